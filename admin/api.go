@@ -0,0 +1,126 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmrpc/server"
+	"net/http"
+	"time"
+)
+
+/*
+管理接口 运行时调整服务端配置 不需要重启
+GET  /admin/config 返回当前配置
+POST /admin/config 只更新请求中出现的字段 所有字段一起生效 返回更新后的配置
+IdleTimeout HandleTimeout SlowThreshold 使用 time.Duration 的字符串形式 例如 "30s"
+接口本身不做鉴权 只应监听在内网地址上
+*/
+
+const ConfigPath = "/admin/config"
+
+type AdminServer struct {
+	rpcServer *server.Server
+}
+
+func NewAdminServer(rpcServer *server.Server) *AdminServer {
+	return &AdminServer{rpcServer: rpcServer}
+}
+
+// GET 的响应与 POST 的请求体 POST 时为空的字段保持不变
+type ConfigBody struct {
+	MaxConcurrent *int     `json:"MaxConcurrent,omitempty"`
+	RateLimit     *float64 `json:"RateLimit,omitempty"`
+	RateBurst     *int     `json:"RateBurst,omitempty"`
+	IdleTimeout   *string  `json:"IdleTimeout,omitempty"`
+	HandleTimeout *string  `json:"HandleTimeout,omitempty"`
+	SlowThreshold *string  `json:"SlowThreshold,omitempty"`
+}
+
+func (a *AdminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != ConfigPath {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeConfig(w, a.rpcServer.Config())
+	case http.MethodPost:
+		var body ConfigBody
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			http.Error(w, "admin: invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		durations, err := body.validate()
+		if err != nil {
+			http.Error(w, "admin: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeConfig(w, a.rpcServer.UpdateConfig(func(c *server.Config) {
+			if body.MaxConcurrent != nil {
+				c.MaxConcurrent = *body.MaxConcurrent
+			}
+			if body.RateLimit != nil {
+				c.RateLimit = *body.RateLimit
+			}
+			if body.RateBurst != nil {
+				c.RateBurst = *body.RateBurst
+			}
+			if d := durations[0]; d != nil {
+				c.IdleTimeout = *d
+			}
+			if d := durations[1]; d != nil {
+				c.HandleTimeout = *d
+			}
+			if d := durations[2]; d != nil {
+				c.SlowThreshold = *d
+			}
+		}))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "admin: method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// 检查取值范围 依次返回解析后的 IdleTimeout HandleTimeout SlowThreshold 未出现的为 nil
+func (b *ConfigBody) validate() ([3]*time.Duration, error) {
+	var durations [3]*time.Duration
+	if b.MaxConcurrent != nil && *b.MaxConcurrent < 0 {
+		return durations, errors.New("MaxConcurrent must not be negative")
+	}
+	if b.RateLimit != nil && *b.RateLimit < 0 {
+		return durations, errors.New("RateLimit must not be negative")
+	}
+	if b.RateBurst != nil && *b.RateBurst < 1 {
+		return durations, errors.New("RateBurst must be positive")
+	}
+	for i, f := range []struct {
+		name  string
+		value *string
+	}{{"IdleTimeout", b.IdleTimeout}, {"HandleTimeout", b.HandleTimeout}, {"SlowThreshold", b.SlowThreshold}} {
+		if f.value == nil {
+			continue
+		}
+		d, err := time.ParseDuration(*f.value)
+		if err != nil || d < 0 {
+			return durations, fmt.Errorf("invalid %s %q", f.name, *f.value)
+		}
+		durations[i] = &d
+	}
+	return durations, nil
+}
+
+func writeConfig(w http.ResponseWriter, c server.Config) {
+	idle, handle, slow := c.IdleTimeout.String(), c.HandleTimeout.String(), c.SlowThreshold.String()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ConfigBody{
+		MaxConcurrent: &c.MaxConcurrent,
+		RateLimit:     &c.RateLimit,
+		RateBurst:     &c.RateBurst,
+		IdleTimeout:   &idle,
+		HandleTimeout: &handle,
+		SlowThreshold: &slow,
+	})
+}
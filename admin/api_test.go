@@ -0,0 +1,195 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Sleeper int
+
+func (s Sleeper) Sleep(d time.Duration, reply *time.Duration) error {
+	time.Sleep(d)
+	*reply = d
+	return nil
+}
+
+func postConfig(url, body string) (*http.Response, ConfigBody) {
+	resp, err := http.Post(url+ConfigPath, "application/json", strings.NewReader(body))
+	_assert(err == nil, "post error: %v", err)
+	defer func() { _ = resp.Body.Close() }()
+	var c ConfigBody
+	if resp.StatusCode == http.StatusOK {
+		_assert(json.NewDecoder(resp.Body).Decode(&c) == nil, "decode response")
+	}
+	return resp, c
+}
+
+func TestAdminServer_MaxConcurrent(t *testing.T) {
+	var sl Sleeper
+	s := server.NewServer()
+	_ = s.Register(&sl)
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+
+	admin := httptest.NewServer(NewAdminServer(s))
+	defer admin.Close()
+	defer http.DefaultClient.CloseIdleConnections()
+
+	c, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = c.Close() }()
+
+	// 未限制时两个请求可以同时处理
+	call := func() error {
+		var reply time.Duration
+		return c.Call(context.Background(), "Sleeper.Sleep", 200*time.Millisecond, &reply)
+	}
+	concurrent := func() (error, error) {
+		errs := make(chan error, 1)
+		go func() { errs <- call() }()
+		time.Sleep(50 * time.Millisecond)
+		err := call()
+		return <-errs, err
+	}
+	err1, err2 := concurrent()
+	_assert(err1 == nil && err2 == nil, "expect both calls to succeed: %v %v", err1, err2)
+
+	resp, cfg := postConfig(admin.URL, `{"MaxConcurrent": 1}`)
+	_assert(resp.StatusCode == http.StatusOK, "expect 200, got %d", resp.StatusCode)
+	_assert(*cfg.MaxConcurrent == 1, "expect MaxConcurrent 1, got %d", *cfg.MaxConcurrent)
+	_assert(s.Config().MaxConcurrent == 1, "config not applied: %+v", s.Config())
+
+	// 之后的请求受新的上限约束
+	err1, err2 = concurrent()
+	_assert(err1 == nil, "first call should succeed: %v", err1)
+	_assert(rpcerr.CodeOf(err2) == rpcerr.Overloaded, "expect Overloaded, got %v", err2)
+
+	get, err := http.Get(admin.URL + ConfigPath)
+	_assert(err == nil, "get error: %v", err)
+	var current ConfigBody
+	_ = json.NewDecoder(get.Body).Decode(&current)
+	_ = get.Body.Close()
+	_assert(*current.MaxConcurrent == 1 && *current.IdleTimeout == "0s", "unexpected config %+v", s.Config())
+
+	// 未出现的字段保持不变
+	resp, cfg = postConfig(admin.URL, `{"IdleTimeout": "30s"}`)
+	_assert(resp.StatusCode == http.StatusOK, "expect 200, got %d", resp.StatusCode)
+	_assert(*cfg.MaxConcurrent == 1 && *cfg.IdleTimeout == "30s", "unexpected config %+v", s.Config())
+}
+
+func TestAdminServer_HandleTimeout(t *testing.T) {
+	var sl Sleeper
+	s := server.NewServer()
+	_ = s.Register(&sl)
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+	defer func() {
+		// 超时后处理函数仍在运行
+		for s.Stats().Inflight > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	admin := httptest.NewServer(NewAdminServer(s))
+	defer admin.Close()
+	defer http.DefaultClient.CloseIdleConnections()
+
+	c, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = c.Close() }()
+	call := func() error {
+		var reply time.Duration
+		return c.Call(context.Background(), "Sleeper.Sleep", 300*time.Millisecond, &reply)
+	}
+
+	// 处理中的请求使用更新前的配置 之后的请求使用新的超时
+	old := make(chan error, 1)
+	go func() { old <- call() }()
+	time.Sleep(50 * time.Millisecond)
+	resp, cfg := postConfig(admin.URL, `{"HandleTimeout": "100ms", "SlowThreshold": "1s"}`)
+	_assert(resp.StatusCode == http.StatusOK, "expect 200, got %d", resp.StatusCode)
+	_assert(*cfg.HandleTimeout == "100ms" && *cfg.SlowThreshold == "1s", "unexpected config %+v", cfg)
+	err = call()
+	_assert(err != nil && strings.Contains(err.Error(), "handle timeout"), "expect handle timeout, got %v", err)
+	_assert(<-old == nil, "in-flight call should finish under the old config")
+
+	rec := httptest.NewRecorder()
+	s.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, server.DebugPath+"/config", nil))
+	var current server.Config
+	_assert(json.NewDecoder(rec.Body).Decode(&current) == nil, "decode debug config")
+	_assert(current.HandleTimeout == 100*time.Millisecond && current.SlowThreshold == time.Second, "unexpected debug config %+v", current)
+}
+
+func TestAdminServer_BadRequest(t *testing.T) {
+	s := server.NewServer()
+	admin := httptest.NewServer(NewAdminServer(s))
+	defer admin.Close()
+	defer http.DefaultClient.CloseIdleConnections()
+
+	for _, body := range []string{
+		`{"MaxConcurrent": -1}`,
+		`{"IdleTimeout": "soon"}`,
+		`{"HandleTimeout": "-1s"}`,
+		`{"Unknown": 1}`,
+		`not json`,
+	} {
+		resp, _ := postConfig(admin.URL, body)
+		_assert(resp.StatusCode == http.StatusBadRequest, "%s: expect 400, got %d", body, resp.StatusCode)
+	}
+	_assert(s.Config() == server.Config{}, "rejected updates should not be applied: %+v", s.Config())
+
+	req, _ := http.NewRequest(http.MethodDelete, admin.URL+ConfigPath, nil)
+	resp, err := http.DefaultClient.Do(req)
+	_assert(err == nil, "delete error: %v", err)
+	_ = resp.Body.Close()
+	_assert(resp.StatusCode == http.StatusMethodNotAllowed, "expect 405, got %d", resp.StatusCode)
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	var sl Sleeper
+	s := server.NewServer()
+	_ = s.Register(&sl)
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+
+	c, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = c.Close() }()
+
+	s.SetIdleTimeout(100 * time.Millisecond)
+	// 处理中的请求不算空闲
+	var reply time.Duration
+	err = c.Call(context.Background(), "Sleeper.Sleep", 300*time.Millisecond, &reply)
+	_assert(err == nil, "in-flight call should not be cut off: %v", err)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for c.IsAvailable() && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	_assert(!c.IsAvailable(), "idle connection should be closed")
+}
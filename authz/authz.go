@@ -0,0 +1,137 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"gmrpc/metadata"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"path"
+	"strings"
+	"time"
+)
+
+/*
+按方法配置的鉴权拦截器
+凭证放在元数据 authorization 中 可带 Bearer 前缀 由 TokenVerifier 校验
+策略表的键为方法名或通配模式 例如 "Admin.*" "*.Get" "*" 精确匹配优先 其次是最长的模式
+没有匹配规则的方法一律拒绝 拒绝时返回 PermissionDenied 不会调用处理函数
+校验通过的 Claims 放入 ctx 之后的拦截器通过 ClaimsFromContext 读取
+*/
+
+const MetadataKey = "authorization"
+
+var (
+	ErrNoToken      = errors.New("rpc authz: missing token")
+	ErrInvalidToken = errors.New("rpc authz: invalid token")
+	ErrExpired      = errors.New("rpc authz: token expired")
+)
+
+type Claims struct {
+	Subject   string            `json:"sub"`
+	Roles     []string          `json:"roles,omitempty"`
+	ExpiresAt int64             `json:"exp,omitempty"` // unix 秒 0 表示不过期
+	Attrs     map[string]string `json:"attrs,omitempty"`
+}
+
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Claims) Expired(now time.Time) bool {
+	return c.ExpiresAt != 0 && now.Unix() >= c.ExpiresAt
+}
+
+// 校验凭证 过期时返回 ErrExpired
+type TokenVerifier interface {
+	Verify(token string) (*Claims, error)
+}
+
+type Rule struct {
+	Public bool              // 不需要凭证
+	Roles  []string          // 满足其一即可 为空表示只要求有效凭证
+	Claims map[string]string // Attrs 中必须全部相同
+}
+
+// 方法名或通配模式 -> 规则 通配符语义同 path.Match
+type Policy map[string]Rule
+
+// 查找方法对应的规则
+func (p Policy) Match(method string) (Rule, bool) {
+	if r, ok := p[method]; ok {
+		return r, true
+	}
+	best, found := "", false
+	for pattern := range p {
+		if ok, _ := path.Match(pattern, method); !ok {
+			continue
+		}
+		if !found || len(pattern) > len(best) || len(pattern) == len(best) && pattern < best {
+			best, found = pattern, true
+		}
+	}
+	return p[best], found
+}
+
+func (r Rule) allow(c *Claims) bool {
+	for k, v := range r.Claims {
+		if c.Attrs[k] != v {
+			return false
+		}
+	}
+	if len(r.Roles) == 0 {
+		return true
+	}
+	for _, role := range r.Roles {
+		if c.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+func NewInterceptor(verifier TokenVerifier, policy Policy) server.ServerInterceptor {
+	return func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		rule, ok := policy.Match(info.ServiceMethod)
+		if !ok {
+			return denied("no policy for %s", info.ServiceMethod)
+		}
+		if rule.Public {
+			return handler(ctx, argv, replyv)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		token := strings.TrimSpace(strings.TrimPrefix(md.Get(MetadataKey), "Bearer "))
+		if token == "" {
+			return denied("%v", ErrNoToken)
+		}
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			return denied("%v", err)
+		}
+		if !rule.allow(claims) {
+			return denied("%s is not allowed to call %s", claims.Subject, info.ServiceMethod)
+		}
+		return handler(context.WithValue(ctx, claimsKey{}, claims), argv, replyv)
+	}
+}
+
+func denied(format string, v ...interface{}) error {
+	return rpcerr.Errorf(rpcerr.PermissionDenied, "rpc authz: permission denied: "+format, v...)
+}
+
+type claimsKey struct{}
+
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(*Claims)
+	return c, ok
+}
+
+// 客户端附加凭证
+func WithToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, MetadataKey, "Bearer "+token)
+}
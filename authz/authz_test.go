@@ -0,0 +1,136 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Admin int
+
+func (a Admin) Reset(n int, reply *int) error {
+	*reply = n
+	return nil
+}
+
+type Calc int
+
+func (c Calc) Add(n int, reply *int) error {
+	*reply = n + 1
+	return nil
+}
+
+func (c Calc) Ping(n int, reply *int) error {
+	*reply = n
+	return nil
+}
+
+func TestPolicy_Match(t *testing.T) {
+	p := Policy{
+		"*":           {Public: true},
+		"Admin.*":     {Roles: []string{"admin"}},
+		"Admin.Reset": {Roles: []string{"root"}},
+	}
+	r, ok := p.Match("Admin.Reset")
+	_assert(ok && r.Roles[0] == "root", "exact match should win, got %+v", r)
+	r, ok = p.Match("Admin.Stop")
+	_assert(ok && r.Roles[0] == "admin", "longest pattern should win, got %+v", r)
+	r, ok = p.Match("Calc.Add")
+	_assert(ok && r.Public, "catch-all should match, got %+v", r)
+	_, ok = Policy{"Admin.*": {}}.Match("Calc.Add")
+	_assert(!ok, "unlisted method should not match")
+}
+
+func TestInterceptor(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	verifier := &HMACVerifier{Key: []byte("secret"), Now: func() time.Time { return now }}
+	seen := make(chan *Claims, 1)
+
+	s := server.NewServer()
+	_ = s.Register(new(Admin))
+	_ = s.Register(new(Calc))
+	s.Use(NewInterceptor(verifier, Policy{
+		"Admin.*":   {Roles: []string{"admin"}},
+		"Calc.Add":  {Claims: map[string]string{"tenant": "acme"}},
+		"Calc.Ping": {Public: true},
+	}))
+	s.Use(func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		if c, ok := ClaimsFromContext(ctx); ok {
+			seen <- c
+		}
+		return handler(ctx, argv, replyv)
+	})
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+	c, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = c.Close() }()
+
+	token := func(claims Claims) context.Context {
+		tok, err := verifier.Sign(claims)
+		_assert(err == nil, "sign error: %v", err)
+		return WithToken(context.Background(), tok)
+	}
+	call := func(ctx context.Context, method string) error {
+		var reply int
+		return c.Call(ctx, method, 1, &reply)
+	}
+	isDenied := func(err error) bool {
+		return rpcerr.CodeOf(err) == rpcerr.PermissionDenied
+	}
+
+	admin := token(Claims{Subject: "alice", Roles: []string{"admin"}, ExpiresAt: now.Add(time.Hour).Unix()})
+	err = call(admin, "Admin.Reset")
+	_assert(err == nil, "admin should be allowed: %v", err)
+	got := <-seen
+	_assert(got.Subject == "alice", "claims should be available in ctx, got %+v", got)
+
+	// 通配符
+	user := token(Claims{Subject: "bob", Roles: []string{"user"}, Attrs: map[string]string{"tenant": "acme"}})
+	_assert(isDenied(call(user, "Admin.Reset")), "Admin.* should require the admin role")
+	_assert(call(user, "Calc.Add") == nil, "matching claim should be allowed")
+	<-seen
+	other := token(Claims{Subject: "eve", Attrs: map[string]string{"tenant": "other"}})
+	_assert(isDenied(call(other, "Calc.Add")), "mismatched claim should be denied")
+
+	expired := token(Claims{Subject: "alice", Roles: []string{"admin"}, ExpiresAt: now.Add(-time.Second).Unix()})
+	err = call(expired, "Admin.Reset")
+	_assert(isDenied(err) && errors.Is(err, rpcerr.New(rpcerr.PermissionDenied, "")), "expired token should be denied, got %v", err)
+
+	_assert(isDenied(call(context.Background(), "Admin.Reset")), "missing token should be denied")
+	_assert(isDenied(call(WithToken(context.Background(), "forged.token"), "Admin.Reset")), "bad signature should be denied")
+	_assert(call(context.Background(), "Calc.Ping") == nil, "public method should not need a token")
+}
+
+func TestJWTVerifier(t *testing.T) {
+	v := &JWTVerifier{Key: []byte("k")}
+	tok, err := v.Sign(Claims{Subject: "alice", Roles: []string{"admin"}, ExpiresAt: time.Now().Add(time.Minute).Unix(), Attrs: map[string]string{"tenant": "acme"}})
+	_assert(err == nil, "sign error: %v", err)
+	c, err := v.Verify(tok)
+	_assert(err == nil && c.Subject == "alice" && c.HasRole("admin") && c.Attrs["tenant"] == "acme", "unexpected claims %+v (%v)", c, err)
+
+	_, err = (&JWTVerifier{Key: []byte("other")}).Verify(tok)
+	_assert(errors.Is(err, ErrInvalidToken), "wrong key should fail, got %v", err)
+	tok, _ = v.Sign(Claims{Subject: "alice", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	_, err = v.Verify(tok)
+	_assert(errors.Is(err, ErrExpired), "expired jwt should fail, got %v", err)
+}
@@ -0,0 +1,87 @@
+package authz
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HS256 签名的 JWT 只使用标准库
+// sub exp roles 对应 Claims 的同名字段 其余字符串类型的声明放入 Attrs
+type JWTVerifier struct {
+	Key []byte
+	Now func() time.Time
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func (v *JWTVerifier) Sign(c Claims) (string, error) {
+	m := make(map[string]interface{}, len(c.Attrs)+3)
+	for k, val := range c.Attrs {
+		m[k] = val
+	}
+	m["sub"] = c.Subject
+	if len(c.Roles) > 0 {
+		m["roles"] = c.Roles
+	}
+	if c.ExpiresAt != 0 {
+		m["exp"] = c.ExpiresAt
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + sign(v.Key, signed), nil
+}
+
+func (v *JWTVerifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed jwt", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if data, err := base64.RawURLEncoding.DecodeString(parts[0]); err != nil || json.Unmarshal(data, &header) != nil || header.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: unsupported jwt header", ErrInvalidToken)
+	}
+	payload, err := verifySigned(v.Key, token)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	var c Claims
+	for k, val := range raw {
+		var err error
+		switch k {
+		case "sub":
+			err = json.Unmarshal(val, &c.Subject)
+		case "roles":
+			err = json.Unmarshal(val, &c.Roles)
+		case "exp":
+			var exp float64
+			err = json.Unmarshal(val, &exp)
+			c.ExpiresAt = int64(exp)
+		default:
+			var s string
+			if json.Unmarshal(val, &s) == nil {
+				if c.Attrs == nil {
+					c.Attrs = make(map[string]string)
+				}
+				c.Attrs[k] = s
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: claim %s: %v", ErrInvalidToken, k, err)
+		}
+	}
+	return checkExpiry(&c, v.Now)
+}
+
+var _ TokenVerifier = (*JWTVerifier)(nil)
@@ -0,0 +1,84 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"gmrpc/client"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+/*
+广播调用 将同一个请求同时发往所有服务端 适用于清理缓存 重新加载配置等场景
+*/
+
+type BroadcastClient struct {
+	clients []*client.Client
+}
+
+func NewBroadcastClient(clients ...*client.Client) *BroadcastClient {
+	return &BroadcastClient{clients: clients}
+}
+
+// 并发调用所有服务端 replies 与 clients 一一对应 返回每个服务端的错误
+func (b *BroadcastClient) Call(ctx context.Context, method string, args interface{}, replies []interface{}) []error {
+	errs := make([]error, len(b.clients))
+	if len(replies) != len(b.clients) {
+		err := errors.New("rpc broadcast: number of replies does not match number of clients")
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range b.clients {
+		wg.Add(1)
+		go func(i int, c *client.Client) {
+			defer wg.Done()
+			errs[i] = c.Call(ctx, method, args, replies[i])
+		}(i, c)
+	}
+	wg.Wait()
+	return errs
+}
+
+// 返回第一个成功的结果 并取消其余仍在进行的调用 全部失败时返回汇总的错误
+func (b *BroadcastClient) CallAny(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	if len(b.clients) == 0 {
+		return errors.New("rpc broadcast: no clients")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		reply interface{}
+		err   error
+	}
+	results := make(chan result, len(b.clients))
+	replyType := reflect.TypeOf(reply)
+	for _, c := range b.clients {
+		go func(c *client.Client) {
+			// 每个调用使用独立的 reply 避免并发写入
+			r := reply
+			if replyType != nil && replyType.Kind() == reflect.Ptr {
+				r = reflect.New(replyType.Elem()).Interface()
+			}
+			results <- result{reply: r, err: c.Call(ctx, method, args, r)}
+		}(c)
+	}
+
+	var msgs []string
+	for range b.clients {
+		res := <-results
+		if res.err == nil {
+			if res.reply != reply {
+				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(res.reply).Elem())
+			}
+			return nil
+		}
+		msgs = append(msgs, res.err.Error())
+	}
+	return errors.New("rpc broadcast: all calls failed: " + strings.Join(msgs, "; "))
+}
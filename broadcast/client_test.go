@@ -0,0 +1,97 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"net"
+	"testing"
+	"time"
+)
+
+type Node struct {
+	name  string
+	delay time.Duration
+	fail  bool
+}
+
+func (n *Node) Reload(version int, reply *string) error {
+	time.Sleep(n.delay)
+	if n.fail {
+		return errors.New("reload failed on " + n.name)
+	}
+	*reply = fmt.Sprintf("%s@%d", n.name, version)
+	return nil
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+func dialNode(n *Node) *client.Client {
+	s := server.NewServer()
+	_ = s.Register(n)
+	l, _ := net.Listen("tcp", ":0")
+	go s.Accept(l)
+	c, _ := client.Dial("tcp", l.Addr().String())
+	return c
+}
+
+func TestBroadcastClient_Call(t *testing.T) {
+	t.Run("all succeed", func(t *testing.T) {
+		c1, c2, c3 := dialNode(&Node{name: "a"}), dialNode(&Node{name: "b"}), dialNode(&Node{name: "c"})
+		b := NewBroadcastClient(c1, c2, c3)
+
+		replies := []interface{}{new(string), new(string), new(string)}
+		errs := b.Call(context.Background(), "Node.Reload", 7, replies)
+		for i, want := range []string{"a@7", "b@7", "c@7"} {
+			_assert(errs[i] == nil, "expect no error from %d, got %v", i, errs[i])
+			_assert(*replies[i].(*string) == want, "expect %s, got %s", want, *replies[i].(*string))
+		}
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		c1, c2, c3 := dialNode(&Node{name: "a"}), dialNode(&Node{name: "b", fail: true}), dialNode(&Node{name: "c"})
+		_ = c3.Close()
+		b := NewBroadcastClient(c1, c2, c3)
+
+		replies := []interface{}{new(string), new(string), new(string)}
+		errs := b.Call(context.Background(), "Node.Reload", 1, replies)
+		_assert(errs[0] == nil && *replies[0].(*string) == "a@1", "expect first node to succeed, got %v", errs[0])
+		_assert(errs[1] != nil && errs[1].Error() == "reload failed on b", "expect handler error, got %v", errs[1])
+		_assert(errors.Is(errs[2], client.ErrShutdown), "expect shutdown error, got %v", errs[2])
+	})
+}
+
+func TestBroadcastClient_CallAny(t *testing.T) {
+	t.Run("first success wins", func(t *testing.T) {
+		slow, fast := dialNode(&Node{name: "slow", delay: time.Second}), dialNode(&Node{name: "fast"})
+		b := NewBroadcastClient(slow, fast)
+
+		var reply string
+		start := time.Now()
+		err := b.CallAny(context.Background(), "Node.Reload", 2, &reply)
+		_assert(err == nil && reply == "fast@2", "expect fast reply, got %q (%v)", reply, err)
+		_assert(time.Since(start) < 500*time.Millisecond, "expect slow call to be abandoned")
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		bad, good := dialNode(&Node{name: "bad", fail: true}), dialNode(&Node{name: "good", delay: 50 * time.Millisecond})
+		b := NewBroadcastClient(bad, good)
+
+		var reply string
+		err := b.CallAny(context.Background(), "Node.Reload", 3, &reply)
+		_assert(err == nil && reply == "good@3", "expect good reply, got %q (%v)", reply, err)
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		b := NewBroadcastClient(dialNode(&Node{name: "x", fail: true}), dialNode(&Node{name: "y", fail: true}))
+		var reply string
+		err := b.CallAny(context.Background(), "Node.Reload", 4, &reply)
+		_assert(err != nil && reply == "", "expect aggregated error, got %v", err)
+	})
+}
@@ -0,0 +1,161 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+带结果汇总的广播 默认要求全部成功 任一失败立即取消其余调用
+	Quorum(n)   n 个服务端成功即返回 并取消其余调用 剩余的服务端不足以达到 n 时立即失败
+	BestEffort  等待所有调用结束 至少一个成功即视为成功
+每个服务端的结果都会记录 被取消的调用也不例外
+*/
+
+var (
+	// 结果已经确定 调用被主动取消
+	ErrAbandoned = errors.New("rpc broadcast: call abandoned")
+	// 成功的服务端数量无法达到要求
+	ErrQuorumUnreachable = errors.New("rpc broadcast: quorum unreachable")
+)
+
+type mode int
+
+const (
+	modeAll mode = iota
+	modeQuorum
+	modeBestEffort
+)
+
+type broadcastConfig struct {
+	mode   mode
+	quorum int
+}
+
+type BroadcastOption func(*broadcastConfig)
+
+func Quorum(n int) BroadcastOption {
+	return func(c *broadcastConfig) {
+		c.mode, c.quorum = modeQuorum, n
+	}
+}
+
+func BestEffort() BroadcastOption {
+	return func(c *broadcastConfig) {
+		c.mode = modeBestEffort
+	}
+}
+
+// 单个服务端的结果
+type ServerResult struct {
+	Reply   interface{} // 成功时为与 reply 同类型的新值
+	Err     error       // 调用方 ctx 取消时包装 ctx.Err() 主动取消时为 ErrAbandoned
+	Latency time.Duration
+}
+
+type BroadcastResult struct {
+	Results   []ServerResult // 与 clients 一一对应
+	Succeeded int
+}
+
+// 成功的回复 按 clients 的顺序
+func (r *BroadcastResult) Replies() []interface{} {
+	var replies []interface{}
+	for _, res := range r.Results {
+		if res.Err == nil {
+			replies = append(replies, res.Reply)
+		}
+	}
+	return replies
+}
+
+// 并发调用所有服务端 reply 只用于确定回复的类型 不会被写入
+// 返回的错误表示没有满足选项要求的条件 此时结果仍然有效
+func (b *BroadcastClient) Broadcast(ctx context.Context, method string, args interface{}, reply interface{}, opts ...BroadcastOption) (*BroadcastResult, error) {
+	cfg := broadcastConfig{mode: modeAll}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	n := len(b.clients)
+	need := n
+	switch cfg.mode {
+	case modeQuorum:
+		need = cfg.quorum
+	case modeBestEffort:
+		need = 1
+	}
+	result := &BroadcastResult{Results: make([]ServerResult, n)}
+	if n == 0 {
+		return result, errors.New("rpc broadcast: no clients")
+	}
+	if need < 1 || need > n {
+		return result, fmt.Errorf("%w: need %d of %d", ErrQuorumUnreachable, need, n)
+	}
+
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type done struct {
+		i   int
+		res ServerResult
+	}
+	results := make(chan done, n)
+	var wg sync.WaitGroup
+	replyType := reflect.TypeOf(reply)
+	start := time.Now()
+	for i, c := range b.clients {
+		wg.Add(1)
+		go func(i int, c *client.Client) {
+			defer wg.Done()
+			r := reply
+			if replyType != nil && replyType.Kind() == reflect.Ptr {
+				r = reflect.New(replyType.Elem()).Interface()
+			}
+			err := c.Call(callCtx, method, args, r)
+			res := ServerResult{Latency: time.Since(start)}
+			switch {
+			case err == nil:
+				res.Reply = r
+			case ctx.Err() == nil && callCtx.Err() != nil:
+				res.Err = ErrAbandoned
+			default:
+				res.Err = err
+			}
+			results <- done{i, res}
+		}(i, c)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// 结果确定后取消其余调用 并等待它们结束 以记录每个服务端的结果
+	failed, decided := 0, false
+	for d := range results {
+		result.Results[d.i] = d.res
+		if d.res.Err == nil {
+			result.Succeeded++
+		} else {
+			failed++
+		}
+		if !decided && (result.Succeeded >= need && cfg.mode != modeBestEffort || n-failed < need) {
+			decided = true
+			cancel()
+		}
+	}
+	if result.Succeeded >= need {
+		return result, nil
+	}
+	var msgs []string
+	for i, res := range result.Results {
+		if res.Err != nil && res.Err != ErrAbandoned {
+			msgs = append(msgs, fmt.Sprintf("#%d: %v", i, res.Err))
+		}
+	}
+	return result, fmt.Errorf("%w: %d of %d succeeded, need %d: %s", ErrQuorumUnreachable, result.Succeeded, n, need, strings.Join(msgs, "; "))
+}
@@ -0,0 +1,66 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"gmrpc/client"
+	"testing"
+	"time"
+)
+
+func TestBroadcastClient_Broadcast(t *testing.T) {
+	t.Run("quorum met early", func(t *testing.T) {
+		b := NewBroadcastClient(dialNode(&Node{name: "a"}), dialNode(&Node{name: "slow", delay: time.Second}), dialNode(&Node{name: "c"}))
+		var reply string
+		start := time.Now()
+		res, err := b.Broadcast(context.Background(), "Node.Reload", 5, &reply, Quorum(2))
+		_assert(err == nil && res.Succeeded == 2, "expect quorum, got %d (%v)", res.Succeeded, err)
+		_assert(time.Since(start) < 500*time.Millisecond, "expect slow call to be canceled")
+		_assert(*res.Results[0].Reply.(*string) == "a@5" && *res.Results[2].Reply.(*string) == "c@5", "unexpected replies %v", res.Replies())
+		_assert(errors.Is(res.Results[1].Err, ErrAbandoned), "expect slow call to be abandoned, got %v", res.Results[1].Err)
+		_assert(reply == "", "reply prototype should not be written")
+	})
+
+	t.Run("quorum impossible", func(t *testing.T) {
+		b := NewBroadcastClient(dialNode(&Node{name: "x", fail: true}), dialNode(&Node{name: "y", fail: true}), dialNode(&Node{name: "slow", delay: time.Second}))
+		var reply string
+		start := time.Now()
+		res, err := b.Broadcast(context.Background(), "Node.Reload", 6, &reply, Quorum(2))
+		_assert(errors.Is(err, ErrQuorumUnreachable), "expect quorum unreachable, got %v", err)
+		_assert(time.Since(start) < 500*time.Millisecond, "expect to fail fast")
+		_assert(res.Results[0].Err != nil && res.Results[1].Err != nil && errors.Is(res.Results[2].Err, ErrAbandoned), "unexpected results %+v", res.Results)
+
+		_, err = b.Broadcast(context.Background(), "Node.Reload", 6, &reply, Quorum(4))
+		_assert(errors.Is(err, ErrQuorumUnreachable), "quorum larger than clients should fail, got %v", err)
+	})
+
+	t.Run("best effort with a dead server", func(t *testing.T) {
+		dead := dialNode(&Node{name: "dead"})
+		_ = dead.Close()
+		b := NewBroadcastClient(dialNode(&Node{name: "a", delay: 50 * time.Millisecond}), dead, dialNode(&Node{name: "c"}))
+		var reply string
+		res, err := b.Broadcast(context.Background(), "Node.Reload", 7, &reply, BestEffort())
+		_assert(err == nil && res.Succeeded == 2, "expect 2 successes, got %d (%v)", res.Succeeded, err)
+		_assert(errors.Is(res.Results[1].Err, client.ErrShutdown), "expect shutdown error, got %v", res.Results[1].Err)
+		_assert(res.Results[0].Latency >= 50*time.Millisecond, "latency should be recorded, got %v", res.Results[0].Latency)
+		_assert(len(res.Replies()) == 2, "expect 2 replies, got %v", res.Replies())
+	})
+
+	t.Run("all or nothing", func(t *testing.T) {
+		b := NewBroadcastClient(dialNode(&Node{name: "a"}), dialNode(&Node{name: "b", fail: true}))
+		var reply string
+		res, err := b.Broadcast(context.Background(), "Node.Reload", 8, &reply)
+		_assert(errors.Is(err, ErrQuorumUnreachable) && res.Succeeded <= 1, "expect failure, got %v", err)
+	})
+
+	t.Run("caller deadline", func(t *testing.T) {
+		b := NewBroadcastClient(dialNode(&Node{name: "a"}), dialNode(&Node{name: "slow", delay: time.Second}))
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		var reply string
+		res, err := b.Broadcast(ctx, "Node.Reload", 9, &reply, BestEffort())
+		_assert(err == nil && res.Succeeded == 1, "expect 1 success, got %d (%v)", res.Succeeded, err)
+		slow := res.Results[1].Err
+		_assert(errors.Is(slow, context.DeadlineExceeded) && !errors.Is(slow, ErrAbandoned), "expect caller deadline, got %v", slow)
+	})
+}
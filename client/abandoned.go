@@ -0,0 +1,27 @@
+package client
+
+import "log"
+
+/*
+Go 的 Done 通道已满时结果不再阻塞接收循环 而是放入溢出列表 泄漏可以被发现而不是静默发生
+没有人读取的 Done 通道会一直持有已完成的 Call 通过 Stats().Abandoned 与 AbandonedCalls 观察
+*/
+
+func (client *Client) abandon(call *Call) {
+	client.abandonedLog.Do(func() {
+		log.Printf("rpc client: Done channel of %s is full, moving completed calls to AbandonedCalls", call.ServiceMethod)
+	})
+	client.abandonedMu.Lock()
+	defer client.abandonedMu.Unlock()
+	client.abandoned = append(client.abandoned, call)
+	client.abandonedTotal++
+}
+
+// 取走因 Done 已满而无法投递的调用 按完成顺序排列
+func (client *Client) AbandonedCalls() []*Call {
+	client.abandonedMu.Lock()
+	defer client.abandonedMu.Unlock()
+	calls := client.abandoned
+	client.abandoned = nil
+	return calls
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Done 容量为 1 且无人读取 之后的调用仍能完成 溢出的调用可以取回
+func TestClient_AbandonedCalls(t *testing.T) {
+	var s Sleeper
+	addr := startTestServer(t, &s)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	done := make(chan *Call, 1)
+	const n = 5
+	for i := 1; i <= n; i++ {
+		var reply time.Duration
+		client.Go("Sleeper.Sleep", time.Duration(0), &reply, done)
+		// 接收循环没有阻塞在 Done 上 每个结果都被投递或放入溢出列表
+		deadline := time.Now().Add(time.Second)
+		for len(done)+int(client.Stats().Abandoned) < i {
+			_assert(time.Now().Before(deadline), "call %d not completed", i)
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	var reply time.Duration
+	err = client.Call(context.Background(), "Sleeper.Sleep", time.Millisecond, &reply)
+	_assert(err == nil && reply == time.Millisecond, "call after overflow: %v %v", err, reply)
+
+	_assert(client.Stats().Abandoned == n-1, "abandoned count: %d", client.Stats().Abandoned)
+	calls := client.AbandonedCalls()
+	_assert(len(calls) == n-1, "abandoned calls: %d", len(calls))
+	for _, call := range calls {
+		_assert(call.Error == nil, "abandoned call error: %v", call.Error)
+	}
+	_assert(len(client.AbandonedCalls()) == 0, "abandoned calls not drained")
+	_assert(client.Stats().Abandoned == n-1, "total reset by drain")
+	_assert(len(done) == 1, "first call not delivered")
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"gmrpc/service"
+	"sync"
+	"time"
+)
+
+/*
+自适应超时 按方法统计成功调用的耗时 超时时间取分位数乘以系数 并限制在上下限之间
+失败的调用不计入 超时的调用耗时接近超时时间 计入后学习到的值会越来越大
+样本不足时使用持久化恢复的值或固定的默认值 调用方设置了截止时间时不覆盖
+*/
+
+// 持久化学习到的超时时间 例如在重启之间保存
+type TimeoutStore interface {
+	Load() (map[string]time.Duration, error)
+	Save(timeouts map[string]time.Duration) error
+}
+
+type AdaptiveTimeout struct {
+	Percentile float64       // 使用的分位数 0~100 默认 99
+	Multiplier float64       // 系数 默认 2
+	Floor      time.Duration // 下限
+	Ceiling    time.Duration // 上限 0 表示不限制
+	MinSamples int64         // 样本数达到后才使用学习到的值 默认 100
+	Default    time.Duration // 样本不足时的超时 0 表示不设置
+	Store      TimeoutStore  // 可选 启用时加载 SaveAdaptiveTimeouts 时保存
+}
+
+type adaptiveTimeouts struct {
+	cfg AdaptiveTimeout
+
+	mu       sync.Mutex
+	methods  map[string]*service.LatencyTracker
+	restored map[string]time.Duration
+}
+
+// 开启自适应超时 配置了 Store 时加载之前保存的值
+func WithAdaptiveTimeout(cfg AdaptiveTimeout) ClientOption {
+	if cfg.Percentile <= 0 || cfg.Percentile > 100 {
+		cfg.Percentile = 99
+	}
+	if cfg.Multiplier <= 0 {
+		cfg.Multiplier = 2
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = 100
+	}
+	a := &adaptiveTimeouts{
+		cfg:     cfg,
+		methods: make(map[string]*service.LatencyTracker),
+	}
+	if cfg.Store != nil {
+		if restored, err := cfg.Store.Load(); err == nil {
+			a.restored = restored
+		}
+	}
+	return func(client *Client) {
+		client.adaptive = a
+	}
+}
+
+func (a *adaptiveTimeouts) tracker(serviceMethod string) *service.LatencyTracker {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t := a.methods[serviceMethod]
+	if t == nil {
+		t = new(service.LatencyTracker)
+		a.methods[serviceMethod] = t
+	}
+	return t
+}
+
+func (a *adaptiveTimeouts) record(serviceMethod string, d time.Duration) {
+	a.tracker(serviceMethod).Record(d.Nanoseconds())
+}
+
+func (a *adaptiveTimeouts) clamp(d time.Duration) time.Duration {
+	if d < a.cfg.Floor {
+		d = a.cfg.Floor
+	}
+	if a.cfg.Ceiling > 0 && d > a.cfg.Ceiling {
+		d = a.cfg.Ceiling
+	}
+	return d
+}
+
+// 学习到的超时时间 ok 为 false 表示样本不足且没有恢复的值
+func (a *adaptiveTimeouts) learned(serviceMethod string) (time.Duration, bool) {
+	t := a.tracker(serviceMethod)
+	if t.Count() >= a.cfg.MinSamples {
+		p := float64(t.Percentile(a.cfg.Percentile)) * a.cfg.Multiplier
+		return a.clamp(time.Duration(p)), true
+	}
+	a.mu.Lock()
+	d, ok := a.restored[serviceMethod]
+	a.mu.Unlock()
+	if ok {
+		return a.clamp(d), true
+	}
+	return 0, false
+}
+
+func (a *adaptiveTimeouts) timeout(serviceMethod string) time.Duration {
+	if d, ok := a.learned(serviceMethod); ok {
+		return d
+	}
+	return a.cfg.Default
+}
+
+func (a *adaptiveTimeouts) snapshot() map[string]time.Duration {
+	a.mu.Lock()
+	names := make([]string, 0, len(a.methods)+len(a.restored))
+	for name := range a.methods {
+		names = append(names, name)
+	}
+	for name := range a.restored {
+		if a.methods[name] == nil {
+			names = append(names, name)
+		}
+	}
+	a.mu.Unlock()
+
+	out := make(map[string]time.Duration, len(names))
+	for _, name := range names {
+		if d, ok := a.learned(name); ok {
+			out[name] = d
+		}
+	}
+	return out
+}
+
+// 未设置截止时间时按学习到的值设置
+func (a *adaptiveTimeouts) withTimeout(ctx context.Context, serviceMethod string) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	if d := a.timeout(serviceMethod); d > 0 {
+		return withAttemptTimeout(ctx, d)
+	}
+	return ctx, func() {}
+}
+
+func (client *Client) adaptiveTimeouts() *adaptiveTimeouts {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.adaptive
+}
+
+// 保存学习到的超时时间 未开启或未配置 Store 时什么都不做
+func (client *Client) SaveAdaptiveTimeouts() error {
+	a := client.adaptiveTimeouts()
+	if a == nil || a.cfg.Store == nil {
+		return nil
+	}
+	return a.cfg.Store.Save(a.snapshot())
+}
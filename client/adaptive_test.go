@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"gmrpc/rpcerr"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memoryTimeoutStore struct {
+	saved map[string]time.Duration
+}
+
+func (s *memoryTimeoutStore) Load() (map[string]time.Duration, error) {
+	return s.saved, nil
+}
+
+func (s *memoryTimeoutStore) Save(timeouts map[string]time.Duration) error {
+	s.saved = timeouts
+	return nil
+}
+
+func newAdaptive(cfg AdaptiveTimeout) *adaptiveTimeouts {
+	c := &Client{}
+	WithAdaptiveTimeout(cfg)(c)
+	return c.adaptive
+}
+
+func within(d, want time.Duration) bool {
+	return d >= want*97/100 && d <= want*103/100
+}
+
+func TestAdaptiveTimeout_TracksDistribution(t *testing.T) {
+	a := newAdaptive(AdaptiveTimeout{MinSamples: 200, Default: time.Second})
+	rng := rand.New(rand.NewSource(1))
+
+	// 样本不足时使用默认值
+	for i := 0; i < 199; i++ {
+		a.record("Svc.Fast", time.Duration(10+rng.Intn(10))*time.Millisecond)
+	}
+	_assert(a.timeout("Svc.Fast") == time.Second, "expect default timeout, got %v", a.timeout("Svc.Fast"))
+
+	// 10~20ms 均匀分布 p99 约 20ms 两倍约 40ms
+	for i := 0; i < 1000; i++ {
+		a.record("Svc.Fast", 10*time.Millisecond+time.Duration(rng.Int63n(int64(10*time.Millisecond))))
+	}
+	d := a.timeout("Svc.Fast")
+	_assert(within(d, 40*time.Millisecond), "expect about 40ms, got %v", d)
+
+	// 分布变慢后超时随之增大
+	for i := 0; i < 5000; i++ {
+		a.record("Svc.Fast", 100*time.Millisecond+time.Duration(rng.Int63n(int64(100*time.Millisecond))))
+	}
+	d = a.timeout("Svc.Fast")
+	_assert(within(d, 400*time.Millisecond), "expect about 400ms, got %v", d)
+	_assert(a.timeout("Svc.Other") == time.Second, "other methods keep the default")
+}
+
+func TestAdaptiveTimeout_Bounds(t *testing.T) {
+	a := newAdaptive(AdaptiveTimeout{MinSamples: 10, Floor: 50 * time.Millisecond, Ceiling: 200 * time.Millisecond, Multiplier: 3})
+	for i := 0; i < 100; i++ {
+		a.record("Svc.Fast", time.Millisecond)
+		a.record("Svc.Slow", time.Second)
+	}
+	_assert(a.timeout("Svc.Fast") == 50*time.Millisecond, "floor not applied: %v", a.timeout("Svc.Fast"))
+	_assert(a.timeout("Svc.Slow") == 200*time.Millisecond, "ceiling not applied: %v", a.timeout("Svc.Slow"))
+	_assert(a.timeout("Svc.None") == 0, "expect no timeout without samples and default")
+}
+
+func TestAdaptiveTimeout_Store(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c, new(Sleeper))
+	store := &memoryTimeoutStore{}
+
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	client.Apply(WithAdaptiveTimeout(AdaptiveTimeout{MinSamples: 20, Floor: 20 * time.Millisecond, Store: store}))
+	for i := 0; i < 20; i++ {
+		var reply int
+		_assert(client.Call(context.Background(), "Calc.Add", AddArgs{Num1: i}, &reply) == nil, "call failed")
+	}
+	learned := client.Stats().AdaptiveTimeouts["Calc.Add"]
+	_assert(learned >= 20*time.Millisecond, "expect learned timeout in stats, got %v", client.Stats().AdaptiveTimeouts)
+	_assert(client.SaveAdaptiveTimeouts() == nil && store.saved["Calc.Add"] == learned, "unexpected saved values %v", store.saved)
+	_ = client.Close()
+
+	// 新的客户端直接使用恢复的值 慢调用因此超时
+	store.saved["Sleeper.Sleep"] = 30 * time.Millisecond
+	client, err = Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	client.Apply(WithAdaptiveTimeout(AdaptiveTimeout{Store: store, Floor: 20 * time.Millisecond}))
+	_assert(client.Stats().AdaptiveTimeouts["Calc.Add"] == learned, "restored value missing: %v", client.Stats().AdaptiveTimeouts)
+	var reply time.Duration
+	err = client.Call(context.Background(), "Sleeper.Sleep", 300*time.Millisecond, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), "deadline exceeded"), "expect restored timeout to apply, got %v", err)
+	_assert(rpcerr.TimeoutSource(err) == rpcerr.TimeoutAttempt, "adaptive timeout should be attributed to the attempt: %v", err)
+
+	// 调用方设置的截止时间优先
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = client.Call(ctx, "Sleeper.Sleep", 50*time.Millisecond, &reply)
+	_assert(err == nil, "caller deadline should override adaptive timeout: %v", err)
+}
+
+// 只统计成功的调用 超时的耗时不会推高学习到的值
+func TestAdaptiveTimeout_OnlySuccesses(t *testing.T) {
+	client, err := Dial("tcp", startTestServer(t, new(Sleeper)))
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	client.Apply(WithAdaptiveTimeout(AdaptiveTimeout{Default: 30 * time.Millisecond}))
+
+	var reply time.Duration
+	for i := 0; i < 3; i++ {
+		err = client.Call(context.Background(), "Sleeper.Sleep", 100*time.Millisecond, &reply)
+		_assert(err != nil, "expect the default timeout to apply")
+	}
+	_assert(client.adaptive.tracker("Sleeper.Sleep").Count() == 0, "failed calls should not be recorded")
+	_assert(client.Call(context.Background(), "Sleeper.Sleep", time.Millisecond, &reply) == nil, "call failed")
+	_assert(client.adaptive.tracker("Sleeper.Sleep").Count() == 1, "successful call should be recorded")
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+	"reflect"
+)
+
+// 客户端选项 通过 Apply 设置
+type ClientOption func(client *Client)
+
+func (client *Client) Apply(opts ...ClientOption) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	for _, opt := range opts {
+		opt(client)
+	}
+}
+
+// 发送前深拷贝参数 调用方可以在 Go 返回后立即复用参数
+// 默认通过 gob 编码再解码到同一类型 无法编码的参数原样发送
+func WithArgCopy() ClientOption {
+	return WithArgCopier(gobCopy)
+}
+
+// 使用自定义的拷贝函数 fn 为空时关闭拷贝
+func WithArgCopier(fn func(interface{}) interface{}) ClientOption {
+	return func(client *Client) {
+		client.argCopier = fn
+	}
+}
+
+func (client *Client) copyArgs(call *Call) {
+	client.mu.Lock()
+	copier := client.argCopier
+	client.mu.Unlock()
+	if copier == nil || call.Args == nil {
+		return
+	}
+	// 流式参数只能读取一次 不拷贝
+	if _, ok := streamingArg(call.Args); ok {
+		return
+	}
+	call.Args = copier(call.Args)
+}
+
+func gobCopy(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).EncodeValue(rv); err != nil {
+		log.Println("rpc client: copy args error:", err)
+		return v
+	}
+	out := reflect.New(rv.Type())
+	if err := gob.NewDecoder(&buf).DecodeValue(out); err != nil {
+		log.Println("rpc client: copy args error:", err)
+		return v
+	}
+	return out.Elem().Interface()
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient_ArgCopy(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	client.Apply(WithArgCopy())
+
+	// 两次 Go 调用复用同一个参数指针 每次调用看到的是发送时的值
+	args := &AddArgs{Num1: 1, Num2: 1}
+	var r1, r2 int
+	call1 := client.Go("Calc.Add", args, &r1, nil)
+	args.Num1 = 5
+	call2 := client.Go("Calc.Add", args, &r2, nil)
+	args.Num1 = 100
+	<-call1.Done
+	<-call2.Done
+	_assert(call1.Error == nil && r1 == 2, "first call saw %d (%v)", r1, call1.Error)
+	_assert(call2.Error == nil && r2 == 6, "second call saw %d (%v)", r2, call2.Error)
+	copied, ok := call1.Args.(*AddArgs)
+	_assert(ok && copied != args && copied.Num1 == 1, "args were not copied: %#v", call1.Args)
+
+	// 自定义拷贝函数
+	var copies int32
+	client.Apply(WithArgCopier(func(v interface{}) interface{} {
+		atomic.AddInt32(&copies, 1)
+		a := *v.(*AddArgs)
+		return &a
+	}))
+	call := <-client.Go("Calc.Add", args, &r1, nil).Done
+	_assert(call.Error == nil && r1 == 101, "unexpected result %d (%v)", r1, call.Error)
+	_assert(atomic.LoadInt32(&copies) == 1, "custom copier called %d times", copies)
+
+	// 关闭拷贝
+	client.Apply(WithArgCopier(nil))
+	call = <-client.Go("Calc.Add", args, &r1, nil).Done
+	_assert(call.Args == args, "args should not be copied")
+}
+
+func TestGobCopy(t *testing.T) {
+	in := map[string][]int{"a": {1, 2}}
+	out := gobCopy(in).(map[string][]int)
+	in["a"][0] = 9
+	_assert(out["a"][0] == 1 && len(out["a"]) == 2, "map was not deep copied: %v", out)
+
+	// 无法编码的值原样返回
+	ch := make(chan int)
+	_assert(gobCopy(ch).(chan int) == ch, "unencodable value should be returned as is")
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"gmrpc/server"
+	"strings"
+)
+
+// 读取服务端握手后发送的能力通告 见 server.Capabilities 附带协议协商结果时一并返回
+func readCapabilities(r *bufio.Reader) (map[string][]string, *server.ProtocolAck, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, nil, err
+	}
+	// 服务端拒绝连接时回复 server.HandshakeError
+	var caps struct {
+		server.Capabilities
+		*server.ProtocolAck
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(line, &caps); err != nil {
+		return nil, nil, err
+	}
+	if caps.Error != "" {
+		return nil, nil, errors.New(caps.Error)
+	}
+	if caps.Services == nil {
+		caps.Services = make(map[string][]string)
+	}
+	return caps.Services, caps.ProtocolAck, nil
+}
+
+// 服务端在建立连接时是否注册了该方法 格式为 Service.Method
+// 未协商能力通告(Option.Capabilities 为 false)时总是返回 false
+func (client *Client) HasMethod(serviceMethod string) bool {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return false
+	}
+	for _, m := range client.capabilities[serviceMethod[:dot]] {
+		if m == serviceMethod[dot+1:] {
+			return true
+		}
+	}
+	return false
+}
+
+// 服务端通告的服务与方法 未协商时为 nil
+func (client *Client) Capabilities() map[string][]string {
+	if client.capabilities == nil {
+		return nil
+	}
+	caps := make(map[string][]string, len(client.capabilities))
+	for svc, methods := range client.capabilities {
+		caps[svc] = append([]string(nil), methods...)
+	}
+	return caps
+}
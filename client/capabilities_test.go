@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClient_Capabilities(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c, new(Sleeper))
+
+	// 能力通告需要明确开启
+	opt := *server.DefaultOption
+	opt.Capabilities = true
+	client, err := Dial("tcp", addr, &opt)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	want := map[string][]string{"Calc": {"Add"}, "Sleeper": {"Sleep"}}
+	_assert(reflect.DeepEqual(client.Capabilities(), want), "unexpected capabilities %v", client.Capabilities())
+	_assert(client.HasMethod("Calc.Add") && client.HasMethod("Sleeper.Sleep"), "registered methods should be advertised")
+	for _, m := range []string{"Calc.Mul", "Missing.Add", "Calc", "_reflection.ListServices"} {
+		_assert(!client.HasMethod(m), "%s should not be advertised", m)
+	}
+
+	// 读取通告后连接正常可用
+	var reply int
+	err = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "unexpected result %d (%v)", reply, err)
+
+	// 默认与未协商时没有通告
+	def, err := Dial("tcp", addr)
+	_assert(err == nil && def.Capabilities() == nil, "capabilities should be opt-in (%v)", err)
+	_ = def.Close()
+	for _, ct := range []codec.Type{codec.GobType, codec.JsonType} {
+		plain, err := Dial("tcp", addr, &server.Option{CodecType: ct, ConnectTimeout: time.Second})
+		_assert(err == nil, "dial error: %v", err)
+		_assert(plain.Capabilities() == nil && !plain.HasMethod("Calc.Add"), "capabilities should not be negotiated")
+		err = plain.Call(context.Background(), "Calc.Add", AddArgs{Num1: 2, Num2: 2}, &reply)
+		_assert(err == nil && reply == 4, "unexpected result %d (%v)", reply, err)
+		_ = plain.Close()
+	}
+}
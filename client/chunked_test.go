@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"gmrpc/wiretrace"
+	"strings"
+	"testing"
+)
+
+type Payload struct{}
+
+func (Payload) Len(data string, reply *int) error {
+	*reply = len(data)
+	for i := range data {
+		if data[i] != byte('a'+i%26) {
+			*reply = -1
+			break
+		}
+	}
+	return nil
+}
+
+func TestClient_LargeArgsChunked(t *testing.T) {
+	addr := startTestServer(t, Payload{})
+	var b strings.Builder
+	for i := 0; i < 5<<20; i++ {
+		b.WriteByte(byte('a' + i%26))
+	}
+	large := b.String()
+
+	for _, f := range []struct {
+		header codec.HeaderType
+		body   codec.Type
+	}{
+		{codec.CombinedHeader, codec.GobType}, {codec.CombinedHeader, codec.JsonType}, {codec.BinaryHeader, codec.GobType},
+	} {
+		ring := wiretrace.NewRing(100, 16)
+		opt := *server.DefaultOption
+		opt.HeaderType, opt.CodecType = f.header, f.body
+		opt.LargeArgThresholdBytes = 1 << 20
+		opt.WireTracer = ring
+		client, err := Dial("tcp", addr, &opt)
+		_assert(err == nil, "dial error: %v", err)
+
+		var n int
+		err = client.Call(context.Background(), "Payload.Len", large, &n)
+		_assert(err == nil && n == len(large), "%s/%s: unexpected result %d (%v)", f.header, f.body, n, err)
+		chunks := 0
+		for _, frame := range ring.Frames() {
+			if frame.Dir == wiretrace.Send && frame.Kind == wiretrace.Body {
+				chunks++
+			}
+		}
+		_assert(chunks >= 5, "%s/%s: 5 MB args should be sent in chunks, got %d", f.header, f.body, chunks)
+
+		// 方法不存在时服务端丢弃所有块 连接仍然可用
+		err = client.Call(context.Background(), "Payload.Missing", large, &n)
+		_assert(err != nil && strings.Contains(err.Error(), "can't find method"), "%s/%s: expect not found, got %v", f.header, f.body, err)
+		// 小参数照常发送
+		err = client.Call(context.Background(), "Payload.Len", "abc", &n)
+		_assert(err == nil && n == 3, "%s/%s: unexpected result %d (%v)", f.header, f.body, n, err)
+		_ = client.Close()
+	}
+}
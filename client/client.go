@@ -1,44 +1,122 @@
 package client
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"gmrpc/codec"
+	"gmrpc/logger"
+	"gmrpc/metadata"
+	"gmrpc/netutil"
+	"gmrpc/resolver"
+	"gmrpc/rpcerr"
 	"gmrpc/server"
+	"gmrpc/tracing"
+	"gmrpc/wiretrace"
 	"io"
 	"log"
 	"net"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
 )
 
 // rpc调用结构体
 type Call struct {
 	Seq           uint64
-	ServiceMethod string      // 服务方法名
-	Args          interface{} // 参数
-	Reply         interface{} // 结果
-	Error         error       // 错误信息
-	Done          chan *Call  // 支持异步调用  chan 通道 用于协程通信
+	ServiceMethod string            // 服务方法名
+	Args          interface{}       // 参数
+	Reply         interface{}       // 结果
+	Error         error             // 错误信息
+	Done          chan *Call        // 支持异步调用  chan 通道 用于协程通信
+	Metadata      map[string]string // 随请求发送的元数据
+	ResponseMeta  metadata.MD       // 响应头中的元数据 如弃用说明
+
+	hint     sendHint    // 发送策略
+	start    time.Time   // 注册的时间
+	overflow func(*Call) // Done 已满时接收结果 为空时丢弃
+	raw      *[]byte     // 非空时写入未解码的结果 见 WithRawResponse
 }
 
+// 调用结束被执行 Done 已满时不阻塞 交给 overflow 处理
 func (call *Call) done() {
-	// 调用结束被执行
-	call.Done <- call
+	select {
+	case call.Done <- call:
+	default:
+		if call.overflow != nil {
+			call.overflow(call)
+		} else {
+			log.Println("rpc client: discarding Call reply due to insufficient Done chan capacity")
+		}
+	}
 }
 
+// 客户端可被多个 goroutine 同时使用 但不能复制 需要多个句柄时使用 CloneSharing
 type Client struct {
+	noCopy noCopy
+
 	cc       codec.Codec
 	opt      *server.Option
 	header   codec.Header
 	sending  sync.Mutex // 互斥锁，保证请求有序
 	mu       sync.Mutex
-	seq      uint64           // 请求编号
-	pending  map[uint64]*Call // 存储未处理完成的call实例
-	closing  bool             // 用户主动关闭标志
-	shutdown bool             // 错误发生标志
+	seq      uint64            // 请求编号 设置了 seqGen 时只用于计数
+	seqGen   SequenceGenerator // 为空时使用 seq 递增
+	pending  map[uint64]*Call  // 存储未处理完成的call实例
+	closing  bool              // 用户主动关闭标志
+	shutdown bool              // 错误发生标志
+
+	serverClosed *ServerClosedError // 收到服务端的关闭通知
+	done         chan struct{}      // 接收循环退出时关闭 见 lifecycle.go
+	err          error              // 接收循环退出的原因
+
+	conn     net.Conn                 // 底层连接 用于调整 socket 选项 可能为空
+	slowConn *netutil.SlowConnMonitor // 编解码器使用的连接 监控慢读写 可能为空
+	waiting  int32                    // 等待 sending 锁的发送者数量
+	urgent   int32                    // 等待中的低延迟调用数量
+	nagle    bool                     // 当前是否开启 Nagle 算法
+
+	interceptors []ClientInterceptor // 拦截器
+	retryPolicy  *RetryPolicy        // CallWithRetry 使用的策略 为空时使用默认策略
+	retrySleep   sleepFunc           // 重试前的等待 测试时替换 为空时使用计时器
+	methods      *methodCache        // 方法缓存 为空表示未开启
+	schemas      *schemaCache        // 类型结构检查 为空表示未开启
+
+	deprecationLogger logger.Logger   // 调用弃用方法时输出警告 为空表示不输出
+	deprecationLogged map[string]bool // 已输出过警告的方法
+
+	argCopier func(interface{}) interface{} // 发送前拷贝参数 为空表示不拷贝
+	adaptive  *adaptiveTimeouts             // 自适应超时 为空表示未开启
+
+	requestHook RequestHook    // 写入前修改请求头 为空表示没有
+	bodyHook    codec.BodyHook // 以编码后的消息体修改请求头 为空表示没有
+
+	httpClient *http.Client // SubscribeSSE 使用 为空时使用 http.DefaultClient
+
+	capabilities map[string][]string // 握手时服务端通告的服务与方法 创建后只读
+	compression  string              // 握手时协商的压缩算法 创建后只读
+	protocol     server.ProtocolAck  // 握手时协商的协议版本与功能 创建后只读
+
+	abandonedMu    sync.Mutex // 单独的锁 调用可能在持有 mu 时结束
+	abandoned      []*Call    // Done 已满无法投递的调用 由 AbandonedCalls 取走
+	abandonedTotal uint64     // 累计无法投递的调用数
+	abandonedLog   sync.Once  // 只输出一次警告
+}
+
+// 嵌入后 go vet 的 copylocks 检查会报告对结构体的复制
+type noCopy struct{}
+
+func (*noCopy) Lock()   {}
+func (*noCopy) Unlock() {}
+
+// 返回共享同一连接的句柄 即同一个指针 任一句柄关闭后连接对所有句柄关闭
+// 需要把客户端交给其他组件时使用 不要复制 Client 的值
+func (client *Client) CloneSharing() *Client {
+	return client
 }
 
 var _ io.Closer = (*Client)(nil)
@@ -58,7 +136,37 @@ func (client *Client) Close() error {
 func (client *Client) IsAvailable() bool {
 	client.mu.Lock()
 	defer client.mu.Unlock()
-	return !client.shutdown && !client.closing
+	return !client.shutdown && !client.closing && client.serverClosed == nil
+}
+
+// 客户端运行状态快照
+type ClientStats struct {
+	Pending  int    // 等待响应的调用数
+	Seq      uint64 // 下一个请求编号 设置了 SequenceGenerator 时为已注册的调用数加 1
+	Closing  bool
+	Shutdown bool
+
+	AdaptiveTimeouts map[string]time.Duration // 自适应超时学习到的各方法超时时间
+	Abandoned        uint64                   // Done 已满无法投递的调用数 见 AbandonedCalls
+}
+
+func (client *Client) Stats() ClientStats {
+	client.mu.Lock()
+	stats := ClientStats{
+		Pending:  len(client.pending),
+		Seq:      client.seq,
+		Closing:  client.closing,
+		Shutdown: client.shutdown,
+	}
+	adaptive := client.adaptive
+	client.mu.Unlock()
+	client.abandonedMu.Lock()
+	stats.Abandoned = client.abandonedTotal
+	client.abandonedMu.Unlock()
+	if adaptive != nil {
+		stats.AdaptiveTimeouts = adaptive.snapshot()
+	}
+	return stats
 }
 
 func (client *Client) registerCall(call *Call) (uint64, error) {
@@ -66,11 +174,19 @@ func (client *Client) registerCall(call *Call) (uint64, error) {
 	defer client.mu.Unlock()
 	client.mu.Lock()
 
+	if client.serverClosed != nil && !client.closing {
+		return 0, client.serverClosed
+	}
 	if client.closing || client.shutdown {
 		return 0, ErrShutdown
 	}
 
-	call.Seq = client.seq
+	seq, err := client.nextSeq()
+	if err != nil {
+		return 0, err
+	}
+	call.Seq = seq
+	call.start = time.Now()
 	client.pending[call.Seq] = call
 	client.seq++
 	return call.Seq, nil
@@ -96,12 +212,21 @@ func (client *Client) terminateCalls(err error) {
 	client.mu.Lock()
 
 	client.shutdown = true
+	// 主动关闭时 未完成的调用统一返回 ErrShutdown 而不是底层连接错误
+	if client.closing {
+		err = ErrShutdown
+	} else if client.serverClosed != nil {
+		err = client.serverClosed
+	}
 
-	for _, call := range client.pending {
+	for seq, call := range client.pending {
 		call.Error = err
 		call.done()
+		delete(client.pending, seq)
 	}
-
+	// 接收循环只退出一次
+	client.err = err
+	close(client.done)
 }
 
 func (client *Client) receive() {
@@ -113,21 +238,47 @@ func (client *Client) receive() {
 
 		// 读取请求头
 		var header codec.Header
-		if err = client.cc.ReadBody(&header); err != nil {
+		if err = client.cc.ReadHeader(&header); err != nil {
 			break
 		}
 
+		if header.ServiceMethod == server.ClosingMethod {
+			err = client.receiveClosing()
+			continue
+		}
+
 		var call *Call = client.removeCall(header.Seq)
+		if call != nil && len(header.Metadata) > 0 {
+			call.ResponseMeta = metadata.New(header.Metadata)
+		}
+		if msg, ok := header.Metadata[server.DeprecatedKey]; ok {
+			client.logDeprecation(header.ServiceMethod, msg)
+		}
 
 		switch {
+		case codec.IsStream(&header):
+			err = client.receiveStream(call)
 		case call == nil:
-			err = client.cc.ReadBody(nil)
+			err = client.cc.SkipBody()
 		case header.Error != "":
-			call.Error = errors.New(header.Error)
+			if header.Status != nil {
+				call.Error = header.Status
+				if header.Status.Code == rpcerr.NotFound {
+					client.invalidateMethodCache()
+				}
+			} else {
+				call.Error = errors.New(header.Error)
+			}
+			call.Error = withRetryAfter(call.Error, header.Metadata)
+			err = client.cc.SkipBody()
+			call.done()
 		default:
-			err = client.cc.ReadBody(call.Reply)
+			err = client.readReply(call)
 			if err != nil {
 				call.Error = errors.New("reading body " + err.Error())
+				if !client.IsAvailable() {
+					call.Error = ErrShutdown
+				}
 			}
 			call.done()
 		}
@@ -137,9 +288,19 @@ func (client *Client) receive() {
 
 func (client *Client) send(call *Call) {
 	// 发送数据
+	if err := validateServiceMethod(call.ServiceMethod); err != nil {
+		call.Error = err
+		call.done()
+		return
+	}
+	client.copyArgs(call)
+	client.lockSending(call.hint)
 	defer client.sending.Unlock()
-	client.sending.Lock()
+	client.sendLocked(call, true)
+}
 
+// 注册并写入请求 flush 为 false 时留在发送缓冲区 由调用方刷新 调用方持有 sending 锁
+func (client *Client) sendLocked(call *Call, flush bool) {
 	// 注册
 	seq, err := client.registerCall(call)
 	if err != nil {
@@ -152,9 +313,25 @@ func (client *Client) send(call *Call) {
 	client.header.ServiceMethod = call.ServiceMethod
 	client.header.Seq = seq
 	client.header.Error = ""
+	client.header.Metadata = call.Metadata
+	if !client.protocol.Features.Has(server.FeatureMetadata) {
+		client.header.Metadata = nil
+	}
 
 	// 发送数据
-	if err := client.cc.Write(&client.header, call.Args); err != nil {
+	if err = client.runRequestHook(call.Args); err != nil {
+		// 之前的发送者可能把刷新留给了本次调用
+		if bw, ok := client.cc.(codec.BufferedWriter); ok {
+			_ = bw.Flush()
+		}
+	} else {
+		err = client.writeRequest(call, flush)
+	}
+	if err != nil {
+		if isConnError(err) {
+			client.failAfterReceive(seq, err)
+			return
+		}
 		call := client.removeCall(seq)
 		if call != nil {
 			call.Error = err
@@ -163,68 +340,202 @@ func (client *Client) send(call *Call) {
 	}
 }
 
-func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
-	// 异步调用
+// 方法名格式为 Service.Method 不能包含控制字符
+func validateServiceMethod(serviceMethod string) error {
+	dot := strings.LastIndex(serviceMethod, ".")
+	switch {
+	case dot <= 0 || dot == len(serviceMethod)-1:
+		return rpcerr.Errorf(rpcerr.InvalidArgs, "rpc client: service method %q must be of the form Service.Method", serviceMethod)
+	case strings.IndexFunc(serviceMethod, unicode.IsControl) >= 0:
+		return rpcerr.Errorf(rpcerr.InvalidArgs, "rpc client: service method %q contains control characters", serviceMethod)
+	}
+	return nil
+}
+
+func newCall(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
 	if done == nil {
 		done = make(chan *Call, 10)
 	} else if cap(done) == 0 {
 		log.Panic("rpc client: done channel is unbuffered")
 	}
-	call := &Call{
+	return &Call{
 		ServiceMethod: serviceMethod,
 		Args:          args,
 		Reply:         reply,
 		Done:          done,
 	}
+}
+
+func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	// 异步调用
+	call := newCall(serviceMethod, args, reply, done)
+	call.overflow = client.abandon
+	if err := client.checkMethod(context.Background(), serviceMethod); err != nil {
+		call.Error = err
+		call.done()
+		return call
+	}
+	if client.schemaPending(serviceMethod) {
+		// 获取服务端的类型描述需要一次往返 在后台完成检查后再发送
+		go func() {
+			if err := client.checkSchema(context.Background(), serviceMethod, args, reply); err != nil {
+				call.Error = err
+				call.done()
+				return
+			}
+			client.send(call)
+		}()
+		return call
+	}
+	if err := client.checkSchema(context.Background(), serviceMethod, args, reply); err != nil {
+		call.Error = err
+		call.done()
+		return call
+	}
 	client.send(call)
 	return call
 }
 
 func (client *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	// 同步调用
-	call := client.Go(serviceMethod, args, reply, make(chan *Call, 1))
+	// 同步调用 经过拦截器链
+	return client.chainInterceptors(client.call)(ctx, serviceMethod, args, reply)
+}
 
-	// 上下文控制超时
-	select {
-	case <-ctx.Done():
-		client.removeCall(call.Seq)
-		return errors.New("rpc client: call failed: " + ctx.Err().Error())
-	case call := <-call.Done:
-		return call.Error
+func (client *Client) call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if err := client.checkMethod(ctx, serviceMethod); err != nil {
+		return err
+	}
+	if err := client.checkSchema(ctx, serviceMethod, args, reply); err != nil {
+		return err
+	}
+	a := client.adaptiveTimeouts()
+	start := time.Now()
+	if a != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = a.withTimeout(ctx, serviceMethod)
+		defer cancel()
 	}
+	call := newCall(serviceMethod, args, reply, make(chan *Call, 1))
+	call.hint = sendHintFromContext(ctx)
+	call.raw = rawResponseFromContext(ctx)
+	call.Metadata = requestMetadata(ctx)
+	client.send(call)
+	recordCallSeq(ctx, call.Seq)
+
+	// 上下文结束时注销调用并结束 Done 即使服务端一直不响应 Done 也总会收到结果
+	// 与接收响应竞争时 先注销的一方结束调用
+	stop := context.AfterFunc(ctx, func() {
+		if client.removeCall(call.Seq) != nil {
+			call.Error = contextError(ctx)
+			call.done()
+			client.cancelRemote(call.Seq)
+		}
+	})
+	defer stop()
+	done := <-call.Done
+	if done.Error == nil {
+		recordResponseMetadata(ctx, done.ResponseMeta)
+		if a != nil {
+			a.record(serviceMethod, time.Since(start))
+		}
+	}
+	return done.Error
 }
 
-func NewClient(conn net.Conn, opt *server.Option) (*Client, error) {
+// 请求携带的元数据 ctx 中的元数据 剩余时间预算与追踪的 baggage
+func requestMetadata(ctx context.Context) metadata.MD {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return tracing.InjectBaggage(ctx, withBudget(ctx, md))
+}
+
+// 通知服务端取消本连接上仍在处理的请求 不等待结果 服务端不支持取消帧时不发送
+func (client *Client) cancelRemote(seq uint64) {
+	if !client.protocol.Features.Has(server.FeatureCancel) {
+		return
+	}
+	client.send(newCall(server.CancelMethod, seq, nil, nil))
+}
+
+// registry 为空时使用 codec.DefaultCodecRegistry
+func NewClient(conn net.Conn, opt *server.Option, registry ...*codec.CodecRegistry) (*Client, error) {
 	// 创建客户端
 	/*
 		1. 与服务端协商协议交换
 		2. 接收响应
 	*/
 	// 定义协议
-	_func := codec.NewCodecFuncMap[opt.CodecType]
-
-	if _func == nil {
-		err := fmt.Errorf("invalid codec type %s", opt.CodecType)
+	var codecs *codec.CodecRegistry
+	if len(registry) > 0 {
+		codecs = registry[0]
+	}
+	codecs = codec.RegistryOrDefault(codecs)
+	opt = withProtocolDefaults(opt)
+	if !codecs.Supported(opt.HeaderType, opt.CodecType) {
+		err := fmt.Errorf("invalid codec type %s/%s", opt.HeaderType, opt.CodecType)
 		log.Println("rpc client: codec error:", err)
 		return nil, err
 	}
 
 	// 协商协议
-	if err := json.NewEncoder(conn).Encode(opt); err != nil {
+	writeOption := func() error { return json.NewEncoder(conn).Encode(opt) }
+	if opt.BinaryOption {
+		writeOption = func() error { return server.WriteOptionBinary(conn, opt) }
+	}
+	if err := writeOption(); err != nil {
 		log.Println("rpc client: options error: ", err)
 		_ = conn.Close()
 		return nil, err
 	}
 
-	return newClientCodec(_func(conn), opt), nil
+	var rw net.Conn = conn
+	var caps map[string][]string
+	var compression string
+	var ack *server.ProtocolAck
+	if opt.Capabilities || opt.Compression != "" || opt.ProtocolVersion >= 2 {
+		br := bufio.NewReader(conn)
+		var err error
+		if caps, compression, ack, err = readHandshake(br, opt); err != nil {
+			log.Println("rpc client: handshake error: ", err)
+			_ = conn.Close()
+			return nil, err
+		}
+		rw = &bufConn{Conn: conn, r: br}
+	}
+	slowConn := netutil.NewSlowConnMonitor(rw, 0, 0, nil)
+	cc, err := newCodec(slowConn, opt, codecs)
+	if err == nil {
+		err = setCompression(cc, compression, opt)
+	}
+	if err != nil {
+		log.Println("rpc client: codec error:", err)
+		_ = conn.Close()
+		return nil, err
+	}
+
+	client := newClientCodec(cc, opt, caps, negotiatedProtocol(opt, ack))
+	client.conn = conn
+	client.slowConn = slowConn
+	client.compression = compression
+	return client, nil
+}
+
+// 设置了 WireTracer 时包装编解码器
+func newCodec(conn io.ReadWriteCloser, opt *server.Option, codecs *codec.CodecRegistry) (codec.Codec, error) {
+	if opt.WireTracer != nil {
+		return wiretrace.NewCodec(conn, codecs, opt.HeaderType, opt.CodecType, opt.WireTracer)
+	}
+	return codecs.New(conn, opt.HeaderType, opt.CodecType)
 }
 
-func newClientCodec(cc codec.Codec, opt *server.Option) *Client {
+func newClientCodec(cc codec.Codec, opt *server.Option, caps map[string][]string, protocol server.ProtocolAck) *Client {
 	client := &Client{
-		seq:     1,
-		cc:      cc,
-		opt:     opt,
-		pending: make(map[uint64]*Call),
+		seq:          1,
+		cc:           cc,
+		opt:          opt,
+		pending:      make(map[uint64]*Call),
+		capabilities: caps,
+		protocol:     protocol,
+		done:         make(chan struct{}),
 	}
 	go client.receive()
 	return client
@@ -237,13 +548,44 @@ type clientResult struct {
 
 type newClientFunc func(conn net.Conn, opt *server.Option) (client *Client, err error)
 
+// 补全默认配置 返回副本 不修改调用方的 Option 同一个 Option 可以用于并发的 Dial
+func parseOptions(opts ...*server.Option) (*server.Option, error) {
+	if len(opts) == 0 || opts[0] == nil {
+		o := *server.DefaultOption
+		return &o, nil
+	}
+	if len(opts) != 1 {
+		return nil, errors.New("rpc client: number of options is more than 1")
+	}
+	o := *opts[0]
+	opt := &o
+	opt.MagicNumber = server.DefaultOption.MagicNumber
+	if opt.CodecType == "" {
+		opt.CodecType = server.DefaultOption.CodecType
+	}
+	return withProtocolDefaults(opt), nil
+}
+
+// 没有声明版本时使用本版本与全部功能 返回副本 需要版本 1 时明确设置 ProtocolVersion 为 1
+func withProtocolDefaults(opt *server.Option) *server.Option {
+	if opt.ProtocolVersion != 0 {
+		return opt
+	}
+	o := *opt
+	o.ProtocolVersion, o.Features = server.ProtocolVersion, server.SupportedFeatures
+	return &o
+}
+
 func dialTimeout(f newClientFunc, network string, address string, opts ...*server.Option) (client *Client, err error) {
 	// 超时处理
 
 	// 创建opt
-	var opt *server.Option = server.DefaultOption
-	if len(opts) >= 1 && opts[0] != nil {
-		opt = opts[0]
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if addrs := splitAddrs(address); len(addrs) > 1 {
+		return dialRace(f, network, addrs, opt)
 	}
 
 	// 创建链接 连接超时处理
@@ -261,7 +603,7 @@ func dialTimeout(f newClientFunc, network string, address string, opts ...*serve
 		}
 	}()
 
-	clientResCh := make(chan clientResult)
+	clientResCh := make(chan clientResult, 1)
 
 	go func() {
 		client, err := f(conn, opt)
@@ -276,6 +618,12 @@ func dialTimeout(f newClientFunc, network string, address string, opts ...*serve
 
 	select {
 	case <-time.After(opt.ConnectTimeout):
+		// 握手可能稍后完成 需要关闭创建出的客户端
+		go func() {
+			if result := <-clientResCh; result.client != nil {
+				_ = result.client.Close()
+			}
+		}()
 		return nil, fmt.Errorf("rpc client: connect timeout: expect within %s", opt.ConnectTimeout)
 	case result := <-clientResCh:
 		return result.client, result.err
@@ -283,5 +631,22 @@ func dialTimeout(f newClientFunc, network string, address string, opts ...*serve
 }
 
 func Dial(network string, address string, opts ...*server.Option) (*Client, error) {
-	return dialTimeout(NewClient, network, address, opts...)
+	return dialTimeout(func(conn net.Conn, opt *server.Option) (*Client, error) {
+		return NewClient(conn, opt)
+	}, network, address, opts...)
+}
+
+// 解析目标后按顺序尝试每个地址 返回第一个建立成功的连接 目标格式见 resolver 包
+func DialTarget(target string, opts ...*server.Option) (*Client, error) {
+	addrs, err := resolver.Resolve(target)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		var client *Client
+		if client, err = Dial(a.Network, a.Addr, opts...); err == nil {
+			return client, nil
+		}
+	}
+	return nil, err
 }
@@ -2,14 +2,23 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"gmrpc/codec"
 	"gmrpc/server"
+	"io"
 	"net"
 	"strings"
 	"testing"
 	"time"
+
+	"go.uber.org/goleak"
 )
 
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
 func _assert(condition bool, msg string, v ...interface{}) {
 	if !condition {
 		panic(fmt.Sprintf("assertion failed: "+msg, v...))
@@ -19,6 +28,7 @@ func _assert(condition bool, msg string, v ...interface{}) {
 func TestClient_dialTimeout(t *testing.T) {
 	t.Parallel()
 	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
 
 	f := func(conn net.Conn, opt *server.Option) (client *Client, err error) {
 		_ = conn.Close()
@@ -42,32 +52,78 @@ func (b Bar) Timeout(argv int, reply *int) error {
 	return nil
 }
 
-func startServer(addr chan string) {
+func startServer(t *testing.T, addr chan string) {
 	var b Bar
 	_ = server.Register(&b)
 	// pick a free port
 	l, _ := net.Listen("tcp", ":0")
+	t.Cleanup(func() {
+		_ = l.Close()
+		// 等待超时后仍在运行的处理函数结束
+		for server.DefaultServer.Stats().Inflight > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
 	addr <- l.Addr().String()
 	server.Accept(l)
 }
 
+// 补全默认值不修改调用方的 Option
+func TestParseOptions_Copies(t *testing.T) {
+	opt := &server.Option{ConnectTimeout: time.Second}
+	got, err := parseOptions(opt)
+	_assert(err == nil && got != opt, "expect a copy, got %p %v", got, err)
+	_assert(got.MagicNumber == server.MagicNumber && got.CodecType == server.DefaultOption.CodecType && got.ConnectTimeout == time.Second, "expect defaults filled in %+v", got)
+	_assert(opt.MagicNumber == 0 && opt.CodecType == "", "caller's option should be unchanged %+v", opt)
+	def, _ := parseOptions()
+	_assert(def != server.DefaultOption && *def == *server.DefaultOption, "expect a copy of DefaultOption")
+}
+
 func TestClient_Call(t *testing.T) {
 	t.Parallel()
 	addrCh := make(chan string)
-	go startServer(addrCh)
+	go startServer(t, addrCh)
 	addr := <-addrCh
 	time.Sleep(time.Second)
 	t.Run("client timeout", func(t *testing.T) {
 		client, _ := Dial("tcp", addr)
-		ctx, _ := context.WithTimeout(context.Background(), time.Second)
+		defer func() { _ = client.Close() }()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
 		var reply int
 		err := client.Call(ctx, "Bar.Timeout", 1, &reply)
 		_assert(err != nil && strings.Contains(err.Error(), ctx.Err().Error()), "expect a timeout error")
 	})
 	t.Run("server handle timeout", func(t *testing.T) {
 		client, _ := Dial("tcp", addr, &server.Option{HandleTimeout: time.Second})
+		defer func() { _ = client.Close() }()
 		var reply int
 		err := client.Call(context.Background(), "Bar.Timeout", 1, &reply)
 		_assert(err != nil && strings.Contains(err.Error(), "handle timeout"), "expect a timeout error")
 	})
 }
+
+func TestClient_CallContextCancelHangingServer(t *testing.T) {
+	cliConn, srvConn := net.Pipe()
+	// 服务端读取所有请求 从不响应
+	go func() { _, _ = io.Copy(io.Discard, srvConn) }()
+	client, err := NewClient(cliConn, &server.Option{MagicNumber: server.MagicNumber, CodecType: codec.GobType, ProtocolVersion: 1})
+	_assert(err == nil, "new client failed: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	var reply int
+	err = client.Call(ctx, "Bar.Timeout", 1, &reply)
+	_assert(errors.Is(err, context.Canceled), "expect context canceled, got %v", err)
+	_assert(time.Since(start) < time.Second, "call should return promptly, took %v", time.Since(start))
+	client.mu.Lock()
+	_, pending := client.pending[1]
+	client.mu.Unlock()
+	_assert(!pending, "cancelled call should be removed")
+
+	// 上下文已经结束时立即返回
+	err = client.Call(ctx, "Bar.Timeout", 1, &reply)
+	_assert(errors.Is(err, context.Canceled), "expect context canceled, got %v", err)
+}
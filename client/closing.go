@@ -0,0 +1,99 @@
+package client
+
+import (
+	"errors"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// 服务端关闭前发送了 _closing 通知 与网络故障导致的 EOF 区分
+// 为兼容只检查 io.EOF 的调用方 Unwrap 返回 io.EOF
+type ServerClosedError struct {
+	Reason     string
+	RetryAfter time.Duration // 服务端建议的重连等待时间 0 表示没有建议
+	At         time.Time     // 收到通知的时间
+}
+
+func (e *ServerClosedError) Error() string {
+	return "rpc client: server closed the connection: " + e.Reason
+}
+
+func (e *ServerClosedError) Unwrap() error {
+	return io.EOF
+}
+
+// 重连前需要等待到的时间
+func (e *ServerClosedError) RetryAt() time.Time {
+	return e.At.Add(e.RetryAfter)
+}
+
+// 读取关闭通知 之后的调用与连接断开时未完成的调用都返回 ServerClosedError
+func (client *Client) receiveClosing() error {
+	var notice server.ClosingNotice
+	if err := client.cc.ReadBody(&notice); err != nil {
+		return err
+	}
+	client.mu.Lock()
+	client.serverClosed = &ServerClosedError{
+		Reason:     notice.Reason,
+		RetryAfter: time.Duration(notice.RetryAfterMs) * time.Millisecond,
+		At:         time.Now(),
+	}
+	client.mu.Unlock()
+	return nil
+}
+
+// 服务端发送过关闭通知时返回该通知 否则返回 nil
+func (client *Client) ServerClosed() *ServerClosedError {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.serverClosed
+}
+
+// 写入失败后等待接收循环读完关闭通知的最长时间
+const closeNoticeWait = time.Second
+
+// 已收到关闭通知或正在关闭时 以 ServerClosedError / ErrShutdown 代替底层的网络错误
+func (client *Client) closedError(err error) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	switch {
+	case client.closing:
+		return ErrShutdown
+	case client.serverClosed != nil:
+		return client.serverClosed
+	}
+	return err
+}
+
+// 写入时连接已断开 关闭通知可能还在接收缓冲区中没有读出
+// 调用留在 pending 中 由接收循环结束时按关闭通知或 Close 给出错误 接收循环迟迟没有结束时返回写入错误
+func (client *Client) failAfterReceive(seq uint64, err error) {
+	fail := func() {
+		if call := client.removeCall(seq); call != nil {
+			call.Error = client.closedError(err)
+			call.done()
+		}
+	}
+	if client.closedError(nil) != nil {
+		fail()
+		return
+	}
+	time.AfterFunc(closeNoticeWait, fail)
+}
+
+// 连接本身的读写错误 编码失败等与连接无关的错误不算
+func isConnError(err error) bool {
+	var encErr *codec.EncodeError
+	var sizeErr *codec.SizeError
+	if errors.As(err, &encErr) || errors.As(err, &sizeErr) {
+		return false
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
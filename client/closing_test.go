@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gmrpc/codec"
+	"gmrpc/metadata"
+	"gmrpc/server"
+	"io"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_ServerClosedOnShutdown(t *testing.T) {
+	s := server.NewServer()
+	_ = s.Register(new(Sleeper))
+	addr := serveTest(t, s)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	// 进行中的调用在关闭前完成
+	inflight := make(chan error, 1)
+	var md metadata.MD
+	go func() {
+		var reply time.Duration
+		inflight <- client.Call(WithResponseMetadata(context.Background(), &md), "Sleeper.Sleep", 100*time.Millisecond, &reply)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	notice := server.ClosingNotice{Reason: "deploy", RetryAfterMs: 250}
+	_assert(s.ShutdownWithNotice(context.Background(), notice) == nil, "shutdown failed")
+	_assert(<-inflight == nil, "in-flight call should finish before the connection closes")
+	// 关闭中完成的响应带有关闭通知的重试提示
+	_assert(md.Get(server.RetryAfterKey) == "250", "expect a retry-after hint while draining, got %v", md)
+
+	var reply time.Duration
+	err = client.Call(context.Background(), "Sleeper.Sleep", time.Millisecond, &reply)
+	var closed *ServerClosedError
+	_assert(errors.As(err, &closed) && closed.Reason == "deploy" && closed.RetryAfter == 250*time.Millisecond, "expect ServerClosedError, got %v", err)
+	_assert(errors.Is(err, io.EOF) && IsTransportError(err), "ServerClosedError should wrap io.EOF")
+	_assert(!client.IsAvailable() && client.ServerClosed() == closed, "client should record the notice")
+	retryable, waitMs := IsRetryableWithHint(err)
+	_assert(retryable && waitMs == 250, "expect retry after 250ms, got %v %d", retryable, waitMs)
+
+	// 关闭后不再接受新连接
+	_, err = Dial("tcp", addr)
+	_assert(err != nil, "dial after shutdown should fail")
+}
+
+func TestClient_KilledConnectionIsNotServerClosed(t *testing.T) {
+	s := server.NewServer()
+	_ = s.Register(new(Sleeper))
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer func() { _ = l.Close() }()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- conn
+		s.ServeConn(conn)
+	}()
+	client, err := Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	done := make(chan error, 1)
+	go func() {
+		var reply time.Duration
+		done <- client.Call(context.Background(), "Sleeper.Sleep", 200*time.Millisecond, &reply)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_ = (<-accepted).Close()
+
+	err = <-done
+	var closed *ServerClosedError
+	_assert(err != nil && !errors.As(err, &closed) && client.ServerClosed() == nil, "killed connection should not look like a clean shutdown: %v", err)
+}
+
+// 连接池在建议的等待时间之前不重新拨号
+func TestPool_HonorsRetryAfter(t *testing.T) {
+	s := server.NewServer()
+	_ = s.Register(new(Calc))
+	addr := serveTest(t, s)
+	p, _ := NewPool("tcp", addr, 1)
+	defer func() { _ = p.Close() }()
+	var dials int32
+	p.SetDialer(countingDialer(&dials, 0))
+
+	var reply int
+	_assert(p.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 1}, &reply) == nil, "call failed")
+	_assert(s.ShutdownWithNotice(context.Background(), server.ClosingNotice{Reason: "restart", RetryAfterMs: 150}) == nil, "shutdown failed")
+	p.mu.Lock()
+	c := p.clients[0]
+	p.mu.Unlock()
+	for c.ServerClosed() == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	err := p.Call(context.Background(), "Calc.Add", AddArgs{}, &reply)
+	var closed *ServerClosedError
+	_assert(errors.As(err, &closed) && atomic.LoadInt32(&dials) == 1, "pool should wait before redialing: %v dials %d", err, dials)
+
+	time.Sleep(closed.RetryAfter)
+	_ = p.Call(context.Background(), "Calc.Add", AddArgs{}, &reply)
+	_assert(atomic.LoadInt32(&dials) == 2, "pool should redial after retry-after, dials %d", dials)
+}
+
+// 调用已注册 写入前收到关闭通知 服务端随后断开连接 写入失败返回 ServerClosedError 而不是底层的网络错误
+func TestClient_CallsRightAfterShutdown(t *testing.T) {
+	s := server.NewServer()
+	_ = s.Register(new(Sleeper))
+	sock := filepath.Join(t.TempDir(), "rpc.sock")
+	l, err := net.Listen("unix", sock)
+	_assert(err == nil, "listen error: %v", err)
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+
+	client, err := Dial("unix", sock)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	var hold int32
+	release := make(chan struct{})
+	client.Apply(WithRequestHook(func(h *codec.Header, args interface{}) error {
+		if atomic.LoadInt32(&hold) == 1 {
+			<-release
+		}
+		return nil
+	}))
+	var reply time.Duration
+	_assert(client.Call(context.Background(), "Sleeper.Sleep", time.Duration(0), &reply) == nil, "call before shutdown failed")
+
+	// 写入前停在 hook 中 持有发送锁 接收循环读完通知后不能结束未完成的调用
+	atomic.StoreInt32(&hold, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Call(context.Background(), "Sleeper.Sleep", time.Duration(0), &reply)
+	}()
+	_assert(s.Shutdown(context.Background()) == nil, "shutdown error")
+	for client.ServerClosed() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	err = <-done
+	var closed *ServerClosedError
+	_assert(errors.As(err, &closed), "expect ServerClosedError, got %v", err)
+}
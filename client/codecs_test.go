@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"io"
+	"net"
+	"testing"
+)
+
+// 服务端与客户端使用独立的注册表 默认注册表中没有该类型
+func TestClient_CodecRegistry(t *testing.T) {
+	const custom codec.Type = "application/x-custom"
+	r := codec.NewCodecRegistry()
+	r.Register(custom, func(conn io.ReadWriteCloser) codec.Codec { return codec.NewJsonCodec(conn) })
+
+	s := server.NewServer()
+	_ = s.Register(new(Calc))
+	cliConn, srvConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.ServeConn(srvConn, r)
+	}()
+
+	opt := &server.Option{MagicNumber: server.MagicNumber, CodecType: custom}
+	c, err := NewClient(cliConn, opt, r)
+	_assert(err == nil, "new client error: %v", err)
+	var reply int
+	err = c.Call(context.Background(), "Calc.Add", AddArgs{Num1: 2, Num2: 3}, &reply)
+	_assert(err == nil && reply == 5, "unexpected result %d (%v)", reply, err)
+	_ = c.Close()
+	<-done
+
+	a, b := net.Pipe()
+	defer func() { _ = a.Close(); _ = b.Close() }()
+	_, err = NewClient(a, opt)
+	_assert(err != nil, "default registry should not know the custom codec")
+}
+
+func TestClient_JSONRPC2(t *testing.T) {
+	s := server.NewServer()
+	_ = s.Register(new(Calc))
+	addr := serveTest(t, s)
+	client, err := Dial("tcp", addr, &server.Option{MagicNumber: server.MagicNumber, CodecType: codec.JSONRPC2Type})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	err = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 2, Num2: 3}, &reply)
+	_assert(err == nil && reply == 5, "unexpected result %d (%v)", reply, err)
+
+	err = client.Call(context.Background(), "Calc.Missing", AddArgs{}, &reply)
+	e, ok := rpcerr.FromError(err)
+	_assert(ok && e.Code == rpcerr.NotFound, "expect NotFound status, got %v", err)
+
+	// 关闭通知以 JSON-RPC 通知的形式发送
+	_assert(s.Shutdown(context.Background()) == nil, "shutdown failed")
+	err = client.Call(context.Background(), "Calc.Add", AddArgs{}, &reply)
+	var closed *ServerClosedError
+	_assert(errors.As(err, &closed) && closed.Reason == server.DefaultClosingNotice.Reason, "expect ServerClosedError, got %v", err)
+}
+
+func TestClient_BinaryOption(t *testing.T) {
+	addr := startTestServer(t, new(Calc))
+	opt := *server.DefaultOption
+	opt.BinaryOption = true
+	opt.Capabilities = true
+	client, err := Dial("tcp", addr, &opt)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	err = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 2, Num2: 3}, &reply)
+	_assert(err == nil && reply == 5, "unexpected result %d (%v)", reply, err)
+	_assert(client.ProtocolVersion() == server.ProtocolVersion && client.HasMethod("Calc.Add"), "handshake should still be negotiated")
+
+	opt.Compression = "gzip"
+	_, err = Dial("tcp", addr, &opt)
+	_assert(errors.Is(err, server.ErrOptionNotBinary), "expect ErrOptionNotBinary, got %v", err)
+}
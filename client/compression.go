@@ -0,0 +1,78 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"gmrpc/codec"
+	"gmrpc/server"
+)
+
+// 读取服务端握手后依次发送的能力通告与压缩协商结果 未开启的部分服务端不会发送
+// 协议协商结果在第一行中 两者都没有开启时单独一行 旧版本的服务端没有 此时 ack 为 nil
+func readHandshake(r *bufio.Reader, opt *server.Option) (caps map[string][]string, compression string, ack *server.ProtocolAck, err error) {
+	if !opt.Capabilities && opt.Compression == "" {
+		if opt.ProtocolVersion >= 2 {
+			ack, err = readProtocolAck(r)
+		}
+		return nil, "", ack, err
+	}
+	if opt.Capabilities {
+		if caps, ack, err = readCapabilities(r); err != nil {
+			return nil, "", nil, err
+		}
+	}
+	if opt.Compression != "" {
+		var compAck *server.ProtocolAck
+		if compression, compAck, err = readCompression(r); err != nil {
+			return nil, "", nil, err
+		}
+		if !opt.Capabilities {
+			ack = compAck
+		}
+	}
+	return caps, compression, ack, nil
+}
+
+// 见 server.CompressionAck 服务端拒绝连接时回复 server.HandshakeError
+func readCompression(r *bufio.Reader) (string, *server.ProtocolAck, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return "", nil, err
+	}
+	var ack struct {
+		server.CompressionAck
+		*server.ProtocolAck
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(line, &ack); err != nil {
+		return "", nil, err
+	}
+	if ack.Error != "" {
+		return "", nil, errors.New(ack.Error)
+	}
+	return ack.Compression, ack.ProtocolAck, nil
+}
+
+// 服务端选择的算法为空或编解码器不支持时不压缩
+func setCompression(cc codec.Codec, name string, opt *server.Option) error {
+	if name == "" {
+		return nil
+	}
+	c, ok := codec.GetCompressor(name)
+	comp, ok2 := cc.(codec.Compressible)
+	if !ok || !ok2 {
+		return errors.New("rpc client: unsupported compression " + name)
+	}
+	threshold := opt.CompressThreshold
+	if threshold <= 0 {
+		threshold = codec.DefaultCompressThreshold
+	}
+	comp.SetCompression(c, threshold)
+	return nil
+}
+
+// 握手时协商的压缩算法 未压缩时为空
+func (client *Client) Compression() string {
+	return client.compression
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"strings"
+	"testing"
+)
+
+type Repeater int
+
+func (r Repeater) Repeat(s string, reply *string) error {
+	*reply = strings.Repeat(s, 200)
+	return nil
+}
+
+func TestClient_CompressionNegotiation(t *testing.T) {
+	s := server.NewServer()
+	_ = s.Register(new(Repeater))
+	s.SetCompression(64, "gzip", "deflate")
+	addr := serveTest(t, s)
+
+	dial := func(header codec.HeaderType, algorithms string) *Client {
+		opt := &server.Option{MagicNumber: server.MagicNumber, CodecType: codec.GobType, HeaderType: header, Compression: algorithms}
+		c, err := Dial("tcp", addr, opt)
+		_assert(err == nil, "dial error: %v", err)
+		return c
+	}
+	call := func(c *Client) {
+		var reply string
+		err := c.Call(context.Background(), "Repeater.Repeat", "abc", &reply)
+		_assert(err == nil && reply == strings.Repeat("abc", 200), "unexpected reply (%v)", err)
+	}
+
+	// 客户端只支持 deflate 双方取交集 名称前后的空白被忽略
+	before := codec.ReadCompressionStats()
+	c := dial(codec.BinaryHeader, "zstd, deflate")
+	defer func() { _ = c.Close() }()
+	_assert(c.Compression() == "deflate", "expect deflate, got %q", c.Compression())
+	call(c)
+	stats := codec.ReadCompressionStats()
+	_assert(stats.Compressed > before.Compressed && stats.Skipped > before.Skipped, "expect the reply to be compressed and the request skipped: %+v", stats)
+
+	// 没有共同算法或合并格式时不压缩
+	none := dial(codec.BinaryHeader, "zstd")
+	defer func() { _ = none.Close() }()
+	_assert(none.Compression() == "", "expect no compression, got %q", none.Compression())
+	call(none)
+	combined := dial(codec.CombinedHeader, "gzip")
+	defer func() { _ = combined.Close() }()
+	_assert(combined.Compression() == "", "combined format cannot compress, got %q", combined.Compression())
+	call(combined)
+
+	// 经 HTTP 请求头协商
+	opt := &server.Option{MagicNumber: server.MagicNumber, CodecType: codec.JsonType, HeaderType: codec.BinaryHeader, Compression: "gzip,deflate"}
+	parsed, err := server.OptionFromHTTPHeader(opt.HTTPHeader())
+	_assert(err == nil && *parsed == *opt, "compression should survive http headers: %+v (%v)", parsed, err)
+}
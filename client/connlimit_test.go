@@ -0,0 +1,66 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer_MaxConnections(t *testing.T) {
+	var c Calc
+	s := server.NewServer()
+	_ = s.Register(&c)
+	s.SetMaxConnections(2)
+	addr := serveTest(t, s)
+
+	opt := func(timeout time.Duration) *server.Option {
+		return &server.Option{CodecType: codec.GobType, ConnectTimeout: timeout, Capabilities: true}
+	}
+	var clients []*Client
+	for i := 0; i < 2; i++ {
+		client, err := Dial("tcp", addr, opt(time.Second))
+		_assert(err == nil, "dial %d error: %v", i, err)
+		clients = append(clients, client)
+	}
+	_assert(s.ConnectionCount() == 2, "expect 2 connections, got %d", s.ConnectionCount())
+
+	// 第 n+1 个连接在等待 ConnectTimeout 后被拒绝
+	_, err := Dial("tcp", addr, opt(100*time.Millisecond))
+	_assert(err != nil, "connection over the limit should be rejected")
+
+	conn, err := net.Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	_ = json.NewEncoder(conn).Encode(&server.Option{MagicNumber: server.MagicNumber, CodecType: codec.GobType, ConnectTimeout: 50 * time.Millisecond, Capabilities: true})
+	var hsErr server.HandshakeError
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	err = json.NewDecoder(bufio.NewReader(conn)).Decode(&hsErr)
+	_assert(err == nil && hsErr.Error == server.ErrTooManyConnections.Error(), "expect handshake error, got %+v (%v)", hsErr, err)
+	_ = conn.Close()
+	_assert(s.ConnectionCount() == 2, "rejected connections should not be counted, got %d", s.ConnectionCount())
+
+	// 排队的连接在有连接关闭后得到名额
+	type result struct {
+		client *Client
+		err    error
+	}
+	queued := make(chan result, 1)
+	go func() {
+		client, err := Dial("tcp", addr, opt(2*time.Second))
+		if err == nil {
+			var reply int
+			err = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply)
+		}
+		queued <- result{client, err}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	_ = clients[0].Close()
+	r := <-queued
+	_assert(r.err == nil, "queued connection should be admitted: %v", r.err)
+	_ = r.client.Close()
+	_ = clients[1].Close()
+}
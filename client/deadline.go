@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"gmrpc/metadata"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"time"
+)
+
+/*
+截止时间传递 ctx 带有截止时间时把剩余时间写入请求元数据 server.TimeoutKey
+本地超时的错误为 *TimeoutError 注明是调用方的 ctx 还是单次尝试的超时触发
+服务端触发的超时通过 rpcerr.RPCError 的 Details 传回 统一用 rpcerr.TimeoutSource 读取
+*/
+
+// 客户端本地的超时 errors.Is(err, context.DeadlineExceeded) 成立
+type TimeoutError struct {
+	Source string // rpcerr.TimeoutClientDeadline 或 rpcerr.TimeoutAttempt
+	Err    error
+}
+
+func (e *TimeoutError) Error() string {
+	return "rpc client: call failed: " + e.Err.Error() + " (" + e.Source + ")"
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TimeoutError) TimeoutSource() string {
+	return e.Source
+}
+
+type attemptDeadlineKey struct{}
+
+// 单次尝试的超时 不覆盖更早的截止时间 超时错误的来源为 rpcerr.TimeoutAttempt
+func withAttemptTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	deadline := time.Now().Add(d)
+	if dl, ok := ctx.Deadline(); ok && !deadline.Before(dl) {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	return context.WithValue(ctx, attemptDeadlineKey{}, deadline), cancel
+}
+
+// ctx 结束时返回的错误
+func contextError(ctx context.Context) error {
+	err := ctx.Err()
+	if err != context.DeadlineExceeded {
+		return fmt.Errorf("rpc client: call failed: %w", err)
+	}
+	source := rpcerr.TimeoutClientDeadline
+	if dl, ok := ctx.Value(attemptDeadlineKey{}).(time.Time); ok {
+		if cur, _ := ctx.Deadline(); cur.Equal(dl) {
+			source = rpcerr.TimeoutAttempt
+		}
+	}
+	return &TimeoutError{Source: source, Err: err}
+}
+
+// 在请求元数据中写入剩余时间 不修改 ctx 中的元数据
+func withBudget(ctx context.Context, md metadata.MD) metadata.MD {
+	dl, ok := ctx.Deadline()
+	if !ok {
+		return md
+	}
+	out := md.Copy()
+	out.Set(server.TimeoutKey, time.Until(dl).String())
+	return out
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// 只读取不响应的服务端 超时只能由客户端触发
+func silentClient(t *testing.T) *Client {
+	serverConn, clientConn := net.Pipe()
+	go func() { _, _ = io.Copy(io.Discard, serverConn) }()
+	client, err := NewClient(clientConn, &server.Option{MagicNumber: server.MagicNumber, CodecType: codec.GobType, ProtocolVersion: 1})
+	_assert(err == nil, "new client error: %v", err)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = serverConn.Close()
+	})
+	return client
+}
+
+func TestClient_TimeoutAttribution(t *testing.T) {
+	client := silentClient(t)
+	var reply int
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	err := client.Call(ctx, "Calc.Add", AddArgs{}, &reply)
+	_assert(errors.Is(err, context.DeadlineExceeded), "expect context deadline, got %v", err)
+	_assert(rpcerr.TimeoutSource(err) == rpcerr.TimeoutClientDeadline, "unexpected source in %v", err)
+
+	// 单次尝试超时后重试 全部失败时来源为单次尝试
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond, AttemptTimeout: 20 * time.Millisecond})
+	start := time.Now()
+	err = client.CallWithRetry(context.Background(), "Calc.Add", AddArgs{}, &reply)
+	_assert(rpcerr.TimeoutSource(err) == rpcerr.TimeoutAttempt, "unexpected source in %v", err)
+	_assert(time.Since(start) >= 60*time.Millisecond, "expect 3 attempts, took %v", time.Since(start))
+
+	// 调用方的截止时间早于单次尝试的超时 来源为调用方
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = client.CallWithRetry(ctx, "Calc.Add", AddArgs{}, &reply)
+	_assert(rpcerr.TimeoutSource(err) == rpcerr.TimeoutClientDeadline, "unexpected source in %v", err)
+
+	// 取消不是超时
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = client.Call(ctx, "Calc.Add", AddArgs{}, &reply)
+	_assert(errors.Is(err, context.Canceled) && rpcerr.TimeoutSource(err) == "", "unexpected error %v", err)
+}
+
+func TestClient_PropagatedDeadline(t *testing.T) {
+	s := server.NewServer()
+	_ = s.Register(new(Sleeper))
+	remaining := make(chan time.Duration, 1)
+	s.Use(func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		dl, _ := ctx.Deadline()
+		remaining <- time.Until(dl)
+		return handler(ctx, argv, replyv)
+	})
+	addr := serveTest(t, s)
+
+	client, err := Dial("tcp", addr, &server.Option{CodecType: codec.GobType, HandleTimeout: 50 * time.Millisecond})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var reply time.Duration
+	err = client.Call(ctx, "Sleeper.Sleep", time.Duration(0), &reply)
+	_assert(err == nil, "call error: %v", err)
+	d := <-remaining
+	_assert(d > 900*time.Millisecond && d <= time.Second, "server should see the remaining budget, got %v", d)
+
+	// 服务端的超时来源随结构化错误传回
+	err = client.Call(ctx, "Sleeper.Sleep", 200*time.Millisecond, &reply)
+	<-remaining
+	_assert(rpcerr.CodeOf(err) == rpcerr.DeadlineExceeded, "expect deadline exceeded, got %v", err)
+	_assert(rpcerr.TimeoutSource(err) == rpcerr.TimeoutServerHandle, "unexpected source in %v", err)
+}
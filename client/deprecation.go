@@ -0,0 +1,25 @@
+package client
+
+import "gmrpc/logger"
+
+// 设置弃用警告的日志 每个方法只输出一次 为空时关闭
+func (client *Client) SetDeprecationLogger(l logger.Logger) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.deprecationLogger = l
+}
+
+func (client *Client) logDeprecation(serviceMethod, msg string) {
+	client.mu.Lock()
+	l := client.deprecationLogger
+	if l == nil || client.deprecationLogged[serviceMethod] {
+		client.mu.Unlock()
+		return
+	}
+	if client.deprecationLogged == nil {
+		client.deprecationLogged = make(map[string]bool)
+	}
+	client.deprecationLogged[serviceMethod] = true
+	client.mu.Unlock()
+	l.Warn("rpc client: %s is deprecated: %s", serviceMethod, msg)
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"gmrpc/server"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type Users int
+
+func (u Users) GetUser(id int, reply *string) error {
+	*reply = fmt.Sprintf("user-%d", id)
+	return nil
+}
+
+func (u Users) Lookup(id int, reply *string) error {
+	*reply = fmt.Sprintf("legacy-%d", id)
+	return nil
+}
+
+type warnLogger struct {
+	mu   sync.Mutex
+	warn []string
+}
+
+func (l *warnLogger) Info(format string, v ...interface{})  {}
+func (l *warnLogger) Error(format string, v ...interface{}) {}
+func (l *warnLogger) Warn(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warn = append(l.warn, fmt.Sprintf(format, v...))
+}
+
+func TestClient_DeprecatedMethods(t *testing.T) {
+	var u Users
+	s := server.NewServer()
+	err := s.RegisterWithOptions(&u, server.ServiceOptions{Deprecated: map[string]server.Deprecation{
+		"Lookup": {Message: "use GetUser"},
+		"Fetch":  {Message: "renamed to GetUser", ForwardTo: "GetUser"},
+	}})
+	_assert(err == nil, "register error: %v", err)
+	addr := serveTest(t, s)
+
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	logs := new(warnLogger)
+	client.SetDeprecationLogger(logs)
+
+	// 未转发 仍由原方法处理
+	var reply string
+	call := <-client.Go("Users.Lookup", 1, &reply, nil).Done
+	_assert(call.Error == nil && reply == "legacy-1", "unexpected lookup result %q (%v)", reply, call.Error)
+	_assert(call.ResponseMeta.Get(server.DeprecatedKey) == "use GetUser", "missing deprecation metadata: %v", call.ResponseMeta)
+	_assert(call.ResponseMeta.Get(server.DeprecatedForwardToKey) == "", "unexpected forward target")
+
+	// 已删除的方法转发到新方法
+	for i := 0; i < 3; i++ {
+		call = <-client.Go("Users.Fetch", 2, &reply, nil).Done
+		_assert(call.Error == nil && reply == "user-2", "unexpected fetch result %q (%v)", reply, call.Error)
+		_assert(call.ResponseMeta.Get(server.DeprecatedKey) == "renamed to GetUser", "missing deprecation metadata: %v", call.ResponseMeta)
+		_assert(call.ResponseMeta.Get(server.DeprecatedForwardToKey) == "Users.GetUser", "unexpected forward target: %v", call.ResponseMeta)
+	}
+	_ = client.Call(context.Background(), "Users.Lookup", 3, &reply)
+
+	// 未弃用的方法不带弃用信息
+	call = <-client.Go("Users.GetUser", 4, &reply, nil).Done
+	_assert(call.Error == nil && reply == "user-4", "unexpected get result %q (%v)", reply, call.Error)
+	_, ok := call.ResponseMeta[server.DeprecatedKey]
+	_assert(!ok, "unexpected deprecation metadata: %v", call.ResponseMeta)
+
+	// 每个方法只输出一次警告
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+	_assert(len(logs.warn) == 2, "expected one warning per method, got %v", logs.warn)
+	_assert(strings.Contains(logs.warn[0], "Users.Lookup") && strings.Contains(logs.warn[1], "Users.Fetch"), "unexpected warnings %v", logs.warn)
+
+	// 反射接口显示弃用状态
+	var methods server.ListMethodsReply
+	err = client.Call(context.Background(), server.ReflectionService+".ListMethods", server.ListMethodsArgs{Service: "Users"}, &methods)
+	_assert(err == nil, "list methods error: %v", err)
+	got := make(map[string]server.MethodDescriptor)
+	for _, m := range methods.Methods {
+		got[m.Name] = m
+	}
+	_assert(len(got) == 3, "unexpected methods %v", methods.Methods)
+	_assert(got["Fetch"].Deprecated && got["Fetch"].ForwardTo == "GetUser" && got["Fetch"].ArgType == "int", "unexpected Fetch descriptor %+v", got["Fetch"])
+	_assert(got["Lookup"].Deprecated && got["Lookup"].Message == "use GetUser", "unexpected Lookup descriptor %+v", got["Lookup"])
+	_assert(!got["GetUser"].Deprecated, "GetUser should not be deprecated")
+}
+
+func TestServer_RegisterDeprecationErrors(t *testing.T) {
+	var u Users
+	for _, d := range []map[string]server.Deprecation{
+		{"Missing": {Message: "gone"}},
+		{"Fetch": {ForwardTo: "Missing"}},
+	} {
+		err := server.NewServer().RegisterWithOptions(&u, server.ServiceOptions{Deprecated: d})
+		_assert(err != nil, "invalid deprecation %v accepted", d)
+	}
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"gmrpc/server"
+	"net"
+	"strings"
+	"time"
+)
+
+/*
+多地址拨号 Dial 的地址为逗号分隔的列表时 (如 "10.0.0.1:9999,10.0.0.2:9999") 按 happy eyeballs 的方式竞争
+先连接第一个地址 DialStagger 内没有完成握手或连接失败时开始下一个 使用最先完成握手的连接 其余连接关闭
+ConnectTimeout 限制整个过程 全部失败时返回 *DialAllError 列出每个地址的错误
+握手不等待服务端响应时 (Option 没有 Capabilities 与 Compression) 建立 TCP 连接即视为成功
+*/
+
+// 开始下一个地址前等待的时间
+const DialStagger = 250 * time.Millisecond
+
+type AddrError struct {
+	Addr string
+	Err  error
+}
+
+// 所有地址都失败
+type DialAllError struct {
+	Errors []AddrError // 与地址列表的顺序一致
+}
+
+func (e *DialAllError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, ae := range e.Errors {
+		msgs[i] = ae.Addr + ": " + ae.Err.Error()
+	}
+	return fmt.Sprintf("rpc client: all %d addresses failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+func (e *DialAllError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, ae := range e.Errors {
+		errs[i] = ae.Err
+	}
+	return errs
+}
+
+// 拆分逗号分隔的地址 去掉空白与空项
+func splitAddrs(address string) []string {
+	var addrs []string
+	for _, a := range strings.Split(address, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+type raceResult struct {
+	i      int
+	client *Client
+	err    error
+}
+
+func dialRace(f newClientFunc, network string, addrs []string, opt *server.Option) (*Client, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if opt.ConnectTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), opt.ConnectTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	results := make(chan raceResult, len(addrs))
+	next, pending := 0, 0
+	start := func() {
+		i := next
+		next++
+		pending++
+		go func() {
+			c, err := dialAddr(ctx, f, network, addrs[i], opt)
+			results <- raceResult{i: i, client: c, err: err}
+		}()
+	}
+
+	timer := time.NewTimer(DialStagger)
+	defer timer.Stop()
+	errs := make([]error, len(addrs))
+	start()
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// 取消其余连接 稍后完成的连接关闭
+				cancel()
+				go func(n int) {
+					for ; n > 0; n-- {
+						if r := <-results; r.client != nil {
+							_ = r.client.Close()
+						}
+					}
+				}(pending)
+				return r.client, nil
+			}
+			errs[r.i] = r.err
+		case <-timer.C:
+		}
+		if next < len(addrs) {
+			start()
+			timer.Reset(DialStagger)
+		}
+	}
+
+	e := &DialAllError{Errors: make([]AddrError, len(addrs))}
+	for i, err := range errs {
+		e.Errors[i] = AddrError{Addr: addrs[i], Err: err}
+	}
+	return nil, e
+}
+
+// 建立连接并握手 ctx 结束时关闭连接中断握手
+func dialAddr(ctx context.Context, f newClientFunc, network, address string, opt *server.Option) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, dialContextError(ctx, opt, err)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	o := *opt
+	client, err := f(conn, &o)
+	if !stop() {
+		// 握手期间 ctx 已结束 连接已关闭
+		if client != nil {
+			_ = client.Close()
+		}
+		return nil, dialContextError(ctx, opt, ctx.Err())
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// 超过 ConnectTimeout 时与单地址拨号的错误一致
+func dialContextError(ctx context.Context, opt *server.Option, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("rpc client: connect timeout: expect within %s", opt.ConnectTimeout)
+	}
+	return err
+}
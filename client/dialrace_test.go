@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gmrpc/server"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 已关闭的端口 连接立即被拒绝
+func deadAddr(t *testing.T) string {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close()
+	return addr
+}
+
+// 接受连接但从不握手
+func silentAddr(t *testing.T) string {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		_ = l.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			_ = c.Close()
+		}
+	})
+	return l.Addr().String()
+}
+
+func TestDial_MultipleAddresses(t *testing.T) {
+	var c Calc
+	live := startTestServer(t, &c)
+	call := func(client *Client) {
+		var reply int
+		err := client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "unexpected result %d (%v)", reply, err)
+	}
+
+	t.Run("refused then live", func(t *testing.T) {
+		start := time.Now()
+		client, err := Dial("tcp", deadAddr(t)+", "+live)
+		_assert(err == nil, "dial error: %v", err)
+		defer func() { _ = client.Close() }()
+		_assert(time.Since(start) < DialStagger/2, "failed address should not wait for the stagger, took %s", time.Since(start))
+		call(client)
+	})
+
+	// 请求能力通告时握手需要服务端的响应 不响应的地址不会胜出
+	t.Run("silent then live", func(t *testing.T) {
+		start := time.Now()
+		client, err := Dial("tcp", silentAddr(t)+","+live, &server.Option{ConnectTimeout: 2 * time.Second, Capabilities: true})
+		_assert(err == nil, "dial error: %v", err)
+		defer func() { _ = client.Close() }()
+		elapsed := time.Since(start)
+		_assert(elapsed >= DialStagger && elapsed < DialStagger+time.Second, "expect second address after the stagger, took %s", elapsed)
+		call(client)
+	})
+
+	t.Run("all dead", func(t *testing.T) {
+		a, b := deadAddr(t), deadAddr(t)
+		_, err := Dial("tcp", a+","+b)
+		var all *DialAllError
+		_assert(errors.As(err, &all) && len(all.Errors) == 2, "expect aggregated error, got %v", err)
+		_assert(all.Errors[0].Addr == a && all.Errors[1].Addr == b, "unexpected addresses %+v", all.Errors)
+		_assert(strings.Contains(err.Error(), a+": ") && strings.Contains(err.Error(), b+": "), "error should name each address: %v", err)
+		var opErr *net.OpError
+		_assert(errors.As(err, &opErr), "expect underlying dial errors, got %v", err)
+	})
+
+	t.Run("connect timeout bounds the race", func(t *testing.T) {
+		start := time.Now()
+		_, err := Dial("tcp", silentAddr(t)+","+silentAddr(t), &server.Option{ConnectTimeout: 400 * time.Millisecond, Capabilities: true})
+		elapsed := time.Since(start)
+		var all *DialAllError
+		_assert(errors.As(err, &all) && strings.Contains(all.Errors[1].Err.Error(), "connect timeout"), "expect timeout for each address, got %v", err)
+		_assert(elapsed < 800*time.Millisecond, "expect ConnectTimeout to bound the whole dial, took %s", elapsed)
+	})
+}
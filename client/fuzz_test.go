@@ -0,0 +1,155 @@
+package client
+
+import (
+	"bytes"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 响应的字节由模糊测试给出 每种编码一个 v1 的 Option 握手之后直接是响应
+var fuzzOptions = []*server.Option{
+	{MagicNumber: server.MagicNumber, CodecType: codec.GobType, ProtocolVersion: 1},
+	{MagicNumber: server.MagicNumber, CodecType: codec.JsonType, ProtocolVersion: 1},
+	{MagicNumber: server.MagicNumber, CodecType: codec.GobType, HeaderType: codec.BinaryHeader, ProtocolVersion: 1},
+	{MagicNumber: server.MagicNumber, CodecType: codec.JsonType, HeaderType: codec.BinaryHeader, ProtocolVersion: 1},
+	{MagicNumber: server.MagicNumber, CodecType: codec.JSONRPC2Type, ProtocolVersion: 1},
+}
+
+// 单个输入的处理时间上限 超过视为挂起
+const fuzzTimeout = 5 * time.Second
+
+// 发出的调用 种子会话与模糊测试相同 响应按 seq 对应
+func fuzzCalls(client *Client) []*Call {
+	var sum int
+	var reading Reading
+	return []*Call{
+		client.Go("Calc.Add", AddArgs{Num1: 1, Num2: 2}, &sum, nil),
+		client.Go("Weather.Current", "Shenzhen", &reading, nil),
+		client.Go("Calc.Missing", AddArgs{}, &sum, nil),
+	}
+}
+
+// 记录读到的字节
+type recordConn struct {
+	net.Conn
+	mu   sync.Mutex
+	read bytes.Buffer
+}
+
+func (c *recordConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	c.read.Write(p[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+// 记录真实会话中服务端在握手之后发送的字节 作为模糊测试的种子
+func recordSession(t testing.TB, opt *server.Option) []byte {
+	s := server.NewServer()
+	_ = s.Register(new(Calc))
+	_ = s.Register(new(Weather))
+	serverConn, clientConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.ServeConn(serverConn)
+		close(done)
+	}()
+	conn := &recordConn{Conn: clientConn}
+	o := *opt
+	client, err := NewClient(conn, &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := fuzzCalls(client)
+	for _, call := range calls {
+		<-call.Done
+	}
+	_assert(calls[0].Error == nil && calls[1].Error == nil && calls[2].Error != nil, "session: unexpected results %v %v %v", calls[0].Error, calls[1].Error, calls[2].Error)
+	_ = client.Close()
+	<-done
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return append([]byte(nil), conn.read.Bytes()...)
+}
+
+// 调用发出后才开始返回固定的字节 写入丢弃 读完后返回 EOF
+type replayConn struct {
+	r     io.Reader
+	ready chan struct{}
+	once  sync.Once
+	done  chan struct{}
+}
+
+func newReplayConn(data []byte) *replayConn {
+	return &replayConn{r: bytes.NewReader(data), ready: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	select {
+	case <-c.ready:
+		return c.r.Read(p)
+	case <-c.done:
+		return 0, net.ErrClosed
+	}
+}
+
+func (c *replayConn) Write(p []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, net.ErrClosed
+	default:
+		return len(p), nil
+	}
+}
+
+func (c *replayConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
+}
+
+func (c *replayConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *replayConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *replayConn) SetDeadline(t time.Time) error      { return nil }
+func (c *replayConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *replayConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func FuzzClientReceive(f *testing.F) {
+	for i, opt := range fuzzOptions {
+		session := recordSession(f, opt)
+		f.Add(uint8(i), session)
+		f.Add(uint8(i), session[:len(session)/2])
+		f.Add(uint8(i), []byte{})
+	}
+
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(out) })
+
+	f.Fuzz(func(t *testing.T, which uint8, data []byte) {
+		opt := *fuzzOptions[int(which)%len(fuzzOptions)]
+		conn := newReplayConn(data)
+		client, err := NewClient(conn, &opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = client.Close() }()
+		calls := fuzzCalls(client)
+		close(conn.ready)
+
+		timeout := time.After(fuzzTimeout)
+		for _, call := range calls {
+			select {
+			case <-call.Done:
+			case <-timeout:
+				t.Fatalf("call %s not done within %s for %d bytes", call.ServiceMethod, fuzzTimeout, len(data))
+			}
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"math"
+	"net"
+	"runtime"
+	"sync/atomic"
+)
+
+/*
+按调用设置发送策略
+默认: 有其他调用排队发送时暂不刷新缓冲区 由最后一个发送者刷新 合并连续的小消息
+低延迟: 写入后立即刷新 并保证连接关闭 Nagle 算法
+批量: 允许内核合并发送(开启 Nagle) 等待中的低延迟调用优先获得发送权
+注意: 不增大 socket 发送缓冲区 内核中排队的数据越多 后续 ping 的排队延迟越高
+*/
+
+type sendHint int
+
+const (
+	hintDefault sendHint = iota
+	hintLowLatency
+	hintBulk
+)
+
+type sendHintKey struct{}
+
+// 本次调用写入后立即发送
+func WithLowLatency(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sendHintKey{}, hintLowLatency)
+}
+
+// 本次调用允许与其他数据合并发送
+func WithBulk(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sendHintKey{}, hintBulk)
+}
+
+func sendHintFromContext(ctx context.Context) sendHint {
+	h, _ := ctx.Value(sendHintKey{}).(sendHint)
+	return h
+}
+
+// 获取 sending 锁 批量调用让出给等待中的低延迟调用
+func (client *Client) lockSending(hint sendHint) {
+	atomic.AddInt32(&client.waiting, 1)
+	defer atomic.AddInt32(&client.waiting, -1)
+	switch hint {
+	case hintLowLatency:
+		atomic.AddInt32(&client.urgent, 1)
+		defer atomic.AddInt32(&client.urgent, -1)
+	case hintBulk:
+		for atomic.LoadInt32(&client.urgent) > 0 {
+			runtime.Gosched()
+		}
+	}
+	client.sending.Lock()
+}
+
+// 写入请求 调用方持有 sending 锁 flush 为 false 时不刷新发送缓冲区
+func (client *Client) write(call *Call, flush bool) error {
+	if r, ok := streamingArg(call.Args); ok {
+		defer func() { _ = r.Close() }()
+		if !client.protocol.Features.Has(server.FeatureStreaming) {
+			return errStreamingUnsupported
+		}
+		return codec.WriteStream(client.cc, &client.header, r)
+	}
+	if client.largeArgs(call.Args) {
+		return codec.WriteChunked(client.cc, &client.header, call.Args, 0)
+	}
+	bw, ok := client.cc.(codec.BufferedWriter)
+	if !ok {
+		return client.cc.Write(&client.header, call.Args)
+	}
+	client.setNagle(call.hint == hintBulk)
+	if err := bw.WriteBuffered(&client.header, call.Args); err != nil {
+		return err
+	}
+	// 还有调用在等待发送时 由后面的发送者负责刷新
+	if !flush || call.hint != hintLowLatency && atomic.LoadInt32(&client.waiting) > 0 {
+		return nil
+	}
+	return bw.Flush()
+}
+
+// 只在状态变化时修改 socket 选项 调用方持有 sending 锁
+func (client *Client) setNagle(on bool) {
+	tc, ok := client.conn.(*net.TCPConn)
+	if !ok || client.nagle == on {
+		return
+	}
+	if err := tc.SetNoDelay(!on); err == nil {
+		client.nagle = on
+	}
+}
+
+// 参数编码后一定超过 Option.LargeArgThresholdBytes 时分块发送
+// 按 codec.MinBodySize 的下界判断 不额外编码一次 下界没有超过阈值的参数按普通消息发送
+func (client *Client) largeArgs(args interface{}) bool {
+	limit := client.opt.LargeArgThresholdBytes
+	if limit <= 0 || !client.protocol.Features.Has(server.FeatureChunkedArgs) {
+		return false
+	}
+	if _, ok := client.cc.(codec.BodyMarshaler); !ok {
+		return false
+	}
+	n := int(min(limit, math.MaxInt32))
+	return codec.MinBodySize(args, n) > n
+}
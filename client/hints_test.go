@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type Blob int
+
+func (b Blob) Echo(data []byte, reply *[]byte) error {
+	*reply = data
+	return nil
+}
+
+func (b Blob) Upload(data []byte, reply *int) error {
+	*reply = len(data)
+	return nil
+}
+
+func (b Blob) Ping(n int, reply *int) error {
+	*reply = n
+	return nil
+}
+
+// 混合使用各种发送策略时 每个请求都能及时发出
+func TestClient_SendHints(t *testing.T) {
+	var b Blob
+	client, _ := Dial("tcp", startTestServer(t, &b))
+	defer func() { _ = client.Close() }()
+
+	ctxs := []context.Context{context.Background(), WithLowLatency(context.Background()), WithBulk(context.Background())}
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctxs[i%3], time.Second)
+			defer cancel()
+			for j := 0; j < 50; j++ {
+				var reply []byte
+				err := client.Call(ctx, "Blob.Echo", make([]byte, 1<<(j%16)), &reply)
+				_assert(err == nil && len(reply) == 1<<(j%16), "call %d/%d failed: %v", i, j, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// 与批量上传混合时 ping 的 p99 延迟
+func BenchmarkClient_PingWithBulkTraffic(b *testing.B) {
+	for _, bc := range []struct {
+		name     string
+		ping     func(context.Context) context.Context
+		bulkCtx  func(context.Context) context.Context
+		bulkSize int
+	}{
+		{"default", func(ctx context.Context) context.Context { return ctx }, func(ctx context.Context) context.Context { return ctx }, 16 << 10},
+		{"hinted", WithLowLatency, WithBulk, 16 << 10},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var blob Blob
+			client, _ := Dial("tcp", startTestServer(b, &blob))
+			defer func() { _ = client.Close() }()
+
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			for i := 0; i < 32; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					payload := make([]byte, bc.bulkSize)
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						var n int
+						_ = client.Call(bc.bulkCtx(context.Background()), "Blob.Upload", payload, &n)
+					}
+				}()
+			}
+
+			latencies := make([]time.Duration, 0, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				var reply int
+				_ = client.Call(bc.ping(context.Background()), "Blob.Ping", i, &reply)
+				latencies = append(latencies, time.Since(start))
+			}
+			b.StopTimer()
+			close(stop)
+			wg.Wait()
+
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Microseconds()), "p99-us")
+		})
+	}
+}
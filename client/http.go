@@ -0,0 +1,68 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"io"
+	"log"
+	"net"
+	"net/http"
+)
+
+// 读取走缓冲区 HTTP 响应之后的数据可能已被读入
+type bufConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// 以 HTTP 请求头发送 Option 服务端返回 200 后在同一连接上通信
+func NewHTTPClientWithHeaders(conn net.Conn, opt *server.Option) (*Client, error) {
+	opt = withProtocolDefaults(opt)
+	if _, err := io.WriteString(conn, "CONNECT "+server.HTTPPath+" HTTP/1.0\r\n"); err != nil {
+		return nil, err
+	}
+	if err := opt.HTTPHeader().Write(conn); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(conn, "\r\n"); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != server.HTTPConnected {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, errors.New("rpc client: unexpected HTTP response: " + resp.Status + " " + string(body))
+	}
+
+	caps, compression, ack, err := readHandshake(br, opt)
+	if err != nil {
+		log.Println("rpc client: handshake error: ", err)
+		return nil, err
+	}
+	cc, err := newCodec(&bufConn{Conn: conn, r: br}, opt, codec.DefaultCodecRegistry)
+	if err == nil {
+		err = setCompression(cc, compression, opt)
+	}
+	if err != nil {
+		log.Println("rpc client: codec error:", err)
+		return nil, err
+	}
+	client := newClientCodec(cc, opt, caps, negotiatedProtocol(opt, ack))
+	client.conn = conn
+	client.compression = compression
+	return client, nil
+}
+
+func DialHTTPWithHeaders(network, address string, opts ...*server.Option) (*Client, error) {
+	return dialTimeout(NewHTTPClientWithHeaders, network, address, opts...)
+}
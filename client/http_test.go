@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_DialHTTPWithHeaders(t *testing.T) {
+	var c Calc
+	s := server.NewServer()
+	_ = s.Register(&c)
+	ts := httptest.NewServer(http.HandlerFunc(s.ServeHTTPConn))
+	defer ts.Close()
+	addr := ts.Listener.Addr().String()
+
+	for _, opt := range []*server.Option{
+		{CodecType: codec.GobType, ConnectTimeout: time.Second},
+		{CodecType: codec.JsonType, ConnectTimeout: time.Second, StrictDecoding: true},
+		{CodecType: codec.JsonType, HeaderType: codec.BinaryHeader, ConnectTimeout: time.Second, HandleTimeout: time.Second},
+		{CodecType: codec.GobType, ConnectTimeout: time.Second, Capabilities: true},
+	} {
+		client, err := DialHTTPWithHeaders("tcp", addr, opt)
+		_assert(err == nil, "dial error: %v", err)
+		_assert(client.HasMethod("Calc.Add") == opt.Capabilities, "unexpected capabilities %v", client.Capabilities())
+		var reply int
+		err = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "%s/%s: unexpected result %d (%v)", opt.HeaderType, opt.CodecType, reply, err)
+		_ = client.Close()
+	}
+
+	// 请求头中的选项无效时返回 400 不劫持连接
+	bad := (&server.Option{MagicNumber: server.MagicNumber, CodecType: "xml"}).HTTPHeader()
+	for _, h := range []http.Header{bad, {}} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+server.HTTPPath, nil)
+		req.Header = h
+		resp, err := http.DefaultClient.Do(req)
+		_assert(err == nil && resp.StatusCode == http.StatusBadRequest, "invalid options should be rejected: %v", err)
+		_ = resp.Body.Close()
+	}
+	http.DefaultClient.CloseIdleConnections()
+}
+
+func TestOptionFromHTTPHeader(t *testing.T) {
+	opt := &server.Option{
+		MagicNumber:    server.MagicNumber,
+		CodecType:      codec.JsonType,
+		HeaderType:     codec.BinaryHeader,
+		HandleTimeout:  1500 * time.Millisecond,
+		StrictDecoding: true,
+	}
+	got, err := server.OptionFromHTTPHeader(opt.HTTPHeader())
+	_assert(err == nil && *got == *opt, "round trip mismatch: %+v (%v)", got, err)
+
+	h := opt.HTTPHeader()
+	h.Set(server.HTTPMagicHeader, "1")
+	_, err = server.OptionFromHTTPHeader(h)
+	_assert(err != nil, "bad magic number accepted")
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"errors"
+	"gmrpc/server"
+	"sort"
+	"time"
+)
+
+/*
+查看与取消进行中的调用 供管理页面使用
+InflightCalls 返回快照 不持有锁 以 _ 开头的内部调用不列出
+*/
+
+var ErrCanceled = errors.New("rpc client: call canceled")
+
+type CallInfo struct {
+	Seq           uint64
+	ServiceMethod string
+	Elapsed       time.Duration     // 发送后经过的时间
+	Metadata      map[string]string // 请求元数据的副本
+}
+
+// 按 Seq 排序的进行中调用
+func (client *Client) InflightCalls() []CallInfo {
+	now := time.Now()
+	client.mu.Lock()
+	calls := make([]CallInfo, 0, len(client.pending))
+	for seq, call := range client.pending {
+		if server.IsReserved(call.ServiceMethod) {
+			continue
+		}
+		info := CallInfo{Seq: seq, ServiceMethod: call.ServiceMethod, Elapsed: now.Sub(call.start)}
+		if call.Metadata != nil {
+			info.Metadata = make(map[string]string, len(call.Metadata))
+			for k, v := range call.Metadata {
+				info.Metadata[k] = v
+			}
+		}
+		calls = append(calls, info)
+	}
+	client.mu.Unlock()
+	sort.Slice(calls, func(i, j int) bool { return calls[i].Seq < calls[j].Seq })
+	return calls
+}
+
+// 以 ErrCanceled 结束调用 协商了取消帧时通知服务端 调用已经结束时返回 false
+func (client *Client) Cancel(seq uint64) bool {
+	call := client.removeCall(seq)
+	if call == nil {
+		return false
+	}
+	call.Error = ErrCanceled
+	call.done()
+	if !server.IsReserved(call.ServiceMethod) {
+		client.cancelRemote(seq)
+	}
+	return true
+}
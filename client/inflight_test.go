@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gmrpc/metadata"
+	"gmrpc/server"
+	"testing"
+	"time"
+)
+
+func TestClient_InflightCalls(t *testing.T) {
+	s := server.NewServer()
+	_ = s.Register(new(Sleeper))
+	addr := serveTest(t, s)
+	t.Cleanup(func() {
+		// 取消后服务端的处理函数仍在运行
+		for s.Stats().Inflight > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	errs := make(chan error, 2)
+	for _, user := range []string{"a", "b"} {
+		ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("user", user))
+		go func() {
+			var reply time.Duration
+			errs <- client.Call(ctx, "Sleeper.Sleep", 200*time.Millisecond, &reply)
+		}()
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	calls := client.InflightCalls()
+	_assert(len(calls) == 2, "expect 2 in-flight calls, got %+v", calls)
+	_assert(calls[0].ServiceMethod == "Sleeper.Sleep" && calls[0].Metadata["user"] == "a" && calls[1].Metadata["user"] == "b", "unexpected calls %+v", calls)
+	_assert(calls[0].Seq < calls[1].Seq && calls[0].Elapsed >= calls[1].Elapsed, "calls should be ordered by seq: %+v", calls)
+	// 快照与客户端内部状态无关
+	calls[0].Metadata["user"] = "changed"
+	_assert(client.InflightCalls()[0].Metadata["user"] == "a", "snapshot should copy metadata")
+
+	_assert(client.Cancel(calls[0].Seq), "cancel should succeed")
+	_assert(!client.Cancel(calls[0].Seq), "second cancel should report false")
+	err1 := <-errs
+	_assert(errors.Is(err1, ErrCanceled), "expect cancelled call first, got %v", err1)
+	err2 := <-errs
+	_assert(err2 == nil, "other call should succeed, got %v", err2)
+	_assert(len(client.InflightCalls()) == 0, "no calls should remain")
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"gmrpc/logger"
+	"reflect"
+)
+
+type Logger = logger.Logger
+
+// 真正发起调用的函数
+type UnaryInvoker func(ctx context.Context, serviceMethod string, args, reply interface{}) error
+
+// 客户端拦截器 在调用前后插入逻辑 由拦截器决定是否调用 invoker
+type ClientInterceptor func(ctx context.Context, client *Client, serviceMethod string, args, reply interface{}, invoker UnaryInvoker) error
+
+// 注册拦截器 按注册顺序由外向内执行
+func (client *Client) Use(interceptors ...ClientInterceptor) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.interceptors = append(client.interceptors, interceptors...)
+}
+
+func (client *Client) chainInterceptors(invoker UnaryInvoker) UnaryInvoker {
+	client.mu.Lock()
+	interceptors := client.interceptors
+	client.mu.Unlock()
+
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+			return interceptor(ctx, client, serviceMethod, args, reply, next)
+		}
+	}
+	return invoker
+}
+
+// 响应转换函数 在结果返回给调用方前对 reply 做后处理(解密 解压 类型转换等)
+type ClientResponseTransformer func(method string, reply interface{}) error
+
+func WithResponseTransformer(fn ClientResponseTransformer) ClientInterceptor {
+	return func(ctx context.Context, client *Client, serviceMethod string, args, reply interface{}, invoker UnaryInvoker) error {
+		if err := invoker(ctx, serviceMethod, args, reply); err != nil {
+			return err
+		}
+		return fn(serviceMethod, reply)
+	}
+}
+
+// 记录每次调用的结果 带有请求编号 可与服务端日志对应
+func WithResponseLogging(logger Logger) ClientInterceptor {
+	return func(ctx context.Context, client *Client, serviceMethod string, args, reply interface{}, invoker UnaryInvoker) error {
+		var seq uint64
+		if err := invoker(WithCallSeq(ctx, &seq), serviceMethod, args, reply); err != nil {
+			return err
+		}
+		if seq == 0 {
+			// 没有经过真实的调用 例如被其他拦截器短路
+			logger.Info("rpc client: %s reply: %+v", serviceMethod, indirect(reply))
+			return nil
+		}
+		logger.Info("rpc client: %s reply: %+v seq=%d", serviceMethod, indirect(reply), seq)
+		return nil
+	}
+}
+
+func indirect(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		return rv.Elem().Interface()
+	}
+	return v
+}
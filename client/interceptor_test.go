@@ -0,0 +1,68 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"gmrpc/logger"
+	"gmrpc/server"
+	"net"
+	"strings"
+	"testing"
+)
+
+type Reading struct {
+	City string
+	Temp int
+}
+
+type Weather int
+
+func (w Weather) Current(city string, reply *Reading) error {
+	reply.City = city
+	reply.Temp = 100 // 摄氏度
+	return nil
+}
+
+// 启动独立的服务端 返回监听地址
+func startTestServer(t testing.TB, rcvrs ...interface{}) string {
+	s := server.NewServer()
+	for _, rcvr := range rcvrs {
+		_ = s.Register(rcvr)
+	}
+	return serveTest(t, s)
+}
+
+// 测试结束时关闭监听
+func serveTest(t testing.TB, s *server.Server) string {
+	l, _ := net.Listen("tcp", ":0")
+	t.Cleanup(func() { _ = l.Close() })
+	go s.Accept(l)
+	return l.Addr().String()
+}
+
+func TestClient_ResponseTransformer(t *testing.T) {
+	var w Weather
+	addr := startTestServer(t, &w)
+
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var buf bytes.Buffer
+	client.Use(
+		WithResponseLogging(logger.New(&buf)),
+		WithResponseTransformer(func(method string, reply interface{}) error {
+			r := reply.(*Reading)
+			r.Temp = r.Temp*9/5 + 32
+			return nil
+		}),
+	)
+
+	var reply Reading
+	err = client.Call(context.Background(), "Weather.Current", "Beijing", &reply)
+	_assert(err == nil, "call error: %v", err)
+	_assert(reply.Temp == 212, "expect 212 fahrenheit, but got %d", reply.Temp)
+	// 日志拦截器在外层 看到的是转换后的结果
+	_assert(strings.Contains(buf.String(), "Temp:212"), "expect logged reply, got %q", buf.String())
+	_assert(strings.Contains(buf.String(), "seq=1"), "expect logged seq, got %q", buf.String())
+}
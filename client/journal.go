@@ -0,0 +1,219 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"gmrpc/codec"
+	"gmrpc/metadata"
+	"gmrpc/server"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+请求日志 记录客户端发出的每次调用 用于线上问题复现
+参数统一以 json 编码保存 与客户端使用的编解码类型无关 回放时以 json 编码发送
+只有参数可以 json 编码的调用能够回放 编码失败时调用照常发送 记录中只保存失败原因
+*/
+
+type JournalEntry struct {
+	ServiceMethod string
+	Metadata      map[string]string
+	Args          json.RawMessage // 编码后的参数
+	ArgsError     string          // 参数 json 编码失败的原因 不为空时 Args 为空 不能回放
+	Start         time.Time
+	End           time.Time
+	Error         string // 调用结果 为空表示成功
+}
+
+type Journal interface {
+	Record(entry *JournalEntry) error
+}
+
+// 脱敏函数 入参为参数 json 解码后的通用结构 返回替换后的值
+type RedactFunc func(args interface{}) interface{}
+
+// 将顶层字段替换为 [REDACTED]
+func RedactFields(fields ...string) RedactFunc {
+	return func(args interface{}) interface{} {
+		m, ok := args.(map[string]interface{})
+		if !ok {
+			return args
+		}
+		for _, f := range fields {
+			if _, ok := m[f]; ok {
+				m[f] = "[REDACTED]"
+			}
+		}
+		return m
+	}
+}
+
+// 记录请求日志的拦截器 redact 以 Service.Method 为键
+func WithJournal(j Journal, redact map[string]RedactFunc) ClientInterceptor {
+	return func(ctx context.Context, client *Client, serviceMethod string, args, reply interface{}, invoker UnaryInvoker) error {
+		entry := &JournalEntry{ServiceMethod: serviceMethod, Start: time.Now()}
+		if md, ok := metadata.FromOutgoingContext(ctx); ok {
+			entry.Metadata = md
+		}
+		if argsData, err := encodeJournalArgs(args, redact[serviceMethod]); err != nil {
+			log.Println("rpc client: journal encode args error:", err)
+			entry.ArgsError = err.Error()
+		} else {
+			entry.Args = argsData
+		}
+
+		err := invoker(ctx, serviceMethod, args, reply)
+		entry.End = time.Now()
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		if jerr := j.Record(entry); jerr != nil {
+			log.Println("rpc client: journal record error:", jerr)
+		}
+		return err
+	}
+}
+
+func encodeJournalArgs(args interface{}, redact RedactFunc) ([]byte, error) {
+	data, err := json.Marshal(args)
+	if err != nil || redact == nil {
+		return data, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(redact(v))
+}
+
+// 文件日志 每条记录为 [4 字节大端长度][json 编码的 JournalEntry]
+type FileJournal struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+}
+
+func NewFileJournal(path string) (*FileJournal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileJournal{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (j *FileJournal) Record(entry *JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+	if _, err := j.w.Write(size[:]); err != nil {
+		return err
+	}
+	if _, err := j.w.Write(data); err != nil {
+		return err
+	}
+	return j.w.Flush()
+}
+
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.w.Flush(); err != nil {
+		_ = j.f.Close()
+		return err
+	}
+	return j.f.Close()
+}
+
+var _ Journal = (*FileJournal)(nil)
+
+// 读取 FileJournal 写入的全部记录
+func ReadJournal(r io.Reader) ([]*JournalEntry, error) {
+	br := bufio.NewReader(r)
+	var entries []*JournalEntry
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(br, size[:]); err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return entries, err
+		}
+		data := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(br, data); err != nil {
+			return entries, err
+		}
+		entry := new(JournalEntry)
+		if err := json.Unmarshal(data, entry); err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+type ReplayResult struct {
+	Entry *JournalEntry
+	Reply json.RawMessage
+	Error error
+}
+
+// 将记录的调用依次重新发往目标地址 参数没有记录下来的调用不会发送 结果中返回错误
+func Replay(ctx context.Context, entries []*JournalEntry, network, address string) ([]ReplayResult, error) {
+	client, err := Dial(network, address, &server.Option{CodecType: codec.JsonType})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = client.Close() }()
+
+	results := make([]ReplayResult, 0, len(entries))
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		if entry.ArgsError != "" {
+			results = append(results, ReplayResult{Entry: entry, Error: errArgsNotRecorded})
+			continue
+		}
+		callCtx := ctx
+		if entry.Metadata != nil {
+			callCtx = metadata.NewOutgoingContext(ctx, metadata.New(entry.Metadata))
+		}
+		var reply json.RawMessage
+		err := client.Call(callCtx, entry.ServiceMethod, entry.Args, &reply)
+		results = append(results, ReplayResult{Entry: entry, Reply: reply, Error: err})
+	}
+	return results, nil
+}
+
+var (
+	errEmptyJournal    = errors.New("rpc client: empty journal")
+	errArgsNotRecorded = errors.New("rpc client: journal entry has no args to replay")
+)
+
+// 从 FileJournal 文件回放
+func ReplayFile(ctx context.Context, path, network, address string) ([]ReplayResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := ReadJournal(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errEmptyJournal
+	}
+	return Replay(ctx, entries, network, address)
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gmrpc/metadata"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type RecordArgs struct {
+	User     string
+	Password string
+	Amount   int
+}
+
+type Recorder struct {
+	mu     sync.Mutex
+	inputs []RecordArgs
+}
+
+func (r *Recorder) Record(args RecordArgs, reply *int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inputs = append(r.inputs, args)
+	*reply = len(r.inputs)
+	return nil
+}
+
+func (r *Recorder) Login(args RecordArgs, reply *int) error {
+	return r.Record(args, reply)
+}
+
+func TestClient_JournalReplay(t *testing.T) {
+	origin, target := new(Recorder), new(Recorder)
+	originAddr, targetAddr := startTestServer(t, origin), startTestServer(t, target)
+
+	path := filepath.Join(t.TempDir(), "journal.log")
+	journal, err := NewFileJournal(path)
+	_assert(err == nil, "open journal error: %v", err)
+
+	client, _ := Dial("tcp", originAddr)
+	defer func() { _ = client.Close() }()
+	client.Use(WithJournal(journal, map[string]RedactFunc{
+		"Recorder.Login": RedactFields("Password"),
+	}))
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("trace-id", "t-1"))
+	for i := 0; i < 5; i++ {
+		var reply int
+		err := client.Call(ctx, "Recorder.Record", RecordArgs{User: "u", Password: "p", Amount: i}, &reply)
+		_assert(err == nil, "call error: %v", err)
+	}
+	var reply int
+	_ = client.Call(ctx, "Recorder.Login", RecordArgs{User: "admin", Password: "secret"}, &reply)
+	_ = client.Call(ctx, "Recorder.Missing", RecordArgs{}, &reply)
+	_assert(journal.Close() == nil, "close journal error")
+
+	results, err := ReplayFile(context.Background(), path, "tcp", targetAddr)
+	_assert(err == nil, "replay error: %v", err)
+	_assert(len(results) == 7, "expect 7 replayed calls, but got %d", len(results))
+
+	entry := results[0].Entry
+	_assert(entry.Metadata["trace-id"] == "t-1", "expect journaled metadata, got %v", entry.Metadata)
+	_assert(!entry.End.Before(entry.Start), "wrong timestamps")
+	_assert(results[6].Entry.Error != "" && results[6].Error != nil, "expect unknown method outcome recorded")
+
+	var login map[string]interface{}
+	_ = json.Unmarshal(results[5].Entry.Args, &login)
+	_assert(login["Password"] == "[REDACTED]", "expect password redacted, got %v", login["Password"])
+
+	// 除脱敏字段外 回放后处理函数看到的输入与原始调用一致
+	_assert(len(target.inputs) == len(origin.inputs), "expect %d inputs, but got %d", len(origin.inputs), len(target.inputs))
+	_assert(reflect.DeepEqual(origin.inputs[:5], target.inputs[:5]), "replayed inputs differ: %v vs %v", origin.inputs, target.inputs)
+	_assert(target.inputs[5].Password == "[REDACTED]" && target.inputs[5].User == "admin", "unexpected login input %v", target.inputs[5])
+}
+
+// gob 忽略函数字段 json 不能编码
+type HookedArgs struct {
+	User string
+	Hook func()
+}
+
+// 参数不能 json 编码时调用照常发送 记录中只有失败原因 回放时跳过
+func TestClient_JournalArgsError(t *testing.T) {
+	origin, target := new(Recorder), new(Recorder)
+	originAddr, targetAddr := startTestServer(t, origin), startTestServer(t, target)
+	journal := new(memJournal)
+
+	client, _ := Dial("tcp", originAddr)
+	defer func() { _ = client.Close() }()
+	client.Use(WithJournal(journal, nil))
+
+	var reply int
+	err := client.Call(context.Background(), "Recorder.Record", HookedArgs{User: "u", Hook: func() {}}, &reply)
+	_assert(err == nil && reply == 1, "call error: %v", err)
+	_assert(len(journal.entries) == 1, "expect 1 entry, got %d", len(journal.entries))
+	entry := journal.entries[0]
+	_assert(entry.ArgsError != "" && entry.Args == nil, "expect args error recorded, got %+v", entry)
+
+	results, err := Replay(context.Background(), journal.entries, "tcp", targetAddr)
+	_assert(err == nil, "replay error: %v", err)
+	_assert(len(results) == 1 && errors.Is(results[0].Error, errArgsNotRecorded), "unexpected replay results %+v", results)
+	_assert(len(target.inputs) == 0, "entry without args should not be replayed")
+}
+
+type memJournal struct {
+	mu      sync.Mutex
+	entries []*JournalEntry
+}
+
+func (j *memJournal) Record(entry *JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, entry)
+	return nil
+}
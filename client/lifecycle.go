@@ -0,0 +1,19 @@
+package client
+
+/*
+连接的生命周期 接收循环退出后客户端不再可用 Done 关闭 Err 给出原因
+主动 Close 为 ErrShutdown 收到服务端关闭通知后为 *ServerClosedError 其他情况为读取错误 (如 io.EOF 与校验失败)
+连接池与 XClient 据此立即移出失效的连接 不必等到下一次调用失败
+*/
+
+// 接收循环退出时关闭
+func (client *Client) Done() <-chan struct{} {
+	return client.done
+}
+
+// 接收循环退出的原因 仍在运行时为 nil
+func (client *Client) Err() error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.err
+}
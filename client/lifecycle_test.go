@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gmrpc/server"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 服务端 kill 关闭已建立的连接 模拟进程退出
+func killableServer(t *testing.T, rcvrs ...interface{}) (addr string, kill func()) {
+	s := server.NewServer()
+	for _, rcvr := range rcvrs {
+		_ = s.Register(rcvr)
+	}
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+			go s.ServeConn(conn)
+		}
+	}()
+	kill = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			_ = c.Close()
+		}
+		conns = nil
+	}
+	t.Cleanup(func() {
+		_ = l.Close()
+		kill()
+	})
+	return l.Addr().String(), kill
+}
+
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func waitDone(t *testing.T, c *Client) {
+	t.Helper()
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done not closed")
+	}
+}
+
+func TestClient_DoneOnKilledServer(t *testing.T) {
+	addr, kill := killableServer(t, new(Calc))
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	_assert(client.Err() == nil && !closed(client.Done()), "running client should have no error")
+
+	kill()
+	waitDone(t, client)
+	_assert(errors.Is(client.Err(), io.EOF), "expect io.EOF, got %v", client.Err())
+	_assert(!client.IsAvailable(), "client should be unavailable")
+	// 之后的 Close 不改变已记录的原因
+	_ = client.Close()
+	_assert(errors.Is(client.Err(), io.EOF), "Close should keep the terminal error, got %v", client.Err())
+}
+
+func TestClient_DoneOnClose(t *testing.T) {
+	addr := startTestServer(t, new(Calc))
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	_assert(client.Close() == nil, "close failed")
+	waitDone(t, client)
+	_assert(client.Err() == ErrShutdown, "expect ErrShutdown, got %v", client.Err())
+	_assert(client.Close() == ErrShutdown && closed(client.Done()), "second Close should not reopen Done")
+}
+
+func TestClient_DoneOnServerShutdown(t *testing.T) {
+	s := server.NewServer()
+	_ = s.Register(new(Calc))
+	client, err := Dial("tcp", serveTest(t, s))
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	_assert(s.ShutdownWithNotice(context.Background(), server.ClosingNotice{Reason: "deploy"}) == nil, "shutdown failed")
+	waitDone(t, client)
+	var sc *ServerClosedError
+	_assert(errors.As(client.Err(), &sc) && sc.Reason == "deploy", "expect ServerClosedError, got %v", client.Err())
+}
+
+// 连接断开后不经调用即移出连接池
+func TestPool_EvictsKilledMember(t *testing.T) {
+	addr, kill := killableServer(t, new(Calc))
+	p, _ := NewPool("tcp", addr, 2)
+	defer func() { _ = p.Close() }()
+	_assert(p.Warm(context.Background(), 2) == nil, "warm failed")
+	_assert(p.Connected() == 2, "expect 2 connections, got %d", p.Connected())
+	p.mu.Lock()
+	members := append([]*Client(nil), p.clients...)
+	p.mu.Unlock()
+
+	kill()
+	for _, c := range members {
+		waitDone(t, c)
+	}
+	eventually(func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.clients[0] == nil && p.clients[1] == nil
+	}, "expect killed members to be evicted")
+	_assert(p.Connected() == 0, "expect no connections, got %d", p.Connected())
+
+	var reply int
+	_assert(p.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply) == nil && reply == 3, "pool should redial")
+}
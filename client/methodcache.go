@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/server"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+方法缓存 通过服务端的反射服务获取已注册的方法
+开启后调用未知方法会在客户端直接失败 不必等待一次往返
+*/
+
+var ErrUnknownMethod = errors.New("rpc client: unknown method")
+
+type methodCache struct {
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	methods map[string]struct{} // Service.Method
+	expires time.Time
+
+	refreshing sync.Mutex // 避免并发刷新
+}
+
+func (mc *methodCache) valid(now time.Time) bool {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	return mc.methods != nil && now.Before(mc.expires)
+}
+
+func (mc *methodCache) has(serviceMethod string) bool {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	_, ok := mc.methods[serviceMethod]
+	return ok
+}
+
+func (mc *methodCache) invalidate() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.expires = time.Time{}
+}
+
+// 开启方法缓存并立即拉取一次 ttl 为缓存有效期
+func (client *Client) EnableMethodCache(ctx context.Context, ttl time.Duration) error {
+	mc := &methodCache{ttl: ttl}
+	client.mu.Lock()
+	client.methods = mc
+	client.mu.Unlock()
+	return client.refreshMethods(ctx, mc)
+}
+
+// 关闭方法缓存 适用于服务会动态注册的场景
+func (client *Client) DisableMethodCache() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.methods = nil
+}
+
+// 立即刷新方法缓存
+func (client *Client) RefreshMethods(ctx context.Context) error {
+	mc := client.methodCache()
+	if mc == nil {
+		return errors.New("rpc client: method cache is not enabled")
+	}
+	mc.invalidate()
+	return client.refreshMethods(ctx, mc)
+}
+
+func (client *Client) methodCache() *methodCache {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.methods
+}
+
+func (client *Client) refreshMethods(ctx context.Context, mc *methodCache) error {
+	mc.refreshing.Lock()
+	defer mc.refreshing.Unlock()
+
+	// 等待期间其他协程可能已经刷新
+	now := time.Now()
+	if mc.valid(now) {
+		return nil
+	}
+
+	var services server.ListServicesReply
+	if err := client.call(ctx, server.ReflectionService+".ListServices", server.ListServicesArgs{}, &services); err != nil {
+		return err
+	}
+	methods := make(map[string]struct{})
+	for _, svc := range services.Services {
+		var reply server.ListMethodsReply
+		if err := client.call(ctx, server.ReflectionService+".ListMethods", server.ListMethodsArgs{Service: svc}, &reply); err != nil {
+			return err
+		}
+		for _, m := range reply.Methods {
+			methods[svc+"."+m.Name] = struct{}{}
+		}
+	}
+
+	mc.mu.Lock()
+	mc.methods = methods
+	mc.expires = now.Add(mc.ttl)
+	mc.mu.Unlock()
+	return nil
+}
+
+type skipMethodCheckKey struct{}
+
+// 跳过本次调用的方法检查
+func WithoutMethodCheck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipMethodCheckKey{}, true)
+}
+
+// 检查方法是否存在 缓存不可用时放行 交给服务端判断
+func (client *Client) checkMethod(ctx context.Context, serviceMethod string) error {
+	if err := validateServiceMethod(serviceMethod); err != nil {
+		return err
+	}
+	mc := client.methodCache()
+	if mc == nil || strings.HasPrefix(serviceMethod, "_") {
+		return nil
+	}
+	if skip, _ := ctx.Value(skipMethodCheckKey{}).(bool); skip {
+		return nil
+	}
+	if !mc.valid(time.Now()) {
+		refreshCtx, cancel := ctx, context.CancelFunc(func() {})
+		if client.opt.ConnectTimeout > 0 {
+			refreshCtx, cancel = context.WithTimeout(ctx, client.opt.ConnectTimeout)
+		}
+		err := client.refreshMethods(refreshCtx, mc)
+		cancel()
+		if err != nil {
+			return nil
+		}
+	}
+	if !mc.has(serviceMethod) {
+		return fmt.Errorf("%w: %s", ErrUnknownMethod, serviceMethod)
+	}
+	return nil
+}
+
+// 服务端返回方法不存在时 缓存可能已过时
+func (client *Client) invalidateMethodCache() {
+	if mc := client.methodCache(); mc != nil {
+		mc.invalidate()
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"testing"
+	"time"
+)
+
+func TestClient_MethodCache(t *testing.T) {
+	var c Calc
+	s := server.NewServer()
+	_ = s.Register(&c)
+	addr := serveTest(t, s)
+
+	client, _ := Dial("tcp", addr)
+	defer func() { _ = client.Close() }()
+	ctx := context.Background()
+
+	err := client.EnableMethodCache(ctx, time.Hour)
+	_assert(err == nil, "enable method cache error: %v", err)
+
+	var reply int
+	err = client.Call(ctx, "Calc.Ad", AddArgs{}, &reply)
+	_assert(errors.Is(err, ErrUnknownMethod), "expect ErrUnknownMethod, got %v", err)
+
+	call := client.Go("Calc.Ad", AddArgs{}, &reply, nil)
+	<-call.Done
+	_assert(errors.Is(call.Error, ErrUnknownMethod), "expect ErrUnknownMethod from Go, got %v", call.Error)
+
+	err = client.Call(ctx, "Calc.Add", AddArgs{Num1: 1, Num2: 1}, &reply)
+	_assert(err == nil && reply == 2, "expect known method to succeed, got %v", err)
+
+	t.Run("invalidate on server not found", func(t *testing.T) {
+		var w Weather
+		_ = s.Register(&w)
+
+		var r Reading
+		err := client.Call(ctx, "Weather.Current", "Paris", &r)
+		_assert(errors.Is(err, ErrUnknownMethod), "expect stale cache to reject, got %v", err)
+
+		// 跳过检查时由服务端判断 服务端返回方法不存在后缓存失效 下一次调用重新拉取
+		err = client.Call(WithoutMethodCheck(ctx), "Calc.Ad", AddArgs{}, &reply)
+		_assert(rpcerr.CodeOf(err) == rpcerr.NotFound, "expect server NotFound, got %v", err)
+		err = client.Call(ctx, "Weather.Current", "Paris", &r)
+		_assert(err == nil && r.City == "Paris", "expect refreshed cache to accept, got %v", err)
+	})
+
+	t.Run("ttl refresh", func(t *testing.T) {
+		client, _ := Dial("tcp", addr)
+		defer func() { _ = client.Close() }()
+		_ = client.EnableMethodCache(ctx, 100*time.Millisecond)
+
+		var r Recorder
+		_ = s.Register(&r)
+		err := client.Call(ctx, "Recorder.Record", RecordArgs{}, &reply)
+		_assert(errors.Is(err, ErrUnknownMethod), "expect cached miss, got %v", err)
+
+		time.Sleep(150 * time.Millisecond)
+		err = client.Call(ctx, "Recorder.Record", RecordArgs{}, &reply)
+		_assert(err == nil, "expect refreshed cache after ttl, got %v", err)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client.DisableMethodCache()
+		err := client.Call(ctx, "Calc.Ad", AddArgs{}, &reply)
+		_assert(rpcerr.CodeOf(err) == rpcerr.NotFound, "expect server NotFound, got %v", err)
+	})
+}
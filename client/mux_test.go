@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"gmrpc/mux"
+	"gmrpc/server"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type Sleeper int
+
+func (s Sleeper) Sleep(d time.Duration, reply *time.Duration) error {
+	time.Sleep(d)
+	*reply = d
+	return nil
+}
+
+// 一个物理连接上的 10 个逻辑流 各自的调用并发完成
+func TestClient_Mux(t *testing.T) {
+	var s Sleeper
+	addr := startTestServer(t, &s)
+
+	conn, err := net.Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	m, err := mux.Client(conn)
+	_assert(err == nil, "mux error: %v", err)
+	defer func() { _ = m.Close() }()
+
+	const n = 10
+	const d = 200 * time.Millisecond
+	clients := make([]*Client, n)
+	for i := range clients {
+		stream, err := m.OpenStream()
+		_assert(err == nil, "open stream error: %v", err)
+		clients[i], err = NewClient(stream.(net.Conn), server.DefaultOption)
+		_assert(err == nil, "new client error: %v", err)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c *Client) {
+			defer wg.Done()
+			var reply time.Duration
+			// 每个流的耗时不同 响应不会串到其他流上
+			arg := d + time.Duration(i)*time.Millisecond
+			if errs[i] = c.Call(context.Background(), "Sleeper.Sleep", arg, &reply); errs[i] == nil && reply != arg {
+				errs[i] = context.DeadlineExceeded
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	for i, err := range errs {
+		_assert(err == nil, "stream %d: call error: %v", i, err)
+	}
+	_assert(elapsed < n*d/2, "calls did not run concurrently: %v", elapsed)
+
+	// 关闭一个流不影响其他流
+	_ = clients[0].Close()
+	var reply time.Duration
+	err = clients[1].Call(context.Background(), "Sleeper.Sleep", time.Millisecond, &reply)
+	_assert(err == nil, "call after closing sibling stream: %v", err)
+	for _, c := range clients[1:] {
+		_ = c.Close()
+	}
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 复制 Client Server 与 XClient 的值会被 go vet 的 copylocks 检查报告
+func TestClient_VetCopy(t *testing.T) {
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	out, err := exec.Command(gobin, "vet", "./testdata/copyclient").CombinedOutput()
+	_assert(err != nil, "expect go vet to fail, output: %s", out)
+	for _, want := range []string{
+		"assignment copies lock value to shadow: gmrpc/client.Client contains gmrpc/client.noCopy",
+		"return copies lock value: gmrpc/server.Server contains gmrpc/server.noCopy",
+		"assignment copies lock value to shadow: gmrpc/xclient.XClient contains gmrpc/xclient.noCopy",
+	} {
+		_assert(strings.Contains(string(out), want), "missing %q in vet output: %s", want, out)
+	}
+}
+
+func TestClient_CloneSharing(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	clone := client.CloneSharing()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			handle := client
+			if i%2 == 1 {
+				handle = clone
+			}
+			var reply int
+			if err := handle.Call(context.Background(), "Calc.Add", AddArgs{Num1: i, Num2: i}, &reply); err != nil || reply != 2*i {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("unexpected call result: %v", err)
+	}
+	_assert(client.Stats().Pending == 0 && clone.Stats().Seq == client.Stats().Seq, "handles do not share state")
+
+	// 任一句柄关闭后 另一个句柄也不可用
+	_ = clone.Close()
+	_assert(!client.IsAvailable(), "closing the clone should close the shared connection")
+	_assert(client.Close() == ErrShutdown, "second close should report ErrShutdown")
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/server"
+)
+
+/*
+请求流水线 先排队多个调用 Flush 时一次写入并等待全部响应 N 个顺序调用只需要一次往返
+请求带有 server.PipelineMetadataKey 服务端按读取的顺序逐个处理并响应 (需要协商 metadata 功能 否则并发处理)
+与 Call 一样携带 ctx 中的元数据 截止时间与 baggage 与 Client.Go 一样不经过拦截器
+不是并发安全的 每个协程使用自己的 Pipeline
+	p := client.Pipeline()
+	a, b := p.Go("Calc.Add", args1, &r1), p.Go("Calc.Add", args2, &r2)
+	err := p.Flush(ctx) // a.Error 与 b.Error 是各自的结果
+*/
+
+type Pipeline struct {
+	client  *Client
+	pending []*Call
+}
+
+func (client *Client) Pipeline() *Pipeline {
+	return &Pipeline{client: client}
+}
+
+// 排队一个调用 不发送 结果在 Flush 返回后有效
+func (p *Pipeline) Go(serviceMethod string, args, reply interface{}) *Call {
+	call := newCall(serviceMethod, args, reply, make(chan *Call, 1))
+	call.overflow = p.client.abandon
+	p.pending = append(p.pending, call)
+	return call
+}
+
+// 排队的调用数
+func (p *Pipeline) Len() int {
+	return len(p.pending)
+}
+
+// 一次写入所有排队的调用并等待全部响应 返回按排队顺序的第一个错误
+// ctx 结束时没有完成的调用返回 ctx 的错误 并通知服务端取消 之后 Pipeline 可以继续使用
+func (p *Pipeline) Flush(ctx context.Context) error {
+	calls := p.pending
+	p.pending = nil
+	if len(calls) == 0 {
+		return nil
+	}
+	client := p.client
+	md := requestMetadata(ctx)
+	if client.protocol.Features.Has(server.FeatureMetadata) {
+		md = md.Copy()
+		md.Set(server.PipelineMetadataKey, "1")
+	}
+	raw := rawResponseFromContext(ctx)
+	var send []*Call
+	for _, call := range calls {
+		if err := client.checkPipelined(ctx, call); err != nil {
+			call.Error = err
+			call.done()
+			continue
+		}
+		client.copyArgs(call)
+		call.Metadata, call.raw = md, raw
+		send = append(send, call)
+	}
+	if len(send) > 0 {
+		client.lockSending(hintDefault)
+		for _, call := range send {
+			client.sendLocked(call, false)
+		}
+		var err error
+		if bw, ok := client.cc.(codec.BufferedWriter); ok {
+			err = bw.Flush()
+		}
+		client.sending.Unlock()
+		if err != nil {
+			err = client.closedError(err)
+			for _, call := range send {
+				if client.removeCall(call.Seq) != nil {
+					call.Error = err
+					call.done()
+				}
+			}
+		}
+	}
+
+	var first error
+	for _, call := range calls {
+		select {
+		case <-call.Done:
+		case <-ctx.Done():
+			if client.removeCall(call.Seq) != nil {
+				call.Error = contextError(ctx)
+				call.done()
+				client.cancelRemote(call.Seq)
+			}
+			<-call.Done
+		}
+		if call.Error != nil && first == nil {
+			first = call.Error
+		}
+	}
+	return first
+}
+
+func (client *Client) checkPipelined(ctx context.Context, call *Call) error {
+	if err := validateServiceMethod(call.ServiceMethod); err != nil {
+		return err
+	}
+	if err := client.checkMethod(ctx, call.ServiceMethod); err != nil {
+		return err
+	}
+	return client.checkSchema(ctx, call.ServiceMethod, call.Args, call.Reply)
+}
@@ -0,0 +1,222 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/metadata"
+	"gmrpc/server"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 在 addr 前增加单向 rtt/2 延迟的代理 模拟高延迟网络
+func latencyProxy(t testing.TB, addr string, rtt time.Duration) string {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	var mu sync.Mutex
+	var conns []net.Conn
+	track := func(c net.Conn) {
+		mu.Lock()
+		conns = append(conns, c)
+		mu.Unlock()
+	}
+	go func() {
+		for {
+			down, err := l.Accept()
+			if err != nil {
+				return
+			}
+			up, err := net.Dial("tcp", addr)
+			if err != nil {
+				_ = down.Close()
+				continue
+			}
+			track(down)
+			track(up)
+			go delayCopy(up, down, rtt/2)
+			go delayCopy(down, up, rtt/2)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = l.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			_ = c.Close()
+		}
+	})
+	return l.Addr().String()
+}
+
+// 读到的数据延迟 d 后按顺序写出
+func delayCopy(dst, src net.Conn, d time.Duration) {
+	type chunk struct {
+		data []byte
+		at   time.Time
+	}
+	ch := make(chan chunk, 1024)
+	go func() {
+		defer close(ch)
+		for {
+			buf := make([]byte, 32<<10)
+			n, err := src.Read(buf)
+			if n > 0 {
+				ch <- chunk{data: buf[:n], at: time.Now().Add(d)}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	for c := range ch {
+		time.Sleep(time.Until(c.at))
+		if _, err := dst.Write(c.data); err != nil {
+			break
+		}
+	}
+	_ = dst.Close()
+	for range ch {
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	client, err := Dial("tcp", startTestServer(t, new(Calc)))
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	p := client.Pipeline()
+	replies := make([]int, 5)
+	calls := make([]*Call, 5)
+	for i := range calls {
+		calls[i] = p.Go("Calc.Add", AddArgs{Num1: i, Num2: 1}, &replies[i])
+	}
+	bad := p.Go("Calc.Missing", AddArgs{}, new(int))
+	_assert(p.Len() == 6, "expect 6 queued calls, got %d", p.Len())
+	err = p.Flush(context.Background())
+	_assert(err != nil && err == bad.Error, "expect the failed call's error, got %v", err)
+	for i, call := range calls {
+		_assert(call.Error == nil && replies[i] == i+1, "call %d: %d %v", i, replies[i], call.Error)
+	}
+	_assert(p.Len() == 0 && p.Flush(context.Background()) == nil, "flush should empty the queue")
+
+	// 之后可以继续使用
+	var reply int
+	p.Go("Calc.Add", AddArgs{Num1: 2, Num2: 2}, &reply)
+	_assert(p.Flush(context.Background()) == nil && reply == 4, "reuse failed: %d", reply)
+}
+
+func TestPipeline_Context(t *testing.T) {
+	client, err := Dial("tcp", startTestServer(t, new(Sleeper)))
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	p := client.Pipeline()
+	var fast, slow time.Duration
+	p.Go("Sleeper.Sleep", time.Millisecond, &fast)
+	slowCall := p.Go("Sleeper.Sleep", 300*time.Millisecond, &slow)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = p.Flush(ctx)
+	_assert(errors.Is(err, context.DeadlineExceeded) && slowCall.Error == err, "expect deadline exceeded, got %v", err)
+	_assert(fast == time.Millisecond && time.Since(start) < 250*time.Millisecond, "flush should return at the deadline")
+	_assert(client.IsAvailable(), "client should remain usable")
+}
+
+// 高延迟网络上 N 个顺序调用只需要一次往返
+func TestPipeline_AmortizesRTT(t *testing.T) {
+	const rtt, n = 20 * time.Millisecond, 10
+	client, err := Dial("tcp", latencyProxy(t, startTestServer(t, new(Calc)), rtt))
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		var reply int
+		_assert(client.Call(context.Background(), "Calc.Add", AddArgs{Num1: i}, &reply) == nil, "call failed")
+	}
+	sequential := time.Since(start)
+
+	start = time.Now()
+	p := client.Pipeline()
+	for i := 0; i < n; i++ {
+		p.Go("Calc.Add", AddArgs{Num1: i}, new(int))
+	}
+	_assert(p.Flush(context.Background()) == nil, "flush failed")
+	pipelined := time.Since(start)
+	_assert(sequential >= n*rtt && pipelined < 3*rtt, "expect %d round-trips to become one: sequential %s pipelined %s", n, sequential, pipelined)
+}
+
+// 10ms 往返延迟下每次 10 个调用
+func BenchmarkPipeline(b *testing.B) {
+	const n = 10
+	client, _ := Dial("tcp", latencyProxy(b, startTestServer(b, new(Calc)), 10*time.Millisecond))
+	defer func() { _ = client.Close() }()
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < n; j++ {
+				var reply int
+				_ = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: j}, &reply)
+			}
+		}
+	})
+	b.Run("pipeline", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p := client.Pipeline()
+			for j := 0; j < n; j++ {
+				p.Go("Calc.Add", AddArgs{Num1: j}, new(int))
+			}
+			_ = p.Flush(context.Background())
+		}
+	})
+}
+
+// 流水线请求按顺序逐个处理 (包括并行解码时) 处理函数能看到 ctx 的截止时间与元数据
+func TestPipeline_Ordered(t *testing.T) {
+	for _, workers := range []int{0, 4} {
+		t.Run(fmt.Sprintf("decode workers %d", workers), func(t *testing.T) { testPipelineOrdered(t, workers) })
+	}
+}
+
+func testPipelineOrdered(t *testing.T, decodeWorkers int) {
+	s := server.NewServer()
+	s.SetDecodeWorkers(decodeWorkers)
+	_ = s.Register(new(Sleeper))
+	var mu sync.Mutex
+	var events []string
+	s.Use(func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		_, hasDeadline := ctx.Deadline()
+		md, _ := metadata.FromIncomingContext(ctx)
+		d := argv.(time.Duration)
+		mu.Lock()
+		events = append(events, fmt.Sprintf("start %v %v %s", d, hasDeadline, md.Get("user")))
+		mu.Unlock()
+		err := handler(ctx, argv, replyv)
+		mu.Lock()
+		events = append(events, fmt.Sprintf("end %v", d))
+		mu.Unlock()
+		return err
+	})
+	client, err := Dial("tcp", serveTest(t, s))
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithTimeout(metadata.AppendToOutgoingContext(context.Background(), "user", "alice"), time.Second)
+	defer cancel()
+	p := client.Pipeline()
+	for _, d := range []time.Duration{30 * time.Millisecond, time.Millisecond, 2 * time.Millisecond} {
+		p.Go("Sleeper.Sleep", d, new(time.Duration))
+	}
+	_assert(p.Flush(ctx) == nil, "flush failed")
+	want := []string{
+		"start 30ms true alice", "end 30ms",
+		"start 1ms true alice", "end 1ms",
+		"start 2ms true alice", "end 2ms",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	_assert(reflect.DeepEqual(events, want), "expect in-order processing with ctx, got %q", events)
+}
@@ -0,0 +1,369 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/resolver"
+	"gmrpc/server"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+连接池 对同一地址维护固定数量的连接 轮询使用
+连接在第一次使用时建立 或通过 Warm / PreWarm 提前建立 断开的连接在下次使用时重新建立
+通过 NewPoolTarget 创建时每次建立连接都重新解析目标 第 i 个位置使用第 i%n 个地址
+*/
+
+// 建立连接的函数 默认为 Dial 测试时可替换
+type DialFunc func(network, address string, opts ...*server.Option) (*Client, error)
+
+type Pool struct {
+	noCopy noCopy
+
+	network string
+	address string
+	target  string // 不为空时通过 resolver 解析地址
+	opt     *server.Option
+
+	mu       sync.Mutex
+	dial     DialFunc
+	warmPing bool
+	clients  []*Client // 未建立的位置为空
+	next     int
+	closed   bool
+
+	budget   ErrorBudget
+	health   []memberHealth // 与 clients 一一对应
+	nextDial time.Time      // 下一次替换拨号的最早时间
+	done     chan struct{}  // 关闭时通知后台替换
+	bg       sync.WaitGroup
+
+	minConns    int           // PreWarm 建立的连接数
+	prewarmStop chan struct{} // 结束定时预热 未启用时为空
+}
+
+var _ io.Closer = (*Pool)(nil)
+
+func NewPool(network, address string, size int, opts ...*server.Option) (*Pool, error) {
+	if size <= 0 {
+		return nil, errors.New("rpc pool: size must be positive")
+	}
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Pool{
+		network:  network,
+		address:  address,
+		opt:      opt,
+		dial:     Dial,
+		clients:  make([]*Client, size),
+		health:   make([]memberHealth, size),
+		done:     make(chan struct{}),
+		minConns: size,
+	}, nil
+}
+
+// 目标格式见 resolver 包 例如 static:///a,b 或 dns:///host:port
+func NewPoolTarget(target string, size int, opts ...*server.Option) (*Pool, error) {
+	if _, _, err := resolver.Lookup(target); err != nil {
+		return nil, err
+	}
+	p, err := NewPool("", target, size, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.target = target
+	return p, nil
+}
+
+func (p *Pool) SetDialer(dial DialFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dial = dial
+}
+
+// Warm 建立连接后是否调用 Ping 检查服务端
+func (p *Pool) SetWarmPing(on bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.warmPing = on
+}
+
+func (p *Pool) Size() int {
+	return len(p.clients)
+}
+
+// 已建立且可用的连接数
+func (p *Pool) Connected() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, c := range p.clients {
+		if c != nil && c.IsAvailable() {
+			n++
+		}
+	}
+	return n
+}
+
+// 轮询取出一个连接 未建立或已断开时重新建立
+// 跳过正在替换的位置 以及服务端关闭时建议的重连等待时间还没有到的位置
+func (p *Pool) Get() (*Client, error) {
+	_, c, err := p.get()
+	return c, err
+}
+
+func (p *Pool) get() (int, *Client, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return 0, nil, ErrShutdown
+	}
+	i := p.next
+	now := time.Now()
+	for k := 0; k < len(p.clients); k++ {
+		j := (p.next + k) % len(p.clients)
+		if !p.health[j].draining && p.retryWait(j, now) == nil {
+			i = j
+			break
+		}
+	}
+	p.next = (i + 1) % len(p.clients)
+	c := p.clients[i]
+	closed := p.retryWait(i, now)
+	p.mu.Unlock()
+	if c != nil && c.IsAvailable() {
+		return i, c, nil
+	}
+	if closed != nil {
+		return i, nil, closed
+	}
+	c, err := p.dialSlot(i)
+	if err != nil {
+		return i, nil, err
+	}
+	c, err = p.install(i, c)
+	return i, c, err
+}
+
+// 传输错误计入该连接的错误预算 见 SetErrorBudget
+func (p *Pool) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	i, c, err := p.get()
+	if err != nil {
+		return err
+	}
+	err = c.Call(ctx, serviceMethod, args, reply)
+	p.report(i, c, err)
+	return err
+}
+
+// 第 i 个位置的连接被服务端关闭且还不能重连时返回关闭通知 调用方持有 mu
+func (p *Pool) retryWait(i int, now time.Time) *ServerClosedError {
+	c := p.clients[i]
+	if c == nil {
+		return nil
+	}
+	if sc := c.ServerClosed(); sc != nil && now.Before(sc.RetryAt()) {
+		return sc
+	}
+	return nil
+}
+
+func (p *Pool) dialSlot(i int) (*Client, error) {
+	p.mu.Lock()
+	dial := p.dial
+	p.mu.Unlock()
+	opt := *p.opt
+	if p.target == "" {
+		return dial(p.network, p.address, &opt)
+	}
+	addrs, err := resolver.Resolve(p.target)
+	if err != nil {
+		return nil, err
+	}
+	a := addrs[i%len(addrs)]
+	return dial(a.Network, a.Addr, &opt)
+}
+
+// 放入第 i 个位置 并发建立了多个连接时保留已有的可用连接
+func (p *Pool) install(i int, c *Client) (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		_ = c.Close()
+		return nil, ErrShutdown
+	}
+	if old := p.clients[i]; old != nil {
+		if old.IsAvailable() {
+			_ = c.Close()
+			return old, nil
+		}
+		_ = old.Close()
+	}
+	p.clients[i] = c
+	p.watch(i, c)
+	return c, nil
+}
+
+// 连接断开时立即移出第 i 个位置 不必等到下次使用 调用方持有 mu
+// 收到服务端关闭通知的连接留在原位 按建议的等待时间重连 见 retryWait
+func (p *Pool) watch(i int, c *Client) {
+	p.bg.Add(1)
+	go func() {
+		defer p.bg.Done()
+		select {
+		case <-c.Done():
+		case <-p.done:
+			return
+		}
+		if c.ServerClosed() != nil {
+			return
+		}
+		p.remove(i, c)
+	}()
+}
+
+// 提前建立最多 n 个连接 已建立的不重复建立 每个连接受 ConnectTimeout 限制
+// 部分失败时返回 *WarmError 失败的位置在之后使用时重新建立
+func (p *Pool) Warm(ctx context.Context, n int) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrShutdown
+	}
+	if n > len(p.clients) {
+		n = len(p.clients)
+	}
+	var slots []int
+	for i := 0; i < n; i++ {
+		if c := p.clients[i]; c == nil || !c.IsAvailable() {
+			slots = append(slots, i)
+		}
+	}
+	ping := p.warmPing
+	p.mu.Unlock()
+
+	targets := make([]string, len(slots))
+	for k, i := range slots {
+		targets[k] = fmt.Sprintf("%s#%d", p.address, i)
+	}
+	return WarmTargets(ctx, targets, func(ctx context.Context, k int) error {
+		c, err := dialContext(ctx, func() (*Client, error) { return p.dialSlot(slots[k]) })
+		if err != nil {
+			return err
+		}
+		if ping {
+			if err := c.Ping(ctx); err != nil {
+				_ = c.Close()
+				return err
+			}
+		}
+		_, err = p.install(slots[k], c)
+		return err
+	})
+}
+
+// 关闭所有连接 并等待后台替换结束
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrShutdown
+	}
+	p.closed = true
+	close(p.done)
+	for i, c := range p.clients {
+		if c != nil {
+			_ = c.Close()
+			p.clients[i] = nil
+		}
+	}
+	p.mu.Unlock()
+	p.bg.Wait()
+	return nil
+}
+
+// 预热时的最大并发数
+const WarmParallelism = 8
+
+type WarmFailure struct {
+	Target string
+	Err    error
+}
+
+// 预热部分失败
+type WarmError struct {
+	Failures []WarmFailure
+}
+
+func (e *WarmError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = f.Target + ": " + f.Err.Error()
+	}
+	return fmt.Sprintf("rpc warm: %d failed: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// 以有限的并发对每个目标执行 warm 汇总失败的目标 全部成功时返回 nil
+func WarmTargets(ctx context.Context, targets []string, warm func(ctx context.Context, i int) error) error {
+	errs := make([]error, len(targets))
+	sem := make(chan struct{}, WarmParallelism)
+	var wg sync.WaitGroup
+	for i := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = warm(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+
+	var e WarmError
+	for i, err := range errs {
+		if err != nil {
+			e.Failures = append(e.Failures, WarmFailure{Target: targets[i], Err: err})
+		}
+	}
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	return &e
+}
+
+// 建立连接 ctx 结束时不再等待 稍后建立的连接会被关闭
+func dialContext(ctx context.Context, dial func() (*Client, error)) (*Client, error) {
+	ch := make(chan clientResult, 1)
+	go func() {
+		c, err := dial()
+		ch <- clientResult{client: c, err: err}
+	}()
+	select {
+	case res := <-ch:
+		return res.client, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-ch; res.client != nil {
+				_ = res.client.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// 调用内置的反射服务检查服务端是否正常处理请求
+func (client *Client) Ping(ctx context.Context) error {
+	var reply server.ListServicesReply
+	return client.Call(WithoutMethodCheck(ctx), server.ReflectionService+".ListServices", server.ListServicesArgs{}, &reply)
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gmrpc/server"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 统计调用次数 前 fail 次返回错误
+func countingDialer(dials *int32, fail int32) DialFunc {
+	return func(network, address string, opts ...*server.Option) (*Client, error) {
+		if n := atomic.AddInt32(dials, 1); n <= fail {
+			return nil, errors.New("dial refused")
+		}
+		return Dial(network, address, opts...)
+	}
+}
+
+func TestPool_Warm(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+	p, err := NewPool("tcp", addr, 4)
+	_assert(err == nil, "new pool error: %v", err)
+	defer func() { _ = p.Close() }()
+	var dials int32
+	p.SetDialer(countingDialer(&dials, 0))
+	p.SetWarmPing(true)
+
+	_assert(p.Warm(context.Background(), 10) == nil, "warm failed")
+	_assert(atomic.LoadInt32(&dials) == 4 && p.Connected() == 4, "expect 4 connections, dials %d connected %d", dials, p.Connected())
+
+	// 预热后的调用不再建立连接
+	for i := 0; i < 8; i++ {
+		var reply int
+		err := p.Call(context.Background(), "Calc.Add", AddArgs{Num1: i, Num2: 1}, &reply)
+		_assert(err == nil && reply == i+1, "unexpected result %d (%v)", reply, err)
+	}
+	_assert(atomic.LoadInt32(&dials) == 4, "calls after warm should not dial, got %d dials", dials)
+
+	// 已建立的连接不重复建立
+	_assert(p.Warm(context.Background(), 4) == nil && atomic.LoadInt32(&dials) == 4, "warm should skip connected slots")
+}
+
+func TestPool_WarmPartialFailure(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+	p, _ := NewPool("tcp", addr, 4)
+	defer func() { _ = p.Close() }()
+	var dials int32
+	p.SetDialer(countingDialer(&dials, 2))
+
+	err := p.Warm(context.Background(), 4)
+	var warmErr *WarmError
+	_assert(errors.As(err, &warmErr) && len(warmErr.Failures) == 2, "expect 2 failures, got %v", err)
+	for _, f := range warmErr.Failures {
+		_assert(f.Err.Error() == "dial refused", "unexpected failure %s: %v", f.Target, f.Err)
+	}
+	_assert(p.Connected() == 2, "expect 2 connections, got %d", p.Connected())
+
+	// 失败的位置在使用时重新建立
+	for i := 0; i < 4; i++ {
+		var reply int
+		err := p.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 1}, &reply)
+		_assert(err == nil && reply == 2, "unexpected result %d (%v)", reply, err)
+	}
+	_assert(p.Connected() == 4, "expect failed slots to be redialed, got %d", p.Connected())
+}
+
+func TestPool_WarmContext(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+	p, _ := NewPool("tcp", addr, 2)
+	defer func() { _ = p.Close() }()
+	p.SetDialer(func(network, address string, opts ...*server.Option) (*Client, error) {
+		time.Sleep(100 * time.Millisecond)
+		return Dial(network, address, opts...)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := p.Warm(ctx, 2)
+	var warmErr *WarmError
+	_assert(errors.As(err, &warmErr) && len(warmErr.Failures) == 2, "expect 2 failures, got %v", err)
+	_assert(errors.Is(warmErr.Failures[0].Err, context.DeadlineExceeded), "unexpected failure %v", warmErr.Failures[0].Err)
+	_assert(p.Connected() == 0, "no connection should be installed after the deadline")
+	// 等待后台关闭迟到的连接
+	time.Sleep(150 * time.Millisecond)
+}
+
+func TestPool_Target(t *testing.T) {
+	var c Calc
+	addrs := []string{startTestServer(t, &c), startTestServer(t, &c)}
+	p, err := NewPoolTarget("static:///"+strings.Join(addrs, ","), 4)
+	_assert(err == nil, "new pool error: %v", err)
+	defer func() { _ = p.Close() }()
+
+	var dialed []string
+	var mu sync.Mutex
+	p.SetDialer(func(network, address string, opts ...*server.Option) (*Client, error) {
+		mu.Lock()
+		dialed = append(dialed, network+"@"+address)
+		mu.Unlock()
+		return Dial(network, address, opts...)
+	})
+	for i := 0; i < 4; i++ {
+		var reply int
+		err := p.Call(context.Background(), "Calc.Add", AddArgs{Num1: i, Num2: 1}, &reply)
+		_assert(err == nil && reply == i+1, "unexpected result %d (%v)", reply, err)
+	}
+	sort.Strings(dialed)
+	want := []string{"tcp@" + addrs[0], "tcp@" + addrs[0], "tcp@" + addrs[1], "tcp@" + addrs[1]}
+	sort.Strings(want)
+	_assert(reflect.DeepEqual(dialed, want), "slots should spread over resolved addresses: %v", dialed)
+
+	_, err = NewPoolTarget("etcd:///svc", 1)
+	_assert(err != nil, "unknown scheme should fail")
+}
+
+func TestDialTarget(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	refused := l.Addr().String()
+	_ = l.Close()
+
+	// 跳过无法连接的地址
+	client, err := DialTarget("static:///" + refused + "," + addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	var reply int
+	err = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 1}, &reply)
+	_assert(err == nil && reply == 2, "unexpected result %d (%v)", reply, err)
+
+	_, err = DialTarget("static:///" + refused)
+	_assert(err != nil, "dial to refused address should fail")
+}
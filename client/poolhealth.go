@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+/*
+连接的错误预算 NAT 超时等原因留下的半开连接不会报错 只会让调用超时
+某个连接在 Window 内累计 Errors 次传输错误后 在后台建立新连接替换它 替换完成前调用绕开该连接
+旧连接等待进行中的调用结束后关闭 所有替换共享 MinDialInterval 的拨号间隔 避免同时重建大量连接
+*/
+
+type ErrorBudget struct {
+	Errors          int           // 触发替换的错误次数 0 表示关闭
+	Window          time.Duration // 统计错误的时间窗口
+	MinDialInterval time.Duration // 两次替换拨号之间的最小间隔 默认 100ms
+}
+
+const (
+	defaultReplaceInterval = 100 * time.Millisecond
+	poolDrainTimeout       = 5 * time.Second // 旧连接等待进行中调用的上限
+)
+
+// 判断错误是否来自连接本身 包括连接断开 读写错误 以及截止时间到达仍未收到响应
+func IsTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	var timeout *TimeoutError
+	switch {
+	case errors.Is(err, ErrShutdown), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.As(err, &timeout):
+		return errors.Is(timeout.Err, context.DeadlineExceeded)
+	case errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
+
+// 连接池中一个位置的健康状态
+type PoolMemberStats struct {
+	Connected    bool
+	Draining     bool      // 正在后台替换 调用绕开该位置
+	RecentErrors int       // 窗口内的传输错误次数
+	Replacements int       // 因错误预算被替换的次数
+	LastError    string    // 最近一次传输错误
+	LastReplaced time.Time // 最近一次替换完成的时间
+}
+
+type PoolStats struct {
+	Members      []PoolMemberStats
+	Replacements int
+}
+
+type memberHealth struct {
+	errors       []time.Time
+	draining     bool
+	replacements int
+	lastErr      error
+	lastReplaced time.Time
+}
+
+// 设置错误预算 只影响之后的错误
+func (p *Pool) SetErrorBudget(b ErrorBudget) {
+	if b.MinDialInterval <= 0 {
+		b.MinDialInterval = defaultReplaceInterval
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.budget = b
+}
+
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := PoolStats{Members: make([]PoolMemberStats, len(p.clients))}
+	now := time.Now()
+	for i, c := range p.clients {
+		h := &p.health[i]
+		h.trim(now, p.budget.Window)
+		m := PoolMemberStats{
+			Connected:    c != nil && c.IsAvailable(),
+			Draining:     h.draining,
+			RecentErrors: len(h.errors),
+			Replacements: h.replacements,
+			LastReplaced: h.lastReplaced,
+		}
+		if h.lastErr != nil {
+			m.LastError = h.lastErr.Error()
+		}
+		stats.Members[i] = m
+		stats.Replacements += h.replacements
+	}
+	return stats
+}
+
+func (h *memberHealth) trim(now time.Time, window time.Duration) {
+	k := 0
+	for k < len(h.errors) && now.Sub(h.errors[k]) > window {
+		k++
+	}
+	h.errors = h.errors[k:]
+}
+
+// 记录第 i 个位置上 c 的调用结果 超出预算时开始替换
+func (p *Pool) report(i int, c *Client, err error) {
+	if !IsTransportError(err) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.clients[i] != c {
+		// 连接已经被替换
+		return
+	}
+	h := &p.health[i]
+	now := time.Now()
+	h.lastErr = err
+	h.errors = append(h.errors, now)
+	h.trim(now, p.budget.Window)
+	if p.budget.Errors <= 0 || h.draining || len(h.errors) < p.budget.Errors {
+		return
+	}
+	h.draining = true
+	p.bg.Add(1)
+	go p.replace(i, c)
+}
+
+// 等待拨号间隔 返回 false 表示连接池已关闭
+func (p *Pool) waitDialTurn() bool {
+	p.mu.Lock()
+	now := time.Now()
+	at := p.nextDial
+	if at.Before(now) {
+		at = now
+	}
+	p.nextDial = at.Add(p.budget.MinDialInterval)
+	p.mu.Unlock()
+
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+func (p *Pool) replace(i int, old *Client) {
+	defer p.bg.Done()
+	for {
+		if !p.waitDialTurn() {
+			return
+		}
+		c, err := p.dialSlot(i)
+		if err != nil {
+			// 拨号失败时继续绕开该位置 按间隔重试
+			p.mu.Lock()
+			p.health[i].lastErr = err
+			p.mu.Unlock()
+			continue
+		}
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			_ = c.Close()
+			return
+		}
+		h := &p.health[i]
+		if cur := p.clients[i]; cur != old && cur != nil && cur.IsAvailable() {
+			// 调用方已经重新建立了连接
+			_ = c.Close()
+		} else {
+			p.clients[i] = c
+			p.watch(i, c)
+		}
+		h.draining = false
+		h.errors = nil
+		h.replacements++
+		h.lastReplaced = time.Now()
+		p.mu.Unlock()
+		p.drain(old)
+		return
+	}
+}
+
+// 等待旧连接上进行中的调用结束后关闭 连接池关闭时立即关闭
+func (p *Pool) drain(old *Client) {
+	timeout := time.NewTimer(poolDrainTimeout)
+	defer timeout.Stop()
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	for old.Stats().Pending > 0 {
+		select {
+		case <-tick.C:
+		case <-timeout.C:
+			_ = old.Close()
+			return
+		case <-p.done:
+			_ = old.Close()
+			return
+		}
+	}
+	_ = old.Close()
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gmrpc/server"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 模拟半开连接 开启后写入被静默丢弃
+type blackholeConn struct {
+	net.Conn
+	on *int32
+}
+
+func (c *blackholeConn) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(c.on) == 1 {
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+func TestPool_ErrorBudgetReplacesMember(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+	p, _ := NewPool("tcp", addr, 4)
+	var dials, blackhole int32
+	p.SetDialer(func(network, address string, opts ...*server.Option) (*Client, error) {
+		conn, err := net.Dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		if atomic.AddInt32(&dials, 1) == 1 {
+			// 只有第一个连接会变坏
+			conn = &blackholeConn{Conn: conn, on: &blackhole}
+		}
+		return NewClient(conn, opts[0])
+	})
+	p.SetErrorBudget(ErrorBudget{Errors: 3, Window: time.Second, MinDialInterval: 10 * time.Millisecond})
+	_assert(p.Warm(context.Background(), 4) == nil, "warm failed")
+	atomic.StoreInt32(&blackhole, 1)
+
+	const calls = 200
+	failed := 0
+	for i := 0; i < calls; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		var reply int
+		if err := p.Call(ctx, "Calc.Add", AddArgs{Num1: i, Num2: 1}, &reply); err != nil {
+			_assert(IsTransportError(err), "unexpected error %v", err)
+			failed++
+		}
+		cancel()
+	}
+	_assert(failed <= 4, "expect at most the budget to fail, got %d/%d", failed, calls)
+
+	stats := p.Stats()
+	_assert(stats.Replacements == 1 && atomic.LoadInt32(&dials) == 5, "expect one replacement, got %+v dials %d", stats, dials)
+	for i, m := range stats.Members {
+		_assert(m.Connected && !m.Draining, "member %d unhealthy: %+v", i, m)
+		if m.Replacements == 1 {
+			_assert(m.LastError != "" && m.RecentErrors == 0, "replaced member should reset errors: %+v", m)
+		}
+	}
+	_assert(p.Close() == nil, "close failed")
+}
+
+// 替换时的拨号按间隔进行 拨号失败期间继续绕开该位置
+func TestPool_ErrorBudgetRateLimitsDials(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+	p, _ := NewPool("tcp", addr, 2)
+	var dials int32
+	var dialTimes []time.Time
+	p.SetDialer(func(network, address string, opts ...*server.Option) (*Client, error) {
+		n := atomic.AddInt32(&dials, 1)
+		if n > 2 {
+			dialTimes = append(dialTimes, time.Now())
+			if n <= 4 {
+				return nil, errors.New("dial refused")
+			}
+		}
+		return Dial(network, address, opts...)
+	})
+	p.SetErrorBudget(ErrorBudget{Errors: 1, Window: time.Second, MinDialInterval: 30 * time.Millisecond})
+	_assert(p.Warm(context.Background(), 2) == nil, "warm failed")
+
+	c0, _ := p.Get()
+	p.report(0, c0, io.EOF)
+	stats := p.Stats()
+	_assert(stats.Members[0].Draining && stats.Members[0].RecentErrors == 1, "member 0 should drain: %+v", stats.Members[0])
+	for i := 0; i < 4; i++ {
+		got, err := p.Get()
+		_assert(err == nil && got != c0, "draining member should be skipped")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Stats().Replacements == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	_assert(p.Stats().Replacements == 1 && len(dialTimes) == 3, "expect replacement after 3 dials, got %d", len(dialTimes))
+	for i := 1; i < len(dialTimes); i++ {
+		gap := dialTimes[i].Sub(dialTimes[i-1])
+		_assert(gap >= 25*time.Millisecond, "replacement dials too close: %v", gap)
+	}
+	_assert(!IsTransportError(errors.New("server error")) && IsTransportError(ErrShutdown), "unexpected classification")
+	_ = p.Close()
+}
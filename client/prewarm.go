@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+/*
+后台预热 第一次调用不必等待建立连接
+PreWarm 在后台建立前 MinConns 个连接 不阻塞调用方 SetPrewarmInterval 定时执行 补上断开的连接
+HealthCheck 对已建立的连接调用 Ping 失败或已断开的连接关闭后重新建立
+*/
+
+// PreWarm 与定时预热建立的连接数 默认为连接池大小 超出时按连接池大小
+func (p *Pool) SetMinConns(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.minConns = n
+}
+
+// 在后台建立前 MinConns 个连接后返回 失败的位置在之后使用时重新建立 连接池关闭时返回 ErrShutdown
+// ctx 结束或连接池关闭时停止
+func (p *Pool) PreWarm(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrShutdown
+	}
+	n := p.minConns
+	p.bg.Add(1)
+	p.mu.Unlock()
+	go func() {
+		defer p.bg.Done()
+		p.prewarm(ctx, n)
+	}()
+	return nil
+}
+
+func (p *Pool) prewarm(ctx context.Context, n int) {
+	ctx, cancel := p.withDone(ctx)
+	defer cancel()
+	if err := p.Warm(ctx, n); err != nil && !errors.Is(err, ErrShutdown) && ctx.Err() == nil {
+		log.Println("rpc pool: prewarm:", err)
+	}
+}
+
+// 连接池关闭时结束的 ctx
+func (p *Pool) withDone(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-p.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// 每隔 d 在后台预热一次 d <= 0 时停止 再次设置时替换之前的间隔
+func (p *Pool) SetPrewarmInterval(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.prewarmStop != nil {
+		close(p.prewarmStop)
+		p.prewarmStop = nil
+	}
+	if d <= 0 || p.closed {
+		return
+	}
+	stop := make(chan struct{})
+	p.prewarmStop = stop
+	p.bg.Add(1)
+	go p.prewarmLoop(d, stop)
+}
+
+func (p *Pool) prewarmLoop(d time.Duration, stop chan struct{}) {
+	defer p.bg.Done()
+	tick := time.NewTicker(d)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+		case <-stop:
+			return
+		case <-p.done:
+			return
+		}
+		p.mu.Lock()
+		n := p.minConns
+		p.mu.Unlock()
+		p.prewarm(context.Background(), n)
+	}
+}
+
+// 对已建立的连接调用 Ping 失败 (包括超过 ConnectTimeout) 或已断开的连接关闭后重新建立 未建立与正在替换的位置跳过
+// 重新建立失败时返回 *WarmError ctx 结束时不关闭正在检查的连接
+func (p *Pool) HealthCheck(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrShutdown
+	}
+	var slots []int
+	var clients []*Client
+	for i, c := range p.clients {
+		if c != nil && !p.health[i].draining {
+			slots = append(slots, i)
+			clients = append(clients, c)
+		}
+	}
+	p.mu.Unlock()
+
+	targets := make([]string, len(slots))
+	for k, i := range slots {
+		targets[k] = fmt.Sprintf("%s#%d", p.address, i)
+	}
+	return WarmTargets(ctx, targets, func(ctx context.Context, k int) error {
+		i, c := slots[k], clients[k]
+		if c.IsAvailable() {
+			if err := p.probe(ctx, c); err == nil || ctx.Err() != nil {
+				return err
+			}
+		}
+		p.remove(i, c)
+		nc, err := dialContext(ctx, func() (*Client, error) { return p.dialSlot(i) })
+		if err != nil {
+			return err
+		}
+		_, err = p.install(i, nc)
+		return err
+	})
+}
+
+// 半开的连接不会返回错误 Ping 受 ConnectTimeout 限制
+func (p *Pool) probe(ctx context.Context, c *Client) error {
+	if p.opt.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.opt.ConnectTimeout)
+		defer cancel()
+	}
+	return c.Ping(ctx)
+}
+
+// 第 i 个位置仍是 c 时清空 并关闭 c
+func (p *Pool) remove(i int, c *Client) {
+	p.mu.Lock()
+	if p.clients[i] == c {
+		p.clients[i] = nil
+	}
+	p.mu.Unlock()
+	_ = c.Close()
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"gmrpc/server"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 等待条件成立 超时后断言失败
+func eventually(cond func() bool, msg string, v ...interface{}) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	_assert(cond(), msg, v...)
+}
+
+func TestPool_PreWarm(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+	p, _ := NewPool("tcp", addr, 4)
+	defer func() { _ = p.Close() }()
+	var dials int32
+	release := make(chan struct{})
+	p.SetDialer(func(network, address string, opts ...*server.Option) (*Client, error) {
+		<-release
+		atomic.AddInt32(&dials, 1)
+		return Dial(network, address, opts...)
+	})
+	p.SetMinConns(2)
+
+	// 拨号阻塞时也立即返回
+	_assert(p.PreWarm(context.Background()) == nil, "prewarm failed")
+	close(release)
+	eventually(func() bool { return p.Connected() == 2 }, "expect 2 prewarmed connections, got %d", p.Connected())
+
+	// 预热的连接先被使用
+	for i := 0; i < 2; i++ {
+		var reply int
+		err := p.Call(context.Background(), "Calc.Add", AddArgs{Num1: i, Num2: 1}, &reply)
+		_assert(err == nil && reply == i+1, "unexpected result %d (%v)", reply, err)
+	}
+	_assert(atomic.LoadInt32(&dials) == 2, "calls should use prewarmed connections, got %d dials", dials)
+
+	// 其余位置在使用时建立
+	var reply int
+	_ = p.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 1}, &reply)
+	_assert(atomic.LoadInt32(&dials) == 3, "expect a new dial, got %d", dials)
+
+	_assert(p.Close() == nil, "close failed")
+	_assert(p.PreWarm(context.Background()) == ErrShutdown, "expect ErrShutdown after close")
+}
+
+func TestPool_PrewarmInterval(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+	p, _ := NewPool("tcp", addr, 3)
+	defer func() { _ = p.Close() }()
+	var dials int32
+	p.SetDialer(countingDialer(&dials, 0))
+	p.SetPrewarmInterval(10 * time.Millisecond)
+	eventually(func() bool { return p.Connected() == 3 }, "expect 3 connections, got %d", p.Connected())
+
+	// 断开的连接在下一次预热时补上
+	cl, _ := p.Get()
+	_ = cl.Close()
+	eventually(func() bool { return p.Connected() == 3 && atomic.LoadInt32(&dials) == 4 }, "expect closed connection replaced, connected %d dials %d", p.Connected(), dials)
+
+	p.SetPrewarmInterval(0)
+	cl, _ = p.Get()
+	_ = cl.Close()
+	time.Sleep(50 * time.Millisecond)
+	_assert(p.Connected() == 2, "expect no prewarm after stop, got %d", p.Connected())
+}
+
+func TestPool_HealthCheck(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+	p, _ := NewPool("tcp", addr, 3, &server.Option{ConnectTimeout: 100 * time.Millisecond})
+	defer func() { _ = p.Close() }()
+	var dials, blackhole int32
+	var bad atomic.Pointer[Client]
+	p.SetDialer(func(network, address string, opts ...*server.Option) (*Client, error) {
+		conn, err := net.Dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		if atomic.AddInt32(&dials, 1) != 1 {
+			return NewClient(conn, opts[0])
+		}
+		cl, err := NewClient(&blackholeConn{Conn: conn, on: &blackhole}, opts[0])
+		bad.Store(cl)
+		return cl, err
+	})
+	_assert(p.Warm(context.Background(), 3) == nil, "warm failed")
+	_assert(p.HealthCheck(context.Background()) == nil && atomic.LoadInt32(&dials) == 3, "healthy pool should not redial, dials %d", dials)
+
+	// 半开的连接与已断开的连接被替换
+	atomic.StoreInt32(&blackhole, 1)
+	cl, _ := p.Get()
+	for cl == bad.Load() {
+		cl, _ = p.Get()
+	}
+	_ = cl.Close()
+	err := p.HealthCheck(context.Background())
+	_assert(err == nil, "health check error: %v", err)
+	_assert(atomic.LoadInt32(&dials) == 5 && p.Connected() == 3, "expect 2 replaced, dials %d connected %d", dials, p.Connected())
+	for i := 0; i < 6; i++ {
+		var reply int
+		err := p.Call(context.Background(), "Calc.Add", AddArgs{Num1: i, Num2: 1}, &reply)
+		_assert(err == nil && reply == i+1, "unexpected result %d (%v)", reply, err)
+	}
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"gmrpc/server"
+)
+
+/*
+协议版本协商 见 server/protocol.go
+服务端在握手回复中给出协商结果 没有结果时 (旧版本服务端) 按版本 1 处理 不使用任何可选功能
+协商的功能不包含的帧不会发送 例如对方不支持 _cancel 时上下文结束只在本地结束调用
+*/
+
+var errStreamingUnsupported = errors.New("rpc client: server does not support streaming")
+
+// 根据握手回复确定连接使用的版本与功能
+func negotiatedProtocol(opt *server.Option, ack *server.ProtocolAck) server.ProtocolAck {
+	own := server.NegotiateProtocol(opt.ProtocolVersion, opt.Features)
+	if own.Version < 2 || ack == nil {
+		return server.ProtocolAck{Version: 1, Features: own.Features & server.V1Features}
+	}
+	if ack.Version < own.Version {
+		own.Version = ack.Version
+	}
+	own.Features &= ack.Features
+	return own
+}
+
+// 没有开启能力通告与压缩时 服务端单独回复一行协商结果 拒绝连接时回复 server.HandshakeError
+func readProtocolAck(r *bufio.Reader) (*server.ProtocolAck, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	var ack struct {
+		*server.ProtocolAck
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(line, &ack); err != nil {
+		return nil, err
+	}
+	if ack.Error != "" {
+		return nil, errors.New(ack.Error)
+	}
+	return ack.ProtocolAck, nil
+}
+
+// 连接协商的协议版本
+func (client *Client) ProtocolVersion() int {
+	return client.protocol.Version
+}
+
+// 连接协商的功能
+func (client *Client) Features() server.Feature {
+	return client.protocol.Features
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 引入版本号之前的 Option 字段 冻结不再修改
+type v1Option struct {
+	CodecType    codec.Type `json:"CodecType"`
+	MagicNumber  int        `json:"MagicNumber"`
+	Capabilities bool       `json:"Capabilities,omitempty"`
+}
+
+// 模拟旧版本的服务端 忽略 Option 中的新字段 只提供 Calc.Add
+func serveV1(t *testing.T) string {
+	l, _ := net.Listen("tcp", ":0")
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				br := bufio.NewReader(conn)
+				line, _ := br.ReadBytes('\n')
+				var opt v1Option
+				_ = json.Unmarshal(line, &opt)
+				if opt.Capabilities {
+					_, _ = io.WriteString(conn, `{"services":{"Calc":["Add"]}}`+"\n")
+				}
+				cc := codec.NewGobCodec(&bufConn{Conn: conn, r: br})
+				defer func() { _ = cc.Close() }()
+				for {
+					var h codec.Header
+					var args AddArgs
+					if cc.ReadHeader(&h) != nil || cc.ReadBody(&args) != nil {
+						return
+					}
+					_ = cc.Write(&h, args.Num1+args.Num2)
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// 旧版本的服务端只在开启能力通告或压缩时回复 或者客户端声明版本 1 不等待回复
+func TestClient_ProtocolV1Server(t *testing.T) {
+	addr := serveV1(t)
+	for _, opt := range []*server.Option{
+		{CodecType: codec.GobType, Capabilities: true},
+		{CodecType: codec.GobType, ProtocolVersion: 1},
+	} {
+		client, err := Dial("tcp", addr, opt)
+		_assert(err == nil, "dial error: %v", err)
+
+		_assert(client.ProtocolVersion() == 1 && client.Features() == server.V1Features, "old server should negotiate v1, got %d %s", client.ProtocolVersion(), client.Features())
+		_assert(client.HasMethod("Calc.Add") == opt.Capabilities, "capabilities should still be read")
+		var reply int
+		err = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "unexpected result %d (%v)", reply, err)
+		_ = client.Close()
+	}
+}
+
+func TestClient_ProtocolFeatures(t *testing.T) {
+	var c Calc
+	s := server.NewServer()
+	_ = s.Register(&c)
+	addr := serveTest(t, s)
+
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	_assert(client.ProtocolVersion() == server.ProtocolVersion && client.Features() == server.SupportedFeatures, "unexpected protocol %d %s", client.ProtocolVersion(), client.Features())
+	_ = client.Close()
+
+	// 更高的未知版本降到双方共同支持的版本
+	client, err = Dial("tcp", addr, &server.Option{MagicNumber: server.MagicNumber, CodecType: codec.GobType, Capabilities: true,
+		ProtocolVersion: 9, Features: server.SupportedFeatures | 1<<20})
+	_assert(err == nil, "dial error: %v", err)
+	_assert(client.ProtocolVersion() == server.ProtocolVersion && client.Features() == server.SupportedFeatures, "unexpected protocol %d %s", client.ProtocolVersion(), client.Features())
+	_ = client.Close()
+
+	// 没有协商的功能不会使用
+	client, err = Dial("tcp", addr, &server.Option{MagicNumber: server.MagicNumber, CodecType: codec.GobType, Compression: "gzip",
+		ProtocolVersion: server.ProtocolVersion, Features: server.FeatureMetadata})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	_assert(client.Features() == server.FeatureMetadata, "unexpected features %s", client.Features())
+	call := <-client.NewStreamingCall("Calc.Add", io.NopCloser(strings.NewReader("data"))).Done
+	_assert(errors.Is(call.Error, errStreamingUnsupported), "expect streaming to be refused, got %v", call.Error)
+	var reply int
+	err = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "unexpected result %d (%v)", reply, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = s.Shutdown(ctx)
+	err = client.Call(context.Background(), "Calc.Add", AddArgs{}, &reply)
+	_assert(err != nil && client.ServerClosed() == nil, "closing notice should not be sent, got %v", err)
+}
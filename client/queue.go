@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+客户端调用队列 突发的调用先进入有界队列 由后台协程按入队顺序逐个转发给 Client.Call
+队列已满时按 OverflowPolicy 处理: 等待空位 丢弃最旧的调用 或直接拒绝
+*/
+
+type OverflowPolicy int
+
+const (
+	Block      OverflowPolicy = iota // 等待空位 直到 ctx 结束
+	DropOldest                       // 丢弃队列中最旧的调用 它返回 ErrDropped
+	Reject                           // 拒绝新的调用 返回 ErrQueueFull
+)
+
+var (
+	ErrDropped   = errors.New("rpc client: call dropped from full queue")
+	ErrQueueFull = errors.New("rpc client: call queue is full")
+)
+
+// 队列中调用的状态
+const (
+	pendingQueued int32 = iota
+	pendingRunning
+	pendingAbandoned // 已被丢弃或调用方已放弃 不再转发
+)
+
+type pendingCall struct {
+	ctx           context.Context
+	serviceMethod string
+	args, reply   interface{}
+	state         int32
+	done          chan error
+}
+
+type QueuedClient struct {
+	inner  *Client
+	queue  chan *pendingCall
+	policy OverflowPolicy
+
+	mu        sync.RWMutex // 关闭与入队互斥 关闭后不再有调用进入队列
+	closed    bool
+	closing   chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// capacity 为队列容量 不包括正在转发的调用 关闭 QueuedClient 不会关闭 c
+func NewQueuedClient(c *Client, capacity int, policy OverflowPolicy) *QueuedClient {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	q := &QueuedClient{
+		inner:   c,
+		queue:   make(chan *pendingCall, capacity),
+		policy:  policy,
+		closing: make(chan struct{}),
+	}
+	q.wg.Add(1)
+	go q.dispatch()
+	return q
+}
+
+// 入队后等待结果 ctx 在转发前结束时调用不再发送
+func (q *QueuedClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	pc := &pendingCall{
+		ctx:           ctx,
+		serviceMethod: serviceMethod,
+		args:          args,
+		reply:         reply,
+		done:          make(chan error, 1),
+	}
+	if err := q.enqueue(pc); err != nil {
+		return err
+	}
+	select {
+	case err := <-pc.done:
+		return err
+	case <-ctx.Done():
+		if atomic.CompareAndSwapInt32(&pc.state, pendingQueued, pendingAbandoned) {
+			return contextError(ctx)
+		}
+		// 已经开始转发 Client.Call 会因 ctx 结束而返回 等待它以免之后仍写入 reply
+		return <-pc.done
+	}
+}
+
+func (q *QueuedClient) enqueue(pc *pendingCall) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrShutdown
+	}
+	switch q.policy {
+	case Reject:
+		select {
+		case q.queue <- pc:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	case DropOldest:
+		for {
+			select {
+			case q.queue <- pc:
+				return nil
+			default:
+			}
+			// 与转发协程竞争 取到的调用可能已被调用方放弃
+			select {
+			case old := <-q.queue:
+				if atomic.CompareAndSwapInt32(&old.state, pendingQueued, pendingAbandoned) {
+					old.done <- ErrDropped
+				}
+			default:
+			}
+		}
+	default:
+		select {
+		case q.queue <- pc:
+			return nil
+		case <-pc.ctx.Done():
+			return contextError(pc.ctx)
+		case <-q.closing:
+			return ErrShutdown
+		}
+	}
+}
+
+func (q *QueuedClient) dispatch() {
+	defer q.wg.Done()
+	for {
+		select {
+		case pc := <-q.queue:
+			if atomic.CompareAndSwapInt32(&pc.state, pendingQueued, pendingRunning) {
+				pc.done <- q.inner.Call(pc.ctx, pc.serviceMethod, pc.args, pc.reply)
+			}
+		case <-q.closing:
+			return
+		}
+	}
+}
+
+// 队列中的调用数 不包括正在转发的调用
+func (q *QueuedClient) Len() int {
+	return len(q.queue)
+}
+
+// 停止转发 队列中尚未转发的调用返回 ErrShutdown 等待正在转发的调用结束
+func (q *QueuedClient) Close() error {
+	q.closeOnce.Do(func() {
+		// 先唤醒等待空位的调用方 它们持有读锁
+		close(q.closing)
+		q.mu.Lock()
+		q.closed = true
+		q.mu.Unlock()
+		q.wg.Wait()
+		for {
+			select {
+			case pc := <-q.queue:
+				if atomic.CompareAndSwapInt32(&pc.state, pendingQueued, pendingAbandoned) {
+					pc.done <- ErrShutdown
+				}
+			default:
+				return
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 转发协程被一个慢调用占住 队列中再放入一个调用 之后的调用触发溢出
+func fillQueue(t *testing.T, policy OverflowPolicy) (*QueuedClient, chan error) {
+	var s Sleeper
+	addr := startTestServer(t, &s)
+	c, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	q := NewQueuedClient(c, 1, policy)
+	t.Cleanup(func() {
+		_ = q.Close()
+		_ = c.Close()
+	})
+
+	results := make(chan error, 2)
+	go func() {
+		var reply time.Duration
+		results <- q.Call(context.Background(), "Sleeper.Sleep", 200*time.Millisecond, &reply)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for c.Stats().Pending == 0 {
+		_assert(time.Now().Before(deadline), "slow call not dispatched")
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		var reply time.Duration
+		results <- q.Call(context.Background(), "Sleeper.Sleep", time.Duration(0), &reply)
+	}()
+	for q.Len() == 0 {
+		_assert(time.Now().Before(deadline), "second call not queued")
+		time.Sleep(time.Millisecond)
+	}
+	return q, results
+}
+
+func TestQueuedClient_Reject(t *testing.T) {
+	q, results := fillQueue(t, Reject)
+	var reply time.Duration
+	start := time.Now()
+	err := q.Call(context.Background(), "Sleeper.Sleep", time.Duration(0), &reply)
+	_assert(errors.Is(err, ErrQueueFull), "expect ErrQueueFull, got %v", err)
+	_assert(time.Since(start) < 100*time.Millisecond, "reject should not wait")
+	for i := 0; i < 2; i++ {
+		_assert(<-results == nil, "queued calls should succeed")
+	}
+}
+
+func TestQueuedClient_DropOldest(t *testing.T) {
+	q, results := fillQueue(t, DropOldest)
+	var reply time.Duration
+	err := q.Call(context.Background(), "Sleeper.Sleep", time.Millisecond, &reply)
+	_assert(err == nil && reply == time.Millisecond, "newest call should succeed: %v", err)
+	// 排队的调用被丢弃 慢调用正常完成
+	_assert(errors.Is(<-results, ErrDropped), "oldest queued call should be dropped")
+	_assert(<-results == nil, "running call should succeed")
+}
+
+func TestQueuedClient_Block(t *testing.T) {
+	q, results := fillQueue(t, Block)
+	var reply time.Duration
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := q.Call(ctx, "Sleeper.Sleep", time.Duration(0), &reply)
+	_assert(errors.Is(err, context.DeadlineExceeded), "expect deadline while blocked, got %v", err)
+
+	// 没有截止时间时等到空位
+	err = q.Call(context.Background(), "Sleeper.Sleep", time.Millisecond, &reply)
+	_assert(err == nil && reply == time.Millisecond, "blocked call should succeed: %v", err)
+	for i := 0; i < 2; i++ {
+		_assert(<-results == nil, "queued calls should succeed")
+	}
+
+	_ = q.Close()
+	err = q.Call(context.Background(), "Sleeper.Sleep", time.Duration(0), &reply)
+	_assert(errors.Is(err, ErrShutdown), "expect ErrShutdown after close, got %v", err)
+}
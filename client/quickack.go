@@ -0,0 +1,14 @@
+package client
+
+import "gmrpc/netutil"
+
+// 对底层 TCP 连接设置 TCP_QUICKACK 见 netutil.SetQuickACK 不支持的平台与非 TCP 连接忽略
+//
+//	client.Apply(WithQuickACK(true))
+func WithQuickACK(enabled bool) ClientOption {
+	return func(client *Client) {
+		if client.conn != nil {
+			_ = netutil.SetQuickACK(client.conn, enabled)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+//go:build linux
+
+package client
+
+import (
+	"context"
+	"gmrpc/server"
+	"sort"
+	"testing"
+	"time"
+)
+
+// 100 字节请求与响应的 P50 延迟 服务端与客户端同时设置 TCP_QUICKACK
+//
+// 回环地址 单核 Go 1.23 上 -benchtime 20000x 的结果:
+//
+//	BenchmarkQuickACK/off   p50 18-19µs
+//	BenchmarkQuickACK/on    p50 18µs
+//
+// 客户端与服务端默认 TCP_NODELAY 每条消息一次写入 回环上几乎不触发延迟确认 两者没有明显差别
+// 收益出现在对端开启 Nagle 或跨主机的请求-响应路径上 需在真实网络上对比
+func BenchmarkQuickACK(b *testing.B) {
+	for _, on := range []bool{false, true} {
+		name := "off"
+		if on {
+			name = "on"
+		}
+		b.Run(name, func(b *testing.B) {
+			s := server.NewServer()
+			_ = s.Register(new(Blob))
+			s.SetQuickACK(on)
+			client, err := Dial("tcp", serveTest(b, s))
+			_assert(err == nil, "dial error: %v", err)
+			defer func() { _ = client.Close() }()
+			client.Apply(WithQuickACK(on))
+
+			payload := make([]byte, 100)
+			latencies := make([]time.Duration, 0, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var reply []byte
+				start := time.Now()
+				_ = client.Call(context.Background(), "Blob.Echo", payload, &reply)
+				latencies = append(latencies, time.Since(start))
+			}
+			b.StopTimer()
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(latencies[len(latencies)/2].Microseconds()), "p50-µs")
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"gmrpc/codec"
+)
+
+/*
+取得未解码的结果 缓存代理等只转发结果的场景不必解码为结构体
+	var raw []byte
+	err := client.Call(client.WithRawResponse(ctx, &raw), "Math.Add", args, nil)
+reply 为 nil 时不解码 非空时仍正常解码 raw 可以之后以 codec.BodyMarshaler.UnmarshalBody 解码
+只有能取出单个消息体的编码支持 (二进制头部 且消息体之间没有共享状态 见 codec.RawBodyReader)
+不支持时 raw 置为 nil 结果照常解码 调用出错时 raw 不变
+*/
+
+type rawResponseKey struct{}
+
+// 调用成功后把结果编码后的字节写入 buf (复用其容量) 只对 Call 生效
+func WithRawResponse(ctx context.Context, buf *[]byte) context.Context {
+	return context.WithValue(ctx, rawResponseKey{}, buf)
+}
+
+func rawResponseFromContext(ctx context.Context) *[]byte {
+	buf, _ := ctx.Value(rawResponseKey{}).(*[]byte)
+	return buf
+}
+
+// 读取结果 设置了 raw 时先取出消息体
+func (client *Client) readReply(call *Call) error {
+	if call.raw == nil {
+		return client.cc.ReadBody(call.Reply)
+	}
+	rb, ok := client.cc.(codec.RawBodyReader)
+	bm, ok2 := client.cc.(codec.BodyMarshaler)
+	if !ok || !ok2 || !rb.RawBodySupported() {
+		*call.raw = nil
+		return client.cc.ReadBody(call.Reply)
+	}
+	data := rb.ReadRawBody()
+	*call.raw = append((*call.raw)[:0], data...)
+	if call.Reply == nil {
+		return nil
+	}
+	return bm.UnmarshalBody(data, call.Reply)
+}
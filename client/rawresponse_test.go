@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"testing"
+)
+
+func TestClient_RawResponse(t *testing.T) {
+	addr := startTestServer(t, new(Weather), new(Calc))
+
+	t.Run("binary json", func(t *testing.T) {
+		client, err := Dial("tcp", addr, &server.Option{CodecType: codec.JsonType, HeaderType: codec.BinaryHeader})
+		_assert(err == nil, "dial error: %v", err)
+		defer func() { _ = client.Close() }()
+
+		// reply 为 nil 时只取字节
+		var raw []byte
+		err = client.Call(WithRawResponse(context.Background(), &raw), "Weather.Current", "Shenzhen", nil)
+		_assert(err == nil, "call error: %v", err)
+		var decoded Reading
+		err = json.Unmarshal(raw, &decoded)
+		_assert(err == nil && decoded == Reading{City: "Shenzhen", Temp: 100}, "raw %q decoded to %+v (%v)", raw, decoded, err)
+
+		// 与编解码器的解码结果一致
+		var again Reading
+		err = client.cc.(codec.BodyMarshaler).UnmarshalBody(raw, &again)
+		_assert(err == nil && again == decoded, "expect %+v, got %+v (%v)", decoded, again, err)
+
+		// reply 非空时同时解码 复用 raw 的容量
+		var reading Reading
+		prev := &raw[:1][0]
+		err = client.Call(WithRawResponse(context.Background(), &raw), "Weather.Current", "Beijing", &reading)
+		_assert(err == nil && reading.City == "Beijing", "expect Beijing, got %+v (%v)", reading, err)
+		_assert(&raw[0] == prev, "expect buffer reused")
+		_ = json.Unmarshal(raw, &decoded)
+		_assert(decoded == reading, "expect %+v, got %+v", reading, decoded)
+
+		// 出错时不写入
+		var sum int
+		err = client.Call(WithRawResponse(context.Background(), &raw), "Calc.Missing", AddArgs{}, &sum)
+		_assert(err != nil, "expect error")
+		_ = json.Unmarshal(raw, &decoded)
+		_assert(decoded.City == "Beijing", "raw changed on error: %q", raw)
+
+		// 普通调用不受影响
+		err = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &sum)
+		_assert(err == nil && sum == 3, "expect 3, got %d (%v)", sum, err)
+	})
+
+	t.Run("gob unsupported", func(t *testing.T) {
+		client, err := Dial("tcp", addr, &server.Option{CodecType: codec.GobType, HeaderType: codec.BinaryHeader})
+		_assert(err == nil, "dial error: %v", err)
+		defer func() { _ = client.Close() }()
+
+		raw := []byte("stale")
+		var reading Reading
+		err = client.Call(WithRawResponse(context.Background(), &raw), "Weather.Current", "Shenzhen", &reading)
+		_assert(err == nil && reading.City == "Shenzhen", "expect decoded reply, got %+v (%v)", reading, err)
+		_assert(raw == nil, "expect nil raw for stateful body, got %q", raw)
+
+		// 不解码时照常读出消息体 后续调用不受影响
+		err = client.Call(WithRawResponse(context.Background(), &raw), "Weather.Current", "Shenzhen", nil)
+		_assert(err == nil, "call error: %v", err)
+		var sum int
+		err = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 2, Num2: 2}, &sum)
+		_assert(err == nil && sum == 4, "expect 4, got %d (%v)", sum, err)
+	})
+}
@@ -0,0 +1,55 @@
+package client
+
+import "gmrpc/codec"
+
+// 在分配 Seq 之后 写入请求之前调用 可以修改请求头 例如添加签名
+// h.Metadata 是该请求独有的副本 返回错误时请求不会发送
+type RequestHook func(h *codec.Header, args interface{}) error
+
+// hook 为空时取消
+func WithRequestHook(hook RequestHook) ClientOption {
+	return func(client *Client) {
+		client.requestHook = hook
+	}
+}
+
+// 以实际发送的消息体字节修改请求头 见 codec.BodyHook 只支持分帧格式 (Option.HeaderType 为 binary)
+// 与 RequestHook 一样 h.Metadata 是该请求独有的副本 hook 为空时取消
+func WithBodyHook(hook codec.BodyHook) ClientOption {
+	return func(client *Client) {
+		client.bodyHook = hook
+	}
+}
+
+// 调用方持有 sending 锁
+func (client *Client) runRequestHook(args interface{}) error {
+	client.mu.Lock()
+	hook, bodyHook := client.requestHook, client.bodyHook
+	client.mu.Unlock()
+	if hook == nil && bodyHook == nil {
+		return nil
+	}
+	md := make(map[string]string, len(client.header.Metadata)+3)
+	for k, v := range client.header.Metadata {
+		md[k] = v
+	}
+	client.header.Metadata = md
+	if hook == nil {
+		return nil
+	}
+	return hook(&client.header, args)
+}
+
+// 只在写入本次请求期间设置 取消通知等其他消息不调用 调用方持有 sending 锁
+func (client *Client) writeRequest(call *Call, flush bool) error {
+	client.mu.Lock()
+	hook := client.bodyHook
+	client.mu.Unlock()
+	bh, ok := client.cc.(codec.BodyHooker)
+	if hook == nil || !ok {
+		return client.write(call, flush)
+	}
+	bh.SetBodyHook(hook)
+	defer bh.SetBodyHook(nil)
+	return client.write(call, flush)
+}
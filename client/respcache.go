@@ -0,0 +1,178 @@
+package client
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"gmrpc/metadata"
+	"gmrpc/server"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/*
+响应缓存 以拦截器的方式缓存成功的结果 键为方法名与参数的 json 编码
+服务端的缓存提示(server.CacheHint)优先于客户端的配置: max-age 覆盖配置的时间 no-store 总是不缓存
+结果以 gob 编码保存 命中时解码到调用方的 reply 各调用方互不影响
+条目数有上限 超出时淘汰最久未使用的条目
+*/
+
+// ResponseCacheConfig.MaxEntries 为 0 时的条目数上限
+const DefaultResponseCacheEntries = 1024
+
+type ResponseCacheConfig struct {
+	TTL        time.Duration            // 默认缓存时间 0 表示只缓存服务端声明可缓存的结果
+	Methods    map[string]time.Duration // 按方法覆盖 TTL
+	MaxEntries int                      // 条目数上限 0 表示使用 DefaultResponseCacheEntries
+}
+
+type ResponseCache struct {
+	cfg ResponseCacheConfig
+	now func() time.Time // 测试时替换
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // 最近使用的在头部
+}
+
+type cacheEntry struct {
+	key     string
+	reply   []byte
+	expires time.Time
+}
+
+func NewResponseCache(cfg ResponseCacheConfig) *ResponseCache {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = DefaultResponseCacheEntries
+	}
+	return &ResponseCache{cfg: cfg, now: time.Now, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// 清空缓存
+func (c *ResponseCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *ResponseCache) Interceptor() ClientInterceptor {
+	return func(ctx context.Context, client *Client, serviceMethod string, args, reply interface{}, invoker UnaryInvoker) error {
+		key, ok := cacheKey(serviceMethod, args, reply)
+		if !ok {
+			return invoker(ctx, serviceMethod, args, reply)
+		}
+		if c.load(key, reply) {
+			return nil
+		}
+		var md metadata.MD
+		if err := invoker(WithResponseMetadata(ctx, &md), serviceMethod, args, reply); err != nil {
+			return err
+		}
+		c.store(key, serviceMethod, md, reply)
+		return nil
+	}
+}
+
+func (c *ResponseCache) load(key string, reply interface{}) bool {
+	c.mu.Lock()
+	var data []byte
+	if e, ok := c.entries[key]; ok {
+		if entry := e.Value.(*cacheEntry); c.now().Before(entry.expires) {
+			c.lru.MoveToFront(e)
+			data = entry.reply
+		} else {
+			c.remove(e)
+		}
+	}
+	c.mu.Unlock()
+	if data == nil {
+		return false
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(reply) == nil
+}
+
+func (c *ResponseCache) store(key, serviceMethod string, md metadata.MD, reply interface{}) {
+	ttl := c.ttl(serviceMethod, md)
+	if ttl <= 0 {
+		c.mu.Lock()
+		if e, ok := c.entries[key]; ok {
+			c.remove(e)
+		}
+		c.mu.Unlock()
+		return
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(reply); err != nil {
+		return
+	}
+	entry := &cacheEntry{key: key, reply: buf.Bytes(), expires: c.now().Add(ttl)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value = entry
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.cfg.MaxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// 调用方持有 c.mu
+func (c *ResponseCache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*cacheEntry).key)
+}
+
+func (c *ResponseCache) ttl(serviceMethod string, md metadata.MD) time.Duration {
+	if hint, ok := server.ParseCacheControl(md.Get(server.CacheControlKey)); ok {
+		if hint.NoStore {
+			return 0
+		}
+		return hint.TTL
+	}
+	if ttl, ok := c.cfg.Methods[serviceMethod]; ok {
+		return ttl
+	}
+	return c.cfg.TTL
+}
+
+func cacheKey(serviceMethod string, args, reply interface{}) (string, bool) {
+	if _, ok := streamingArg(args); ok {
+		return "", false
+	}
+	if rv := reflect.ValueOf(reply); rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return "", false
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	return serviceMethod + "\x00" + reflect.TypeOf(reply).String() + "\x00" + string(b), true
+}
+
+type responseMetadataKey struct{}
+
+// 调用成功后把响应头中的元数据写入 md 只对 Call 生效 嵌套使用时每一层都会写入
+func WithResponseMetadata(ctx context.Context, md *metadata.MD) context.Context {
+	mds, _ := ctx.Value(responseMetadataKey{}).([]*metadata.MD)
+	return context.WithValue(ctx, responseMetadataKey{}, append(mds[:len(mds):len(mds)], md))
+}
+
+func recordResponseMetadata(ctx context.Context, md metadata.MD) {
+	mds, _ := ctx.Value(responseMetadataKey{}).([]*metadata.MD)
+	for _, p := range mds {
+		*p = md
+	}
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"gmrpc/server"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Quote struct {
+	Price int
+	hint  server.CacheHint
+}
+
+func (q *Quote) CacheHint() server.CacheHint {
+	return q.hint
+}
+
+type Quotes struct {
+	calls int64
+}
+
+// 服务端声明可缓存 1 秒
+func (q *Quotes) Cached(symbol string, reply *Quote) error {
+	reply.Price = int(atomic.AddInt64(&q.calls, 1))
+	reply.hint = server.CacheFor(time.Second)
+	return nil
+}
+
+// 实时价格 禁止缓存
+func (q *Quotes) Live(symbol string, reply *Quote) error {
+	reply.Price = int(atomic.AddInt64(&q.calls, 1))
+	reply.hint = server.NoStore()
+	return nil
+}
+
+// 没有提示 由客户端配置决定
+func (q *Quotes) Plain(symbol string, reply *Quote) error {
+	reply.Price = int(atomic.AddInt64(&q.calls, 1))
+	return nil
+}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestResponseCache_ServerHints(t *testing.T) {
+	var q Quotes
+	addr := startTestServer(t, &q)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	cache := NewResponseCache(ResponseCacheConfig{TTL: time.Minute, Methods: map[string]time.Duration{"Quotes.Cached": time.Hour}})
+	clock := &fakeClock{now: time.Now()}
+	cache.now = clock.Now
+	client.Use(cache.Interceptor())
+
+	call := func(method, symbol string) int {
+		var reply Quote
+		err := client.Call(context.Background(), method, symbol, &reply)
+		_assert(err == nil, "%s: call error: %v", method, err)
+		return reply.Price
+	}
+
+	// 服务端的 1 秒覆盖客户端配置的 1 小时
+	first := call("Quotes.Cached", "A")
+	_assert(call("Quotes.Cached", "A") == first, "reply should be served from cache")
+	_assert(call("Quotes.Cached", "B") != first, "different args should not share the entry")
+	clock.Advance(900 * time.Millisecond)
+	_assert(call("Quotes.Cached", "A") == first, "entry should still be valid")
+	clock.Advance(200 * time.Millisecond)
+	second := call("Quotes.Cached", "A")
+	_assert(second != first, "expired entry should be re-fetched")
+	_assert(call("Quotes.Cached", "A") == second, "re-fetched reply should be cached again")
+
+	// no-store 即使客户端配置了缓存也不缓存
+	before := atomic.LoadInt64(&q.calls)
+	for i := 0; i < 3; i++ {
+		call("Quotes.Live", "A")
+	}
+	_assert(atomic.LoadInt64(&q.calls)-before == 3, "no-store replies must not be cached")
+
+	// 没有提示时使用客户端配置
+	plain := call("Quotes.Plain", "A")
+	clock.Advance(30 * time.Second)
+	_assert(call("Quotes.Plain", "A") == plain, "reply without hint should use the configured TTL")
+	clock.Advance(31 * time.Second)
+	_assert(call("Quotes.Plain", "A") != plain, "configured TTL should expire")
+
+	cache.Invalidate()
+	_assert(cache.Len() == 0, "invalidate should clear the cache")
+}
+
+func TestResponseCache_OnlyServerHints(t *testing.T) {
+	var q Quotes
+	addr := startTestServer(t, &q)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	cache := NewResponseCache(ResponseCacheConfig{})
+	client.Use(cache.Interceptor())
+	var a, b Quote
+	_ = client.Call(context.Background(), "Quotes.Plain", "A", &a)
+	_ = client.Call(context.Background(), "Quotes.Plain", "A", &b)
+	_assert(a.Price != b.Price && cache.Len() == 0, "replies without hint should not be cached by default")
+	_ = client.Call(context.Background(), "Quotes.Cached", "A", &a)
+	_ = client.Call(context.Background(), "Quotes.Cached", "A", &b)
+	_assert(a.Price == b.Price && cache.Len() == 1, "hinted reply should be cached")
+}
+
+// 超出条目数上限时淘汰最久未使用的条目
+func TestResponseCache_MaxEntries(t *testing.T) {
+	var q Quotes
+	client, err := Dial("tcp", startTestServer(t, &q))
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	cache := NewResponseCache(ResponseCacheConfig{TTL: time.Minute, MaxEntries: 2})
+	client.Use(cache.Interceptor())
+	call := func(symbol string) int {
+		var reply Quote
+		_assert(client.Call(context.Background(), "Quotes.Plain", symbol, &reply) == nil, "call failed")
+		return reply.Price
+	}
+	a, b := call("A"), call("B")
+	_assert(call("A") == a, "A should be cached")
+	c := call("C")
+	_assert(cache.Len() == 2, "expect 2 entries, got %d", cache.Len())
+	_assert(call("A") == a && call("C") == c, "recently used entries should stay")
+	_assert(call("B") != b, "least recently used entry should be evicted")
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"time"
+)
+
+// 重试策略 未收到服务端建议时按指数退避等待
+type RetryPolicy struct {
+	MaxAttempts int           // 最大尝试次数 包含第一次
+	BaseBackoff time.Duration // 第一次重试前的等待时间
+	MaxBackoff  time.Duration // 退避等待的上限
+
+	AttemptTimeout time.Duration // 单次尝试的超时 超时后重试 0 表示不设置
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseBackoff: 100 * time.Millisecond,
+	MaxBackoff:  2 * time.Second,
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseBackoff << uint(attempt)
+	if d <= 0 || d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// 判断错误是否可以重试 并返回服务端建议的等待毫秒数
+// 服务端主动关闭连接时可以重试 等待时间来自关闭通知 其他错误只有过载与资源不足可以重试
+// 关闭中的服务端对所有响应都给出提示 带有提示的参数错误或业务错误仍然不重试
+func IsRetryableWithHint(err error) (retryable bool, waitMs uint32) {
+	var closed *ServerClosedError
+	if errors.As(err, &closed) {
+		return true, uint32(closed.RetryAfter / time.Millisecond)
+	}
+	e, ok := rpcerr.FromError(err)
+	if !ok || !rpcerr.Retryable(e.Code) {
+		return false, 0
+	}
+	return true, e.RetryAfterMs
+}
+
+// 响应元数据中的 retry-after-ms 补充到 RPCError 中 Status 已有提示时不覆盖
+// 没有 Status 的错误 (如 jsonrpc2) 原样返回
+func withRetryAfter(err error, md map[string]string) error {
+	ms, ok := server.ParseRetryAfter(md[server.RetryAfterKey])
+	if !ok {
+		return err
+	}
+	if e, isRPC := err.(*rpcerr.RPCError); isRPC && e.RetryAfterMs == 0 {
+		e.RetryAfterMs = ms
+	}
+	return err
+}
+
+func (client *Client) SetRetryPolicy(policy RetryPolicy) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.retryPolicy = &policy
+}
+
+// 同步调用 遇到可重试错误时按服务端建议或指数退避等待后重试
+func (client *Client) CallWithRetry(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	client.mu.Lock()
+	policy := DefaultRetryPolicy
+	if client.retryPolicy != nil {
+		policy = *client.retryPolicy
+	}
+	client.mu.Unlock()
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = client.callAttempt(ctx, policy.AttemptTimeout, serviceMethod, args, reply)
+		retryable, waitMs := IsRetryableWithHint(err)
+		// 单次尝试超时 服务端按传递的预算先超时时来源为 TimeoutPropagatedBudget
+		switch rpcerr.TimeoutSource(err) {
+		case rpcerr.TimeoutAttempt, rpcerr.TimeoutPropagatedBudget:
+			retryable = retryable || ctx.Err() == nil
+		}
+		if !retryable || attempt+1 >= policy.MaxAttempts {
+			return err
+		}
+
+		wait := policy.backoff(attempt)
+		if waitMs > 0 {
+			wait = time.Duration(waitMs) * time.Millisecond
+		}
+		if client.sleep(ctx, wait) != nil {
+			return err
+		}
+	}
+}
+
+// 等待 d 或 ctx 结束 返回 ctx 的错误
+type sleepFunc func(ctx context.Context, d time.Duration) error
+
+func (client *Client) sleep(ctx context.Context, d time.Duration) error {
+	if client.retrySleep != nil {
+		return client.retrySleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (client *Client) callAttempt(ctx context.Context, timeout time.Duration, serviceMethod string, args, reply interface{}) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = withAttemptTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return client.Call(ctx, serviceMethod, args, reply)
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClient_CallWithRetry(t *testing.T) {
+	var c Calc
+	s := server.NewServer()
+	_ = s.Register(&c)
+	// 每秒 5 个请求 令牌耗尽后下一个令牌在 200ms 后产生
+	s.SetRateLimit(5, 1)
+	addr := serveTest(t, s)
+
+	client, _ := Dial("tcp", addr)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	_ = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1}, &reply)
+
+	err := client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1}, &reply)
+	_assert(errors.Is(err, server.ErrServerOverloaded), "expect overloaded error, got %v", err)
+	retryable, waitMs := IsRetryableWithHint(err)
+	_assert(retryable && waitMs > 150 && waitMs <= 200, "expect retry hint about 200ms, got %v %d", retryable, waitMs)
+
+	// 指数退避的默认值远小于建议值 重试等待时间应接近服务端的建议
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	time.Sleep(250 * time.Millisecond)
+	_ = client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1}, &reply)
+
+	start := time.Now()
+	err = client.CallWithRetry(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply)
+	elapsed := time.Since(start)
+	_assert(err == nil && reply == 3, "expect retry to succeed, got %v", err)
+	_assert(elapsed >= 180*time.Millisecond && elapsed < 400*time.Millisecond, "expect to wait about 200ms, but waited %s", elapsed)
+
+	t.Run("concurrency limit", func(t *testing.T) {
+		var b Bar
+		s := server.NewServer()
+		_ = s.Register(&b)
+		s.SetMaxConcurrentRequests(1)
+		client, _ := Dial("tcp", serveTest(t, s))
+		defer func() { _ = client.Close() }()
+
+		var reply int
+		call := client.Go("Bar.Timeout", 1, &reply, nil)
+		time.Sleep(100 * time.Millisecond)
+		err := client.Call(context.Background(), "Bar.Timeout", 1, &reply)
+		_assert(errors.Is(err, server.ErrServerOverloaded), "expect overloaded error, got %v", err)
+		<-call.Done
+	})
+}
+
+func TestClient_RetryAfterHint(t *testing.T) {
+	var c Calc
+	s := server.NewServer()
+	_ = s.Register(&c)
+	// 每秒 2 个请求 令牌耗尽后下一个令牌在 500ms 后产生
+	s.SetRateLimit(2, 1)
+	addr := serveTest(t, s)
+
+	client, _ := Dial("tcp", addr)
+	defer func() { _ = client.Close() }()
+	var reply int
+	_assert(client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1}, &reply) == nil, "first call should pass")
+
+	// 提示同时出现在错误与响应元数据中
+	call := <-client.Go("Calc.Add", AddArgs{Num1: 1}, &reply, nil).Done
+	hint := rpcerr.RetryAfter(call.Error)
+	_assert(hint > 400*time.Millisecond && hint <= 500*time.Millisecond, "expect a hint about 500ms, got %v (%v)", hint, call.Error)
+	_assert(call.ResponseMeta.Get(server.RetryAfterKey) == strconv.FormatInt(hint.Milliseconds(), 10),
+		"expect %s in metadata, got %v", server.RetryAfterKey, call.ResponseMeta)
+
+	// 假时钟 等待时放开限流 相当于时间已经过去
+	var waited []time.Duration
+	client.retrySleep = func(ctx context.Context, d time.Duration) error {
+		waited = append(waited, d)
+		s.SetRateLimit(0, 0)
+		return nil
+	}
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	err := client.CallWithRetry(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "expect retry to succeed, got %v", err)
+	_assert(len(waited) == 1 && waited[0] > 400*time.Millisecond && waited[0] <= 500*time.Millisecond,
+		"expect one wait of about 500ms instead of the backoff, got %v", waited)
+}
+
+func TestWithRetryAfter(t *testing.T) {
+	md := map[string]string{server.RetryAfterKey: "120"}
+	overloaded := rpcerr.New(rpcerr.Overloaded, "busy")
+	err := withRetryAfter(overloaded, md)
+	retryable, waitMs := IsRetryableWithHint(err)
+	_assert(err == overloaded && retryable && waitMs == 120, "overloaded error should carry the hint, got %v %d", retryable, waitMs)
+
+	// 关闭中的服务端对所有响应都给出提示 不可重试的错误仍然不重试
+	invalid := rpcerr.New(rpcerr.InvalidArgs, "bad args")
+	retryable, _ = IsRetryableWithHint(withRetryAfter(invalid, md))
+	_assert(invalid.RetryAfterMs == 120 && !retryable, "hinted invalid args should not be retryable")
+	plain := errors.New("busy")
+	retryable, _ = IsRetryableWithHint(withRetryAfter(plain, md))
+	_assert(withRetryAfter(plain, md) == plain && !retryable, "plain errors are unchanged and not retryable")
+
+	// Status 中已有的提示优先
+	status := &rpcerr.RPCError{Code: rpcerr.Overloaded, RetryAfterMs: 30}
+	_assert(withRetryAfter(status, md) == status && status.RetryAfterMs == 30, "status hint should win")
+	_assert(withRetryAfter(plain, nil) == plain, "errors without a hint are unchanged")
+	_assert(withRetryAfter(overloaded, map[string]string{server.RetryAfterKey: "soon"}) == overloaded, "invalid hints are ignored")
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/server"
+	"gmrpc/service"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+/*
+参数与结果类型的结构检查 客户端与服务端的类型定义不一致时 (字段改名 类型改变) 调用在客户端直接失败
+开启后第一次调用某个服务时通过反射服务获取该服务各方法的结构摘要 与本地参数与结果类型的摘要比较
+旧版本的服务端不提供摘要 或获取失败时放行 失败的结果同样缓存 不支持反射的服务端不会每次调用都多一次往返
+获取最多等待 ConnectTimeout Go 需要获取时在后台完成检查后再发送 不阻塞调用方
+*/
+
+var ErrSchemaMismatch = errors.New("rpc client: schema mismatch")
+
+type schemaKey struct {
+	method     string
+	arg, reply reflect.Type
+}
+
+type schemaCache struct {
+	mu       sync.Mutex
+	services map[string]map[string]server.MethodDescriptor // 服务 -> 方法 -> 描述 获取失败时为 nil
+	checked  map[schemaKey]error                           // 已比较过的类型组合
+}
+
+// 开启类型结构检查
+func (client *Client) EnableSchemaCheck() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.schemas = &schemaCache{
+		services: make(map[string]map[string]server.MethodDescriptor),
+		checked:  make(map[schemaKey]error),
+	}
+}
+
+func (client *Client) DisableSchemaCheck() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.schemas = nil
+}
+
+func (client *Client) schemaCache() *schemaCache {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.schemas
+}
+
+func (client *Client) checkSchema(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	sc := client.schemaCache()
+	if sc == nil || args == nil || reply == nil || strings.HasPrefix(serviceMethod, "_") {
+		return nil
+	}
+	key := schemaKey{serviceMethod, reflect.TypeOf(args), reflect.TypeOf(reply)}
+	sc.mu.Lock()
+	err, ok := sc.checked[key]
+	sc.mu.Unlock()
+	if ok {
+		return err
+	}
+
+	svc, method := splitServiceMethod(serviceMethod)
+	methods, err := client.serviceSchemas(ctx, sc, svc)
+	if err != nil {
+		return nil
+	}
+	desc, ok := methods[method]
+	if !ok {
+		return nil
+	}
+	err = compareSchema(serviceMethod, "args", desc.ArgHash, desc.ArgShape, key.arg)
+	if err == nil {
+		err = compareSchema(serviceMethod, "reply", desc.ReplyHash, desc.ReplyShape, key.reply)
+	}
+	sc.mu.Lock()
+	sc.checked[key] = err
+	sc.mu.Unlock()
+	return err
+}
+
+// 检查是否需要先向服务端获取描述 不需要时 checkSchema 不会阻塞
+func (client *Client) schemaPending(serviceMethod string) bool {
+	sc := client.schemaCache()
+	if sc == nil || strings.HasPrefix(serviceMethod, "_") {
+		return false
+	}
+	svc, _ := splitServiceMethod(serviceMethod)
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	_, ok := sc.services[svc]
+	return !ok
+}
+
+func splitServiceMethod(serviceMethod string) (svc, method string) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	return serviceMethod[:dot], serviceMethod[dot+1:]
+}
+
+// 获取服务各方法的描述 结果与服务端返回的失败都缓存 调用方 ctx 结束导致的失败不缓存
+func (client *Client) serviceSchemas(ctx context.Context, sc *schemaCache, svc string) (map[string]server.MethodDescriptor, error) {
+	sc.mu.Lock()
+	methods, ok := sc.services[svc]
+	sc.mu.Unlock()
+	if ok {
+		return methods, nil
+	}
+	if client.opt.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.opt.ConnectTimeout)
+		defer cancel()
+	}
+	var reply server.ListMethodsReply
+	err := client.call(ctx, server.ReflectionService+".ListMethods", server.ListMethodsArgs{Service: svc}, &reply)
+	if err != nil {
+		if ctx.Err() == nil {
+			sc.mu.Lock()
+			sc.services[svc] = nil
+			sc.mu.Unlock()
+		}
+		return nil, err
+	}
+	methods = make(map[string]server.MethodDescriptor, len(reply.Methods))
+	for _, m := range reply.Methods {
+		methods[m.Name] = m
+	}
+	sc.mu.Lock()
+	sc.services[svc] = methods
+	sc.mu.Unlock()
+	return methods, nil
+}
+
+func compareSchema(serviceMethod, which, hash string, want []string, t reflect.Type) error {
+	if hash == "" {
+		return nil
+	}
+	got := service.TypeShape(t)
+	if service.ShapeHash(got) == hash {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s: %s", ErrSchemaMismatch, serviceMethod, which, strings.Join(service.DiffShapes(want, got), "; "))
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gmrpc/server"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 模拟客户端持有的过时定义 Num2 改名为 Count Origin.Y 改为 string
+type driftedPoint struct {
+	X int
+	Y string
+}
+
+type driftedArgs struct {
+	Num1, Count int
+	Origin      driftedPoint
+}
+
+func TestClient_SchemaCheck(t *testing.T) {
+	var c Calc
+	s := server.NewServer()
+	_ = s.Register(&c)
+	addr := serveTest(t, s)
+
+	client, _ := Dial("tcp", addr)
+	defer func() { _ = client.Close() }()
+	client.EnableSchemaCheck()
+	ctx := context.Background()
+
+	// 同样结构的副本 类型名不同也能通过
+	type localArgs struct {
+		Num1, Num2 int
+		Origin     struct{ X, Y int }
+	}
+	var reply int
+	err := client.Call(ctx, "Calc.Add", localArgs{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "matching schema should pass, got %d (%v)", reply, err)
+
+	err = client.Call(ctx, "Calc.Add", driftedArgs{Num1: 1, Count: 2}, &reply)
+	_assert(errors.Is(err, ErrSchemaMismatch), "expect ErrSchemaMismatch, got %v", err)
+	for _, s := range []string{"Calc.Add args", "missing Num2 int", "unexpected Count int", "Origin.Y: string != int"} {
+		_assert(strings.Contains(err.Error(), s), "error should mention %q: %v", s, err)
+	}
+
+	var wrong string
+	call := <-client.Go("Calc.Add", AddArgs{}, &wrong, nil).Done
+	_assert(errors.Is(call.Error, ErrSchemaMismatch) && strings.Contains(call.Error.Error(), "$: string != int"), "expect reply mismatch, got %v", call.Error)
+
+	client.DisableSchemaCheck()
+	err = client.Call(ctx, "Calc.Add", driftedArgs{Num1: 1, Count: 2}, &reply)
+	_assert(!errors.Is(err, ErrSchemaMismatch), "check should be disabled, got %v", err)
+}
+
+// 获取描述失败的结果也缓存 Go 不等待获取
+func TestClient_SchemaCheckFetch(t *testing.T) {
+	var c Calc
+	s := server.NewServer()
+	_ = s.Register(&c)
+	var lists int32
+	// 模拟不支持反射且响应很慢的服务端
+	s.Use(func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		if info.ServiceMethod == server.ReflectionService+".ListMethods" {
+			atomic.AddInt32(&lists, 1)
+			time.Sleep(200 * time.Millisecond)
+			return errors.New("reflection disabled")
+		}
+		return handler(ctx, argv, replyv)
+	})
+	client, _ := Dial("tcp", serveTest(t, s))
+	defer func() { _ = client.Close() }()
+	client.EnableSchemaCheck()
+
+	var reply int
+	start := time.Now()
+	call := client.Go("Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply, nil)
+	_assert(time.Since(start) < 100*time.Millisecond, "Go should not wait for the schema fetch, took %v", time.Since(start))
+	<-call.Done
+	_assert(call.Error == nil && reply == 3, "call should pass after a failed fetch, got %d (%v)", reply, call.Error)
+	for i := 0; i < 3; i++ {
+		_assert(client.Call(context.Background(), "Calc.Add", AddArgs{Num1: i}, &reply) == nil, "call failed")
+	}
+	_assert(atomic.LoadInt32(&lists) == 1, "failed fetch should be cached, got %d fetches", lists)
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+请求编号生成器 默认每个客户端从 1 开始递增 分布式场景需要全局唯一的调用编号时替换
+生成器返回 0 (留给服务端的关闭通知) 或仍在等待响应的编号时不重新获取 调用返回 ErrDuplicateSeq 不会发送
+调用方通过 WithCallSeq 取得实际使用的编号 与服务端日志中的 Seq 对应
+*/
+
+type SequenceGenerator interface {
+	Next() uint64
+}
+
+var ErrDuplicateSeq = errors.New("rpc client: sequence generator returned a duplicate seq")
+
+// 之后注册的调用使用 gen 生成编号 为空时恢复默认的递增编号
+func (client *Client) SetSequenceGenerator(gen SequenceGenerator) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.seqGen = gen
+}
+
+// 与 SetSequenceGenerator 相同 通过 Apply 设置
+func WithSequenceGenerator(gen SequenceGenerator) ClientOption {
+	return func(client *Client) {
+		client.seqGen = gen
+	}
+}
+
+// 调用方持有 client.mu
+func (client *Client) nextSeq() (uint64, error) {
+	if client.seqGen == nil {
+		return client.seq, nil
+	}
+	seq := client.seqGen.Next()
+	if seq == 0 || client.pending[seq] != nil {
+		return 0, fmt.Errorf("%w: %d", ErrDuplicateSeq, seq)
+	}
+	return seq, nil
+}
+
+type callSeqKey struct{}
+
+// 调用注册后把请求编号写入 seq 注册失败时为 0 只对 Call 生效
+// 拦截器在调用 invoker 前设置 返回后读取 可把 Seq 写入日志 多层拦截器各自设置时都会写入
+func WithCallSeq(ctx context.Context, seq *uint64) context.Context {
+	seqs, _ := ctx.Value(callSeqKey{}).([]*uint64)
+	return context.WithValue(ctx, callSeqKey{}, append(seqs[:len(seqs):len(seqs)], seq))
+}
+
+func recordCallSeq(ctx context.Context, seq uint64) {
+	seqs, _ := ctx.Value(callSeqKey{}).([]*uint64)
+	for _, p := range seqs {
+		*p = seq
+	}
+}
+
+// 从 1 开始递增 与默认行为相同 可在多个客户端间共享
+type MonotonicGenerator struct {
+	last uint64
+}
+
+func (g *MonotonicGenerator) Next() uint64 {
+	return atomic.AddUint64(&g.last, 1)
+}
+
+// 对随机生成的 UUID v4 做 fnv64 摘要
+// 128 位压缩到 64 位 冲突的概率降低但不为零 约 6 亿个编号后出现冲突的概率为 1%
+type UUIDGenerator struct{}
+
+func (UUIDGenerator) Next() uint64 {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		panic("rpc client: read random bytes: " + err.Error())
+	}
+	u[6] = u[6]&0x0f | 0x40 // 版本 4
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 变体
+	h := fnv.New64a()
+	_, _ = h.Write(u[:])
+	return h.Sum64()
+}
+
+// Snowflake 编号的布局 自 snowflakeEpoch 起的毫秒数 | 机器号 | 毫秒内序号
+const (
+	snowflakeMachineBits  = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxMachine   = 1<<snowflakeMachineBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+var snowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type snowflakeGenerator struct {
+	mu      sync.Mutex
+	machine uint64
+	lastMs  int64
+	seq     uint64
+}
+
+// Twitter Snowflake 风格的编号 41 位毫秒时间戳 10 位机器号 12 位序号
+// 机器号只取低 10 位 不同机器需使用不同的机器号 每毫秒最多 4096 个 用完后等待下一毫秒
+func SnowflakeGenerator(machineID uint16) SequenceGenerator {
+	return &snowflakeGenerator{machine: uint64(machineID) & snowflakeMaxMachine}
+}
+
+func (g *snowflakeGenerator) Next() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Since(snowflakeEpoch).Milliseconds()
+	if now < g.lastMs {
+		// 时钟回拨 沿用上一次的时间戳 保证编号递增
+		now = g.lastMs
+	}
+	if now == g.lastMs {
+		g.seq = (g.seq + 1) & snowflakeMaxSequence
+		if g.seq == 0 {
+			for now <= g.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Since(snowflakeEpoch).Milliseconds()
+			}
+		}
+	} else {
+		g.seq = 0
+	}
+	g.lastMs = now
+	return uint64(now)<<(snowflakeMachineBits+snowflakeSequenceBits) | g.machine<<snowflakeSequenceBits | g.seq
+}
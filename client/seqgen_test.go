@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSequenceGenerator_NoDuplicates(t *testing.T) {
+	const n = 1000000
+	for name, gen := range map[string]SequenceGenerator{
+		"monotonic": new(MonotonicGenerator),
+		"uuid":      UUIDGenerator{},
+		"snowflake": SnowflakeGenerator(7),
+	} {
+		seen := make(map[uint64]struct{}, n)
+		var last uint64
+		for i := 0; i < n; i++ {
+			id := gen.Next()
+			_, dup := seen[id]
+			_assert(!dup, "%s: duplicate id %d after %d ids", name, id, i)
+			seen[id] = struct{}{}
+			if name != "uuid" {
+				_assert(id > last, "%s: id %d not increasing after %d", name, id, last)
+			}
+			last = id
+		}
+	}
+}
+
+func TestSnowflakeGenerator_Layout(t *testing.T) {
+	id := SnowflakeGenerator(0x3ff + 1 + 5).Next()
+	// 机器号只取低 10 位
+	_assert(id>>snowflakeSequenceBits&snowflakeMaxMachine == 5, "unexpected machine id in %x", id)
+	ms := int64(id >> (snowflakeMachineBits + snowflakeSequenceBits))
+	at := snowflakeEpoch.Add(time.Duration(ms) * time.Millisecond)
+	_assert(time.Since(at) < time.Second, "unexpected timestamp %v", at)
+}
+
+// 生成器的编号用作请求编号
+type fixedGenerator struct {
+	ids []uint64
+}
+
+func (g *fixedGenerator) Next() uint64 {
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id
+}
+
+func TestClient_SetSequenceGenerator(t *testing.T) {
+	var s Sleeper
+	addr := startTestServer(t, &s)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	client.SetSequenceGenerator(&fixedGenerator{ids: []uint64{42, 1 << 60}})
+	var r1, r2 time.Duration
+	slow := client.Go("Sleeper.Sleep", 50*time.Millisecond, &r1, nil)
+	fast := client.Go("Sleeper.Sleep", time.Millisecond, &r2, nil)
+	_assert(slow.Seq == 42 && fast.Seq == 1<<60, "unexpected seqs %d %d", slow.Seq, fast.Seq)
+	_assert((<-fast.Done).Error == nil && r2 == time.Millisecond, "fast call failed")
+	_assert((<-slow.Done).Error == nil && r1 == 50*time.Millisecond, "slow call failed")
+
+	// 0 留给关闭通知 不会发送
+	client.SetSequenceGenerator(&fixedGenerator{ids: []uint64{0}})
+	var reply time.Duration
+	err = client.Call(context.Background(), "Sleeper.Sleep", time.Duration(0), &reply)
+	_assert(errors.Is(err, ErrDuplicateSeq), "expect ErrDuplicateSeq for seq 0, got %v", err)
+
+	client.SetSequenceGenerator(nil)
+	_assert(client.Call(context.Background(), "Sleeper.Sleep", time.Duration(0), &reply) == nil, "call with default seq failed")
+}
+
+// 高 16 位为进程号 低位递增 不同进程的编号不会相同
+type workerGenerator struct {
+	worker uint64
+	n      uint64
+}
+
+func (g *workerGenerator) Next() uint64 {
+	g.n++
+	return g.worker<<48 | g.n
+}
+
+// 总是返回同一个编号 记录被调用的次数
+type collidingGenerator struct {
+	calls int32
+}
+
+func (g *collidingGenerator) Next() uint64 {
+	atomic.AddInt32(&g.calls, 1)
+	return 7
+}
+
+func TestClient_WithSequenceGenerator(t *testing.T) {
+	var s Sleeper
+	addr := startTestServer(t, &s)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	client.Apply(WithSequenceGenerator(&workerGenerator{worker: 3}))
+
+	var seq uint64
+	var reply time.Duration
+	err = client.Call(WithCallSeq(context.Background(), &seq), "Sleeper.Sleep", time.Duration(0), &reply)
+	_assert(err == nil, "call error: %v", err)
+	_assert(seq == 3<<48|1, "unexpected seq %x", seq)
+}
+
+func TestClient_DuplicateSeq(t *testing.T) {
+	var s Sleeper
+	addr := startTestServer(t, &s)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	gen := &collidingGenerator{}
+	client.Apply(WithSequenceGenerator(gen))
+
+	var r1 time.Duration
+	slow := client.Go("Sleeper.Sleep", 50*time.Millisecond, &r1, nil)
+	_assert(slow.Seq == 7, "unexpected seq %d", slow.Seq)
+
+	// 编号 7 仍在等待响应 第二个调用不重新获取编号 直接失败
+	var seq uint64
+	var r2 time.Duration
+	err = client.Call(WithCallSeq(context.Background(), &seq), "Sleeper.Sleep", time.Duration(0), &r2)
+	_assert(errors.Is(err, ErrDuplicateSeq), "expect ErrDuplicateSeq, got %v", err)
+	_assert(seq == 0, "rejected call got seq %d", seq)
+	_assert(atomic.LoadInt32(&gen.calls) == 2, "generator called %d times", gen.calls)
+	_assert((<-slow.Done).Error == nil && r1 == 50*time.Millisecond, "first call failed")
+
+	// 之前的调用完成后编号可以再次使用
+	_assert(client.Call(context.Background(), "Sleeper.Sleep", time.Duration(0), &r2) == nil, "call after release failed")
+}
+
+func TestWithCallSeq_Nested(t *testing.T) {
+	var outer, inner uint64
+	ctx := WithCallSeq(WithCallSeq(context.Background(), &outer), &inner)
+	recordCallSeq(ctx, 42)
+	_assert(outer == 42 && inner == 42, "unexpected seqs %d %d", outer, inner)
+}
@@ -0,0 +1,11 @@
+package client
+
+import "time"
+
+// 单次读写超过阈值时通过 logger.Default 输出警告 立即生效 <= 0 表示不监控该方向
+// 只对 NewClient 建立的连接有效 默认不监控
+func (client *Client) SetSlowConnThreshold(read, write time.Duration) {
+	if client.slowConn != nil {
+		client.slowConn.SetThresholds(read, write)
+	}
+}
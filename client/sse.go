@@ -0,0 +1,148 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmrpc/rpcerr"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/*
+订阅 Server.SSEHandler 推送的流式结果 不使用 RPC 连接 每次订阅是一个 HTTP 请求 使用 SetSSEClient 设置的 http.Client
+通道中依次为每个事件的结果 (json 解码为 interface{}) 读取出错时最后一个元素为 *rpcerr.RPCError
+连接意外断开时最后一个元素为 ErrSSEInterrupted 方法正常结束或订阅被取消时直接关闭通道
+*/
+
+var ErrSSEInterrupted = errors.New("rpc client: sse stream interrupted")
+
+// 订阅使用的 http.Client 为 nil 时使用 http.DefaultClient
+func (client *Client) SetSSEClient(hc *http.Client) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.httpClient = hc
+}
+
+func (client *Client) sseClient() *http.Client {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.httpClient == nil {
+		return http.DefaultClient
+	}
+	return client.httpClient
+}
+
+func (client *Client) SubscribeSSE(url string, method string, args interface{}) (<-chan interface{}, error) {
+	return client.SubscribeSSEContext(context.Background(), url, method, args)
+}
+
+// ctx 结束时断开订阅 服务端的 ctx 随之取消
+func (client *Client) SubscribeSSEContext(ctx context.Context, rawURL string, method string, args interface{}) (<-chan interface{}, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("method", method)
+	if args != nil {
+		data, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+		q.Set("args", string(data))
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := client.sseClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer func() { _ = resp.Body.Close() }()
+		var e rpcerr.RPCError
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &e) == nil && e.Message != "" {
+			return nil, &e
+		}
+		return nil, fmt.Errorf("rpc client: unexpected sse response %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	ch := make(chan interface{})
+	go readSSE(ctx, resp.Body, ch)
+	return ch, nil
+}
+
+func readSSE(ctx context.Context, body io.ReadCloser, ch chan<- interface{}) {
+	defer close(ch)
+	defer func() { _ = body.Close() }()
+	send := func(v interface{}) bool {
+		select {
+		case ch <- v:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	r := bufio.NewReader(body)
+	var event string
+	var data []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if ctx.Err() == nil {
+				send(ErrSSEInterrupted)
+			}
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				data = append(data, value)
+			}
+			// 注释 (以 : 开头) 与 id retry 字段忽略
+			continue
+		}
+		if len(data) == 0 {
+			event = ""
+			continue
+		}
+		payload := []byte(strings.Join(data, "\n"))
+		switch event {
+		case "end":
+			return
+		case "error":
+			e := &rpcerr.RPCError{}
+			if err := json.Unmarshal(payload, e); err != nil {
+				e = rpcerr.Errorf(rpcerr.Unknown, "rpc client: invalid sse error event: %v", err)
+			}
+			send(e)
+			return
+		default:
+			var v interface{}
+			if err := json.Unmarshal(payload, &v); err != nil {
+				send(fmt.Errorf("rpc client: invalid sse event: %w", err))
+				return
+			}
+			if !send(v) {
+				return
+			}
+		}
+		event, data = "", nil
+	}
+}
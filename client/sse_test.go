@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Ticker struct{}
+
+type TickArgs struct {
+	N int
+}
+
+type Tick struct {
+	I int
+}
+
+// 每个结果一行 json
+func (Ticker) Count(args TickArgs, reply *StreamingArg) error {
+	if args.N < 0 {
+		return rpcerr.New(rpcerr.InvalidArgs, "negative count")
+	}
+	r, w := io.Pipe()
+	go func() {
+		enc := json.NewEncoder(w)
+		for i := 1; i <= args.N; i++ {
+			if enc.Encode(Tick{I: i}) != nil {
+				return
+			}
+		}
+		_ = w.Close()
+	}()
+	reply.Reader = r
+	return nil
+}
+
+// 订阅方断开后写入失败 协程退出
+func (Ticker) Forever(args int, reply *StreamingArg) error {
+	r, w := io.Pipe()
+	go func() {
+		for {
+			if _, err := fmt.Fprintf(w, "%d\n", args); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	reply.Reader = r
+	return nil
+}
+
+// 记录请求数的 RoundTripper
+type countingTransport struct {
+	n int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.n, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClient_SubscribeSSE(t *testing.T) {
+	s := server.NewServer()
+	_ = s.Register(Ticker{})
+	hs := httptest.NewServer(s.SSEHandler())
+	defer hs.Close()
+	client, err := Dial("tcp", startTestServer(t))
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	var transport countingTransport
+	client.SetSSEClient(&http.Client{Transport: &transport})
+
+	ch, err := client.SubscribeSSE(hs.URL, "Ticker.Count", TickArgs{N: 3})
+	_assert(err == nil, "subscribe error: %v", err)
+	var got []interface{}
+	for v := range ch {
+		got = append(got, v)
+	}
+	_assert(len(got) == 3, "expect 3 events, got %v", got)
+	for i, v := range got {
+		m, ok := v.(map[string]interface{})
+		_assert(ok && m["I"] == float64(i+1), "unexpected event %d: %v", i, v)
+	}
+	_assert(atomic.LoadInt32(&transport.n) == 1, "expect the injected http client to be used")
+
+	// 订阅开始前的错误
+	_, err = client.SubscribeSSE(hs.URL, "Ticker.Count", TickArgs{N: -1})
+	_assert(rpcerr.CodeOf(err) == rpcerr.InvalidArgs, "expect InvalidArgs, got %v", err)
+	_, err = client.SubscribeSSE(hs.URL, "Ticker.Missing", nil)
+	_assert(rpcerr.CodeOf(err) == rpcerr.NotFound, "expect NotFound, got %v", err)
+
+	// 取消订阅后通道关闭
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err = client.SubscribeSSEContext(ctx, hs.URL, "Ticker.Forever", 7)
+	_assert(err == nil, "subscribe error: %v", err)
+	_assert(<-ch == float64(7), "unexpected first event")
+	cancel()
+	for v := range ch {
+		err, _ := v.(error)
+		_assert(!errors.Is(err, ErrSSEInterrupted), "canceled stream should not report an interruption")
+	}
+}
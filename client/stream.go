@@ -0,0 +1,54 @@
+package client
+
+import (
+	"errors"
+	"gmrpc/codec"
+	"io"
+)
+
+/*
+流式调用 参数为 StreamingArg 时分块发送 Reader 中的数据
+结果为 *StreamingArg 时 Reader 直接读取连接上的数据 读完或关闭之前该连接上的其他响应都会等待
+*/
+
+type StreamingArg = codec.StreamingArg
+
+// 异步发送 r 中的全部数据 发送完成后关闭 r 结果被丢弃 通过 Done 获取调用结果
+func (client *Client) NewStreamingCall(serviceMethod string, r io.ReadCloser) *Call {
+	call := newCall(serviceMethod, StreamingArg{Reader: r}, nil, nil)
+	go client.send(call)
+	return call
+}
+
+func streamingArg(args interface{}) (io.ReadCloser, bool) {
+	switch a := args.(type) {
+	case StreamingArg:
+		return &a, true
+	case *StreamingArg:
+		return a, a != nil
+	}
+	return nil, false
+}
+
+var errUnexpectedStream = errors.New("rpc client: unexpected stream response")
+
+// 读取流式响应 在流结束前阻塞接收循环
+func (client *Client) receiveStream(call *Call) error {
+	sr := codec.NewStreamReader(client.cc)
+	if call == nil {
+		return sr.Close()
+	}
+	reply, ok := call.Reply.(*StreamingArg)
+	if !ok {
+		call.Error = errUnexpectedStream
+		call.done()
+		return sr.Close()
+	}
+	reply.Reader = sr
+	call.done()
+	<-sr.Done()
+	if err := sr.Err(); err != io.EOF {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+type UploadResult struct {
+	Size int64
+	Sum  []byte
+}
+
+type Files int
+
+func (f Files) Upload(arg StreamingArg, reply *UploadResult) error {
+	h := sha256.New()
+	n, err := io.Copy(h, arg.Reader)
+	reply.Size, reply.Sum = n, h.Sum(nil)
+	return err
+}
+
+func (f Files) Download(size int64, reply *StreamingArg) error {
+	reply.Reader = io.NopCloser(io.LimitReader(rand.New(rand.NewSource(size)), size))
+	return nil
+}
+
+func TestClient_Streaming(t *testing.T) {
+	var f Files
+	addr := startTestServer(t, &f)
+
+	for _, tc := range []struct {
+		name string
+		opt  *server.Option
+		size int64
+	}{
+		{"gob", &server.Option{CodecType: codec.GobType}, 100 << 20},
+		{"json", &server.Option{CodecType: codec.JsonType}, 4 << 20},
+		{"binary header", &server.Option{CodecType: codec.GobType, HeaderType: codec.BinaryHeader}, 4 << 20},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := Dial("tcp", addr, tc.opt)
+			_assert(err == nil, "dial error: %v", err)
+			defer func() { _ = client.Close() }()
+
+			// 上传 数据边生成边计算摘要 不整体放入内存
+			h := sha256.New()
+			src := io.TeeReader(io.LimitReader(rand.New(rand.NewSource(1)), tc.size), h)
+			var res UploadResult
+			err = client.Call(context.Background(), "Files.Upload", StreamingArg{Reader: io.NopCloser(src)}, &res)
+			_assert(err == nil, "upload error: %v", err)
+			_assert(res.Size == tc.size && bytes.Equal(res.Sum, h.Sum(nil)), "expect %d bytes uploaded, got %d", tc.size, res.Size)
+
+			// 下载
+			var reply StreamingArg
+			err = client.Call(context.Background(), "Files.Download", tc.size, &reply)
+			_assert(err == nil, "download error: %v", err)
+			h.Reset()
+			n, err := io.Copy(h, reply.Reader)
+			_ = reply.Close()
+			want := sha256.New()
+			_, _ = io.Copy(want, io.LimitReader(rand.New(rand.NewSource(tc.size)), tc.size))
+			_assert(err == nil && n == tc.size && bytes.Equal(h.Sum(nil), want.Sum(nil)), "expect %d bytes downloaded, got %d (%v)", tc.size, n, err)
+
+			// 流结束后连接仍然可用
+			call := client.NewStreamingCall("Files.Upload", io.NopCloser(bytes.NewReader([]byte("small"))))
+			<-call.Done
+			_assert(call.Error == nil, "streaming call error: %v", call.Error)
+
+			err = client.Call(context.Background(), "Files.Upload", 1, &res)
+			_assert(rpcerr.CodeOf(err) == rpcerr.InvalidArgs, "expect stream mismatch error, got %v", err)
+			_ = client.Call(context.Background(), "Files.Download", int64(0), &reply)
+			_ = reply.Close()
+			_assert(client.IsAvailable(), "connection should stay available")
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"testing"
+)
+
+type Point struct{ X, Y int }
+
+type AddArgs struct {
+	Num1, Num2 int
+	Origin     Point
+}
+
+type Calc int
+
+func (c Calc) Add(args AddArgs, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func TestClient_StrictDecoding(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+
+	assertInvalid := func(err error, field string) {
+		e, ok := rpcerr.FromError(err)
+		_assert(ok, "expect structured error, got %v", err)
+		_assert(e.Code == rpcerr.InvalidArgs, "expect InvalidArgs, got %s", e.Code)
+		_assert(e.Detail(rpcerr.DetailField) == field, "expect field %q, got %q", field, e.Detail(rpcerr.DetailField))
+	}
+
+	t.Run("json unknown field", func(t *testing.T) {
+		client, _ := Dial("tcp", addr, &server.Option{CodecType: codec.JsonType, StrictDecoding: true})
+		defer func() { _ = client.Close() }()
+
+		var reply int
+		args := map[string]interface{}{"Num1": 1, "Nmu2": 2}
+		assertInvalid(client.Call(context.Background(), "Calc.Add", args, &reply), "Nmu2")
+
+		args = map[string]interface{}{"Num1": 1, "Origin": map[string]int{"X": 1, "Z": 2}}
+		assertInvalid(client.Call(context.Background(), "Calc.Add", args, &reply), "Origin.Z")
+
+		// 连接在参数错误后仍然可用
+		err := client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "expect 3, got %d (%v)", reply, err)
+	})
+
+	t.Run("json type mismatch", func(t *testing.T) {
+		client, _ := Dial("tcp", addr, &server.Option{CodecType: codec.JsonType})
+		defer func() { _ = client.Close() }()
+
+		var reply int
+		args := map[string]interface{}{"Num1": 1, "Origin": map[string]string{"X": "one"}}
+		assertInvalid(client.Call(context.Background(), "Calc.Add", args, &reply), "Origin.X")
+	})
+
+	t.Run("json lenient by default", func(t *testing.T) {
+		client, _ := Dial("tcp", addr, &server.Option{CodecType: codec.JsonType})
+		defer func() { _ = client.Close() }()
+
+		var reply int
+		err := client.Call(context.Background(), "Calc.Add", map[string]int{"Num1": 1, "Nmu2": 2}, &reply)
+		_assert(err == nil && reply == 1, "expect unknown field to be dropped, got %d (%v)", reply, err)
+	})
+
+	t.Run("gob type mismatch", func(t *testing.T) {
+		client, _ := Dial("tcp", addr, &server.Option{CodecType: codec.GobType, StrictDecoding: true})
+		defer func() { _ = client.Close() }()
+
+		type Typo struct{ Nmu1, Nmu2 int }
+		var reply int
+		assertInvalid(client.Call(context.Background(), "Calc.Add", Typo{1, 2}, &reply), "")
+
+		err := client.Call(context.Background(), "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "expect 3, got %d (%v)", reply, err)
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		client, _ := Dial("tcp", addr)
+		defer func() { _ = client.Close() }()
+
+		var reply int
+		err := client.Call(context.Background(), "Calc.Sub", AddArgs{}, &reply)
+		_assert(rpcerr.CodeOf(err) == rpcerr.NotFound, "expect NotFound, got %v", err)
+		_assert(client.IsAvailable(), "connection should stay available")
+	})
+}
@@ -0,0 +1,22 @@
+// 供 TestClient_VetCopy 使用 复制 Client Server 与 XClient 的值应被 go vet 报告
+package copyclient
+
+import (
+	"gmrpc/client"
+	"gmrpc/server"
+	"gmrpc/xclient"
+)
+
+func copyClient(c *client.Client) {
+	shadow := *c
+	_ = shadow.Close()
+}
+
+func copyServer(s *server.Server) server.Server {
+	return *s
+}
+
+func copyXClient(xc *xclient.XClient) {
+	shadow := *xc
+	_ = shadow.Close()
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"testing"
+	"time"
+)
+
+func TestClient_InvalidServiceMethod(t *testing.T) {
+	var c Calc
+	addr := startTestServer(t, &c)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	for _, m := range []string{"", "NoDot", ".Add", "Calc.", "Calc.Ad\x00d", "Calc\n.Add"} {
+		var reply int
+		err := client.Call(context.Background(), m, AddArgs{}, &reply)
+		e, ok := rpcerr.FromError(err)
+		_assert(ok && e.Code == rpcerr.InvalidArgs, "%q: expect invalid args, got %v", m, err)
+		call := <-client.Go(m, AddArgs{}, &reply, nil).Done
+		e, ok = rpcerr.FromError(call.Error)
+		_assert(ok && e.Code == rpcerr.InvalidArgs, "%q: expect invalid args from Go, got %v", m, call.Error)
+	}
+	_assert(client.Stats().Seq == 1, "invalid calls should not be sent, seq %d", client.Stats().Seq)
+}
+
+// 调用被取消后服务端的处理上下文被取消
+// 超时会把剩余时间传给服务端 由服务端自己的截止时间结束 见 deadline_test.go 这里只测试取消
+func TestClient_CancelRemote(t *testing.T) {
+	canceled := make(chan error, 1)
+	s := server.NewServer()
+	_ = s.Register(new(Calc))
+	s.Use(func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		select {
+		case <-ctx.Done():
+			canceled <- ctx.Err()
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+			canceled <- nil
+			return handler(ctx, argv, replyv)
+		}
+	})
+	client, err := Dial("tcp", serveTest(t, s))
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	timer := time.AfterFunc(50*time.Millisecond, cancel)
+	defer timer.Stop()
+	var reply int
+	_assert(client.Call(ctx, "Calc.Add", AddArgs{Num1: 1, Num2: 2}, &reply) != nil, "expect cancellation")
+	select {
+	case err := <-canceled:
+		_assert(err == context.Canceled, "expect server context to be canceled, got %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("server handler was not canceled")
+	}
+}
@@ -0,0 +1,236 @@
+//go:build js && wasm
+
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"io"
+	"net"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// 连接 wsURL 例如 ws://host:port/_gmrpc_ws_ 只能使用 json 编码 未指定编码时使用 json
+func DialWebAssembly(wsURL string, opts ...*server.Option) (*client.Client, error) {
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialWebSocket(wsURL, opt.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c, err := client.NewClient(conn, opt)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func parseOptions(opts ...*server.Option) (*server.Option, error) {
+	if len(opts) > 1 {
+		return nil, errors.New("rpc client: number of options is more than 1")
+	}
+	opt := *server.DefaultJsonOption
+	if len(opts) == 1 && opts[0] != nil {
+		opt = *opts[0]
+		opt.MagicNumber = server.MagicNumber
+		if opt.CodecType == "" {
+			opt.CodecType = codec.JsonType
+		}
+	}
+	if opt.CodecType != codec.JsonType {
+		return nil, fmt.Errorf("rpc client: webassembly client only supports %s, got %s", codec.JsonType, opt.CodecType)
+	}
+	return &opt, nil
+}
+
+// 以浏览器的 WebSocket 实现的 net.Conn 收到的消息依次拼接为字节流
+type wsConn struct {
+	ws  js.Value
+	url string
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	buf      []byte
+	err      error     // 连接关闭或出错后 读完 buf 返回该错误
+	deadline time.Time // 读取的截止时间
+	timer    *time.Timer
+
+	listeners []listener // 关闭时移除并释放
+}
+
+type listener struct {
+	event string
+	fn    js.Func
+}
+
+var errDeadline = errors.New("rpc client: websocket read deadline exceeded")
+
+func dialWebSocket(url string, timeout time.Duration) (*wsConn, error) {
+	ctor := js.Global().Get("WebSocket")
+	if ctor.IsUndefined() {
+		return nil, errors.New("rpc client: WebSocket is not available")
+	}
+	c := &wsConn{url: url}
+	c.cond = sync.NewCond(&c.mu)
+	c.ws = ctor.New(url)
+	c.ws.Set("binaryType", "arraybuffer")
+
+	opened := make(chan error, 1)
+	c.on("open", func(js.Value) {
+		select {
+		case opened <- nil:
+		default:
+		}
+	})
+	c.on("error", func(js.Value) {
+		err := fmt.Errorf("rpc client: websocket %s error", url)
+		select {
+		case opened <- err:
+		default:
+		}
+		c.fail(err)
+	})
+	c.on("close", func(js.Value) {
+		select {
+		case opened <- fmt.Errorf("rpc client: websocket %s closed", url):
+		default:
+		}
+		c.fail(io.EOF)
+	})
+	c.on("message", func(ev js.Value) {
+		data := js.Global().Get("Uint8Array").New(ev.Get("data"))
+		b := make([]byte, data.Length())
+		js.CopyBytesToGo(b, data)
+		c.mu.Lock()
+		c.buf = append(c.buf, b...)
+		c.mu.Unlock()
+		c.cond.Broadcast()
+	})
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timeoutCh = t.C
+	}
+	select {
+	case err := <-opened:
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	case <-timeoutCh:
+		_ = c.Close()
+		return nil, fmt.Errorf("rpc client: connect timeout: expect within %s", timeout)
+	}
+	return c, nil
+}
+
+func (c *wsConn) on(event string, fn func(js.Value)) {
+	f := js.FuncOf(func(this js.Value, args []js.Value) any {
+		fn(args[0])
+		return nil
+	})
+	c.listeners = append(c.listeners, listener{event, f})
+	c.ws.Call("addEventListener", event, f)
+}
+
+func (c *wsConn) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.buf) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		if !c.deadline.IsZero() && !time.Now().Before(c.deadline) {
+			return 0, errDeadline
+		}
+		c.cond.Wait()
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// 发送一条二进制消息 浏览器负责缓冲
+func (c *wsConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	data := js.Global().Get("Uint8Array").New(len(p))
+	js.CopyBytesToJS(data, p)
+	c.ws.Call("send", data)
+	return len(p), nil
+}
+
+func (c *wsConn) Close() error {
+	c.fail(net.ErrClosed)
+	c.ws.Call("close")
+	c.mu.Lock()
+	listeners := c.listeners
+	c.listeners = nil
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.mu.Unlock()
+	// 关闭事件稍后才到达 先移除监听再释放回调
+	for _, l := range listeners {
+		c.ws.Call("removeEventListener", l.event, l.fn)
+		l.fn.Release()
+	}
+	return nil
+}
+
+func (c *wsConn) LocalAddr() net.Addr  { return wsAddr("local") }
+func (c *wsConn) RemoteAddr() net.Addr { return wsAddr(c.url) }
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// 截止时间到达时唤醒等待中的 Read
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if !t.IsZero() {
+		c.timer = time.AfterFunc(time.Until(t), c.cond.Broadcast)
+	}
+	return nil
+}
+
+// 写入不会阻塞 不支持写截止时间
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type wsAddr string
+
+func (a wsAddr) Network() string { return "websocket" }
+func (a wsAddr) String() string  { return string(a) }
+
+var _ net.Conn = (*wsConn)(nil)
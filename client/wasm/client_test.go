@@ -0,0 +1,72 @@
+//go:build js && wasm
+
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Args struct{ A, B int }
+
+// 服务端由 testdata/harness.js 启动 地址通过环境变量传入
+func wsURL(t *testing.T) string {
+	url := os.Getenv("RPC_WS_URL")
+	if url == "" {
+		t.Skip("RPC_WS_URL not set, run testdata/harness.js")
+	}
+	return url
+}
+
+func TestDialWebAssembly(t *testing.T) {
+	c, err := DialWebAssembly(wsURL(t))
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = c.Close() }()
+
+	var sum int
+	_assert(c.Call(context.Background(), "Arith.Add", Args{1, 2}, &sum) == nil && sum == 3, "Arith.Add failed")
+
+	var quo int
+	call := c.Go("Arith.Divide", Args{9, 3}, &quo, nil)
+	_assert((<-call.Done).Error == nil && quo == 3, "Arith.Divide failed")
+
+	err = c.Call(context.Background(), "Arith.Divide", Args{1, 0}, &quo)
+	_assert(err != nil && strings.Contains(err.Error(), "divide by zero"), "expect handler error, got %v", err)
+	_assert(c.HasMethod("Arith.Add"), "capabilities not received")
+
+	// 并发调用共享同一个 WebSocket
+	calls := make([]*int, 20)
+	done := make(chan error, len(calls))
+	for i := range calls {
+		calls[i] = new(int)
+		go func(i int) {
+			done <- c.Call(context.Background(), "Arith.Add", Args{i, i}, calls[i])
+		}(i)
+	}
+	for range calls {
+		_assert(<-done == nil, "concurrent call failed")
+	}
+	for i, r := range calls {
+		_assert(*r == 2*i, "call %d: unexpected reply %d", i, *r)
+	}
+}
+
+func TestDialWebAssembly_Errors(t *testing.T) {
+	_, err := DialWebAssembly("ws://127.0.0.1:1/", &server.Option{CodecType: codec.GobType})
+	_assert(err != nil && strings.Contains(err.Error(), "only supports"), "expect codec error, got %v", err)
+
+	_, err = DialWebAssembly("ws://127.0.0.1:1/", &server.Option{ConnectTimeout: time.Second})
+	_assert(err != nil, "expect dial error")
+}
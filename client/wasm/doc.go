@@ -0,0 +1,14 @@
+/*
+Package wasm 在浏览器中使用的客户端 以 WebSocket 代替 TCP 连接 只能编译为 WebAssembly
+
+	GOOS=js GOARCH=wasm go build -o app.wasm ./yourapp
+
+页面通过 $(go env GOROOT)/lib/wasm/wasm_exec.js 加载 app.wasm
+服务端以 Server.WebSocketHandler 接受连接 只支持 json 编码 便于在浏览器中查看
+DialWebAssembly 返回的 *client.Client 与 TCP 连接的客户端用法相同
+
+testdata/harness.js 在 node 中运行本包的测试 需要 go 与 node 20 以上
+
+	node client/wasm/testdata/harness.js
+*/
+package wasm
@@ -0,0 +1,76 @@
+#!/usr/bin/env node
+// 在 node 中运行 client/wasm 的测试
+// 先编译 testdata/server 与 js/wasm 的测试程序 启动服务端后以 RPC_WS_URL 传入地址 退出码与测试一致
+// 用法: node client/wasm/testdata/harness.js [-test.run=...]
+"use strict";
+
+const { execFileSync, spawn } = require("child_process");
+const fs = require("fs");
+const os = require("os");
+const path = require("path");
+const readline = require("readline");
+
+const pkgDir = path.resolve(__dirname, "..");
+const tmp = fs.mkdtempSync(path.join(os.tmpdir(), "gmrpc-wasm-"));
+const serverBin = path.join(tmp, "server");
+const testWasm = path.join(tmp, "wasm.test");
+
+function go(args, env) {
+  execFileSync("go", args, { cwd: pkgDir, env: { ...process.env, ...env }, stdio: "inherit" });
+}
+
+// go 1.24 起 wasm_exec 位于 lib/wasm 之前在 misc/wasm
+function wasmExec() {
+  const goroot = execFileSync("go", ["env", "GOROOT"]).toString().trim();
+  for (const dir of ["lib/wasm", "misc/wasm"]) {
+    const file = path.join(goroot, dir, "wasm_exec_node.js");
+    if (fs.existsSync(file)) {
+      return file;
+    }
+  }
+  throw new Error("wasm_exec_node.js not found in " + goroot);
+}
+
+function startServer() {
+  const srv = spawn(serverBin, [], { stdio: ["ignore", "pipe", "inherit"] });
+  return new Promise((resolve, reject) => {
+    srv.on("error", reject);
+    srv.on("exit", (code) => reject(new Error("server exited with code " + code)));
+    readline.createInterface({ input: srv.stdout }).once("line", (url) => resolve({ srv, url }));
+  });
+}
+
+function runTests(url) {
+  // node 22 之前 WebSocket 需要开启实验特性
+  const flags = typeof WebSocket === "undefined" ? ["--experimental-websocket"] : [];
+  const args = [...flags, "--stack-size=8192", wasmExec(), testWasm, "-test.v", ...process.argv.slice(2)];
+  const child = spawn(process.execPath, args, {
+    env: { ...process.env, RPC_WS_URL: url },
+    stdio: "inherit",
+  });
+  return new Promise((resolve) => child.on("exit", (code) => resolve(code ?? 1)));
+}
+
+async function main() {
+  go(["build", "-o", serverBin, "./testdata/server"]);
+  go(["test", "-c", "-o", testWasm, "."], { GOOS: "js", GOARCH: "wasm" });
+  const { srv, url } = await startServer();
+  srv.removeAllListeners("exit");
+  console.log("rpc server listening on " + url);
+  try {
+    return await runTests(url);
+  } finally {
+    srv.kill();
+  }
+}
+
+main()
+  .then((code) => {
+    fs.rmSync(tmp, { recursive: true, force: true });
+    process.exit(code);
+  })
+  .catch((err) => {
+    console.error(err);
+    fs.rmSync(tmp, { recursive: true, force: true });
+    process.exit(1);
+  });
@@ -0,0 +1,45 @@
+// harness.js 启动的服务端 在随机端口上接受 WebSocket 连接 第一行输出地址
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gmrpc/server"
+	"net"
+	"net/http"
+	"os"
+)
+
+type Arith struct{}
+
+type Args struct{ A, B int }
+
+func (Arith) Add(args Args, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (Arith) Divide(args Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func main() {
+	s := server.NewServer()
+	if err := s.Register(Arith{}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("ws://%s%s\n", l.Addr(), server.WebSocketPath)
+	mux := http.NewServeMux()
+	mux.Handle(server.WebSocketPath, s.WebSocketHandler())
+	_ = http.Serve(l, mux)
+}
@@ -0,0 +1,205 @@
+package main
+
+/*
+rpcbench 对运行 Bench 服务的服务端发起压测 输出吞吐量与延迟分位数
+不指定 -addr 时在进程内启动服务端 可作为冒烟测试
+
+	go run ./cmd/rpcbench -addr 127.0.0.1:9999 -c 64 -conns 4 -size 1024 -codec json -d 10s
+*/
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type config struct {
+	network     string
+	addr        string
+	method      string // echo sum payload
+	codec       string // gob json
+	concurrency int
+	conns       int
+	size        int
+	duration    time.Duration
+}
+
+type result struct {
+	calls     int
+	errors    int
+	elapsed   time.Duration
+	latencies []time.Duration // 成功调用的耗时 升序
+}
+
+func (r *result) throughput() float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(r.calls) / r.elapsed.Seconds()
+}
+
+func (r *result) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(r.latencies)-1))
+	return r.latencies[i]
+}
+
+func (r *result) report(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "calls %d  errors %d  elapsed %v  %.0f calls/s\n", r.calls, r.errors, r.elapsed.Round(time.Millisecond), r.throughput())
+	_, _ = fmt.Fprintf(w, "p50 %v  p90 %v  p99 %v  p999 %v  max %v\n",
+		r.percentile(0.5), r.percentile(0.9), r.percentile(0.99), r.percentile(0.999), r.percentile(1))
+}
+
+var codecTypes = map[string]codec.Type{
+	"gob":  codec.GobType,
+	"json": codec.JsonType,
+}
+
+// 按配置生成一次调用
+func newCall(cfg config) (string, func() interface{}, func() interface{}, error) {
+	switch cfg.method {
+	case "echo":
+		payload := make([]byte, cfg.size)
+		return "Bench.Echo", func() interface{} { return payload }, func() interface{} { return new([]byte) }, nil
+	case "sum":
+		nums := make([]int64, cfg.size)
+		for i := range nums {
+			nums[i] = int64(i)
+		}
+		return "Bench.Sum", func() interface{} { return nums }, func() interface{} { return new(int64) }, nil
+	case "payload":
+		return "Bench.Payload", func() interface{} { return cfg.size }, func() interface{} { return new([]byte) }, nil
+	}
+	return "", nil, nil, fmt.Errorf("unknown method %q", cfg.method)
+}
+
+func run(ctx context.Context, cfg config) (*result, error) {
+	ct, ok := codecTypes[cfg.codec]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %q", cfg.codec)
+	}
+	if cfg.concurrency <= 0 || cfg.conns <= 0 {
+		return nil, errors.New("concurrency and conns must be positive")
+	}
+	method, newArgs, newReply, err := newCall(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	opt := *server.DefaultOption
+	opt.CodecType = ct
+	// 调用经连接池轮询分配到 conns 个连接 与实际使用方式一致 压测前建立所有连接
+	pool, err := client.NewPool(cfg.network, cfg.addr, cfg.conns, &opt)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = pool.Close() }()
+	if err := pool.Warm(ctx, cfg.conns); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.duration)
+	defer cancel()
+
+	// 每个 worker 单独记录 结束后合并 避免争用
+	type stat struct {
+		errors    int
+		latencies []time.Duration
+		lastErr   error
+	}
+	stats := make([]stat, cfg.concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < cfg.concurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			st := &stats[w]
+			for ctx.Err() == nil {
+				begin := time.Now()
+				err := pool.Call(context.Background(), method, newArgs(), newReply())
+				if err != nil {
+					st.errors++
+					st.lastErr = err
+					continue
+				}
+				st.latencies = append(st.latencies, time.Since(begin))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	r := &result{elapsed: time.Since(start)}
+	var lastErr error
+	for _, st := range stats {
+		r.errors += st.errors
+		r.latencies = append(r.latencies, st.latencies...)
+		if st.lastErr != nil {
+			lastErr = st.lastErr
+		}
+	}
+	r.calls = len(r.latencies) + r.errors
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	if len(r.latencies) == 0 && lastErr != nil {
+		return r, lastErr
+	}
+	return r, nil
+}
+
+// 进程内启动带 Bench 服务的服务端
+func serveLocal() (string, func(), error) {
+	s := server.NewServer()
+	if err := s.RegisterBenchService(); err != nil {
+		return "", nil, err
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	go s.Accept(l)
+	return l.Addr().String(), func() { _ = l.Close() }, nil
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.network, "network", "tcp", "network of the target server")
+	flag.StringVar(&cfg.addr, "addr", "", "target server address, empty to start an in-process server")
+	flag.StringVar(&cfg.method, "method", "echo", "bench method: echo, sum or payload")
+	flag.StringVar(&cfg.codec, "codec", "gob", "codec: gob or json")
+	flag.IntVar(&cfg.concurrency, "c", 16, "number of concurrent callers")
+	flag.IntVar(&cfg.conns, "conns", 1, "size of the connection pool shared by the callers")
+	flag.IntVar(&cfg.size, "size", 128, "payload size in bytes (number of integers for sum)")
+	flag.DurationVar(&cfg.duration, "d", 10*time.Second, "bench duration")
+	flag.Parse()
+
+	log.SetFlags(0)
+	if cfg.addr == "" {
+		addr, stop, err := serveLocal()
+		if err != nil {
+			log.Fatal("rpcbench: ", err)
+		}
+		defer stop()
+		cfg.network, cfg.addr = "tcp", addr
+	}
+
+	r, err := run(context.Background(), cfg)
+	if r != nil {
+		r.report(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal("rpcbench: ", err)
+	}
+}
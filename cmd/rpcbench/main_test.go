@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	addr, stop, err := serveLocal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	for _, method := range []string{"echo", "sum", "payload"} {
+		for _, codec := range []string{"gob", "json"} {
+			cfg := config{
+				network:     "tcp",
+				addr:        addr,
+				method:      method,
+				codec:       codec,
+				concurrency: 8,
+				conns:       2,
+				size:        256,
+				duration:    100 * time.Millisecond,
+			}
+			r, err := run(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("%s/%s: %v", method, codec, err)
+			}
+			if r.calls == 0 || r.errors != 0 {
+				t.Fatalf("%s/%s: calls %d errors %d", method, codec, r.calls, r.errors)
+			}
+			if r.percentile(0.5) > r.percentile(0.99) || r.percentile(0.99) > r.percentile(1) {
+				t.Fatalf("%s/%s: percentiles out of order", method, codec)
+			}
+			var out bytes.Buffer
+			r.report(&out)
+			if !strings.Contains(out.String(), "calls/s") {
+				t.Fatalf("unexpected report %q", out.String())
+			}
+		}
+	}
+}
+
+func TestRun_InvalidConfig(t *testing.T) {
+	for _, cfg := range []config{
+		{codec: "xml", method: "echo", concurrency: 1, conns: 1},
+		{codec: "gob", method: "upload", concurrency: 1, conns: 1},
+		{codec: "gob", method: "echo", concurrency: 0, conns: 1},
+	} {
+		if _, err := run(context.Background(), cfg); err == nil {
+			t.Fatalf("expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/server"
+	"gmrpc/service"
+	"io"
+	"reflect"
+	"sync"
+)
+
+/*
+服务端请求合并 大量并发请求查询同一份数据时 (同一个用户的资料) 只执行一次处理函数
+与 singleflight 相同 只合并同时进行的调用 不缓存已完成的结果
+后来者得到结果的浅拷贝 引用类型的字段与第一个请求共享 处理函数与拦截器不应在返回后修改结果
+*/
+
+type call struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+	dups int // 等待该调用的后来者数量
+}
+
+type Coalescer struct {
+	mu      sync.Mutex // 保护 call.dups
+	pending sync.Map   // key -> *call
+}
+
+func NewCoalescer() *Coalescer {
+	return &Coalescer{}
+}
+
+// 执行 fn 相同 key 的调用进行中时等待其结果
+func (c *Coalescer) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	return c.do(context.Background(), key, fn)
+}
+
+// 等待期间 ctx 结束时返回 ctx.Err() 不影响进行中的调用
+func (c *Coalescer) do(ctx context.Context, key string, fn func() (interface{}, error)) (val interface{}, err error) {
+	cl := &call{done: make(chan struct{})}
+	if v, loaded := c.pending.LoadOrStore(key, cl); loaded {
+		cl = v.(*call)
+		c.mu.Lock()
+		cl.dups++
+		c.mu.Unlock()
+		select {
+		case <-cl.done:
+			return cl.val, cl.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			cl.val, cl.err = nil, fmt.Errorf("coalesce: panic in %s: %v", key, r)
+			val, err = cl.val, cl.err
+		}
+		c.pending.Delete(key)
+		close(cl.done)
+	}()
+	cl.val, cl.err = fn()
+	return cl.val, cl.err
+}
+
+// 等待 key 的后来者数量 没有进行中的调用时返回 0
+func (c *Coalescer) waiters(key string) int {
+	v, ok := c.pending.Load(key)
+	if !ok {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return v.(*call).dups
+}
+
+// 按 keyFn 合并相同的请求 keyFn 返回空串时不合并 键中已包含方法名
+// 流式参数或结果 以及延迟响应的方法不合并
+func NewCoalescingInterceptor(keyFn func(method string, args interface{}) string) server.ServerInterceptor {
+	return newInterceptor(NewCoalescer(), keyFn)
+}
+
+func newInterceptor(c *Coalescer, keyFn func(method string, args interface{}) string) server.ServerInterceptor {
+	return func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		if !coalescable(argv, replyv) {
+			return handler(ctx, argv, replyv)
+		}
+		k := keyFn(info.ServiceMethod, argv)
+		if k == "" {
+			return handler(ctx, argv, replyv)
+		}
+		rv := reflect.ValueOf(replyv)
+		key := info.ServiceMethod + "\x00" + k
+		for {
+			leader := false
+			val, err := c.do(ctx, key, func() (interface{}, error) {
+				leader = true
+				err := handler(ctx, argv, replyv)
+				// 返回前复制 结果实例在响应后会放回池中
+				return rv.Elem().Interface(), err
+			})
+			if leader {
+				return err
+			}
+			// 第一个请求的上下文结束导致失败 自身未结束时重新执行
+			if (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) && ctx.Err() == nil {
+				continue
+			}
+			if val != nil {
+				rv.Elem().Set(reflect.ValueOf(val))
+			}
+			return err
+		}
+	}
+}
+
+func coalescable(argv, replyv interface{}) bool {
+	switch argv.(type) {
+	case server.StreamingArg, *server.StreamingArg:
+		return false
+	}
+	switch replyv.(type) {
+	case *service.DeferredReply, io.Reader:
+		return false
+	}
+	return true
+}
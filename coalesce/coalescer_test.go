@@ -0,0 +1,122 @@
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Profile struct {
+	ID   int
+	Name string
+}
+
+// 模拟数据库 查询在 release 关闭前阻塞
+type fakeDB struct {
+	queries int64
+	release chan struct{}
+}
+
+func (db *fakeDB) query(id int) Profile {
+	atomic.AddInt64(&db.queries, 1)
+	<-db.release
+	return Profile{ID: id, Name: fmt.Sprintf("user-%d", id)}
+}
+
+type UserService struct{ db *fakeDB }
+
+func (s *UserService) GetProfile(id int, reply *Profile) error {
+	*reply = s.db.query(id)
+	return nil
+}
+
+func TestCoalescingInterceptor(t *testing.T) {
+	db := &fakeDB{release: make(chan struct{})}
+	c := NewCoalescer()
+	s := server.NewServer()
+	s.Use(newInterceptor(c, func(method string, args interface{}) string { return fmt.Sprint(args) }))
+	_ = s.Register(&UserService{db: db})
+	l, _ := net.Listen("tcp", ":0")
+	go s.Accept(l)
+	defer func() { _ = l.Close() }()
+
+	cli, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = cli.Close() }()
+
+	const n = 50
+	var wg sync.WaitGroup
+	replies := make([]Profile, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = cli.Call(context.Background(), "UserService.GetProfile", 7, &replies[i])
+		}(i)
+	}
+	// 所有请求都在等待第一次查询后再放行
+	key := "UserService.GetProfile\x007"
+	for deadline := time.Now().Add(5 * time.Second); c.waiters(key) < n-1; {
+		_assert(time.Now().Before(deadline), "only %d requests joined", c.waiters(key))
+		time.Sleep(time.Millisecond)
+	}
+	close(db.release)
+	wg.Wait()
+
+	_assert(atomic.LoadInt64(&db.queries) == 1, "expect 1 query, got %d", db.queries)
+	for i := 0; i < n; i++ {
+		_assert(errs[i] == nil && replies[i] == Profile{ID: 7, Name: "user-7"}, "unexpected reply %d: %+v (%v)", i, replies[i], errs[i])
+	}
+
+	// 不同的参数不合并 已完成的结果不缓存
+	var p Profile
+	_ = cli.Call(context.Background(), "UserService.GetProfile", 8, &p)
+	_ = cli.Call(context.Background(), "UserService.GetProfile", 7, &p)
+	_assert(atomic.LoadInt64(&db.queries) == 3 && p.ID == 7, "expect 3 queries, got %d", db.queries)
+}
+
+func TestCoalescer_Do(t *testing.T) {
+	c := NewCoalescer()
+	started, release := make(chan struct{}), make(chan struct{})
+	go func() {
+		_, _ = c.Do("k", func() (interface{}, error) {
+			close(started)
+			<-release
+			return nil, errors.New("failed")
+		})
+	}()
+	<-started
+	done := make(chan error)
+	go func() {
+		_, err := c.Do("k", func() (interface{}, error) { return "second", nil })
+		done <- err
+	}()
+	for c.waiters("k") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	_assert((<-done).Error() == "failed", "waiters should share the error")
+
+	v, err := c.Do("k", func() (interface{}, error) { panic("boom") })
+	_assert(v == nil && err != nil && c.waiters("k") == 0, "panic should be returned as error, got %v", err)
+}
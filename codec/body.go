@@ -0,0 +1,239 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+)
+
+// 消息体编解码接口 对同一连接上的数据流有状态(如 gob 只发送一次类型信息)
+type BodyCodec interface {
+	EncodeBody(body interface{}) error
+	DecodeBody(body interface{}) error // body 为空时丢弃消息体
+}
+
+// 可选接口 消息体之间共享解码状态 (如 gob 只发送一次的类型定义)
+// 分帧格式跳过这类消息体时仍需经过解码器 其他消息体直接丢弃字节
+type StatefulBody interface {
+	StatefulDecoding() bool
+}
+
+// 基于读写流创建消息体编解码器
+type NewBodyCodecFunc func(r io.Reader, w io.Writer) BodyCodec
+
+var NewBodyCodecFuncMap = map[Type]NewBodyCodecFunc{
+	GobType:  NewGobBodyCodec,
+	JsonType: NewJsonBodyCodec,
+}
+
+// 合并格式 头部与消息体依次使用同一个消息体编解码器编码 与拆分前的线上格式一致
+type combinedCodec struct {
+	conn   io.ReadWriteCloser // socket 链接实例
+	buf    *bufio.Writer      // 缓冲区 增加性能
+	body   BodyCodec
+	name   string
+	strict bool
+
+	in       *countingReader
+	bodyFrom int64 // 读完头部时已读取的字节数
+	bodySize int
+
+	out   *switchWriter // 消息体编解码器的写入目标
+	stage bytes.Buffer  // 先编码消息体 成功后再写入头部
+	limit limitWriter   // 写入 stage 时检查消息体大小
+
+	newBody NewBodyCodecFunc
+}
+
+// 累计写入超过上限时拒绝 不复制数据 编码器通常一次写入整个消息 limit <= 0 表示不限制
+type limitWriter struct {
+	w     io.Writer
+	limit int
+	n     int
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.limit > 0 && l.n+len(p) > l.limit {
+		return 0, &SizeError{Size: l.n + len(p), Limit: l.limit}
+	}
+	n, err := l.w.Write(p)
+	l.n += n
+	return n, err
+}
+
+// 可切换目标的写入器
+type switchWriter struct {
+	w io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+func NewCombinedCodec(conn io.ReadWriteCloser, name string, newBody NewBodyCodecFunc) Codec {
+	buf := bufio.NewWriter(newPoisonWriter(conn))
+	in := newCountingReader(conn)
+	out := &switchWriter{w: buf}
+	return &combinedCodec{
+		conn: conn,
+		buf:  buf,
+		body: newBody(in, out),
+		name: name,
+		in:   in,
+		out:  out,
+
+		newBody: newBody,
+	}
+}
+
+// 统计解码器读取的字节数 实现 io.ByteReader 使 gob 不再另加缓冲 计数即为实际消耗的字节数
+type countingReader struct {
+	r  io.Reader
+	br io.ByteReader
+	n  int64
+}
+
+func newCountingReader(r io.Reader) *countingReader {
+	if br, ok := r.(io.ByteReader); ok {
+		return &countingReader{r: r, br: br}
+	}
+	b := bufio.NewReader(r)
+	return &countingReader{r: b, br: b}
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.br.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// 严格模式只作用于消息体 头部始终宽松解码 以兼容新增的头部字段
+func (c *combinedCodec) decode(v interface{}, strict bool) error {
+	if sd, ok := c.body.(StrictDecoding); ok && c.strict {
+		sd.SetStrictDecoding(strict)
+	}
+	return c.body.DecodeBody(v)
+}
+
+func (c *combinedCodec) ReadHeader(h *Header) error {
+	err := c.decode(h, false)
+	c.bodyFrom = c.in.n
+	return err
+}
+
+func (c *combinedCodec) ReadBody(body interface{}) error {
+	err := c.decode(body, true)
+	c.bodySize = int(c.in.n - c.bodyFrom)
+	return err
+}
+
+// 合并格式没有长度前缀 只能由消息体编解码器读完整个消息体
+func (c *combinedCodec) SkipBody() error {
+	return c.ReadBody(nil)
+}
+
+// 消息体编解码器能给出准确大小时(如 json)优先使用
+func (c *combinedCodec) BodySize() int {
+	if bs, ok := c.body.(BodySizer); ok {
+		return bs.BodySize()
+	}
+	return c.bodySize
+}
+
+func (c *combinedCodec) Write(h *Header, body interface{}) error {
+	if err := c.WriteBuffered(h, body); err != nil {
+		return err
+	}
+	return c.Flush()
+}
+
+// 消息体先编码到 stage 失败时不写入头部 返回 EncodeError
+// gob 在编码值之前可能已经输出了类型定义 它们仍写入连接 对端在读取下一条消息时处理
+func (c *combinedCodec) WriteBuffered(h *Header, body interface{}) (err error) {
+	defer func() {
+		var encErr *EncodeError
+		if err != nil && !errors.As(err, &encErr) {
+			_ = c.buf.Flush()
+			_ = c.Close()
+		}
+	}()
+	if limit := c.limit.limit; limit > 0 {
+		if n := MinBodySize(body, limit); n > limit {
+			return &EncodeError{Err: &SizeError{Size: n, Limit: limit}}
+		}
+	}
+	c.stage.Reset()
+	c.limit.w, c.limit.n = &c.stage, 0
+	c.out.w = &c.limit
+	bodyErr := c.body.EncodeBody(body)
+	c.out.w = c.buf
+	if bodyErr != nil {
+		log.Printf("rpc codec: %s error encoding body: %v", c.name, bodyErr)
+		if _, err := c.buf.Write(c.stage.Bytes()); err != nil {
+			return err
+		}
+		return &EncodeError{Err: bodyErr}
+	}
+	if err := c.body.EncodeBody(h); err != nil {
+		log.Printf("rpc codec: %s error encoding header: %v", c.name, err)
+		return err
+	}
+	_, err = c.buf.Write(c.stage.Bytes())
+	return err
+}
+
+func (c *combinedCodec) WriteBody(body interface{}) error {
+	if err := c.body.EncodeBody(body); err != nil {
+		log.Printf("rpc codec: %s error encoding body: %v", c.name, err)
+		_ = c.buf.Flush()
+		_ = c.Close()
+		return err
+	}
+	return nil
+}
+
+func (c *combinedCodec) Flush() error {
+	return c.buf.Flush()
+}
+
+func (c *combinedCodec) Close() error {
+	return c.conn.Close()
+}
+
+func (c *combinedCodec) MarshalBody(body interface{}) ([]byte, error) {
+	return marshalBody(c.newBody, body)
+}
+
+func (c *combinedCodec) MarshalBodyTo(w io.Writer, body interface{}) error {
+	return marshalBodyTo(c.newBody, w, body)
+}
+
+func (c *combinedCodec) UnmarshalBody(data []byte, body interface{}) error {
+	return unmarshalBody(c.newBody, c.strict, data, body)
+}
+
+func (c *combinedCodec) SetMaxBodySize(n int) {
+	c.limit.limit = n
+}
+
+func (c *combinedCodec) SetStrictDecoding(strict bool) {
+	c.strict = strict
+}
+
+var _ Codec = (*combinedCodec)(nil)
+var _ StrictDecoding = (*combinedCodec)(nil)
+var _ BufferedWriter = (*combinedCodec)(nil)
+var _ BodyWriter = (*combinedCodec)(nil)
+var _ BodySizer = (*combinedCodec)(nil)
+var _ BodyMarshaler = (*combinedCodec)(nil)
+var _ SizeLimiter = (*combinedCodec)(nil)
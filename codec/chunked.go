@@ -0,0 +1,199 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+分块发送的大参数 参数按连接的消息体格式单独编码 编码输出按块写入连接 对端读完所有块后再解码
+请求头的元数据中带有 ChunkedMetadataKey 之后依次写入 ArgChunk 最后一块 EOF 为 true
+与流式消息不同 处理函数看到的仍是完整的参数 只避免把超大的消息体一次写入缓冲区
+*/
+
+const (
+	ChunkedMetadataKey = "x-rpc-chunked"
+	ArgChunkSize       = 256 << 10
+)
+
+type ArgChunk struct {
+	Seq  uint32
+	EOF  bool
+	Data []byte
+}
+
+// 可选接口 以连接的消息体格式单独编解码 不影响连接上编解码器的状态 (如 gob 已发送的类型信息)
+type BodyMarshaler interface {
+	MarshalBody(body interface{}) ([]byte, error)
+	// 编码结果直接写入 w 不在内存中另存一份 编码失败时返回 *EncodeError
+	MarshalBodyTo(w io.Writer, body interface{}) error
+	UnmarshalBody(data []byte, body interface{}) error
+}
+
+func IsChunked(h *Header) bool {
+	_, ok := h.Metadata[ChunkedMetadataKey]
+	return ok
+}
+
+func marshalBody(newBody NewBodyCodecFunc, body interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := marshalBodyTo(newBody, &buf, body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func marshalBodyTo(newBody NewBodyCodecFunc, w io.Writer, body interface{}) error {
+	if err := newBody(bytes.NewReader(nil), w).EncodeBody(body); err != nil {
+		var encErr *EncodeError
+		if errors.As(err, &encErr) {
+			return err
+		}
+		return &EncodeError{Err: err}
+	}
+	return nil
+}
+
+func unmarshalBody(newBody NewBodyCodecFunc, strict bool, data []byte, body interface{}) error {
+	bc := newBody(bytes.NewReader(data), io.Discard)
+	if sd, ok := bc.(StrictDecoding); ok && strict {
+		sd.SetStrictDecoding(true)
+	}
+	return bc.DecodeBody(body)
+}
+
+// 写入请求头 参数边编码边按 chunkSize 分块写入 调用方需保证写入期间独占连接
+// 没有写出任何块时编码失败返回 *EncodeError 连接仍然可用
+func WriteChunked(cc Codec, h *Header, body interface{}, chunkSize int) error {
+	bw, ok := cc.(BufferedWriter)
+	bodyw, ok2 := cc.(BodyWriter)
+	bm, ok3 := cc.(BodyMarshaler)
+	if !ok || !ok2 || !ok3 {
+		return ErrStreamUnsupported
+	}
+	if chunkSize <= 0 {
+		chunkSize = ArgChunkSize
+	}
+	md := make(map[string]string, len(h.Metadata)+1)
+	for k, v := range h.Metadata {
+		md[k] = v
+	}
+	md[ChunkedMetadataKey] = "stream"
+	hh := *h
+	hh.Metadata = md
+
+	w := &chunkWriter{h: &hh, bw: bw, bodyw: bodyw, size: chunkSize}
+	err := bm.MarshalBodyTo(w, body)
+	if err != nil && w.seq == 0 {
+		return err
+	}
+	// 已经写出部分块时仍以 EOF 结束 对端按解码失败处理这一个请求
+	if cerr := w.close(); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// 编码输出的写入目标 凑满一块且后面还有数据时写出 最后一块在 close 时带 EOF 写出
+type chunkWriter struct {
+	h     *Header
+	bw    BufferedWriter
+	bodyw BodyWriter
+	size  int
+	seq   uint32
+	buf   []byte
+	err   error
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		if len(w.buf) == w.size {
+			if w.err = w.emit(w.buf, false); w.err != nil {
+				return 0, w.err
+			}
+			w.buf = w.buf[:0]
+		}
+		// 缓冲为空时整块直接从 p 写出 不复制
+		if len(w.buf) == 0 && len(p) > w.size {
+			if w.err = w.emit(p[:w.size], false); w.err != nil {
+				return 0, w.err
+			}
+			p = p[w.size:]
+			continue
+		}
+		k := min(w.size-len(w.buf), len(p))
+		w.buf = append(w.buf, p[:k]...)
+		p = p[k:]
+	}
+	return n, nil
+}
+
+func (w *chunkWriter) emit(data []byte, eof bool) error {
+	chunk := &ArgChunk{Seq: w.seq, EOF: eof, Data: data}
+	w.seq++
+	if chunk.Seq == 0 {
+		return w.bw.WriteBuffered(w.h, chunk)
+	}
+	return w.bodyw.WriteBody(chunk)
+}
+
+func (w *chunkWriter) close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.emit(w.buf, true); err != nil {
+		return err
+	}
+	return w.bw.Flush()
+}
+
+// 读取所有块 总大小超过 limit (> 0) 时立即丢弃已读的数据 之后的块逐块丢弃 保持连接可用
+// 块的顺序错误时同样丢弃剩余的块
+func ReadChunked(cc Codec, limit int) ([]byte, error) {
+	var data []byte
+	for seq := uint32(0); ; seq++ {
+		var chunk ArgChunk
+		if err := cc.ReadBody(&chunk); err != nil {
+			return nil, err
+		}
+		var err error
+		switch {
+		case chunk.Seq != seq:
+			err = &DecodeError{Err: fmt.Errorf("chunk %d out of order, expect %d", chunk.Seq, seq)}
+		case limit > 0 && len(data)+len(chunk.Data) > limit:
+			err = &DecodeError{Err: &SizeError{Size: len(data) + len(chunk.Data), Limit: limit}}
+		case chunk.EOF:
+			return append(data, chunk.Data...), nil
+		default:
+			data = append(data, chunk.Data...)
+			continue
+		}
+		data = nil
+		if !chunk.EOF {
+			if derr := DiscardChunked(cc); derr != nil {
+				return nil, derr
+			}
+		}
+		return nil, err
+	}
+}
+
+// 丢弃剩余的块 同一时间只保留一块
+func DiscardChunked(cc Codec) error {
+	var chunk ArgChunk
+	for {
+		chunk.EOF = false
+		if err := cc.ReadBody(&chunk); err != nil {
+			return err
+		}
+		if chunk.EOF {
+			return nil
+		}
+	}
+}
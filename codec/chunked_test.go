@@ -0,0 +1,54 @@
+package codec
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestChunked(t *testing.T) {
+	large := strings.Repeat("0123456789", 100<<10)
+	for name, newCodec := range map[string]func(conn io.ReadWriteCloser) Codec{
+		"gob":        NewGobCodec,
+		"json":       NewJsonCodec,
+		"binary/gob": func(conn io.ReadWriteCloser) Codec { return NewFramedCodec(conn, BinaryHeaderCodec{}, NewGobBodyCodec) },
+		"binary/json": func(conn io.ReadWriteCloser) Codec {
+			return NewFramedCodec(conn, BinaryHeaderCodec{}, NewJsonBodyCodec)
+		},
+	} {
+		conn := new(bufferConn)
+		w := newCodec(conn)
+		for seq := uint64(1); seq <= 3; seq++ {
+			err := WriteChunked(w, &Header{ServiceMethod: "Foo.Len", Seq: seq}, large, 64<<10)
+			_assert(err == nil, "%s: write chunked: %v", name, err)
+		}
+		_ = w.Write(&Header{ServiceMethod: "Foo.Len", Seq: 4}, "ok")
+
+		r := newCodec(&bufferConn{Buffer: conn.Buffer})
+		bm := r.(BodyMarshaler)
+		var h Header
+		// 完整读取
+		_assert(r.ReadHeader(&h) == nil && IsChunked(&h), "%s: expect chunked header", name)
+		data, err := ReadChunked(r, 0)
+		var s string
+		_assert(err == nil && bm.UnmarshalBody(data, &s) == nil && s == large, "%s: read chunked: %v", name, err)
+		// 超过上限立即失败 剩余的块被丢弃
+		_assert(r.ReadHeader(&h) == nil && h.Seq == 2, "%s: read header 2", name)
+		_, err = ReadChunked(r, 100<<10)
+		var sizeErr *SizeError
+		_assert(errors.As(err, &sizeErr) && sizeErr.Limit == 100<<10 && sizeErr.Size <= 200<<10, "%s: expect size error, got %v", name, err)
+		// 不读取直接丢弃
+		_assert(r.ReadHeader(&h) == nil && h.Seq == 3 && DiscardChunked(r) == nil, "%s: discard chunked", name)
+		_assert(r.ReadHeader(&h) == nil && h.Seq == 4 && r.ReadBody(&s) == nil && s == "ok", "%s: connection out of sync", name)
+	}
+}
+
+// 编码失败时没有写出任何内容 连接仍然可用
+func TestChunked_EncodeError(t *testing.T) {
+	conn := new(bufferConn)
+	w := NewJsonCodec(conn)
+	err := WriteChunked(w, &Header{ServiceMethod: "Foo.Len", Seq: 1}, make(chan int), 0)
+	var encErr *EncodeError
+	_assert(errors.As(err, &encErr) && conn.Len() == 0, "expect encode error without output, got %v (%d bytes)", err, conn.Len())
+}
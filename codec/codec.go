@@ -1,12 +1,19 @@
 package codec
 
-import "io"
+import (
+	"fmt"
+	"gmrpc/rpcerr"
+	"io"
+)
 
 // 定义头部
+// json 格式的字段名由 tag 固定 修改会导致线上格式变化 见 tests/testdata/jsonwire
 type Header struct {
-	ServiceMethod string // 调用包方法名称 Service.Method
-	Seq           uint64 // 请求序列号
-	Error         string // 错误信息
+	ServiceMethod string            `json:"ServiceMethod"` // 调用包方法名称 Service.Method
+	Seq           uint64            `json:"Seq"`           // 请求序列号
+	Error         string            `json:"Error"`         // 错误信息
+	Metadata      map[string]string `json:"Metadata"`      // 元数据
+	Status        *rpcerr.RPCError  `json:"Status"`        // 结构化错误 Error 非空时可能携带
 }
 
 // 对消息体编解码接口
@@ -14,9 +21,135 @@ type Codec interface {
 	io.Closer // 继承关闭资源的接口
 	ReadHeader(*Header) error
 	ReadBody(interface{}) error
+	SkipBody() error // 丢弃当前消息体 之后可以继续读取下一条消息
 	Write(*Header, interface{}) error
 }
 
+// 没有 SkipBody 的旧编解码器 通过 AdaptLegacyCodec 转换为 Codec
+type LegacyCodec interface {
+	io.Closer
+	ReadHeader(*Header) error
+	ReadBody(interface{}) error
+	Write(*Header, interface{}) error
+}
+
+// SkipBody 以 ReadBody(nil) 实现 要求 c 解码到 nil 时跳过消息体 (gob 与 json 如此)
+// 包装后只保留 LegacyCodec 的方法 BufferedWriter 等可选接口不再可见
+func AdaptLegacyCodec(c LegacyCodec) Codec {
+	if cc, ok := c.(Codec); ok {
+		return cc
+	}
+	return legacyCodec{c}
+}
+
+type legacyCodec struct {
+	LegacyCodec
+}
+
+func (c legacyCodec) SkipBody() error {
+	return c.ReadBody(nil)
+}
+
+// 可选接口 写入后暂不刷新缓冲区 由调用方决定刷新时机 用于合并连续的小消息
+type BufferedWriter interface {
+	WriteBuffered(*Header, interface{}) error
+	Flush() error
+}
+
+// 可选接口 支持严格解码的编解码器实现 未知字段视为参数错误
+type StrictDecoding interface {
+	SetStrictDecoding(strict bool)
+}
+
+// 可选接口 最近一次读取的消息体在线上的字节数 在 ReadBody 之后有效 用于估算请求占用的内存
+// 分帧格式与 json 为准确值 合并格式的 gob 按解码时消耗的字节数计算
+type BodySizer interface {
+	BodySize() int
+}
+
+// 可选接口 ReadHeader 之后 读取消息体之前 长度前缀声明的消息体字节数 用于在读取与解码之前占用内存预算
+// 只有分帧格式支持 合并格式的消息体没有长度前缀 只能在 ReadBody 之后以 BodySizer 得知 包装的编解码器不支持时返回负数
+type FrameSizer interface {
+	FrameSize() int
+}
+
+// 可选接口 读取头部后取出未解码的消息体 之后可在其他协程中以 BodyMarshaler.UnmarshalBody 解码
+// 取出后当前消息体视为已读 RawBodySupported 为 false 时 (如 gob 的消息体共享类型定义) 只能以 ReadBody 读取
+type RawBodyReader interface {
+	RawBodySupported() bool
+	ReadRawBody() []byte
+}
+
+// 可选接口 读取头部后查看收到的消息体 (解压后 未解码) 不影响之后的 ReadBody 在下一次 ReadHeader 之前有效
+type BodyPeeker interface {
+	PeekBody() []byte
+}
+
+// 写入消息前以编码后的消息体 (压缩前) 调用 可以修改 h.Metadata 例如对实际发送的字节签名
+// 流式与分块消息的 body 为空
+type BodyHook func(h *Header, body []byte)
+
+// 可选接口 只有分帧格式支持 合并格式的头部与消息体在同一个流中 对端无法取得消息体的字节
+// hook 为空时取消 只作用于 Write 与 WriteBuffered
+type BodyHooker interface {
+	SetBodyHook(hook BodyHook)
+}
+
+// 可选接口 限制响应消息体编码后的字节数 n <= 0 表示不限制 只作用于 Write 与 WriteBuffered 不限制流式消息的后续块
+// 超出时消息不写入 返回 *EncodeError 其中 Err 为 *SizeError 连接仍然可用
+// 编码前先按下界估计 明显超出时不编码 其余编码结果在写入缓冲区前检查 超出时不会复制到发送缓冲区
+type SizeLimiter interface {
+	SetMaxBodySize(n int)
+}
+
+// 可选接口 限制收到的单个消息体 (及解压后) 的字节数 n <= 0 表示不限制 默认为 DefaultMaxReceiveSize
+// 超出时读取返回 *SizeError 未读出的数据无法跳过 连接不再可用
+type ReceiveLimiter interface {
+	SetMaxReceiveSize(n int)
+}
+
+// 分帧格式默认的接收上限 长度前缀来自对端 不能无限制地读取
+const DefaultMaxReceiveSize = 64 << 20
+
+type SizeError struct {
+	Size  int // 编码结果至少有这么大
+	Limit int
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("rpc codec: body of %d bytes exceeds limit of %d bytes", e.Size, e.Limit)
+}
+
+// 消息体无法编码 例如接口字段中的值无法序列化 这条消息没有写入 连接仍然可用
+type EncodeError struct {
+	Err error
+}
+
+func (e *EncodeError) Error() string {
+	return "rpc codec: body not serializable: " + e.Err.Error()
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// 消息体与目标类型不匹配 Field 为出错字段路径(可能为空)
+type DecodeError struct {
+	Field string
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + " (field " + e.Field + ")"
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
 // Codec构造方法
 // 定义类型
 type NewCodecFunc func(io.ReadWriteCloser) Codec
@@ -24,14 +157,5 @@ type Type string
 
 const (
 	GobType  Type = "application/gob"
-	JsonType Type = "application/json" // not implemented
+	JsonType Type = "application/json"
 )
-
-var NewCodecFuncMap map[Type]NewCodecFunc
-
-// 包的初始化
-func init() {
-	NewCodecFuncMap = make(map[Type]NewCodecFunc)
-	NewCodecFuncMap[GobType] = NewGobCodec
-	NewCodecFuncMap[JsonType] = NewJsonCodec
-}
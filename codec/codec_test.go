@@ -0,0 +1,212 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmrpc/rpcerr"
+	"io"
+	"net"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Args struct {
+	Num1, Num2 int
+	Tags       []string
+}
+
+// 写入内存的连接 用于比较编码结果
+type bufferConn struct {
+	bytes.Buffer
+}
+
+func (c *bufferConn) Close() error { return nil }
+
+var headers = []*Header{
+	{ServiceMethod: "Foo.Sum", Seq: 1},
+	{ServiceMethod: "Foo.Sum", Seq: 2, Metadata: map[string]string{"trace-id": "t-1"}},
+	{ServiceMethod: "Foo.Sum", Seq: 3, Error: "overloaded", Status: &rpcerr.RPCError{
+		Code: rpcerr.Overloaded, Message: "overloaded", RetryAfterMs: 200, Details: map[string]string{"field": "Num1"},
+	}},
+}
+
+func TestCodec_HeaderBodyCombinations(t *testing.T) {
+	for _, ht := range []HeaderType{CombinedHeader, BinaryHeader} {
+		for _, bt := range []Type{GobType, JsonType} {
+			t.Run(fmt.Sprintf("%q/%s", ht, bt), func(t *testing.T) {
+				c1, c2 := net.Pipe()
+				w, err := New(c1, ht, bt)
+				_assert(err == nil, "new codec error: %v", err)
+				r, _ := New(c2, ht, bt)
+				defer func() { _ = w.Close(); _ = r.Close() }()
+
+				go func() {
+					for i, h := range headers {
+						_ = w.Write(h, Args{Num1: i, Num2: 2 * i, Tags: []string{"a", "b"}})
+					}
+				}()
+				for i, want := range headers {
+					var h Header
+					_assert(r.ReadHeader(&h) == nil, "read header error")
+					_assert(reflect.DeepEqual(&h, want), "expect header %+v, got %+v", want, h)
+					// 丢弃第二个消息体 不影响后续消息
+					if i == 1 {
+						_assert(r.ReadBody(nil) == nil, "discard body error")
+						continue
+					}
+					var args Args
+					_assert(r.ReadBody(&args) == nil, "read body error")
+					_assert(args.Num1 == i && args.Num2 == 2*i && len(args.Tags) == 2, "unexpected body %+v", args)
+				}
+			})
+		}
+	}
+
+	_, err := New(&bufferConn{}, "unknown", GobType)
+	_assert(err != nil, "expect error for unknown header type")
+	_, err = New(&bufferConn{}, BinaryHeader, "unknown")
+	_assert(err != nil, "expect error for unknown body type")
+}
+
+// 合并格式与拆分前的实现逐字节一致
+func TestCodec_LegacyCombinedFormat(t *testing.T) {
+	legacy := map[Type]func(w io.Writer) func(v interface{}) error{
+		GobType:  func(w io.Writer) func(v interface{}) error { return gob.NewEncoder(w).Encode },
+		JsonType: func(w io.Writer) func(v interface{}) error { return json.NewEncoder(w).Encode },
+	}
+	for typ, newEnc := range legacy {
+		var want bytes.Buffer
+		enc := newEnc(&want)
+		conn := new(bufferConn)
+		cc := DefaultCodecRegistry.Lookup(typ)(conn)
+		for i, h := range headers {
+			_ = enc(h)
+			_ = enc(Args{Num1: i})
+			_ = cc.Write(h, Args{Num1: i})
+		}
+		_assert(bytes.Equal(conn.Bytes(), want.Bytes()), "%s: combined format differs from legacy encoding", typ)
+
+		// 新实现可以读取旧格式
+		r := DefaultCodecRegistry.Lookup(typ)(&bufferConn{Buffer: want})
+		for i := range headers {
+			var h Header
+			var args Args
+			_assert(r.ReadHeader(&h) == nil && h.Seq == headers[i].Seq, "%s: read legacy header error", typ)
+			_assert(r.ReadBody(&args) == nil && args.Num1 == i, "%s: read legacy body error", typ)
+		}
+	}
+}
+
+// 中间设备只需解析二进制头部即可得到方法名 无需理解消息体编码
+func TestCodec_BinaryHeaderLayout(t *testing.T) {
+	conn := new(bufferConn)
+	cc, _ := New(conn, BinaryHeader, GobType)
+	_ = cc.Write(headers[1], Args{Num1: 1})
+
+	data := conn.Bytes()
+	size := binary.BigEndian.Uint32(data)
+	var h Header
+	_assert(BinaryHeaderCodec{}.DecodeHeader(data[4:4+size], &h) == nil, "decode header error")
+	_assert(h.ServiceMethod == "Foo.Sum" && h.Seq == 2 && h.Metadata["trace-id"] == "t-1", "unexpected header %+v", h)
+	bodySize := binary.BigEndian.Uint32(data[4+size:])
+	_assert(int(4+size+4+bodySize) == len(data), "expect body to fill the rest of the frame")
+
+	_assert(BinaryHeaderCodec{}.DecodeHeader(data[4:4+size-1], &h) != nil, "expect truncated header to fail")
+}
+
+func TestBodySizer(t *testing.T) {
+	for _, c := range []struct {
+		header HeaderType
+		body   Type
+	}{{CombinedHeader, GobType}, {CombinedHeader, JsonType}, {BinaryHeader, GobType}, {CombinedHeader, JSONRPC2Type}} {
+		conn := new(bufferConn)
+		cc, err := New(conn, c.header, c.body)
+		_assert(err == nil, "new codec error: %v", err)
+		payload := make([]byte, 1000)
+		for seq := uint64(1); seq <= 2; seq++ {
+			_assert(cc.Write(&Header{ServiceMethod: "Foo.Sum", Seq: seq}, payload) == nil, "write failed")
+		}
+		for seq := uint64(1); seq <= 2; seq++ {
+			var h Header
+			var got []byte
+			_assert(cc.ReadHeader(&h) == nil && cc.ReadBody(&got) == nil && len(got) == 1000, "%s/%s: read failed", c.header, c.body)
+			// json 以 base64 编码字节切片
+			n := cc.(BodySizer).BodySize()
+			_assert(n >= 1000 && n <= 1400, "%s/%s: unexpected body size %d", c.header, c.body, n)
+		}
+	}
+}
+
+// 畸形的类型定义使 encoding/gob panic 时返回 ErrCorruptGob
+func TestGobCodec_CorruptStream(t *testing.T) {
+	// 模糊测试发现的输入 类型定义中 Num2 的类型 id 越界
+	data := []byte("\x00\x00\x00\x1b\x01\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\aFoo.Sum\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00," +
+		"#\x7f\x03\x01\x01\x04Args\x01\xff\x80\x00\x01\x02\x01\x04Num1\x01\x04\x00\x01\x04Num2\x01\x04\x80\x00\x00\a\xff\x80\x01\x02\x01\x02\x00" +
+		"\x00\x00\x00\x1b\x01\x00\x00\x00\x00\x00\x00\x00\x02\x00\x00\x00\aFoo.Sum\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x08\a\xff\x80\x01\x04\x01\b\x00" +
+		"\x00\x00\x00\x1b\x01\x00\x00\x00\x00\x00\x00\x00\x03\x00\x00\x00\aFoo.Sum\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x04\x03\xff\x80\x00")
+	cc, _ := New(&bufferConn{Buffer: *bytes.NewBuffer(data)}, BinaryHeader, GobType)
+	var h Header
+	var args struct{ Num1, Num2 int }
+	_assert(cc.ReadHeader(&h) == nil && cc.ReadBody(&args) != nil, "expect error for invalid args")
+	_assert(cc.ReadHeader(&h) == nil && cc.SkipBody() != nil, "expect error for undefined type")
+	_assert(cc.ReadHeader(&h) == nil, "read header error")
+	err := cc.SkipBody()
+	_assert(errors.Is(err, ErrCorruptGob), "expect ErrCorruptGob, got %v", err)
+}
+
+// 消息体长度前缀远大于实际数据时不预先分配
+func TestFramedCodec_ShortFrame(t *testing.T) {
+	var buf bufferConn
+	w, _ := New(&buf, BinaryHeader, JsonType)
+	_ = w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 1}, Args{Num1: 1})
+	data := buf.Bytes()
+	hdrLen := binary.BigEndian.Uint32(data)
+	binary.BigEndian.PutUint32(data[4+hdrLen:], 1<<31-1)
+
+	r, _ := New(&bufferConn{Buffer: *bytes.NewBuffer(data)}, BinaryHeader, JsonType)
+	// 不限制接收大小时按实际收到的数据分配
+	r.(ReceiveLimiter).SetMaxReceiveSize(0)
+	var h Header
+	// 消息体在使用时才读取 之前可以得到声明的大小
+	_assert(r.ReadHeader(&h) == nil && r.(FrameSizer).FrameSize() == 1<<31-1, "expect declared frame size")
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	err := r.ReadBody(nil)
+	runtime.ReadMemStats(&after)
+	_assert(errors.Is(err, io.ErrUnexpectedEOF), "expect ErrUnexpectedEOF, got %v", err)
+	_assert(after.TotalAlloc-before.TotalAlloc < 1<<20, "allocated %d bytes for a short frame", after.TotalAlloc-before.TotalAlloc)
+}
+
+// 消息体帧超过接收上限时不读取 返回 SizeError
+func TestFramedCodec_MaxReceiveSize(t *testing.T) {
+	var buf bufferConn
+	w, _ := New(&buf, BinaryHeader, JsonType)
+	_ = w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 1}, make([]byte, 4096))
+	_ = w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 2}, "ok")
+
+	r, _ := New(&bufferConn{Buffer: *bytes.NewBuffer(buf.Bytes())}, BinaryHeader, JsonType)
+	r.(ReceiveLimiter).SetMaxReceiveSize(1024)
+	var h Header
+	var sizeErr *SizeError
+	err := r.ReadHeader(&h)
+	_assert(errors.As(err, &sizeErr) && sizeErr.Limit == 1024 && sizeErr.Size > 4096, "expect size error, got %v", err)
+
+	// 默认上限拒绝伪造的长度前缀
+	data := append([]byte(nil), buf.Bytes()...)
+	hdrLen := binary.BigEndian.Uint32(data)
+	binary.BigEndian.PutUint32(data[4+hdrLen:], DefaultMaxReceiveSize+1)
+	r, _ = New(&bufferConn{Buffer: *bytes.NewBuffer(data)}, BinaryHeader, JsonType)
+	err = r.ReadHeader(&h)
+	_assert(errors.As(err, &sizeErr) && sizeErr.Limit == DefaultMaxReceiveSize, "expect default limit, got %v", err)
+}
@@ -0,0 +1,210 @@
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+按消息压缩 只用于拆分头部的帧格式 合并格式没有消息边界
+消息体帧长度的最高位表示该帧已压缩 小于阈值或压缩后没有变小的消息原样发送
+使用的算法在握手时协商 见 server.Option.Compression
+*/
+
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// 可选接口 解压时限制输出的字节数 limit <= 0 表示不限制 超出时返回 *SizeError
+// 没有实现时先完整解压再检查大小
+type LimitedDecompressor interface {
+	DecompressLimit(data []byte, limit int) ([]byte, error)
+}
+
+// 可选接口 支持按消息压缩的编解码器 c 为空时关闭压缩
+type Compressible interface {
+	SetCompression(c Compressor, threshold int)
+}
+
+// 小于该大小的消息体不压缩
+const DefaultCompressThreshold = 1024
+
+const compressedFlag = 1 << 31
+
+var ErrCompressedFrame = errors.New("rpc codec: compressed frame without negotiated compression")
+
+var compressors = struct {
+	sync.RWMutex
+	m map[string]Compressor
+}{m: map[string]Compressor{
+	"gzip":    gzipCompressor{},
+	"deflate": deflateCompressor{},
+}}
+
+// 注册压缩算法 同名时替换 例如 snappy zstd
+func RegisterCompressor(c Compressor) {
+	compressors.Lock()
+	defer compressors.Unlock()
+	compressors.m[c.Name()] = c
+}
+
+func GetCompressor(name string) (Compressor, bool) {
+	compressors.RLock()
+	defer compressors.RUnlock()
+	c, ok := compressors.m[name]
+	return c, ok
+}
+
+// 按客户端的优先顺序选择第一个双方都支持且已注册的算法 没有时返回空字符串
+func NegotiateCompression(client, server []string) string {
+	for _, name := range client {
+		if _, ok := GetCompressor(name); !ok {
+			continue
+		}
+		for _, s := range server {
+			if s == name {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// 压缩统计 进程内所有连接的发送方向
+type CompressionStats struct {
+	Compressed      uint64 // 压缩后发送的消息数
+	Skipped         uint64 // 小于阈值或压缩后没有变小 原样发送的消息数
+	RawBytes        uint64 // 压缩消息的原始字节数
+	CompressedBytes uint64 // 压缩消息压缩后的字节数
+}
+
+// 压缩后与压缩前的字节数之比
+func (s CompressionStats) Ratio() float64 {
+	if s.RawBytes == 0 {
+		return 1
+	}
+	return float64(s.CompressedBytes) / float64(s.RawBytes)
+}
+
+var compressionStats CompressionStats
+
+func ReadCompressionStats() CompressionStats {
+	return CompressionStats{
+		Compressed:      atomic.LoadUint64(&compressionStats.Compressed),
+		Skipped:         atomic.LoadUint64(&compressionStats.Skipped),
+		RawBytes:        atomic.LoadUint64(&compressionStats.RawBytes),
+		CompressedBytes: atomic.LoadUint64(&compressionStats.CompressedBytes),
+	}
+}
+
+// 返回要发送的数据以及是否已压缩
+func compressBody(c Compressor, threshold int, data []byte) ([]byte, bool) {
+	if c == nil {
+		return data, false
+	}
+	if len(data) < threshold {
+		atomic.AddUint64(&compressionStats.Skipped, 1)
+		return data, false
+	}
+	out, err := c.Compress(data)
+	if err != nil || len(out) >= len(data) {
+		atomic.AddUint64(&compressionStats.Skipped, 1)
+		return data, false
+	}
+	atomic.AddUint64(&compressionStats.Compressed, 1)
+	atomic.AddUint64(&compressionStats.RawBytes, uint64(len(data)))
+	atomic.AddUint64(&compressionStats.CompressedBytes, uint64(len(out)))
+	return out, true
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string { return "gzip" }
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (g gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	return g.DecompressLimit(data, 0)
+}
+
+func (gzipCompressor) DecompressLimit(data []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	return readLimit(r, limit)
+}
+
+type deflateCompressor struct{}
+
+func (deflateCompressor) Name() string { return "deflate" }
+
+func (deflateCompressor) Compress(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, _ := flate.NewWriter(&b, flate.DefaultCompression)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (d deflateCompressor) Decompress(data []byte) ([]byte, error) {
+	return d.DecompressLimit(data, 0)
+}
+
+func (deflateCompressor) DecompressLimit(data []byte, limit int) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer func() { _ = r.Close() }()
+	return readLimit(r, limit)
+}
+
+// 多读一个字节判断是否超出 不会把压缩炸弹完整解压到内存
+func readLimit(r io.Reader, limit int) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, &SizeError{Size: len(data), Limit: limit}
+	}
+	return data, nil
+}
+
+// 按上限解压 limit <= 0 表示不限制
+func decompress(c Compressor, data []byte, limit int) ([]byte, error) {
+	if ld, ok := c.(LimitedDecompressor); ok {
+		return ld.DecompressLimit(data, limit)
+	}
+	out, err := c.Decompress(data)
+	if err == nil && limit > 0 && len(out) > limit {
+		return nil, &SizeError{Size: len(out), Limit: limit}
+	}
+	return out, err
+}
+
+var _ LimitedDecompressor = gzipCompressor{}
+var _ LimitedDecompressor = deflateCompressor{}
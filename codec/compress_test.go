@@ -0,0 +1,89 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 测试用 以 deflate 实现的同名算法
+type fakeSnappy struct{ deflateCompressor }
+
+func (fakeSnappy) Name() string { return "snappy" }
+
+func TestCompression_Negotiate(t *testing.T) {
+	RegisterCompressor(fakeSnappy{})
+	_assert(NegotiateCompression([]string{"snappy"}, []string{"gzip", "snappy"}) == "snappy", "expect the common algorithm")
+	_assert(NegotiateCompression([]string{"deflate", "gzip"}, []string{"gzip", "deflate"}) == "deflate", "client preference should win")
+	_assert(NegotiateCompression([]string{"zstd"}, []string{"gzip"}) == "", "no common algorithm should fall back to none")
+	_assert(NegotiateCompression([]string{"lz4"}, []string{"lz4"}) == "", "unregistered algorithm should not be chosen")
+}
+
+func TestCompression_Threshold(t *testing.T) {
+	gz, _ := GetCompressor("gzip")
+	conn := new(bufferConn)
+	w := NewFramedCodec(conn, BinaryHeaderCodec{}, NewJsonBodyCodec)
+	w.(Compressible).SetCompression(gz, 100)
+	before := ReadCompressionStats()
+
+	small, large := "tiny", strings.Repeat("compressible ", 100)
+	_ = w.Write(&Header{ServiceMethod: "Foo.Echo", Seq: 1}, small)
+	_ = w.Write(&Header{ServiceMethod: "Foo.Echo", Seq: 2}, large)
+
+	// 第一条消息的消息体帧没有压缩标记 第二条有
+	data := conn.Bytes()
+	bodyFlag := func(data []byte) (bool, []byte) {
+		hlen := binary.BigEndian.Uint32(data)
+		data = data[4+hlen:]
+		n := binary.BigEndian.Uint32(data)
+		return n&compressedFlag != 0, data[4+n&^compressedFlag:]
+	}
+	compressed, rest := bodyFlag(data)
+	_assert(!compressed, "small body should not be compressed")
+	compressed, rest = bodyFlag(rest)
+	_assert(compressed && len(rest) == 0, "large body should be compressed")
+
+	stats := ReadCompressionStats()
+	_assert(stats.Compressed-before.Compressed == 1 && stats.Skipped-before.Skipped == 1, "unexpected stats %+v", stats)
+	_assert(stats.CompressedBytes-before.CompressedBytes < stats.RawBytes-before.RawBytes, "compressed bytes should be smaller")
+
+	r := NewFramedCodec(&bufferConn{Buffer: *bytes.NewBuffer(data)}, BinaryHeaderCodec{}, NewJsonBodyCodec)
+	r.(Compressible).SetCompression(gz, 100)
+	for _, want := range []string{small, large} {
+		var h Header
+		var got string
+		_assert(r.ReadHeader(&h) == nil && r.ReadBody(&got) == nil && got == want, "round trip failed for seq %d", h.Seq)
+	}
+
+	// 未协商压缩的一端读到压缩帧时报错
+	plain := NewFramedCodec(&bufferConn{Buffer: *bytes.NewBuffer(data)}, BinaryHeaderCodec{}, NewJsonBodyCodec)
+	var h Header
+	_ = plain.ReadHeader(&h)
+	_ = plain.ReadBody(nil)
+	_assert(plain.ReadHeader(&h) == nil && plain.ReadBody(nil) == ErrCompressedFrame, "expect compressed frame error")
+	_assert(plain.ReadHeader(&h) == ErrCompressedFrame, "connection should stay broken")
+}
+
+// 解压后超过接收上限时不完整解压 读取失败
+func TestCompression_ReceiveLimit(t *testing.T) {
+	RegisterCompressor(fakeSnappy{})
+	for _, name := range []string{"gzip", "deflate", "snappy"} {
+		c, _ := GetCompressor(name)
+		conn := new(bufferConn)
+		w := NewFramedCodec(conn, BinaryHeaderCodec{}, NewJsonBodyCodec)
+		w.(Compressible).SetCompression(c, 1)
+		_ = w.Write(&Header{ServiceMethod: "Foo.Echo", Seq: 1}, strings.Repeat("0", 4<<20))
+		_assert(conn.Len() < 64<<10, "%s: expect a small compressed frame, got %d bytes", name, conn.Len())
+
+		r := NewFramedCodec(&bufferConn{Buffer: conn.Buffer}, BinaryHeaderCodec{}, NewJsonBodyCodec)
+		r.(Compressible).SetCompression(c, 1)
+		r.(ReceiveLimiter).SetMaxReceiveSize(1 << 20)
+		var h Header
+		var sizeErr *SizeError
+		_assert(r.ReadHeader(&h) == nil, "%s: read header error", name)
+		err := r.ReadBody(nil)
+		_assert(errors.As(err, &sizeErr) && sizeErr.Limit == 1<<20, "%s: expect size error, got %v", name, err)
+	}
+}
@@ -1,10 +1,11 @@
 package codec
 
 import (
-	"bufio"
 	"encoding/gob"
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"strings"
 )
 
 /*
@@ -12,55 +13,66 @@ import (
 一个典型的用途是传输远程过程调用（RPC）的参数和结果
 */
 
-// 定义gob 类型
-type GobCodec struct {
-	conn io.ReadWriteCloser // socket 链接实例
-	buf  *bufio.Writer      // 缓冲区 增加性能
-	dec  *gob.Decoder       // 解码器
-	enc  *gob.Encoder       // 编码器
-}
-
-/* 实现 Codec 接口*/
-func (c *GobCodec) ReadHeader(h *Header) error {
-	return c.dec.Decode(h)
-}
+// encoding/gob 遇到畸形的类型定义时可能 panic 而不是返回错误 见 DecodeBody
+var ErrCorruptGob = errors.New("rpc codec: corrupt gob stream")
 
-func (c *GobCodec) ReadBody(body interface{}) error {
-	return c.dec.Decode(body)
+// 定义gob 类型 作为消息体编解码器 同一连接上共享类型信息
+type GobCodec struct {
+	dec *gob.Decoder // 解码器
+	enc *gob.Encoder // 编码器
+	err error        // 解码器 panic 后其状态不再可信 之后的解码都返回该错误
 }
 
-func (c *GobCodec) Write(h *Header, body interface{}) (err error) {
+/* 实现 BodyCodec 接口*/
+func (c *GobCodec) DecodeBody(body interface{}) (err error) {
+	if c.err != nil {
+		return c.err
+	}
 	defer func() {
-		_ = c.buf.Flush()
-		if err != nil {
-			_ = c.Close()
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("%w: %v", ErrCorruptGob, r)
+			err = c.err
 		}
 	}()
-	if err := c.enc.Encode(h); err != nil {
-		log.Println("rpc codec: gob error encoding header:", err)
-		return err
+	err = c.dec.Decode(body)
+	if err != nil && isGobTypeMismatch(err) {
+		return &DecodeError{Err: err}
 	}
-	if err := c.enc.Encode(body); err != nil {
-		log.Println("rpc codec: gob error encoding body:", err)
-		return err
+	return err
+}
+
+// gob 的类型不匹配错误没有导出类型 只能根据错误信息判断
+func isGobTypeMismatch(err error) bool {
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "gob: ") {
+		return false
 	}
-	return nil
+	return strings.Contains(msg, "type mismatch") ||
+		strings.Contains(msg, "local type") ||
+		strings.Contains(msg, "wrong type")
+}
+
+func (c *GobCodec) EncodeBody(body interface{}) error {
+	return c.enc.Encode(body)
 }
 
-func (c *GobCodec) Close() error {
-	return c.conn.Close()
+// 类型定义只在第一次出现时发送 跳过的消息体也要解码
+func (c *GobCodec) StatefulDecoding() bool {
+	return true
 }
 
 // ? 确保接口被实现常用的方式
-var _ Codec = (*GobCodec)(nil)
+var _ BodyCodec = (*GobCodec)(nil)
+var _ StatefulBody = (*GobCodec)(nil)
 
-// 返回gob实体指针  gob编码处理机制
-func NewGobCodec(conn io.ReadWriteCloser) Codec {
-	buf := bufio.NewWriter(conn)
+func NewGobBodyCodec(r io.Reader, w io.Writer) BodyCodec {
 	return &GobCodec{
-		conn: conn,
-		buf:  buf,
-		dec:  gob.NewDecoder(conn),
-		enc:  gob.NewEncoder(buf),
+		dec: gob.NewDecoder(r),
+		enc: gob.NewEncoder(w),
 	}
 }
+
+// 返回gob编解码器 头部与消息体都使用 gob 编码 即传统的合并格式
+func NewGobCodec(conn io.ReadWriteCloser) Codec {
+	return NewCombinedCodec(conn, "gob", NewGobBodyCodec)
+}
@@ -0,0 +1,584 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gmrpc/rpcerr"
+	"io"
+	"log"
+	"sort"
+)
+
+/*
+头部与消息体分离的帧格式 头部使用固定的二进制布局 中间设备无需理解消息体编码即可读取方法名等信息
+
+帧:   uint32 头部长度 | 头部 | uint32 消息体长度 | 消息体
+头部: uint8 版本 | uint64 Seq | str ServiceMethod | str Error | uint16 元数据个数 {str 键 | str 值}
+      | uint8 是否有 Status [uint32 Code | str Message | uint32 RetryAfterMs | uint16 Details 个数 {str 键 | str 值}]
+str:  uint32 长度 | 字节
+所有整数均为大端序
+*/
+
+type HeaderType string
+
+const (
+	CombinedHeader HeaderType = ""       // 头部与消息体使用同一编码 传统格式
+	BinaryHeader   HeaderType = "binary" // 固定二进制布局的头部
+)
+
+const (
+	binaryHeaderVersion = 1
+	maxHeaderSize       = 1 << 20
+	readChunkSize       = 64 << 10 // 不超过该大小的帧一次分配
+)
+
+// 头部编解码接口
+type HeaderCodec interface {
+	EncodeHeader(h *Header) ([]byte, error)
+	DecodeHeader(data []byte, h *Header) error
+}
+
+var HeaderCodecMap = map[HeaderType]HeaderCodec{
+	BinaryHeader: BinaryHeaderCodec{},
+}
+
+// 使用 DefaultCodecRegistry 创建编解码器
+func New(conn io.ReadWriteCloser, header HeaderType, body Type) (Codec, error) {
+	return DefaultCodecRegistry.New(conn, header, body)
+}
+
+// 使用 DefaultCodecRegistry 判断是否支持
+func Supported(header HeaderType, body Type) bool {
+	return DefaultCodecRegistry.Supported(header, body)
+}
+
+type BinaryHeaderCodec struct{}
+
+var errHeaderTooShort = errors.New("rpc codec: binary header too short")
+
+func (BinaryHeaderCodec) EncodeHeader(h *Header) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte(binaryHeaderVersion)
+	_ = binary.Write(&b, binary.BigEndian, h.Seq)
+	writeString(&b, h.ServiceMethod)
+	writeString(&b, h.Error)
+	if err := writeMap(&b, h.Metadata); err != nil {
+		return nil, err
+	}
+	if h.Status == nil {
+		b.WriteByte(0)
+		return b.Bytes(), nil
+	}
+	b.WriteByte(1)
+	_ = binary.Write(&b, binary.BigEndian, uint32(h.Status.Code))
+	writeString(&b, h.Status.Message)
+	_ = binary.Write(&b, binary.BigEndian, h.Status.RetryAfterMs)
+	if err := writeMap(&b, h.Status.Details); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (BinaryHeaderCodec) DecodeHeader(data []byte, h *Header) error {
+	r := &headerReader{data: data}
+	if v := r.byte(); r.err == nil && v != binaryHeaderVersion {
+		return fmt.Errorf("rpc codec: unsupported binary header version %d", v)
+	}
+	*h = Header{}
+	h.Seq = r.uint64()
+	h.ServiceMethod = r.string()
+	h.Error = r.string()
+	h.Metadata = r.stringMap()
+	if r.byte() == 1 {
+		h.Status = &rpcerr.RPCError{Code: rpcerr.Code(r.uint32())}
+		h.Status.Message = r.string()
+		h.Status.RetryAfterMs = r.uint32()
+		h.Status.Details = r.stringMap()
+	}
+	return r.err
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	_ = binary.Write(b, binary.BigEndian, uint32(len(s)))
+	b.WriteString(s)
+}
+
+// 按键排序写入 保证相同的头部编码结果一致
+func writeMap(b *bytes.Buffer, m map[string]string) error {
+	if len(m) > 0xffff {
+		return errors.New("rpc codec: too many header entries")
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	_ = binary.Write(b, binary.BigEndian, uint16(len(keys)))
+	for _, k := range keys {
+		writeString(b, k)
+		writeString(b, m[k])
+	}
+	return nil
+}
+
+// 顺序读取二进制头部 第一次出错后的读取都返回零值
+type headerReader struct {
+	data []byte
+	err  error
+}
+
+func (r *headerReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = errHeaderTooShort
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *headerReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *headerReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *headerReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *headerReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *headerReader) string() string {
+	return string(r.next(int(r.uint32())))
+}
+
+func (r *headerReader) stringMap() map[string]string {
+	n := int(r.uint16())
+	if n == 0 || r.err != nil {
+		return nil
+	}
+	m := make(map[string]string, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		k := r.string()
+		m[k] = r.string()
+	}
+	return m
+}
+
+// 分帧编解码器 头部由 HeaderCodec 编码 消息体由 BodyCodec 编码并带长度前缀
+type framedCodec struct {
+	conn   io.ReadWriteCloser
+	r      *bufio.Reader
+	w      *bufio.Writer
+	header HeaderCodec
+	body   BodyCodec
+	in     bytes.Buffer // 当前消息体 供 BodyCodec 读取
+	out    bytes.Buffer // 待发送的消息体
+	limit  limitWriter  // 消息体编解码器经它写入 out
+	frame  bytes.Buffer // 完整的待发送消息 一次写入缓冲区
+	read   bool         // 当前消息体已读取 流式消息的下一块需要从连接读取
+	next   uint32       // 已读出长度前缀 尚未读取的消息体帧 (含压缩标志) 见 loadBody
+	unread bool         // next 有效
+	err    error        // 读取消息体失败后连接不再可用 之后的 ReadHeader 返回该错误
+	raw    []byte       // 当前消息体 (已解压) 供 ReadRawBody 取出
+	carry  []byte       // 编码失败的消息体已输出的类型定义 放在下一个消息体之前
+	size   int          // 当前消息体解压后的字节数
+
+	compressor Compressor // 握手时协商的压缩算法 为空表示不压缩
+	threshold  int        // 小于该大小的消息体不压缩
+
+	newBody NewBodyCodecFunc
+	strict  bool
+	maxBody int // 消息体大小上限 见 SizeLimiter
+	maxRecv int // 收到的消息体大小上限 见 ReceiveLimiter
+
+	bodyHook BodyHook // 见 BodyHooker
+}
+
+func NewFramedCodec(conn io.ReadWriteCloser, header HeaderCodec, newBody NewBodyCodecFunc) Codec {
+	c := &framedCodec{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriter(newPoisonWriter(conn)),
+		header:  header,
+		newBody: newBody,
+		maxRecv: DefaultMaxReceiveSize,
+	}
+	c.limit.w = &c.out
+	c.body = newBody(&c.in, &c.limit)
+	return c
+}
+
+func (c *framedCodec) readFrame(limit uint32) ([]byte, error) {
+	n, err := c.readSize(limit)
+	if err != nil {
+		return nil, err
+	}
+	return c.readFrameData(n, limit)
+}
+
+// 读取帧的长度前缀 (含压缩标志)
+func (c *framedCodec) readSize(limit uint32) (uint32, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(c.r, size[:]); err != nil {
+		return 0, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if limit > 0 && n&^compressedFlag > limit {
+		return 0, fmt.Errorf("rpc codec: frame too large: %w", &SizeError{Size: int(n &^ compressedFlag), Limit: int(limit)})
+	}
+	return n, nil
+}
+
+func (c *framedCodec) readFrameData(n, limit uint32) ([]byte, error) {
+	compressed := n&compressedFlag != 0
+	n &^= compressedFlag
+	data, err := readData(c.r, n)
+	if err != nil {
+		return nil, err
+	}
+	if !compressed {
+		return data, nil
+	}
+	if c.compressor == nil {
+		return nil, ErrCompressedFrame
+	}
+	data, err = decompress(c.compressor, data, int(limit))
+	if err != nil {
+		return nil, fmt.Errorf("rpc codec: decompress frame: %w", err)
+	}
+	return data, nil
+}
+
+// 长度前缀来自对端 较大的帧按实际收到的数据增长缓冲区 伪造的长度不会导致一次分配大块内存
+func readData(r io.Reader, n uint32) ([]byte, error) {
+	if n <= readChunkSize {
+		data := make([]byte, n)
+		_, err := io.ReadFull(r, data)
+		return data, err
+	}
+	var b bytes.Buffer
+	if _, err := io.CopyN(&b, r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// 读取头部与消息体的长度前缀 消息体在第一次使用 (ReadBody ReadRawBody PeekBody) 时才读取
+// 之前 FrameSize 为声明的大小 调用方可以据此决定是否读取
+func (c *framedCodec) ReadHeader(h *Header) error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.unread {
+		// 上一个消息体没有被使用
+		if err := c.SkipBody(); err != nil {
+			return err
+		}
+	}
+	data, err := c.readFrame(maxHeaderSize)
+	if err != nil {
+		return err
+	}
+	if err := c.header.DecodeHeader(data, h); err != nil {
+		return err
+	}
+	n, err := c.readSize(c.recvLimit())
+	if err != nil {
+		return err
+	}
+	c.in.Reset()
+	c.raw = nil
+	c.read = false
+	c.next, c.unread = n, true
+	c.size = int(n &^ compressedFlag)
+	return nil
+}
+
+// 读取 ReadHeader 之后尚未读取的消息体
+func (c *framedCodec) loadBody() error {
+	if !c.unread {
+		return c.err
+	}
+	c.unread = false
+	body, err := c.readFrameData(c.next, c.recvLimit())
+	if err != nil {
+		c.err = err
+		return err
+	}
+	c.in.Write(body)
+	c.raw = body
+	c.size = len(body)
+	return nil
+}
+
+// ReadHeader 之后 消息体读取之前为长度前缀声明的字节数 (压缩时为压缩后的大小)
+func (c *framedCodec) FrameSize() int {
+	return int(c.next &^ compressedFlag)
+}
+
+// 消息体之间共享解码状态时 (gob) 不能脱离连接单独解码
+func (c *framedCodec) RawBodySupported() bool {
+	sb, ok := c.body.(StatefulBody)
+	return !ok || !sb.StatefulDecoding()
+}
+
+// 读取失败时返回空 之后的 ReadHeader 返回错误
+func (c *framedCodec) ReadRawBody() []byte {
+	_ = c.loadBody()
+	data := c.raw
+	c.raw = nil
+	c.in.Reset()
+	c.read = true
+	return data
+}
+
+func (c *framedCodec) PeekBody() []byte {
+	_ = c.loadBody()
+	return c.raw
+}
+
+func (c *framedCodec) BodySize() int {
+	return c.size
+}
+
+func (c *framedCodec) ReadBody(body interface{}) error {
+	if err := c.loadBody(); err != nil {
+		return err
+	}
+	c.raw = nil
+	if c.read {
+		data, err := c.readFrame(c.recvLimit())
+		if err != nil {
+			return err
+		}
+		c.in.Write(data)
+	}
+	defer c.in.Reset()
+	c.read = true
+	return c.body.DecodeBody(body)
+}
+
+// 消息体在 ReadHeader 时已读出 直接丢弃 流式消息的后续块按长度前缀跳过 不解压
+// 消息体编解码器有状态时仍需解码
+func (c *framedCodec) SkipBody() error {
+	if sb, ok := c.body.(StatefulBody); ok && sb.StatefulDecoding() {
+		return c.ReadBody(nil)
+	}
+	switch {
+	case c.unread:
+		c.unread = false
+		if err := c.discard(c.next &^ compressedFlag); err != nil {
+			c.err = err
+			return err
+		}
+	case c.read:
+		if err := c.skipFrame(); err != nil {
+			return err
+		}
+	}
+	c.raw = nil
+	c.in.Reset()
+	c.read = true
+	return nil
+}
+
+func (c *framedCodec) skipFrame() error {
+	var size [4]byte
+	if _, err := io.ReadFull(c.r, size[:]); err != nil {
+		return err
+	}
+	return c.discard(binary.BigEndian.Uint32(size[:]) &^ compressedFlag)
+}
+
+func (c *framedCodec) discard(n uint32) error {
+	if _, err := c.r.Discard(int(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+// 帧先写入 frame 整条消息编码完成后才写入连接
+func (c *framedCodec) appendFrame(data []byte, size uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], size)
+	c.frame.Write(b[:])
+	c.frame.Write(data)
+}
+
+// 消息体帧 按阈值决定是否压缩
+func (c *framedCodec) appendBodyFrame(data []byte) {
+	data, compressed := compressBody(c.compressor, c.threshold, data)
+	size := uint32(len(data))
+	if compressed {
+		size |= compressedFlag
+	}
+	c.appendFrame(data, size)
+}
+
+func (c *framedCodec) Write(h *Header, body interface{}) error {
+	if err := c.WriteBuffered(h, body); err != nil {
+		return err
+	}
+	return c.Flush()
+}
+
+// 编码消息体 失败时保留已输出的内容(gob 的类型定义) 返回 EncodeError 连接仍然可用
+// limit 为 0 时不检查大小
+func (c *framedCodec) encodeBody(body interface{}, limit int) error {
+	if limit > 0 {
+		if n := MinBodySize(body, limit); n > limit {
+			return &EncodeError{Err: &SizeError{Size: n, Limit: limit}}
+		}
+	}
+	c.out.Reset()
+	c.limit.limit, c.limit.n = limit, 0
+	c.out.Write(c.carry)
+	c.carry = nil
+	if err := c.body.EncodeBody(body); err != nil {
+		log.Println("rpc codec: error encoding body:", err)
+		c.carry = append([]byte(nil), c.out.Bytes()...)
+		return &EncodeError{Err: err}
+	}
+	return nil
+}
+
+func (c *framedCodec) WriteBuffered(h *Header, body interface{}) (err error) {
+	defer func() {
+		var encErr *EncodeError
+		if err != nil && !errors.As(err, &encErr) {
+			_ = c.w.Flush()
+			_ = c.Close()
+		}
+	}()
+	if err := c.encodeBody(body, c.maxBody); err != nil {
+		return err
+	}
+	if c.bodyHook != nil {
+		if IsStream(h) || IsChunked(h) {
+			c.bodyHook(h, nil)
+		} else {
+			c.bodyHook(h, c.out.Bytes())
+		}
+	}
+	hdr, err := c.header.EncodeHeader(h)
+	if err != nil {
+		log.Println("rpc codec: error encoding header:", err)
+		return err
+	}
+	c.frame.Reset()
+	c.appendFrame(hdr, uint32(len(hdr)))
+	c.appendBodyFrame(c.out.Bytes())
+	_, err = c.w.Write(c.frame.Bytes())
+	return err
+}
+
+func (c *framedCodec) WriteBody(body interface{}) (err error) {
+	defer func() {
+		if err != nil {
+			_ = c.w.Flush()
+			_ = c.Close()
+		}
+	}()
+	if err := c.encodeBody(body, 0); err != nil {
+		return err
+	}
+	c.frame.Reset()
+	c.appendBodyFrame(c.out.Bytes())
+	_, err = c.w.Write(c.frame.Bytes())
+	return err
+}
+
+func (c *framedCodec) Flush() error {
+	return c.w.Flush()
+}
+
+func (c *framedCodec) Close() error {
+	return c.conn.Close()
+}
+
+func (c *framedCodec) MarshalBody(body interface{}) ([]byte, error) {
+	return marshalBody(c.newBody, body)
+}
+
+func (c *framedCodec) MarshalBodyTo(w io.Writer, body interface{}) error {
+	return marshalBodyTo(c.newBody, w, body)
+}
+
+func (c *framedCodec) UnmarshalBody(data []byte, body interface{}) error {
+	return unmarshalBody(c.newBody, c.strict, data, body)
+}
+
+func (c *framedCodec) SetStrictDecoding(strict bool) {
+	c.strict = strict
+	if sd, ok := c.body.(StrictDecoding); ok {
+		sd.SetStrictDecoding(strict)
+	}
+}
+
+func (c *framedCodec) SetMaxBodySize(n int) {
+	c.maxBody = n
+}
+
+func (c *framedCodec) SetBodyHook(hook BodyHook) {
+	c.bodyHook = hook
+}
+
+func (c *framedCodec) SetMaxReceiveSize(n int) {
+	c.maxRecv = n
+}
+
+// 消息体帧的长度上限 0 表示不限制
+func (c *framedCodec) recvLimit() uint32 {
+	if c.maxRecv <= 0 || uint64(c.maxRecv) >= compressedFlag {
+		return 0
+	}
+	return uint32(c.maxRecv)
+}
+
+func (c *framedCodec) SetCompression(comp Compressor, threshold int) {
+	c.compressor, c.threshold = comp, threshold
+}
+
+var _ Codec = (*framedCodec)(nil)
+var _ Compressible = (*framedCodec)(nil)
+var _ StrictDecoding = (*framedCodec)(nil)
+var _ BufferedWriter = (*framedCodec)(nil)
+var _ BodyWriter = (*framedCodec)(nil)
+var _ BodySizer = (*framedCodec)(nil)
+var _ FrameSizer = (*framedCodec)(nil)
+var _ BodyMarshaler = (*framedCodec)(nil)
+var _ SizeLimiter = (*framedCodec)(nil)
+var _ BodyPeeker = (*framedCodec)(nil)
+var _ BodyHooker = (*framedCodec)(nil)
+var _ RawBodyReader = (*framedCodec)(nil)
+var _ ReceiveLimiter = (*framedCodec)(nil)
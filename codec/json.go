@@ -1,60 +1,173 @@
 package codec
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
-	"log"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
 type JsonCodec struct {
-	conn io.ReadWriteCloser // socket 链接实例
-	buf  *bufio.Writer      // 缓冲区 增加性能
-	dec  *json.Decoder      // 解码器
-	enc  *json.Encoder      // 编码器
+	dec    *json.Decoder // 解码器
+	enc    *json.Encoder // 编码器
+	w      io.Writer     // 编码器的写入目标
+	strict bool          // 严格模式 拒绝未知字段
+	size   int           // 最近一次解码的消息体字节数
 }
 
-/* 实现 Codec 接口*/
-func (j *JsonCodec) ReadHeader(h *Header) error {
-	return j.dec.Decode(h)
-}
+/* 实现 BodyCodec 接口*/
+func (j *JsonCodec) DecodeBody(body interface{}) error {
+	// 先完整读出消息体 解码失败时不影响后续消息的读取
+	var raw json.RawMessage
+	if err := j.dec.Decode(&raw); err != nil {
+		return err
+	}
+	j.size = len(raw)
+	if body == nil {
+		return nil
+	}
 
-func (j *JsonCodec) ReadBody(body interface{}) error {
-	return j.dec.Decode(body)
-}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if j.strict {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(body)
+	if err == nil {
+		return nil
+	}
 
-func (j *JsonCodec) Write(h *Header, body interface{}) (err error) {
-	defer func() {
-		_ = j.buf.Flush()
-		if err != nil {
-			_ = j.Close()
-		}
-	}()
-	if err := j.enc.Encode(h); err != nil {
-		log.Println("rpc codec: gob error encoding header:", err)
-		return err
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		return &DecodeError{Field: typeErr.Field, Err: err}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return &DecodeError{Field: unknownFieldPath(raw, reflect.TypeOf(body), ""), Err: err}
 	}
-	if err := j.enc.Encode(body); err != nil {
-		log.Println("rpc codec: gob error encoding body:", err)
-		return err
+	return err
+}
+
+func (j *JsonCodec) EncodeBody(body interface{}) error {
+	err := j.enc.Encode(body)
+	var sizeErr *SizeError
+	if errors.As(err, &sizeErr) {
+		// json.Encoder 写入失败后不再可用 超出大小时没有写入任何内容 换一个新的编码器
+		j.enc = json.NewEncoder(j.w)
 	}
-	return nil
+	return err
 }
 
-func (j *JsonCodec) Close() error {
-	return j.conn.Close()
+func (j *JsonCodec) BodySize() int {
+	return j.size
+}
+
+func (j *JsonCodec) SetStrictDecoding(strict bool) {
+	j.strict = strict
 }
 
 // ? 确保接口被实现常用的方式
-var _ Codec = (*JsonCodec)(nil)
+var _ BodyCodec = (*JsonCodec)(nil)
+var _ StrictDecoding = (*JsonCodec)(nil)
+var _ BodySizer = (*JsonCodec)(nil)
 
-// 返回gob实体指针  gob编码处理机制
-func NewJsonCodec(conn io.ReadWriteCloser) Codec {
-	buf := bufio.NewWriter(conn)
+func NewJsonBodyCodec(r io.Reader, w io.Writer) BodyCodec {
 	return &JsonCodec{
-		conn: conn,
-		buf:  buf,
-		dec:  json.NewDecoder(conn),
-		enc:  json.NewEncoder(buf),
+		dec: json.NewDecoder(r),
+		enc: json.NewEncoder(w),
+		w:   w,
+	}
+}
+
+// 返回json编解码器 头部与消息体都使用 json 编码 即传统的合并格式
+func NewJsonCodec(conn io.ReadWriteCloser) Codec {
+	return NewCombinedCodec(conn, "json", NewJsonBodyCodec)
+}
+
+// 对照目标类型查找第一个未知字段 返回形如 Inner.Items[1].Name 的路径
+func unknownFieldPath(data []byte, t reflect.Type, prefix string) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return ""
+		}
+		for key, value := range obj {
+			ft, ok := jsonField(t, key)
+			path := joinPath(prefix, key)
+			if !ok {
+				return path
+			}
+			if p := unknownFieldPath(value, ft, path); p != "" {
+				return p
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if json.Unmarshal(data, &items) != nil {
+			return ""
+		}
+		for i, item := range items {
+			if p := unknownFieldPath(item, t.Elem(), prefix+"["+strconv.Itoa(i)+"]"); p != "" {
+				return p
+			}
+		}
+	case reflect.Map:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return ""
+		}
+		for key, value := range obj {
+			if p := unknownFieldPath(value, t.Elem(), joinPath(prefix, key)); p != "" {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// 按 encoding/json 的规则匹配字段: 优先 tag 名称 大小写不敏感 展开匿名结构体
+func jsonField(t reflect.Type, key string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		} else if f.Anonymous {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if t, ok := jsonField(ft, key); ok {
+					return t, true
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if strings.EqualFold(name, key) {
+			return f.Type, true
+		}
+	}
+	return nil, false
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
 	}
+	return prefix + "." + key
 }
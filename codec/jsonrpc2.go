@@ -0,0 +1,264 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmrpc/rpcerr"
+	"io"
+	"strconv"
+	"sync"
+)
+
+/*
+JSON-RPC 2.0 线上格式 https://www.jsonrpc.org/specification 只用于合并格式 每条消息一个 json 对象
+	请求 {"jsonrpc":"2.0","method":"Math.Add","params":{...},"id":1}
+	响应 {"jsonrpc":"2.0","result":{...},"id":1} 或 {"jsonrpc":"2.0","error":{"code":-32601,"message":"..."},"id":1}
+params 为参数的 json 编码 结构体参数即按名称传参 不支持按位置传参与批量请求
+写入时 id 为之前读到的请求时编码为响应 否则编码为请求 Seq 为 0 的请求(如服务端的关闭通知)编码为没有 id 的通知
+数字 id 直接作为 Seq 字符串等其他 id 分配最高位为 1 的 Seq 响应时还原 通知不发送响应
+错误的 data 为完整的 rpcerr.RPCError 元数据放在扩展字段 meta 中 没有元数据时不出现
+*/
+
+const JSONRPC2Type Type = "application/json-rpc2"
+
+const jsonrpc2Version = "2.0"
+
+// JSON-RPC 2.0 预定义的错误码
+const (
+	JSONRPC2ParseError     = -32700
+	JSONRPC2InvalidRequest = -32600
+	JSONRPC2MethodNotFound = -32601
+	JSONRPC2InvalidParams  = -32602
+	JSONRPC2InternalError  = -32603
+	JSONRPC2ServerError    = -32000 // 其他服务端错误
+)
+
+type JSONRPC2Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// 读取时使用 同时容纳请求与响应
+type jsonrpc2Message struct {
+	Version string            `json:"jsonrpc"`
+	Method  string            `json:"method"`
+	Params  json.RawMessage   `json:"params"`
+	Result  json.RawMessage   `json:"result"`
+	Error   *JSONRPC2Error    `json:"error"`
+	ID      json.RawMessage   `json:"id"`
+	Meta    map[string]string `json:"meta"`
+}
+
+type jsonrpc2Request struct {
+	Version string            `json:"jsonrpc"`
+	Method  string            `json:"method"`
+	Params  json.RawMessage   `json:"params,omitempty"`
+	ID      *uint64           `json:"id,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+type jsonrpc2Response struct {
+	Version string            `json:"jsonrpc"`
+	Result  *json.RawMessage  `json:"result,omitempty"`
+	Error   *JSONRPC2Error    `json:"error,omitempty"`
+	ID      json.RawMessage   `json:"id"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// 非数字 id 与通知使用的 Seq 最高位为 1
+const jsonrpc2SyntheticSeq = 1 << 63
+
+type JSONRPC2Codec struct {
+	conn   io.ReadWriteCloser
+	buf    *bufio.Writer
+	dec    *json.Decoder
+	enc    *json.Encoder
+	body   json.RawMessage // 当前消息的 params 或 result
+	size   int
+	strict bool
+
+	mu       sync.Mutex
+	requests map[uint64]json.RawMessage // 已读到但还没有响应的请求 Seq -> 原始 id 通知为空
+	nextSeq  uint64
+}
+
+func NewJSONRPC2Codec(conn io.ReadWriteCloser) Codec {
+	buf := bufio.NewWriter(newPoisonWriter(conn))
+	return &JSONRPC2Codec{
+		conn:     conn,
+		buf:      buf,
+		dec:      json.NewDecoder(conn),
+		enc:      json.NewEncoder(buf),
+		requests: make(map[uint64]json.RawMessage),
+	}
+}
+
+func (c *JSONRPC2Codec) ReadHeader(h *Header) error {
+	var msg jsonrpc2Message
+	if err := c.dec.Decode(&msg); err != nil {
+		return err
+	}
+	if msg.Version != jsonrpc2Version {
+		return fmt.Errorf("rpc codec: jsonrpc2: unsupported version %q", msg.Version)
+	}
+	*h = Header{Metadata: msg.Meta}
+	if msg.Method != "" {
+		h.ServiceMethod = msg.Method
+		h.Seq = c.trackRequest(msg.ID)
+		c.body = msg.Params
+		return nil
+	}
+
+	seq, err := strconv.ParseUint(string(msg.ID), 10, 64)
+	if err != nil {
+		return fmt.Errorf("rpc codec: jsonrpc2: invalid response id %s", msg.ID)
+	}
+	h.Seq = seq
+	c.body = msg.Result
+	if e := msg.Error; e != nil {
+		h.Error = e.Message
+		var status rpcerr.RPCError
+		if len(e.Data) > 0 && json.Unmarshal(e.Data, &status) == nil && status.Code != rpcerr.OK {
+			h.Status = &status
+		}
+	}
+	return nil
+}
+
+// 记录请求的原始 id 返回对应的 Seq
+func (c *JSONRPC2Codec) trackRequest(id json.RawMessage) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(id) > 0 && !bytes.Equal(id, []byte("null")) {
+		if seq, err := strconv.ParseUint(string(id), 10, 64); err == nil && seq < jsonrpc2SyntheticSeq {
+			c.requests[seq] = id
+			return seq
+		}
+	} else {
+		id = nil
+	}
+	c.nextSeq++
+	seq := jsonrpc2SyntheticSeq | c.nextSeq
+	c.requests[seq] = id
+	return seq
+}
+
+func (c *JSONRPC2Codec) ReadBody(body interface{}) error {
+	raw := c.body
+	c.body = nil
+	c.size = len(raw)
+	if body == nil || len(raw) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if c.strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(body); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return &DecodeError{Field: typeErr.Field, Err: err}
+		}
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
+
+// 消息体已随头部读出 丢弃即可
+func (c *JSONRPC2Codec) SkipBody() error {
+	c.size = len(c.body)
+	c.body = nil
+	return nil
+}
+
+func (c *JSONRPC2Codec) Write(h *Header, body interface{}) (err error) {
+	defer func() {
+		var encErr *EncodeError
+		if err != nil && !errors.As(err, &encErr) {
+			_ = c.buf.Flush()
+			_ = c.Close()
+		}
+	}()
+	c.mu.Lock()
+	id, isResponse := c.requests[h.Seq]
+	delete(c.requests, h.Seq)
+	c.mu.Unlock()
+	// 编码失败时保留请求 以便调用方改为发送错误响应
+	defer func() {
+		if err != nil && isResponse {
+			c.mu.Lock()
+			c.requests[h.Seq] = id
+			c.mu.Unlock()
+		}
+	}()
+
+	var msg interface{}
+	switch {
+	case isResponse && id == nil:
+		// 通知不需要响应
+		return nil
+	case isResponse:
+		resp := &jsonrpc2Response{Version: jsonrpc2Version, ID: id, Meta: h.Metadata}
+		if h.Error != "" {
+			resp.Error = jsonrpc2ErrorFor(h)
+		} else {
+			result, err := json.Marshal(body)
+			if err != nil {
+				return &EncodeError{Err: err}
+			}
+			resp.Result = (*json.RawMessage)(&result)
+		}
+		msg = resp
+	default:
+		req := &jsonrpc2Request{Version: jsonrpc2Version, Method: h.ServiceMethod, Meta: h.Metadata}
+		if h.Seq != 0 {
+			seq := h.Seq
+			req.ID = &seq
+		}
+		if req.Params, err = json.Marshal(body); err != nil {
+			return &EncodeError{Err: err}
+		}
+		msg = req
+	}
+	if err := c.enc.Encode(msg); err != nil {
+		return err
+	}
+	return c.buf.Flush()
+}
+
+func jsonrpc2ErrorFor(h *Header) *JSONRPC2Error {
+	e := &JSONRPC2Error{Code: JSONRPC2ServerError, Message: h.Error}
+	if h.Status == nil {
+		return e
+	}
+	switch h.Status.Code {
+	case rpcerr.NotFound:
+		e.Code = JSONRPC2MethodNotFound
+	case rpcerr.InvalidArgs:
+		e.Code = JSONRPC2InvalidParams
+	case rpcerr.Internal:
+		e.Code = JSONRPC2InternalError
+	}
+	e.Data, _ = json.Marshal(h.Status)
+	return e
+}
+
+func (c *JSONRPC2Codec) BodySize() int {
+	return c.size
+}
+
+func (c *JSONRPC2Codec) Close() error {
+	return c.conn.Close()
+}
+
+func (c *JSONRPC2Codec) SetStrictDecoding(strict bool) {
+	c.strict = strict
+}
+
+var _ Codec = (*JSONRPC2Codec)(nil)
+var _ StrictDecoding = (*JSONRPC2Codec)(nil)
+var _ BodySizer = (*JSONRPC2Codec)(nil)
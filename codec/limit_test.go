@@ -0,0 +1,68 @@
+package codec
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCodec_MaxBodySize(t *testing.T) {
+	for name, newCodec := range map[string]func(conn io.ReadWriteCloser) Codec{
+		"gob":        NewGobCodec,
+		"json":       NewJsonCodec,
+		"binary/gob": func(conn io.ReadWriteCloser) Codec { return NewFramedCodec(conn, BinaryHeaderCodec{}, NewGobBodyCodec) },
+		"binary/json": func(conn io.ReadWriteCloser) Codec {
+			return NewFramedCodec(conn, BinaryHeaderCodec{}, NewJsonBodyCodec)
+		},
+	} {
+		conn := new(bufferConn)
+		w := newCodec(conn)
+		w.(SizeLimiter).SetMaxBodySize(1024)
+		err := w.Write(&Header{ServiceMethod: "Foo.Echo", Seq: 1}, strings.Repeat("x", 1<<20))
+		var sizeErr *SizeError
+		var encErr *EncodeError
+		_assert(errors.As(err, &encErr) && errors.As(err, &sizeErr), "%s: expect size error, got %v", name, err)
+		_assert(sizeErr.Limit == 1024 && sizeErr.Size >= 1<<20, "%s: unexpected error %+v", name, sizeErr)
+		// 超出上限的消息体没有进入发送缓冲区
+		_assert(conn.Len() < 1024, "%s: %d bytes written for rejected body", name, conn.Len())
+
+		_ = w.Write(&Header{ServiceMethod: "Foo.Echo", Seq: 2}, "ok")
+		r := newCodec(&bufferConn{Buffer: conn.Buffer})
+		var h Header
+		var reply string
+		_assert(r.ReadHeader(&h) == nil && h.Seq == 2, "%s: read header after rejected body error", name)
+		_assert(r.ReadBody(&reply) == nil && reply == "ok", "%s: unexpected body %q", name, reply)
+	}
+}
+
+type sizeHintReply struct {
+	Name    string
+	Data    []byte
+	Nums    []int64
+	Items   []*sizeHintReply
+	Tags    map[int]string
+	Skipped string `json:"-"`
+	At      time.Time
+}
+
+func TestMinBodySize(t *testing.T) {
+	r := &sizeHintReply{
+		Name:    "abc",
+		Data:    make([]byte, 10),
+		Nums:    make([]int64, 5),
+		Items:   []*sizeHintReply{{Name: "de"}, nil},
+		Tags:    map[int]string{1: "xyz"},
+		Skipped: strings.Repeat("x", 100),
+	}
+	_assert(MinBodySize(r, 1<<20) == 3+10+5+2+3, "unexpected lower bound %d", MinBodySize(r, 1<<20))
+	_assert(MinBodySize(nil, 10) == 0 && MinBodySize(42, 10) == 0, "scalars have no lower bound")
+	// 超过上限后不再继续计算
+	big := make([]string, 1000)
+	for i := range big {
+		big[i] = "0123456789"
+	}
+	_assert(MinBodySize(big, 100) <= 110, "expect early exit, got %d", MinBodySize(big, 100))
+	_assert(MinBodySize(big, 1<<20) == 10000, "unexpected lower bound %d", MinBodySize(big, 1<<20))
+}
@@ -0,0 +1,39 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+写入失败后连接不再可用 部分写入的帧之后无法再接上完整的帧 对端会把后续数据解析为错误的内容
+第一次写入失败 (包括没有返回错误的短写) 时关闭连接 之后的写入直接返回 ErrPoisoned
+对端只会看到完整的帧 然后是 EOF 双方的读取循环随之结束 未完成的调用全部失败
+*/
+
+var ErrPoisoned = errors.New("rpc codec: connection poisoned by an earlier write error")
+
+type poisonWriter struct {
+	conn io.WriteCloser
+	err  error // 第一次写入的错误
+}
+
+func newPoisonWriter(conn io.WriteCloser) *poisonWriter {
+	return &poisonWriter{conn: conn}
+}
+
+func (w *poisonWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrPoisoned, w.err)
+	}
+	n, err := w.conn.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		w.err = err
+		_ = w.conn.Close()
+	}
+	return n, err
+}
@@ -0,0 +1,111 @@
+package codec
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errBroken = errors.New("broken pipe")
+
+// 写满 budget 字节后返回短写或错误 之后的写入又能成功 模拟 socket 缓冲区满后恢复
+type flakyConn struct {
+	net.Conn
+	budget int
+	short  bool
+}
+
+func (c *flakyConn) Write(p []byte) (int, error) {
+	if c.budget < 0 || len(p) <= c.budget {
+		c.budget -= len(p)
+		if c.budget < 0 {
+			c.budget = -1
+		}
+		return c.Conn.Write(p)
+	}
+	n, _ := c.Conn.Write(p[:c.budget])
+	c.budget = -1
+	if c.short {
+		return n, nil
+	}
+	return n, errBroken
+}
+
+func TestCodec_PoisonAfterPartialWrite(t *testing.T) {
+	for _, f := range []struct {
+		header HeaderType
+		body   Type
+	}{
+		{CombinedHeader, GobType}, {CombinedHeader, JsonType}, {BinaryHeader, GobType}, {BinaryHeader, JsonType},
+	} {
+		for seed := int64(0); seed < 20; seed++ {
+			rng := rand.New(rand.NewSource(seed))
+			local, peer := net.Pipe()
+			flaky := &flakyConn{Conn: local, budget: rng.Intn(40000), short: rng.Intn(2) == 0}
+			w, _ := New(flaky, f.header, f.body)
+			r, _ := New(peer, f.header, f.body)
+			_ = peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			var mu sync.Mutex
+			var wg sync.WaitGroup
+			failed := false
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 20; i++ {
+						seq := g*20 + i + 1
+						mu.Lock()
+						err := w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: uint64(seq)}, &Args{Num1: seq, Num2: -seq, Tags: []string{strings.Repeat("x", seq*7)}})
+						_assert(!failed || err != nil, "%s/%s seed %d: write after a failed write should fail", f.header, f.body, seed)
+						failed = failed || err != nil
+						mu.Unlock()
+					}
+				}(g)
+			}
+
+			// 对端只看到完整的消息 然后是 EOF
+			var readErr error
+			for {
+				var h Header
+				var args Args
+				if readErr = r.ReadHeader(&h); readErr != nil {
+					break
+				}
+				if readErr = r.ReadBody(&args); readErr != nil {
+					break
+				}
+				seq := int(h.Seq)
+				_assert(h.ServiceMethod == "Foo.Sum" && args.Num1 == seq && args.Num2 == -seq && len(args.Tags) == 1 && len(args.Tags[0]) == seq*7,
+					"%s/%s seed %d: corrupted message %+v %+v", f.header, f.body, seed, h, args)
+			}
+			wg.Wait()
+			_assert(errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF), "%s/%s seed %d: expect EOF, got %v", f.header, f.body, seed, readErr)
+			_ = w.Close()
+			_ = r.Close()
+		}
+	}
+}
+
+func TestCodec_PoisonClosesOnFlushError(t *testing.T) {
+	for _, ht := range []HeaderType{CombinedHeader, BinaryHeader} {
+		local, peer := net.Pipe()
+		w, _ := New(&flakyConn{Conn: local, budget: 10, short: true}, ht, GobType)
+		r, _ := New(peer, ht, GobType)
+		_ = peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+		go func() {
+			err := w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 1}, &Args{Num1: 1})
+			_assert(errors.Is(err, io.ErrShortWrite), "expect short write, got %v", err)
+		}()
+		// 没有后续写入 连接也已关闭
+		var h Header
+		err := r.ReadHeader(&h)
+		_assert(errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF), "%s: expect EOF, got %v", ht, err)
+		_ = r.Close()
+	}
+}
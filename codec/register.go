@@ -0,0 +1,30 @@
+package codec
+
+import (
+	"encoding/gob"
+	"log"
+	"reflect"
+	"sync"
+)
+
+// 已注册到 gob 的类型 避免重复注册
+var gobTypes sync.Map // reflect.Type -> struct{}
+
+// 注册 gob 编码接口值时需要的具体类型 重复注册同一类型是安全的
+// 与已注册的其他类型名称冲突时只记录日志 不会 panic
+func RegisterGobType(val interface{}) {
+	if val == nil {
+		return
+	}
+	t := reflect.TypeOf(val)
+	if _, loaded := gobTypes.LoadOrStore(t, struct{}{}); loaded {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			gobTypes.Delete(t)
+			log.Printf("rpc codec: register gob type %s error: %v", t, r)
+		}
+	}()
+	gob.Register(val)
+}
@@ -0,0 +1,99 @@
+package codec
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+/*
+合并格式编解码器的注册表 替代包级别的 map
+测试与插件可以使用独立的注册表 不影响 DefaultCodecRegistry
+拆分头部的格式仍使用 HeaderCodecMap 与 NewBodyCodecFuncMap
+*/
+
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs map[Type]NewCodecFunc
+}
+
+func NewCodecRegistry() *CodecRegistry {
+	return &CodecRegistry{codecs: make(map[Type]NewCodecFunc)}
+}
+
+// 内置 gob json 与 JSON-RPC 2.0
+var DefaultCodecRegistry *CodecRegistry
+
+func init() {
+	DefaultCodecRegistry = NewCodecRegistry()
+	DefaultCodecRegistry.Register(GobType, NewGobCodec)
+	DefaultCodecRegistry.Register(JsonType, NewJsonCodec)
+	DefaultCodecRegistry.Register(JSONRPC2Type, NewJSONRPC2Codec)
+}
+
+// 已存在时替换 fn 为空时删除
+func (r *CodecRegistry) Register(t Type, fn NewCodecFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fn == nil {
+		delete(r.codecs, t)
+		return
+	}
+	r.codecs[t] = fn
+}
+
+// 未注册时返回空
+func (r *CodecRegistry) Lookup(t Type) NewCodecFunc {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.codecs[t]
+}
+
+// 已注册的类型 排序后返回
+func (r *CodecRegistry) Types() []Type {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]Type, 0, len(r.codecs))
+	for t := range r.codecs {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// 按头部格式与消息体类型创建编解码器 头部格式为空时使用传统的合并格式
+func (r *CodecRegistry) New(conn io.ReadWriteCloser, header HeaderType, body Type) (Codec, error) {
+	if header == CombinedHeader {
+		f := r.Lookup(body)
+		if f == nil {
+			return nil, fmt.Errorf("invalid codec type %s", body)
+		}
+		return f(conn), nil
+	}
+	hc := HeaderCodecMap[header]
+	if hc == nil {
+		return nil, fmt.Errorf("invalid header type %s", header)
+	}
+	f := NewBodyCodecFuncMap[body]
+	if f == nil {
+		return nil, fmt.Errorf("invalid codec type %s", body)
+	}
+	return NewFramedCodec(conn, hc, f), nil
+}
+
+// 是否支持该头部格式与消息体类型的组合
+func (r *CodecRegistry) Supported(header HeaderType, body Type) bool {
+	if header == CombinedHeader {
+		return r.Lookup(body) != nil
+	}
+	return HeaderCodecMap[header] != nil && NewBodyCodecFuncMap[body] != nil
+}
+
+// 为空时返回 DefaultCodecRegistry
+func RegistryOrDefault(r *CodecRegistry) *CodecRegistry {
+	if r == nil {
+		return DefaultCodecRegistry
+	}
+	return r
+}
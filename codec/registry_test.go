@@ -0,0 +1,26 @@
+package codec
+
+import (
+	"io"
+	"testing"
+)
+
+func TestCodecRegistry_Isolated(t *testing.T) {
+	const custom Type = "application/x-custom"
+	r := NewCodecRegistry()
+	r.Register(custom, func(conn io.ReadWriteCloser) Codec { return NewJsonCodec(conn) })
+
+	_assert(r.Lookup(custom) != nil, "custom codec should be registered")
+	_assert(len(r.Types()) == 1 && r.Types()[0] == custom, "unexpected types %v", r.Types())
+	_assert(r.Supported(CombinedHeader, custom) && !r.Supported(CombinedHeader, GobType), "custom registry should only support its own codecs")
+
+	_assert(DefaultCodecRegistry.Lookup(custom) == nil, "default registry should not be affected")
+	_assert(!Supported(CombinedHeader, custom), "default registry should not be affected")
+	types := DefaultCodecRegistry.Types()
+	_assert(len(types) == 3 && types[0] == GobType && types[1] == JsonType && types[2] == JSONRPC2Type, "unexpected default types %v", types)
+
+	_, err := r.New(new(bufferConn), CombinedHeader, GobType)
+	_assert(err != nil, "expect error for unregistered type")
+	r.Register(custom, nil)
+	_assert(r.Lookup(custom) == nil, "registering nil should remove the codec")
+}
@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+)
+
+/*
+消息体编码结果大小的下界 设置了 SizeLimiter 时在编码前检查
+gob 与 json 都至少为字符串与字节切片的每个字节 其他切片的每个元素输出一个字节
+明显超出上限的结果 (如大的字节切片) 不必完整编码后才被拒绝
+自定义编码的类型与 json:"-" 的字段输出多少不确定 不计入
+*/
+
+var (
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	gobEncoderType      = reflect.TypeOf((*gob.GobEncoder)(nil)).Elem()
+)
+
+func customEncoded(t reflect.Type) bool {
+	for _, it := range []reflect.Type{jsonMarshalerType, textMarshalerType, binaryMarshalerType, gobEncoderType} {
+		if t.Implements(it) || reflect.PointerTo(t).Implements(it) {
+			return true
+		}
+	}
+	return false
+}
+
+// 递归的深度上限 更深的部分不计入 结果仍是下界
+const sizeHintDepth = 16
+
+// 编码结果至少有多少字节 超过 limit 后立即返回
+func MinBodySize(body interface{}, limit int) int {
+	if body == nil {
+		return 0
+	}
+	return minValueSize(reflect.ValueOf(body), limit, 0)
+}
+
+func minValueSize(v reflect.Value, limit, depth int) int {
+	if depth > sizeHintDepth || !v.IsValid() || customEncoded(v.Type()) {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.Len()
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return minValueSize(v.Elem(), limit, depth+1)
+	case reflect.Slice, reflect.Array:
+		if scalarKind(v.Type().Elem().Kind()) {
+			return v.Len()
+		}
+		n := 0
+		for i := 0; i < v.Len() && n <= limit; i++ {
+			n += minValueSize(v.Index(i), limit-n, depth+1)
+		}
+		return n
+	case reflect.Map:
+		n := 0
+		iter := v.MapRange()
+		for n <= limit && iter.Next() {
+			n += minValueSize(iter.Key(), limit-n, depth+1)
+			n += minValueSize(iter.Value(), limit-n, depth+1)
+		}
+		return n
+	case reflect.Struct:
+		n := 0
+		for i := 0; i < v.NumField() && n <= limit; i++ {
+			if f := v.Type().Field(i); f.IsExported() && f.Tag.Get("json") != "-" {
+				n += minValueSize(v.Field(i), limit-n, depth+1)
+			}
+		}
+		return n
+	}
+	return 0
+}
+
+// 每个元素至少编码为一个字节的类型
+func scalarKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
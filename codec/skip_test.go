@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// 只有旧接口的编解码器 没有 SkipBody
+type legacyOnly struct {
+	LegacyCodec
+}
+
+var skipCodecs = map[string]func(conn io.ReadWriteCloser) Codec{
+	"gob":        NewGobCodec,
+	"json":       NewJsonCodec,
+	"binary/gob": func(conn io.ReadWriteCloser) Codec { return NewFramedCodec(conn, BinaryHeaderCodec{}, NewGobBodyCodec) },
+	"binary/json": func(conn io.ReadWriteCloser) Codec {
+		return NewFramedCodec(conn, BinaryHeaderCodec{}, NewJsonBodyCodec)
+	},
+	"jsonrpc2":   NewJSONRPC2Codec,
+	"split/gob":  func(conn io.ReadWriteCloser) Codec { return NewSplitGobCodec(conn, 0) },
+	"legacy/gob": func(conn io.ReadWriteCloser) Codec { return AdaptLegacyCodec(legacyOnly{NewGobCodec(conn)}) },
+}
+
+func TestCodec_SkipBodyKeepsAlignment(t *testing.T) {
+	for name, newCodec := range skipCodecs {
+		t.Run(name, func(t *testing.T) {
+			conn := new(bufferConn)
+			w := newCodec(conn)
+			for i := 0; i < 4; i++ {
+				_assert(w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: uint64(i + 1)}, Args{Num1: i, Tags: []string{"x"}}) == nil, "write error")
+			}
+			_ = w.Close()
+
+			r := newCodec(&bufferConn{Buffer: conn.Buffer})
+			defer func() { _ = r.Close() }()
+			for i := 0; i < 4; i++ {
+				var h Header
+				_assert(r.ReadHeader(&h) == nil && h.Seq == uint64(i+1), "%s: read header %d error, got %+v", name, i, h)
+				// 跳过的第一条消息带有 gob 的类型定义 之后的消息仍能解码
+				if i%2 == 0 {
+					_assert(r.SkipBody() == nil, "%s: skip body %d error", name, i)
+					continue
+				}
+				var args Args
+				_assert(r.ReadBody(&args) == nil, "%s: read body %d error", name, i)
+				_assert(args.Num1 == i && len(args.Tags) == 1, "%s: unexpected body %+v", name, args)
+			}
+			var h Header
+			_assert(r.ReadHeader(&h) != nil, "%s: expect end of stream", name)
+		})
+	}
+}
+
+// 流式消息的后续块也可以跳过
+func TestCodec_SkipStreamChunk(t *testing.T) {
+	for name, newCodec := range skipCodecs {
+		conn := new(bufferConn)
+		w := newCodec(conn)
+		bw, ok := w.(BodyWriter)
+		if !ok {
+			continue
+		}
+		_ = w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 1}, Args{Num1: 1})
+		_ = bw.WriteBody(Args{Num1: 2})
+		_ = w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 2}, Args{Num1: 3})
+
+		r := newCodec(&bufferConn{Buffer: conn.Buffer})
+		var h Header
+		var args Args
+		_assert(r.ReadHeader(&h) == nil && r.ReadBody(&args) == nil && args.Num1 == 1, "%s: read first chunk error", name)
+		_assert(r.SkipBody() == nil, "%s: skip second chunk error", name)
+		_assert(r.ReadHeader(&h) == nil && h.Seq == 2, "%s: read header after skipped chunk error", name)
+		_assert(r.ReadBody(&args) == nil && args.Num1 == 3, "%s: unexpected body %+v", name, args)
+	}
+}
+
+func TestCodec_SkipCompressedBody(t *testing.T) {
+	gz, _ := GetCompressor("gzip")
+	conn := new(bufferConn)
+	w := NewFramedCodec(conn, BinaryHeaderCodec{}, NewJsonBodyCodec)
+	w.(Compressible).SetCompression(gz, 100)
+	_ = w.Write(&Header{ServiceMethod: "Foo.Echo", Seq: 1}, strings.Repeat("compressible ", 100))
+	_ = w.Write(&Header{ServiceMethod: "Foo.Echo", Seq: 2}, "tiny")
+
+	var h Header
+	var reply string
+	r := NewFramedCodec(&bufferConn{Buffer: conn.Buffer}, BinaryHeaderCodec{}, NewJsonBodyCodec)
+	r.(Compressible).SetCompression(gz, 100)
+	_assert(r.ReadHeader(&h) == nil && r.SkipBody() == nil, "skip compressed body error")
+	_assert(r.ReadHeader(&h) == nil && h.Seq == 2, "read header after skip error")
+	_assert(r.ReadBody(&reply) == nil && reply == "tiny", "unexpected body %q", reply)
+}
@@ -0,0 +1,253 @@
+package codec
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+/*
+读写分离的编解码器 每个方向一个 goroutine
+写: Write 只把消息放入队列即返回 由编码 goroutine 依次编码 队列空时才刷新缓冲区 多个并发写入合并为一次系统调用
+    队列满时 Write 阻塞 编码出错后后续的 Write 都返回该错误
+读: 解码 goroutine 读到消息体后立即读取下一个头部 与调用方处理上一条消息重叠 对调用方仍是同步的 ReadHeader/ReadBody
+写入是异步的 Write 返回后消息体仍可能在编码 调用方不能再修改它
+*/
+
+var ErrCodecClosed = errors.New("rpc codec: codec is closed")
+
+// 默认的写队列长度
+const DefaultWriteQueueSize = 64
+
+type writeJob struct {
+	h    Header
+	body interface{}
+}
+
+// 解码 goroutine 收到后调用 inner.SkipBody
+type skipBody struct{}
+
+type readResult struct {
+	h   Header
+	err error
+}
+
+type SplitCodec struct {
+	inner Codec
+
+	jobs     chan writeJob
+	quit     chan struct{}
+	encDone  chan struct{}
+	werrMu   sync.Mutex
+	werr     error
+	quitOnce sync.Once
+
+	readOnce sync.Once
+	headers  chan readResult
+	bodies   chan interface{} // ReadBody 的目标 skipBody 表示丢弃
+	bodyErrs chan error
+	rerr     error // 读到的第一个错误 之后的 ReadHeader 都返回它
+}
+
+// 包装任意编解码器 inner 只会被两个内部 goroutine 使用 writeQueueSize <= 0 时使用 DefaultWriteQueueSize
+func NewSplitCodec(inner Codec, writeQueueSize int) *SplitCodec {
+	if writeQueueSize <= 0 {
+		writeQueueSize = DefaultWriteQueueSize
+	}
+	c := &SplitCodec{
+		inner:    inner,
+		jobs:     make(chan writeJob, writeQueueSize),
+		quit:     make(chan struct{}),
+		encDone:  make(chan struct{}),
+		headers:  make(chan readResult),
+		bodies:   make(chan interface{}),
+		bodyErrs: make(chan error),
+	}
+	go c.encodeLoop()
+	return c
+}
+
+// gob 合并格式的读写分离版本 线上格式与 NewGobCodec 相同
+func NewSplitGobCodec(conn io.ReadWriteCloser, writeQueueSize int) Codec {
+	return NewSplitCodec(NewGobCodec(conn), writeQueueSize)
+}
+
+func (c *SplitCodec) writeErr() error {
+	c.werrMu.Lock()
+	defer c.werrMu.Unlock()
+	return c.werr
+}
+
+func (c *SplitCodec) encode(job writeJob) {
+	if c.writeErr() != nil {
+		return
+	}
+	var err error
+	if bw, ok := c.inner.(BufferedWriter); ok {
+		err = bw.WriteBuffered(&job.h, job.body)
+	} else {
+		err = c.inner.Write(&job.h, job.body)
+	}
+	if err != nil {
+		c.werrMu.Lock()
+		c.werr = err
+		c.werrMu.Unlock()
+	}
+}
+
+func (c *SplitCodec) flush() {
+	bw, ok := c.inner.(BufferedWriter)
+	if !ok || c.writeErr() != nil {
+		return
+	}
+	if err := bw.Flush(); err != nil {
+		c.werrMu.Lock()
+		c.werr = err
+		c.werrMu.Unlock()
+	}
+}
+
+func (c *SplitCodec) encodeLoop() {
+	defer close(c.encDone)
+	for {
+		select {
+		case job := <-c.jobs:
+			c.encode(job)
+		case <-c.quit:
+			// 关闭前写完已入队的消息
+			for {
+				select {
+				case job := <-c.jobs:
+					c.encode(job)
+				default:
+					c.flush()
+					return
+				}
+			}
+		}
+		if len(c.jobs) == 0 {
+			c.flush()
+		}
+	}
+}
+
+// 入队后立即返回 返回的错误来自之前的写入或关闭
+func (c *SplitCodec) Write(h *Header, body interface{}) error {
+	if err := c.writeErr(); err != nil {
+		return err
+	}
+	select {
+	case <-c.quit:
+		return ErrCodecClosed
+	default:
+	}
+	select {
+	case c.jobs <- writeJob{h: *h, body: body}:
+		return nil
+	case <-c.quit:
+		return ErrCodecClosed
+	}
+}
+
+func (c *SplitCodec) decodeLoop() {
+	defer close(c.headers)
+	for {
+		var h Header
+		err := c.inner.ReadHeader(&h)
+		select {
+		case c.headers <- readResult{h: h, err: err}:
+		case <-c.quit:
+			return
+		}
+		if err != nil {
+			return
+		}
+		var body interface{}
+		select {
+		case body = <-c.bodies:
+		case <-c.quit:
+			return
+		}
+		if _, skip := body.(skipBody); skip {
+			err = c.inner.SkipBody()
+		} else {
+			err = c.inner.ReadBody(body)
+		}
+		select {
+		case c.bodyErrs <- err:
+		case <-c.quit:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// 解码 goroutine 在第一次读取时启动 之前仍可设置 StrictDecoding 等选项
+func (c *SplitCodec) ReadHeader(h *Header) error {
+	c.readOnce.Do(func() { go c.decodeLoop() })
+	if c.rerr != nil {
+		return c.rerr
+	}
+	r, ok := <-c.headers
+	if !ok {
+		c.rerr = ErrCodecClosed
+		return c.rerr
+	}
+	if r.err != nil {
+		c.rerr = r.err
+		return r.err
+	}
+	*h = r.h
+	return nil
+}
+
+func (c *SplitCodec) ReadBody(body interface{}) error {
+	return c.readBody(body)
+}
+
+func (c *SplitCodec) SkipBody() error {
+	return c.readBody(skipBody{})
+}
+
+func (c *SplitCodec) readBody(body interface{}) error {
+	if c.rerr != nil {
+		return c.rerr
+	}
+	select {
+	case c.bodies <- body:
+	case <-c.quit:
+		return ErrCodecClosed
+	}
+	select {
+	case err := <-c.bodyErrs:
+		if err != nil {
+			c.rerr = err
+		}
+		return err
+	case <-c.quit:
+		return ErrCodecClosed
+	}
+}
+
+// 写完队列中的消息后关闭连接 重复关闭返回 nil
+func (c *SplitCodec) Close() error {
+	var err error
+	c.quitOnce.Do(func() {
+		close(c.quit)
+		<-c.encDone
+		err = c.inner.Close()
+	})
+	return err
+}
+
+// 需要在第一次读取前设置
+func (c *SplitCodec) SetStrictDecoding(strict bool) {
+	if sd, ok := c.inner.(StrictDecoding); ok {
+		sd.SetStrictDecoding(strict)
+	}
+}
+
+var _ Codec = (*SplitCodec)(nil)
+var _ StrictDecoding = (*SplitCodec)(nil)
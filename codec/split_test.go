@@ -0,0 +1,119 @@
+package codec
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestSplitCodec_ConcurrentWrites(t *testing.T) {
+	a, b := net.Pipe()
+	split := NewSplitGobCodec(a, 4)
+	peer := NewGobCodec(b)
+	defer func() { _ = peer.Close() }()
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := split.Write(&Header{ServiceMethod: "Foo.Sum", Seq: uint64(i)}, &Args{Num1: i, Num2: i})
+			_assert(err == nil, "write %d failed: %v", i, err)
+		}(i)
+	}
+
+	seen := make(map[uint64]bool)
+	for i := 0; i < n; i++ {
+		var h Header
+		var args Args
+		_assert(peer.ReadHeader(&h) == nil && peer.ReadBody(&args) == nil, "read %d failed", i)
+		_assert(args.Num1 == int(h.Seq) && !seen[h.Seq], "unexpected message %+v %+v", h, args)
+		seen[h.Seq] = true
+	}
+	wg.Wait()
+
+	// 反方向 读取经过解码 goroutine
+	go func() {
+		for i := 0; i < 3; i++ {
+			_ = peer.Write(&Header{ServiceMethod: "Foo.Sum", Seq: uint64(i)}, &Args{Num1: i})
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		var h Header
+		var args Args
+		_assert(split.ReadHeader(&h) == nil, "read header %d failed", i)
+		if i == 1 {
+			_assert(split.ReadBody(nil) == nil, "discard body failed")
+			continue
+		}
+		_assert(split.ReadBody(&args) == nil && args.Num1 == i && h.Seq == uint64(i), "unexpected reply %+v %+v", h, args)
+	}
+	_ = split.Close()
+}
+
+func TestSplitCodec_CloseFlushesQueue(t *testing.T) {
+	a, b := net.Pipe()
+	split := NewSplitGobCodec(a, 8)
+	peer := NewGobCodec(b)
+	defer func() { _ = peer.Close() }()
+
+	for i := 0; i < 5; i++ {
+		_assert(split.Write(&Header{Seq: uint64(i)}, &Args{Num1: i}) == nil, "write %d failed", i)
+	}
+	done := make(chan error, 1)
+	go func() { done <- split.Close() }()
+	for i := 0; i < 5; i++ {
+		var h Header
+		var args Args
+		_assert(peer.ReadHeader(&h) == nil && peer.ReadBody(&args) == nil && args.Num1 == i, "queued message %d lost", i)
+	}
+	_assert(<-done == nil, "close failed")
+	_assert(split.Write(&Header{}, &Args{}) == ErrCodecClosed, "write after close should fail")
+	var h Header
+	_assert(split.ReadHeader(&h) != nil, "read after close should fail")
+}
+
+// 50 个 goroutine 竞争同一连接的写入 GobCodec 由调用方加锁串行 与客户端的 sending 锁一致
+func BenchmarkSplitCodec_Contention(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		split bool
+	}{{"gob", false}, {"split", true}} {
+		b.Run(bc.name, func(b *testing.B) {
+			a, peer := net.Pipe()
+			go func() { _, _ = io.Copy(io.Discard, peer) }()
+			var cc Codec
+			if bc.split {
+				cc = NewSplitGobCodec(a, 0)
+			} else {
+				cc = NewGobCodec(a)
+			}
+			var mu sync.Mutex
+			args := &Args{Num1: 1, Num2: 2, Tags: []string{"a", "b"}}
+
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for g := 0; g < 50; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := g; i < b.N; i += 50 {
+						h := &Header{ServiceMethod: "Foo.Sum", Seq: uint64(i)}
+						if !bc.split {
+							mu.Lock()
+						}
+						_ = cc.Write(h, args)
+						if !bc.split {
+							mu.Unlock()
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+			_ = cc.Close()
+			_ = peer.Close()
+		})
+	}
+}
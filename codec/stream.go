@@ -0,0 +1,181 @@
+package codec
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+/*
+流式消息体 请求头之后依次写入若干 []byte 块 以空块结束 不需要把整个消息体读入内存
+请求头的元数据中带有 StreamMetadataKey 对端据此按块读取 即使对端不接受流也能完整丢弃
+*/
+
+const (
+	StreamMetadataKey = "x-rpc-stream"
+	StreamChunkSize   = 32 << 10
+)
+
+// 流式参数 服务端方法的参数类型为 StreamingArg 时 Reader 直接读取连接上的数据
+// 作为结果时 处理函数设置 Reader 服务端分块发送后关闭
+type StreamingArg struct {
+	Reader io.ReadCloser
+}
+
+func (s *StreamingArg) Read(p []byte) (int, error) {
+	if s.Reader == nil {
+		return 0, io.EOF
+	}
+	return s.Reader.Read(p)
+}
+
+func (s *StreamingArg) Close() error {
+	if s.Reader == nil {
+		return nil
+	}
+	return s.Reader.Close()
+}
+
+var _ io.ReadCloser = (*StreamingArg)(nil)
+
+// 可选接口 在请求头之后继续写入一个消息体 需要配合 BufferedWriter 刷新
+type BodyWriter interface {
+	WriteBody(body interface{}) error
+}
+
+var ErrStreamUnsupported = errors.New("rpc codec: codec does not support streaming")
+
+// 是否为流式消息
+func IsStream(h *Header) bool {
+	_, ok := h.Metadata[StreamMetadataKey]
+	return ok
+}
+
+// 写入请求头 并把 r 的内容分块写入 调用方需保证写入期间独占连接
+func WriteStream(cc Codec, h *Header, r io.Reader) error {
+	bw, ok := cc.(BufferedWriter)
+	bodyw, ok2 := cc.(BodyWriter)
+	if !ok || !ok2 {
+		return ErrStreamUnsupported
+	}
+	md := make(map[string]string, len(h.Metadata)+1)
+	for k, v := range h.Metadata {
+		md[k] = v
+	}
+	md[StreamMetadataKey] = "chunked"
+	hh := *h
+	hh.Metadata = md
+
+	buf := make([]byte, StreamChunkSize)
+	first := true
+	write := func(chunk []byte) error {
+		if first {
+			first = false
+			return bw.WriteBuffered(&hh, chunk)
+		}
+		return bodyw.WriteBody(chunk)
+	}
+	for {
+		// 读到的数据立即发送 产生得慢的流 (如事件推送) 不必等待凑满一块
+		n, err := r.Read(buf)
+		if n > 0 {
+			if werr := write(buf[:n]); werr != nil {
+				return werr
+			}
+			if werr := bw.Flush(); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// 读取失败时仍然结束流 保持连接可用
+			if werr := write([]byte{}); werr != nil {
+				return werr
+			}
+			_ = bw.Flush()
+			return err
+		}
+	}
+	if err := write([]byte{}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// 从连接上按块读取流式消息体 读到结束块或关闭后 Done 返回的通道关闭
+// 在此之前连接上的下一条消息不能读取
+type StreamReader struct {
+	cc    Codec
+	mu    sync.Mutex
+	chunk []byte
+	err   error
+	done  chan struct{}
+}
+
+// 在 ReadHeader 读到流式消息头后调用
+func NewStreamReader(cc Codec) *StreamReader {
+	return &StreamReader{cc: cc, done: make(chan struct{})}
+}
+
+func (s *StreamReader) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.chunk) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.next()
+	}
+	n := copy(p, s.chunk)
+	s.chunk = s.chunk[n:]
+	return n, nil
+}
+
+// 读取下一块 调用方持有锁
+func (s *StreamReader) next() {
+	var chunk []byte
+	if err := s.cc.ReadBody(&chunk); err != nil {
+		s.finish(err)
+		return
+	}
+	if len(chunk) == 0 {
+		s.finish(io.EOF)
+		return
+	}
+	s.chunk = chunk
+}
+
+func (s *StreamReader) finish(err error) {
+	s.err = err
+	s.chunk = nil
+	close(s.done)
+}
+
+// 丢弃剩余的数据直到流结束
+func (s *StreamReader) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.err == nil {
+		s.next()
+	}
+	s.chunk = nil
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+func (s *StreamReader) Done() <-chan struct{} {
+	return s.done
+}
+
+// 流结束的原因 正常结束为 io.EOF
+func (s *StreamReader) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+var _ io.ReadCloser = (*StreamReader)(nil)
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+从 YAML 读取 Option 字段名与 Option 相同 首字母小写 时间使用 time.Duration 的字符串形式
+	magicNumber: 0x3bef5c
+	codecType: application/gob
+	connectTimeout: ${CONNECT_TIMEOUT}
+解析前以环境变量替换 ${VAR} 未设置的变量替换为空字符串 未知字段与不支持的编码都返回错误
+*/
+
+// 文件中的字段 未出现的字段保持默认值
+type optionFile struct {
+	MagicNumber       *int              `yaml:"magicNumber"`
+	CodecType         *codec.Type       `yaml:"codecType"`
+	HeaderType        *codec.HeaderType `yaml:"headerType"`
+	ConnectTimeout    *time.Duration    `yaml:"connectTimeout"`
+	HandleTimeout     *time.Duration    `yaml:"handleTimeout"`
+	StrictDecoding    *bool             `yaml:"strictDecoding"`
+	Capabilities      *bool             `yaml:"capabilities"`
+	Compression       *string           `yaml:"compression"`
+	ProtocolVersion   *int              `yaml:"protocolVersion"`
+	CompressThreshold *int              `yaml:"compressThreshold"` // 只用于客户端
+	LargeArgThreshold *int64            `yaml:"largeArgThreshold"` // 只用于客户端
+	BinaryOption      *bool             `yaml:"binaryOption"`      // 只用于客户端
+}
+
+// 服务端使用的 Option 未出现的字段为零值
+func LoadServerOption(r io.Reader) (*server.Option, error) {
+	opt := &server.Option{}
+	if err := load(r, opt, false); err != nil {
+		return nil, err
+	}
+	return opt, nil
+}
+
+func LoadServerOptionFile(path string) (*server.Option, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return LoadServerOption(f)
+}
+
+// 客户端使用的 Option 未出现的字段使用 server.DefaultOption 中的值
+func LoadClientOption(r io.Reader) (*server.Option, error) {
+	opt := *server.DefaultOption
+	if err := load(r, &opt, true); err != nil {
+		return nil, err
+	}
+	return &opt, nil
+}
+
+func load(r io.Reader, opt *server.Option, client bool) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	expanded := os.Expand(string(data), os.Getenv)
+	var f optionFile
+	dec := yaml.NewDecoder(bytes.NewReader([]byte(expanded)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && err != io.EOF {
+		return fmt.Errorf("rpc config: %w", err)
+	}
+	if f.CompressThreshold != nil && !client {
+		return errors.New("rpc config: compressThreshold is a client option")
+	}
+	if f.LargeArgThreshold != nil && !client {
+		return errors.New("rpc config: largeArgThreshold is a client option")
+	}
+	if f.BinaryOption != nil && !client {
+		return errors.New("rpc config: binaryOption is a client option")
+	}
+	f.apply(opt)
+	return validate(opt)
+}
+
+func (f *optionFile) apply(opt *server.Option) {
+	if f.MagicNumber != nil {
+		opt.MagicNumber = *f.MagicNumber
+	}
+	if f.CodecType != nil {
+		opt.CodecType = *f.CodecType
+	}
+	if f.HeaderType != nil {
+		opt.HeaderType = *f.HeaderType
+	}
+	if f.ConnectTimeout != nil {
+		opt.ConnectTimeout = *f.ConnectTimeout
+	}
+	if f.HandleTimeout != nil {
+		opt.HandleTimeout = *f.HandleTimeout
+	}
+	if f.StrictDecoding != nil {
+		opt.StrictDecoding = *f.StrictDecoding
+	}
+	if f.Capabilities != nil {
+		opt.Capabilities = *f.Capabilities
+	}
+	if f.Compression != nil {
+		opt.Compression = *f.Compression
+	}
+	if f.ProtocolVersion != nil {
+		opt.ProtocolVersion = *f.ProtocolVersion
+	}
+	if f.CompressThreshold != nil {
+		opt.CompressThreshold = *f.CompressThreshold
+	}
+	if f.LargeArgThreshold != nil {
+		opt.LargeArgThresholdBytes = *f.LargeArgThreshold
+	}
+	if f.BinaryOption != nil {
+		opt.BinaryOption = *f.BinaryOption
+	}
+}
+
+func validate(opt *server.Option) error {
+	switch {
+	case opt.MagicNumber == 0:
+		return errors.New("rpc config: magicNumber is required")
+	case opt.MagicNumber != server.MagicNumber:
+		return fmt.Errorf("rpc config: invalid magicNumber %#x", opt.MagicNumber)
+	case !codec.DefaultCodecRegistry.Supported(opt.HeaderType, opt.CodecType):
+		return fmt.Errorf("rpc config: unsupported codec %s/%s", opt.HeaderType, opt.CodecType)
+	case opt.ConnectTimeout < 0 || opt.HandleTimeout < 0:
+		return errors.New("rpc config: timeouts must not be negative")
+	case opt.ProtocolVersion < 0:
+		return errors.New("rpc config: protocolVersion must not be negative")
+	}
+	return nil
+}
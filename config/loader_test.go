@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"gmrpc/codec"
+	"gmrpc/server"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+func TestLoadServerOption(t *testing.T) {
+	t.Setenv("RPC_CODEC", "application/json")
+	t.Setenv("RPC_HANDLE_TIMEOUT", "1.5s")
+	yml := `
+magicNumber: 0x3bef5c
+codecType: ${RPC_CODEC}
+headerType: binary
+handleTimeout: ${RPC_HANDLE_TIMEOUT}
+strictDecoding: true
+compression: gzip,deflate
+`
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	_assert(os.WriteFile(path, []byte(yml), 0o600) == nil, "write file")
+	opt, err := LoadServerOptionFile(path)
+	_assert(err == nil, "load error: %v", err)
+	want := server.Option{
+		MagicNumber:    server.MagicNumber,
+		CodecType:      codec.JsonType,
+		HeaderType:     codec.BinaryHeader,
+		HandleTimeout:  1500 * time.Millisecond,
+		StrictDecoding: true,
+		Compression:    "gzip,deflate",
+	}
+	_assert(*opt == want, "unexpected option %+v", *opt)
+}
+
+func TestLoadClientOption(t *testing.T) {
+	t.Setenv("RPC_TIMEOUT", "3s")
+	opt, err := LoadClientOption(strings.NewReader("connectTimeout: ${RPC_TIMEOUT}\ncompressThreshold: 512\nlargeArgThreshold: 1048576\n"))
+	_assert(err == nil, "load error: %v", err)
+	// 未出现的字段使用默认值
+	_assert(opt.MagicNumber == server.MagicNumber && opt.CodecType == codec.GobType && opt.Features == server.SupportedFeatures, "defaults should be kept: %+v", *opt)
+	_assert(opt.ConnectTimeout == 3*time.Second && opt.CompressThreshold == 512 && opt.LargeArgThresholdBytes == 1<<20, "unexpected option %+v", *opt)
+
+	opt, err = LoadClientOption(strings.NewReader(""))
+	_assert(err == nil && *opt == *server.DefaultOption, "empty file should give defaults: %+v (%v)", opt, err)
+}
+
+func TestLoadOption_Invalid(t *testing.T) {
+	for _, yml := range []string{
+		"codecType: application/gob\n",
+		"magicNumber: 0\ncodecType: application/gob\n",
+		"magicNumber: 0x3bef5c\ncodecType: application/xml\n",
+		"magicNumber: 0x3bef5c\ncodecType: application/gob\nunknown: 1\n",
+		"magicNumber: 0x3bef5c\ncodecType: application/gob\nhandleTimeout: soon\n",
+		"magicNumber: 0x3bef5c\ncodecType: application/gob\ncompressThreshold: 10\n",
+		"magicNumber: [\n",
+	} {
+		_, err := LoadServerOption(strings.NewReader(yml))
+		_assert(err != nil, "expect error for %q", yml)
+	}
+	_, err := LoadServerOptionFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	_assert(os.IsNotExist(err), "expect not exist error, got %v", err)
+}
@@ -0,0 +1,85 @@
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gmrpc/client"
+	"reflect"
+
+	"golang.org/x/sync/singleflight"
+)
+
+/*
+进行中请求去重 扇出时大量相同方法相同参数的并发调用合并为一次真正的调用 由 singleflight.Group 合并
+参数按 json 编码后取哈希 键中包含 reply 的类型 保证结果可以直接赋值
+真正的调用解码到私有的 reply 完成后复制给每个等待者 (浅拷贝 引用类型的字段与其他调用方共享 调用方不应修改)
+调用不受任何一个调用方的 ctx 控制 只保留第一个调用方 ctx 中的值 所有等待者都离开后仍会执行完
+只合并同时进行的调用 不缓存已完成的结果
+*/
+
+type InflightDeduplicator struct {
+	group singleflight.Group
+}
+
+func NewInflightDeduplicator() *InflightDeduplicator {
+	return &InflightDeduplicator{}
+}
+
+// 实际发起调用的函数 结果写入 reply
+type CallFunc func(ctx context.Context, reply interface{}) error
+
+// 与进行中的相同调用合并 参数无法编码或为流式参数时直接调用 fn
+// ctx 结束时立即返回 之后不会再写入 reply
+func (d *InflightDeduplicator) Do(ctx context.Context, method string, args, reply interface{}, fn CallFunc) error {
+	key, ok := dedupKey(method, args, reply)
+	if !ok {
+		return fn(ctx, reply)
+	}
+	callCtx := context.WithoutCancel(ctx)
+	ch := d.group.DoChan(key, func() (interface{}, error) {
+		v := reflect.New(reflect.TypeOf(reply).Elem())
+		return v, fn(callCtx, v.Interface())
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return res.Err
+		}
+		reflect.ValueOf(reply).Elem().Set(res.Val.(reflect.Value).Elem())
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 客户端拦截器 对经过该客户端的所有调用去重
+func NewInflightDedupInterceptor() client.ClientInterceptor {
+	d := NewInflightDeduplicator()
+	return func(ctx context.Context, c *client.Client, serviceMethod string, args, reply interface{}, invoker client.UnaryInvoker) error {
+		return d.Do(ctx, serviceMethod, args, reply, func(ctx context.Context, reply interface{}) error {
+			return invoker(ctx, serviceMethod, args, reply)
+		})
+	}
+}
+
+func dedupKey(method string, args, reply interface{}) (string, bool) {
+	switch args.(type) {
+	case client.StreamingArg, *client.StreamingArg:
+		return "", false
+	}
+	rv := reflect.ValueOf(reply)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return "", false
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\x00%s\x00", method, rv.Type())
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
@@ -0,0 +1,143 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Lookup struct {
+	calls int64
+}
+
+type LookupArgs struct {
+	Key string
+}
+
+func (l *Lookup) Get(args LookupArgs, reply *string) error {
+	atomic.AddInt64(&l.calls, 1)
+	time.Sleep(100 * time.Millisecond)
+	*reply = "value-" + args.Key
+	return nil
+}
+
+func dial(t *testing.T, rcvr interface{}) *client.Client {
+	s := server.NewServer()
+	_ = s.Register(rcvr)
+	l, _ := net.Listen("tcp", ":0")
+	go s.Accept(l)
+	c, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = l.Close()
+	})
+	return c
+}
+
+func TestInflightDedupInterceptor(t *testing.T) {
+	var lookup Lookup
+	c := dial(t, &lookup)
+	c.Use(NewInflightDedupInterceptor())
+
+	var wg sync.WaitGroup
+	replies := make([]string, 20)
+	errs := make([]error, 20)
+	for i := range replies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = c.Call(context.Background(), "Lookup.Get", LookupArgs{Key: "a"}, &replies[i])
+		}(i)
+	}
+	wg.Wait()
+	for i := range replies {
+		_assert(errs[i] == nil && replies[i] == "value-a", "caller %d: unexpected result %q (%v)", i, replies[i], errs[i])
+	}
+	_assert(atomic.LoadInt64(&lookup.calls) == 1, "expect 1 request, got %d", lookup.calls)
+
+	// 参数不同不合并 结束后的调用重新发起
+	var a, b string
+	wg.Add(2)
+	go func() { defer wg.Done(); _ = c.Call(context.Background(), "Lookup.Get", LookupArgs{Key: "a"}, &a) }()
+	go func() { defer wg.Done(); _ = c.Call(context.Background(), "Lookup.Get", LookupArgs{Key: "b"}, &b) }()
+	wg.Wait()
+	_assert(a == "value-a" && b == "value-b", "unexpected results %q %q", a, b)
+	_assert(atomic.LoadInt64(&lookup.calls) == 3, "expect 3 requests, got %d", lookup.calls)
+}
+
+// 第一个调用方取消后调用继续 后来者得到结果 取消的调用方的 reply 不再被写入
+func TestInflightDeduplicator_LeaderCanceled(t *testing.T) {
+	d := NewInflightDeduplicator()
+	var calls int64
+	fn := func(ctx context.Context, reply interface{}) error {
+		atomic.AddInt64(&calls, 1)
+		select {
+		case <-time.After(50 * time.Millisecond):
+			*reply.(*int) = 42
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	var leaderReply int
+	go func() { leaderErr <- d.Do(ctx, "M", 1, &leaderReply, fn) }()
+	time.Sleep(10 * time.Millisecond)
+
+	followerErr := make(chan error, 1)
+	var reply int
+	go func() { followerErr <- d.Do(context.Background(), "M", 1, &reply, fn) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	_assert(errors.Is(<-leaderErr, context.Canceled), "leader should be canceled")
+	err := <-followerErr
+	_assert(err == nil && reply == 42, "follower should get the result, got %d (%v)", reply, err)
+	_assert(leaderReply == 0, "canceled caller's reply should not be written, got %d", leaderReply)
+	_assert(atomic.LoadInt64(&calls) == 1, "expect 1 call, got %d", calls)
+}
+
+// 每个等待者得到自己的副本
+func TestInflightDeduplicator_PrivateReply(t *testing.T) {
+	d := NewInflightDeduplicator()
+	release := make(chan struct{})
+	fn := func(ctx context.Context, reply interface{}) error {
+		select {
+		case <-release:
+			*reply.(*int) = 7
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	var a, b int
+	errs := make(chan error, 2)
+	go func() { errs <- d.Do(context.Background(), "M", 1, &a, fn) }()
+	go func() { errs <- d.Do(context.Background(), "M", 1, &b, fn) }()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	_assert(<-errs == nil && <-errs == nil && a == 7 && b == 7, "expect both copies, got %d %d", a, b)
+	b = 8
+	_assert(a == 7, "replies should not be shared")
+}
@@ -0,0 +1,184 @@
+package fastpath
+
+import (
+	"bytes"
+	"fmt"
+	"gmrpc/service"
+	"go/ast"
+	"go/format"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+为服务方法生成登记适配器的代码 生成的 init 以 service.RegisterAdapter 登记每种签名
+之后注册服务时这些方法直接调用 不经过 reflect.Call 见 service/adapter.go
+生成的文件放在服务所在的包中 通常由 go:generate 运行的小程序调用
+	//go:generate go run ./gen
+	// gen/main.go
+	fastpath.Generate(f, "math", "example.com/math", &math.Math{})
+参数与结果需为具体的类型 (不含接口 函数 通道与匿名结构体) 延迟响应的方法不生成 见 CanGenerate
+*/
+
+const header = "// Code generated by gmrpc/fastpath. DO NOT EDIT.\n\n"
+
+// 方法能否生成适配器
+func CanGenerate(m *service.MethodType) bool {
+	if m.Deferred {
+		return false
+	}
+	in := m.Method().Type
+	_, err := newRenderer("").render(in.In(0))
+	if err == nil {
+		_, err = newRenderer("").render(m.ArgType)
+	}
+	if err == nil {
+		_, err = newRenderer("").render(m.ReplyType)
+	}
+	return err == nil
+}
+
+// 生成包 pkgName (导入路径 pkgPath) 中 rcvrs 的方法的适配器登记代码 不能生成的方法跳过
+func Generate(w io.Writer, pkgName, pkgPath string, rcvrs ...interface{}) error {
+	r := newRenderer(pkgPath)
+	methods := make(map[string][]string) // 类型参数 -> 方法名
+	for _, rcvr := range rcvrs {
+		s := service.NewService(rcvr)
+		names := make([]string, 0, len(s.Method))
+		for name := range s.Method {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			m := s.Method[name]
+			if !CanGenerate(m) {
+				continue
+			}
+			args, err := r.typeArgs(m)
+			if err != nil {
+				return err
+			}
+			methods[args] = append(methods[args], s.Name+"."+name)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString(header)
+	fmt.Fprintf(&b, "package %s\n\n", pkgName)
+	b.WriteString("import (\n")
+	for _, imp := range r.sortedImports() {
+		if a := r.imports[imp]; a != path.Base(imp) {
+			fmt.Fprintf(&b, "\t%s %q\n", a, imp)
+		} else {
+			fmt.Fprintf(&b, "\t%q\n", imp)
+		}
+	}
+	b.WriteString(")\n\nfunc init() {\n")
+	keys := make([]string, 0, len(methods))
+	for k := range methods {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\tservice.RegisterAdapter[%s]() // %s\n", k, strings.Join(methods[k], " "))
+	}
+	b.WriteString("}\n")
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return fmt.Errorf("rpc fastpath: format generated code: %w", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// 把类型写成目标包中的 Go 表达式 记录需要导入的包
+type renderer struct {
+	pkgPath string
+	imports map[string]string // 导入路径 -> 别名
+	aliases map[string]bool
+}
+
+func newRenderer(pkgPath string) *renderer {
+	return &renderer{pkgPath: pkgPath, imports: map[string]string{"gmrpc/service": "service"}, aliases: map[string]bool{"service": true}}
+}
+
+// RegisterAdapter 的类型参数 T, A, R
+func (r *renderer) typeArgs(m *service.MethodType) (string, error) {
+	var parts []string
+	for _, t := range []reflect.Type{m.Method().Type.In(0), m.ArgType, m.ReplyType.Elem()} {
+		s, err := r.render(t)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+func (r *renderer) render(t reflect.Type) (string, error) {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return "", fmt.Errorf("rpc fastpath: unsupported type %s", t)
+	}
+	if t.Name() != "" {
+		if strings.Contains(t.Name(), "[") {
+			return "", fmt.Errorf("rpc fastpath: generic type %s", t)
+		}
+		if t.PkgPath() == "" {
+			return t.Name(), nil
+		}
+		if t.PkgPath() == r.pkgPath {
+			return t.Name(), nil
+		}
+		if !ast.IsExported(t.Name()) {
+			return "", fmt.Errorf("rpc fastpath: unexported type %s", t)
+		}
+		return r.alias(t.PkgPath()) + "." + t.Name(), nil
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem, err := r.render(t.Elem())
+		return "*" + elem, err
+	case reflect.Slice:
+		elem, err := r.render(t.Elem())
+		return "[]" + elem, err
+	case reflect.Array:
+		elem, err := r.render(t.Elem())
+		return "[" + strconv.Itoa(t.Len()) + "]" + elem, err
+	case reflect.Map:
+		key, err := r.render(t.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := r.render(t.Elem())
+		return "map[" + key + "]" + elem, err
+	}
+	return "", fmt.Errorf("rpc fastpath: unsupported type %s", t)
+}
+
+func (r *renderer) alias(pkgPath string) string {
+	if a, ok := r.imports[pkgPath]; ok {
+		return a
+	}
+	base := strings.NewReplacer("-", "_", ".", "_").Replace(path.Base(pkgPath))
+	a := base
+	for i := 2; r.aliases[a]; i++ {
+		a = base + strconv.Itoa(i)
+	}
+	r.aliases[a] = true
+	r.imports[pkgPath] = a
+	return a
+}
+
+func (r *renderer) sortedImports() []string {
+	paths := make([]string, 0, len(r.imports))
+	for p := range r.imports {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,126 @@
+package fastpath
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"gmrpc/service"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// 生成的登记代码在 zz_fastpath_test.go 中 修改下面的类型后重新生成
+//	UPDATE_FASTPATH=1 go test ./fastpath -run TestGenerate
+
+type Args struct{ Num1, Num2 int }
+
+type Calc struct{}
+
+func (Calc) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (Calc) Concat(args []string, reply *string) error {
+	*reply = strings.Join(args, "")
+	return nil
+}
+
+func (Calc) Lookup(args map[string]time.Duration, reply *[]time.Duration) error {
+	for _, v := range args {
+		*reply = append(*reply, v)
+	}
+	return nil
+}
+
+// 参数为接口 不能生成
+func (Calc) Describe(args interface{}, reply *string) error {
+	*reply = fmt.Sprint(args)
+	return nil
+}
+
+// 延迟响应 不能生成
+func (Calc) Later(ctx context.Context, args int, w service.ResponseWriter) error {
+	return w.Send(args)
+}
+
+// 与 Calc.Sum 相同的方法 没有生成适配器 用于对比
+type SlowCalc struct{}
+
+func (SlowCalc) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+var update = os.Getenv("UPDATE_FASTPATH") != ""
+
+func TestGenerate(t *testing.T) {
+	var b bytes.Buffer
+	_assert(Generate(&b, "fastpath", "gmrpc/fastpath", &Calc{}) == nil, "generate failed")
+	got := b.String()
+	if update {
+		_assert(os.WriteFile("zz_fastpath_test.go", b.Bytes(), 0o644) == nil, "write failed")
+	}
+	want, err := os.ReadFile("zz_fastpath_test.go")
+	_assert(err == nil && got == string(want), "generated code is out of date, rerun with UPDATE_FASTPATH=1:\n%s", got)
+	_assert(strings.Contains(got, `"time"`) && strings.Contains(got, "service.RegisterAdapter[*Calc, Args, int]()"),
+		"unexpected generated code:\n%s", got)
+
+	s := service.NewService(&Calc{})
+	for name, want := range map[string]bool{"Sum": true, "Concat": true, "Lookup": true, "Describe": false, "Later": false} {
+		m := s.Method[name]
+		_assert(CanGenerate(m) == want, "CanGenerate(%s) = %v", name, !want)
+		_assert(m.Adapted() == want, "%s should be adapted: %v", name, want)
+	}
+	_assert(!service.NewService(&SlowCalc{}).Method["Sum"].Adapted(), "SlowCalc has no generated adapter")
+}
+
+func TestGenerate_SameResults(t *testing.T) {
+	fast, slow := service.NewService(&Calc{}), service.NewService(&SlowCalc{})
+	for _, s := range []*service.Service{fast, slow} {
+		m := s.Method["Sum"]
+		argv, replyv := m.NewArgv(), m.NewReplyv()
+		argv.Set(reflect.ValueOf(Args{Num1: 3, Num2: 4}))
+		_assert(s.Call(m, argv, replyv) == nil && replyv.Elem().Int() == 7 && m.NumCalls() == 1, "%s.Sum failed", s.Name)
+	}
+	m := fast.Method["Lookup"]
+	replyv := m.NewReplyv()
+	_ = fast.Call(m, reflect.ValueOf(map[string]time.Duration{"a": time.Second}), replyv)
+	_assert(reflect.DeepEqual(replyv.Elem().Interface(), []time.Duration{time.Second}), "unexpected Lookup result %v", replyv)
+}
+
+// 生成的适配器与反射调用的吞吐量
+func BenchmarkSum(b *testing.B) {
+	run := func(b *testing.B, rcvr interface{}) {
+		s := service.NewService(rcvr)
+		m := s.Method["Sum"]
+		args := reflect.ValueOf(Args{Num1: 1, Num2: 2})
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				argv, replyv := m.NewArgvFromPool(), m.NewReplyvFromPool()
+				argv.Set(args)
+				_ = s.Call(m, argv, replyv)
+				m.RecycleArgv(argv)
+				m.RecycleReplyv(replyv)
+			}
+		})
+	}
+	b.Run("reflect", func(b *testing.B) { run(b, &SlowCalc{}) })
+	b.Run("generated", func(b *testing.B) { run(b, &Calc{}) })
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
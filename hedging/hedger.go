@@ -0,0 +1,85 @@
+package hedging
+
+import (
+	"context"
+	"errors"
+	"gmrpc/client"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+对冲请求 先向第一个服务端发送请求 hedgeDelay 内没有结果时再向下一个服务端发送同一请求 使用最先成功的结果
+某个请求失败时不等待 立即发往下一个服务端 返回时取消其余仍在进行的调用
+请求会被执行多次 只适用于幂等的方法
+*/
+
+type Hedger struct {
+	clients    []*client.Client
+	hedgeDelay time.Duration
+}
+
+func NewHedger(delay time.Duration, clients ...*client.Client) *Hedger {
+	return &Hedger{clients: clients, hedgeDelay: delay}
+}
+
+type result struct {
+	reply interface{}
+	err   error
+}
+
+func (h *Hedger) Call(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	if len(h.clients) == 0 {
+		return errors.New("rpc hedging: no clients")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result, len(h.clients))
+	replyType := reflect.TypeOf(reply)
+	start := func(c *client.Client) {
+		go func() {
+			// 每个调用使用独立的 reply 避免并发写入
+			r := reply
+			if replyType != nil && replyType.Kind() == reflect.Ptr {
+				r = reflect.New(replyType.Elem()).Interface()
+			}
+			results <- result{reply: r, err: c.Call(ctx, method, args, r)}
+		}()
+	}
+
+	timer := time.NewTimer(h.hedgeDelay)
+	defer timer.Stop()
+	start(h.clients[0])
+	sent, pending := 1, 1
+	var msgs []string
+	for pending > 0 {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if res.reply != reply {
+					reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(res.reply).Elem())
+				}
+				return nil
+			}
+			msgs = append(msgs, res.err.Error())
+			if ctx.Err() != nil {
+				// 调用方取消 不再发送
+				continue
+			}
+		case <-timer.C:
+		}
+		if sent < len(h.clients) {
+			start(h.clients[sent])
+			sent++
+			pending++
+			timer.Reset(h.hedgeDelay)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errors.New("rpc hedging: all calls failed: " + strings.Join(msgs, "; "))
+}
@@ -0,0 +1,99 @@
+package hedging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Node struct {
+	name  string
+	delay time.Duration
+	fail  bool
+	calls int32
+}
+
+func (n *Node) Get(key string, reply *string) error {
+	atomic.AddInt32(&n.calls, 1)
+	time.Sleep(n.delay)
+	if n.fail {
+		return errors.New("get failed on " + n.name)
+	}
+	*reply = n.name + ":" + key
+	return nil
+}
+
+// 测试结束时关闭连接与监听 并等待仍在运行的处理函数
+func dialNode(t *testing.T, n *Node) *client.Client {
+	s := server.NewServer()
+	_ = s.Register(n)
+	l, _ := net.Listen("tcp", ":0")
+	go s.Accept(l)
+	c, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = l.Close()
+		for s.Stats().Inflight > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	return c
+}
+
+func TestHedger_Call(t *testing.T) {
+	t.Run("hedge wins", func(t *testing.T) {
+		slow, fast := &Node{name: "slow", delay: 200 * time.Millisecond}, &Node{name: "fast"}
+		h := NewHedger(100*time.Millisecond, dialNode(t, slow), dialNode(t, fast))
+
+		var reply string
+		start := time.Now()
+		err := h.Call(context.Background(), "Node.Get", "k", &reply)
+		elapsed := time.Since(start)
+		_assert(err == nil && reply == "fast:k", "expect hedged reply, got %q (%v)", reply, err)
+		_assert(elapsed >= 100*time.Millisecond && elapsed < 180*time.Millisecond, "expect ~100ms, got %v", elapsed)
+	})
+
+	t.Run("no hedge when fast", func(t *testing.T) {
+		first, second := &Node{name: "a"}, &Node{name: "b"}
+		h := NewHedger(100*time.Millisecond, dialNode(t, first), dialNode(t, second))
+		var reply string
+		err := h.Call(context.Background(), "Node.Get", "k", &reply)
+		_assert(err == nil && reply == "a:k", "expect first reply, got %q (%v)", reply, err)
+		_assert(atomic.LoadInt32(&second.calls) == 0, "second server should not be called")
+	})
+
+	t.Run("failure hedges immediately", func(t *testing.T) {
+		h := NewHedger(time.Second, dialNode(t, &Node{name: "a", fail: true}), dialNode(t, &Node{name: "b"}))
+		var reply string
+		start := time.Now()
+		err := h.Call(context.Background(), "Node.Get", "k", &reply)
+		_assert(err == nil && reply == "b:k" && time.Since(start) < 500*time.Millisecond, "expect immediate hedge, got %q (%v)", reply, err)
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		h := NewHedger(10*time.Millisecond, dialNode(t, &Node{name: "a", fail: true}), dialNode(t, &Node{name: "b", fail: true}))
+		var reply string
+		err := h.Call(context.Background(), "Node.Get", "k", &reply)
+		_assert(err != nil && strings.Contains(err.Error(), "get failed on a") && strings.Contains(err.Error(), "get failed on b"), "expect both errors, got %v", err)
+	})
+}
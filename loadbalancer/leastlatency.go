@@ -0,0 +1,136 @@
+package loadbalancer
+
+import (
+	"context"
+	"gmrpc/client"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+/*
+最低延迟负载均衡 每次调用发往平均延迟 (指数加权移动平均 EWMA) 最低的服务端
+还没有测量过的服务端延迟视为 0 会先各被选中一次
+传输错误 (见 client.IsTransportError) 按耗时加上 ErrorPenalty 计入 快速失败的服务端不会吸走所有请求
+平均延迟超过 ProbeAfter 没有更新的服务端会被选中一次 服务端恢复后能重新得到请求
+	c.Use(loadbalancer.NewLeastLatencyInterceptor(loadbalancer.NewLeastLatencyBalancer(c, c2, c3)))
+*/
+
+const (
+	DefaultErrorPenalty = time.Second
+	DefaultProbeAfter   = 5 * time.Second
+	ewmaWeight          = 0.3 // 新样本的权重
+)
+
+// 一个服务端与其平均延迟 字段以原子操作读写
+type EndpointStats struct {
+	client        *client.Client
+	ewmaLatencyNs int64
+	updatedNs     int64 // 平均延迟最近一次更新 (或被选中探测) 的时间
+	calls         int64
+}
+
+func (e *EndpointStats) Client() *client.Client {
+	return e.client
+}
+
+// 平均延迟 还没有测量时为 0
+func (e *EndpointStats) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&e.ewmaLatencyNs))
+}
+
+// 经该服务端完成的调用数
+func (e *EndpointStats) Calls() int64 {
+	return atomic.LoadInt64(&e.calls)
+}
+
+type LeastLatencyBalancer struct {
+	endpoints []*EndpointStats
+
+	ErrorPenalty time.Duration // 传输错误额外计入的延迟 创建后不能修改
+	ProbeAfter   time.Duration // 平均延迟多久没有更新时探测一次 <= 0 表示不探测 创建后不能修改
+}
+
+func NewLeastLatencyBalancer(clients ...*client.Client) *LeastLatencyBalancer {
+	b := &LeastLatencyBalancer{
+		endpoints:    make([]*EndpointStats, len(clients)),
+		ErrorPenalty: DefaultErrorPenalty,
+		ProbeAfter:   DefaultProbeAfter,
+	}
+	now := time.Now().UnixNano()
+	for i, c := range clients {
+		b.endpoints[i] = &EndpointStats{client: c, updatedNs: now}
+	}
+	return b
+}
+
+func (b *LeastLatencyBalancer) Endpoints() []*EndpointStats {
+	return b.endpoints
+}
+
+// 可用的服务端中平均延迟最低的 有待探测的服务端时优先返回 没有可用的服务端时返回 nil
+func (b *LeastLatencyBalancer) Select() *EndpointStats {
+	now := time.Now().UnixNano()
+	var best *EndpointStats
+	bestLatency := int64(math.MaxInt64)
+	for _, e := range b.endpoints {
+		if !e.client.IsAvailable() {
+			continue
+		}
+		if b.ProbeAfter > 0 {
+			// 认领探测 并发的调用只有一个会选中
+			updated := atomic.LoadInt64(&e.updatedNs)
+			if now-updated > int64(b.ProbeAfter) && atomic.CompareAndSwapInt64(&e.updatedNs, updated, now) {
+				return e
+			}
+		}
+		if l := atomic.LoadInt64(&e.ewmaLatencyNs); l < bestLatency {
+			best, bestLatency = e, l
+		}
+	}
+	return best
+}
+
+// 以一次调用的延迟更新平均延迟
+func (b *LeastLatencyBalancer) AfterCall(endpoint *EndpointStats, latencyNs int64) {
+	if latencyNs < 1 {
+		latencyNs = 1 // 0 表示没有测量过
+	}
+	for {
+		old := atomic.LoadInt64(&endpoint.ewmaLatencyNs)
+		next := latencyNs
+		if old > 0 {
+			next = int64(ewmaWeight*float64(latencyNs) + (1-ewmaWeight)*float64(old))
+		}
+		if atomic.CompareAndSwapInt64(&endpoint.ewmaLatencyNs, old, next) {
+			break
+		}
+	}
+	atomic.StoreInt64(&endpoint.updatedNs, time.Now().UnixNano())
+	atomic.AddInt64(&endpoint.calls, 1)
+}
+
+func (b *LeastLatencyBalancer) record(endpoint *EndpointStats, elapsed time.Duration, err error) {
+	if client.IsTransportError(err) {
+		elapsed += b.ErrorPenalty
+	}
+	b.AfterCall(endpoint, int64(elapsed))
+}
+
+// 把调用发往 balancer 选出的服务端 选中安装拦截器的客户端或没有可用的服务端时由 invoker 发出
+func NewLeastLatencyInterceptor(balancer *LeastLatencyBalancer) client.ClientInterceptor {
+	return func(ctx context.Context, c *client.Client, serviceMethod string, args, reply interface{}, invoker client.UnaryInvoker) error {
+		e := balancer.Select()
+		if e == nil {
+			return invoker(ctx, serviceMethod, args, reply)
+		}
+		call := invoker
+		if e.client != c {
+			call = e.client.Call
+		}
+		start := time.Now()
+		err := call(ctx, serviceMethod, args, reply)
+		balancer.record(e, time.Since(start), err)
+		return err
+	}
+}
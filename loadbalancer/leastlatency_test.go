@@ -0,0 +1,106 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Node struct {
+	delay time.Duration
+	calls int32
+}
+
+func (n *Node) Echo(s string, reply *string) error {
+	atomic.AddInt32(&n.calls, 1)
+	time.Sleep(n.delay)
+	*reply = s
+	return nil
+}
+
+// 测试结束时关闭连接与监听
+func dialNode(t *testing.T, n *Node) *client.Client {
+	s := server.NewServer()
+	_ = s.Register(n)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(l)
+	c, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = l.Close()
+	})
+	return c
+}
+
+func TestLeastLatencyBalancer_RoutesToFastServer(t *testing.T) {
+	fast, slow := &Node{}, &Node{delay: 2 * time.Millisecond}
+	fc, sc := dialNode(t, fast), dialNode(t, slow)
+	b := NewLeastLatencyBalancer(fc, sc)
+	// 入口客户端也是其中一个服务端 经 invoker 发出
+	fc.Use(NewLeastLatencyInterceptor(b))
+
+	const calls = 1000
+	for i := 0; i < calls; i++ {
+		var reply string
+		err := fc.Call(context.Background(), "Node.Echo", "hi", &reply)
+		_assert(err == nil && reply == "hi", "call %d failed: %q %v", i, reply, err)
+	}
+	f, s := atomic.LoadInt32(&fast.calls), atomic.LoadInt32(&slow.calls)
+	_assert(f+s == calls, "expect %d calls, got %d + %d", calls, f, s)
+	_assert(f > calls*8/10, "expect fast server to get >80%% of calls, got %d/%d", f, calls)
+	eps := b.Endpoints()
+	_assert(eps[0].Latency() < eps[1].Latency(), "expect fast latency %s < slow %s", eps[0].Latency(), eps[1].Latency())
+	_assert(eps[0].Calls() == int64(f) && eps[1].Calls() == int64(s), "calls mismatch %d %d", eps[0].Calls(), eps[1].Calls())
+}
+
+func TestLeastLatencyBalancer_SelectAndProbe(t *testing.T) {
+	a, c := dialNode(t, &Node{}), dialNode(t, &Node{})
+	b := NewLeastLatencyBalancer(a, c)
+	b.ProbeAfter = 50 * time.Millisecond
+	ea, ec := b.Endpoints()[0], b.Endpoints()[1]
+
+	// 没有测量过的先被选中
+	b.AfterCall(ea, int64(time.Millisecond))
+	_assert(b.Select() == ec, "expect unmeasured endpoint")
+	b.AfterCall(ec, int64(10*time.Millisecond))
+	_assert(b.Select() == ea, "expect lowest latency")
+
+	// EWMA 平滑单次的抖动
+	b.AfterCall(ea, int64(20*time.Millisecond))
+	_assert(ea.Latency() == 6700*time.Microsecond, "unexpected ewma %s", ea.Latency())
+	_assert(b.Select() == ea, "one slow call should not flip the choice")
+
+	// 传输错误计入惩罚
+	b.record(ea, time.Millisecond, client.ErrShutdown)
+	_assert(b.Select() == ec, "expect penalty to move traffic, latency %s", ea.Latency())
+
+	// 长时间没有更新的服务端被探测一次
+	time.Sleep(60 * time.Millisecond)
+	b.AfterCall(ec, int64(10*time.Millisecond))
+	_assert(b.Select() == ea, "expect stale endpoint to be probed")
+	_assert(b.Select() == ec, "probe should be claimed only once")
+
+	// 不可用的服务端跳过
+	_ = c.Close()
+	_assert(b.Select() == ea, "expect closed endpoint to be skipped")
+	_ = a.Close()
+	_assert(b.Select() == nil, "expect nil without available endpoints")
+}
@@ -1 +1,45 @@
 package logger
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// 日志接口 便于替换为第三方日志库
+type Logger interface {
+	Info(format string, v ...interface{})
+	Warn(format string, v ...interface{})
+	Error(format string, v ...interface{})
+}
+
+// 基于标准库 log 的默认实现
+type StdLogger struct {
+	l *log.Logger
+}
+
+func (s *StdLogger) output(level string, format string, v ...interface{}) {
+	_ = s.l.Output(3, level+" "+fmt.Sprintf(format, v...))
+}
+
+func (s *StdLogger) Info(format string, v ...interface{}) {
+	s.output("[INFO]", format, v...)
+}
+
+func (s *StdLogger) Warn(format string, v ...interface{}) {
+	s.output("[WARN]", format, v...)
+}
+
+func (s *StdLogger) Error(format string, v ...interface{}) {
+	s.output("[ERROR]", format, v...)
+}
+
+var _ Logger = (*StdLogger)(nil)
+
+// 创建写入 w 的日志实例
+func New(w io.Writer) *StdLogger {
+	return &StdLogger{l: log.New(w, "", log.LstdFlags)}
+}
+
+var Default Logger = New(os.Stderr)
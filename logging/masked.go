@@ -0,0 +1,182 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gmrpc/logger"
+	"gmrpc/server"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+审计日志 记录每次调用的方法 参数 结果 错误与耗时 敏感字段 (密码 令牌 卡号) 替换为掩码函数的结果
+fieldMasks 的键为字段名 (Go 字段名或 json tag 中的名称) 也可以带服务名 "Users.Password" 只作用于该服务
+嵌套的结构体 指针 切片与 map 中的同名字段 (map 的键 非字符串的键以 fmt.Sprint 格式化) 同样替换 原始的参数与结果不会被修改
+	s.Use(logging.NewMaskedAuditInterceptor(map[string]logging.MaskFunc{"Password": logging.Redact}))
+日志一行一条 参数与结果为替换后的 json
+*/
+
+// 字段的掩码 返回值代替原值写入日志
+type MaskFunc func(v interface{}) interface{}
+
+// 替换为 "***"
+func Redact(interface{}) interface{} {
+	return "***"
+}
+
+// 只保留最后 n 个字符 其余替换为 * 用于卡号 手机号
+func KeepLast(n int) MaskFunc {
+	return func(v interface{}) interface{} {
+		s := []rune(fmt.Sprint(v))
+		if len(s) <= n {
+			return strings.Repeat("*", len(s))
+		}
+		return strings.Repeat("*", len(s)-n) + string(s[len(s)-n:])
+	}
+}
+
+// 嵌套过深时不再展开 避免自引用的结构
+const maxMaskDepth = 16
+
+type MaskedLogger struct {
+	inner      logger.Logger
+	fieldMasks map[string]MaskFunc
+}
+
+func NewMaskedLogger(inner logger.Logger, fieldMasks map[string]MaskFunc) *MaskedLogger {
+	if inner == nil {
+		inner = logger.Default
+	}
+	return &MaskedLogger{inner: inner, fieldMasks: fieldMasks}
+}
+
+// 以 logger.Default 记录审计日志的拦截器
+func NewMaskedAuditInterceptor(masks map[string]MaskFunc) server.ServerInterceptor {
+	return NewMaskedLogger(logger.Default, masks).Interceptor()
+}
+
+// 处理函数返回后记录一条审计日志 出错时不记录结果
+func (m *MaskedLogger) Interceptor() server.ServerInterceptor {
+	return func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		start := time.Now()
+		err := handler(ctx, argv, replyv)
+		m.LogCall(info.ServiceMethod, argv, replyv, err, time.Since(start))
+		return err
+	}
+}
+
+// 记录一次调用
+func (m *MaskedLogger) LogCall(serviceMethod string, args, reply interface{}, err error, elapsed time.Duration) {
+	svc := serviceMethod
+	if dot := strings.LastIndex(serviceMethod, "."); dot >= 0 {
+		svc = serviceMethod[:dot]
+	}
+	if err != nil {
+		m.inner.Warn("audit %s args=%s err=%q elapsed=%s", serviceMethod, m.render(svc, args), err.Error(), elapsed)
+		return
+	}
+	m.inner.Info("audit %s args=%s reply=%s elapsed=%s", serviceMethod, m.render(svc, args), m.render(svc, reply), elapsed)
+}
+
+// 替换掩码后的 json
+func (m *MaskedLogger) render(svc string, v interface{}) string {
+	data, err := json.Marshal(m.Mask(svc, v))
+	if err != nil {
+		return fmt.Sprintf("%q", "unloggable: "+err.Error())
+	}
+	return string(data)
+}
+
+// 返回 v 替换掩码后的副本 结构体转为以字段名为键的 map 不修改 v
+func (m *MaskedLogger) Mask(svc string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return m.mask(svc, reflect.ValueOf(v), 0)
+}
+
+func (m *MaskedLogger) maskFor(svc, name string) MaskFunc {
+	if f, ok := m.fieldMasks[svc+"."+name]; ok {
+		return f
+	}
+	return m.fieldMasks[name]
+}
+
+func (m *MaskedLogger) mask(svc string, v reflect.Value, depth int) interface{} {
+	if depth > maxMaskDepth {
+		return "..."
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return m.mask(svc, v.Elem(), depth+1)
+	case reflect.Struct:
+		if _, ok := v.Interface().(time.Time); ok {
+			return v.Interface()
+		}
+		out := make(map[string]interface{}, v.NumField())
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := f.Name
+			if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			mf := m.maskFor(svc, f.Name)
+			if mf == nil {
+				mf = m.maskFor(svc, name)
+			}
+			if mf != nil {
+				out[name] = mf(v.Field(i).Interface())
+				continue
+			}
+			out[name] = m.mask(svc, v.Field(i), depth+1)
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface() // []byte 以 base64 记录
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = m.mask(svc, v.Index(i), depth+1)
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		// 非字符串的键以 fmt.Sprint 格式化 值同样展开
+		stringKey := v.Type().Key().Kind() == reflect.String
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			if stringKey {
+				key = iter.Key().String()
+			}
+			if mf := m.maskFor(svc, key); mf != nil {
+				out[key] = mf(iter.Value().Interface())
+				continue
+			}
+			out[key] = m.mask(svc, iter.Value(), depth+1)
+		}
+		return out
+	case reflect.Invalid:
+		return nil
+	}
+	return v.Interface()
+}
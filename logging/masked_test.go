@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type captureLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (c *captureLogger) add(format string, v ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lines = append(c.lines, fmt.Sprintf(format, v...))
+}
+
+func (c *captureLogger) Info(format string, v ...interface{})  { c.add(format, v...) }
+func (c *captureLogger) Warn(format string, v ...interface{})  { c.add(format, v...) }
+func (c *captureLogger) Error(format string, v ...interface{}) { c.add(format, v...) }
+
+func (c *captureLogger) last() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.lines) == 0 {
+		return ""
+	}
+	return c.lines[len(c.lines)-1]
+}
+
+type LoginRequest struct {
+	Username string
+	Password string
+}
+
+type Session struct {
+	Token string `json:"token"`
+	User  string `json:"user"`
+}
+
+type Auth struct{ seen LoginRequest }
+
+func (a *Auth) Login(req LoginRequest, reply *Session) error {
+	a.seen = req
+	if req.Password != "hunter2" {
+		return errors.New("wrong password")
+	}
+	*reply = Session{Token: "tok-" + req.Username, User: req.Username}
+	return nil
+}
+
+func TestMaskedAuditInterceptor(t *testing.T) {
+	logs := &captureLogger{}
+	auth := &Auth{}
+	s := server.NewServer()
+	s.Use(NewMaskedLogger(logs, map[string]MaskFunc{"Password": Redact, "Auth.token": KeepLast(4)}).Interceptor())
+	_ = s.Register(auth)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+
+	c, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = c.Close() }()
+
+	var session Session
+	err = c.Call(context.Background(), "Auth.Login", LoginRequest{Username: "alice", Password: "hunter2"}, &session)
+	_assert(err == nil && session.Token == "tok-alice", "login failed: %v %+v", err, session)
+	_assert(auth.seen.Password == "hunter2", "handler must see the real password, got %q", auth.seen.Password)
+
+	line := logs.last()
+	_assert(strings.Contains(line, `audit Auth.Login args={"Password":"***","Username":"alice"}`), "unexpected log %q", line)
+	_assert(strings.Contains(line, `reply={"token":"*****lice","user":"alice"}`), "unexpected log %q", line)
+	_assert(!strings.Contains(line, "hunter2") && !strings.Contains(line, "tok-alice"), "secret leaked: %q", line)
+
+	err = c.Call(context.Background(), "Auth.Login", LoginRequest{Username: "bob", Password: "guess"}, &session)
+	_assert(err != nil, "expect wrong password error")
+	line = logs.last()
+	_assert(strings.Contains(line, `args={"Password":"***","Username":"bob"}`) && strings.Contains(line, `err="wrong password"`), "unexpected log %q", line)
+	_assert(!strings.Contains(line, "guess"), "secret leaked: %q", line)
+}
+
+func TestMaskedLogger_Nested(t *testing.T) {
+	type Card struct{ Number string }
+	type Order struct {
+		Cards   []Card
+		Billing *Card
+		Extra   map[string]string
+		secret  string
+	}
+	m := NewMaskedLogger(&captureLogger{}, map[string]MaskFunc{"Number": KeepLast(4), "password": Redact})
+	order := Order{
+		Cards:   []Card{{Number: "4111111111111111"}},
+		Billing: &Card{Number: "5500000000000004"},
+		Extra:   map[string]string{"password": "p", "note": "n"},
+		secret:  "s",
+	}
+	got := m.render("Shop", order)
+	want := `{"Billing":{"Number":"************0004"},"Cards":[{"Number":"************1111"}],"Extra":{"note":"n","password":"***"}}`
+	_assert(got == want, "expect %s, got %s", want, got)
+	_assert(order.Cards[0].Number == "4111111111111111" && order.Extra["password"] == "p", "original value modified")
+}
+
+// 非字符串为键的 map 中的值同样替换
+func TestMaskedLogger_NonStringKeys(t *testing.T) {
+	type Card struct{ Number string }
+	m := NewMaskedLogger(&captureLogger{}, map[string]MaskFunc{"Number": KeepLast(4), "7": Redact})
+	cards := map[int]Card{1: {Number: "4111111111111111"}}
+	got := m.render("Shop", struct {
+		Cards map[int]Card
+		Codes map[int]string
+	}{cards, map[int]string{7: "secret", 8: "ok"}})
+	want := `{"Cards":{"1":{"Number":"************1111"}},"Codes":{"7":"***","8":"ok"}}`
+	_assert(got == want, "expect %s, got %s", want, got)
+	_assert(cards[1].Number == "4111111111111111", "original value modified")
+}
@@ -0,0 +1,80 @@
+package metadata
+
+import (
+	"context"
+	"strings"
+)
+
+/*
+随请求头传递的键值对 键统一转为小写
+*/
+
+type MD map[string]string
+
+func New(m map[string]string) MD {
+	md := make(MD, len(m))
+	for k, v := range m {
+		md[strings.ToLower(k)] = v
+	}
+	return md
+}
+
+// 由 k1, v1, k2, v2... 构造 奇数个参数时忽略最后一个
+func Pairs(kv ...string) MD {
+	md := make(MD, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		md[strings.ToLower(kv[i])] = kv[i+1]
+	}
+	return md
+}
+
+func (md MD) Get(k string) string {
+	return md[strings.ToLower(k)]
+}
+
+func (md MD) Set(k, v string) {
+	md[strings.ToLower(k)] = v
+}
+
+func (md MD) Copy() MD {
+	return New(md)
+}
+
+// 合并多个 MD 后者覆盖前者
+func Join(mds ...MD) MD {
+	out := MD{}
+	for _, md := range mds {
+		for k, v := range md {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+type outgoingKey struct{}
+type incomingKey struct{}
+
+// 客户端发出的元数据
+func NewOutgoingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, outgoingKey{}, md)
+}
+
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	md, _ := FromOutgoingContext(ctx)
+	return NewOutgoingContext(ctx, Join(md, Pairs(kv...)))
+}
+
+func FromOutgoingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(outgoingKey{}).(MD)
+	return md, ok
+}
+
+// 服务端收到的元数据
+func NewIncomingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, incomingKey{}, md)
+}
+
+func FromIncomingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(incomingKey{}).(MD)
+	return md, ok
+}
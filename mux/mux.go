@@ -0,0 +1,354 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+连接多路复用 多个逻辑流共享一个物理连接
+帧格式: [StreamID uint32][Length uint32][Payload...] 大端序
+对端第一次出现的 StreamID 即为新的流 Length 为 0 的帧表示发送方关闭了该流的写入
+打开流的一方使用奇数(客户端)或偶数(服务端) ID 避免冲突
+没有流量控制 接收方读取过慢时数据在内存中累积
+等待 AcceptStream 的流超过 acceptBacklog 个时 新的流被拒绝 本端立即关闭该流 对端读取返回 io.EOF
+*/
+
+// 客户端在握手前发送的第一个字节 不会与 json 格式的 Option 冲突
+const MagicByte byte = 0xfe
+
+const (
+	headerSize    = 8
+	maxFrameSize  = 64 << 10
+	acceptBacklog = 64
+)
+
+var (
+	ErrClosed              = errors.New("mux: connection closed")
+	ErrStreamClosed        = errors.New("mux: stream closed")
+	ErrFrameTooLarge       = errors.New("mux: frame too large")
+	errDeadline      error = os.ErrDeadlineExceeded
+)
+
+type Mux struct {
+	conn io.ReadWriteCloser
+
+	wmu sync.Mutex // 保证帧写入的完整性
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32
+	err     error
+
+	accept chan *Stream
+	closed chan struct{}
+}
+
+// 客户端 先发送 MagicByte
+func Client(conn io.ReadWriteCloser) (*Mux, error) {
+	if _, err := conn.Write([]byte{MagicByte}); err != nil {
+		return nil, err
+	}
+	return newMux(conn, 1), nil
+}
+
+// 服务端 调用方已读取 MagicByte
+func Server(conn io.ReadWriteCloser) *Mux {
+	return newMux(conn, 2)
+}
+
+func newMux(conn io.ReadWriteCloser, firstID uint32) *Mux {
+	m := &Mux{
+		conn:    conn,
+		streams: make(map[uint32]*Stream),
+		nextID:  firstID,
+		accept:  make(chan *Stream, acceptBacklog),
+		closed:  make(chan struct{}),
+	}
+	go m.readLoop()
+	return m
+}
+
+// 打开一个新的流 返回的流同时实现了 net.Conn
+func (m *Mux) OpenStream() (io.ReadWriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	s := newStream(m, m.nextID)
+	m.streams[s.id] = s
+	m.nextID += 2
+	return s, nil
+}
+
+// 等待对端打开的流
+func (m *Mux) AcceptStream() (io.ReadWriteCloser, error) {
+	select {
+	case s := <-m.accept:
+		return s, nil
+	case <-m.closed:
+		return nil, m.Err()
+	}
+}
+
+// 关闭物理连接 所有流随之关闭
+func (m *Mux) Close() error {
+	err := m.conn.Close()
+	<-m.closed
+	return err
+}
+
+// 物理连接关闭的原因
+func (m *Mux) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// 当前未完全关闭的流数量
+func (m *Mux) NumStreams() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.streams)
+}
+
+func (m *Mux) writeFrame(id uint32, payload []byte) error {
+	var hdr [headerSize]byte
+	binary.BigEndian.PutUint32(hdr[:4], id)
+	binary.BigEndian.PutUint32(hdr[4:], uint32(len(payload)))
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+	if _, err := m.conn.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := m.conn.Write(payload)
+	return err
+}
+
+func (m *Mux) readLoop() {
+	var err error
+	defer func() { m.shutdown(err) }()
+
+	var hdr [headerSize]byte
+	for {
+		if _, err = io.ReadFull(m.conn, hdr[:]); err != nil {
+			return
+		}
+		id, n := binary.BigEndian.Uint32(hdr[:4]), binary.BigEndian.Uint32(hdr[4:])
+		if n > maxFrameSize {
+			err = ErrFrameTooLarge
+			return
+		}
+		payload := make([]byte, n)
+		if _, err = io.ReadFull(m.conn, payload); err != nil {
+			return
+		}
+
+		m.mu.Lock()
+		s, ok := m.streams[id]
+		if !ok {
+			// 对端新打开的流
+			s = newStream(m, id)
+			m.streams[id] = s
+		}
+		m.mu.Unlock()
+		if !ok {
+			select {
+			case m.accept <- s:
+			default:
+				// 不能阻塞读取循环 否则其他流也收不到数据
+				s.refuse()
+			}
+		}
+		s.receive(payload)
+	}
+}
+
+func (m *Mux) shutdown(err error) {
+	if err == nil || err == io.EOF {
+		err = ErrClosed
+	}
+	m.mu.Lock()
+	m.err = err
+	streams := m.streams
+	m.streams = make(map[uint32]*Stream)
+	m.mu.Unlock()
+
+	_ = m.conn.Close()
+	close(m.closed)
+	for _, s := range streams {
+		s.broadcast()
+	}
+}
+
+func (m *Mux) remove(id uint32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.streams, id)
+}
+
+// 逻辑流
+type Stream struct {
+	id uint32
+	m  *Mux
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	buf          bytes.Buffer
+	remoteClosed bool // 对端已关闭写入
+	localClosed  bool
+	deadline     time.Time
+	timer        *time.Timer
+}
+
+func newStream(m *Mux, id uint32) *Stream {
+	s := &Stream{id: id, m: m}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *Stream) ID() uint32 {
+	return s.id
+}
+
+func (s *Stream) receive(payload []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(payload) == 0 {
+		s.remoteClosed = true
+		if s.localClosed {
+			s.m.remove(s.id)
+		}
+	} else if !s.localClosed {
+		s.buf.Write(payload)
+	}
+	s.cond.Broadcast()
+}
+
+// 积压已满时拒绝对端打开的流 之后收到的数据直接丢弃 对端关闭后从 streams 中删除
+// 关闭帧在新协程中写入 读取循环不等待物理连接的写入
+func (s *Stream) refuse() {
+	s.mu.Lock()
+	s.localClosed = true
+	s.mu.Unlock()
+	go func() { _ = s.m.writeFrame(s.id, nil) }()
+}
+
+func (s *Stream) broadcast() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+func (s *Stream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.buf.Len() == 0 {
+		switch {
+		case s.localClosed:
+			return 0, ErrStreamClosed
+		case s.remoteClosed:
+			return 0, io.EOF
+		case s.m.Err() != nil:
+			return 0, s.m.Err()
+		case !s.deadline.IsZero() && !time.Now().Before(s.deadline):
+			return 0, errDeadline
+		}
+		s.cond.Wait()
+	}
+	return s.buf.Read(p)
+}
+
+func (s *Stream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	closed := s.localClosed
+	s.mu.Unlock()
+	if closed {
+		return 0, ErrStreamClosed
+	}
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > maxFrameSize {
+			n = maxFrameSize
+		}
+		if err := s.m.writeFrame(s.id, p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// 关闭本端 通知对端不再发送数据
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	if s.localClosed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.localClosed = true
+	s.buf.Reset()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	remoteClosed := s.remoteClosed
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	if remoteClosed {
+		s.m.remove(s.id)
+	}
+	if s.m.Err() != nil {
+		return nil
+	}
+	return s.m.writeFrame(s.id, nil)
+}
+
+func (s *Stream) LocalAddr() net.Addr {
+	if c, ok := s.m.conn.(net.Conn); ok {
+		return c.LocalAddr()
+	}
+	return nil
+}
+
+func (s *Stream) RemoteAddr() net.Addr {
+	if c, ok := s.m.conn.(net.Conn); ok {
+		return c.RemoteAddr()
+	}
+	return nil
+}
+
+func (s *Stream) SetDeadline(t time.Time) error {
+	return s.SetReadDeadline(t)
+}
+
+func (s *Stream) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadline = t
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if !t.IsZero() {
+		s.timer = time.AfterFunc(time.Until(t), s.broadcast)
+	}
+	s.cond.Broadcast()
+	return nil
+}
+
+// 写入直接进入物理连接 不支持单独设置写超时
+func (s *Stream) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+var _ net.Conn = (*Stream)(nil)
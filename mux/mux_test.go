@@ -0,0 +1,155 @@
+package mux
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+// 通过 net.Pipe 连接的客户端与服务端
+func pair(t *testing.T) (*Mux, *Mux) {
+	c, s := net.Pipe()
+	magic := make(chan error, 1)
+	go func() {
+		var b [1]byte
+		_, err := io.ReadFull(s, b[:])
+		if err == nil && b[0] != MagicByte {
+			err = fmt.Errorf("unexpected first byte %x", b[0])
+		}
+		magic <- err
+	}()
+	client, err := Client(c)
+	_assert(err == nil, "client error: %v", err)
+	_assert(<-magic == nil, "magic byte error")
+	server := Server(s)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return client, server
+}
+
+func TestMux_Framing(t *testing.T) {
+	client, server := pair(t)
+
+	// 超过 maxFrameSize 的写入拆成多帧 多个流的数据互不混杂
+	big := bytes.Repeat([]byte("0123456789"), maxFrameSize/5)
+	s1, err := client.OpenStream()
+	_assert(err == nil, "open error: %v", err)
+	s2, _ := client.OpenStream()
+	_assert(s1.(*Stream).ID() == 1 && s2.(*Stream).ID() == 3, "client stream ids should be odd")
+	go func() {
+		_, _ = s1.Write(big)
+		_, _ = s2.Write([]byte("hello"))
+	}()
+
+	r1, err := server.AcceptStream()
+	_assert(err == nil, "accept error: %v", err)
+	got := make([]byte, len(big))
+	_, err = io.ReadFull(r1, got)
+	_assert(err == nil && bytes.Equal(got, big), "big payload mismatch: %v", err)
+	r2, _ := server.AcceptStream()
+	small := make([]byte, 5)
+	_, err = io.ReadFull(r2, small)
+	_assert(err == nil && string(small) == "hello", "unexpected payload %q: %v", small, err)
+
+	// 服务端打开的流使用偶数 ID
+	s3, _ := server.OpenStream()
+	_assert(s3.(*Stream).ID() == 2, "server stream ids should be even")
+	go func() { _, _ = s3.Write([]byte("pong")) }()
+	r3, _ := client.AcceptStream()
+	pong := make([]byte, 4)
+	_, err = io.ReadFull(r3, pong)
+	_assert(err == nil && string(pong) == "pong", "unexpected payload %q: %v", pong, err)
+}
+
+func TestMux_CloseEOF(t *testing.T) {
+	client, server := pair(t)
+
+	s, _ := client.OpenStream()
+	go func() {
+		_, _ = s.Write([]byte("bye"))
+		_ = s.Close()
+	}()
+	r, _ := server.AcceptStream()
+	data, err := io.ReadAll(r)
+	_assert(err == nil && string(data) == "bye", "expect data then EOF, got %q %v", data, err)
+	_, err = s.Write([]byte("x"))
+	_assert(err == ErrStreamClosed, "write after close should fail, got %v", err)
+
+	// 两端都关闭后流被删除
+	_ = r.Close()
+	deadline := time.Now().Add(time.Second)
+	for (client.NumStreams() != 0 || server.NumStreams() != 0) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	_assert(client.NumStreams() == 0 && server.NumStreams() == 0, "streams not removed: %d %d", client.NumStreams(), server.NumStreams())
+
+	// 对端关闭物理连接后 等待中的读取与 AcceptStream 返回 ErrClosed
+	open, _ := client.OpenStream()
+	_, _ = open.Write([]byte("x"))
+	pending, _ := server.AcceptStream()
+	buf := make([]byte, 1)
+	_, _ = io.ReadFull(pending, buf)
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := pending.Read(buf)
+		readErr <- err
+	}()
+	_ = client.Close()
+	_assert(<-readErr == ErrClosed, "pending read should fail with ErrClosed")
+	_, err = server.AcceptStream()
+	_assert(err == ErrClosed, "accept after close should fail, got %v", err)
+	_, err = client.OpenStream()
+	_assert(err != nil, "open after close should fail")
+}
+
+// 服务端不接受新流时 积压满后的流被拒绝 已有的流不受影响
+func TestMux_AcceptBacklog(t *testing.T) {
+	client, server := pair(t)
+
+	var streams []io.ReadWriteCloser
+	for i := 0; i < acceptBacklog+1; i++ {
+		s, err := client.OpenStream()
+		_assert(err == nil, "open error: %v", err)
+		_, err = s.Write([]byte("x"))
+		_assert(err == nil, "write error: %v", err)
+		streams = append(streams, s)
+	}
+	refused := streams[acceptBacklog]
+	_ = refused.(*Stream).SetReadDeadline(time.Now().Add(time.Second))
+	_, err := refused.Read(make([]byte, 1))
+	_assert(err == io.EOF, "refused stream should read EOF, got %v", err)
+
+	// 拒绝之后读取循环仍在工作 积压中的流照常收到数据
+	_, err = streams[0].Write([]byte("y"))
+	_assert(err == nil, "write error: %v", err)
+	first, err := server.AcceptStream()
+	_assert(err == nil, "accept error: %v", err)
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(first, buf)
+	_assert(err == nil && string(buf) == "xy", "unexpected payload %q: %v", buf, err)
+
+	// 对端关闭被拒绝的流后 本端不再保留
+	_ = refused.Close()
+	deadline := time.Now().Add(time.Second)
+	for server.NumStreams() != acceptBacklog && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	_assert(server.NumStreams() == acceptBacklog, "refused stream not removed, %d streams", server.NumStreams())
+}
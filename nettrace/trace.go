@@ -0,0 +1,48 @@
+package nettrace
+
+import (
+	"context"
+	"gmrpc/server"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/net/trace"
+)
+
+/*
+接入 golang.org/x/net/trace 每个请求一条 trace family 为服务方法名 title 为 Seq
+内层拦截器可通过 trace.FromContext(ctx) 取出当前请求的 trace 追加记录
+Handler 的 /debug/requests 与 /debug/events 查看结果 例如 http.Handle("/debug/requests", nettrace.Handler())
+默认只允许本机访问 可通过 trace.AuthRequest 修改
+*/
+
+// 为每个请求创建 trace 处理函数返回错误时记录并标记为失败
+func NewTraceInterceptor() server.ServerInterceptor {
+	return func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		var seq uint64
+		if info.Header != nil {
+			seq = info.Header.Seq
+		}
+		tr := trace.New(info.ServiceMethod, strconv.FormatUint(seq, 10))
+		defer tr.Finish()
+		err := handler(trace.NewContext(ctx, tr), argv, replyv)
+		if err != nil {
+			tr.LazyPrintf("error: %v", err)
+			tr.SetError()
+		}
+		return err
+	}
+}
+
+// 长期存在的对象 (连接 后台任务) 的事件日志 使用完后调用 Finish
+func NewEventLog(family, title string) trace.EventLog {
+	return trace.NewEventLog(family, title)
+}
+
+// trace 的调试页面 GET /debug/requests 与 GET /debug/events
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/requests", trace.Traces)
+	mux.HandleFunc("GET /debug/events", trace.Events)
+	return mux
+}
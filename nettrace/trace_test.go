@@ -0,0 +1,103 @@
+package nettrace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/goleak"
+	"golang.org/x/net/trace"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Tracer struct{}
+
+type Args struct{ Num1, Num2 int }
+
+func (Tracer) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (Tracer) Fail(args Args, reply *int) error {
+	return errors.New("nettrace: boom")
+}
+
+func startServer(t *testing.T) *client.Client {
+	s := server.NewServer()
+	_assert(s.Register(Tracer{}) == nil, "register")
+	// 内层拦截器向当前请求的 trace 追加记录
+	s.Use(NewTraceInterceptor(), func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		if tr, ok := trace.FromContext(ctx); ok {
+			tr.LazyPrintf("num1=%d", argv.(Args).Num1)
+		}
+		return handler(ctx, argv, replyv)
+	})
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(l)
+	c, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial: %v", err)
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = l.Close()
+	})
+	return c
+}
+
+// 以本机地址请求 trace 默认只允许本机查看
+func get(h http.Handler, target string) string {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	_assert(rec.Code == http.StatusOK, "%s: status %d", target, rec.Code)
+	return rec.Body.String()
+}
+
+func TestTraceInterceptor(t *testing.T) {
+	c := startServer(t)
+	var reply int
+	_assert(c.Call(context.Background(), "Tracer.Sum", Args{1, 2}, &reply) == nil && reply == 3, "sum")
+	err := c.Call(context.Background(), "Tracer.Fail", Args{Num1: 7}, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), "boom"), "fail: %v", err)
+
+	// 完成的请求出现在 family 列表中
+	body := get(Handler(), "/debug/requests")
+	_assert(strings.Contains(body, "Tracer.Sum"), "Tracer.Sum family missing")
+	_assert(strings.Contains(body, "Tracer.Fail"), "Tracer.Fail family missing")
+
+	// 失败的请求在错误分组中 (b=8) 带有内层拦截器与错误的记录
+	body = get(Handler(), "/debug/requests?fam=Tracer.Fail&b=8&exp=1")
+	_assert(strings.Contains(body, "num1=7"), "handler log missing:\n%s", body)
+	_assert(strings.Contains(body, "nettrace: boom"), "error missing:\n%s", body)
+	body = get(Handler(), "/debug/requests?fam=Tracer.Sum&b=8&exp=1")
+	_assert(!strings.Contains(body, "error:"), "Tracer.Sum recorded as error")
+}
+
+func TestEventLog(t *testing.T) {
+	el := NewEventLog("nettrace.conn", "127.0.0.1:9999")
+	el.Printf("accepted")
+	el.Errorf("read: %v", errors.New("reset"))
+	defer el.Finish()
+
+	body := get(Handler(), "/debug/events")
+	_assert(strings.Contains(body, "nettrace.conn"), "family missing:\n%s", body)
+	body = get(Handler(), "/debug/events?fam=nettrace.conn&b=0&exp=1")
+	_assert(strings.Contains(body, "accepted") && strings.Contains(body, "reset"), "events missing:\n%s", body)
+}
@@ -0,0 +1,27 @@
+package netutil
+
+import (
+	"errors"
+	"syscall"
+)
+
+/*
+TCP_QUICKACK 关闭延迟确认 收到数据后立即回复 ACK 避免请求-响应模式下的额外等待 (Linux 默认最多约 40ms)
+只有 Linux 支持 其他平台返回 ErrQuickACKUnsupported
+内核在部分情况下 (如连接进入 pingpong 模式) 会恢复延迟确认 这里只在建立连接时设置一次
+*/
+
+var ErrQuickACKUnsupported = errors.New("netutil: TCP_QUICKACK is only supported on linux")
+
+// conn 需要实现 syscall.Conn (如 *net.TCPConn) 否则返回错误
+func SetQuickACK(conn interface{}, enabled bool) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return errors.New("netutil: connection does not expose a file descriptor")
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return setQuickACK(raw, enabled)
+}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package netutil
+
+import "syscall"
+
+func setQuickACK(raw syscall.RawConn, enabled bool) error {
+	v := 0
+	if enabled {
+		v = 1
+	}
+	var err error
+	if cerr := raw.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_QUICKACK, v)
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package netutil
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func quickACK(t *testing.T, conn *net.TCPConn) int {
+	raw, err := conn.SyscallConn()
+	_assert(err == nil, "syscall conn: %v", err)
+	var v int
+	_ = raw.Control(func(fd uintptr) {
+		v, err = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_QUICKACK)
+	})
+	_assert(err == nil, "getsockopt: %v", err)
+	return v
+}
+
+func TestSetQuickACK(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer func() { _ = l.Close() }()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = conn.Close() }()
+	tc := conn.(*net.TCPConn)
+
+	_assert(SetQuickACK(tc, true) == nil && quickACK(t, tc) == 1, "expect quickack on")
+	_assert(SetQuickACK(tc, false) == nil && quickACK(t, tc) == 0, "expect quickack off")
+
+	p1, p2 := net.Pipe()
+	defer func() { _ = p1.Close(); _ = p2.Close() }()
+	_assert(SetQuickACK(p1, true) != nil, "pipe has no socket")
+}
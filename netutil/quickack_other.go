@@ -0,0 +1,9 @@
+//go:build !linux
+
+package netutil
+
+import "syscall"
+
+func setQuickACK(raw syscall.RawConn, enabled bool) error {
+	return ErrQuickACKUnsupported
+}
@@ -0,0 +1,74 @@
+package netutil
+
+import (
+	"gmrpc/logger"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+/*
+慢读写监控 单次 Read 或 Write 耗时超过阈值时输出警告
+读慢通常是对端发送慢或连接空闲 (阻塞等待下一个请求的读取同样计时 读阈值应大于正常的请求间隔)
+写慢说明对端接收慢 内核发送缓冲区已满
+*/
+
+type SlowConnMonitor struct {
+	conn           net.Conn
+	readThreshold  atomic.Int64 // time.Duration <= 0 表示不监控
+	writeThreshold atomic.Int64
+	logger         logger.Logger
+}
+
+// l 为空时使用 logger.Default
+func NewSlowConnMonitor(conn net.Conn, read, write time.Duration, l logger.Logger) *SlowConnMonitor {
+	if l == nil {
+		l = logger.Default
+	}
+	m := &SlowConnMonitor{conn: conn, logger: l}
+	m.SetThresholds(read, write)
+	return m
+}
+
+// 可在使用中修改 立即生效
+func (m *SlowConnMonitor) SetThresholds(read, write time.Duration) {
+	m.readThreshold.Store(int64(read))
+	m.writeThreshold.Store(int64(write))
+}
+
+func (m *SlowConnMonitor) Read(p []byte) (int, error) {
+	threshold := time.Duration(m.readThreshold.Load())
+	if threshold <= 0 {
+		return m.conn.Read(p)
+	}
+	start := time.Now()
+	n, err := m.conn.Read(p)
+	m.check("read", threshold, time.Since(start), n)
+	return n, err
+}
+
+func (m *SlowConnMonitor) Write(p []byte) (int, error) {
+	threshold := time.Duration(m.writeThreshold.Load())
+	if threshold <= 0 {
+		return m.conn.Write(p)
+	}
+	start := time.Now()
+	n, err := m.conn.Write(p)
+	m.check("write", threshold, time.Since(start), n)
+	return n, err
+}
+
+func (m *SlowConnMonitor) check(op string, threshold, elapsed time.Duration, n int) {
+	if elapsed > threshold {
+		m.logger.Warn("rpc conn: slow %s (peer %s): %v for %d bytes, threshold %v", op, m.conn.RemoteAddr(), elapsed, n, threshold)
+	}
+}
+
+func (m *SlowConnMonitor) Close() error                       { return m.conn.Close() }
+func (m *SlowConnMonitor) LocalAddr() net.Addr                { return m.conn.LocalAddr() }
+func (m *SlowConnMonitor) RemoteAddr() net.Addr               { return m.conn.RemoteAddr() }
+func (m *SlowConnMonitor) SetDeadline(t time.Time) error      { return m.conn.SetDeadline(t) }
+func (m *SlowConnMonitor) SetReadDeadline(t time.Time) error  { return m.conn.SetReadDeadline(t) }
+func (m *SlowConnMonitor) SetWriteDeadline(t time.Time) error { return m.conn.SetWriteDeadline(t) }
+
+var _ net.Conn = (*SlowConnMonitor)(nil)
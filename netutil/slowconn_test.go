@@ -0,0 +1,91 @@
+package netutil
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type captureLogger struct {
+	mu   sync.Mutex
+	warn []string
+}
+
+func (l *captureLogger) Info(format string, v ...interface{})  {}
+func (l *captureLogger) Error(format string, v ...interface{}) {}
+func (l *captureLogger) Warn(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warn = append(l.warn, fmt.Sprintf(format, v...))
+}
+
+func (l *captureLogger) messages() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.warn...)
+}
+
+// 每次写入前等待 delay 模拟发送缓冲区已满
+type throttledConn struct {
+	net.Conn
+	delay time.Duration
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	time.Sleep(c.delay)
+	return c.Conn.Write(p)
+}
+
+func TestSlowConnMonitor(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer func() { _ = c1.Close(); _ = c2.Close() }()
+	logs := new(captureLogger)
+	m := NewSlowConnMonitor(&throttledConn{Conn: c1, delay: 30 * time.Millisecond}, 0, 10*time.Millisecond, logs)
+
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			if _, err := c2.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	n, err := m.Write([]byte("hello"))
+	_assert(err == nil && n == 5, "write failed: %v", err)
+	msgs := logs.messages()
+	_assert(len(msgs) == 1 && strings.Contains(msgs[0], "slow write") && strings.Contains(msgs[0], "5 bytes"), "unexpected logs %q", msgs)
+
+	// 读阈值为 0 不监控 修改阈值后立即生效
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_, _ = c2.Write([]byte("hi"))
+	}()
+	buf := make([]byte, 2)
+	_, _ = m.Read(buf)
+	_assert(len(logs.messages()) == 1, "read should not be monitored")
+
+	m.SetThresholds(10*time.Millisecond, 0)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_, _ = c2.Write([]byte("hi"))
+	}()
+	_, _ = m.Read(buf)
+	_, _ = m.Write([]byte("x"))
+	msgs = logs.messages()
+	_assert(len(msgs) == 2 && strings.Contains(msgs[1], "slow read") && strings.Contains(msgs[1], "2 bytes"), "unexpected logs %q", msgs)
+}
@@ -0,0 +1,60 @@
+package propagate
+
+import (
+	"context"
+	"gmrpc/client"
+	"gmrpc/server"
+)
+
+/*
+截止时间的逐级继承 处理请求 A 时发起的下游调用 B 不能晚于 A 的截止时间
+下游调用常使用与请求无关的 ctx (如 context.WithoutCancel 后重新设置超时) 此时 A 的截止时间丢失
+服务端拦截器 ServerInterceptor 把请求的 ctx 放入 ctx 的值中 只要下游调用的 ctx 由它派生即可取回
+客户端拦截器 WithDeadlineInheritance 以取回的 ctx 为父 调用 InheritDeadline
+*/
+
+type parentKey struct{}
+
+// 在 ctx 中记录父调用的 ctx
+func WithParent(ctx, parent context.Context) context.Context {
+	return context.WithValue(ctx, parentKey{}, parent)
+}
+
+// ctx 中记录的父调用的 ctx
+func ParentFromContext(ctx context.Context) (context.Context, bool) {
+	parent, ok := ctx.Value(parentKey{}).(context.Context)
+	return parent, ok
+}
+
+// 返回以两者中较早的截止时间为截止时间的 child 两者都没有截止时间时返回 child
+// 只继承截止时间 parent 被取消不影响返回的 ctx
+func InheritDeadline(parent, child context.Context) context.Context {
+	dl, ok := parent.Deadline()
+	if !ok {
+		return child
+	}
+	if cdl, ok := child.Deadline(); ok && !dl.Before(cdl) {
+		return child
+	}
+	ctx, cancel := context.WithDeadline(child, dl)
+	// 截止时间到达或 child 结束时 ctx 自行释放 cancel 不需要由调用方持有
+	context.AfterFunc(ctx, cancel)
+	return ctx
+}
+
+// 把请求的 ctx 记录为父调用 处理函数由它派生的 ctx 发起的调用都受其截止时间约束
+func ServerInterceptor() server.ServerInterceptor {
+	return func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		return handler(WithParent(ctx, ctx), argv, replyv)
+	}
+}
+
+// ctx 中记录了父调用时 调用的截止时间不晚于父调用的截止时间
+func WithDeadlineInheritance() client.ClientInterceptor {
+	return func(ctx context.Context, c *client.Client, serviceMethod string, args, reply interface{}, invoker client.UnaryInvoker) error {
+		if parent, ok := ParentFromContext(ctx); ok {
+			ctx = InheritDeadline(parent, ctx)
+		}
+		return invoker(ctx, serviceMethod, args, reply)
+	}
+}
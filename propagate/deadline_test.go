@@ -0,0 +1,106 @@
+package propagate
+
+import (
+	"context"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+func TestInheritDeadline(t *testing.T) {
+	bg := context.Background()
+	early, cancel1 := context.WithTimeout(bg, time.Second)
+	defer cancel1()
+	late, cancel2 := context.WithTimeout(bg, time.Hour)
+	defer cancel2()
+	earlyDl, _ := early.Deadline()
+
+	dl, ok := InheritDeadline(early, late).Deadline()
+	_assert(ok && dl.Equal(earlyDl), "expect parent deadline %v, got %v", earlyDl, dl)
+	_assert(InheritDeadline(late, early) == early, "earlier child deadline should be kept")
+	_assert(InheritDeadline(bg, late) == late, "parent without deadline should not change child")
+	dl, ok = InheritDeadline(early, bg).Deadline()
+	_assert(ok && dl.Equal(earlyDl), "child without deadline should get parent deadline")
+
+	// 只继承截止时间 父调用取消不影响子调用
+	parent, cancel := context.WithTimeout(bg, time.Hour)
+	child := InheritDeadline(parent, bg)
+	cancel()
+	_assert(child.Err() == nil, "child canceled with parent")
+}
+
+type Backend struct{}
+
+func (Backend) Echo(n int, reply *int) error {
+	*reply = n
+	return nil
+}
+
+type Gateway struct {
+	backend  *client.Client
+	deadline chan time.Time // 请求 A 的截止时间
+}
+
+// 以与请求无关的超时调用下游 截止时间仍继承自请求
+func (g *Gateway) Forward(ctx context.Context, n int, w server.ResponseWriter) error {
+	dl, _ := ctx.Deadline()
+	g.deadline <- dl
+	sub, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Hour)
+	defer cancel()
+	var reply int
+	if err := g.backend.Call(sub, "Backend.Echo", n, &reply); err != nil {
+		return err
+	}
+	return w.Send(reply)
+}
+
+func serve(t *testing.T, rcvr interface{}, interceptors ...server.ServerInterceptor) string {
+	s := server.NewServer()
+	_assert(s.Register(rcvr) == nil, "register failed")
+	s.Use(interceptors...)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(l)
+	t.Cleanup(func() { _ = l.Close() })
+	return l.Addr().String()
+}
+
+func TestWithDeadlineInheritance(t *testing.T) {
+	backend, err := client.Dial("tcp", serve(t, Backend{}))
+	_assert(err == nil, "dial backend: %v", err)
+	defer func() { _ = backend.Close() }()
+	subDeadline := make(chan time.Time, 1)
+	backend.Use(WithDeadlineInheritance(), func(ctx context.Context, c *client.Client, serviceMethod string, args, reply interface{}, invoker client.UnaryInvoker) error {
+		dl, _ := ctx.Deadline()
+		subDeadline <- dl
+		return invoker(ctx, serviceMethod, args, reply)
+	})
+
+	gw := &Gateway{backend: backend, deadline: make(chan time.Time, 1)}
+	c, err := client.Dial("tcp", serve(t, gw, ServerInterceptor()))
+	_assert(err == nil, "dial gateway: %v", err)
+	defer func() { _ = c.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var reply int
+	_assert(c.Call(ctx, "Gateway.Forward", 7, &reply) == nil && reply == 7, "call failed")
+	parent, sub := <-gw.deadline, <-subDeadline
+	_assert(!parent.IsZero(), "request has no deadline")
+	_assert(sub.Equal(parent), "sub-call deadline %v, request deadline %v", sub, parent)
+	_assert(time.Until(parent) <= 2*time.Second, "request deadline %v not from caller's budget", parent)
+}
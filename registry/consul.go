@@ -0,0 +1,222 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+/*
+基于 Consul 的服务注册中心
+注册时附带 TTL 健康检查 后台协程按 ttl/2 的间隔上报心跳 服务停止上报后由 Consul 标记为不健康
+*/
+
+type ConsulRegistry struct {
+	client *api.Client
+
+	mu         sync.Mutex
+	heartbeats map[string]chan struct{} // 服务实例 ID -> 停止心跳
+	wg         sync.WaitGroup
+}
+
+// config 为空时使用默认配置 (CONSUL_HTTP_ADDR 等环境变量 或 127.0.0.1:8500)
+func NewConsulRegistry(config *api.Config) (*ConsulRegistry, error) {
+	if config == nil {
+		config = api.DefaultConfig()
+	}
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsulRegistry{client: client, heartbeats: make(map[string]chan struct{})}, nil
+}
+
+func serviceID(serviceName, addr string) string {
+	return serviceName + "-" + addr
+}
+
+func checkID(id string) string {
+	return "service:" + id
+}
+
+// 注册服务实例并开始上报心跳 addr 格式为 host:port
+func (r *ConsulRegistry) Register(serviceName, addr string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("rpc registry: ttl must be positive")
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("rpc registry: invalid port in %s", addr)
+	}
+
+	id := serviceID(serviceName, addr)
+	agent := r.client.Agent()
+	err = agent.ServiceRegister(&api.AgentServiceRegistration{
+		ID:      id,
+		Name:    serviceName,
+		Address: host,
+		Port:    port,
+		Check: &api.AgentServiceCheck{
+			CheckID:                        checkID(id),
+			TTL:                            ttl.String(),
+			DeregisterCriticalServiceAfter: (10 * ttl).String(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	// 注册后检查默认为 critical 立即上报一次
+	if err := agent.UpdateTTL(checkID(id), "", api.HealthPassing); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stop, ok := r.heartbeats[id]; ok {
+		close(stop)
+	}
+	stop := make(chan struct{})
+	r.heartbeats[id] = stop
+	r.wg.Add(1)
+	go r.heartbeat(id, ttl/2, stop)
+	return nil
+}
+
+func (r *ConsulRegistry) heartbeat(id string, interval time.Duration, stop chan struct{}) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := r.client.Agent().UpdateTTL(checkID(id), "", api.HealthPassing); err != nil {
+				log.Println("rpc registry: update ttl error:", err)
+			}
+		}
+	}
+}
+
+// 停止心跳并注销服务实例
+func (r *ConsulRegistry) Deregister(serviceName, addr string) error {
+	id := serviceID(serviceName, addr)
+	r.mu.Lock()
+	if stop, ok := r.heartbeats[id]; ok {
+		close(stop)
+		delete(r.heartbeats, id)
+	}
+	r.mu.Unlock()
+	return r.client.Agent().ServiceDeregister(id)
+}
+
+// 注销所有由该实例注册的服务
+func (r *ConsulRegistry) Close() error {
+	r.mu.Lock()
+	ids := make([]string, 0, len(r.heartbeats))
+	for id, stop := range r.heartbeats {
+		close(stop)
+		ids = append(ids, id)
+	}
+	r.heartbeats = make(map[string]chan struct{})
+	r.mu.Unlock()
+	r.wg.Wait()
+
+	var first error
+	for _, id := range ids {
+		if err := r.client.Agent().ServiceDeregister(id); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// 返回健康检查通过的服务地址
+func (r *ConsulRegistry) GetAddresses(serviceName string) ([]string, error) {
+	entries, _, err := r.client.Health().Service(serviceName, "", true, nil)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// 监听服务实例列表的变化 基于 index 的阻塞查询 每次变化推送一次完整的地址列表
+// ctx 结束后关闭返回的通道
+func (r *ConsulRegistry) Watch(ctx context.Context, serviceName string) (<-chan []string, error) {
+	services, meta, err := r.client.Catalog().Service(serviceName, "", (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []string, 1)
+	ch <- catalogAddresses(services)
+
+	go func() {
+		defer close(ch)
+		index := meta.LastIndex
+		for {
+			opts := (&api.QueryOptions{WaitIndex: index, WaitTime: 5 * time.Minute}).WithContext(ctx)
+			services, meta, err := r.client.Catalog().Service(serviceName, "", opts)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Println("rpc registry: watch error:", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+				continue
+			}
+			// index 回退时重新开始
+			if meta.LastIndex < index {
+				index = 0
+				continue
+			}
+			if meta.LastIndex == index {
+				continue
+			}
+			index = meta.LastIndex
+			select {
+			case ch <- catalogAddresses(services):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func catalogAddresses(services []*api.CatalogService) []string {
+	addrs := make([]string, 0, len(services))
+	for _, s := range services {
+		host := s.ServiceAddress
+		if host == "" {
+			host = s.Address
+		}
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(s.ServicePort)))
+	}
+	sort.Strings(addrs)
+	return addrs
+}
@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil"
+)
+
+/*
+集成测试需要 PATH 中存在 consul 可执行文件 否则跳过
+也可以用 docker 启动: docker run -d -p 8500:8500 hashicorp/consul agent -dev -client 0.0.0.0
+然后设置 CONSUL_HTTP_ADDR=127.0.0.1:8500 运行测试 此时直接使用该 agent
+*/
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+func newTestRegistry(t *testing.T) *ConsulRegistry {
+	if os.Getenv("CONSUL_HTTP_ADDR") != "" {
+		r, err := NewConsulRegistry(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	if _, err := exec.LookPath("consul"); err != nil {
+		t.Skip("consul binary not found in PATH")
+	}
+	srv, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+		c.LogLevel = "error"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = srv.Stop() })
+
+	config := api.DefaultConfig()
+	config.Address = srv.HTTPAddr
+	r, err := NewConsulRegistry(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestConsulRegistry(t *testing.T) {
+	r := newTestRegistry(t)
+	defer func() { _ = r.Close() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates, err := r.Watch(ctx, "Foo")
+	_assert(err == nil, "watch error: %v", err)
+	_assert(len(<-updates) == 0, "expect no instances at first")
+
+	ttl := time.Second
+	_assert(r.Register("Foo", "127.0.0.1:9001", ttl) == nil, "register error")
+	_assert(r.Register("Foo", "127.0.0.1:9002", ttl) == nil, "register error")
+
+	want := []string{"127.0.0.1:9001", "127.0.0.1:9002"}
+	waitFor(t, 5*time.Second, func() bool {
+		addrs, _ := r.GetAddresses("Foo")
+		return reflect.DeepEqual(addrs, want)
+	})
+	// 心跳使实例在超过 ttl 后仍然健康
+	time.Sleep(2 * ttl)
+	addrs, _ := r.GetAddresses("Foo")
+	_assert(reflect.DeepEqual(addrs, want), "expect %v to stay healthy, got %v", want, addrs)
+
+	_assert(r.Deregister("Foo", "127.0.0.1:9001") == nil, "deregister error")
+	addrs, _ = r.GetAddresses("Foo")
+	_assert(reflect.DeepEqual(addrs, want[1:]), "expect %v, got %v", want[1:], addrs)
+
+	// watch 最终看到注销后的列表
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case addrs := <-updates:
+			if reflect.DeepEqual(addrs, want[1:]) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("watch did not observe deregistration")
+		}
+	}
+}
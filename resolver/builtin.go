@@ -0,0 +1,123 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// static:///a,b,c
+type Static struct{}
+
+func (Static) Resolve(target string) ([]Address, error) {
+	var addrs []Address
+	for _, s := range strings.Split(target, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		a, err := ParseAddress(s)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, a)
+	}
+	return addrs, nil
+}
+
+// dns:///host:port 每个 IP 一个地址 地址中的 network 与元数据对所有结果生效
+type DNS struct {
+	LookupHost func(ctx context.Context, host string) ([]string, error) // 为空时使用 net.DefaultResolver
+	Timeout    time.Duration                                            // 默认 5 秒
+}
+
+func (d *DNS) Resolve(target string) ([]Address, error) {
+	tmpl, err := ParseAddress(target)
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(tmpl.Addr)
+	if err != nil {
+		return nil, err
+	}
+	lookup, timeout := d.LookupHost, d.Timeout
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupHost
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	hosts, err := lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]Address, 0, len(hosts))
+	for _, h := range hosts {
+		a := tmpl
+		a.Addr = net.JoinHostPort(h, port)
+		addrs = append(addrs, a)
+	}
+	return addrs, nil
+}
+
+// 注册中心 registry.ConsulRegistry 满足该接口
+type Registry interface {
+	GetAddresses(serviceName string) ([]string, error)
+	Watch(ctx context.Context, serviceName string) (<-chan []string, error)
+}
+
+// registry:///service 需要注册后使用 resolver.Register("registry", NewRegistryResolver(reg))
+type RegistryResolver struct {
+	registry Registry
+}
+
+func NewRegistryResolver(registry Registry) *RegistryResolver {
+	return &RegistryResolver{registry: registry}
+}
+
+func (r *RegistryResolver) Resolve(target string) ([]Address, error) {
+	addrs, err := r.registry.GetAddresses(target)
+	if err != nil {
+		return nil, err
+	}
+	return toAddresses(addrs)
+}
+
+func (r *RegistryResolver) Watch(ctx context.Context, target string) (<-chan []Address, error) {
+	in, err := r.registry.Watch(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan []Address, 1)
+	go func() {
+		defer close(out)
+		for addrs := range in {
+			resolved, err := toAddresses(addrs)
+			if err != nil {
+				continue
+			}
+			select {
+			case out <- resolved:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func toAddresses(addrs []string) ([]Address, error) {
+	resolved := make([]Address, 0, len(addrs))
+	for _, s := range addrs {
+		a, err := ParseAddress(s)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, a)
+	}
+	return resolved, nil
+}
+
+var _ Watcher = (*RegistryResolver)(nil)
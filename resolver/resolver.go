@@ -0,0 +1,164 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+名称解析 把一个目标字符串解析为一组服务端地址 Dial Pool XClient 共用
+目标格式为 scheme:///endpoint 没有 scheme 时整个字符串就是一个地址
+内置 scheme:
+	static:///a,b,c        逗号分隔的地址列表
+	dns:///host:port       解析域名 每个 IP 一个地址
+	registry:///service    从注册中心查询 需要先用 NewRegistryResolver 注册
+地址格式为 [network@]addr[?key=value&...] 省略 network 时为 tcp 查询参数作为地址的元数据 例如 weight
+*/
+
+// 服务端地址
+type Address struct {
+	Network  string
+	Addr     string
+	Metadata map[string]string // 例如权重 weight
+}
+
+// 返回 network@addr 与 XClient 的服务列表格式一致
+func (a Address) String() string {
+	return a.Network + "@" + a.Addr
+}
+
+type Resolver interface {
+	// target 为去掉 scheme:/// 之后的部分
+	Resolve(target string) ([]Address, error)
+}
+
+// 可选接口 支持推送地址变化的解析器
+type Watcher interface {
+	// 每次变化推送一次完整的地址列表 ctx 结束后关闭通道
+	Watch(ctx context.Context, target string) (<-chan []Address, error)
+}
+
+var (
+	ErrUnknownScheme = errors.New("rpc resolver: unknown scheme")
+	ErrNoAddress     = errors.New("rpc resolver: no address")
+)
+
+// 没有 scheme 时使用 目标本身就是一个地址
+const Passthrough = "passthrough"
+
+var (
+	mu        sync.RWMutex
+	resolvers = map[string]Resolver{
+		Passthrough: passthrough{},
+		"static":    Static{},
+		"dns":       &DNS{},
+	}
+)
+
+// 注册解析器 已存在时替换 r 为空时删除 scheme 不区分大小写
+func Register(scheme string, r Resolver) {
+	mu.Lock()
+	defer mu.Unlock()
+	if r == nil {
+		delete(resolvers, strings.ToLower(scheme))
+		return
+	}
+	resolvers[strings.ToLower(scheme)] = r
+}
+
+func Get(scheme string) (Resolver, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	r, ok := resolvers[strings.ToLower(scheme)]
+	return r, ok
+}
+
+// 已注册的 scheme
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	schemes := make([]string, 0, len(resolvers))
+	for s := range resolvers {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// 拆分 scheme:///endpoint scheme://authority/endpoint 中的 authority 被忽略
+func Parse(target string) (scheme, endpoint string) {
+	i := strings.Index(target, "://")
+	if i <= 0 {
+		return Passthrough, target
+	}
+	scheme, rest := target[:i], target[i+3:]
+	if j := strings.Index(rest, "/"); j >= 0 {
+		rest = rest[j+1:]
+	}
+	return strings.ToLower(scheme), rest
+}
+
+// 查找 scheme 对应的解析器
+func Lookup(target string) (Resolver, string, error) {
+	scheme, endpoint := Parse(target)
+	r, ok := Get(scheme)
+	if !ok {
+		return nil, "", fmt.Errorf("%w %q", ErrUnknownScheme, scheme)
+	}
+	return r, endpoint, nil
+}
+
+// 解析目标 结果为空时返回 ErrNoAddress
+func Resolve(target string) ([]Address, error) {
+	r, endpoint, err := Lookup(target)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := r.Resolve(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%w for %q", ErrNoAddress, target)
+	}
+	return addrs, nil
+}
+
+// 解析 [network@]addr[?key=value&...]
+func ParseAddress(s string) (Address, error) {
+	a := Address{Network: "tcp"}
+	if i := strings.Index(s, "?"); i >= 0 {
+		q, err := url.ParseQuery(s[i+1:])
+		if err != nil {
+			return Address{}, fmt.Errorf("rpc resolver: invalid address %q: %v", s, err)
+		}
+		a.Metadata = make(map[string]string, len(q))
+		for k := range q {
+			a.Metadata[k] = q.Get(k)
+		}
+		s = s[:i]
+	}
+	if i := strings.Index(s, "@"); i >= 0 {
+		a.Network, s = s[:i], s[i+1:]
+	}
+	if s == "" {
+		return Address{}, fmt.Errorf("rpc resolver: empty address")
+	}
+	a.Addr = s
+	return a, nil
+}
+
+type passthrough struct{}
+
+func (passthrough) Resolve(target string) ([]Address, error) {
+	a, err := ParseAddress(target)
+	if err != nil {
+		return nil, err
+	}
+	return []Address{a}, nil
+}
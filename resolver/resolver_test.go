@@ -0,0 +1,145 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+func TestParse(t *testing.T) {
+	for target, want := range map[string][2]string{
+		"static:///a,b":        {"static", "a,b"},
+		"DNS:///host:80":       {"dns", "host:80"},
+		"dns://8.8.8.8/host:8": {"dns", "host:8"},
+		"127.0.0.1:80":         {Passthrough, "127.0.0.1:80"},
+		"unix@/tmp/rpc.sock":   {Passthrough, "unix@/tmp/rpc.sock"},
+	} {
+		scheme, endpoint := Parse(target)
+		_assert(scheme == want[0] && endpoint == want[1], "%s: got %s %s", target, scheme, endpoint)
+	}
+}
+
+func TestResolve_Builtin(t *testing.T) {
+	addrs, err := Resolve("static:///a:1, unix@/tmp/b.sock ,c:3?weight=5")
+	_assert(err == nil, "resolve error: %v", err)
+	want := []Address{
+		{Network: "tcp", Addr: "a:1"},
+		{Network: "unix", Addr: "/tmp/b.sock"},
+		{Network: "tcp", Addr: "c:3", Metadata: map[string]string{"weight": "5"}},
+	}
+	_assert(reflect.DeepEqual(addrs, want), "unexpected addresses %+v", addrs)
+	_assert(addrs[1].String() == "unix@/tmp/b.sock", "unexpected string %s", addrs[1])
+
+	addrs, err = Resolve("127.0.0.1:80")
+	_assert(err == nil && len(addrs) == 1 && addrs[0].String() == "tcp@127.0.0.1:80", "passthrough: %+v (%v)", addrs, err)
+
+	addrs, err = Resolve("dns:///localhost:8080")
+	_assert(err == nil && len(addrs) > 0, "dns: %+v (%v)", addrs, err)
+	for _, a := range addrs {
+		_assert(a.Network == "tcp" && (a.Addr == "127.0.0.1:8080" || a.Addr == "[::1]:8080"), "unexpected dns address %+v", a)
+	}
+
+	_, err = Resolve("static:///")
+	_assert(errors.Is(err, ErrNoAddress), "expect ErrNoAddress, got %v", err)
+	_, err = Resolve("etcd:///svc")
+	_assert(errors.Is(err, ErrUnknownScheme), "expect ErrUnknownScheme, got %v", err)
+	_, err = Resolve("dns:///no-port")
+	_assert(err != nil, "dns target without port should fail")
+}
+
+func TestDNS_Lookup(t *testing.T) {
+	d := &DNS{LookupHost: func(ctx context.Context, host string) ([]string, error) {
+		_assert(host == "svc.local", "unexpected host %s", host)
+		return []string{"10.0.0.1", "10.0.0.2"}, nil
+	}}
+	addrs, err := d.Resolve("unix@svc.local:9000?zone=a")
+	_assert(err == nil && len(addrs) == 2, "resolve error: %v", err)
+	_assert(addrs[1].String() == "unix@10.0.0.2:9000" && addrs[1].Metadata["zone"] == "a", "unexpected address %+v", addrs[1])
+}
+
+type fakeRegistry struct {
+	addrs   []string
+	updates chan []string
+}
+
+func (r *fakeRegistry) GetAddresses(serviceName string) ([]string, error) {
+	if serviceName != "orders" {
+		return nil, errors.New("unknown service")
+	}
+	return r.addrs, nil
+}
+
+func (r *fakeRegistry) Watch(ctx context.Context, serviceName string) (<-chan []string, error) {
+	ch := make(chan []string)
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case addrs := <-r.updates:
+				ch <- addrs
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func TestRegistryResolver(t *testing.T) {
+	reg := &fakeRegistry{addrs: []string{"10.0.0.1:80", "10.0.0.2:80"}, updates: make(chan []string)}
+	Register("registry", NewRegistryResolver(reg))
+	defer Register("registry", nil)
+
+	addrs, err := Resolve("registry:///orders")
+	_assert(err == nil && len(addrs) == 2 && addrs[0].Addr == "10.0.0.1:80", "unexpected addresses %+v (%v)", addrs, err)
+	_, err = Resolve("registry:///missing")
+	_assert(err != nil, "unknown service should fail")
+
+	r, endpoint, _ := Lookup("registry:///orders")
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := r.(Watcher).Watch(ctx, endpoint)
+	_assert(err == nil, "watch error: %v", err)
+	reg.updates <- []string{"udp@10.0.0.3:80"}
+	select {
+	case addrs := <-ch:
+		_assert(len(addrs) == 1 && addrs[0].String() == "udp@10.0.0.3:80", "unexpected update %+v", addrs)
+	case <-time.After(time.Second):
+		t.Fatal("no update")
+	}
+	cancel()
+	for range ch {
+	}
+}
+
+// 自定义解析器 按名称返回固定的地址
+type pluginResolver map[string][]Address
+
+func (p pluginResolver) Resolve(target string) ([]Address, error) {
+	return p[target], nil
+}
+
+func TestRegister_Custom(t *testing.T) {
+	Register("Plugin", pluginResolver{"users": {{Network: "tcp", Addr: "u:1"}}})
+	defer Register("plugin", nil)
+
+	_assert(len(Schemes()) >= 4, "unexpected schemes %v", Schemes())
+	addrs, err := Resolve("plugin:///users")
+	_assert(err == nil && len(addrs) == 1 && addrs[0].Addr == "u:1", "unexpected addresses %+v (%v)", addrs, err)
+	_, err = Resolve("plugin:///none")
+	_assert(errors.Is(err, ErrNoAddress), "expect ErrNoAddress, got %v", err)
+}
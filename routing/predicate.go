@@ -0,0 +1,82 @@
+package routing
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+/*
+按条件把调用转到另一个已注册的服务 例如只在工作时间开放的方法 或来自特定网段的请求使用影子服务
+规则按顺序匹配 第一条满足条件的规则把服务名替换为 TargetService 方法名不变
+条件函数的上下文带有请求的元数据 (metadata.FromIncomingContext) 与对端地址 (PeerFromContext)
+*/
+
+type Rule struct {
+	Predicate     func(ctx context.Context, serviceMethod string) bool
+	TargetService string
+}
+
+type PredicateRouter struct {
+	rules []Rule
+}
+
+func NewPredicateRouter(rules ...Rule) *PredicateRouter {
+	return &PredicateRouter{rules: rules}
+}
+
+// 返回路由后的 Service.Method 没有规则匹配时原样返回
+func (r *PredicateRouter) Route(ctx context.Context, serviceMethod string) string {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if r == nil || dot < 0 {
+		return serviceMethod
+	}
+	for _, rule := range r.rules {
+		if rule.Predicate(ctx, serviceMethod) {
+			return rule.TargetService + serviceMethod[dot:]
+		}
+	}
+	return serviceMethod
+}
+
+type peerKey struct{}
+
+func NewPeerContext(ctx context.Context, addr net.Addr) context.Context {
+	return context.WithValue(ctx, peerKey{}, addr)
+}
+
+// 请求的对端地址 连接没有地址时 (如 net.Pipe) 返回 nil
+func PeerFromContext(ctx context.Context) net.Addr {
+	addr, _ := ctx.Value(peerKey{}).(net.Addr)
+	return addr
+}
+
+// 对端 IP 属于给定网段
+func PeerIn(n *net.IPNet) func(ctx context.Context, serviceMethod string) bool {
+	return func(ctx context.Context, serviceMethod string) bool {
+		addr := PeerFromContext(ctx)
+		if addr == nil {
+			return false
+		}
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			host = addr.String()
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && n.Contains(ip)
+	}
+}
+
+// 当前时间在每天的 [start, end) 区间内 以 now 的时区计算 end 小于 start 表示跨过午夜
+func Between(start, end time.Duration, now func() time.Time) func(ctx context.Context, serviceMethod string) bool {
+	return func(ctx context.Context, serviceMethod string) bool {
+		t := now()
+		y, m, d := t.Date()
+		offset := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+		if start <= end {
+			return offset >= start && offset < end
+		}
+		return offset >= start || offset < end
+	}
+}
@@ -0,0 +1,37 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+func TestPredicateRouter_Route(t *testing.T) {
+	_, office, _ := net.ParseCIDR("10.1.0.0/16")
+	now := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+	r := NewPredicateRouter(
+		Rule{Predicate: PeerIn(office), TargetService: "Internal"},
+		Rule{Predicate: Between(18*time.Hour, 9*time.Hour, func() time.Time { return now }), TargetService: "Closed"},
+	)
+	peer := func(ip string) context.Context {
+		return NewPeerContext(context.Background(), &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234})
+	}
+
+	got := r.Route(peer("10.1.2.3"), "Orders.List")
+	_assert(got == "Internal.List", "office peer routed to %s", got)
+	got = r.Route(peer("192.168.0.1"), "Orders.List")
+	_assert(got == "Closed.List", "after hours routed to %s", got)
+	now = now.Add(-10 * time.Hour)
+	got = r.Route(context.Background(), "Orders.List")
+	_assert(got == "Orders.List", "business hours without peer routed to %s", got)
+	got = (*PredicateRouter)(nil).Route(peer("10.1.2.3"), "Orders.List")
+	_assert(got == "Orders.List", "nil router routed to %s", got)
+}
@@ -0,0 +1,151 @@
+package rpcerr
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+结构化错误 随响应头传回客户端 客户端可根据错误码区分处理
+*/
+
+type Code uint32
+
+const (
+	OK Code = iota
+	Unknown
+	InvalidArgs      // 参数无法解码或校验失败
+	NotFound         // 服务或方法不存在
+	DeadlineExceeded // 处理超时
+	Internal
+	Overloaded        // 服务端过载 可稍后重试
+	PermissionDenied  // 缺少有效的凭证或权限不足
+	Unauthenticated   // 请求签名无效或已过期
+	ResourceExhausted // 超出资源限制 如响应过大
+)
+
+var codeNames = map[Code]string{
+	OK:                "OK",
+	Unknown:           "Unknown",
+	InvalidArgs:       "InvalidArgs",
+	NotFound:          "NotFound",
+	DeadlineExceeded:  "DeadlineExceeded",
+	Internal:          "Internal",
+	Overloaded:        "Overloaded",
+	PermissionDenied:  "PermissionDenied",
+	Unauthenticated:   "Unauthenticated",
+	ResourceExhausted: "ResourceExhausted",
+}
+
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Code(%d)", uint32(c))
+}
+
+// 常用的 Details 键
+const (
+	DetailField         = "field"          // 出错字段路径
+	DetailTimeoutSource = "timeout-source" // 超时的来源 取值见下
+	DetailSize          = "size"           // 超出限制的字节数
+	DetailLimit         = "limit"          // 对应的限制
+)
+
+// 超时来源 用于区分是哪一个时限触发了超时
+const (
+	TimeoutClientDeadline   = "client-deadline"       // 调用方 ctx 的截止时间
+	TimeoutAttempt          = "attempt-timeout"       // 单次尝试的超时 如重试策略或自适应超时
+	TimeoutServerHandle     = "server-handle-timeout" // 服务端 Option.HandleTimeout
+	TimeoutPropagatedBudget = "propagated-budget"     // 客户端随请求传递的剩余时间
+)
+
+type RPCError struct {
+	Code         Code              `json:"Code"`
+	Message      string            `json:"Message"`
+	Details      map[string]string `json:"Details"`
+	RetryAfterMs uint32            `json:"RetryAfterMs"` // 建议的重试等待时间 0 表示无建议
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// 错误码相同即视为同一类错误 便于 errors.Is 比较
+func (e *RPCError) Is(target error) bool {
+	t, ok := target.(*RPCError)
+	return ok && t.Code == e.Code
+}
+
+func (e *RPCError) Detail(key string) string {
+	return e.Details[key]
+}
+
+// 服务端建议的重试等待时间 0 表示无建议
+func (e *RPCError) RetryAfter() time.Duration {
+	return time.Duration(e.RetryAfterMs) * time.Millisecond
+}
+
+func New(code Code, msg string) *RPCError {
+	return &RPCError{Code: code, Message: msg}
+}
+
+func Errorf(code Code, format string, v ...interface{}) *RPCError {
+	return New(code, fmt.Sprintf(format, v...))
+}
+
+// 附加详情 返回自身便于链式调用
+func (e *RPCError) WithDetail(key, value string) *RPCError {
+	if e.Details == nil {
+		e.Details = make(map[string]string)
+	}
+	e.Details[key] = value
+	return e
+}
+
+// 从错误链中取出 RPCError
+func FromError(err error) (*RPCError, bool) {
+	var e *RPCError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// 错误码 nil 为 OK 非结构化错误为 Unknown
+func CodeOf(err error) Code {
+	if err == nil {
+		return OK
+	}
+	if e, ok := FromError(err); ok {
+		return e.Code
+	}
+	return Unknown
+}
+
+// 服务端没有处理请求 稍后可以重试的错误码 其他错误即使带有重试提示也不应重试
+func Retryable(code Code) bool {
+	return code == Overloaded || code == ResourceExhausted
+}
+
+// 错误链中 RPCError 建议的重试等待时间 没有时返回 0
+func RetryAfter(err error) time.Duration {
+	if e, ok := FromError(err); ok {
+		return e.RetryAfter()
+	}
+	return 0
+}
+
+// 超时来源 不是超时或没有来源时返回空字符串
+// 客户端本地超时的错误实现 TimeoutSource() 服务端的超时通过 Details 传回
+func TimeoutSource(err error) string {
+	var ts interface{ TimeoutSource() string }
+	if errors.As(err, &ts) {
+		return ts.TimeoutSource()
+	}
+	if e, ok := FromError(err); ok && e.Code == DeadlineExceeded {
+		return e.Detail(DetailTimeoutSource)
+	}
+	return ""
+}
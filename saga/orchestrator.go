@@ -0,0 +1,148 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gmrpc/client"
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+Saga 编排 多个 rpc 调用依次执行 某一步失败时按相反顺序执行已完成步骤的补偿函数
+每一步的状态变化都会记录到 SagaLog 并以 json 行的形式写入调用方提供的 io.Writer
+*/
+
+type Client = client.Client
+
+// 步骤状态
+const (
+	StatusPending            = "pending"
+	StatusSucceeded          = "succeeded"
+	StatusFailed             = "failed"
+	StatusCompensated        = "compensated"
+	StatusCompensationFailed = "compensation_failed"
+)
+
+type Step struct {
+	Name       string
+	Forward    func(ctx context.Context, client *Client) error
+	Compensate func(ctx context.Context, client *Client) error // 可以为空 表示无需补偿
+}
+
+type SagaLogEntry struct {
+	Step   string    `json:"step"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// 执行日志 每个步骤一条记录 保存最新状态
+type SagaLog struct {
+	mu    sync.Mutex
+	steps []SagaLogEntry
+	w     io.Writer
+}
+
+// 返回日志快照
+func (l *SagaLog) Entries() []SagaLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]SagaLogEntry(nil), l.steps...)
+}
+
+// 更新第 i 步的状态 并追加写入 writer
+func (l *SagaLog) update(i int, status string, err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry := &l.steps[i]
+	entry.Status = status
+	entry.Time = time.Now()
+	entry.Error = ""
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if l.w == nil {
+		return nil
+	}
+	data, e := json.Marshal(entry)
+	if e != nil {
+		return e
+	}
+	_, e = l.w.Write(append(data, '\n'))
+	return e
+}
+
+type Saga struct {
+	steps []Step
+	w     io.Writer
+	log   *SagaLog
+}
+
+func New(steps ...Step) *Saga {
+	return &Saga{steps: steps}
+}
+
+func (s *Saga) AddStep(step Step) *Saga {
+	s.steps = append(s.steps, step)
+	return s
+}
+
+// 设置日志持久化的位置 为空时只保存在内存中
+func (s *Saga) SetLogWriter(w io.Writer) {
+	s.w = w
+}
+
+// 最近一次 Execute 的日志
+func (s *Saga) Log() *SagaLog {
+	return s.log
+}
+
+// 依次执行所有步骤 失败时逆序补偿已完成的步骤 返回导致失败的错误
+// 补偿使用同一个 ctx 若失败原因是 ctx 超时 调用方应传入仍然有效的 ctx 以保证补偿能够执行
+func (s *Saga) Execute(ctx context.Context, client *Client) error {
+	log := &SagaLog{steps: make([]SagaLogEntry, len(s.steps)), w: s.w}
+	for i, step := range s.steps {
+		log.steps[i] = SagaLogEntry{Step: step.Name, Status: StatusPending}
+	}
+	s.log = log
+
+	for i, step := range s.steps {
+		err := step.Forward(ctx, client)
+		if err == nil {
+			if err := log.update(i, StatusSucceeded, nil); err != nil {
+				return fmt.Errorf("saga: write log: %w", err)
+			}
+			continue
+		}
+		_ = log.update(i, StatusFailed, err)
+		err = fmt.Errorf("saga: step %s failed: %w", step.Name, err)
+		if cerr := s.compensate(ctx, client, log, i); cerr != nil {
+			return fmt.Errorf("%w; %v", err, cerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// 逆序补偿 failed 之前的所有步骤 单个补偿失败不影响其余步骤
+func (s *Saga) compensate(ctx context.Context, client *Client, log *SagaLog, failed int) error {
+	var first error
+	for i := failed - 1; i >= 0; i-- {
+		step := s.steps[i]
+		if step.Compensate == nil {
+			continue
+		}
+		if err := step.Compensate(ctx, client); err != nil {
+			_ = log.update(i, StatusCompensationFailed, err)
+			if first == nil {
+				first = fmt.Errorf("saga: compensate %s failed: %w", step.Name, err)
+			}
+			continue
+		}
+		_ = log.update(i, StatusCompensated, nil)
+	}
+	return first
+}
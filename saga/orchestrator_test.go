@@ -0,0 +1,108 @@
+package saga
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"net"
+	"sync"
+	"testing"
+)
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Inventory struct {
+	mu       sync.Mutex
+	reserved int
+}
+
+func (inv *Inventory) Reserve(n int, reply *int) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.reserved += n
+	*reply = inv.reserved
+	return nil
+}
+
+func (inv *Inventory) Release(n int, reply *int) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.reserved -= n
+	*reply = inv.reserved
+	return nil
+}
+
+func (inv *Inventory) Charge(amount int, reply *int) error {
+	return errors.New("insufficient balance")
+}
+
+func TestSaga_Execute(t *testing.T) {
+	inv := new(Inventory)
+	s := server.NewServer()
+	_ = s.Register(inv)
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+	c, _ := client.Dial("tcp", l.Addr().String())
+	defer func() { _ = c.Close() }()
+
+	call := func(method string, n int) func(ctx context.Context, client *Client) error {
+		return func(ctx context.Context, client *Client) error {
+			var reply int
+			return client.Call(ctx, method, n, &reply)
+		}
+	}
+	var compensated []string
+	compensate := func(name string, method string, n int) func(ctx context.Context, client *Client) error {
+		return func(ctx context.Context, client *Client) error {
+			compensated = append(compensated, name)
+			return call(method, n)(ctx, client)
+		}
+	}
+	shipped := false
+
+	saga := New(
+		Step{Name: "reserve", Forward: call("Inventory.Reserve", 3), Compensate: compensate("reserve", "Inventory.Release", 3)},
+		Step{Name: "charge", Forward: call("Inventory.Charge", 100), Compensate: compensate("charge", "Inventory.Charge", -100)},
+		Step{Name: "ship", Forward: func(ctx context.Context, client *Client) error {
+			shipped = true
+			return nil
+		}},
+	)
+	var buf bytes.Buffer
+	saga.SetLogWriter(&buf)
+
+	err := saga.Execute(context.Background(), c)
+	_assert(err != nil && errors.Unwrap(err).Error() == "insufficient balance", "expect charge error, got %v", err)
+	_assert(len(compensated) == 1 && compensated[0] == "reserve", "expect only reserve to be compensated, got %v", compensated)
+	_assert(!shipped, "step after the failure should not run")
+	_assert(inv.reserved == 0, "expect reservation released, got %d", inv.reserved)
+
+	entries := saga.Log().Entries()
+	want := []string{StatusCompensated, StatusFailed, StatusPending}
+	for i, e := range entries {
+		_assert(e.Status == want[i], "step %s: expect %s, got %s", e.Step, want[i], e.Status)
+	}
+	_assert(entries[1].Error == "insufficient balance", "expect error recorded, got %q", entries[1].Error)
+
+	// writer 中按顺序保存每次状态变化
+	var persisted []SagaLogEntry
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e SagaLogEntry
+		_assert(json.Unmarshal(scanner.Bytes(), &e) == nil, "invalid log line %q", scanner.Text())
+		persisted = append(persisted, e)
+	}
+	_assert(len(persisted) == 3, "expect 3 log lines, got %d", len(persisted))
+	_assert(persisted[0].Step == "reserve" && persisted[0].Status == StatusSucceeded, "unexpected entry %+v", persisted[0])
+	_assert(persisted[2].Step == "reserve" && persisted[2].Status == StatusCompensated, "unexpected entry %+v", persisted[2])
+}
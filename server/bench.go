@@ -0,0 +1,55 @@
+package server
+
+import (
+	"fmt"
+	"gmrpc/rpcerr"
+	"math/rand"
+)
+
+/*
+内置的压测服务 性能分析时无需再手写回显服务 配合 cmd/rpcbench 使用
+*/
+
+const BenchService = "Bench"
+
+// Payload 单次返回的最大字节数
+const MaxBenchPayload = 64 << 20
+
+type Bench struct{}
+
+// 原样返回参数
+func (b *Bench) Echo(args []byte, reply *[]byte) error {
+	*reply = args
+	return nil
+}
+
+func (b *Bench) Sum(args []int64, reply *int64) error {
+	var sum int64
+	for _, v := range args {
+		sum += v
+	}
+	*reply = sum
+	return nil
+}
+
+// 返回 size 个随机字节
+func (b *Bench) Payload(size int, reply *[]byte) error {
+	if size < 0 || size > MaxBenchPayload {
+		return rpcerr.New(rpcerr.InvalidArgs, fmt.Sprintf("payload size %d out of range [0, %d]", size, MaxBenchPayload))
+	}
+	buf := make([]byte, size)
+	_, _ = rand.Read(buf)
+	*reply = buf
+	return nil
+}
+
+func (server *Server) RegisterBenchService() error {
+	return server.Register(&Bench{})
+}
+
+func RegisterBenchService(server ...*Server) error {
+	if len(server) >= 1 {
+		return server[0].RegisterBenchService()
+	}
+	return DefaultServer.RegisterBenchService()
+}
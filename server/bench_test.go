@@ -0,0 +1,27 @@
+package server
+
+import (
+	"bytes"
+	"gmrpc/rpcerr"
+	"testing"
+)
+
+func TestBench_Handlers(t *testing.T) {
+	var b Bench
+	var out []byte
+	_assert(b.Echo([]byte("ping"), &out) == nil && bytes.Equal(out, []byte("ping")), "echo mismatch: %q", out)
+
+	var sum int64
+	_assert(b.Sum([]int64{1, 2, 3, -4}, &sum) == nil && sum == 2, "sum mismatch: %d", sum)
+
+	_assert(b.Payload(1000, &out) == nil && len(out) == 1000, "payload size mismatch: %d", len(out))
+	_assert(!bytes.Equal(out, make([]byte, 1000)), "payload is not random")
+
+	err := b.Payload(MaxBenchPayload+1, &out)
+	e, ok := rpcerr.FromError(err)
+	_assert(ok && e.Code == rpcerr.InvalidArgs, "oversized payload should be rejected: %v", err)
+
+	s := NewServer()
+	_assert(RegisterBenchService(s) == nil, "register bench service failed")
+	_assert(len(s.serviceNames()) == 1 && s.serviceNames()[0] == BenchService, "unexpected services %v", s.serviceNames())
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmrpc/codec"
+	"io"
+)
+
+/*
+二进制 Option 固定 16 字节 代替握手时的一行 json 客户端设置 Option.BinaryOption 后使用
+	[4 字节 magic][1 字节 version][1 字节 codecType][2 字节 flags][8 字节 reserved]  多字节字段为大端序
+magic 为 MagicNumber 的大端序 00 3b ef 5c 首字节与 json 的 '{' 及多路复用的 MagicByte 都不同 服务端据此区分两种格式
+version 为 ProtocolVersion codecType 见 binaryCodecTypes
+flags 低 8 位为 StrictDecoding Capabilities 与头部格式 高 8 位为 Features reserved 必须为 0
+不能表示的 Option (压缩 超时 未登记的编码 超出范围的版本与功能) 只能使用 json 格式
+服务端没有 ConnectTimeout 等待连接名额时使用默认值
+*/
+
+const binaryOptionSize = 16
+
+var binaryOptionMagic = [4]byte{0x00, 0x3b, 0xef, 0x5c}
+
+// codecType 字节对应的编码 0 不使用
+var binaryCodecTypes = []codec.Type{1: codec.GobType, 2: codec.JsonType, 3: codec.JSONRPC2Type}
+
+const (
+	binaryFlagStrict       uint16 = 1 << 0
+	binaryFlagCapabilities uint16 = 1 << 1
+	binaryFlagBinaryHeader uint16 = 1 << 2 // HeaderType 为 codec.BinaryHeader
+	binaryFlagsKnown              = binaryFlagStrict | binaryFlagCapabilities | binaryFlagBinaryHeader
+	binaryFeatureShift            = 8
+)
+
+var ErrOptionNotBinary = errors.New("rpc: option can't be encoded in binary form")
+
+func binaryCodecType(t codec.Type) (byte, bool) {
+	for i, ct := range binaryCodecTypes {
+		if i > 0 && ct == t {
+			return byte(i), true
+		}
+	}
+	return 0, false
+}
+
+// 检查 opt 能否以二进制格式发送 不能时返回原因
+func checkOptionBinary(opt *Option) error {
+	fail := func(format string, v ...interface{}) error {
+		return fmt.Errorf("%w: "+format, append([]interface{}{ErrOptionNotBinary}, v...)...)
+	}
+	if _, ok := binaryCodecType(opt.CodecType); !ok {
+		return fail("codec %s", opt.CodecType)
+	}
+	switch {
+	case opt.HeaderType != codec.CombinedHeader && opt.HeaderType != codec.BinaryHeader:
+		return fail("header %s", opt.HeaderType)
+	case opt.ProtocolVersion < 0 || opt.ProtocolVersion > 0xff:
+		return fail("protocol version %d", opt.ProtocolVersion)
+	case opt.Features > 0xff:
+		return fail("features %s", opt.Features)
+	case opt.Compression != "":
+		return fail("compression")
+	case opt.HandleTimeout != 0:
+		return fail("handle timeout")
+	}
+	return nil
+}
+
+// 调用方先以 checkOptionBinary 检查 不能表示的字段被忽略
+func encodeOptionBinary(opt *Option) [16]byte {
+	var b [binaryOptionSize]byte
+	copy(b[:4], binaryOptionMagic[:])
+	b[4] = byte(opt.ProtocolVersion)
+	b[5], _ = binaryCodecType(opt.CodecType)
+	flags := uint16(opt.Features&0xff) << binaryFeatureShift
+	if opt.StrictDecoding {
+		flags |= binaryFlagStrict
+	}
+	if opt.Capabilities {
+		flags |= binaryFlagCapabilities
+	}
+	if opt.HeaderType == codec.BinaryHeader {
+		flags |= binaryFlagBinaryHeader
+	}
+	binary.BigEndian.PutUint16(b[6:8], flags)
+	return b
+}
+
+func decodeOptionBinary(b [16]byte) (*Option, error) {
+	if [4]byte(b[:4]) != binaryOptionMagic {
+		return nil, fmt.Errorf("rpc server: invalid binary option magic % x", b[:4])
+	}
+	ct := int(b[5])
+	if ct == 0 || ct >= len(binaryCodecTypes) {
+		return nil, fmt.Errorf("rpc server: unknown binary codec type %d", ct)
+	}
+	flags := binary.BigEndian.Uint16(b[6:8])
+	if low := flags &^ (0xff << binaryFeatureShift); low&^binaryFlagsKnown != 0 {
+		return nil, fmt.Errorf("rpc server: unknown binary option flags %#x", low)
+	}
+	for _, r := range b[8:] {
+		if r != 0 {
+			return nil, errors.New("rpc server: binary option reserved bytes must be zero")
+		}
+	}
+	opt := &Option{
+		MagicNumber:     MagicNumber,
+		CodecType:       binaryCodecTypes[ct],
+		ProtocolVersion: int(b[4]),
+		Features:        Feature(flags >> binaryFeatureShift),
+		StrictDecoding:  flags&binaryFlagStrict != 0,
+		Capabilities:    flags&binaryFlagCapabilities != 0,
+	}
+	if flags&binaryFlagBinaryHeader != 0 {
+		opt.HeaderType = codec.BinaryHeader
+	}
+	return opt, nil
+}
+
+// 以二进制格式发送 Option opt 不能表示时返回 ErrOptionNotBinary 不写入任何数据
+func WriteOptionBinary(w io.Writer, opt *Option) error {
+	if err := checkOptionBinary(opt); err != nil {
+		return err
+	}
+	b := encodeOptionBinary(opt)
+	_, err := w.Write(b[:])
+	return err
+}
+
+// 读取握手时的 Option 首字节为 binaryOptionMagic[0] 时为二进制格式 否则为一行 json
+func readOption(br *bufio.Reader) (*Option, error) {
+	if b, err := br.Peek(1); err == nil && b[0] == binaryOptionMagic[0] {
+		var raw [binaryOptionSize]byte
+		if _, err := io.ReadFull(br, raw[:]); err != nil {
+			return nil, err
+		}
+		return decodeOptionBinary(raw)
+	}
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	var opt Option
+	if err := json.Unmarshal(line, &opt); err != nil {
+		return nil, err
+	}
+	return &opt, nil
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"gmrpc/codec"
+	"testing"
+)
+
+func TestOptionBinary_RoundTrip(t *testing.T) {
+	for _, opt := range []*Option{
+		{MagicNumber: MagicNumber, CodecType: codec.GobType},
+		{MagicNumber: MagicNumber, CodecType: codec.JsonType, HeaderType: codec.BinaryHeader, StrictDecoding: true},
+		{MagicNumber: MagicNumber, CodecType: codec.JSONRPC2Type, Capabilities: true, ProtocolVersion: ProtocolVersion, Features: SupportedFeatures},
+	} {
+		b := encodeOptionBinary(opt)
+		_assert(len(b) == 16 && bytes.Equal(b[:4], []byte{0x00, 0x3b, 0xef, 0x5c}), "unexpected header % x", b)
+		got, err := decodeOptionBinary(b)
+		_assert(err == nil && *got == *opt, "round trip mismatch: %+v != %+v (%v)", got, opt, err)
+	}
+
+	// 不能表示的 Option
+	for _, opt := range []*Option{
+		{CodecType: "application/x-custom"},
+		{CodecType: codec.GobType, Compression: "gzip"},
+		{CodecType: codec.GobType, HandleTimeout: 1},
+		{CodecType: codec.GobType, ProtocolVersion: 256},
+		{CodecType: codec.GobType, Features: 1 << 8},
+	} {
+		var buf bytes.Buffer
+		err := WriteOptionBinary(&buf, opt)
+		_assert(errors.Is(err, ErrOptionNotBinary) && buf.Len() == 0, "expect ErrOptionNotBinary for %+v, got %v", opt, err)
+	}
+
+	bad := encodeOptionBinary(&Option{CodecType: codec.GobType})
+	bad[15] = 1
+	_, err := decodeOptionBinary(bad)
+	_assert(err != nil, "non-zero reserved bytes should be rejected")
+	bad = encodeOptionBinary(&Option{CodecType: codec.GobType})
+	bad[5] = 9
+	_, err = decodeOptionBinary(bad)
+	_assert(err != nil, "unknown codec type should be rejected")
+}
+
+func TestReadOption_DetectsFormat(t *testing.T) {
+	opt := &Option{MagicNumber: MagicNumber, CodecType: codec.JsonType, Capabilities: true}
+	var buf bytes.Buffer
+	_ = WriteOptionBinary(&buf, opt)
+	_ = json.NewEncoder(&buf).Encode(opt)
+	buf.WriteString("rest")
+
+	br := bufio.NewReader(&buf)
+	for _, format := range []string{"binary", "json"} {
+		got, err := readOption(br)
+		_assert(err == nil && got.CodecType == opt.CodecType && got.Capabilities, "%s option: %+v (%v)", format, got, err)
+	}
+	rest, _ := br.ReadString(0)
+	_assert(rest == "rest", "option reading should not consume following data, got %q", rest)
+}
+
+func TestServer_ServeConnBinaryOption(t *testing.T) {
+	var foo Foo
+	s := NewServer()
+	_ = s.Register(&foo)
+
+	for _, opt := range []*Option{
+		{MagicNumber: MagicNumber, CodecType: codec.GobType, BinaryOption: true},
+		{MagicNumber: MagicNumber, CodecType: codec.JsonType, HeaderType: codec.BinaryHeader, BinaryOption: true},
+	} {
+		cc, stop := servePipe(s, opt)
+		_ = cc.Write(&codec.Header{ServiceMethod: "Foo.Sum", Seq: 1}, Args{Num1: 1, Num2: 2})
+		var h codec.Header
+		var reply int
+		_assert(cc.ReadHeader(&h) == nil && cc.ReadBody(&reply) == nil, "read response failed")
+		_assert(h.Error == "" && reply == 3, "unexpected response %+v %d", h, reply)
+		stop()
+	}
+}
+
+// 每次迭代完成 10000 次握手中 Option 的编码与读取
+func BenchmarkOptionNegotiation(b *testing.B) {
+	const conns = 10000
+	opt := &Option{MagicNumber: MagicNumber, CodecType: codec.GobType, Capabilities: true, ProtocolVersion: ProtocolVersion}
+	run := func(b *testing.B, write func(*bytes.Buffer)) {
+		var buf bytes.Buffer
+		br := bufio.NewReader(&buf)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < conns; j++ {
+				buf.Reset()
+				write(&buf)
+				br.Reset(&buf)
+				if _, err := readOption(br); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+	b.Run("json", func(b *testing.B) {
+		run(b, func(buf *bytes.Buffer) { _ = json.NewEncoder(buf).Encode(opt) })
+	})
+	b.Run("binary", func(b *testing.B) {
+		run(b, func(buf *bytes.Buffer) { _ = WriteOptionBinary(buf, opt) })
+	})
+}
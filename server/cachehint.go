@@ -0,0 +1,78 @@
+package server
+
+import (
+	"gmrpc/codec"
+	"strings"
+	"time"
+)
+
+/*
+响应缓存提示 结果类型实现 CacheHinter 时服务端在响应元数据中写入 cache-control
+取值为 no-store 或 max-age=<time.Duration 字符串> 例如 max-age=1.5s
+客户端的响应缓存优先使用该提示 见 client.ResponseCache
+*/
+
+const CacheControlKey = "cache-control"
+
+type CacheHint struct {
+	TTL     time.Duration // 可以缓存的时间 为 0 时不写入提示 由客户端的配置决定
+	NoStore bool          // 禁止缓存 优先于 TTL
+}
+
+// 由处理函数的结果类型实现 在处理成功后调用
+type CacheHinter interface {
+	CacheHint() CacheHint
+}
+
+func CacheFor(ttl time.Duration) CacheHint {
+	return CacheHint{TTL: ttl}
+}
+
+func NoStore() CacheHint {
+	return CacheHint{NoStore: true}
+}
+
+// 编码为 cache-control 的值 没有提示时返回空字符串
+func (h CacheHint) String() string {
+	switch {
+	case h.NoStore:
+		return "no-store"
+	case h.TTL > 0:
+		return "max-age=" + h.TTL.String()
+	}
+	return ""
+}
+
+// 解析 cache-control 的值 无法识别时 ok 为 false
+func ParseCacheControl(v string) (hint CacheHint, ok bool) {
+	v = strings.TrimSpace(v)
+	if v == "no-store" {
+		return NoStore(), true
+	}
+	if rest, found := strings.CutPrefix(v, "max-age="); found {
+		ttl, err := time.ParseDuration(rest)
+		if err != nil || ttl <= 0 {
+			return CacheHint{}, false
+		}
+		return CacheFor(ttl), true
+	}
+	return CacheHint{}, false
+}
+
+// 在响应头中写入结果的缓存提示
+func setCacheHint(h *codec.Header, body interface{}) {
+	hinter, ok := body.(CacheHinter)
+	if !ok {
+		return
+	}
+	v := hinter.CacheHint().String()
+	if v == "" {
+		return
+	}
+	md := make(map[string]string, len(h.Metadata)+1)
+	for k, val := range h.Metadata {
+		md[k] = val
+	}
+	md[CacheControlKey] = v
+	h.Metadata = md
+}
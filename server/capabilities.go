@@ -0,0 +1,48 @@
+package server
+
+import (
+	"encoding/json"
+	"gmrpc/service"
+	"io"
+	"sort"
+	"strconv"
+)
+
+/*
+握手后的能力通告 Option.Capabilities 为 true 时服务端在处理请求前发送一行 json
+内容为连接建立时已注册的服务与方法 不包含以 _ 开头的内置服务 之后注册的服务不会再通告
+*/
+
+type Capabilities struct {
+	Services map[string][]string `json:"services"` // 服务名 -> 排序后的方法名
+}
+
+// 当前已注册的服务与方法 版本化的方法列在原服务名下 如 Math 的 Add@2
+func (server *Server) Capabilities() Capabilities {
+	caps := Capabilities{Services: make(map[string][]string)}
+	for _, name := range server.serviceNames() {
+		svc, ok := server.lookupService(name)
+		if !ok {
+			continue
+		}
+		base, version, versioned := service.SplitVersion(name)
+		methods := caps.Services[base]
+		for method := range svc.Method {
+			if versioned {
+				method = method + service.VersionSep + strconv.Itoa(int(version))
+			}
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		caps.Services[base] = methods
+	}
+	return caps
+}
+
+// json.Encoder 以换行结尾 客户端按行读取 ack 不为空时附带协议协商结果
+func (server *Server) writeCapabilities(w io.Writer, ack *ProtocolAck) error {
+	return json.NewEncoder(w).Encode(struct {
+		Capabilities
+		*ProtocolAck
+	}{server.Capabilities(), ack})
+}
@@ -0,0 +1,16 @@
+package server
+
+import "gmrpc/codec"
+
+// 设置之后建立的连接使用的编解码器注册表 r 为空时恢复 codec.DefaultCodecRegistry
+func (server *Server) SetCodecRegistry(r *codec.CodecRegistry) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.codecs = r
+}
+
+func (server *Server) codecRegistry() *codec.CodecRegistry {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	return codec.RegistryOrDefault(server.codecs)
+}
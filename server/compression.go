@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"gmrpc/codec"
+	"io"
+	"strings"
+)
+
+/*
+压缩协商 客户端在 Option.Compression 中按优先顺序列出支持的算法 以逗号分隔
+服务端选择第一个双方都支持的算法 在能力通告之后回复一行 json {"compression": "gzip"}
+没有共同算法或编解码器不支持按消息压缩(合并格式)时回复空字符串 双方都不压缩
+客户端没有提供算法时不回复 与旧版本的握手一致
+*/
+
+type CompressionAck struct {
+	Compression string `json:"compression"`
+}
+
+// 设置服务端支持的压缩算法 threshold 为不压缩的消息体大小上限 <= 0 时使用 codec.DefaultCompressThreshold
+// 只影响之后建立的连接
+func (server *Server) SetCompression(threshold int, algorithms ...string) {
+	if threshold <= 0 {
+		threshold = codec.DefaultCompressThreshold
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.compression = append([]string(nil), algorithms...)
+	server.compressThreshold = threshold
+}
+
+// 协商的功能不包含压缩时回复空字符串 ack 不为空时附带协议协商结果
+func (server *Server) negotiateCompression(w io.Writer, cc codec.Codec, opt *Option, features Feature, ack *ProtocolAck) error {
+	if opt.Compression == "" {
+		return nil
+	}
+	server.mu.RLock()
+	offered, threshold := server.compression, server.compressThreshold
+	server.mu.RUnlock()
+
+	comp, ok := cc.(codec.Compressible)
+	var name string
+	if ok && features.Has(FeatureCompression) {
+		names := strings.Split(opt.Compression, ",")
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+		name = codec.NegotiateCompression(names, offered)
+	}
+	if err := json.NewEncoder(w).Encode(struct {
+		CompressionAck
+		*ProtocolAck
+	}{CompressionAck{Compression: name}, ack}); err != nil {
+		return err
+	}
+	if c, found := codec.GetCompressor(name); found {
+		comp.SetCompression(c, threshold)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+运行时可调整的配置 与握手时由客户端决定的 Option 分开保存
+通过 UpdateConfig 整体更新 admin 包提供对应的 HTTP 接口
+每次更新发布一份新的配置 不再修改 请求在准入时取得当前配置 处理期间看到的始终是同一份
+*/
+
+type Config struct {
+	MaxConcurrent     int           `json:"MaxConcurrent"`     // 同时处理的请求上限 0 表示不限制
+	RateLimit         float64       `json:"RateLimit"`         // 每秒允许的请求数 0 表示不限流
+	RateBurst         int           `json:"RateBurst"`         // 限流允许的突发请求数 最小为 1
+	IdleTimeout       time.Duration `json:"IdleTimeout"`       // 连接没有请求多久后关闭 0 表示不关闭
+	MemoryBudget      int64         `json:"MemoryBudget"`      // 所有请求消息体合计的字节数上限 0 表示不限制
+	MemoryWait        time.Duration `json:"MemoryWait"`        // 内存预算不足时等待的时间 0 表示直接拒绝
+	HandleTimeout     time.Duration `json:"HandleTimeout"`     // 服务端的处理超时 与连接的 Option.HandleTimeout 取较短者 0 表示不限制
+	SlowThreshold     time.Duration `json:"SlowThreshold"`     // 慢请求阈值 0 表示关闭看门狗
+	MaxSendSize       int64         `json:"MaxSendSize"`       // 单个响应消息体编码后的字节数上限 0 表示不限制
+	DecodeWorkers     int           `json:"DecodeWorkers"`     // 每个连接解码参数的协程数 0 表示在读取循环中解码 见 decodepool.go
+	MaxReceiveSize    int64         `json:"MaxReceiveSize"`    // 单个请求消息体的字节数上限 0 表示使用 codec.DefaultMaxReceiveSize 对之后建立的连接生效
+	StandbyQueueLimit int           `json:"StandbyQueueLimit"` // 热备状态排队的请求数上限 0 表示使用 DefaultStandbyQueueLimit
+}
+
+var zeroConfig Config
+
+// 当前发布的配置 不能修改
+func (server *Server) loadConfig() *Config {
+	if c := server.config.Load(); c != nil {
+		return c
+	}
+	return &zeroConfig
+}
+
+// 空闲超时关闭时检查配置变化的间隔
+const idleCheckInterval = time.Second
+
+func (server *Server) Config() Config {
+	return *server.loadConfig()
+}
+
+// 在锁内修改配置并立即生效 返回生效后的配置 负数按 0 处理
+// 已经开始处理的请求仍使用更新前的 HandleTimeout 与 SlowThreshold
+func (server *Server) UpdateConfig(update func(c *Config)) Config {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	c := *server.loadConfig()
+	update(&c)
+	if c.MaxConcurrent < 0 {
+		c.MaxConcurrent = 0
+	}
+	if c.RateLimit < 0 {
+		c.RateLimit = 0
+	}
+	if c.RateBurst < 1 {
+		c.RateBurst = 1
+	}
+	if c.IdleTimeout < 0 {
+		c.IdleTimeout = 0
+	}
+	if c.MemoryBudget < 0 {
+		c.MemoryBudget = 0
+	}
+	if c.MemoryWait < 0 {
+		c.MemoryWait = 0
+	}
+	if c.HandleTimeout < 0 {
+		c.HandleTimeout = 0
+	}
+	if c.SlowThreshold < 0 {
+		c.SlowThreshold = 0
+	}
+	if c.MaxSendSize < 0 {
+		c.MaxSendSize = 0
+	}
+	if c.MaxReceiveSize < 0 {
+		c.MaxReceiveSize = 0
+	}
+	if c.DecodeWorkers < 0 {
+		c.DecodeWorkers = 0
+	}
+	if c.StandbyQueueLimit < 0 {
+		c.StandbyQueueLimit = 0
+	}
+	server.memory.setLimit(c.MemoryBudget)
+
+	// 已有的限流器原地调整 保留正在处理的请求计数与剩余令牌
+	switch {
+	case c.RateLimit == 0:
+		server.rateLimiter = nil
+	case server.rateLimiter == nil:
+		server.rateLimiter = newRateLimiter(c.RateLimit, c.RateBurst)
+	default:
+		server.rateLimiter.set(c.RateLimit, c.RateBurst)
+	}
+	switch {
+	case c.MaxConcurrent == 0:
+		server.concurrency = nil
+	case server.concurrency == nil:
+		server.concurrency = &concurrencyLimiter{max: int64(c.MaxConcurrent)}
+	default:
+		server.concurrency.setMax(c.MaxConcurrent)
+	}
+	server.config.Store(&c)
+	if c.IdleTimeout > 0 {
+		server.startIdleChecks()
+	}
+	return c
+}
+
+// 连接的处理超时与配置的处理超时取较短者 0 表示不限制
+func handleTimeout(conn, config time.Duration) time.Duration {
+	if conn == 0 || (config > 0 && config < conn) {
+		return config
+	}
+	return conn
+}
+
+// 连接没有正在处理的请求且超过 IdleTimeout 没有新请求时关闭
+// IdleTimeout 为 0 时不启动定时器 之后通过 UpdateConfig 开启时对已有连接启动
+type idleCloser struct {
+	server *Server
+	cc     io.Closer
+	conn   *connState
+
+	mu      sync.Mutex
+	stopped bool
+	timer   *time.Timer // 为空表示没有在检查
+}
+
+// 开始检查 已在检查或 IdleTimeout 为 0 时不做任何事
+func (ic *idleCloser) start() {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	d := ic.server.Config().IdleTimeout
+	if ic.stopped || ic.timer != nil || d == 0 {
+		return
+	}
+	ic.timer = time.AfterFunc(min(d, idleCheckInterval), ic.check)
+}
+
+// 每次检查时读取最新的配置 IdleTimeout 改为 0 后停止检查
+func (ic *idleCloser) check() {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	if ic.stopped {
+		return
+	}
+	d := ic.server.Config().IdleTimeout
+	if d == 0 {
+		ic.timer = nil
+		return
+	}
+	next := idleCheckInterval
+	idle, busy := ic.conn.idle(time.Now())
+	if !busy && idle >= d {
+		_ = ic.cc.Close()
+		return
+	}
+	if !busy && d-idle < next {
+		next = d - idle
+	}
+	ic.timer.Reset(next)
+}
+
+func (ic *idleCloser) stop() {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	ic.stopped = true
+	if ic.timer != nil {
+		ic.timer.Stop()
+	}
+}
+
+// 开启空闲超时后为已有的连接启动检查
+func (server *Server) startIdleChecks() {
+	server.shutdownMu.Lock()
+	defer server.shutdownMu.Unlock()
+	for c := range server.activeCodecs {
+		c.idle.start()
+	}
+}
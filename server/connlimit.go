@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+/*
+连接数上限 只统计物理连接 多路复用的逻辑流不占用名额
+超出上限的连接在读取 Option 后排队等待 最长等待 Option.ConnectTimeout
+等待者按到达顺序获得名额(阻塞在 channel 上的发送者先进先出)
+超时后以一行 json {"error": "..."} 回复并关闭连接
+Accept 不会因排队而阻塞 其他连接照常被接受与排队
+*/
+
+var ErrTooManyConnections = errors.New("rpc server: too many connections")
+
+// Option.ConnectTimeout 为 0 时的最长等待时间
+const defaultConnectWait = 10 * time.Second
+
+// 握手失败时服务端回复的内容 等待回复行的客户端 (声明版本 2 或开启 Capabilities Compression) 会读取并返回该错误
+type HandshakeError struct {
+	Error string `json:"error"`
+}
+
+// 设置同时服务的连接上限 n <= 0 表示不限制 只影响之后建立的连接
+func (server *Server) SetMaxConnections(n int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if n <= 0 {
+		server.connSlots = nil
+		return
+	}
+	server.connSlots = make(chan struct{}, n)
+}
+
+// 当前服务中的物理连接数 不含排队等待的连接与多路复用的逻辑流 与 Stats().ActiveConns 相同
+func (server *Server) ConnectionCount() int32 {
+	return int32(atomic.LoadInt64(&server.activeConns))
+}
+
+// 获取连接名额 成功时返回连接结束后需调用的释放函数
+func (server *Server) acquireConn(wait time.Duration) (func(), error) {
+	server.mu.RLock()
+	slots := server.connSlots
+	server.mu.RUnlock()
+
+	if slots != nil {
+		if wait <= 0 {
+			wait = defaultConnectWait
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case slots <- struct{}{}:
+		case <-timer.C:
+			return nil, ErrTooManyConnections
+		}
+	}
+	atomic.AddInt64(&server.activeConns, 1)
+	return func() {
+		atomic.AddInt64(&server.activeConns, -1)
+		if slots != nil {
+			<-slots
+		}
+	}, nil
+}
+
+func writeHandshakeError(w io.Writer, err error) {
+	_ = json.NewEncoder(w).Encode(HandshakeError{Error: err.Error()})
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"gmrpc/rpcerr"
+	"time"
+)
+
+/*
+截止时间传递 客户端发送的是剩余时间而不是绝对时间 两端时钟不同步也不影响
+服务端在收到请求时换算为本地的截止时间 处理函数的 ctx 带有该截止时间
+与 HandleTimeout 同时存在时以先到者为准 超时错误的 Details 中注明来源
+*/
+
+// 请求元数据中的剩余时间 time.Duration 的字符串形式 例如 1.5s
+const TimeoutKey = "rpc-timeout"
+
+// 取出请求携带的剩余时间并换算为本地截止时间 无法解析时忽略
+func budgetDeadline(h map[string]string, now time.Time) time.Time {
+	v, ok := h[TimeoutKey]
+	if !ok {
+		return time.Time{}
+	}
+	delete(h, TimeoutKey)
+	budget, err := time.ParseDuration(v)
+	if err != nil {
+		return time.Time{}
+	}
+	return now.Add(budget)
+}
+
+// 本次请求的处理时限及超时来源
+// 来源为 HandleTimeout 时 limit 为 0 表示不限制 来源为预算时 limit <= 0 表示到达时已经耗尽
+func handleLimit(handleTimeout time.Duration, deadline time.Time) (limit time.Duration, source string) {
+	limit, source = handleTimeout, rpcerr.TimeoutServerHandle
+	if deadline.IsZero() {
+		return limit, source
+	}
+	remaining := time.Until(deadline)
+	if limit == 0 || remaining < limit {
+		return remaining, rpcerr.TimeoutPropagatedBudget
+	}
+	return limit, source
+}
+
+func timeoutError(limit time.Duration, source string) error {
+	var e *rpcerr.RPCError
+	if source == rpcerr.TimeoutPropagatedBudget {
+		e = rpcerr.New(rpcerr.DeadlineExceeded, "rpc server: propagated deadline exceeded")
+	} else {
+		e = rpcerr.Errorf(rpcerr.DeadlineExceeded, "rpc server: request handle timeout: expect within %s", limit)
+	}
+	return e.WithDetail(rpcerr.DetailTimeoutSource, source)
+}
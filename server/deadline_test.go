@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServer_PropagatedDeadline(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(new(Sleeper))
+	var invoked int32
+	remaining := make(chan time.Duration, 10)
+	s.Use(func(ctx context.Context, info *MethodInfo, argv, replyv interface{}, handler UnaryHandler) error {
+		atomic.AddInt32(&invoked, 1)
+		if dl, ok := ctx.Deadline(); ok {
+			remaining <- time.Until(dl)
+		} else {
+			remaining <- -1
+		}
+		return handler(ctx, argv, replyv)
+	})
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType, HandleTimeout: 300 * time.Millisecond})
+	defer stop()
+
+	call := func(seq uint64, budget string, sleep time.Duration) (*codec.Header, int) {
+		var md map[string]string
+		if budget != "" {
+			md = map[string]string{TimeoutKey: budget}
+		}
+		_ = cc.Write(&codec.Header{ServiceMethod: "Sleeper.Sleep", Seq: seq, Metadata: md}, sleep)
+		var h codec.Header
+		var reply int
+		_assert(cc.ReadHeader(&h) == nil, "read header error")
+		_ = cc.ReadBody(&reply)
+		return &h, reply
+	}
+
+	// 剩余时间按本地时钟换算 不受两端时钟差影响
+	// 客户端时钟比服务端快一小时时 绝对时间会导致立即超时 剩余时间仍然正确
+	h, _ := call(1, "1h", 0)
+	_assert(h.Error == "", "unexpected error %q", h.Error)
+	d := <-remaining
+	_assert(d > 299*time.Millisecond && d <= time.Hour, "handler ctx should carry the propagated deadline, got %v", d)
+	_assert(h.Metadata[TimeoutKey] == "", "budget should not be echoed back")
+
+	// 预算短于 HandleTimeout 时由预算触发 来源写入 Details
+	h, _ = call(2, "50ms", 200*time.Millisecond)
+	_assert(h.Status != nil && h.Status.Code == rpcerr.DeadlineExceeded, "expect deadline exceeded, got %+v", h)
+	_assert(rpcerr.TimeoutSource(h.Status) == rpcerr.TimeoutPropagatedBudget, "unexpected source %q", h.Status.Detail(rpcerr.DetailTimeoutSource))
+	<-remaining
+
+	// 预算长于 HandleTimeout 时由 HandleTimeout 触发
+	h, _ = call(3, "10s", 500*time.Millisecond)
+	_assert(rpcerr.TimeoutSource(h.Status) == rpcerr.TimeoutServerHandle, "unexpected error %+v", h)
+	<-remaining
+
+	// 到达时预算已经耗尽(例如被发送方的时钟偏差抵消) 不调用处理函数
+	before := atomic.LoadInt32(&invoked)
+	h, _ = call(4, "-20ms", 0)
+	_assert(rpcerr.TimeoutSource(h.Status) == rpcerr.TimeoutPropagatedBudget, "unexpected error %+v", h)
+	_assert(atomic.LoadInt32(&invoked) == before, "handler should not run with an exhausted budget")
+
+	// 无法解析的预算被忽略
+	h, _ = call(5, "soon", 0)
+	_assert(h.Error == "" && <-remaining < 0, "invalid budget should be ignored: %+v", h)
+}
+
+// 超时响应不修改请求头 处理函数返回前仍能读到原来的错误信息与元数据
+func TestServer_TimeoutKeepsRequestHeader(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(new(Sleeper))
+	seen := make(chan string, 1)
+	s.Use(func(ctx context.Context, info *MethodInfo, argv, replyv interface{}, handler UnaryHandler) error {
+		err := handler(ctx, argv, replyv)
+		seen <- info.Header.Error + "|" + info.Header.Metadata["user"]
+		return err
+	})
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	defer stop()
+
+	_ = cc.Write(&codec.Header{ServiceMethod: "Sleeper.Sleep", Seq: 1, Metadata: map[string]string{TimeoutKey: "20ms", "user": "alice"}}, 100*time.Millisecond)
+	var h codec.Header
+	_assert(cc.ReadHeader(&h) == nil && cc.ReadBody(nil) == nil, "read failed")
+	_assert(h.Status != nil && h.Status.Code == rpcerr.DeadlineExceeded, "expect timeout, got %+v", h)
+	_assert(<-seen == "|alice", "request header should not be modified by the timeout response")
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+/*
+调试页面 挂载在 DebugPath 下 例如 http.Handle(server.DebugPath+"/", s.DebugHandler())
+	GET /debug/rpc/schema  已注册服务的 JSON Schema
+	GET /debug/rpc/config  当前的运行时配置 时间以纳秒表示
+请求的 trace 页面由 nettrace.Handler 提供 服务端本身不依赖 golang.org/x/net/trace
+*/
+
+const DebugPath = "/debug/rpc"
+
+func (server *Server) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+DebugPath+"/schema", server.serveSchema)
+	mux.HandleFunc("GET "+DebugPath+"/config", server.serveConfig)
+	return mux
+}
+
+func (server *Server) serveSchema(w http.ResponseWriter, r *http.Request) {
+	data, err := server.ExportSchema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func (server *Server) serveConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(server.Config())
+}
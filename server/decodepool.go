@@ -0,0 +1,84 @@
+package server
+
+import (
+	"gmrpc/codec"
+	"sync"
+	"time"
+)
+
+/*
+并行解码 连接上的请求很多时 读取循环依次解码每个请求的参数 成为单连接吞吐的上限
+Config.DecodeWorkers > 0 时 读取循环只读出帧并解码头部 (二进制头部 开销很小) 消息体交给 N 个解码协程解码后分发
+只对能脱离连接解码消息体的编码生效 (分帧格式 消息体之间没有共享状态 如 binary + json 见 codec.RawBodyReader) 其他编码不受影响
+流式参数 分块参数与控制帧仍在读取循环中处理 响应按 Seq 对应 与解码的先后无关 同一连接上请求的处理顺序不再与到达顺序一致
+请求在交给解码协程前登记到连接上 解码期间同样可以被 _cancel 取消 空闲超时与 Shutdown 视其为进行中
+设置只对之后建立的连接生效
+*/
+
+// 设置每个连接的解码协程数 n <= 0 表示在读取循环中解码
+func (server *Server) SetDecodeWorkers(n int) {
+	server.UpdateConfig(func(c *Config) {
+		c.DecodeWorkers = n
+	})
+}
+
+type decodePool struct {
+	jobs chan *request
+	wg   sync.WaitGroup
+}
+
+// 连接不支持或未启用时返回 nil 此时 conn.rawBody 为空 读取循环照常解码
+func (server *Server) newDecodePool(cc codec.Codec, conn *connState, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) *decodePool {
+	n := server.loadConfig().DecodeWorkers
+	rb, ok := cc.(codec.RawBodyReader)
+	if n <= 0 || !ok || !rb.RawBodySupported() {
+		return nil
+	}
+	if _, ok := cc.(codec.BodyMarshaler); !ok {
+		return nil
+	}
+	conn.rawBody = rb
+	p := &decodePool{jobs: make(chan *request, n)}
+	p.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer p.wg.Done()
+			for req := range p.jobs {
+				if err := server.decodeRawArgs(cc, req); err != nil {
+					req.untrack()
+					if req.freeMem != nil {
+						req.freeMem()
+					}
+					setHeaderError(req.h, err)
+					server.sendResponse(cc, req.h, invalidRequest, 0, sending)
+					continue
+				}
+				server.serveRequest(cc, req, conn, sending, wg, timeout)
+			}
+		}()
+	}
+	return p
+}
+
+// 解码协程都忙时阻塞读取循环
+func (p *decodePool) submit(req *request) {
+	p.jobs <- req
+}
+
+// 等待已提交的请求解码并分发
+func (p *decodePool) close() {
+	if p == nil {
+		return
+	}
+	close(p.jobs)
+	p.wg.Wait()
+}
+
+func (server *Server) decodeRawArgs(cc codec.Codec, req *request) error {
+	data := req.raw
+	req.raw = nil
+	if err := cc.(codec.BodyMarshaler).UnmarshalBody(data, argsPointer(req.argv)); err != nil {
+		return argsError(err)
+	}
+	return server.validateArgs(req.h.ServiceMethod, req.argv.Interface())
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type Tally struct{ calls int64 }
+
+type Batch struct {
+	ID     int
+	Values []int
+	Labels map[string]string
+}
+
+func (c *Tally) Sum(args Batch, reply *int) error {
+	atomic.AddInt64(&c.calls, 1)
+	*reply = args.ID
+	for _, v := range args.Values {
+		*reply += v
+	}
+	return nil
+}
+
+func newBatch(id int) Batch {
+	return Batch{ID: id, Values: []int{1, 2, 3, 4, 5, 6, 7, 8}, Labels: map[string]string{"region": "sz", "tier": "gold"}}
+}
+
+// 一条连接上先写入 n 个请求 再依次读取响应 检查每个 Seq 恰好响应一次
+func pipelineCalls(s *Server, opt *Option, n int) error {
+	cc, stop := servePipe(s, opt)
+	defer stop()
+	go func() {
+		for i := 1; i <= n; i++ {
+			method := "Tally.Sum"
+			if i%50 == 0 {
+				method = "Tally.Missing"
+			}
+			_ = cc.Write(&codec.Header{ServiceMethod: method, Seq: uint64(i)}, newBatch(i))
+		}
+	}()
+	seen := make(map[uint64]bool, n)
+	for i := 0; i < n; i++ {
+		var h codec.Header
+		var reply int
+		if err := cc.ReadHeader(&h); err != nil {
+			return err
+		}
+		if seen[h.Seq] {
+			return fmt.Errorf("duplicate response for seq %d", h.Seq)
+		}
+		seen[h.Seq] = true
+		if h.Seq%50 == 0 {
+			if h.Status == nil || h.Status.Code != rpcerr.NotFound {
+				return fmt.Errorf("seq %d: expect NotFound, got %+v", h.Seq, h)
+			}
+			_ = cc.ReadBody(nil)
+			continue
+		}
+		if err := cc.ReadBody(&reply); err != nil || h.Error != "" || reply != int(h.Seq)+36 {
+			return fmt.Errorf("seq %d: unexpected reply %d %q %v", h.Seq, reply, h.Error, err)
+		}
+	}
+	return nil
+}
+
+func TestServer_DecodeWorkers(t *testing.T) {
+	counter := new(Tally)
+	s := NewServer()
+	_ = s.Register(counter)
+	s.SetDecodeWorkers(4)
+
+	const n = 2000
+	for _, opt := range []*Option{
+		{MagicNumber: MagicNumber, CodecType: codec.JsonType, HeaderType: codec.BinaryHeader},
+		// gob 的消息体共享类型定义 仍在读取循环中解码
+		{MagicNumber: MagicNumber, CodecType: codec.GobType, HeaderType: codec.BinaryHeader},
+		{MagicNumber: MagicNumber, CodecType: codec.JsonType},
+	} {
+		atomic.StoreInt64(&counter.calls, 0)
+		err := pipelineCalls(s, opt, n)
+		_assert(err == nil, "%s/%s: %v", opt.HeaderType, opt.CodecType, err)
+		calls := atomic.LoadInt64(&counter.calls)
+		_assert(calls == n-n/50, "%s/%s: expect %d calls, got %d", opt.HeaderType, opt.CodecType, n-n/50, calls)
+	}
+}
+
+func TestServer_DecodeWorkersInvalidArgs(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(new(Tally))
+	s.SetDecodeWorkers(2)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.JsonType, HeaderType: codec.BinaryHeader})
+	defer stop()
+
+	go func() {
+		_ = cc.Write(&codec.Header{ServiceMethod: "Tally.Sum", Seq: 1}, map[string]string{"ID": "one"})
+		_ = cc.Write(&codec.Header{ServiceMethod: "Tally.Sum", Seq: 2}, newBatch(2))
+	}()
+	for i := 0; i < 2; i++ {
+		var h codec.Header
+		var reply int
+		_assert(cc.ReadHeader(&h) == nil, "read header error")
+		_ = cc.ReadBody(&reply)
+		if h.Seq == 1 {
+			_assert(h.Status != nil && h.Status.Code == rpcerr.InvalidArgs && h.Status.Detail(rpcerr.DetailField) == "ID", "expect InvalidArgs on ID, got %+v", h.Status)
+		} else {
+			_assert(h.Error == "" && reply == 38, "expect 38, got %d %q", reply, h.Error)
+		}
+	}
+}
+
+// 解码在 gate 关闭前阻塞
+type GatedArgs struct{ V int }
+
+var decodeGate chan struct{}
+
+func (a *GatedArgs) UnmarshalJSON(data []byte) error {
+	<-decodeGate
+	type plain GatedArgs
+	return json.Unmarshal(data, (*plain)(a))
+}
+
+type Gated struct{}
+
+func (Gated) Echo(args GatedArgs, reply *int) error {
+	*reply = args.V
+	return nil
+}
+
+// 交给解码协程的请求已登记在连接上 解码期间可以被取消
+func TestServer_DecodeWorkersCancel(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(Gated{})
+	s.SetDecodeWorkers(1)
+	canceled := make(chan bool, 1)
+	s.Use(func(ctx context.Context, info *MethodInfo, argv, replyv interface{}, handler UnaryHandler) error {
+		canceled <- ctx.Err() != nil
+		return handler(ctx, argv, replyv)
+	})
+	decodeGate = make(chan struct{})
+	open := sync.OnceFunc(func() { close(decodeGate) })
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.JsonType, HeaderType: codec.BinaryHeader})
+	defer stop()
+	defer open()
+
+	_assert(cc.Write(&codec.Header{ServiceMethod: "Gated.Echo", Seq: 1}, GatedArgs{V: 7}) == nil, "write failed")
+	_assert(cc.Write(&codec.Header{ServiceMethod: CancelMethod, Seq: 2}, uint64(1)) == nil, "write cancel failed")
+	var h codec.Header
+	_assert(cc.ReadHeader(&h) == nil && h.Seq == 2 && h.Error == "", "cancel should find the decoding request, got %+v", h)
+	_ = cc.ReadBody(nil)
+	open()
+	_assert(<-canceled, "handler ctx should be canceled")
+	var reply int
+	_assert(cc.ReadHeader(&h) == nil && h.Seq == 1 && cc.ReadBody(&reply) == nil, "read reply failed")
+}
+
+// 单连接上大量小请求的吞吐 对比在读取循环中解码与 4 个解码协程
+func BenchmarkServer_DecodeWorkers(b *testing.B) {
+	for _, workers := range []int{0, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) { benchDecodeWorkers(b, workers) })
+	}
+}
+
+// 多核时并行解码的单连接吞吐应明显高于在读取循环中解码
+func TestServer_DecodeWorkersThroughput(t *testing.T) {
+	if testing.Short() || runtime.NumCPU() < 4 {
+		t.Skip("needs at least 4 CPUs")
+	}
+	serial := testing.Benchmark(func(b *testing.B) { benchDecodeWorkers(b, 0) })
+	parallel := testing.Benchmark(func(b *testing.B) { benchDecodeWorkers(b, 4) })
+	_assert(parallel.NsPerOp()*5 < serial.NsPerOp()*4, "expect at least 25%% more calls/s with decode workers: serial %s, parallel %s", serial, parallel)
+}
+
+func benchDecodeWorkers(b *testing.B, workers int) {
+	s := NewServer()
+	_ = s.Register(new(Tally))
+	s.SetDecodeWorkers(workers)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	opt := &Option{MagicNumber: MagicNumber, CodecType: codec.JsonType, HeaderType: codec.BinaryHeader}
+	_ = json.NewEncoder(conn).Encode(opt)
+	cc, _ := codec.New(conn, opt.HeaderType, opt.CodecType)
+	defer func() { _ = cc.Close() }()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	b.ResetTimer()
+	go func() {
+		defer wg.Done()
+		args := newBatch(1)
+		bw := cc.(codec.BufferedWriter)
+		for i := 1; i <= b.N; i++ {
+			_ = bw.WriteBuffered(&codec.Header{ServiceMethod: "Tally.Sum", Seq: uint64(i)}, args)
+			if i%64 == 0 {
+				_ = bw.Flush()
+			}
+		}
+		_ = bw.Flush()
+	}()
+	for i := 0; i < b.N; i++ {
+		var h codec.Header
+		var reply int
+		if err := cc.ReadHeader(&h); err != nil {
+			b.Fatal(err)
+		}
+		_ = cc.ReadBody(&reply)
+	}
+	wg.Wait()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "calls/s")
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"gmrpc/rpcerr"
+	"gmrpc/service"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+延迟响应 处理函数签名为 func (T) M(ctx context.Context, args A, w ResponseWriter) error
+处理函数返回后不再占用协程 请求保持未完成 直到 w.Send / w.Error 超时 _cancel 或连接关闭中最先发生的一个
+ctx 在响应完成时取消 超时与 HandleTimeout 及客户端传来的剩余时间一致
+拦截器看到的结果为 *service.DeferredReply 不能读取或修改结果 延迟响应方法的参数不放回池中 处理函数返回后可以继续使用
+响应可能在处理函数返回前由其他协程 超时或取消完成 响应头使用请求头的副本 处理函数与拦截器读取的请求头不受影响
+*/
+
+type ResponseWriter = service.ResponseWriter
+
+var (
+	ErrResponseSent      = errors.New("rpc server: response already sent")
+	ErrResponseAbandoned = errors.New("rpc server: response abandoned") // 已超时 被取消或连接已关闭
+)
+
+type responseWriter struct {
+	mu     sync.Mutex
+	done   bool
+	sent   bool // 由 Send Error 或处理函数的错误完成
+	finish func(err error, body interface{})
+}
+
+func (w *responseWriter) complete(err error, body interface{}, sent bool) error {
+	w.mu.Lock()
+	if w.done {
+		sent := w.sent
+		w.mu.Unlock()
+		if sent {
+			return ErrResponseSent
+		}
+		return ErrResponseAbandoned
+	}
+	w.done, w.sent = true, sent
+	w.mu.Unlock()
+	w.finish(err, body)
+	return nil
+}
+
+func (w *responseWriter) Send(reply interface{}) error {
+	return w.complete(nil, reply, true)
+}
+
+func (w *responseWriter) Error(err error) error {
+	if err == nil {
+		err = rpcerr.New(rpcerr.Unknown, "rpc server: deferred response completed with nil error")
+	}
+	return w.complete(err, nil, true)
+}
+
+// 在处理请求的协程中调用处理函数 返回后由 Send Error 超时或取消完成响应与清理
+func (server *Server) handleDeferred(req *request, respond func(error, interface{}), limit time.Duration, source string, wg *sync.WaitGroup) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if limit > 0 {
+		ctx, cancel = context.WithTimeout(req.ctx, limit)
+	} else {
+		ctx, cancel = context.WithCancel(req.ctx)
+	}
+	atomic.AddInt64(&server.inflight, 1)
+	watched := server.watchdog.begin(req.config.SlowThreshold, req.h.ServiceMethod, req.h.Seq)
+	start := time.Now()
+	wg.Add(1)
+	w := &responseWriter{finish: func(err error, body interface{}) {
+		respond(err, body)
+		cancel()
+		req.mtype.TrackLatency(time.Since(start).Nanoseconds())
+		server.watchdog.end(watched)
+		req.release()
+		req.freeMem()
+		atomic.AddInt64(&server.inflight, -1)
+		wg.Done()
+	}}
+	context.AfterFunc(ctx, func() {
+		err := error(context.Canceled)
+		if req.ctx.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = timeoutError(limit, source)
+		}
+		_ = w.complete(err, nil, false)
+	})
+	// 连接关闭时取消 避免等待永远不会到来的响应
+	req.conn.markDeferred(req.h.Seq)
+
+	req.replyv = reflect.ValueOf(&service.DeferredReply{Writer: w})
+	var err error
+	server.watchdog.do(watched, func() { err = server.invokeWith(ctx, req) })
+	if err != nil {
+		_ = w.complete(err, nil, true)
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"testing"
+	"time"
+)
+
+type Webhook struct {
+	held  chan ResponseWriter
+	sends chan error
+}
+
+// 由定时器协程完成响应 并尝试重复发送
+func (h *Webhook) Delayed(ctx context.Context, id int, w ResponseWriter) error {
+	if id < 0 {
+		return errors.New("bad id")
+	}
+	time.AfterFunc(20*time.Millisecond, func() {
+		h.sends <- w.Send(fmt.Sprintf("event %d", id))
+		h.sends <- w.Send("again")
+	})
+	return nil
+}
+
+// 保留响应对象 由测试决定何时完成
+func (h *Webhook) Hold(ctx context.Context, id int, w ResponseWriter) error {
+	h.held <- w
+	return nil
+}
+
+func TestServer_DeferredResponse(t *testing.T) {
+	hook := &Webhook{held: make(chan ResponseWriter, 1), sends: make(chan error, 2)}
+	s := NewServer()
+	_assert(s.Register(hook) == nil, "deferred methods should register")
+	read := func(cc codec.Codec) (codec.Header, string) {
+		var h codec.Header
+		var reply string
+		_assert(cc.ReadHeader(&h) == nil, "read header failed")
+		if h.Error != "" {
+			_assert(cc.ReadBody(nil) == nil, "read body failed")
+			return h, ""
+		}
+		_assert(cc.ReadBody(&reply) == nil, "read body failed")
+		return h, reply
+	}
+
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	// 等待中的请求不阻塞同一连接上的其他请求
+	_ = cc.Write(&codec.Header{ServiceMethod: "Webhook.Hold", Seq: 1}, 1)
+	w := <-hook.held
+	_ = cc.Write(&codec.Header{ServiceMethod: "Webhook.Delayed", Seq: 2}, 2)
+	h, reply := read(cc)
+	_assert(h.Seq == 2 && h.Error == "" && reply == "event 2", "unexpected response %+v %q", h, reply)
+	_assert(<-hook.sends == nil && errors.Is(<-hook.sends, ErrResponseSent), "second send should fail")
+
+	_ = cc.Write(&codec.Header{ServiceMethod: "Webhook.Delayed", Seq: 3}, -1)
+	h, _ = read(cc)
+	_assert(h.Seq == 3 && h.Error == "bad id", "handler error should be sent at once, got %+v", h)
+
+	go func() { hook.sends <- w.Error(errors.New("upstream failed")) }()
+	h, _ = read(cc)
+	_assert(<-hook.sends == nil, "error should complete the response")
+	_assert(h.Seq == 1 && h.Error == "upstream failed", "unexpected response %+v", h)
+
+	// 连接关闭后等待中的响应被放弃 连接可以正常退出
+	_ = cc.Write(&codec.Header{ServiceMethod: "Webhook.Hold", Seq: 4}, 4)
+	w = <-hook.held
+	stop()
+	_assert(errors.Is(w.Send("late"), ErrResponseAbandoned), "send after close should be abandoned")
+}
+
+func TestServer_DeferredTimeout(t *testing.T) {
+	hook := &Webhook{held: make(chan ResponseWriter, 1)}
+	s := NewServer()
+	_ = s.Register(hook)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType, HandleTimeout: 50 * time.Millisecond})
+	defer stop()
+
+	_ = cc.Write(&codec.Header{ServiceMethod: "Webhook.Hold", Seq: 1}, 1)
+	w := <-hook.held
+	var h codec.Header
+	_assert(cc.ReadHeader(&h) == nil && cc.ReadBody(nil) == nil, "read failed")
+	_assert(h.Status != nil && h.Status.Code == rpcerr.DeadlineExceeded, "expect timeout, got %+v", h)
+	_assert(errors.Is(w.Send("late"), ErrResponseAbandoned), "send after timeout should be abandoned")
+}
+
+// 处理函数返回前由其他协程完成响应 拦截器仍能读取原来的请求头
+func TestServer_DeferredSendBeforeReturn(t *testing.T) {
+	hook := &Webhook{held: make(chan ResponseWriter, 1)}
+	s := NewServer()
+	_ = s.Register(hook)
+	seen := make(chan string, 1)
+	s.Use(func(ctx context.Context, info *MethodInfo, argv, replyv interface{}, handler UnaryHandler) error {
+		err := handler(ctx, argv, replyv)
+		// ctx 在响应完成时取消 之后读取请求头
+		<-ctx.Done()
+		seen <- info.Header.Error + "|" + info.Header.Metadata["user"]
+		return err
+	})
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType, Features: FeatureMetadata})
+	defer stop()
+
+	_ = cc.Write(&codec.Header{ServiceMethod: "Webhook.Hold", Seq: 1, Metadata: map[string]string{"user": "alice"}}, 1)
+	w := <-hook.held
+	go func() { _ = w.Error(errors.New("upstream failed")) }()
+	var h codec.Header
+	_assert(cc.ReadHeader(&h) == nil && cc.ReadBody(nil) == nil, "read failed")
+	_assert(h.Error == "upstream failed", "unexpected response %+v", h)
+	_assert(<-seen == "|alice", "request header should not be modified by the response")
+}
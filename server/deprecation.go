@@ -0,0 +1,37 @@
+package server
+
+import (
+	"gmrpc/codec"
+	"gmrpc/service"
+)
+
+/*
+方法弃用 重命名方法后旧的调用方仍可使用 响应元数据中带有弃用说明
+*/
+
+const (
+	DeprecatedKey          = "deprecated"            // 弃用说明
+	DeprecatedForwardToKey = "deprecated-forward-to" // 实际处理请求的方法
+)
+
+type Deprecation = service.Deprecation
+
+// 在响应头中写入弃用信息
+func setDeprecation(h *codec.Header, req *request) {
+	d := req.svc.Deprecation(req.method)
+	if d == nil {
+		return
+	}
+	md := make(map[string]string, len(h.Metadata)+2)
+	for k, v := range h.Metadata {
+		md[k] = v
+	}
+	md[DeprecatedKey] = d.Message
+	if md[DeprecatedKey] == "" {
+		md[DeprecatedKey] = h.ServiceMethod + " is deprecated"
+	}
+	if d.ForwardTo != "" {
+		md[DeprecatedForwardToKey] = req.svc.Name + "." + d.ForwardTo
+	}
+	h.Metadata = md
+}
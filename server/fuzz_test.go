@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"gmrpc/codec"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 握手之后的字节由模糊测试给出 每种编码一个 Option
+var fuzzOptions = []*Option{
+	{MagicNumber: MagicNumber, CodecType: codec.GobType},
+	{MagicNumber: MagicNumber, CodecType: codec.JsonType},
+	{MagicNumber: MagicNumber, CodecType: codec.GobType, HeaderType: codec.BinaryHeader},
+	{MagicNumber: MagicNumber, CodecType: codec.JsonType, HeaderType: codec.BinaryHeader},
+	{MagicNumber: MagicNumber, CodecType: codec.JSONRPC2Type},
+}
+
+// 单个输入的处理时间上限 超过视为挂起
+const fuzzTimeout = 5 * time.Second
+
+// 读取固定的字节 写入丢弃 读完后返回 EOF
+type replayConn struct {
+	r      io.Reader
+	mu     sync.Mutex
+	closed bool
+}
+
+func (c *replayConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func (c *replayConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	return len(p), nil
+}
+
+func (c *replayConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// 记录真实会话中客户端在握手之后发送的字节 作为模糊测试的种子
+func recordSession(t testing.TB, opt *Option, calls int) []byte {
+	serverConn, clientConn := net.Pipe()
+	s := NewServer()
+	_ = s.Register(new(Foo))
+	done := make(chan struct{})
+	go func() {
+		s.ServeConn(serverConn)
+		close(done)
+	}()
+	_ = json.NewEncoder(clientConn).Encode(opt)
+
+	var sent bytes.Buffer
+	cc, err := codec.New(&teeConn{Conn: clientConn, w: &sent}, opt.HeaderType, opt.CodecType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= calls; i++ {
+		h := &codec.Header{ServiceMethod: "Foo.Sum", Seq: uint64(i)}
+		if err := cc.Write(h, &Args{Num1: i, Num2: i * i}); err != nil {
+			t.Fatal(err)
+		}
+		var rh codec.Header
+		var reply int
+		_ = cc.ReadHeader(&rh)
+		_ = cc.ReadBody(&reply)
+		_assert(rh.Error == "" && reply == i+i*i, "session: unexpected reply %d %q", reply, rh.Error)
+	}
+	// 不存在的方法 走错误回复的路径
+	_ = cc.Write(&codec.Header{ServiceMethod: "Foo.Missing", Seq: uint64(calls + 1)}, &Args{})
+	var rh codec.Header
+	_ = cc.ReadHeader(&rh)
+	_ = cc.SkipBody()
+	_ = cc.Close()
+	<-done
+	return sent.Bytes()
+}
+
+// 记录写入的字节
+type teeConn struct {
+	net.Conn
+	w io.Writer
+}
+
+func (c *teeConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.w.Write(p[:n])
+	return n, err
+}
+
+func FuzzServeConn(f *testing.F) {
+	for i, opt := range fuzzOptions {
+		session := recordSession(f, opt, 2)
+		f.Add(uint8(i), session)
+		f.Add(uint8(i), session[:len(session)/2])
+		f.Add(uint8(i), []byte{})
+	}
+
+	s := NewServer()
+	_ = s.Register(new(Foo))
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(out) })
+
+	f.Fuzz(func(t *testing.T, which uint8, data []byte) {
+		opt := fuzzOptions[int(which)%len(fuzzOptions)]
+		line, _ := json.Marshal(opt)
+		conn := &replayConn{r: io.MultiReader(bytes.NewReader(append(line, '\n')), bytes.NewReader(data))}
+		done := make(chan struct{})
+		go func() {
+			s.ServeConn(conn)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(fuzzTimeout):
+			t.Fatalf("ServeConn did not return within %s for %d bytes", fuzzTimeout, len(data))
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+	"gmrpc/service"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+服务分组 以前缀区分同一服务的不同版本 例如 v1.Math.Add 与 v2.Math.Add
+前缀可以包含多段 每段需要是合法的服务名 findService 找不到带前缀的服务时回退到去掉前缀的服务名
+*/
+
+// 以 prefix.类型名 注册服务
+func (server *Server) RegisterGroup(prefix string, rcvr interface{}) error {
+	for _, part := range strings.Split(prefix, ".") {
+		if err := validateServiceName(part); err != nil {
+			return fmt.Errorf("rpc: invalid group prefix %q: %w", prefix, err)
+		}
+	}
+	name := reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name()
+	if err := validateServiceName(name); err != nil {
+		return err
+	}
+	return server.register(service.NewNamedService(rcvr, prefix+"."+name), ServiceOptions{})
+}
+
+// 删除前缀下的所有服务与方法校验 返回删除的服务名
+func (server *Server) UnregisterGroup(prefix string) []string {
+	var removed []string
+	server.serviceMap.Range(func(key, _ interface{}) bool {
+		if name := key.(string); strings.HasPrefix(name, prefix+".") {
+			server.serviceMap.Delete(name)
+			removed = append(removed, name)
+		}
+		return true
+	})
+	server.validators.Range(func(key, _ interface{}) bool {
+		if strings.HasPrefix(key.(string), prefix+".") {
+			server.validators.Delete(key)
+		}
+		return true
+	})
+	sort.Strings(removed)
+	return removed
+}
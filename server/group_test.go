@@ -0,0 +1,52 @@
+package server
+
+import (
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"reflect"
+	"testing"
+)
+
+func TestServer_RegisterGroup(t *testing.T) {
+	s := NewServer()
+	_assert(s.RegisterGroup("v1", new(Math)) == nil, "register v1 failed")
+	_assert(s.RegisterGroup("v2", new(Math)) == nil, "register v2 failed")
+	_assert(s.RegisterGroup("v1", new(Math)) != nil, "duplicate group service should be rejected")
+	for _, prefix := range []string{"", "a..b", "_internal", "v1\n"} {
+		_assert(s.RegisterGroup(prefix, new(Foo)) != nil, "prefix %q should be rejected", prefix)
+	}
+
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	defer stop()
+	seq := uint64(0)
+	call := func(method string) codec.Header {
+		seq++
+		_assert(cc.Write(&codec.Header{ServiceMethod: method, Seq: seq}, Args{Num1: 1, Num2: 2}) == nil, "write failed")
+		var h codec.Header
+		var reply int
+		_assert(cc.ReadHeader(&h) == nil, "read header failed")
+		if h.Error != "" {
+			_ = cc.ReadBody(nil)
+			return h
+		}
+		_assert(cc.ReadBody(&reply) == nil && reply == 3, "%s: unexpected reply %d", method, reply)
+		return h
+	}
+
+	for _, method := range []string{"v1.Math.Add", "v2.Math.Add"} {
+		h := call(method)
+		_assert(h.Error == "", "%s should be callable: %s", method, h.Error)
+	}
+	h := call("Math.Add")
+	_assert(h.Status != nil && h.Status.Code == rpcerr.NotFound, "short name should not match a group: %+v", h)
+
+	removed := s.UnregisterGroup("v1")
+	_assert(reflect.DeepEqual(removed, []string{"v1.Math"}), "unexpected removed services %v", removed)
+	h = call("v1.Math.Add")
+	_assert(h.Status != nil && h.Status.Code == rpcerr.NotFound, "v1 should be removed: %+v", h)
+	_assert(call("v2.Math.Add").Error == "", "v2 should remain")
+
+	// 带前缀的服务不存在时回退到去掉前缀的服务名
+	_ = s.Register(new(Math))
+	_assert(call("v1.Math.Add").Error == "", "prefixed name should fall back to the short name")
+}
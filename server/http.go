@@ -0,0 +1,158 @@
+package server
+
+import (
+	"fmt"
+	"gmrpc/codec"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+通过 HTTP 建立连接 Option 放在请求头中 不在消息体前发送 json
+适用于只转发请求头、会改写消息体前缀的反向代理
+服务端返回 200 后劫持连接 之后与 ServeConn 相同
+*/
+
+const (
+	HTTPPath      = "/_gmrpc_"
+	HTTPConnected = "200 Connected to gmrpc"
+
+	HTTPCodecHeader      = "X-GEERPC-Codec"
+	HTTPMagicHeader      = "X-GEERPC-Magic"
+	HTTPHeaderTypeHeader = "X-GEERPC-Header-Type"
+	HTTPTimeoutHeader    = "X-GEERPC-Handle-Timeout" // 毫秒
+	HTTPStrictHeader     = "X-GEERPC-Strict"
+	HTTPCapsHeader       = "X-GEERPC-Capabilities"
+	HTTPCompressHeader   = "X-GEERPC-Compression"
+	HTTPProtocolHeader   = "X-GEERPC-Protocol" // 协议版本
+	HTTPFeaturesHeader   = "X-GEERPC-Features" // 功能标志的十进制值
+)
+
+// 将 Option 编码为 HTTP 请求头
+func (opt *Option) HTTPHeader() http.Header {
+	h := make(http.Header)
+	h.Set(HTTPMagicHeader, strconv.Itoa(opt.MagicNumber))
+	h.Set(HTTPCodecHeader, string(opt.CodecType))
+	if opt.HeaderType != codec.CombinedHeader {
+		h.Set(HTTPHeaderTypeHeader, string(opt.HeaderType))
+	}
+	if opt.HandleTimeout > 0 {
+		h.Set(HTTPTimeoutHeader, strconv.FormatInt(opt.HandleTimeout.Milliseconds(), 10))
+	}
+	if opt.StrictDecoding {
+		h.Set(HTTPStrictHeader, "true")
+	}
+	if opt.Capabilities {
+		h.Set(HTTPCapsHeader, "true")
+	}
+	if opt.Compression != "" {
+		h.Set(HTTPCompressHeader, opt.Compression)
+	}
+	if opt.ProtocolVersion > 0 {
+		h.Set(HTTPProtocolHeader, strconv.Itoa(opt.ProtocolVersion))
+	}
+	if opt.Features != 0 {
+		h.Set(HTTPFeaturesHeader, strconv.FormatUint(uint64(opt.Features), 10))
+	}
+	return h
+}
+
+// 从 HTTP 请求头解析 Option
+func OptionFromHTTPHeader(h http.Header) (*Option, error) {
+	magic, err := strconv.Atoi(h.Get(HTTPMagicHeader))
+	if err != nil || magic != MagicNumber {
+		return nil, fmt.Errorf("invalid magic number %q", h.Get(HTTPMagicHeader))
+	}
+	opt := &Option{
+		MagicNumber: magic,
+		CodecType:   codec.Type(h.Get(HTTPCodecHeader)),
+		HeaderType:  codec.HeaderType(h.Get(HTTPHeaderTypeHeader)),
+	}
+	if opt.CodecType == "" {
+		return nil, fmt.Errorf("missing %s header", HTTPCodecHeader)
+	}
+	if v := h.Get(HTTPTimeoutHeader); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ms < 0 {
+			return nil, fmt.Errorf("invalid handle timeout %q", v)
+		}
+		opt.HandleTimeout = time.Duration(ms) * time.Millisecond
+	}
+	if v := h.Get(HTTPStrictHeader); v != "" {
+		if opt.StrictDecoding, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid strict decoding flag %q", v)
+		}
+	}
+	if v := h.Get(HTTPCapsHeader); v != "" {
+		if opt.Capabilities, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid capabilities flag %q", v)
+		}
+	}
+	opt.Compression = h.Get(HTTPCompressHeader)
+	if v := h.Get(HTTPProtocolHeader); v != "" {
+		if opt.ProtocolVersion, err = strconv.Atoi(v); err != nil || opt.ProtocolVersion < 0 {
+			return nil, fmt.Errorf("invalid protocol version %q", v)
+		}
+	}
+	if v := h.Get(HTTPFeaturesHeader); v != "" {
+		f, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid features %q", v)
+		}
+		opt.Features = Feature(f)
+	}
+	return opt, nil
+}
+
+// 从请求头读取 Option 劫持连接后处理请求
+func (server *Server) ServeHTTPConn(w http.ResponseWriter, r *http.Request) {
+	opt, err := OptionFromHTTPHeader(r.Header)
+	if err != nil {
+		http.Error(w, "rpc server: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	codecs := server.codecRegistry()
+	if !codecs.Supported(opt.HeaderType, opt.CodecType) {
+		http.Error(w, fmt.Sprintf("rpc server: unsupported codec %s/%s", opt.HeaderType, opt.CodecType), http.StatusBadRequest)
+		return
+	}
+	release, err := server.acquireConn(opt.ConnectTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "rpc server: connection does not support hijacking", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		log.Println("rpc server [hijack] err: ", r.RemoteAddr, err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := io.WriteString(conn, "HTTP/1.0 "+HTTPConnected+"\n\n"); err != nil {
+		log.Println("rpc server [http] err: ", err)
+		return
+	}
+	cc, err := server.newCodec(conn, &bufConn{r: rw.Reader, ReadWriteCloser: conn}, opt, codecs)
+	if err != nil {
+		log.Println("rpc server [codec type] err: ", err)
+		return
+	}
+	if sd, ok := cc.(codec.StrictDecoding); ok && opt.StrictDecoding {
+		sd.SetStrictDecoding(true)
+	}
+	features, err := server.handshake(conn, cc, opt)
+	if err != nil {
+		log.Println("rpc server [handshake] err: ", err)
+		return
+	}
+	server.serveCodec(cc, opt.HandleTimeout, features, conn.RemoteAddr())
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/tracing"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// 拦截器可见的请求信息
+type MethodInfo struct {
+	ServiceMethod string
+	Header        *codec.Header
+	Body          []byte // 收到的消息体 (解压后 未解码) 只在分帧格式下有值 流式与分块参数为空 不能修改
+}
+
+// 最终执行服务方法的函数
+type UnaryHandler func(ctx context.Context, argv, replyv interface{}) error
+
+// 服务端拦截器 由拦截器决定是否调用 handler
+type ServerInterceptor func(ctx context.Context, info *MethodInfo, argv, replyv interface{}, handler UnaryHandler) error
+
+// 注册拦截器 按注册顺序由外向内执行
+func (server *Server) Use(interceptors ...ServerInterceptor) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.interceptors = append(server.interceptors, interceptors...)
+}
+
+func (server *Server) chainInterceptors(info *MethodInfo, tr *tracing.Trace, handler UnaryHandler) UnaryHandler {
+	server.mu.RLock()
+	interceptors := server.interceptors
+	server.mu.RUnlock()
+
+	if tr != nil {
+		handler = traceHandler(tr, "handler", handler)
+	}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, argv, replyv interface{}) error {
+			return interceptor(ctx, info, argv, replyv, next)
+		}
+		if tr != nil {
+			handler = traceHandler(tr, funcName(interceptor), handler)
+		}
+	}
+	return handler
+}
+
+func traceHandler(tr *tracing.Trace, name string, handler UnaryHandler) UnaryHandler {
+	return func(ctx context.Context, argv, replyv interface{}) error {
+		tr.Enter(name)
+		defer tr.Exit()
+		return handler(ctx, argv, replyv)
+	}
+}
+
+// 拦截器的函数名 去掉包路径 作为火焰图中的栈帧名
+func funcName(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return "interceptor"
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.NewReplacer(";", "_", " ", "_").Replace(name)
+}
+
+// 设置火焰图追踪 传入 nil 关闭
+func (server *Server) SetFlamegraphTracer(t *tracing.FlamegraphTracer) {
+	server.tracer.Store(t)
+}
+
+func (server *Server) flamegraphTracer() *tracing.FlamegraphTracer {
+	t, _ := server.tracer.Load().(*tracing.FlamegraphTracer)
+	return t
+}
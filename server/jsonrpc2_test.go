@@ -0,0 +1,44 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"gmrpc/codec"
+	"net"
+	"testing"
+)
+
+// 直接写入 JSON-RPC 2.0 请求文本 检查服务端的响应
+func TestServer_JSONRPC2(t *testing.T) {
+	var foo Foo
+	s := NewServer()
+	_ = s.Register(&foo)
+
+	serverConn, clientConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.ServeConn(serverConn)
+		close(done)
+	}()
+	defer func() {
+		_ = clientConn.Close()
+		<-done
+	}()
+	_ = json.NewEncoder(clientConn).Encode(&Option{MagicNumber: MagicNumber, CodecType: codec.JSONRPC2Type})
+	r := bufio.NewReader(clientConn)
+
+	for _, c := range []struct{ req, resp string }{
+		{`{"jsonrpc":"2.0","method":"Foo.Sum","params":{"Num1":1,"Num2":2},"id":1}`,
+			`{"jsonrpc":"2.0","result":3,"id":1}`},
+		{`{"jsonrpc":"2.0","method":"Foo.Sum","params":{"Num1":4,"Num2":5},"id":"abc"}`,
+			`{"jsonrpc":"2.0","result":9,"id":"abc"}`},
+		// 通知没有响应 下一条响应属于之后的请求
+		{`{"jsonrpc":"2.0","method":"Foo.Sum","params":{"Num1":1,"Num2":1}}` + "\n" +
+			`{"jsonrpc":"2.0","method":"Foo.Nope","params":{},"id":7}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"rpc server: can't find method Nope","data":{"Code":3,"Message":"rpc server: can't find method Nope","Details":null,"RetryAfterMs":0}},"id":7}`},
+	} {
+		go func() { _, _ = clientConn.Write([]byte(c.req + "\n")) }()
+		line, err := r.ReadString('\n')
+		_assert(err == nil && line == c.resp+"\n", "request %s\ngot  %s\nwant %s (%v)", c.req, line, c.resp, err)
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"gmrpc/rpcerr"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 服务端过载 由限流或并发上限触发 携带建议的重试等待时间
+var ErrServerOverloaded = rpcerr.New(rpcerr.Overloaded, "rpc server: server overloaded")
+
+func overloadedError(wait time.Duration) *rpcerr.RPCError {
+	e := *ErrServerOverloaded
+	ms := math.Ceil(float64(wait) / float64(time.Millisecond))
+	if ms < 1 {
+		ms = 1
+	}
+	e.RetryAfterMs = uint32(ms)
+	return &e
+}
+
+// 令牌桶限流
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // 每秒生成的令牌数
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (l *rateLimiter) set(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.burst = rate, math.Max(1, float64(burst))
+	l.tokens = math.Min(l.tokens, l.burst)
+}
+
+// 取一个令牌 失败时返回下一个令牌产生前需要等待的时间
+func (l *rateLimiter) allow(now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// 并发上限 超出时直接拒绝 等待时间按处理耗时的滑动平均估算
+type concurrencyLimiter struct {
+	max    int64
+	active int64
+	avgNs  int64 // 处理耗时的指数滑动平均
+}
+
+func (l *concurrencyLimiter) setMax(n int) {
+	atomic.StoreInt64(&l.max, int64(n))
+}
+
+func (l *concurrencyLimiter) acquire() (bool, time.Duration) {
+	if atomic.AddInt64(&l.active, 1) <= atomic.LoadInt64(&l.max) {
+		return true, 0
+	}
+	atomic.AddInt64(&l.active, -1)
+	return false, time.Duration(atomic.LoadInt64(&l.avgNs))
+}
+
+func (l *concurrencyLimiter) release(elapsed time.Duration) {
+	atomic.AddInt64(&l.active, -1)
+	for {
+		old := atomic.LoadInt64(&l.avgNs)
+		avg := int64(elapsed)
+		if old != 0 {
+			avg = old + (int64(elapsed)-old)/8
+		}
+		if atomic.CompareAndSwapInt64(&l.avgNs, old, avg) {
+			return
+		}
+	}
+}
+
+// 设置每秒允许的请求数 rate <= 0 关闭限流
+func (server *Server) SetRateLimit(rate float64, burst int) {
+	server.UpdateConfig(func(c *Config) {
+		c.RateLimit, c.RateBurst = rate, burst
+	})
+}
+
+// 设置同时处理的请求上限 n <= 0 表示不限制
+func (server *Server) SetMaxConcurrentRequests(n int) {
+	server.UpdateConfig(func(c *Config) {
+		c.MaxConcurrent = n
+	})
+}
+
+// 设置连接的空闲超时 d <= 0 表示不关闭空闲连接 对已建立的连接同样生效
+func (server *Server) SetIdleTimeout(d time.Duration) {
+	server.UpdateConfig(func(c *Config) {
+		c.IdleTimeout = d
+	})
+}
+
+// 请求准入检查 通过时返回处理完成后需调用的释放函数
+func (server *Server) admit() (func(), error) {
+	server.mu.RLock()
+	rl, cl := server.rateLimiter, server.concurrency
+	server.mu.RUnlock()
+
+	if rl != nil {
+		if ok, wait := rl.allow(time.Now()); !ok {
+			return nil, overloadedError(wait)
+		}
+	}
+	if cl == nil {
+		return func() {}, nil
+	}
+	ok, wait := cl.acquire()
+	if !ok {
+		return nil, overloadedError(wait)
+	}
+	start := time.Now()
+	return func() { cl.release(time.Since(start)) }, nil
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"gmrpc/codec"
+	"sync"
+	"time"
+)
+
+/*
+请求内存预算 按解码前消息体的字节数估算每个请求占用的内存 记到响应发送且处理函数返回
+分帧格式 (codec.FrameSizer) 在读取与解码消息体之前按长度前缀声明的大小占用 预算不足时消息体不读取 直接丢弃
+其他编码没有长度前缀 读取后按 codec.BodySizer 给出的大小占用 两者都未实现时不计入
+超时的请求在处理函数返回后才释放 预算用尽时读取循环等待 MemoryWait 仍不足时返回 Overloaded
+单个请求超过预算时只在没有其他请求占用内存时放行 避免永远无法处理
+结果按编码后大小的下界 (codec.MinBodySize) 从处理函数返回记到发送完成 不等待也不拒绝 已完成的结果总能发送 之后的请求等待它们释放
+*/
+
+type memoryBudget struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+	freed chan struct{} // 每次释放时关闭并替换 唤醒等待者
+}
+
+func (b *memoryBudget) setLimit(limit int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit = limit
+	b.wake()
+}
+
+// 调用方持有 mu
+func (b *memoryBudget) wake() {
+	if b.freed != nil {
+		close(b.freed)
+		b.freed = nil
+	}
+}
+
+func (b *memoryBudget) fits(n int64) bool {
+	return b.limit <= 0 || b.used+n <= b.limit || b.used == 0
+}
+
+// 占用 n 字节 预算不足时最多等待 wait 仍不足时返回 Overloaded
+func (b *memoryBudget) acquire(n int64, wait time.Duration) error {
+	var deadline time.Time
+	for {
+		b.mu.Lock()
+		if b.fits(n) {
+			b.used += n
+			b.mu.Unlock()
+			return nil
+		}
+		if wait <= 0 {
+			b.mu.Unlock()
+			return overloadedError(time.Millisecond)
+		}
+		if deadline.IsZero() {
+			deadline = time.Now().Add(wait)
+		}
+		if b.freed == nil {
+			b.freed = make(chan struct{})
+		}
+		freed := b.freed
+		b.mu.Unlock()
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return overloadedError(time.Millisecond)
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-freed:
+			timer.Stop()
+		case <-timer.C:
+			return overloadedError(wait)
+		}
+	}
+}
+
+// 不检查预算直接占用 n 字节
+func (b *memoryBudget) add(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used += n
+}
+
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	b.wake()
+}
+
+func (b *memoryBudget) inUse() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// 当前计入预算的请求内存 单位字节
+func (server *Server) MemoryInUse() int64 {
+	return server.memory.inUse()
+}
+
+// 设置请求内存预算 limit <= 0 表示不限制 wait 为预算不足时等待的时间 0 表示直接拒绝
+func (server *Server) SetMemoryBudget(limit int64, wait time.Duration) {
+	server.UpdateConfig(func(c *Config) {
+		c.MemoryBudget, c.MemoryWait = limit, wait
+	})
+}
+
+// 读取消息体之前按声明的大小占用预算 编解码器不支持时返回 nil 读取后由 acquireMemory 计入
+func (server *Server) acquireFrameMemory(cc codec.Codec) (func(), error) {
+	fs, ok := cc.(codec.FrameSizer)
+	if !ok || fs.FrameSize() < 0 {
+		return nil, nil
+	}
+	return server.chargeMemory(int64(fs.FrameSize()))
+}
+
+// 按消息体大小占用预算 返回释放函数 只能调用一次 size > 0 时为已知的消息体大小 (分块发送的参数)
+func (server *Server) acquireMemory(cc codec.Codec, size int) (func(), error) {
+	bs, ok := cc.(codec.BodySizer)
+	if !ok && size <= 0 {
+		return func() {}, nil
+	}
+	n := int64(size)
+	if size <= 0 {
+		n = int64(bs.BodySize())
+	}
+	return server.chargeMemory(n)
+}
+
+func (server *Server) chargeMemory(n int64) (func(), error) {
+	if err := server.memory.acquire(n, server.Config().MemoryWait); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() { once.Do(func() { server.memory.release(n) }) }, nil
+}
+
+// 结果编码后至少占用的内存 在发送完成后释放 没有设置预算时不估算
+func (server *Server) chargeReply(limit int64, body interface{}) func() {
+	if limit <= 0 {
+		return func() {}
+	}
+	n := int64(codec.MinBodySize(body, int(limit)))
+	server.memory.add(n)
+	return func() { server.memory.release(n) }
+}
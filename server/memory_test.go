@@ -0,0 +1,145 @@
+package server
+
+import (
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Holder struct {
+	server  *Server
+	started chan struct{}
+	release chan struct{}
+	peak    int64
+}
+
+func (h *Holder) Hold(b []byte, reply *int) error {
+	for {
+		peak, cur := atomic.LoadInt64(&h.peak), h.server.MemoryInUse()
+		if cur <= peak || atomic.CompareAndSwapInt64(&h.peak, peak, cur) {
+			break
+		}
+	}
+	h.started <- struct{}{}
+	<-h.release
+	*reply = len(b)
+	return nil
+}
+
+func (h *Holder) Big(n int, reply *[]byte) error {
+	*reply = make([]byte, n)
+	return nil
+}
+
+func newHolder() (*Server, *Holder) {
+	s := NewServer()
+	h := &Holder{server: s, started: make(chan struct{}, 8), release: make(chan struct{})}
+	_ = s.Register(h)
+	return s, h
+}
+
+func waitMemory(s *Server, want int64) bool {
+	deadline := time.Now().Add(time.Second)
+	for s.MemoryInUse() != want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return s.MemoryInUse() == want
+}
+
+func TestServer_MemoryBudgetRejects(t *testing.T) {
+	s, h := newHolder()
+	s.SetMemoryBudget(3000, 0)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType, HeaderType: codec.BinaryHeader})
+	defer stop()
+
+	payload := make([]byte, 1200)
+	for seq := uint64(1); seq <= 2; seq++ {
+		_assert(cc.Write(&codec.Header{ServiceMethod: "Holder.Hold", Seq: seq}, payload) == nil, "write failed")
+		<-h.started
+	}
+	used := s.MemoryInUse()
+	_assert(used > 2400 && used <= 3000, "expect both bodies accounted, got %d", used)
+
+	_assert(cc.Write(&codec.Header{ServiceMethod: "Holder.Hold", Seq: 3}, payload) == nil, "write failed")
+	var hdr codec.Header
+	_assert(cc.ReadHeader(&hdr) == nil && hdr.Seq == 3 && rpcerr.CodeOf(hdr.Status) == rpcerr.Overloaded, "expect Overloaded, got %+v", hdr)
+	_ = cc.ReadBody(nil)
+
+	close(h.release)
+	for i := 0; i < 2; i++ {
+		var reply int
+		_assert(cc.ReadHeader(&hdr) == nil && hdr.Error == "" && cc.ReadBody(&reply) == nil && reply == 1200, "unexpected reply %+v", hdr)
+	}
+	_assert(waitMemory(s, 0), "accounting should return to zero, got %d", s.MemoryInUse())
+}
+
+func TestServer_MemoryBudgetQueues(t *testing.T) {
+	s, h := newHolder()
+	s.SetMemoryBudget(3000, 2*time.Second)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType, HeaderType: codec.BinaryHeader})
+	defer stop()
+
+	payload := make([]byte, 1200)
+	for seq := uint64(1); seq <= 3; seq++ {
+		_assert(cc.Write(&codec.Header{ServiceMethod: "Holder.Hold", Seq: seq}, payload) == nil, "write failed")
+	}
+	<-h.started
+	<-h.started
+	select {
+	case <-h.started:
+		t.Fatal("third request should wait for memory")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 第一个请求完成后 排队的请求开始处理
+	h.release <- struct{}{}
+	var hdr codec.Header
+	var reply int
+	_assert(cc.ReadHeader(&hdr) == nil && cc.ReadBody(&reply) == nil && hdr.Error == "", "unexpected reply %+v", hdr)
+	<-h.started
+	close(h.release)
+	for i := 0; i < 2; i++ {
+		_assert(cc.ReadHeader(&hdr) == nil && cc.ReadBody(&reply) == nil && hdr.Error == "", "unexpected reply %+v", hdr)
+	}
+	_assert(atomic.LoadInt64(&h.peak) <= 3000, "budget exceeded: peak %d", h.peak)
+	_assert(waitMemory(s, 0), "accounting should return to zero, got %d", s.MemoryInUse())
+}
+
+// 超时响应后处理函数仍在运行 返回后才释放
+func TestServer_MemoryBudgetTimeout(t *testing.T) {
+	s, h := newHolder()
+	s.SetMemoryBudget(1<<20, 0)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType, HeaderType: codec.BinaryHeader, HandleTimeout: 20 * time.Millisecond})
+	defer stop()
+
+	_assert(cc.Write(&codec.Header{ServiceMethod: "Holder.Hold", Seq: 1}, make([]byte, 500)) == nil, "write failed")
+	<-h.started
+	var hdr codec.Header
+	_assert(cc.ReadHeader(&hdr) == nil && rpcerr.CodeOf(hdr.Status) == rpcerr.DeadlineExceeded, "expect timeout, got %+v", hdr)
+	_ = cc.ReadBody(nil)
+	_assert(s.MemoryInUse() > 500, "timed out handler still holds its args")
+	close(h.release)
+	_assert(waitMemory(s, 0), "accounting should return to zero, got %d", s.MemoryInUse())
+}
+
+// 结果发送完成前计入预算 之后的请求等待它释放
+func TestServer_MemoryBudgetReply(t *testing.T) {
+	s, _ := newHolder()
+	s.SetMemoryBudget(1<<20, 0)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType, HeaderType: codec.BinaryHeader})
+	defer stop()
+
+	// 管道在读出前阻塞 结果停在发送中
+	_assert(cc.Write(&codec.Header{ServiceMethod: "Holder.Big", Seq: 1}, 64<<10) == nil, "write failed")
+	deadline := time.Now().Add(time.Second)
+	for s.MemoryInUse() < 64<<10 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	_assert(s.MemoryInUse() >= 64<<10, "reply should be accounted while sending, got %d", s.MemoryInUse())
+	var hdr codec.Header
+	var reply []byte
+	_assert(cc.ReadHeader(&hdr) == nil && cc.ReadBody(&reply) == nil && len(reply) == 64<<10, "unexpected reply %+v", hdr)
+	_assert(waitMemory(s, 0), "accounting should return to zero, got %d", s.MemoryInUse())
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"gmrpc/service"
+	"reflect"
+)
+
+/*
+服务中间件 注册服务时包装每个方法 与按调用执行的拦截器不同 只在注册时执行一次
+适合初始化指标、包装方法等与具体请求无关的处理
+*/
+
+type MethodFunc = service.MethodFunc
+
+// 按注册顺序由外向内包装
+type ServiceMiddleware func(svcName, methodName string, handler MethodFunc) MethodFunc
+
+func (server *Server) RegisterWithMiddleware(rcvr interface{}, mw ...ServiceMiddleware) error {
+	return server.RegisterWithOptions(rcvr, ServiceOptions{Middleware: mw})
+}
+
+func applyMiddleware(s *service.Service, mw []ServiceMiddleware) {
+	for i := len(mw) - 1; i >= 0; i-- {
+		m := mw[i]
+		s.WrapMethods(func(methodName string, next MethodFunc) MethodFunc {
+			return m(s.Name, methodName, next)
+		})
+	}
+}
+
+// 由拦截器构造中间件 拦截器看到的上下文不含请求元数据 MethodInfo.Header 为空
+func InterceptorMiddleware(interceptors ...ServerInterceptor) ServiceMiddleware {
+	return func(svcName, methodName string, handler MethodFunc) MethodFunc {
+		info := &MethodInfo{ServiceMethod: svcName + "." + methodName}
+		h := func(ctx context.Context, argv, replyv interface{}) error {
+			return handler(reflect.ValueOf(argv), reflect.ValueOf(replyv))
+		}
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], h
+			h = func(ctx context.Context, argv, replyv interface{}) error {
+				return interceptor(ctx, info, argv, replyv, next)
+			}
+		}
+		return func(argv, replyv reflect.Value) error {
+			return h(context.Background(), argv.Interface(), replyv.Interface())
+		}
+	}
+}
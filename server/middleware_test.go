@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"gmrpc/codec"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type Arith int
+
+func (a Arith) Add(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (a Arith) Mul(args Args, reply *int) error {
+	*reply = args.Num1 * args.Num2
+	return nil
+}
+
+type callLog struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (l *callLog) add(s string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, s)
+}
+
+func (l *callLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.calls...)
+}
+
+func TestServer_RegisterWithMiddleware(t *testing.T) {
+	logs := new(callLog)
+	var wrapped []string
+	logging := func(svcName, methodName string, handler MethodFunc) MethodFunc {
+		wrapped = append(wrapped, svcName+"."+methodName)
+		return func(argv, replyv reflect.Value) error {
+			logs.add("log:" + svcName + "." + methodName)
+			return handler(argv, replyv)
+		}
+	}
+	interceptor := func(ctx context.Context, info *MethodInfo, argv, replyv interface{}, handler UnaryHandler) error {
+		logs.add("interceptor:" + info.ServiceMethod)
+		return handler(ctx, argv, replyv)
+	}
+
+	s := NewServer()
+	err := s.RegisterWithMiddleware(new(Arith), logging, InterceptorMiddleware(interceptor))
+	_assert(err == nil, "register error: %v", err)
+	_assert(len(wrapped) == 2, "expect every method to be wrapped once at registration, got %v", wrapped)
+
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	defer stop()
+	for i, tc := range []struct {
+		method string
+		want   int
+	}{{"Arith.Add", 5}, {"Arith.Mul", 6}, {"Arith.Add", 5}} {
+		written := writeAsync(cc, &codec.Header{ServiceMethod: tc.method, Seq: uint64(i)}, Args{Num1: 2, Num2: 3})
+		var h codec.Header
+		var reply int
+		_assert(cc.ReadHeader(&h) == nil && h.Error == "", "unexpected header %+v", h)
+		_assert(cc.ReadBody(&reply) == nil && reply == tc.want, "%s: expect %d, got %d", tc.method, tc.want, reply)
+		_assert(<-written == nil, "write failed")
+	}
+
+	want := []string{
+		"log:Arith.Add", "interceptor:Arith.Add",
+		"log:Arith.Mul", "interceptor:Arith.Mul",
+		"log:Arith.Add", "interceptor:Arith.Add",
+	}
+	_assert(reflect.DeepEqual(logs.get(), want), "unexpected call log %v", logs.get())
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"gmrpc/codec"
+	"gmrpc/mux"
+	"io"
+	"log"
+	"sync"
+)
+
+// 连接以 mux.MagicByte 开头时 每个逻辑流都是一个独立的连接 各自完成 Option 握手
+// 物理连接断开后等待所有流处理结束
+func (server *Server) serveMux(conn io.ReadWriteCloser, codecs *codec.CodecRegistry) {
+	m := mux.Server(conn)
+	defer func() { _ = m.Close() }()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		stream, err := m.AcceptStream()
+		if err != nil {
+			if err != mux.ErrClosed {
+				log.Println("rpc server [mux] err: ", err)
+			}
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server.serveConn(stream, false, codecs)
+		}()
+	}
+}
@@ -0,0 +1,26 @@
+package server
+
+import "gmrpc/codec"
+
+/*
+流水线请求 客户端 Pipeline.Flush 发送的请求带有元数据 x-rpc-pipeline
+同一连接上的流水线请求按读取的顺序依次处理 前一个响应之后才开始处理下一个 不经过并行解码
+其他请求照常并发处理 需要协商 metadata 功能 否则服务端看不到标记
+*/
+
+const PipelineMetadataKey = "x-rpc-pipeline"
+
+func isPipelined(h *codec.Header) bool {
+	_, ok := h.Metadata[PipelineMetadataKey]
+	return ok
+}
+
+// 把请求排在连接上一个流水线请求之后 prev 关闭后开始处理 响应后关闭 next
+func (c *connState) pipelineOrder() (prev <-chan struct{}, next chan struct{}) {
+	next = make(chan struct{})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev = c.pipelineTail
+	c.pipelineTail = next
+	return prev, next
+}
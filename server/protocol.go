@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"gmrpc/codec"
+	"io"
+	"strings"
+)
+
+/*
+协议版本与功能标志 新旧版本的客户端与服务端会同时存在 双方按共同支持的功能通信
+客户端在 Option 中发送 ProtocolVersion 与 Features 没有这两个字段的为版本 1 不启用任何可选功能 (V1Features)
+服务端取双方版本的较小值与功能的交集 写在握手后的第一行回复 (能力通告 压缩协商或单独一行) 中 {"version": 2, "features": 31}
+声明了版本 2 的客户端总会收到这一行 每个功能只在回复中明确列出时才启用
+旧版本的服务端忽略 Option 中的新字段 只在 Capabilities 或 Compression 开启时回复 回复中没有版本时客户端按版本 1 处理
+因此连接旧版本的服务端时 客户端需开启 Capabilities 或 Compression 或声明版本 1 否则等不到回复行
+之后新增的帧与头部字段都需要对应的功能标志 对方不支持时不发送
+*/
+
+// 当前的协议版本
+const ProtocolVersion = 2
+
+type Feature uint32
+
+const (
+	FeatureMetadata      Feature = 1 << iota // 头部携带元数据
+	FeatureStreaming                         // 流式参数与结果
+	FeatureCancel                            // _cancel 取消帧
+	FeatureCompression                       // 按消息压缩
+	FeatureClosingNotice                     // 关闭前的 _closing 通知
+	FeatureChunkedArgs                       // 大参数分块发送 见 codec.WriteChunked
+)
+
+// 版本 1 的基线 不启用任何可选功能
+const V1Features Feature = 0
+
+// 本版本支持的全部功能
+const SupportedFeatures = FeatureMetadata | FeatureStreaming | FeatureCancel | FeatureCompression | FeatureClosingNotice | FeatureChunkedArgs
+
+var featureNames = []string{"metadata", "streaming", "cancel", "compression", "closing-notice", "chunked-args"}
+
+func (f Feature) Has(flag Feature) bool {
+	return f&flag == flag
+}
+
+func (f Feature) String() string {
+	var names []string
+	for i, name := range featureNames {
+		if f.Has(1 << i) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// 握手回复中的协商结果 只在客户端声明了版本 2 及以上时出现
+type ProtocolAck struct {
+	Version  int     `json:"version"`
+	Features Feature `json:"features"`
+}
+
+// 一方声明的版本与功能 未声明版本的为版本 1 功能只按明确声明的计算
+func declared(version int, features Feature) (int, Feature) {
+	if version < 2 {
+		return 1, V1Features
+	}
+	return version, features
+}
+
+// 与对方声明的版本与功能协商 更高的未知版本降到本版本 未知的功能标志被忽略
+func NegotiateProtocol(version int, features Feature) ProtocolAck {
+	version, features = declared(version, features)
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+	return ProtocolAck{Version: version, Features: features & SupportedFeatures}
+}
+
+// 握手后的回复 依次为能力通告与压缩协商 客户端声明了版本 2 及以上时协商结果写在第一行中
+// 两者都没有开启时协商结果单独一行 版本 1 的客户端没有协商结果 返回协商的功能
+func (server *Server) handshake(w io.Writer, cc codec.Codec, opt *Option) (Feature, error) {
+	ack := NegotiateProtocol(opt.ProtocolVersion, opt.Features)
+	var first *ProtocolAck
+	if opt.ProtocolVersion >= 2 {
+		first = &ack
+	}
+	if opt.Capabilities {
+		if err := server.writeCapabilities(w, first); err != nil {
+			return 0, err
+		}
+		first = nil
+	}
+	if opt.Compression != "" {
+		if err := server.negotiateCompression(w, cc, opt, ack.Features, first); err != nil {
+			return 0, err
+		}
+		first = nil
+	}
+	if first != nil {
+		if err := json.NewEncoder(w).Encode(first); err != nil {
+			return 0, err
+		}
+	}
+	return ack.Features, nil
+}
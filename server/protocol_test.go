@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"gmrpc/codec"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 引入版本号之前的 Option 字段 冻结不再修改 模拟旧版本的客户端
+type v1Option struct {
+	CodecType      codec.Type       `json:"CodecType"`
+	HeaderType     codec.HeaderType `json:"HeaderType,omitempty"`
+	MagicNumber    int              `json:"MagicNumber"`
+	ConnectTimeout time.Duration    `json:"ConnectTimeout"`
+	HandleTimeout  time.Duration    `json:"HandleTimeout"`
+	StrictDecoding bool             `json:"StrictDecoding"`
+	Capabilities   bool             `json:"Capabilities,omitempty"`
+	Compression    string           `json:"Compression,omitempty"`
+}
+
+func TestNegotiateProtocol(t *testing.T) {
+	for _, c := range []struct {
+		version  int
+		features Feature
+		want     ProtocolAck
+	}{
+		{0, 0, ProtocolAck{1, V1Features}},
+		{1, FeatureMetadata, ProtocolAck{1, V1Features}},
+		// 功能只按明确声明的计算
+		{2, 0, ProtocolAck{2, 0}},
+		{2, FeatureMetadata | FeatureCancel, ProtocolAck{2, FeatureMetadata | FeatureCancel}},
+		// 更高的未知版本降到本版本 未知的功能被忽略
+		{9, SupportedFeatures | 1<<20, ProtocolAck{ProtocolVersion, SupportedFeatures}},
+	} {
+		got := NegotiateProtocol(c.version, c.features)
+		_assert(got == c.want, "NegotiateProtocol(%d, %s) = %+v, want %+v", c.version, c.features, got, c.want)
+	}
+	_assert((FeatureMetadata|FeatureCancel).String() == "metadata|cancel", "unexpected name %s", FeatureMetadata|FeatureCancel)
+}
+
+type Legacy struct{}
+
+func (Legacy) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// 以原始连接完成握手 返回第一行回复与编解码器
+func handshakeRaw(s *Server, opt interface{}) (string, codec.Codec, func()) {
+	serverConn, clientConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.ServeConn(serverConn)
+		close(done)
+	}()
+	_ = json.NewEncoder(clientConn).Encode(opt)
+	br := bufio.NewReader(clientConn)
+	line, _ := br.ReadString('\n')
+	cc := codec.NewGobCodec(&bufConn{r: br, ReadWriteCloser: clientConn})
+	return line, cc, func() {
+		_ = cc.Close()
+		<-done
+	}
+}
+
+func TestServer_ProtocolCompatibility(t *testing.T) {
+	s := NewServer()
+	_ = s.RegisterWithOptions(Legacy{}, ServiceOptions{Deprecated: map[string]Deprecation{"Sum": {Message: "use Math.Add"}}})
+	call := func(cc codec.Codec) codec.Header {
+		_assert(cc.Write(&codec.Header{ServiceMethod: "Legacy.Sum", Seq: 1, Metadata: map[string]string{"k": "v"}}, Args{Num1: 1, Num2: 2}) == nil, "write failed")
+		var h codec.Header
+		var reply int
+		_assert(cc.ReadHeader(&h) == nil && cc.ReadBody(&reply) == nil, "read failed")
+		_assert(h.Error == "" && reply == 3, "unexpected response %+v %d", h, reply)
+		return h
+	}
+
+	// 旧版本客户端 回复与之前一致 不包含协商结果 不启用任何可选功能
+	line, cc, stop := handshakeRaw(s, v1Option{MagicNumber: MagicNumber, CodecType: codec.GobType, Capabilities: true})
+	_assert(strings.Contains(line, `"services"`) && !strings.Contains(line, "version"), "v1 client should get a v1 reply, got %s", line)
+	h := call(cc)
+	_assert(h.Metadata == nil, "v1 client should not get metadata, got %+v", h.Metadata)
+	stop()
+
+	// 新版本客户端没有开启能力通告与压缩时 协商结果单独一行
+	line, cc, stop = handshakeRaw(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType,
+		ProtocolVersion: ProtocolVersion, Features: FeatureMetadata})
+	var ack ProtocolAck
+	_ = json.Unmarshal([]byte(line), &ack)
+	_assert(ack == ProtocolAck{Version: ProtocolVersion, Features: FeatureMetadata} && !strings.Contains(line, "services"), "unexpected ack %s", line)
+	h = call(cc)
+	_assert(h.Metadata[DeprecatedKey] == "use Math.Add", "acked metadata should be sent, got %+v", h.Metadata)
+	stop()
+
+	// 新版本客户端不支持元数据时响应中不带元数据
+	line, cc, stop = handshakeRaw(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType, Capabilities: true,
+		ProtocolVersion: 5, Features: FeatureCancel | 1<<20})
+	ack = ProtocolAck{}
+	_ = json.Unmarshal([]byte(line), &ack)
+	_assert(ack == ProtocolAck{Version: ProtocolVersion, Features: FeatureCancel}, "unexpected ack %+v from %s", ack, line)
+	h = call(cc)
+	_assert(h.Metadata == nil, "metadata should not be sent, got %+v", h.Metadata)
+	stop()
+}
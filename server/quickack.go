@@ -0,0 +1,22 @@
+package server
+
+import (
+	"gmrpc/netutil"
+	"io"
+)
+
+// 对之后建立的 TCP 连接设置 TCP_QUICKACK 见 netutil.SetQuickACK 不支持的平台与非 TCP 连接忽略
+func (server *Server) SetQuickACK(enabled bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.quickACK = enabled
+}
+
+func (server *Server) applyQuickACK(conn io.ReadWriteCloser) {
+	server.mu.RLock()
+	on := server.quickACK
+	server.mu.RUnlock()
+	if on {
+		_ = netutil.SetQuickACK(conn, true)
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import "sort"
+
+/*
+内置的反射服务 客户端可借此获取服务端注册的服务与方法
+*/
+
+const ReflectionService = "_reflection"
+
+type ListServicesArgs struct{}
+
+type ListServicesReply struct {
+	Services []string
+}
+
+type ListMethodsArgs struct {
+	Service string
+}
+
+type MethodDescriptor struct {
+	Name       string
+	ArgType    string
+	ReplyType  string
+	Deprecated bool
+	Message    string   // 弃用说明
+	ForwardTo  string   // 弃用后转发到的方法
+	ArgHash    string   // 参数类型的结构摘要 旧版本的服务端为空
+	ReplyHash  string   // 结果类型的结构摘要
+	ArgShape   []string // 参数类型的结构描述 用于说明不一致的字段
+	ReplyShape []string
+}
+
+type ListMethodsReply struct {
+	Methods []MethodDescriptor
+}
+
+type reflection struct {
+	server *Server
+}
+
+// 列出用户注册的服务 不包含内置服务
+func (r *reflection) ListServices(args ListServicesArgs, reply *ListServicesReply) error {
+	reply.Services = r.server.serviceNames()
+	return nil
+}
+
+func (r *reflection) ListMethods(args ListMethodsArgs, reply *ListMethodsReply) error {
+	svc, ok := r.server.lookupService(args.Service)
+	if !ok {
+		return errServiceNotFound(args.Service)
+	}
+	for name, mtype := range svc.Method {
+		desc := MethodDescriptor{
+			Name:       name,
+			ArgType:    mtype.ArgType.String(),
+			ReplyType:  mtype.ReplyType.String(),
+			ArgHash:    mtype.ArgHash,
+			ReplyHash:  mtype.ReplyHash,
+			ArgShape:   mtype.ArgShape,
+			ReplyShape: mtype.ReplyShape,
+		}
+		if d := svc.Deprecation(name); d != nil {
+			desc.Deprecated, desc.Message, desc.ForwardTo = true, d.Message, d.ForwardTo
+		}
+		reply.Methods = append(reply.Methods, desc)
+	}
+	sort.Slice(reply.Methods, func(i, j int) bool { return reply.Methods[i].Name < reply.Methods[j].Name })
+	return nil
+}
+
+func (server *Server) serviceNames() []string {
+	var names []string
+	server.serviceMap.Range(func(key, value interface{}) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"strings"
+	"testing"
+)
+
+type ChanReply struct {
+	Name    string
+	Updates chan int
+}
+
+type Hidden struct{ n int }
+
+type HiddenReply struct {
+	Inner []Hidden
+}
+
+type Bad struct{}
+
+func (Bad) Get(args int, reply *ChanReply) error { return nil }
+
+type Opaque struct{}
+
+func (Opaque) Get(args int, reply *HiddenReply) error { return nil }
+
+type OptionalChan struct{}
+
+type SkippedReply struct {
+	Name    string
+	Updates chan int `json:"-"`
+}
+
+func (OptionalChan) Get(args int, reply *SkippedReply) error { return nil }
+
+func TestServer_RejectUnserializableReply(t *testing.T) {
+	s := NewServer()
+	err := s.Register(Bad{})
+	_assert(err != nil && strings.Contains(err.Error(), "Bad.Get") && strings.Contains(err.Error(), "ChanReply.Updates has unsupported type chan int"), "expect chan field rejected, got %v", err)
+	_, _, err = s.findService("Bad.Get")
+	_assert(err != nil, "rejected service should not be registered")
+
+	err = s.Register(Opaque{})
+	_assert(err != nil && strings.Contains(err.Error(), "HiddenReply.Inner (server.Hidden) has no exported fields"), "expect unexported struct rejected, got %v", err)
+
+	_assert(s.Register(OptionalChan{}) == nil, "fields skipped by json tag should be allowed")
+}
+
+type AnyReply struct {
+	Value interface{}
+}
+
+type Dynamic struct{}
+
+func (Dynamic) Get(ok bool, reply *AnyReply) error {
+	if ok {
+		reply.Value = "fine"
+	} else {
+		reply.Value = make(chan int)
+	}
+	return nil
+}
+
+func TestServer_ReplyNotSerializable(t *testing.T) {
+	s := NewServer()
+	_assert(s.Register(Dynamic{}) == nil, "interface fields are checked at runtime")
+	for _, opt := range []*Option{
+		{MagicNumber: MagicNumber, CodecType: codec.GobType},
+		{MagicNumber: MagicNumber, CodecType: codec.JsonType},
+		{MagicNumber: MagicNumber, CodecType: codec.GobType, HeaderType: codec.BinaryHeader},
+	} {
+		cc, stop := servePipe(s, opt)
+		call := func(seq uint64, ok bool) (codec.Header, AnyReply) {
+			_assert(cc.Write(&codec.Header{ServiceMethod: "Dynamic.Get", Seq: seq}, ok) == nil, "write failed")
+			var h codec.Header
+			var reply AnyReply
+			_assert(cc.ReadHeader(&h) == nil && h.Seq == seq, "unexpected header %+v", h)
+			_assert(cc.ReadBody(&reply) == nil, "read body failed")
+			return h, reply
+		}
+
+		h, _ := call(1, false)
+		_assert(h.Status != nil && h.Status.Code == rpcerr.Internal && strings.Contains(h.Error, "reply not serializable"), "%s/%s: expect encode error, got %+v", opt.CodecType, opt.HeaderType, h)
+		// 连接仍然可用
+		h, reply := call(2, true)
+		_assert(h.Error == "" && reply.Value == "fine", "%s/%s: connection should stay usable: %+v %+v", opt.CodecType, opt.HeaderType, h, reply)
+		stop()
+	}
+}
+
+type FloatKeys struct{}
+
+func (FloatKeys) Get(args int, reply *map[float64]string) error {
+	(*reply)[0.5] = "half"
+	return nil
+}
+
+func TestServer_RejectJSONIncompatibleReply(t *testing.T) {
+	s := NewServer()
+	err := s.Register(FloatKeys{})
+	_assert(err != nil && strings.Contains(err.Error(), "FloatKeys.Get can't be encoded as json") && strings.Contains(err.Error(), "map key type float64"), "expect float keys rejected, got %v", err)
+
+	// 只启用 gob 时可以注册
+	gobOnly := codec.NewCodecRegistry()
+	gobOnly.Register(codec.GobType, codec.NewGobCodec)
+	s.SetCodecRegistry(gobOnly)
+	_assert(s.Register(FloatKeys{}) == nil, "gob can encode float keys")
+}
+
+type Rows struct{ caps []int }
+
+func (r *Rows) List(n int, reply *[]int) error {
+	r.caps = append(r.caps, cap(*reply))
+	for i := 0; i < n; i++ {
+		*reply = append(*reply, i)
+	}
+	return nil
+}
+
+func TestServer_ReplyCapacity(t *testing.T) {
+	s := NewServer()
+	err := s.RegisterWithOptions(&Rows{}, ServiceOptions{ReplyCapacity: map[string]int{"Missing": 10}})
+	_assert(err != nil, "expect error for unknown method")
+
+	var rows Rows
+	_assert(s.RegisterWithOptions(&rows, ServiceOptions{ReplyCapacity: map[string]int{"List": 500}}) == nil, "register failed")
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.JsonType})
+	defer stop()
+	_assert(cc.Write(&codec.Header{ServiceMethod: "Rows.List", Seq: 1}, 500) == nil, "write failed")
+	var h codec.Header
+	var reply []int
+	_assert(cc.ReadHeader(&h) == nil && h.Error == "", "unexpected header %+v", h)
+	_assert(cc.ReadBody(&reply) == nil && len(reply) == 500, "expect 500 rows, got %d", len(reply))
+	_assert(len(rows.caps) == 1 && rows.caps[0] == 500, "expect handler to see capacity 500, got %v", rows.caps)
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"gmrpc/service"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+/*
+保留的服务名 以 _ 开头的名称属于框架 用户不能注册
+内置服务(如 _reflection)在 NewServer 时放入单独的表 查找时不会与用户服务混淆
+控制方法(如 _cancel)作用于所在的连接 在读取请求时直接处理 不经过服务分发
+*/
+
+const ReservedPrefix = "_"
+
+// 取消同一连接上正在处理的请求 参数为请求的 Seq
+const (
+	CancelService = "_cancel"
+	CancelMethod  = CancelService + ".Cancel"
+)
+
+func IsReserved(name string) bool {
+	return strings.HasPrefix(name, ReservedPrefix)
+}
+
+// 用户服务名 不能为空 不能包含 . 与控制字符 不能使用保留前缀
+func validateServiceName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("rpc: service name is empty")
+	case IsReserved(name):
+		return fmt.Errorf("rpc: service name %q uses reserved prefix %q", name, ReservedPrefix)
+	case strings.Contains(name, "."):
+		return fmt.Errorf("rpc: service name %q contains '.'", name)
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		return fmt.Errorf("rpc: service name %q contains control characters", name)
+	}
+	return nil
+}
+
+// 以指定名称注册服务
+func (server *Server) RegisterName(name string, rcvr interface{}) error {
+	if err := validateServiceName(name); err != nil {
+		return err
+	}
+	return server.register(service.NewNamedService(rcvr, name), ServiceOptions{})
+}
+
+func (server *Server) registerBuiltin(name string, rcvr interface{}) {
+	if server.builtins == nil {
+		server.builtins = make(map[string]*service.Service)
+	}
+	server.builtins[name] = service.NewNamedService(rcvr, name)
+}
+
+// 保留名称只在内置服务表中查找
+func (server *Server) lookupService(name string) (*service.Service, bool) {
+	if IsReserved(name) {
+		svc, ok := server.builtins[name]
+		return svc, ok
+	}
+	svci, ok := server.serviceMap.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return svci.(*service.Service), true
+}
+
+// 连接级别的状态 记录正在处理的请求 控制方法只能作用于本连接的请求
+type connState struct {
+	mu         sync.Mutex
+	inflight   map[uint64]context.CancelFunc
+	lastActive time.Time           // 最近一次收到请求或处理结束的时间
+	features   Feature             // 握手时协商的功能 创建后只读
+	peer       net.Addr            // 对端地址 未知时为空 创建后只读
+	deferred   map[uint64]struct{} // 等待延迟响应的请求
+	closed     bool                // 已停止读取请求
+	rawBody    codec.RawBodyReader // 启用并行解码时不为空 参数交给解码协程 创建后只读
+
+	pipelineTail chan struct{} // 最后一个流水线请求响应后关闭 见 pipeline.go
+}
+
+func newConnState() *connState {
+	return &connState{inflight: make(map[uint64]context.CancelFunc), lastActive: time.Now()}
+}
+
+// 登记请求 返回处理函数使用的上下文与处理结束时的清理函数
+func (c *connState) track(seq uint64) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.mu.Lock()
+	c.inflight[seq] = cancel
+	c.mu.Unlock()
+	return ctx, func() {
+		c.mu.Lock()
+		delete(c.inflight, seq)
+		delete(c.deferred, seq)
+		c.lastActive = time.Now()
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+func (c *connState) markDeferred(seq uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cancel, ok := c.inflight[seq]
+	if !ok {
+		// 已经完成
+		return
+	}
+	if c.closed {
+		cancel()
+		return
+	}
+	if c.deferred == nil {
+		c.deferred = make(map[uint64]struct{})
+	}
+	c.deferred[seq] = struct{}{}
+}
+
+// 连接关闭时取消所有等待延迟响应的请求 之后的 Send 返回 ErrResponseAbandoned
+func (c *connState) abortDeferred() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for seq := range c.deferred {
+		c.inflight[seq]()
+	}
+}
+
+func (c *connState) touch() {
+	c.mu.Lock()
+	c.lastActive = time.Now()
+	c.mu.Unlock()
+}
+
+// 距最近一次活动的时间 busy 表示仍有请求在处理
+func (c *connState) idle(now time.Time) (idle time.Duration, busy bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return now.Sub(c.lastActive), len(c.inflight) > 0
+}
+
+func (c *connState) cancel(seq uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cancel, ok := c.inflight[seq]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// 控制方法 在读取请求的 goroutine 中执行 需要读取消息体
+type controlHandler func(conn *connState, cc codec.Codec, h *codec.Header) error
+
+var controlHandlers = map[string]controlHandler{
+	CancelMethod: handleCancel,
+}
+
+func handleCancel(conn *connState, cc codec.Codec, h *codec.Header) error {
+	var seq uint64
+	if err := cc.ReadBody(&seq); err != nil {
+		return rpcerr.New(rpcerr.InvalidArgs, "rpc server: invalid cancel frame: "+err.Error())
+	}
+	if seq == h.Seq || !conn.cancel(seq) {
+		return rpcerr.Errorf(rpcerr.InvalidArgs, "rpc server: cancel: seq %d is not in flight on this connection", seq)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServer_ReservedNames(t *testing.T) {
+	s := NewServer()
+	for _, name := range []string{"", "_reflection", "_mine", "A.B", "Bad\nName"} {
+		_assert(s.RegisterName(name, new(Foo)) != nil, "name %q should be rejected", name)
+	}
+	_assert(s.RegisterName("Calc", new(Foo)) == nil, "valid name rejected")
+	_assert(s.RegisterName("Calc", new(Foo)) != nil, "duplicate name accepted")
+	_assert(len(s.serviceNames()) == 1, "unexpected services %v", s.serviceNames())
+
+	// 保留名称只在内置服务中查找
+	_, _, err := s.findService(ReflectionService + ".ListServices")
+	_assert(err == nil, "builtin not found: %v", err)
+	for _, m := range []string{"_cancel.Other", "_reflection.Missing", "_Calc.Sum"} {
+		_, _, err := s.findService(m)
+		e, ok := rpcerr.FromError(err)
+		_assert(ok && e.Code == rpcerr.NotFound, "%s: expect not found, got %v", m, err)
+	}
+}
+
+type Waiter int
+
+func (w Waiter) Wait(n int, reply *int) error {
+	*reply = n
+	return nil
+}
+
+// 拦截器等待上下文结束 模拟响应取消的处理函数
+func waitForCancel(ctx context.Context, info *MethodInfo, argv, replyv interface{}, handler UnaryHandler) error {
+	select {
+	case <-ctx.Done():
+		return rpcerr.New(rpcerr.DeadlineExceeded, "canceled")
+	case <-time.After(2 * time.Second):
+		return handler(ctx, argv, replyv)
+	}
+}
+
+func readResponse(cc codec.Codec) codec.Header {
+	var h codec.Header
+	_ = cc.ReadHeader(&h)
+	_ = cc.ReadBody(nil)
+	return h
+}
+
+func TestServer_CancelControlFrame(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(new(Waiter))
+	s.Use(waitForCancel)
+	opt := &Option{MagicNumber: MagicNumber, CodecType: codec.GobType}
+	cc, stop := servePipe(s, opt)
+	defer stop()
+	other, stopOther := servePipe(s, opt)
+	defer stopOther()
+
+	var mu sync.Mutex
+	write := func(cc codec.Codec, method string, seq uint64, body interface{}) {
+		go func() {
+			mu.Lock()
+			defer mu.Unlock()
+			_ = cc.Write(&codec.Header{ServiceMethod: method, Seq: seq}, body)
+		}()
+	}
+
+	// 引用不存在的请求
+	write(cc, CancelMethod, 100, uint64(42))
+	h := readResponse(cc)
+	_assert(h.Seq == 100 && h.Status != nil && h.Status.Code == rpcerr.InvalidArgs, "spoofed cancel accepted: %+v", h)
+
+	// 其他连接不能取消本连接的请求
+	write(cc, "Waiter.Wait", 1, 1)
+	time.Sleep(20 * time.Millisecond)
+	write(other, CancelMethod, 2, uint64(1))
+	h = readResponse(other)
+	_assert(h.Seq == 2 && h.Status != nil && h.Status.Code == rpcerr.InvalidArgs, "cross-connection cancel accepted: %+v", h)
+
+	// 本连接的取消生效
+	write(cc, CancelMethod, 3, uint64(1))
+	first, second := readResponse(cc), readResponse(cc)
+	if first.Seq != 3 {
+		first, second = second, first
+	}
+	_assert(first.Seq == 3 && first.Error == "", "cancel rejected: %+v", first)
+	_assert(second.Seq == 1 && second.Status != nil && second.Status.Code == rpcerr.DeadlineExceeded, "request not canceled: %+v", second)
+
+	// 请求结束后不能再取消
+	write(cc, CancelMethod, 4, uint64(1))
+	h = readResponse(cc)
+	_assert(h.Seq == 4 && h.Status != nil && h.Status.Code == rpcerr.InvalidArgs, "cancel of finished request accepted: %+v", h)
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"gmrpc/codec"
+	"strconv"
+)
+
+/*
+重试提示 错误带有 RetryAfterMs 时 (限流 并发上限 内存预算) 响应元数据中同时写入 retry-after-ms
+不解码 Status 的客户端或其他语言的实现只需读取元数据 客户端的重试策略与 XClient 按提示等待或换服务端
+关闭开始后 (ShutdownWithNotice) 连接上完成的请求即使成功也带有关闭通知的 RetryAfterMs 调用方可以提前改用其他服务端
+*/
+
+const RetryAfterKey = "retry-after-ms"
+
+// 解析 retry-after-ms 的值 无法识别时 ok 为 false
+func ParseRetryAfter(v string) (ms uint32, ok bool) {
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	return uint32(n), true
+}
+
+// 在响应头中写入重试提示 ms 为 0 时不写入
+func setRetryAfter(h *codec.Header, ms uint32) {
+	if ms == 0 {
+		return
+	}
+	md := make(map[string]string, len(h.Metadata)+1)
+	for k, v := range h.Metadata {
+		md[k] = v
+	}
+	md[RetryAfterKey] = strconv.FormatUint(uint64(ms), 10)
+	h.Metadata = md
+}
+
+// 关闭中的响应带上关闭通知的提示 已有更具体的提示时不覆盖
+func (server *Server) setDrainHint(h *codec.Header) {
+	notice := server.draining.Load()
+	if notice == nil {
+		return
+	}
+	if _, ok := h.Metadata[RetryAfterKey]; ok {
+		return
+	}
+	setRetryAfter(h, notice.RetryAfterMs)
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/metadata"
+	"gmrpc/routing"
+)
+
+/*
+查找服务之前按路由规则改写服务名 响应头中的方法名仍为客户端请求的名称
+*/
+
+// 设置路由规则 传入 nil 取消 对已有连接立即生效
+func (server *Server) SetRouter(r *routing.PredicateRouter) {
+	server.router.Store(r)
+}
+
+func (server *Server) route(conn *connState, h *codec.Header) string {
+	r := server.router.Load()
+	if r == nil {
+		return h.ServiceMethod
+	}
+	ctx := routing.NewPeerContext(context.Background(), conn.peer)
+	if h.Metadata != nil {
+		ctx = metadata.NewIncomingContext(ctx, metadata.New(h.Metadata))
+	}
+	return r.Route(ctx, h.ServiceMethod)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"gmrpc/codec"
+	"gmrpc/metadata"
+	"gmrpc/routing"
+	"net"
+	"testing"
+)
+
+type Data struct{}
+
+func (Data) Get(args int, reply *string) error {
+	*reply = "real"
+	return nil
+}
+
+type ShadowData struct{}
+
+func (ShadowData) Get(args int, reply *string) error {
+	*reply = "test data"
+	return nil
+}
+
+func TestServer_Router(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(Data{})
+	_ = s.Register(ShadowData{})
+	_, local, _ := net.ParseCIDR("127.0.0.0/8")
+	s.SetRouter(routing.NewPredicateRouter(
+		routing.Rule{Predicate: routing.PeerIn(local), TargetService: "ShadowData"},
+		routing.Rule{Predicate: func(ctx context.Context, serviceMethod string) bool {
+			md, _ := metadata.FromIncomingContext(ctx)
+			return md.Get("x-shadow") == "1"
+		}, TargetService: "ShadowData"},
+	))
+
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(l)
+	defer func() { _ = l.Close() }()
+
+	get := func(cc codec.Codec, md map[string]string) string {
+		_assert(cc.Write(&codec.Header{ServiceMethod: "Data.Get", Seq: 1, Metadata: md}, 0) == nil, "write failed")
+		var h codec.Header
+		var reply string
+		_assert(cc.ReadHeader(&h) == nil && cc.ReadBody(&reply) == nil, "read failed")
+		_assert(h.Error == "" && h.ServiceMethod == "Data.Get", "unexpected header %+v", h)
+		return reply
+	}
+
+	opt := &Option{MagicNumber: MagicNumber, CodecType: codec.GobType}
+	conn, err := net.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	_ = json.NewEncoder(conn).Encode(opt)
+	cc := codec.NewGobCodec(conn)
+	reply := get(cc, nil)
+	_assert(reply == "test data", "requests from 127.0.0.0/8 should be routed to the shadow service, got %q", reply)
+	_ = cc.Close()
+
+	// 管道没有对端地址 不匹配网段规则
+	cc, stop := servePipe(s, opt)
+	defer stop()
+	reply = get(cc, nil)
+	_assert(reply == "real", "unmatched requests should reach the original service, got %q", reply)
+	reply = get(cc, map[string]string{"x-shadow": "1"})
+	_assert(reply == "test data", "predicates should see request metadata, got %q", reply)
+
+	s.SetRouter(nil)
+	reply = get(cc, map[string]string{"x-shadow": "1"})
+	_assert(reply == "real", "router should be removable, got %q", reply)
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+以 JSON Schema 描述已注册服务的参数与返回值 用于生成接口文档
+字段名与 encoding/json 一致 使用 gob 编码时按同名字段对应
+递归的结构体放在所在 schema 的 $defs 中 通过 $ref 引用
+*/
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+type MethodSchema struct {
+	Name        string  `json:"name"`
+	ArgSchema   *Schema `json:"argSchema"`
+	ReplySchema *Schema `json:"replySchema"`
+	Deprecated  bool    `json:"deprecated,omitempty"`
+}
+
+type ServiceSchema struct {
+	Name    string         `json:"name"`
+	Methods []MethodSchema `json:"methods"` // 按方法名排序
+}
+
+type SchemaDocument struct {
+	Services []ServiceSchema `json:"services"` // 按服务名排序 不包含内置服务
+}
+
+// 所有已注册服务的 schema
+func (server *Server) Schema() SchemaDocument {
+	doc := SchemaDocument{Services: []ServiceSchema{}}
+	for _, name := range server.serviceNames() {
+		svc, ok := server.lookupService(name)
+		if !ok {
+			continue
+		}
+		ss := ServiceSchema{Name: name, Methods: []MethodSchema{}}
+		for method, mtype := range svc.Method {
+			ss.Methods = append(ss.Methods, MethodSchema{
+				Name:        method,
+				ArgSchema:   TypeSchema(mtype.ArgType),
+				ReplySchema: TypeSchema(mtype.ReplyType),
+				Deprecated:  svc.Deprecation(method) != nil,
+			})
+		}
+		sort.Slice(ss.Methods, func(i, j int) bool { return ss.Methods[i].Name < ss.Methods[j].Name })
+		doc.Services = append(doc.Services, ss)
+	}
+	return doc
+}
+
+// Schema 的 json 编码
+func (server *Server) ExportSchema() ([]byte, error) {
+	return json.MarshalIndent(server.Schema(), "", "  ")
+}
+
+// 单个类型的 schema 指针按指向的类型处理
+func TypeSchema(t reflect.Type) *Schema {
+	g := &schemaGen{visiting: make(map[reflect.Type]bool), recursive: make(map[reflect.Type]bool)}
+	s := g.gen(t)
+	if len(g.defs) > 0 {
+		s.Defs = g.defs
+	}
+	return s
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+type schemaGen struct {
+	visiting  map[reflect.Type]bool // 正在生成的结构体
+	recursive map[reflect.Type]bool // 被自身引用的结构体
+	defs      map[string]*Schema
+}
+
+func (g *schemaGen) gen(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "integer", Description: "nanoseconds"}
+	case streamingArgType:
+		return &Schema{Type: "string", ContentEncoding: "base64", Description: "chunked stream"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &Schema{Type: "array", Items: g.gen(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.gen(t.Elem())}
+	case reflect.Struct:
+		return g.genStruct(t)
+	}
+	// interface{} 等无法确定的类型不做约束
+	return &Schema{}
+}
+
+func (g *schemaGen) genStruct(t reflect.Type) *Schema {
+	if g.visiting[t] {
+		g.recursive[t] = true
+		return g.ref(t)
+	}
+	g.visiting[t] = true
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.fields(t, s.Properties)
+	delete(g.visiting, t)
+	if g.recursive[t] {
+		if g.defs == nil {
+			g.defs = make(map[string]*Schema)
+		}
+		g.defs[defName(t)] = s
+		return g.ref(t)
+	}
+	return s
+}
+
+// 按 encoding/json 的规则收集字段 匿名结构体字段展开
+func (g *schemaGen) fields(t reflect.Type, props map[string]*Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.fields(ft, props)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.gen(f.Type)
+	}
+}
+
+func (g *schemaGen) ref(t reflect.Type) *Schema {
+	return &Schema{Ref: "#/$defs/" + defName(t)}
+}
+
+func defName(t reflect.Type) string {
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return strings.NewReplacer(" ", "", "*", "").Replace(t.String())
+}
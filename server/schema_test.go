@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type Math int
+
+func (m Math) Add(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+type Node struct {
+	Value    string  `json:"value"`
+	Children []*Node `json:"children,omitempty"`
+	secret   int
+}
+
+type Tree int
+
+func (t Tree) Walk(root Node, reply *[]string) error {
+	return nil
+}
+
+func TestServer_ExportSchema(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(new(Math))
+	_ = s.Register(new(Tree))
+
+	data, err := s.ExportSchema()
+	_assert(err == nil, "export error: %v", err)
+	var doc SchemaDocument
+	_assert(json.Unmarshal(data, &doc) == nil, "schema should be valid json")
+	_assert(len(doc.Services) == 2 && doc.Services[0].Name == "Math", "builtin services should be excluded: %+v", doc.Services)
+
+	add := doc.Services[0].Methods[0]
+	_assert(add.Name == "Add", "unexpected method %q", add.Name)
+	props := add.ArgSchema.Properties
+	_assert(add.ArgSchema.Type == "object" && len(props) == 2, "unexpected arg schema %+v", add.ArgSchema)
+	_assert(props["Num1"].Type == "integer" && props["Num2"].Type == "integer", "expect integer fields, got %+v", props)
+	_assert(add.ReplySchema.Type == "integer", "unexpected reply schema %+v", add.ReplySchema)
+
+	// 递归类型通过 $defs 引用 json 标签与未导出字段按 encoding/json 处理
+	walk := doc.Services[1].Methods[0]
+	_assert(walk.ArgSchema.Ref == "#/$defs/Node", "expect ref to Node, got %+v", walk.ArgSchema)
+	node := walk.ArgSchema.Defs["Node"]
+	_assert(node != nil && len(node.Properties) == 2, "unexpected Node schema %+v", node)
+	_assert(node.Properties["children"].Items.Ref == "#/$defs/Node", "children should refer to Node")
+	_assert(walk.ReplySchema.Type == "array" && walk.ReplySchema.Items.Type == "string", "unexpected reply schema %+v", walk.ReplySchema)
+}
+
+func TestServer_DebugSchema(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(new(Math))
+	rec := httptest.NewRecorder()
+	s.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DebugPath+"/schema", nil))
+	_assert(rec.Code == http.StatusOK, "expect 200, got %d", rec.Code)
+	var doc SchemaDocument
+	_assert(json.Unmarshal(rec.Body.Bytes(), &doc) == nil && len(doc.Services) == 1, "unexpected body %s", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	s.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, DebugPath+"/schema", nil))
+	_assert(rec.Code == http.StatusMethodNotAllowed, "expect 405, got %d", rec.Code)
+}
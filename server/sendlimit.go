@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"log"
+	"strconv"
+	"sync/atomic"
+)
+
+/*
+响应大小限制 结果编码后超过 Config.MaxSendSize 时不发送 改为返回 ResourceExhausted 错误
+编码结果在写入发送缓冲区前检查 不会发送截断的消息体 需要编解码器实现 codec.SizeLimiter
+内置的 gob json 与二进制头部格式都支持 jsonrpc2 与 SplitCodec 不检查 流式结果不检查
+处理函数与拦截器可通过 MaxSendSize(ctx) 取得上限 自行截断结果 (如分页)
+*/
+
+type maxSendSizeKey struct{}
+
+// 设置响应大小上限 n <= 0 表示不限制 立即生效
+func (server *Server) SetMaxSendSize(n int64) {
+	server.UpdateConfig(func(c *Config) {
+		c.MaxSendSize = n
+	})
+}
+
+// 设置请求消息体的大小上限 n <= 0 时使用 codec.DefaultMaxReceiveSize 对之后建立的连接生效
+// 超出上限的请求无法跳过 连接被关闭 需要编解码器实现 codec.ReceiveLimiter
+func (server *Server) SetMaxReceiveSize(n int64) {
+	server.UpdateConfig(func(c *Config) {
+		c.MaxReceiveSize = n
+	})
+}
+
+// 连接的请求消息体上限 分块参数与解压同样受它限制
+func (server *Server) maxReceiveSize() int64 {
+	if n := server.loadConfig().MaxReceiveSize; n > 0 {
+		return n
+	}
+	return codec.DefaultMaxReceiveSize
+}
+
+// 请求开始处理时的响应大小上限 0 表示不限制
+func MaxSendSize(ctx context.Context) int64 {
+	n, _ := ctx.Value(maxSendSizeKey{}).(int64)
+	return n
+}
+
+func (server *Server) replyTooLarge(h *codec.Header, e *codec.SizeError) {
+	atomic.AddUint64(&server.oversized, 1)
+	log.Printf("rpc server: reply of %s too large: %d bytes, limit %d", h.ServiceMethod, e.Size, e.Limit)
+	err := rpcerr.Errorf(rpcerr.ResourceExhausted, "rpc server: reply of %s too large: %d bytes exceeds limit of %d bytes", h.ServiceMethod, e.Size, e.Limit).
+		WithDetail(rpcerr.DetailSize, strconv.Itoa(e.Size)).
+		WithDetail(rpcerr.DetailLimit, strconv.Itoa(e.Limit))
+	setHeaderError(h, err)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"testing"
+	"time"
+)
+
+type Dump struct{}
+
+func (Dump) Bytes(n int, reply *[]byte) error {
+	*reply = make([]byte, n)
+	return nil
+}
+
+func TestServer_MaxSendSize(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(Dump{})
+	s.SetMaxSendSize(1 << 20)
+	seen := make(chan int64, 1)
+	s.Use(func(ctx context.Context, info *MethodInfo, argv, replyv interface{}, handler UnaryHandler) error {
+		seen <- MaxSendSize(ctx)
+		return handler(ctx, argv, replyv)
+	})
+
+	for _, opt := range []*Option{
+		{MagicNumber: MagicNumber, CodecType: codec.GobType},
+		{MagicNumber: MagicNumber, CodecType: codec.GobType, HeaderType: codec.BinaryHeader},
+	} {
+		cc, stop := servePipe(s, opt)
+		start := time.Now()
+		_ = cc.Write(&codec.Header{ServiceMethod: "Dump.Bytes", Seq: 1}, 100<<20)
+		var h codec.Header
+		_assert(cc.ReadHeader(&h) == nil && cc.SkipBody() == nil, "%q: read response failed", opt.HeaderType)
+		_assert(time.Since(start) < 5*time.Second, "%q: oversized reply took %v", opt.HeaderType, time.Since(start))
+		_assert(h.Status != nil && h.Status.Code == rpcerr.ResourceExhausted, "%q: unexpected error %q", opt.HeaderType, h.Error)
+		_assert(h.Status.Detail(rpcerr.DetailLimit) == "1048576" && h.Status.Detail(rpcerr.DetailSize) != "", "%q: unexpected details %v", opt.HeaderType, h.Status.Details)
+		_assert(<-seen == 1<<20, "%q: handler did not see the limit", opt.HeaderType)
+
+		// 连接仍然可用 上限内的结果正常返回
+		var reply []byte
+		h = codec.Header{}
+		_ = cc.Write(&codec.Header{ServiceMethod: "Dump.Bytes", Seq: 2}, 1024)
+		_assert(cc.ReadHeader(&h) == nil && h.Error == "" && cc.ReadBody(&reply) == nil && len(reply) == 1024, "%q: small reply failed: %q", opt.HeaderType, h.Error)
+		<-seen
+		stop()
+	}
+	_assert(s.Stats().OversizedReplies == 2, "unexpected oversized count %d", s.Stats().OversizedReplies)
+}
+
+// 处理期间修改配置 响应仍按请求开始时的上限检查
+func TestServer_MaxSendSizeSnapshot(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(Dump{})
+	s.SetMaxSendSize(1024)
+	s.Use(func(ctx context.Context, info *MethodInfo, argv, replyv interface{}, handler UnaryHandler) error {
+		s.SetMaxSendSize(0)
+		return handler(ctx, argv, replyv)
+	})
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	defer stop()
+	written := writeAsync(cc, &codec.Header{ServiceMethod: "Dump.Bytes", Seq: 1}, 4096)
+	var h codec.Header
+	_assert(cc.ReadHeader(&h) == nil && cc.SkipBody() == nil, "read response failed")
+	_assert(h.Status != nil && h.Status.Code == rpcerr.ResourceExhausted, "unexpected error %q", h.Error)
+	_assert(<-written == nil, "write request failed")
+}
+
+// 超过接收上限的请求关闭连接 不读取消息体
+func TestServer_MaxReceiveSize(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(Dump{})
+	s.SetMaxReceiveSize(1024)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.JsonType, HeaderType: codec.BinaryHeader})
+	defer stop()
+	written := writeAsync(cc, &codec.Header{ServiceMethod: "Dump.Bytes", Seq: 1}, make([]byte, 4096))
+	var h codec.Header
+	_assert(cc.ReadHeader(&h) != nil, "expect the connection to be closed")
+	<-written
+}
@@ -1,27 +1,50 @@
 package server
 
 import (
-	"encoding/json"
+	"bufio"
+	"context"
 	"errors"
-	"fmt"
 	"gmrpc/codec"
+	"gmrpc/metadata"
+	"gmrpc/mux"
+	"gmrpc/routing"
+	"gmrpc/rpcerr"
 	"gmrpc/service"
+	"gmrpc/tracing"
+	"gmrpc/wiretrace"
 	"io"
 	"log"
 	"net"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const MagicNumber = 0x3bef5c
 
+// 握手时以一行 json 发送 字段名由 tag 固定
 type Option struct {
-	CodecType      codec.Type // 解码类型
-	MagicNumber    int
-	ConnectTimeout time.Duration // int64  default 10 连接超时
-	HandleTimeout  time.Duration // int64  default 0  处理超时
+	CodecType       codec.Type       `json:"CodecType"`            // 解码类型 拆分头部时为消息体的编码
+	HeaderType      codec.HeaderType `json:"HeaderType,omitempty"` // 头部格式 为空时头部与消息体使用同一编码
+	MagicNumber     int              `json:"MagicNumber"`
+	ConnectTimeout  time.Duration    `json:"ConnectTimeout"`            // int64  default 10 连接超时
+	HandleTimeout   time.Duration    `json:"HandleTimeout"`             // int64  default 0  处理超时
+	StrictDecoding  bool             `json:"StrictDecoding"`            // 严格解码 未知字段与类型不匹配作为参数错误返回
+	Capabilities    bool             `json:"Capabilities,omitempty"`    // 握手后服务端先发送一行 json 列出已注册的服务与方法
+	Compression     string           `json:"Compression,omitempty"`     // 逗号分隔 按优先顺序列出的压缩算法 只用于拆分头部的格式
+	ProtocolVersion int              `json:"ProtocolVersion,omitempty"` // 客户端的协议版本 为 0 表示版本 1 见 protocol.go 客户端在为 0 时使用本版本与全部功能
+	Features        Feature          `json:"Features,omitempty"`        // 客户端支持的功能 只启用明确列出的功能
+
+	// 以下只在客户端使用 不发送给服务端
+	WireTracer        wiretrace.Tracer `json:"-"` // 跟踪该连接上的每一帧
+	CompressThreshold int              `json:"-"` // 小于该大小的消息体不压缩 <= 0 时使用 codec.DefaultCompressThreshold
+	// 参数编码后一定超过该大小时分块发送 (按 codec.MinBodySize 估计) <= 0 表示不分块 需要服务端支持 FeatureChunkedArgs
+	LargeArgThresholdBytes int64 `json:"-"`
+	// 握手时以 16 字节的二进制格式发送 Option 见 binaryoption.go 不能表示时 NewClient 返回错误
+	BinaryOption bool `json:"-"`
 }
 
 type request struct {
@@ -30,108 +53,429 @@ type request struct {
 	replyv reflect.Value // 反射
 	mtype  *service.MethodType
 	svc    *service.Service
+	method string // 请求的方法名 转发时与 mtype 不同
+
+	release func()              // 处理结束后释放准入配额
+	freeMem func()              // 响应发送且处理函数返回后释放内存预算
+	stream  *codec.StreamReader // 流式参数 读完之前不能读取下一个请求
+	size    int                 // 分块发送的参数编码后的大小 其他请求为 0
+	raw     []byte              // 未解码的参数 由解码协程解码 见 decodepool.go
+	body    []byte              // 收到的消息体 见 MethodInfo.Body
+	control bool                // 控制方法 已在读取时处理
+	ctx     context.Context     // 处理函数的上下文 可被 _cancel 取消
+	conn    *connState          // 所在的连接
+	done    func()              // 处理结束后注销请求
+
+	deadline time.Time // 由客户端传来的剩余时间换算的本地截止时间 为零表示没有
+	config   *Config   // 准入时的运行时配置 处理期间不变
+	features Feature   // 连接协商的功能
+
+	prev <-chan struct{} // 流水线请求 上一个流水线请求响应后关闭 见 pipeline.go
+	next chan struct{}   // 流水线请求 本请求响应后关闭
 }
 
+// 没有进入处理时注销已登记的请求
+func (req *request) untrack() {
+	if req.done != nil {
+		req.done()
+	}
+}
+
+// 流式参数 见 codec.StreamingArg
+type StreamingArg = codec.StreamingArg
+
+var streamingArgType = reflect.TypeOf(StreamingArg{})
+
 type Server struct {
+	noCopy noCopy
+
 	serviceMap sync.Map
+	builtins   map[string]*service.Service // 内置服务 NewServer 之后只读
+	validators sync.Map                    // Service.Method -> MethodValidator
+
+	mu           sync.RWMutex
+	interceptors []ServerInterceptor                     // 拦截器
+	tracer       atomic.Value                            // *tracing.FlamegraphTracer
+	router       atomic.Pointer[routing.PredicateRouter] // 按条件改写服务名 为空表示不改写
+	wireTracer   WireTracerFunc                          // 帧跟踪 为空表示不跟踪
+	slowRead     time.Duration                           // 慢读警告的阈值 <= 0 表示不监控
+	slowWrite    time.Duration                           // 慢写警告的阈值 <= 0 表示不监控
+	codecs       *codec.CodecRegistry                    // 为空时使用 codec.DefaultCodecRegistry
+	checks       []namedCheck                            // AddCheck 添加的启动检查
+	strictStart  bool                                    // Accept 前执行 Validate
+	quickACK     bool                                    // 新连接设置 TCP_QUICKACK
+
+	compression       []string // 支持的压缩算法 为空表示不压缩
+	compressThreshold int      // 小于该大小的消息体不压缩
+
+	config      atomic.Pointer[Config] // 运行时配置 由 mu 保护更新 发布后不再修改
+	rateLimiter *rateLimiter           // 限流
+	concurrency *concurrencyLimiter    // 并发上限
+	memory      memoryBudget           // 请求内存预算
+	watchdog    watchdog               // 慢请求看门狗
+
+	connSlots chan struct{} // 连接名额 为空表示不限制
+
+	promoteMu    sync.Mutex // Promote 依次进行 分发的顺序与到达顺序一致
+	standbyMu    sync.Mutex
+	standby      bool             // 热备状态 请求排队等待 Promote
+	standbyQueue []*queuedRequest // 按到达顺序
+
+	shutdownMu    sync.Mutex
+	shuttingDown  bool
+	closingNotice ClosingNotice
+	draining      atomic.Pointer[ClosingNotice] // 关闭开始后不为空
+	listeners     map[net.Listener]struct{}
+	activeCodecs  map[*activeConn]struct{} // 关闭时需要通知的连接
+	lifecycle     *lifecycle               // ShutdownCh 与 Done 第一次使用时创建
+
+	activeConns int64  // 当前服务中的物理连接数 见 ConnectionCount
+	inflight    int64  // 正在执行的处理函数数
+	requests    uint64 // 累计收到的请求数
+	oversized   uint64 // 因超过 MaxSendSize 被替换为错误的响应数
 }
 
+// 嵌入后 go vet 的 copylocks 检查会报告对结构体的复制
+type noCopy struct{}
+
+func (*noCopy) Lock()   {}
+func (*noCopy) Unlock() {}
+
 var invalidRequest = struct{}{}
 
-func (server *Server) Register(rcvr interface{}) error {
+// 注册服务时的选项
+type ServiceOptions struct {
+	Deprecated map[string]Deprecation // 方法名 -> 弃用信息
+	Middleware []ServiceMiddleware    // 包装所有方法 转发的旧方法使用目标方法包装后的结果
+	// 方法名 -> map 或 slice 结果的初始容量 处理函数填充大量元素时避免反复扩容
+	ReplyCapacity map[string]int
+}
+
+func (server *Server) RegisterWithOptions(rcvr interface{}, opts ServiceOptions) error {
 	s := service.NewService(rcvr)
+	if err := validateServiceName(s.Name); err != nil {
+		return err
+	}
+	return server.register(s, opts)
+}
 
+func (server *Server) register(s *service.Service, opts ServiceOptions) error {
+	if err := s.CheckReplyTypes(); err != nil {
+		return err
+	}
+	// 只检查注册时启用的编码 之后 SetCodecRegistry 加入的编码不检查
+	if err := s.CheckReplyCodecs(server.codecRegistry().Types()); err != nil {
+		return err
+	}
+	for method, n := range opts.ReplyCapacity {
+		if err := s.SetReplyCapacity(method, n); err != nil {
+			return err
+		}
+	}
+	applyMiddleware(s, opts.Middleware)
+	for method, d := range opts.Deprecated {
+		if err := s.Deprecate(method, d); err != nil {
+			return err
+		}
+	}
+	views, err := server.versionViews(s)
+	if err != nil {
+		return err
+	}
 	if _, loaded := server.serviceMap.LoadOrStore(s.Name, s); loaded {
 		return errors.New("rpc: service already defined: " + s.Name)
 	}
+	for _, v := range views {
+		server.serviceMap.Store(v.Name, v)
+	}
 	return nil
 }
 
+func (server *Server) Register(rcvr interface{}) error {
+	return server.RegisterWithOptions(rcvr, ServiceOptions{})
+}
+
+func errServiceNotFound(name string) error {
+	return rpcerr.New(rpcerr.NotFound, "rpc server: can't find service "+name)
+}
+
 func (server *Server) findService(serviceMethod string) (svc *service.Service, mtype *service.MethodType, err error) {
 	// 获取分隔符位置
 	dot := strings.LastIndex(serviceMethod, ".")
 	if dot < 0 {
-		err = errors.New("rpc server: service/method request ill-formed: " + serviceMethod)
+		err = rpcerr.New(rpcerr.NotFound, "rpc server: service/method request ill-formed: "+serviceMethod)
 		return
 	}
 
-	// 获取服务名称与方法名称
+	// 获取服务名称与方法名称 Add@2 在服务 Math@2 中查找 Add
 	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
+	if base, version, ok := service.SplitVersion(methodName); ok {
+		serviceName, methodName = serviceName+service.VersionSep+strconv.Itoa(int(version)), base
+	}
 
-	// 获取服务
-	svci, ok := server.serviceMap.Load(serviceName)
+	// 获取服务 带前缀的服务不存在时回退到去掉前缀的服务名
+	svc, ok := server.lookupService(serviceName)
+	if i := strings.LastIndex(serviceName, "."); !ok && i >= 0 {
+		svc, ok = server.lookupService(serviceName[i+1:])
+	}
 	if !ok {
-		err = errors.New("rpc server: can't find service " + serviceName)
+		err = errServiceNotFound(serviceName)
 		return
 	}
-	// 转化服务与方法
-	svc = svci.(*service.Service)
 	mtype = svc.Method[methodName]
 	if mtype == nil {
-		err = errors.New("rpc server: can't find method " + methodName)
+		err = rpcerr.New(rpcerr.NotFound, "rpc server: can't find method "+methodName)
 	}
 	return
 }
 
-func (server *Server) Accept(lis net.Listener) {
+// 返回严格启动检查或 lis.Accept 的错误 Shutdown 关闭监听时返回 nil
+func (server *Server) Accept(lis net.Listener) error {
+	if err := server.strictCheck(lis); err != nil {
+		_ = lis.Close()
+		return err
+	}
+	if !server.trackListener(lis) {
+		_ = lis.Close()
+		return nil
+	}
+	defer server.untrackListener(lis)
 	for {
 		conn, err := lis.Accept()
 
 		if err != nil {
+			if server.isShuttingDown() {
+				return nil
+			}
 			log.Println("rpc server: accept error:", err)
-			return
+			return err
 		}
 
 		go server.ServeConn(conn)
 	}
 }
 
-func (server *Server) ServeConn(conn io.ReadWriteCloser) {
+// registry 用于该连接的编解码器 省略时使用 SetCodecRegistry 设置的注册表
+func (server *Server) ServeConn(conn io.ReadWriteCloser, registry ...*codec.CodecRegistry) {
+	codecs := server.codecRegistry()
+	if len(registry) > 0 && registry[0] != nil {
+		codecs = registry[0]
+	}
+	server.applyQuickACK(conn)
+	server.serveConn(server.monitorConn(conn), true, codecs)
+}
+
+// physical 为 false 表示多路复用的逻辑流 不受连接数上限限制
+func (server *Server) serveConn(conn io.ReadWriteCloser, physical bool, codecs *codec.CodecRegistry) {
 	defer func() { conn.Close() }() // 析构
 
 	var opt Option
 
-	err := json.NewDecoder(conn).Decode(&opt)
+	// json.Decoder 会预读后续的请求数据 因此按行读取 option (或 16 字节的二进制格式) 并让编解码器共用同一个缓冲区
+	br := bufio.NewReader(conn)
+	if b, err := br.Peek(1); err == nil && b[0] == mux.MagicByte {
+		if physical {
+			// 多路复用的连接没有 Option 无法回复错误 超时后直接关闭
+			release, err := server.acquireConn(0)
+			if err != nil {
+				log.Println("rpc server [mux] err: ", err)
+				return
+			}
+			defer release()
+		}
+		_, _ = br.Discard(1)
+		server.serveMux(&bufConn{r: br, ReadWriteCloser: conn}, codecs)
+		return
+	}
+	o, err := readOption(br)
 	if err != nil {
 		log.Println("rpc server [opt] err: ", err)
 		return
 	}
+	opt = *o
 
-	_func := codec.NewCodecFuncMap[opt.CodecType]
-	if _func == nil {
-		log.Println("rpc server [codec type] err: ", opt.CodecType)
+	if opt.MagicNumber != MagicNumber {
+		log.Println("rpc server [magic number] err: ", opt.MagicNumber)
 		return
 	}
+	if physical {
+		release, err := server.acquireConn(opt.ConnectTimeout)
+		if err != nil {
+			log.Println("rpc server [connections] err: ", err)
+			writeHandshakeError(conn, err)
+			return
+		}
+		defer release()
+	}
 
-	server.ServeCodec(_func(conn), opt.HandleTimeout)
+	cc, err := server.newCodec(conn, &bufConn{r: br, ReadWriteCloser: conn}, &opt, codecs)
+	if err != nil {
+		log.Println("rpc server [codec type] err: ", err)
+		return
+	}
+	if sd, ok := cc.(codec.StrictDecoding); ok && opt.StrictDecoding {
+		sd.SetStrictDecoding(true)
+	}
+	if rl, ok := cc.(codec.ReceiveLimiter); ok {
+		rl.SetMaxReceiveSize(int(server.maxReceiveSize()))
+	}
+	features, err := server.handshake(conn, cc, &opt)
+	if err != nil {
+		log.Println("rpc server [handshake] err: ", err)
+		return
+	}
+	var peer net.Addr
+	if c, ok := conn.(interface{ RemoteAddr() net.Addr }); ok {
+		peer = c.RemoteAddr()
+	}
+	server.serveCodec(cc, opt.HandleTimeout, features, peer)
+}
+
+// 读取走缓冲区 写入与关闭走原始连接
+type bufConn struct {
+	r *bufio.Reader
+	io.ReadWriteCloser
 }
 
+func (c *bufConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// 对方按版本 1 处理
 func (server *Server) ServeCodec(cc codec.Codec, timeout time.Duration) {
+	server.serveCodec(cc, timeout, V1Features, nil)
+}
+
+// features 为握手时协商的功能 peer 为对端地址 未知时为空
+func (server *Server) serveCodec(cc codec.Codec, timeout time.Duration, features Feature, peer net.Addr) {
 	// 1. 读取请求
 	// 2. 处理请求
 	// 3. 回复请求
 
 	sending := new(sync.Mutex) // 互斥锁
 	wg := new(sync.WaitGroup)  // 等待一组 goroutine 结束
+	conn := newConnState()
+	conn.features = features
+	conn.peer = peer
+	active := &activeConn{cc: cc, sending: sending, state: conn, idle: &idleCloser{server: server, cc: cc, conn: conn}}
+	if !server.trackConn(active) {
+		return
+	}
+	defer server.untrackConn(active)
+	active.idle.start()
+	defer active.idle.stop()
+	decoders := server.newDecodePool(cc, conn, sending, wg, timeout)
 
 	for {
-		req, err := server.readRequest(cc)
+		req, err := server.readRequest(cc, conn)
+		conn.touch()
+		if req != nil {
+			atomic.AddUint64(&server.requests, 1)
+		}
 		if err != nil {
 			if req == nil {
 				break
 			}
-			req.h.Error = err.Error()
-			server.sendResponse(cc, req.h, invalidRequest, sending)
+			if req.freeMem != nil {
+				req.freeMem()
+			}
+			setHeaderError(req.h, err)
+			server.sendResponse(cc, req.h, invalidRequest, 0, sending)
 			continue
 		}
-		wg.Add(1)
-		go server.handleRequest(cc, req, sending, wg, timeout)
+		if req.control {
+			server.sendResponse(cc, req.h, invalidRequest, 0, sending)
+			continue
+		}
+		if req.raw != nil {
+			// 解码前登记 解码期间的 _cancel 与空闲检查都能看到该请求
+			req.ctx, req.done = conn.track(req.h.Seq)
+			decoders.submit(req)
+			continue
+		}
+		if !server.serveRequest(cc, req, conn, sending, wg, timeout) {
+			break
+		}
 	}
+	decoders.close()
+	server.dropQueued(conn)
+	conn.abortDeferred()
 	wg.Wait()
 	cc.Close()
 
 }
 
+// 已读出参数的请求 检查内存预算与热备状态后交给处理协程 返回 false 表示连接需要关闭
+func (server *Server) serveRequest(cc codec.Codec, req *request, conn *connState, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) bool {
+	// 内存预算 读取前已按声明的大小占用时不再计入 流式参数的大小无法预先知道 不计入
+	if req.freeMem == nil {
+		var err error
+		req.freeMem = func() {}
+		if req.stream == nil {
+			if req.freeMem, err = server.acquireMemory(cc, req.size); err != nil {
+				req.untrack()
+				setHeaderError(req.h, err)
+				server.sendResponse(cc, req.h, invalidRequest, 0, sending)
+				return true
+			}
+		}
+	}
+	req.conn = conn
+	if req.stream != nil && server.isStandby() {
+		_ = req.stream.Close()
+		setHeaderError(req.h, errStandbyStream)
+		server.sendResponse(cc, req.h, invalidRequest, 0, sending)
+		return true
+	}
+	dispatch := func() { server.dispatch(cc, req, conn, sending, wg, timeout) }
+	reject := func(err error) {
+		req.untrack()
+		req.freeMem()
+		setHeaderError(req.h, err)
+		server.sendResponse(cc, req.h, invalidRequest, 0, sending)
+	}
+	if req.stream == nil && server.queueIfStandby(req, wg, dispatch, reject) {
+		return true
+	}
+	// 流式参数由处理函数读取 读完后才能继续读取下一个请求
+	if server.dispatch(cc, req, conn, sending, wg, timeout) && req.stream != nil {
+		<-req.stream.Done()
+		if err := req.stream.Err(); err != io.EOF {
+			log.Println("rpc server: read stream error:", err)
+			return false
+		}
+	}
+	return true
+}
+
+// 准入检查后交给处理协程 未准入时回复错误并返回 false
+func (server *Server) dispatch(cc codec.Codec, req *request, conn *connState, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) bool {
+	// 限流与并发上限检查
+	release, err := server.admit()
+	if err != nil {
+		req.untrack()
+		req.freeMem()
+		if req.stream != nil {
+			_ = req.stream.Close()
+		}
+		setHeaderError(req.h, err)
+		server.sendResponse(cc, req.h, invalidRequest, 0, sending)
+		return false
+	}
+	req.release = release
+	req.config = server.loadConfig()
+	req.features = conn.features
+	if req.ctx == nil {
+		req.ctx, req.done = conn.track(req.h.Seq)
+	}
+	if isPipelined(req.h) {
+		req.prev, req.next = conn.pipelineOrder()
+	}
+	wg.Add(1)
+	go server.handleRequest(cc, req, sending, wg, handleTimeout(timeout, req.config.HandleTimeout))
+	return true
+}
+
 func (server *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
 	var header codec.Header
 	err := cc.ReadHeader(&header)
@@ -143,7 +487,7 @@ func (server *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
 	return &header, nil
 }
 
-func (server *Server) readRequest(cc codec.Codec) (*request, error) {
+func (server *Server) readRequest(cc codec.Codec, conn *connState) (*request, error) {
 
 	// 解析请求头
 	header, err := server.readRequestHeader(cc)
@@ -152,25 +496,65 @@ func (server *Server) readRequest(cc codec.Codec) (*request, error) {
 	}
 
 	// 创建请求
-	req := &request{h: header}
-	req.svc, req.mtype, err = server.findService(header.ServiceMethod)
+	req := &request{h: header, deadline: budgetDeadline(header.Metadata, time.Now())}
+	isStream := codec.IsStream(header)
+	if isStream {
+		delete(header.Metadata, codec.StreamMetadataKey)
+	}
+	isChunked := codec.IsChunked(header) && !isStream
+	if isChunked {
+		delete(header.Metadata, codec.ChunkedMetadataKey)
+	}
+	if handle, ok := controlHandlers[header.ServiceMethod]; ok && !isStream {
+		req.control = true
+		return req, handle(conn, cc, header)
+	}
+	req.svc, req.mtype, err = server.findService(server.route(conn, header))
 	if err != nil {
-		return nil, err
+		// 丢弃消息体 保持连接可用
+		discardBody(cc, isStream, isChunked)
+		return req, err
 	}
-	req.argv = req.mtype.NewArgv()
-	req.replyv = req.mtype.NewReplyv()
-
-	var argvi any
-	if req.argv.Type().Kind() != reflect.Ptr {
-		argvi = req.argv.Addr().Interface()
-	} else {
-		argvi = req.argv.Interface()
+	req.method = header.ServiceMethod[strings.LastIndex(header.ServiceMethod, ".")+1:]
+	if (req.mtype.ArgType == streamingArgType) != isStream {
+		discardBody(cc, isStream, isChunked)
+		return req, rpcerr.New(rpcerr.InvalidArgs, "rpc server: stream mismatch for "+header.ServiceMethod)
+	}
+	if isStream {
+		req.stream = codec.NewStreamReader(cc)
+		req.argv = reflect.ValueOf(StreamingArg{Reader: req.stream})
+		req.replyv = req.mtype.NewReplyvFromPool()
+		return req, nil
+	}
+	req.argv = req.mtype.NewArgvFromPool()
+	req.replyv = req.mtype.NewReplyvFromPool()
+
+	argvi := argsPointer(req.argv)
+	if !isChunked {
+		if req.freeMem, err = server.acquireFrameMemory(cc); err != nil {
+			discardBody(cc, false, false)
+			return req, err
+		}
+	}
+	if bp, ok := cc.(codec.BodyPeeker); ok && !isChunked {
+		req.body = bp.PeekBody()
 	}
 
-	// 解析参数
-	err = cc.ReadBody(argvi)
+	// 解析参数 启用并行解码时只取出消息体 由解码协程解码
+	switch {
+	case isChunked:
+		err = server.readChunkedBody(cc, req, argvi)
+	case conn.rawBody != nil && !isPipelined(header):
+		req.raw = conn.rawBody.ReadRawBody()
+		req.size = len(req.raw)
+		return req, nil
+	default:
+		err = cc.ReadBody(argvi)
+	}
 	if err != nil {
-		log.Println("rpc server read argv err:", err)
+		return req, argsError(err)
+	}
+	if err := server.validateArgs(header.ServiceMethod, req.argv.Interface()); err != nil {
 		return req, err
 	}
 
@@ -178,64 +562,273 @@ func (server *Server) readRequest(cc codec.Codec) (*request, error) {
 
 }
 
+// 解码参数的错误 消息体格式错误时为 InvalidArgs 连接仍然可用
+func argsError(err error) error {
+	log.Println("rpc server read argv err:", err)
+	var decErr *codec.DecodeError
+	if errors.As(err, &decErr) {
+		e := rpcerr.New(rpcerr.InvalidArgs, "rpc server: invalid args: "+err.Error())
+		if decErr.Field != "" {
+			e.WithDetail(rpcerr.DetailField, decErr.Field)
+		}
+		return e
+	}
+	return err
+}
+
+// 参数的指针 解码的目标
+func argsPointer(argv reflect.Value) interface{} {
+	if argv.Type().Kind() != reflect.Ptr {
+		return argv.Addr().Interface()
+	}
+	return argv.Interface()
+}
+
+func discardBody(cc codec.Codec, isStream, isChunked bool) {
+	switch {
+	case isStream:
+		_ = codec.NewStreamReader(cc).Close()
+	case isChunked:
+		_ = codec.DiscardChunked(cc)
+	default:
+		_ = cc.SkipBody()
+	}
+}
+
+// 读完所有块后解码 总大小不超过接收上限与内存预算
+func (server *Server) readChunkedBody(cc codec.Codec, req *request, argvi interface{}) error {
+	limit := server.maxReceiveSize()
+	if b := server.loadConfig().MemoryBudget; b > 0 && b < limit {
+		limit = b
+	}
+	data, err := codec.ReadChunked(cc, int(limit))
+	if err != nil {
+		return err
+	}
+	req.size = len(data)
+	bm, ok := cc.(codec.BodyMarshaler)
+	if !ok {
+		return rpcerr.New(rpcerr.InvalidArgs, "rpc server: codec does not support chunked args")
+	}
+	return bm.UnmarshalBody(data, argvi)
+}
+
 func (server *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
 	defer wg.Done()
-	called := make(chan struct{})
-	sent := make(chan struct{})
+	if req.prev != nil {
+		<-req.prev
+	}
 
-	go func() {
-		err := req.svc.Call(req.mtype, req.argv, req.replyv)
-		called <- struct{}{}
-		if err != nil {
-			req.h.Error = err.Error()
-			server.sendResponse(cc, req.h, invalidRequest, sending)
-			sent <- struct{}{}
+	// 超时后处理函数可能仍在运行 通道带缓冲避免其永久阻塞 responded 保证每个请求只响应一次
+	called := make(chan struct{}, 1)
+	var responded int32
+	respond := func(err error, body interface{}) {
+		if !atomic.CompareAndSwapInt32(&responded, 0, 1) {
+			// 已超时 流式结果不再发送
+			if rc, ok := body.(io.ReadCloser); ok {
+				_ = rc.Close()
+			}
 			return
 		}
-		server.sendResponse(cc, req.h, req.replyv.Interface(), sending)
-		sent <- struct{}{}
+		// 响应之前注销 之后的 _cancel 不再生效
+		req.done()
+		if req.next != nil {
+			defer close(req.next)
+		}
+		if rc, ok := body.(io.ReadCloser); ok && err == nil && !req.features.Has(FeatureStreaming) {
+			_ = rc.Close()
+			err = rpcerr.New(rpcerr.Internal, "rpc server: client does not support streaming replies")
+		}
+		// 超时或延迟响应时处理函数可能仍在读取 req.h 响应头使用副本 元数据只会整体替换 不会原地修改
+		h := *req.h
+		if err != nil {
+			setHeaderError(&h, err)
+			body = invalidRequest
+		} else {
+			setCacheHint(&h, body)
+		}
+		setDeprecation(&h, req)
+		server.setDrainHint(&h)
+		if !req.features.Has(FeatureMetadata) {
+			h.Metadata = nil
+		}
+		freeReply := server.chargeReply(req.config.MemoryBudget, body)
+		server.sendResponse(cc, &h, body, req.config.MaxSendSize, sending)
+		freeReply()
+	}
+
+	limit, source := handleLimit(timeout, req.deadline)
+	if source == rpcerr.TimeoutPropagatedBudget && limit <= 0 {
+		// 到达时预算已经耗尽 不再调用处理函数
+		if req.stream != nil {
+			_ = req.stream.Close()
+		}
+		req.release()
+		respond(timeoutError(limit, source), nil)
+		req.freeMem()
+		return
+	}
+
+	if req.mtype.Deferred {
+		server.handleDeferred(req, respond, limit, source, wg)
+		return
+	}
+
+	atomic.AddInt64(&server.inflight, 1)
+	go func() {
+		defer atomic.AddInt64(&server.inflight, -1)
+		// 超时后处理函数仍在使用参数 返回后才释放
+		defer req.freeMem()
+		start := time.Now()
+		var err error
+		server.watchdog.run(req.config.SlowThreshold, req.h.ServiceMethod, req.h.Seq, func() { err = server.invoke(req) })
+		req.mtype.TrackLatency(time.Since(start).Nanoseconds())
+		if req.stream != nil {
+			// 处理函数没有读完的数据需要丢弃
+			_ = req.stream.Close()
+		}
+		req.release()
+		respond(err, req.replyv.Interface())
+		recycle(cc, req)
+		called <- struct{}{}
 	}()
 
-	if timeout == 0 {
+	if limit == 0 {
 		<-called
-		<-sent
 		return
 	}
 
+	timer := time.NewTimer(limit)
+	defer timer.Stop()
 	select {
-	case <-time.After(timeout):
-		req.h.Error = fmt.Sprintf("rpc server: request handle timeout: expect within %s", timeout)
-		server.sendResponse(cc, req.h, invalidRequest, sending)
+	case <-timer.C:
+		// 处理函数仍在运行 respond 只读取 req.h 不修改
+		respond(timeoutError(limit, source), nil)
 	case <-called:
-		<-sent
 	}
 }
 
-func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) {
+// 处理函数返回且响应已发送后 参数与结果放回池中 处理函数与拦截器不能在返回后继续持有它们
+// 超时的请求已用空消息体响应 同样可以回收
+func recycle(cc codec.Codec, req *request) {
+	if _, async := cc.(*codec.SplitCodec); async {
+		// 异步写入 Write 返回时结果可能还没有编码
+		return
+	}
+	if req.stream == nil {
+		req.mtype.RecycleArgv(req.argv)
+	}
+	req.mtype.RecycleReplyv(req.replyv)
+}
+
+func (server *Server) invoke(req *request) error {
+	// 经过拦截器链调用服务方法
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if req.deadline.IsZero() {
+		ctx, cancel = context.WithCancel(req.ctx)
+	} else {
+		ctx, cancel = context.WithDeadline(req.ctx, req.deadline)
+	}
+	defer cancel()
+	return server.invokeWith(ctx, req)
+}
+
+func (server *Server) invokeWith(ctx context.Context, req *request) error {
+	if req.h.Metadata != nil {
+		md := metadata.New(req.h.Metadata)
+		ctx = tracing.ExtractBaggage(metadata.NewIncomingContext(ctx, md), md)
+	}
+	if n := req.config.MaxSendSize; n > 0 {
+		ctx = context.WithValue(ctx, maxSendSizeKey{}, n)
+	}
+	info := &MethodInfo{ServiceMethod: req.h.ServiceMethod, Header: req.h, Body: req.body}
+
+	var tr *tracing.Trace
+	if t := server.flamegraphTracer(); t != nil {
+		tr = t.StartTrace(info.ServiceMethod)
+	}
+	defer tr.Finish()
+
+	handler := server.chainInterceptors(info, tr, func(ctx context.Context, argv, replyv interface{}) error {
+		if d, ok := replyv.(*service.DeferredReply); ok {
+			d.Ctx = ctx
+		}
+		return req.svc.Call(req.mtype, req.argv, req.replyv)
+	})
+	return handler(ctx, req.argv.Interface(), req.replyv.Interface())
+}
+
+// 写入错误信息 结构化错误同时携带错误码
+func setHeaderError(h *codec.Header, err error) {
+	h.Error = err.Error()
+	if e, ok := rpcerr.FromError(err); ok {
+		h.Status = e
+		setRetryAfter(h, e.RetryAfterMs)
+	}
+}
+
+// maxSend 为请求开始时配置快照中的 MaxSendSize 0 表示不限制
+func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, maxSend int64, sending *sync.Mutex) {
 	defer sending.Unlock()
 	sending.Lock()
-	if err := cc.Write(h, body); err != nil {
+	// 结果实现了 io.ReadCloser 时分块发送
+	if rc, ok := body.(io.ReadCloser); ok {
+		defer func() { _ = rc.Close() }()
+		if err := codec.WriteStream(cc, h, rc); err != nil {
+			log.Println("rpc server: write response stream error:", err)
+		}
+		return
+	}
+	// 只限制结果 错误响应与关闭通知等其他写入不受限制
+	sl, _ := cc.(codec.SizeLimiter)
+	if sl != nil {
+		sl.SetMaxBodySize(int(maxSend))
+	}
+	err := cc.Write(h, body)
+	if sl != nil {
+		sl.SetMaxBodySize(0)
+	}
+	var encErr *codec.EncodeError
+	var sizeErr *codec.SizeError
+	switch {
+	case errors.As(err, &sizeErr):
+		server.replyTooLarge(h, sizeErr)
+		err = cc.Write(h, invalidRequest)
+	case errors.As(err, &encErr):
+		// 结果无法编码时连接仍然可用 改为返回错误
+		setHeaderError(h, rpcerr.New(rpcerr.Internal, "rpc server: reply not serializable: "+encErr.Err.Error()))
+		err = cc.Write(h, invalidRequest)
+	}
+
+	if err != nil {
 		log.Println("rpc server: write response error:", err)
 	}
 }
 
 // 服务端构造函数
 func NewServer() *Server {
-	return &Server{}
+	server := &Server{}
+	server.registerBuiltin(ReflectionService, &reflection{server: server})
+	return server
 }
 
 var DefaultServer *Server = NewServer()
 var DefaultOption = &Option{
-	MagicNumber:    MagicNumber,
-	CodecType:      codec.GobType,
-	ConnectTimeout: time.Second * 10,
-	HandleTimeout:  0,
+	MagicNumber:     MagicNumber,
+	CodecType:       codec.GobType,
+	ConnectTimeout:  time.Second * 10,
+	HandleTimeout:   0,
+	ProtocolVersion: ProtocolVersion,
+	Features:        SupportedFeatures,
 }
 var DefaultJsonOption = &Option{
-	MagicNumber:    MagicNumber,
-	CodecType:      codec.JsonType,
-	ConnectTimeout: time.Second * 10,
-	HandleTimeout:  0,
+	MagicNumber:     MagicNumber,
+	CodecType:       codec.JsonType,
+	ConnectTimeout:  time.Second * 10,
+	HandleTimeout:   0,
+	ProtocolVersion: ProtocolVersion,
+	Features:        SupportedFeatures,
 }
 
 func Register(rcvr interface{}, server ...*Server) error {
@@ -249,6 +842,53 @@ func Register(rcvr interface{}, server ...*Server) error {
 	return ser.Register(rcvr)
 }
 
-func Accept(lis net.Listener) {
-	DefaultServer.Accept(lis)
+func Accept(lis net.Listener) error {
+	return DefaultServer.Accept(lis)
+}
+
+// 服务端运行状态快照
+type ServerStats struct {
+	ActiveConns      int64 // 物理连接数 不含多路复用的逻辑流
+	Inflight         int64
+	Requests         uint64
+	OversizedReplies uint64 // 超过 MaxSendSize 的响应数
+}
+
+func (server *Server) Stats() ServerStats {
+	return ServerStats{
+		ActiveConns: atomic.LoadInt64(&server.activeConns),
+		Inflight:    atomic.LoadInt64(&server.inflight),
+		Requests:    atomic.LoadUint64(&server.requests),
+
+		OversizedReplies: atomic.LoadUint64(&server.oversized),
+	}
+}
+
+// 方法处理耗时的分位数
+type MethodLatencies struct {
+	P50  time.Duration
+	P95  time.Duration
+	P99  time.Duration
+	P999 time.Duration
+}
+
+// 方法不存在或还没有调用时返回零值
+func (server *Server) MethodLatencies(serviceMethod string) MethodLatencies {
+	_, mtype, err := server.findService(serviceMethod)
+	if err != nil {
+		return MethodLatencies{}
+	}
+	return MethodLatencies{
+		P50:  mtype.Percentile(50),
+		P95:  mtype.Percentile(95),
+		P99:  mtype.Percentile(99),
+		P999: mtype.Percentile(99.9),
+	}
+}
+
+// 预先注册通过接口类型传递的具体类型 参数与结果类型在注册服务时已自动注册
+func (server *Server) PreRegisterGobTypes(vals ...interface{}) {
+	for _, v := range vals {
+		codec.RegisterGobType(v)
+	}
 }
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"gmrpc/codec"
+	"gmrpc/logger"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// 通过 net.Pipe 直接与 ServeConn 交互 返回客户端一侧的编解码器
+func servePipe(s *Server, opt *Option) (codec.Codec, func()) {
+	serverConn, clientConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.ServeConn(serverConn)
+		close(done)
+	}()
+	if opt.BinaryOption {
+		_ = WriteOptionBinary(clientConn, opt)
+	} else {
+		_ = json.NewEncoder(clientConn).Encode(opt)
+	}
+	cc, _ := codec.New(clientConn, opt.HeaderType, opt.CodecType)
+	return cc, func() {
+		_ = cc.Close()
+		<-done
+	}
+}
+
+// 管道的写入在对端读出前阻塞 因此在协程中写入 返回写入的结果
+// 编解码器的写入不是并发安全的 下一次写入前等待本次完成
+func writeAsync(cc codec.Codec, h *codec.Header, body interface{}) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- cc.Write(h, body) }()
+	return done
+}
+
+func TestServer_ServeConn(t *testing.T) {
+	var foo Foo
+	s := NewServer()
+	_ = s.Register(&foo)
+
+	for _, opt := range []*Option{
+		{MagicNumber: MagicNumber, CodecType: codec.GobType},
+		{MagicNumber: MagicNumber, CodecType: codec.JsonType},
+		{MagicNumber: MagicNumber, CodecType: codec.GobType, HeaderType: codec.BinaryHeader},
+		{MagicNumber: MagicNumber, CodecType: codec.JsonType, HeaderType: codec.BinaryHeader},
+	} {
+		t.Run(string(opt.HeaderType)+string(opt.CodecType), func(t *testing.T) {
+			cc, stop := servePipe(s, opt)
+			defer stop()
+
+			for i := 1; i <= 3; i++ {
+				written := writeAsync(cc, &codec.Header{ServiceMethod: "Foo.Sum", Seq: uint64(i)}, Args{Num1: i, Num2: i})
+				var h codec.Header
+				var reply int
+				_assert(cc.ReadHeader(&h) == nil && h.Error == "", "unexpected header %+v", h)
+				_assert(cc.ReadBody(&reply) == nil && reply == 2*i, "expect %d, got %d", 2*i, reply)
+				_assert(<-written == nil, "write failed")
+			}
+
+			written := writeAsync(cc, &codec.Header{ServiceMethod: "Foo.Missing", Seq: 9}, Args{})
+			var h codec.Header
+			_assert(cc.ReadHeader(&h) == nil && h.Status != nil && h.Seq == 9, "expect not found error, got %+v", h)
+			_ = cc.ReadBody(nil)
+			_assert(<-written == nil, "write failed")
+			_assert(s.Stats().ActiveConns == 1, "expect 1 active conn, got %d", s.Stats().ActiveConns)
+		})
+	}
+	_assert(s.Stats().ActiveConns == 0, "expect connections to be released, got %d", s.Stats().ActiveConns)
+}
+
+// 没有开启空闲超时时连接不启动定时器 开启后对已有连接启动 改回 0 后停止
+func TestServer_IdleTimerOnlyWhenEnabled(t *testing.T) {
+	s := NewServer()
+	_, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	defer stop()
+	// 返回登记的连接数与其中在检查的连接数
+	checking := func() (conns, n int) {
+		s.shutdownMu.Lock()
+		defer s.shutdownMu.Unlock()
+		for c := range s.activeCodecs {
+			c.idle.mu.Lock()
+			if c.idle.timer != nil {
+				n++
+			}
+			c.idle.mu.Unlock()
+		}
+		return len(s.activeCodecs), n
+	}
+	deadline := time.Now().Add(time.Second)
+	for conns, _ := checking(); conns == 0 && time.Now().Before(deadline); conns, _ = checking() {
+		time.Sleep(time.Millisecond)
+	}
+	conns, n := checking()
+	_assert(conns == 1 && n == 0, "idle timer should not run without IdleTimeout")
+
+	s.SetIdleTimeout(time.Hour)
+	_, n = checking()
+	_assert(n == 1, "enabling IdleTimeout should start the timer on existing connections")
+	s.SetIdleTimeout(0)
+	for _, n = checking(); n != 0 && time.Now().Before(deadline.Add(2*idleCheckInterval)); _, n = checking() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_assert(n == 0, "idle timer should stop after IdleTimeout is disabled")
+}
+
+type Blocker struct{ release chan struct{} }
+
+func (b *Blocker) Wait(n int, reply *int) error {
+	<-b.release
+	*reply = n
+	return nil
+}
+
+type captureLogger struct {
+	mu   sync.Mutex
+	warn []string
+}
+
+func (l *captureLogger) Info(format string, v ...interface{})  {}
+func (l *captureLogger) Error(format string, v ...interface{}) {}
+func (l *captureLogger) Warn(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warn = append(l.warn, fmt.Sprintf(format, v...))
+}
+
+func (l *captureLogger) messages() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.warn...)
+}
+
+func TestServer_SlowRequestWatchdog(t *testing.T) {
+	b := &Blocker{release: make(chan struct{})}
+	s := NewServer()
+	_ = s.Register(b)
+	logs := new(captureLogger)
+	s.SetSlowLogger(logs)
+	s.SetSlowThreshold(50 * time.Millisecond)
+
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	defer stop()
+	written := writeAsync(cc, &codec.Header{ServiceMethod: "Blocker.Wait", Seq: 7}, 1)
+
+	time.Sleep(200 * time.Millisecond)
+	msgs := logs.messages()
+	_assert(len(msgs) == 1, "expect watchdog to fire exactly once, got %d", len(msgs))
+	_assert(strings.Contains(msgs[0], "Blocker.Wait seq=7"), "expect method and seq in log, got %q", msgs[0])
+	_assert(strings.Contains(msgs[0], "(*Blocker).Wait"), "expect handler stack in log, got %q", msgs[0])
+
+	slow := s.SlowRequests()
+	_assert(len(slow) == 1 && slow[0].Seq == 7 && slow[0].Elapsed >= 50*time.Millisecond, "unexpected slow requests %+v", slow)
+
+	close(b.release)
+	var h codec.Header
+	var reply int
+	_assert(cc.ReadHeader(&h) == nil && cc.ReadBody(&reply) == nil && reply == 1, "expect reply after release, got %+v", h)
+	_assert(<-written == nil, "write failed")
+	_assert(len(s.SlowRequests()) == 0, "expect finished request to be removed")
+	_assert(len(logs.messages()) == 1, "expect no further watchdog logs")
+}
+
+// 结束与定时器触发竞争时不留下已结束的请求
+func TestWatchdog_ReportAfterEnd(t *testing.T) {
+	var w watchdog
+	logs := new(captureLogger)
+	var l logger.Logger = logs
+	w.logger.Store(&l)
+	wr := w.begin(time.Hour, "Blocker.Wait", 1)
+	w.end(wr)
+	w.report(wr)
+	_assert(len(w.slow) == 0 && len(logs.messages()) == 0, "finished request should not be reported")
+}
+
+type Payload struct{ Name string }
+type Extra struct{ Size int }
+
+type Envelope struct{ Value interface{} }
+
+type Store struct{}
+
+func (s *Store) Put(p Payload, reply *string) error {
+	*reply = p.Name
+	return nil
+}
+
+func (s *Store) Wrap(e Envelope, reply *string) error {
+	*reply = fmt.Sprintf("%T", e.Value)
+	return nil
+}
+
+func TestServer_GobInterfaceArgs(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(new(Store))
+	// Payload 作为 Put 的参数类型已自动注册 Extra 只出现在接口值中 需要手动注册
+	s.PreRegisterGobTypes(Extra{}, Extra{})
+
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	defer stop()
+	for i, v := range []interface{}{Payload{Name: "p"}, Extra{Size: 1}} {
+		h := &codec.Header{ServiceMethod: "Store.Wrap", Seq: uint64(i)}
+		written := writeAsync(cc, h, Envelope{Value: v})
+
+		var rh codec.Header
+		var reply string
+		_assert(cc.ReadHeader(&rh) == nil && rh.Error == "", "unexpected header %+v", rh)
+		_assert(cc.ReadBody(&reply) == nil && reply == fmt.Sprintf("%T", v), "expect %T, got %q", v, reply)
+		_assert(<-written == nil, "write failed")
+	}
+}
+
+type Sleeper int
+
+func (s Sleeper) Sleep(d time.Duration, reply *int) error {
+	time.Sleep(d)
+	return nil
+}
+
+func TestServer_MethodLatencies(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(new(Sleeper))
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	defer stop()
+
+	// 指数分布的耗时 均值 2ms
+	const n = 1000
+	rng := rand.New(rand.NewSource(1))
+	go func() {
+		for i := 0; i < n; i++ {
+			d := time.Duration(rng.ExpFloat64() * float64(2*time.Millisecond))
+			_ = cc.Write(&codec.Header{ServiceMethod: "Sleeper.Sleep", Seq: uint64(i)}, d)
+		}
+	}()
+	for i := 0; i < n; i++ {
+		var h codec.Header
+		_assert(cc.ReadHeader(&h) == nil && h.Error == "", "unexpected header %+v", h)
+		_ = cc.ReadBody(nil)
+	}
+
+	l := s.MethodLatencies("Sleeper.Sleep")
+	_assert(l.P50 < l.P95 && l.P95 < l.P99 && l.P99 <= l.P999, "percentiles out of order: %+v", l)
+	_assert(l.P50 > 500*time.Microsecond && l.P50 < 5*time.Millisecond, "unrealistic p50: %v", l.P50)
+	_assert(l.P99 > 4*time.Millisecond && l.P99 < 100*time.Millisecond, "unrealistic p99: %v", l.P99)
+	_assert(s.MethodLatencies("Sleeper.Missing") == MethodLatencies{}, "expect zero latencies for missing method")
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"gmrpc/codec"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+/*
+优雅关闭 停止接受新连接 每个连接上的请求处理完后发送 _closing 通知再关闭
+客户端据此区分服务端主动关闭与网络故障 通知中的 RetryAfterMs 建议客户端重连前等待的时间
+ShutdownCh 在开始关闭时关闭 Done 在所有连接都已通知并关闭且处理函数都已返回后关闭 不持有 Server 的协程可以 select 这两个通道
+Shutdown 的 ctx 结束时连接立即关闭 仍在运行的处理函数 (包括超时后的) 返回前 Done 不关闭
+ServeUntilSignal 收到信号后关闭 关闭期间再次收到信号时按默认行为退出进程
+*/
+
+// 关闭通知 Seq 为 0 客户端的请求编号从 1 开始 不会冲突
+const (
+	ClosingService = "_closing"
+	ClosingMethod  = ClosingService + ".Notice"
+)
+
+type ClosingNotice struct {
+	Reason       string
+	RetryAfterMs uint32
+}
+
+var DefaultClosingNotice = ClosingNotice{Reason: "server shutdown"}
+
+// 关闭时等待请求结束的轮询间隔
+const shutdownPollInterval = 10 * time.Millisecond
+
+// 正在服务的连接
+type activeConn struct {
+	cc      codec.Codec
+	sending *sync.Mutex
+	state   *connState
+	idle    *idleCloser
+}
+
+// 登记连接 已经开始关闭时直接通知并关闭 返回 false
+func (server *Server) trackConn(c *activeConn) bool {
+	server.shutdownMu.Lock()
+	if server.shuttingDown {
+		notice := server.closingNotice
+		server.shutdownMu.Unlock()
+		c.notifyClosing(&notice)
+		return false
+	}
+	defer server.shutdownMu.Unlock()
+	if server.activeCodecs == nil {
+		server.activeCodecs = make(map[*activeConn]struct{})
+	}
+	server.activeCodecs[c] = struct{}{}
+	return true
+}
+
+func (server *Server) untrackConn(c *activeConn) {
+	server.shutdownMu.Lock()
+	defer server.shutdownMu.Unlock()
+	delete(server.activeCodecs, c)
+}
+
+func (server *Server) trackListener(lis net.Listener) bool {
+	server.shutdownMu.Lock()
+	defer server.shutdownMu.Unlock()
+	if server.shuttingDown {
+		return false
+	}
+	if server.listeners == nil {
+		server.listeners = make(map[net.Listener]struct{})
+	}
+	server.listeners[lis] = struct{}{}
+	return true
+}
+
+func (server *Server) untrackListener(lis net.Listener) {
+	server.shutdownMu.Lock()
+	defer server.shutdownMu.Unlock()
+	delete(server.listeners, lis)
+}
+
+// 使用 DefaultClosingNotice 关闭
+func (server *Server) Shutdown(ctx context.Context) error {
+	return server.ShutdownWithNotice(ctx, DefaultClosingNotice)
+}
+
+// 关闭监听 等待每个连接上的请求处理完后发送通知并关闭连接
+// ctx 结束时不再等待 剩余连接立即发送通知并关闭 返回 ctx 的错误
+func (server *Server) ShutdownWithNotice(ctx context.Context, notice ClosingNotice) error {
+	server.shutdownMu.Lock()
+	first := !server.shuttingDown
+	if first {
+		close(server.lifecycleLocked().shutdown)
+	}
+	server.shuttingDown = true
+	server.closingNotice = notice
+	server.draining.Store(&notice)
+	for lis := range server.listeners {
+		_ = lis.Close()
+	}
+	conns := make([]*activeConn, 0, len(server.activeCodecs))
+	for c := range server.activeCodecs {
+		conns = append(conns, c)
+	}
+	server.shutdownMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *activeConn) {
+			defer wg.Done()
+			c.waitIdle(ctx)
+			c.notifyClosing(&notice)
+		}(c)
+	}
+	wg.Wait()
+	if first {
+		go server.closeDoneWhenIdle()
+	}
+	return ctx.Err()
+}
+
+func (server *Server) isShuttingDown() bool {
+	server.shutdownMu.Lock()
+	defer server.shutdownMu.Unlock()
+	return server.shuttingDown
+}
+
+// 连接都已退出且没有正在执行的处理函数后关闭 Done
+func (server *Server) closeDoneWhenIdle() {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		server.shutdownMu.Lock()
+		if len(server.activeCodecs) == 0 && atomic.LoadInt64(&server.inflight) == 0 {
+			close(server.lifecycleLocked().done)
+			server.shutdownMu.Unlock()
+			return
+		}
+		server.shutdownMu.Unlock()
+		<-ticker.C
+	}
+}
+
+type lifecycle struct {
+	shutdown chan struct{} // 开始关闭时关闭
+	done     chan struct{} // 第一次调用的 Shutdown 完成时关闭
+}
+
+// 调用方持有 shutdownMu
+func (server *Server) lifecycleLocked() *lifecycle {
+	if server.lifecycle == nil {
+		server.lifecycle = &lifecycle{shutdown: make(chan struct{}), done: make(chan struct{})}
+	}
+	return server.lifecycle
+}
+
+// 开始关闭时关闭的通道
+func (server *Server) ShutdownCh() <-chan struct{} {
+	server.shutdownMu.Lock()
+	defer server.shutdownMu.Unlock()
+	return server.lifecycleLocked().shutdown
+}
+
+// 关闭完成 (所有连接都已关闭 处理函数都已返回) 时关闭的通道
+func (server *Server) Done() <-chan struct{} {
+	server.shutdownMu.Lock()
+	defer server.shutdownMu.Unlock()
+	return server.lifecycleLocked().done
+}
+
+// 在 lis 上接受连接 直到收到 signals 中的任一信号 (默认为 SIGINT 与 SIGTERM) 或其他协程调用了 Shutdown
+// 之后以 DefaultClosingNotice 关闭 等待 Accept 返回与 Done 关闭
+// Accept 提前返回 (监听出错或严格启动检查失败) 时同样关闭 返回 Accept 的错误 否则返回 Shutdown 的错误
+func (server *Server) ServeUntilSignal(lis net.Listener, signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), signals...)
+	defer stop()
+	accepted := make(chan error, 1)
+	go func() { accepted <- server.Accept(lis) }()
+	var acceptErr error
+	select {
+	case <-ctx.Done():
+		log.Println("rpc server: shutting down on signal")
+	case <-server.ShutdownCh():
+	case acceptErr = <-accepted:
+		accepted <- acceptErr
+	}
+	// 恢复默认的信号处理 再次收到信号时直接退出
+	stop()
+	err := server.Shutdown(context.Background())
+	<-accepted
+	<-server.Done()
+	if acceptErr != nil {
+		return acceptErr
+	}
+	return err
+}
+
+func (c *activeConn) waitIdle(ctx context.Context) {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if _, busy := c.state.idle(time.Now()); !busy {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// 对方不支持关闭通知时直接关闭
+func (c *activeConn) notifyClosing(notice *ClosingNotice) {
+	if !c.state.features.Has(FeatureClosingNotice) {
+		_ = c.cc.Close()
+		return
+	}
+	c.sending.Lock()
+	h := &codec.Header{ServiceMethod: ClosingMethod}
+	if err := c.cc.Write(h, notice); err != nil {
+		log.Println("rpc server: write closing notice error:", err)
+	}
+	c.sending.Unlock()
+	_ = c.cc.Close()
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"gmrpc/codec"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type Napper struct{ started chan struct{} }
+
+func (s *Napper) Nap(d time.Duration, reply *bool) error {
+	s.started <- struct{}{}
+	time.Sleep(d)
+	*reply = true
+	return nil
+}
+
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestServer_ShutdownChannels(t *testing.T) {
+	s := NewServer()
+	shutdown, done := s.ShutdownCh(), s.Done()
+	_assert(!closed(shutdown) && !closed(done), "channels should be open before Shutdown")
+
+	napper := &Napper{started: make(chan struct{}, 1)}
+	_ = s.Register(napper)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.JsonType})
+	defer stop()
+	_assert(cc.Write(&codec.Header{ServiceMethod: "Napper.Nap", Seq: 1}, 50*time.Millisecond) == nil, "write failed")
+	<-napper.started
+	// 读出响应与关闭通知 管道的写入在读出前阻塞
+	go func() {
+		var h codec.Header
+		for cc.ReadHeader(&h) == nil && cc.ReadBody(nil) == nil {
+		}
+	}()
+
+	// 只持有通道的协程
+	observed := make(chan time.Time, 1)
+	go func() {
+		<-shutdown
+		observed <- time.Now()
+	}()
+
+	result := make(chan error, 1)
+	go func() { result <- s.Shutdown(context.Background()) }()
+	select {
+	case <-observed:
+	case <-time.After(time.Second):
+		t.Fatal("ShutdownCh not closed")
+	}
+	_assert(!closed(done), "Done should wait for the inflight request")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Done not closed")
+	}
+	_assert(<-result == nil, "shutdown error")
+	_assert(s.ShutdownCh() == shutdown && s.Done() == done, "channels should not change")
+
+	// 再次关闭不会重复关闭通道
+	_assert(s.Shutdown(context.Background()) == nil, "second shutdown error")
+}
+
+func TestServer_ServeUntilSignal(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(&Napper{started: make(chan struct{}, 1)})
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	result := make(chan error, 1)
+	go func() { result <- s.ServeUntilSignal(l, syscall.SIGTERM) }()
+
+	// 能建立连接时已开始接收信号
+	var conn net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if conn, err = net.Dial("tcp", l.Addr().String()); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_assert(err == nil, "dial error: %v", err)
+	_ = conn.Close()
+
+	_assert(syscall.Kill(syscall.Getpid(), syscall.SIGTERM) == nil, "kill failed")
+	select {
+	case err := <-result:
+		_assert(err == nil, "serve error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeUntilSignal did not return after SIGTERM")
+	}
+	_assert(closed(s.ShutdownCh()) && closed(s.Done()), "expect server shut down")
+	_, err = net.Dial("tcp", l.Addr().String())
+	_assert(err != nil, "listener should be closed")
+}
+
+func TestServer_ServeUntilSignalShutdown(t *testing.T) {
+	s := NewServer()
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	result := make(chan error, 1)
+	go func() { result <- s.ServeUntilSignal(l, syscall.SIGUSR1) }()
+	_assert(s.Shutdown(context.Background()) == nil, "shutdown error")
+	select {
+	case err := <-result:
+		_assert(err == nil, "serve error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeUntilSignal did not return after Shutdown")
+	}
+}
+
+// ctx 结束后连接立即关闭 处理函数返回前 Done 不关闭
+func TestServer_DoneWaitsForHandlers(t *testing.T) {
+	s := NewServer()
+	napper := &Napper{started: make(chan struct{}, 1)}
+	_ = s.Register(napper)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.JsonType})
+	defer stop()
+	_assert(cc.Write(&codec.Header{ServiceMethod: "Napper.Nap", Seq: 1}, 200*time.Millisecond) == nil, "write failed")
+	<-napper.started
+	go func() {
+		var h codec.Header
+		for cc.ReadHeader(&h) == nil && cc.ReadBody(nil) == nil {
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_assert(s.Shutdown(ctx) == context.DeadlineExceeded, "expect deadline exceeded")
+	_assert(!closed(s.Done()), "Done should wait for the running handler")
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done not closed after the handler returned")
+	}
+}
+
+// Accept 提前返回时返回其错误
+func TestServer_ServeUntilSignalAcceptError(t *testing.T) {
+	s := NewServer()
+	s.SetStrictStart(true)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	result := make(chan error, 1)
+	go func() { result <- s.ServeUntilSignal(l, syscall.SIGUSR1) }()
+	select {
+	case err := <-result:
+		_assert(err != nil && strings.Contains(err.Error(), "no services registered"), "expect the startup check error, got %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeUntilSignal did not return after Accept failed")
+	}
+	_assert(closed(s.Done()), "expect server shut down")
+}
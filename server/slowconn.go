@@ -0,0 +1,28 @@
+package server
+
+import (
+	"gmrpc/netutil"
+	"io"
+	"net"
+	"time"
+)
+
+// 单次读写超过阈值时输出警告 输出到 SetSlowLogger 设置的日志 对之后建立的连接生效 <= 0 表示不监控该方向
+// 空闲连接等待下一个请求的读取同样计时 读阈值应大于正常的请求间隔
+func (server *Server) SetSlowConnThreshold(read, write time.Duration) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.slowRead, server.slowWrite = read, write
+}
+
+// 只包装 net.Conn 设置了阈值时返回 netutil.SlowConnMonitor
+func (server *Server) monitorConn(conn io.ReadWriteCloser) io.ReadWriteCloser {
+	server.mu.RLock()
+	read, write := server.slowRead, server.slowWrite
+	server.mu.RUnlock()
+	c, ok := conn.(net.Conn)
+	if !ok || (read <= 0 && write <= 0) {
+		return conn
+	}
+	return netutil.NewSlowConnMonitor(c, read, write, server.watchdog.log())
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"gmrpc/codec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_SlowConnThreshold(t *testing.T) {
+	var foo Foo
+	s := NewServer()
+	_ = s.Register(&foo)
+	logs := new(captureLogger)
+	s.SetSlowLogger(logs)
+	s.SetSlowConnThreshold(10*time.Millisecond, 0)
+
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	defer stop()
+	// 服务端等待请求的读取超过阈值
+	time.Sleep(30 * time.Millisecond)
+	_ = cc.Write(&codec.Header{ServiceMethod: "Foo.Sum", Seq: 1}, Args{1, 2})
+	var h codec.Header
+	var reply int
+	_assert(cc.ReadHeader(&h) == nil && cc.ReadBody(&reply) == nil && reply == 3, "call failed")
+
+	var slow []string
+	for _, msg := range logs.messages() {
+		if strings.Contains(msg, "slow read") {
+			slow = append(slow, msg)
+		}
+	}
+	_assert(len(slow) > 0, "expect slow read warning, got %q", logs.messages())
+}
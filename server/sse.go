@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+/*
+以 server-sent events 向浏览器推送流式结果 浏览器使用 EventSource 订阅
+	GET <path>?method=Clock.Tick&args=<json 编码的参数>   Accept: text/event-stream
+每次订阅是服务端内部的一个连接 与普通连接一样经过拦截器 鉴权 限流与超时 请求头 Authorization 作为元数据 authorization 传递
+方法的结果需为流式结果 (*codec.StreamingArg) 数据按行分隔 每行作为一个事件 "data: <行>\n\n" 通常每行是一个 json 值
+流结束时发送 "event: end" 读取失败 (如行过长) 时发送 "event: error" 数据为 json 编码的 rpcerr.RPCError 之后关闭连接
+订阅开始前的错误 (方法不存在 参数错误 鉴权失败 限流) 以 HTTP 状态码与 json 编码的 rpcerr.RPCError 返回
+EventSource 在连接关闭后会自动重连 浏览器应在收到 end 或 error 事件后调用 close
+浏览器断开时关闭内部连接 处理函数的 ctx 随之取消 流式结果被关闭
+*/
+
+const (
+	SSEContentType = "text/event-stream"
+	SSEEventEnd    = "end"
+	SSEEventError  = "error"
+)
+
+// 单个事件 (一行) 的长度上限
+const sseMaxLine = 1 << 20
+
+// 例如 http.Handle("/events", s.SSEHandler())
+func (server *Server) SSEHandler() http.Handler {
+	return http.HandlerFunc(server.serveSSE)
+}
+
+func (server *Server) serveSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeSSEError(w, rpcerr.New(rpcerr.InvalidArgs, "rpc server: sse must GET"), http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Accept"), SSEContentType) {
+		writeSSEError(w, rpcerr.New(rpcerr.InvalidArgs, "rpc server: Accept must include "+SSEContentType), http.StatusNotAcceptable)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeSSEError(w, rpcerr.New(rpcerr.Internal, "rpc server: streaming unsupported"), 0)
+		return
+	}
+	args := json.RawMessage(r.URL.Query().Get("args"))
+	if len(args) == 0 {
+		args = json.RawMessage("null")
+	}
+	if !json.Valid(args) {
+		writeSSEError(w, rpcerr.New(rpcerr.InvalidArgs, "rpc server: sse args is not valid json"), 0)
+		return
+	}
+
+	cliConn, srvConn := net.Pipe()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		server.ServeConn(&sseConn{Conn: srvConn, remote: sseAddr(r.RemoteAddr)})
+	}()
+	defer func() {
+		_ = cliConn.Close()
+		<-served
+	}()
+	stop := context.AfterFunc(r.Context(), func() { _ = cliConn.Close() })
+	defer stop()
+
+	cc, err := sseRequest(cliConn, r, args)
+	if err != nil {
+		writeSSEError(w, err, 0)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", SSEContentType)
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sr := codec.NewStreamReader(cc)
+	defer func() { _ = sr.Close() }()
+	lines := bufio.NewScanner(sr)
+	lines.Buffer(nil, sseMaxLine)
+	for lines.Scan() {
+		if len(lines.Bytes()) == 0 {
+			continue
+		}
+		if _, err := io.WriteString(w, "data: "+lines.Text()+"\n\n"); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+	if r.Context().Err() != nil {
+		return
+	}
+	event, data := SSEEventEnd, []byte("{}")
+	if err := lines.Err(); err != nil {
+		event = SSEEventError
+		data, _ = json.Marshal(rpcerr.Errorf(rpcerr.Internal, "rpc server: sse read stream: %v", err))
+	}
+	_, _ = io.WriteString(w, "event: "+event+"\ndata: "+string(data)+"\n\n")
+	flusher.Flush()
+}
+
+// 在内部连接上握手并发送请求 读到流式响应头后返回编解码器
+func sseRequest(conn net.Conn, r *http.Request, args json.RawMessage) (codec.Codec, error) {
+	opt := Option{
+		MagicNumber:     MagicNumber,
+		CodecType:       codec.JsonType,
+		ProtocolVersion: ProtocolVersion,
+		Features:        FeatureMetadata | FeatureStreaming,
+	}
+	// net.Pipe 没有缓冲 握手与请求在另一个协程中写入
+	written := make(chan error, 1)
+	br := bufio.NewReader(conn)
+	cc := codec.NewJsonCodec(&bufConn{r: br, ReadWriteCloser: conn})
+	go func() {
+		if err := json.NewEncoder(conn).Encode(&opt); err != nil {
+			written <- err
+			return
+		}
+		h := &codec.Header{ServiceMethod: r.URL.Query().Get("method"), Seq: 1}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			h.Metadata = map[string]string{"authorization": auth}
+		}
+		written <- cc.Write(h, args)
+	}()
+	var ack ProtocolAck
+	line, err := br.ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &ack)
+	}
+	if err == nil {
+		err = <-written
+	}
+	if err != nil {
+		return nil, rpcerr.Errorf(rpcerr.Internal, "rpc server: sse handshake: %v", err)
+	}
+
+	var h codec.Header
+	if err := cc.ReadHeader(&h); err != nil {
+		return nil, rpcerr.Errorf(rpcerr.Internal, "rpc server: sse read response: %v", err)
+	}
+	if codec.IsStream(&h) {
+		return cc, nil
+	}
+	_ = cc.ReadBody(nil)
+	if h.Status != nil {
+		return nil, h.Status
+	}
+	if h.Error != "" {
+		return nil, rpcerr.New(rpcerr.Unknown, h.Error)
+	}
+	return nil, rpcerr.New(rpcerr.InvalidArgs, "rpc server: "+h.ServiceMethod+" does not return a stream")
+}
+
+// status 为 0 时按错误码选择
+func writeSSEError(w http.ResponseWriter, err error, status int) {
+	e, ok := rpcerr.FromError(err)
+	if !ok {
+		e = rpcerr.New(rpcerr.Unknown, err.Error())
+	}
+	if status == 0 {
+		status = sseStatus(e.Code)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(e)
+}
+
+func sseStatus(code rpcerr.Code) int {
+	switch code {
+	case rpcerr.InvalidArgs:
+		return http.StatusBadRequest
+	case rpcerr.NotFound:
+		return http.StatusNotFound
+	case rpcerr.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case rpcerr.Overloaded, rpcerr.ResourceExhausted:
+		return http.StatusServiceUnavailable
+	case rpcerr.PermissionDenied:
+		return http.StatusForbidden
+	case rpcerr.Unauthenticated:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// 内部连接的对端为浏览器的地址
+type sseConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *sseConn) RemoteAddr() net.Addr { return c.remote }
+
+type sseAddr string
+
+func (a sseAddr) Network() string { return "tcp" }
+func (a sseAddr) String() string  { return string(a) }
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"gmrpc/codec"
+	"gmrpc/metadata"
+	"gmrpc/rpcerr"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type Echo struct{}
+
+// 每行一个 json 值
+func (Echo) Repeat(args *struct{ Word string }, reply *codec.StreamingArg) error {
+	var b strings.Builder
+	for i := 0; i < 2; i++ {
+		data, _ := json.Marshal(args.Word)
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	reply.Reader = io.NopCloser(strings.NewReader(b.String()))
+	return nil
+}
+
+func sseGet(t *testing.T, u, accept, auth string) (*http.Response, string) {
+	req, _ := http.NewRequest(http.MethodGet, u, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	_assert(err == nil, "request error: %v", err)
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestServer_SSEHandler(t *testing.T) {
+	var foo Foo
+	s := NewServer()
+	_ = s.Register(Echo{})
+	_ = s.Register(&foo)
+	// 订阅与普通请求一样经过拦截器
+	s.Use(func(ctx context.Context, info *MethodInfo, argv, replyv interface{}, handler UnaryHandler) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if md.Get("authorization") != "Bearer ok" {
+			return rpcerr.New(rpcerr.Unauthenticated, "missing token")
+		}
+		return handler(ctx, argv, replyv)
+	})
+	hs := httptest.NewServer(s.SSEHandler())
+	defer hs.Close()
+
+	u := hs.URL + "?method=Echo.Repeat&args=" + url.QueryEscape(`{"Word":"hi"}`)
+	resp, body := sseGet(t, u, SSEContentType, "Bearer ok")
+	_assert(resp.StatusCode == http.StatusOK && resp.Header.Get("Content-Type") == SSEContentType,
+		"unexpected response %s %q", resp.Status, resp.Header.Get("Content-Type"))
+	want := "data: \"hi\"\n\ndata: \"hi\"\n\nevent: end\ndata: {}\n\n"
+	_assert(body == want, "unexpected body %q", body)
+
+	for _, tc := range []struct {
+		url, accept, auth string
+		status            int
+	}{
+		{u, "application/json", "Bearer ok", http.StatusNotAcceptable},
+		{u, SSEContentType, "", http.StatusUnauthorized},
+		{hs.URL + "?method=Echo.Repeat&args=%7B", SSEContentType, "Bearer ok", http.StatusBadRequest},
+		{hs.URL + "?method=Echo.Missing", SSEContentType, "Bearer ok", http.StatusNotFound},
+		// 不返回流的方法
+		{hs.URL + "?method=Foo.Sum&args=" + url.QueryEscape(`{"Num1":1}`), SSEContentType, "Bearer ok", http.StatusBadRequest},
+	} {
+		resp, body := sseGet(t, tc.url, tc.accept, tc.auth)
+		var e rpcerr.RPCError
+		_assert(resp.StatusCode == tc.status && json.Unmarshal([]byte(body), &e) == nil && e.Message != "",
+			"%s: expect %d with an RPCError, got %s %s", tc.url, tc.status, resp.Status, body)
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"gmrpc/rpcerr"
+	"sync"
+)
+
+/*
+热备 备用状态的服务端正常接受连接与读取请求 但不处理 请求放入内存队列 Promote 后按到达顺序分发
+排队的请求已计入内存预算 准入检查 (限流 并发上限) 与处理超时在提升后才开始
+队列的长度有上限 (Config.StandbyQueueLimit) 队列已满时直接回复 Overloaded
+排队的请求登记在连接上 可以被 _cancel 取消 (立即回复 context.Canceled 并移出队列) 空闲超时与 Shutdown 视其为进行中
+Promote 分发完队列后才退出备用状态 分发期间新读取的请求仍然排队 不会越过先到的请求 (流水线请求的顺序因此保持不变)
+连接在提升前关闭时丢弃它排队的请求 流式参数必须读完才能读取下一个请求 备用时直接拒绝
+*/
+
+// Config.StandbyQueueLimit 为 0 时的队列长度上限
+const DefaultStandbyQueueLimit = 1024
+
+var (
+	errStandbyStream    = rpcerr.New(rpcerr.Overloaded, "rpc server: standby server does not accept streaming requests")
+	errStandbyQueueFull = rpcerr.New(rpcerr.Overloaded, "rpc server: standby queue is full")
+)
+
+type queuedRequest struct {
+	req      *request
+	wg       *sync.WaitGroup // 所在连接的处理协程计数 排队期间占用一个
+	dispatch func()
+	reject   func(err error) // 回复错误并释放请求占用的资源
+	stop     func() bool     // 停止监听 _cancel
+}
+
+// 设置为 true 时之后读取的请求进入队列 设置为 false 与 Promote 相同
+func (server *Server) SetStandby(standbyMode bool) {
+	if !standbyMode {
+		server.Promote()
+		return
+	}
+	server.standbyMu.Lock()
+	defer server.standbyMu.Unlock()
+	server.standby = true
+}
+
+// 设置排队请求数的上限 n <= 0 表示使用 DefaultStandbyQueueLimit
+func (server *Server) SetStandbyQueueLimit(n int) {
+	server.UpdateConfig(func(c *Config) {
+		c.StandbyQueueLimit = n
+	})
+}
+
+// 退出备用状态 按到达顺序分发排队的请求 队列清空后返回
+func (server *Server) Promote() {
+	server.promoteMu.Lock()
+	defer server.promoteMu.Unlock()
+	for {
+		server.standbyMu.Lock()
+		queue := server.standbyQueue
+		server.standbyQueue = nil
+		if len(queue) == 0 {
+			server.standby = false
+			server.standbyMu.Unlock()
+			return
+		}
+		server.standbyMu.Unlock()
+		for _, q := range queue {
+			q.stop()
+			q.dispatch()
+			q.wg.Done()
+		}
+	}
+}
+
+// 排队等待提升的请求数
+func (server *Server) QueuedRequestCount() int {
+	server.standbyMu.Lock()
+	defer server.standbyMu.Unlock()
+	return len(server.standbyQueue)
+}
+
+func (server *Server) isStandby() bool {
+	server.standbyMu.Lock()
+	defer server.standbyMu.Unlock()
+	return server.standby
+}
+
+// 备用状态时放入队列或因队列已满拒绝 返回 false 表示需要立即处理
+func (server *Server) queueIfStandby(req *request, wg *sync.WaitGroup, dispatch func(), reject func(err error)) bool {
+	server.standbyMu.Lock()
+	if !server.standby {
+		server.standbyMu.Unlock()
+		return false
+	}
+	limit := server.loadConfig().StandbyQueueLimit
+	if limit <= 0 {
+		limit = DefaultStandbyQueueLimit
+	}
+	if len(server.standbyQueue) >= limit {
+		server.standbyMu.Unlock()
+		reject(errStandbyQueueFull)
+		return true
+	}
+	if req.ctx == nil {
+		req.ctx, req.done = req.conn.track(req.h.Seq)
+	}
+	q := &queuedRequest{req: req, wg: wg, dispatch: dispatch, reject: reject}
+	// 移出队列的一方负责这个请求 Promote 与 dropQueued 取走后不再回复取消
+	q.stop = context.AfterFunc(req.ctx, func() {
+		if server.unqueue(q) {
+			q.reject(context.Canceled)
+			q.wg.Done()
+		}
+	})
+	wg.Add(1)
+	server.standbyQueue = append(server.standbyQueue, q)
+	server.standbyMu.Unlock()
+	return true
+}
+
+// 从队列中移除 返回 false 表示已被取走
+func (server *Server) unqueue(q *queuedRequest) bool {
+	server.standbyMu.Lock()
+	defer server.standbyMu.Unlock()
+	for i, other := range server.standbyQueue {
+		if other == q {
+			last := len(server.standbyQueue) - 1
+			copy(server.standbyQueue[i:], server.standbyQueue[i+1:])
+			server.standbyQueue[last] = nil
+			server.standbyQueue = server.standbyQueue[:last]
+			return true
+		}
+	}
+	return false
+}
+
+// 连接关闭时丢弃它排队的请求 释放内存预算
+func (server *Server) dropQueued(conn *connState) {
+	server.standbyMu.Lock()
+	var dropped []*queuedRequest
+	kept := server.standbyQueue[:0]
+	for _, q := range server.standbyQueue {
+		if q.req.conn == conn {
+			dropped = append(dropped, q)
+		} else {
+			kept = append(kept, q)
+		}
+	}
+	for i := len(kept); i < len(server.standbyQueue); i++ {
+		server.standbyQueue[i] = nil
+	}
+	server.standbyQueue = kept
+	server.standbyMu.Unlock()
+	for _, q := range dropped {
+		q.stop()
+		q.req.untrack()
+		q.req.freeMem()
+		q.wg.Done()
+	}
+}
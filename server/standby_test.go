@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Counter struct{ calls int32 }
+
+func (c *Counter) Add(n int, reply *int) error {
+	atomic.AddInt32(&c.calls, 1)
+	*reply = n
+	return nil
+}
+
+func waitQueued(s *Server, want int) bool {
+	deadline := time.Now().Add(time.Second)
+	for s.QueuedRequestCount() != want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return s.QueuedRequestCount() == want
+}
+
+func TestServer_StandbyPromote(t *testing.T) {
+	c := new(Counter)
+	s := NewServer()
+	_ = s.Register(c)
+	s.SetStandby(true)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	defer stop()
+
+	const n = 3
+	for seq := uint64(1); seq <= n; seq++ {
+		_assert(cc.Write(&codec.Header{ServiceMethod: "Counter.Add", Seq: seq}, int(seq)*10) == nil, "write failed")
+	}
+	_assert(waitQueued(s, n), "expect %d queued requests, got %d", n, s.QueuedRequestCount())
+	time.Sleep(20 * time.Millisecond)
+	_assert(atomic.LoadInt32(&c.calls) == 0, "standby server handled %d requests", c.calls)
+
+	s.Promote()
+	_assert(s.QueuedRequestCount() == 0, "queue not drained")
+	got := make(map[uint64]int)
+	for i := 0; i < n; i++ {
+		var h codec.Header
+		var reply int
+		_assert(cc.ReadHeader(&h) == nil && h.Error == "", "unexpected header %+v", h)
+		_assert(cc.ReadBody(&reply) == nil, "read body failed")
+		got[h.Seq] = reply
+	}
+	for seq := uint64(1); seq <= n; seq++ {
+		_assert(got[seq] == int(seq)*10, "seq %d: got %d", seq, got[seq])
+	}
+
+	// 提升后直接处理
+	_assert(cc.Write(&codec.Header{ServiceMethod: "Counter.Add", Seq: 9}, 1) == nil, "write failed")
+	var h codec.Header
+	var reply int
+	_assert(cc.ReadHeader(&h) == nil && h.Seq == 9 && cc.ReadBody(&reply) == nil && reply == 1, "unexpected reply %+v %d", h, reply)
+}
+
+// 连接在提升前关闭 排队的请求被丢弃 内存预算被释放
+func TestServer_StandbyConnClosed(t *testing.T) {
+	c := new(Counter)
+	s := NewServer()
+	_ = s.Register(c)
+	s.SetMemoryBudget(1<<20, 0)
+	s.SetStandby(true)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	for seq := uint64(1); seq <= 2; seq++ {
+		_assert(cc.Write(&codec.Header{ServiceMethod: "Counter.Add", Seq: seq}, 1) == nil, "write failed")
+	}
+	_assert(waitQueued(s, 2), "expect 2 queued requests, got %d", s.QueuedRequestCount())
+	_assert(s.MemoryInUse() > 0, "queued requests should hold memory")
+
+	stop()
+	_assert(s.QueuedRequestCount() == 0 && s.MemoryInUse() == 0, "queue %d, memory %d after close", s.QueuedRequestCount(), s.MemoryInUse())
+	s.Promote()
+	_assert(atomic.LoadInt32(&c.calls) == 0, "dropped requests were handled")
+}
+
+// 队列已满时直接回复 Overloaded 排队的请求可以被 _cancel 取消
+func TestServer_StandbyQueueLimit(t *testing.T) {
+	c := new(Counter)
+	s := NewServer()
+	_ = s.Register(c)
+	s.SetStandbyQueueLimit(2)
+	s.SetStandby(true)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	defer stop()
+
+	for seq := uint64(1); seq <= 3; seq++ {
+		_assert(cc.Write(&codec.Header{ServiceMethod: "Counter.Add", Seq: seq}, int(seq)) == nil, "write failed")
+	}
+	var h codec.Header
+	_assert(cc.ReadHeader(&h) == nil && h.Seq == 3 && h.Status != nil && h.Status.Code == rpcerr.Overloaded, "expect overloaded, got %+v", h)
+	_ = cc.ReadBody(nil)
+	_assert(s.QueuedRequestCount() == 2, "expect 2 queued requests, got %d", s.QueuedRequestCount())
+
+	_assert(cc.Write(&codec.Header{ServiceMethod: CancelMethod, Seq: 4}, uint64(1)) == nil, "write cancel failed")
+	got := make(map[uint64]string)
+	for i := 0; i < 2; i++ {
+		h = codec.Header{}
+		_assert(cc.ReadHeader(&h) == nil, "read header failed")
+		_ = cc.ReadBody(nil)
+		got[h.Seq] = h.Error
+	}
+	_assert(got[4] == "" && got[1] == context.Canceled.Error(), "expect the queued request canceled, got %q", got)
+	_assert(s.QueuedRequestCount() == 1, "canceled request should leave the queue, got %d", s.QueuedRequestCount())
+
+	s.Promote()
+	var reply int
+	h = codec.Header{}
+	_assert(cc.ReadHeader(&h) == nil && h.Seq == 2 && cc.ReadBody(&reply) == nil && reply == 2, "unexpected reply %+v %d", h, reply)
+	_assert(atomic.LoadInt32(&c.calls) == 1, "expect only the remaining request handled, got %d", c.calls)
+}
+
+// 提升期间新读取的请求排在队列之后 流水线请求按到达顺序处理
+func TestServer_StandbyPromoteOrder(t *testing.T) {
+	s := NewServer()
+	_ = s.Register(new(Counter))
+	var mu sync.Mutex
+	var order []int
+	s.Use(func(ctx context.Context, info *MethodInfo, argv, replyv interface{}, handler UnaryHandler) error {
+		mu.Lock()
+		order = append(order, argv.(int))
+		mu.Unlock()
+		return handler(ctx, argv, replyv)
+	})
+	s.SetStandby(true)
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType, Features: FeatureMetadata})
+	defer stop()
+
+	const queued, n = 100, 150
+	write := func(i int) error {
+		h := &codec.Header{ServiceMethod: "Counter.Add", Seq: uint64(i), Metadata: map[string]string{PipelineMetadataKey: "1"}}
+		return cc.Write(h, i)
+	}
+	for i := 1; i <= queued; i++ {
+		_assert(write(i) == nil, "write failed")
+	}
+	_assert(waitQueued(s, queued), "expect %d queued requests, got %d", queued, s.QueuedRequestCount())
+	go s.Promote()
+	written := make(chan error, 1)
+	go func() {
+		for i := queued + 1; i <= n; i++ {
+			if err := write(i); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- nil
+	}()
+	for i := 1; i <= n; i++ {
+		var h codec.Header
+		_assert(cc.ReadHeader(&h) == nil && h.Error == "" && cc.ReadBody(nil) == nil, "unexpected reply %+v", h)
+	}
+	_assert(<-written == nil, "write failed")
+	mu.Lock()
+	defer mu.Unlock()
+	for i, v := range order {
+		_assert(v == i+1, "expect arrival order, got %v", order)
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"gmrpc/service"
+	"log"
+	"net"
+	"sort"
+	"time"
+)
+
+/*
+启动自检 配置与注册上的错误 (没有注册服务 超时之间互相矛盾 证书过期) 往往到了线上才暴露
+Validate 依次执行内置检查与 AddCheck 添加的检查 汇总所有问题 每个问题一行 以检查名开头
+SetStrictStart(true) 后 Accept 先调用 Validate 失败时输出日志并关闭监听 不接受连接 Accept 返回检查的错误
+*/
+
+// 一项检查 有多个问题时以 errors.Join 返回
+type StartupCheck func(server *Server) error
+
+type namedCheck struct {
+	name  string
+	check StartupCheck
+}
+
+// 内置检查 按顺序执行
+var defaultChecks = []namedCheck{
+	{"services", checkServices},
+	{"client timeouts", checkClientTimeouts},
+	{"validators", checkValidators},
+	{"timeouts", checkTimeouts},
+}
+
+// 添加检查 在内置检查之后按添加顺序执行
+func (server *Server) AddCheck(name string, check StartupCheck) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.checks = append(server.checks, namedCheck{name, check})
+}
+
+// 为 true 时 Accept 在 Validate 失败时不接受连接
+func (server *Server) SetStrictStart(on bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.strictStart = on
+}
+
+// 执行所有检查 返回以 errors.Join 汇总的问题 没有问题时返回 nil
+func (server *Server) Validate() error {
+	server.mu.RLock()
+	checks := append(defaultChecks[:len(defaultChecks):len(defaultChecks)], server.checks...)
+	server.mu.RUnlock()
+	var errs []error
+	for _, c := range checks {
+		err := c.check(server)
+		if err == nil {
+			continue
+		}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range joined.Unwrap() {
+				errs = append(errs, fmt.Errorf("%s: %w", c.name, e))
+			}
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+	}
+	return errors.Join(errs...)
+}
+
+// 严格启动时返回检查发现的问题
+func (server *Server) strictCheck(lis net.Listener) error {
+	server.mu.RLock()
+	strict := server.strictStart
+	server.mu.RUnlock()
+	if !strict {
+		return nil
+	}
+	if err := server.Validate(); err != nil {
+		log.Printf("rpc server: refusing to serve on %s:\n%v\n", lis.Addr(), err)
+		return fmt.Errorf("rpc server: startup check failed: %w", err)
+	}
+	return nil
+}
+
+// 用户服务 包括按版本登记的视图 按名称排序
+func (server *Server) userServices() []*service.Service {
+	var svcs []*service.Service
+	server.serviceMap.Range(func(_, v interface{}) bool {
+		svcs = append(svcs, v.(*service.Service))
+		return true
+	})
+	sort.Slice(svcs, func(i, j int) bool { return svcs[i].Name < svcs[j].Name })
+	return svcs
+}
+
+// 至少注册了一个服务 每个服务至少有一个可调用的方法
+func checkServices(server *Server) error {
+	svcs := server.userServices()
+	if len(svcs) == 0 {
+		return errors.New("no services registered")
+	}
+	var errs []error
+	for _, s := range svcs {
+		if len(s.Method) == 0 {
+			errs = append(errs, fmt.Errorf("service %s has no exported methods of the form M(args, *reply) error", s.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 处理超时长于客户端默认的 ConnectTimeout 时 以它限制调用的客户端 (能力与结构查询) 先放弃 服务端仍在处理
+func checkClientTimeouts(server *Server) error {
+	c := server.Config()
+	if connect := DefaultOption.ConnectTimeout; c.HandleTimeout > 0 && connect > 0 && c.HandleTimeout > connect {
+		return fmt.Errorf("HandleTimeout %s exceeds the client ConnectTimeout %s, clients give up before the server times out", c.HandleTimeout, connect)
+	}
+	return nil
+}
+
+// 参数校验函数对应的方法已注册
+func checkValidators(server *Server) error {
+	var methods []string
+	server.validators.Range(func(k, _ interface{}) bool {
+		methods = append(methods, k.(string))
+		return true
+	})
+	sort.Strings(methods)
+	var errs []error
+	for _, m := range methods {
+		if _, _, err := server.findService(m); err != nil {
+			errs = append(errs, fmt.Errorf("validator registered for unknown method %s", m))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 慢请求阈值与内存等待不短于处理超时时不会生效
+func checkTimeouts(server *Server) error {
+	c := server.Config()
+	if c.HandleTimeout <= 0 {
+		return nil
+	}
+	var errs []error
+	if c.SlowThreshold >= c.HandleTimeout {
+		errs = append(errs, fmt.Errorf("SlowThreshold %s is not shorter than HandleTimeout %s, slow requests time out before they are reported", c.SlowThreshold, c.HandleTimeout))
+	}
+	if c.MemoryBudget > 0 && c.MemoryWait >= c.HandleTimeout {
+		errs = append(errs, fmt.Errorf("MemoryWait %s is not shorter than HandleTimeout %s", c.MemoryWait, c.HandleTimeout))
+	}
+	return errors.Join(errs...)
+}
+
+// 检查证书是否在有效期内 在 within 内过期时同样报告 用于 AddCheck
+func CertificateCheck(within time.Duration, certs ...tls.Certificate) StartupCheck {
+	return func(*Server) error {
+		now := time.Now()
+		var errs []error
+		for i, cert := range certs {
+			leaf := cert.Leaf
+			if leaf == nil && len(cert.Certificate) > 0 {
+				var err error
+				if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+					errs = append(errs, fmt.Errorf("certificate %d: %w", i, err))
+					continue
+				}
+			}
+			if leaf == nil {
+				errs = append(errs, fmt.Errorf("certificate %d is empty", i))
+				continue
+			}
+			switch {
+			case now.Before(leaf.NotBefore):
+				errs = append(errs, fmt.Errorf("certificate %q is not valid before %s", leaf.Subject.CommonName, leaf.NotBefore.Format(time.RFC3339)))
+			case now.After(leaf.NotAfter):
+				errs = append(errs, fmt.Errorf("certificate %q expired at %s", leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339)))
+			case now.Add(within).After(leaf.NotAfter):
+				errs = append(errs, fmt.Errorf("certificate %q expires at %s", leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339)))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Empty struct{}
+
+// 自签名证书 有效期为 [notBefore, notAfter]
+func selfSigned(t *testing.T, name string, notBefore, notAfter time.Time) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_assert(err == nil, "generate key: %v", err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	_assert(err == nil, "create certificate: %v", err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestServer_Validate(t *testing.T) {
+	t.Run("no services", func(t *testing.T) {
+		err := NewServer().Validate()
+		_assert(err != nil && err.Error() == "services: no services registered", "unexpected error %v", err)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		s := NewServer()
+		_ = s.RegisterName("Math", new(countingMath))
+		s.RegisterMethodValidator("Math.Add", func(interface{}) error { return nil })
+		s.UpdateConfig(func(c *Config) {
+			c.HandleTimeout = time.Second
+			c.SlowThreshold = 100 * time.Millisecond
+		})
+		now := time.Now()
+		s.AddCheck("tls", CertificateCheck(time.Hour, selfSigned(t, "ok", now.Add(-time.Hour), now.Add(24*time.Hour))))
+		_assert(s.Validate() == nil, "expect valid, got %v", s.Validate())
+	})
+
+	t.Run("aggregated", func(t *testing.T) {
+		s := NewServer()
+		_ = s.RegisterName("Math", new(countingMath))
+		_ = s.Register(new(Empty))
+		s.RegisterMethodValidator("Math.Sub", func(interface{}) error { return nil })
+		s.UpdateConfig(func(c *Config) {
+			c.HandleTimeout = time.Second
+			c.SlowThreshold = 2 * time.Second
+			c.MemoryBudget = 1 << 20
+			c.MemoryWait = time.Second
+		})
+		now := time.Now()
+		s.AddCheck("tls", CertificateCheck(0,
+			selfSigned(t, "old", now.Add(-48*time.Hour), now.Add(-time.Hour)),
+			selfSigned(t, "soon", now.Add(-time.Hour), now.Add(time.Minute))))
+		s.AddCheck("tls renewal", CertificateCheck(time.Hour, selfSigned(t, "soon", now.Add(-time.Hour), now.Add(time.Minute))))
+		custom := errors.New("database unreachable")
+		s.AddCheck("database", func(*Server) error { return custom })
+
+		err := s.Validate()
+		_assert(err != nil, "expect errors")
+		lines := strings.Split(err.Error(), "\n")
+		want := []string{
+			"services: service Empty has no exported methods",
+			"validators: validator registered for unknown method Math.Sub",
+			"timeouts: SlowThreshold 2s is not shorter than HandleTimeout 1s",
+			"timeouts: MemoryWait 1s is not shorter than HandleTimeout 1s",
+			`tls: certificate "old" expired at`,
+			`tls renewal: certificate "soon" expires at`,
+			"database: database unreachable",
+		}
+		_assert(len(lines) == len(want), "expect %d problems, got %d:\n%v", len(want), len(lines), err)
+		for i, w := range want {
+			_assert(strings.HasPrefix(lines[i], w), "line %d: expect prefix %q, got %q", i, w, lines[i])
+		}
+		_assert(errors.Is(err, custom), "expect custom error to be wrapped")
+	})
+
+	t.Run("client timeouts", func(t *testing.T) {
+		s := NewServer()
+		_ = s.RegisterName("Math", new(countingMath))
+		s.UpdateConfig(func(c *Config) { c.HandleTimeout = DefaultOption.ConnectTimeout + time.Second })
+		err := s.Validate()
+		_assert(err != nil && strings.HasPrefix(err.Error(), "client timeouts: HandleTimeout 11s exceeds the client ConnectTimeout 10s"), "unexpected error %v", err)
+	})
+
+	t.Run("strict start", func(t *testing.T) {
+		s := NewServer()
+		s.SetStrictStart(true)
+		l, _ := net.Listen("tcp", "127.0.0.1:0")
+		done := make(chan error, 1)
+		go func() { done <- s.Accept(l) }()
+		select {
+		case err := <-done:
+			_assert(err != nil && strings.Contains(err.Error(), "no services registered"), "expect the validation error, got %v", err)
+		case <-time.After(time.Second):
+			t.Fatal("Accept should return when validation fails")
+		}
+		_, err := net.Dial("tcp", l.Addr().String())
+		_assert(err != nil, "listener should be closed")
+
+		// 修正后正常接受连接
+		_ = s.RegisterName("Math", new(countingMath))
+		l, _ = net.Listen("tcp", "127.0.0.1:0")
+		defer func() { _ = l.Close() }()
+		go s.Accept(l)
+		conn, err := net.Dial("tcp", l.Addr().String())
+		_assert(err == nil, "dial error: %v", err)
+		_ = conn.Close()
+	})
+}
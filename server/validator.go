@@ -0,0 +1,34 @@
+package server
+
+import (
+	"gmrpc/rpcerr"
+)
+
+// 方法级别的参数校验 在读取参数后 调用处理函数前执行
+// args 与处理函数收到的参数相同 返回错误时不调用处理函数
+type MethodValidator func(args interface{}) error
+
+// 为 Service.Method 注册校验函数 已存在时替换 fn 为空时删除
+func (server *Server) RegisterMethodValidator(serviceMethod string, fn func(args interface{}) error) {
+	if fn == nil {
+		server.validators.Delete(serviceMethod)
+		return
+	}
+	server.validators.Store(serviceMethod, MethodValidator(fn))
+}
+
+// 校验失败时返回 InvalidArgs 校验函数返回的结构化错误原样返回
+func (server *Server) validateArgs(serviceMethod string, args interface{}) error {
+	v, ok := server.validators.Load(serviceMethod)
+	if !ok {
+		return nil
+	}
+	err := v.(MethodValidator)(args)
+	if err == nil {
+		return nil
+	}
+	if _, ok := rpcerr.FromError(err); ok {
+		return err
+	}
+	return rpcerr.New(rpcerr.InvalidArgs, "rpc server: invalid args for "+serviceMethod+": "+err.Error())
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type countingMath struct{ calls int32 }
+
+func (m *countingMath) Add(args Args, reply *int) error {
+	atomic.AddInt32(&m.calls, 1)
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func TestServer_MethodValidator(t *testing.T) {
+	var m countingMath
+	s := NewServer()
+	_ = s.RegisterName("Math", &m)
+	s.RegisterMethodValidator("Math.Add", func(args interface{}) error {
+		a := args.(Args)
+		if a.Num1 < 0 || a.Num2 < 0 {
+			return errors.New("numbers must not be negative")
+		}
+		return nil
+	})
+
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.JsonType})
+	defer stop()
+	call := func(seq uint64, args Args) (codec.Header, int) {
+		_assert(cc.Write(&codec.Header{ServiceMethod: "Math.Add", Seq: seq}, args) == nil, "write failed")
+		var h codec.Header
+		var reply int
+		_assert(cc.ReadHeader(&h) == nil && h.Seq == seq, "unexpected header %+v", h)
+		_ = cc.ReadBody(&reply)
+		return h, reply
+	}
+
+	h, reply := call(1, Args{Num1: 1, Num2: 2})
+	_assert(h.Error == "" && reply == 3, "valid args should pass: %+v %d", h, reply)
+
+	h, _ = call(2, Args{Num1: -1, Num2: 2})
+	_assert(h.Status != nil && h.Status.Code == rpcerr.InvalidArgs && strings.Contains(h.Error, "Math.Add: numbers must not be negative"), "expect InvalidArgs, got %+v", h)
+	_assert(atomic.LoadInt32(&m.calls) == 1, "handler should not run for rejected args, calls %d", m.calls)
+
+	// 结构化错误原样返回 删除后不再校验
+	s.RegisterMethodValidator("Math.Add", func(interface{}) error { return rpcerr.New(rpcerr.PermissionDenied, "nope") })
+	h, _ = call(3, Args{})
+	_assert(h.Status != nil && h.Status.Code == rpcerr.PermissionDenied && h.Error == "nope", "expect validator status, got %+v", h)
+	s.RegisterMethodValidator("Math.Add", nil)
+	h, reply = call(4, Args{Num1: -1, Num2: -2})
+	_assert(h.Error == "" && reply == -3, "validator should be removed: %+v", h)
+}
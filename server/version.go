@@ -0,0 +1,53 @@
+package server
+
+import (
+	"errors"
+	"gmrpc/service"
+	"log"
+	"reflect"
+	"strings"
+)
+
+/*
+方法级的版本 客户端以 Math.Add@2 调用版本 2 的 Add 不带版本的调用不受影响
+版本 N 的方法登记为 serviceMap 中的服务 Math@N 有两种方式
+	方法的文档注释中标注 @version N 见 service/version.go 注册服务时一并登记
+	Server.RegisterVersion(&MathV2{}, 2) 把另一个类型的所有方法登记为版本 2
+*/
+
+// 把 rcvr 的所有方法登记为版本 version 服务名为类型名去掉 V<version> 后缀 如 MathV2 登记为 Math@2
+// 方法上的 @version 标注被忽略 同名的版本已经存在时返回错误
+func (server *Server) RegisterVersion(rcvr interface{}, version uint8) error {
+	if version == 0 {
+		return errors.New("rpc: version must be at least 1")
+	}
+	name := reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name()
+	versioned := service.VersionedName(name, version)
+	if err := validateServiceName(versioned[:strings.LastIndex(versioned, service.VersionSep)]); err != nil {
+		return err
+	}
+	s := service.NewNamedService(rcvr, versioned)
+	for _, mt := range s.Method {
+		mt.Version = version
+	}
+	return server.register(s, ServiceOptions{})
+}
+
+// 标注了版本的方法组成的服务 已登记的版本 (如 Math@2) 本身不再拆分
+func (server *Server) versionViews(s *service.Service) ([]*service.Service, error) {
+	if strings.Contains(s.Name, service.VersionSep) {
+		return nil, nil
+	}
+	var views []*service.Service
+	for _, version := range s.Versions() {
+		v := s.VersionService(version)
+		if _, ok := server.serviceMap.Load(v.Name); ok {
+			return nil, errors.New("rpc: service already defined: " + v.Name)
+		}
+		for name := range v.Method {
+			log.Printf("rpc server: register %s.%s\n", v.Name, name)
+		}
+		views = append(views, v)
+	}
+	return views, nil
+}
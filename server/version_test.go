@@ -0,0 +1,68 @@
+package server
+
+import (
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"testing"
+)
+
+type Adder int
+
+// Add 第一版
+func (a Adder) Add(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// AddV2 第二版 结果翻倍
+// @version 2
+func (a Adder) AddV2(args Args, reply *int) error {
+	*reply = 2 * (args.Num1 + args.Num2)
+	return nil
+}
+
+type AdderV3 int
+
+func (a AdderV3) Add(args Args, reply *int) error {
+	*reply = 3 * (args.Num1 + args.Num2)
+	return nil
+}
+
+func TestServer_MethodVersions(t *testing.T) {
+	s := NewServer()
+	_assert(s.Register(new(Adder)) == nil, "register error")
+	_assert(s.RegisterVersion(new(AdderV3), 3) == nil, "register version error")
+	_assert(s.RegisterVersion(new(AdderV3), 3) != nil, "expect duplicate version error")
+	_assert(s.RegisterVersion(new(AdderV3), 0) != nil, "expect error for version 0")
+
+	cc, stop := servePipe(s, &Option{MagicNumber: MagicNumber, CodecType: codec.GobType})
+	defer stop()
+
+	seq := uint64(0)
+	call := func(method string) (int, *rpcerr.RPCError) {
+		seq++
+		written := writeAsync(cc, &codec.Header{ServiceMethod: method, Seq: seq}, Args{Num1: 1, Num2: 2})
+		defer func() { _assert(<-written == nil, "write failed") }()
+		var h codec.Header
+		var reply int
+		_assert(cc.ReadHeader(&h) == nil, "read header error")
+		if h.Error != "" {
+			_ = cc.ReadBody(nil)
+			return 0, h.Status
+		}
+		_ = cc.ReadBody(&reply)
+		return reply, nil
+	}
+
+	for method, want := range map[string]int{"Adder.Add": 3, "Adder.AddV2": 6, "Adder.Add@2": 6, "Adder.Add@3": 9} {
+		reply, e := call(method)
+		_assert(e == nil && reply == want, "%s: expect %d, got %d %v", method, want, reply, e)
+	}
+	for _, method := range []string{"Adder.Add@4", "Adder.AddV2@2", "Adder.Add@0"} {
+		_, e := call(method)
+		_assert(e != nil && e.Code == rpcerr.NotFound, "%s: expect NotFound, got %v", method, e)
+	}
+
+	caps := s.Capabilities().Services["Adder"]
+	_assert(len(caps) == 4 && caps[0] == "Add" && caps[1] == "Add@2" && caps[2] == "Add@3" && caps[3] == "AddV2", "unexpected capabilities %v", caps)
+}
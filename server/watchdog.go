@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"gmrpc/logger"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+慢请求看门狗 处理时间超过阈值的请求记录一次日志 附带处理协程的调用栈
+处理函数在带 pprof 标签的包装中执行 调用栈按标签从协程剖析中取出
+与 HandleTimeout 相互独立 只观察不打断处理
+*/
+
+// 正在处理且已超过阈值的请求
+type SlowRequest struct {
+	ServiceMethod string
+	Seq           uint64
+	Start         time.Time
+	Elapsed       time.Duration
+	Stack         string // 超过阈值时处理协程的调用栈
+}
+
+type watchdog struct {
+	logger atomic.Value
+	nextID atomic.Uint64
+	mu     sync.Mutex
+	slow   map[*watchedRequest]*SlowRequest
+}
+
+type watchedRequest struct {
+	method string
+	seq    uint64
+	start  time.Time
+	tag    string // 处理协程的 pprof 标签值
+	timer  *time.Timer
+	done   bool // 处理已结束 由 watchdog.mu 保护
+}
+
+// 标记处理协程的 pprof 标签 超过阈值时从协程剖析中按标签找出它的调用栈
+const watchLabel = "gmrpc.watch"
+
+// 设置慢请求阈值 d <= 0 关闭看门狗 只影响之后开始处理的请求
+func (server *Server) SetSlowThreshold(d time.Duration) {
+	server.UpdateConfig(func(c *Config) {
+		c.SlowThreshold = d
+	})
+}
+
+// 设置看门狗使用的日志 默认为 logger.Default
+func (server *Server) SetSlowLogger(l logger.Logger) {
+	server.watchdog.logger.Store(&l)
+}
+
+func (w *watchdog) log() logger.Logger {
+	if l, ok := w.logger.Load().(*logger.Logger); ok {
+		return *l
+	}
+	return logger.Default
+}
+
+// 返回当前仍在处理中的慢请求 按开始时间排序
+func (server *Server) SlowRequests() []SlowRequest {
+	w := &server.watchdog
+	now := time.Now()
+	w.mu.Lock()
+	reqs := make([]SlowRequest, 0, len(w.slow))
+	for _, r := range w.slow {
+		reqs = append(reqs, *r)
+	}
+	w.mu.Unlock()
+	for i := range reqs {
+		reqs[i].Elapsed = now.Sub(reqs[i].Start)
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Start.Before(reqs[j].Start) })
+	return reqs
+}
+
+// 在带标签的包装中执行 fn 超过阈值时记录一次
+func (w *watchdog) run(threshold time.Duration, method string, seq uint64, fn func()) {
+	wr := w.begin(threshold, method, seq)
+	w.do(wr, fn)
+	w.end(wr)
+}
+
+// 开始计时 阈值 <= 0 时返回 nil
+func (w *watchdog) begin(threshold time.Duration, method string, seq uint64) *watchedRequest {
+	if threshold <= 0 {
+		return nil
+	}
+	wr := &watchedRequest{method: method, seq: seq, start: time.Now(), tag: strconv.FormatUint(w.nextID.Add(1), 10)}
+	wr.timer = time.AfterFunc(threshold, func() { w.report(wr) })
+	return wr
+}
+
+// 在当前协程中以 wr 的标签执行 fn
+func (w *watchdog) do(wr *watchedRequest, fn func()) {
+	if wr == nil {
+		fn()
+		return
+	}
+	pprof.Do(context.Background(), pprof.Labels(watchLabel, wr.tag), func(context.Context) { fn() })
+}
+
+// 处理结束 与 report 在同一把锁下移除 不会留下已结束的请求
+func (w *watchdog) end(wr *watchedRequest) {
+	if wr == nil {
+		return
+	}
+	wr.timer.Stop()
+	w.mu.Lock()
+	wr.done = true
+	delete(w.slow, wr)
+	w.mu.Unlock()
+}
+
+// 定时器只触发一次 因此每个请求至多记录一次 处理已结束时不记录
+func (w *watchdog) report(wr *watchedRequest) {
+	stack := taggedStack(wr.tag)
+	w.mu.Lock()
+	if wr.done {
+		w.mu.Unlock()
+		return
+	}
+	if w.slow == nil {
+		w.slow = make(map[*watchedRequest]*SlowRequest)
+	}
+	w.slow[wr] = &SlowRequest{ServiceMethod: wr.method, Seq: wr.seq, Start: wr.start, Stack: stack}
+	w.mu.Unlock()
+	w.log().Warn("rpc server: slow request %s seq=%d elapsed=%s\n%s", wr.method, wr.seq, time.Since(wr.start), stack)
+}
+
+// 从协程剖析 (debug=1 按调用栈与标签分组) 中找出带有该标签的包装协程
+// 处理函数启动的协程继承标签 以调用栈中的 pprof.Do 区分
+func taggedStack(tag string) string {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return ""
+	}
+	label := []byte(strconv.Quote(watchLabel) + ":" + strconv.Quote(tag))
+	for _, g := range bytes.Split(buf.Bytes(), []byte("\n\n")) {
+		if bytes.Contains(g, label) && bytes.Contains(g, []byte("runtime/pprof.Do")) {
+			return string(g)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+/*
+通过 WebSocket 建立连接 供浏览器中的客户端 (client/wasm) 使用
+每个 WebSocket 连接按字节流处理 之后与 ServeConn 相同 消息边界不必与 RPC 消息对应
+不检查 Origin 需要限制来源时在外层校验请求
+*/
+
+const WebSocketPath = "/_gmrpc_ws_"
+
+// 例如 http.Handle(server.WebSocketPath, s.WebSocketHandler())
+func (server *Server) WebSocketHandler() http.Handler {
+	return websocket.Server{Handler: func(ws *websocket.Conn) {
+		ws.PayloadType = websocket.BinaryFrame
+		server.ServeConn(ws)
+	}}
+}
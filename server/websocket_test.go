@@ -0,0 +1,35 @@
+package server
+
+import (
+	"encoding/json"
+	"gmrpc/codec"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestServer_WebSocketHandler(t *testing.T) {
+	var foo Foo
+	s := NewServer()
+	_ = s.Register(&foo)
+	hs := httptest.NewServer(s.WebSocketHandler())
+	defer hs.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(hs.URL, "http")+WebSocketPath, "", hs.URL)
+	_assert(err == nil, "dial error: %v", err)
+	ws.PayloadType = websocket.BinaryFrame
+	opt := &Option{MagicNumber: MagicNumber, CodecType: codec.JsonType}
+	_ = json.NewEncoder(ws).Encode(opt)
+	cc := codec.NewJsonCodec(ws)
+	defer func() { _ = cc.Close() }()
+
+	for i := 1; i <= 3; i++ {
+		_ = cc.Write(&codec.Header{ServiceMethod: "Foo.Sum", Seq: uint64(i)}, Args{i, i})
+		var h codec.Header
+		var reply int
+		_assert(cc.ReadHeader(&h) == nil && cc.ReadBody(&reply) == nil, "read response failed")
+		_assert(h.Seq == uint64(i) && reply == 2*i, "unexpected response %+v %d", h, reply)
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"gmrpc/codec"
+	"gmrpc/wiretrace"
+	"io"
+)
+
+// 为新连接选择帧跟踪器 conn 为原始连接 返回空表示不跟踪该连接
+type WireTracerFunc func(conn io.ReadWriteCloser) wiretrace.Tracer
+
+// 设置后对之后建立的连接生效 f 为空时关闭
+func (server *Server) SetWireTracer(f WireTracerFunc) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.wireTracer = f
+}
+
+// rw 为握手后用于读写的连接
+func (server *Server) newCodec(conn, rw io.ReadWriteCloser, opt *Option, codecs *codec.CodecRegistry) (codec.Codec, error) {
+	server.mu.RLock()
+	f := server.wireTracer
+	server.mu.RUnlock()
+	if f != nil {
+		if t := f(conn); t != nil {
+			return wiretrace.NewCodec(rw, codecs, opt.HeaderType, opt.CodecType, t)
+		}
+	}
+	return codecs.New(rw, opt.HeaderType, opt.CodecType)
+}
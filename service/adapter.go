@@ -0,0 +1,112 @@
+package service
+
+import (
+	"reflect"
+	"sync"
+)
+
+/*
+预编译的调用适配器 注册时把方法表达式断言为具体的函数类型 调用时直接调用 不经过 reflect.Call
+接收者为 T 参数为 A 结果为 *R 的方法在注册服务前以 RegisterAdapter[T, A, R]() 登记 T 与 Register 传入的类型一致
+	func (T) M(args A, reply *R) error
+	service.RegisterAdapter[*Math, Args, int]()
+参数与结果都是常见的内置类型 (int string []byte map[string]interface{} 等 见 builtinTypes) 的方法不需要登记
+注册时把方法值断言为 func(A, *R) error 自动生成适配器 其他参数类型 (如结构体) 需要登记或由 fastpath 生成登记代码
+没有适配器的方法 (包括延迟响应的方法) 仍通过反射调用 两者的行为 (错误 numCalls panic) 相同
+*/
+
+// 由方法表达式与接收者构造 MethodFunc
+type adapterFactory func(fn, rcvr interface{}) MethodFunc
+
+var adapters sync.Map // 方法表达式的函数类型 func(T, A, *R) error -> adapterFactory
+
+// 登记接收者为 T 参数为 A 结果为 *R 的方法的适配器 需在注册服务之前调用 可以重复调用
+func RegisterAdapter[T any, A any, R any]() {
+	adapters.Store(reflect.TypeOf((func(T, A, *R) error)(nil)), adapterFactory(func(fn, rcvr interface{}) MethodFunc {
+		return adapt(fn.(func(T, A, *R) error), rcvr.(T))
+	}))
+}
+
+func adapt[T any, A any, R any](f func(T, A, *R) error, rcvr T) MethodFunc {
+	return adaptFunc(func(args A, reply *R) error { return f(rcvr, args, reply) })
+}
+
+// 方法值 (已绑定接收者) 的函数类型 func(A, *R) error -> 构造 MethodFunc
+var builtinAdapters = map[reflect.Type]func(fn interface{}) MethodFunc{}
+
+// 自动生成适配器的参数与结果类型 两两组合
+func init() {
+	builtinFor[int]()
+	builtinFor[int64]()
+	builtinFor[uint64]()
+	builtinFor[float64]()
+	builtinFor[bool]()
+	builtinFor[string]()
+	builtinFor[[]byte]()
+	builtinFor[[]int]()
+	builtinFor[[]string]()
+	builtinFor[map[string]string]()
+	builtinFor[map[string]interface{}]()
+}
+
+func builtinFor[A any]() {
+	builtinAdapter[A, int]()
+	builtinAdapter[A, int64]()
+	builtinAdapter[A, uint64]()
+	builtinAdapter[A, float64]()
+	builtinAdapter[A, bool]()
+	builtinAdapter[A, string]()
+	builtinAdapter[A, []byte]()
+	builtinAdapter[A, []int]()
+	builtinAdapter[A, []string]()
+	builtinAdapter[A, map[string]string]()
+	builtinAdapter[A, map[string]interface{}]()
+}
+
+func builtinAdapter[A any, R any]() {
+	builtinAdapters[reflect.TypeOf((func(A, *R) error)(nil))] = func(fn interface{}) MethodFunc {
+		return adaptFunc(fn.(func(A, *R) error))
+	}
+}
+
+func adaptFunc[A any, R any](f func(A, *R) error) MethodFunc {
+	switch reflect.TypeOf((*A)(nil)).Elem().Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		// 引用类型的参数 断言即可 不需要取地址
+		return func(argv, replyv reflect.Value) error {
+			return f(argv.Interface().(A), replyv.Interface().(*R))
+		}
+	}
+	// 值类型的参数 (结构体 数组 基本类型 接口) 取地址后断言 避免 Interface() 拷贝与分配
+	return func(argv, replyv reflect.Value) error {
+		var args A
+		if argv.CanAddr() {
+			args = *argv.Addr().Interface().(*A)
+		} else {
+			args, _ = argv.Interface().(A) // 接口类型的 nil 参数为零值
+		}
+		return f(args, replyv.Interface().(*R))
+	}
+}
+
+// 方法的签名 (方法表达式 第一个参数为接收者) 用于 fastpath 生成适配器的登记代码
+func (mt *methodType) Method() reflect.Method {
+	return mt.method
+}
+
+// 是否通过预编译的适配器调用
+func (mt *methodType) Adapted() bool {
+	return mt.adapted
+}
+
+// 方法的适配器 优先使用登记的 其次是内置类型的 都没有时返回 nil
+func (s *service) adapterFunc(method reflect.Method) MethodFunc {
+	if factory, ok := adapters.Load(method.Type); ok {
+		return factory.(adapterFactory)(method.Func.Interface(), s.receiver.Interface())
+	}
+	fn := s.receiver.Method(method.Index)
+	if build, ok := builtinAdapters[fn.Type()]; ok {
+		return build(fn.Interface())
+	}
+	return nil
+}
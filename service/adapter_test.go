@@ -0,0 +1,109 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type Calc struct{}
+
+var errNegative = errors.New("negative")
+
+func (Calc) Double(args int, reply *int) error {
+	if args < 0 {
+		return errNegative
+	}
+	*reply = args * 2
+	return nil
+}
+
+func (Calc) Join(args *TagArgs, reply *[]string) error {
+	*reply = append(*reply, args.Tags...)
+	return nil
+}
+
+func (Calc) Panic(args string, reply *string) error {
+	panic("boom: " + args)
+}
+
+// 没有登记适配器的非内置类型
+func (Calc) Exotic(args [2]int, reply *[2]int) error {
+	*reply = [2]int{args[1], args[0]}
+	return nil
+}
+
+func init() {
+	RegisterAdapter[*Foo, Args, int]()
+	RegisterAdapter[Calc, *TagArgs, []string]()
+}
+
+// 同一方法分别以反射与适配器调用 结果一致
+func callBoth(s *Service, name string, args interface{}) (reflective, adapted reflect.Value, rerr, aerr error) {
+	mt := s.Method[name]
+	call := func(h MethodFunc) (reflect.Value, error) {
+		argv, replyv := mt.NewArgv(), mt.NewReplyv()
+		if argv.Kind() == reflect.Ptr {
+			argv.Elem().Set(reflect.ValueOf(args).Elem())
+		} else {
+			argv.Set(reflect.ValueOf(args))
+		}
+		return replyv, h(argv, replyv)
+	}
+	reflective, rerr = call(s.methodFunc(mt.method))
+	adapted, aerr = call(mt.handler)
+	return
+}
+
+func TestAdapter_MatchesReflection(t *testing.T) {
+	var foo Foo
+	sum := NewService(&foo)
+	_assert(sum.Method["Sum"].adapted, "registered adapter should be used for Foo.Sum")
+	r, a, rerr, aerr := callBoth(sum, "Sum", Args{Num1: 2, Num2: 5})
+	_assert(rerr == nil && aerr == nil && r.Elem().Interface() == a.Elem().Interface() && a.Elem().Int() == 7, "Sum mismatch: %v %v", r, a)
+
+	// Double 与 Panic 的参数与结果为内置类型 没有登记也使用适配器
+	s := NewService(Calc{})
+	for name, adapted := range map[string]bool{"Double": true, "Join": true, "Panic": true, "Exotic": false} {
+		_assert(s.Method[name].adapted == adapted, "%s adapted = %v, want %v", name, s.Method[name].adapted, adapted)
+	}
+	r, a, rerr, aerr = callBoth(s, "Double", 21)
+	_assert(rerr == nil && aerr == nil && r.Elem().Int() == 42 && a.Elem().Int() == 42, "Double mismatch")
+	_, _, rerr, aerr = callBoth(s, "Double", -1)
+	_assert(rerr == errNegative && aerr == errNegative, "errors should propagate unchanged: %v %v", rerr, aerr)
+	r, a, _, _ = callBoth(s, "Join", &TagArgs{Tags: []string{"x", "y"}})
+	_assert(reflect.DeepEqual(r.Elem().Interface(), a.Elem().Interface()) && a.Elem().Len() == 2, "Join mismatch: %v %v", r, a)
+
+	// 适配器中的 panic 与反射调用一样传给调用方
+	recovered := func(h MethodFunc) (v interface{}) {
+		defer func() { v = recover() }()
+		_ = h(reflect.ValueOf("x"), reflect.New(reflect.TypeOf("")))
+		return nil
+	}
+	mt := s.Method["Panic"]
+	_assert(recovered(mt.handler) == "boom: x" && recovered(s.methodFunc(mt.method)) == "boom: x", "panics should propagate the same way")
+
+	// 参数不可寻址时同样可以调用 numCalls 照常计数
+	double := s.Method["Double"]
+	replyv := double.NewReplyv()
+	_assert(s.Call(double, reflect.ValueOf(4), replyv) == nil && replyv.Elem().Int() == 8 && double.NumCalls() == 1, "unexpected call result")
+	sumMt := sum.Method["Sum"]
+	replyv = sumMt.NewReplyv()
+	_assert(sum.Call(sumMt, reflect.ValueOf(Args{Num1: 1, Num2: 1}), replyv) == nil && replyv.Elem().Int() == 2, "non-addressable struct args should work")
+}
+
+func BenchmarkMethodType_Call(b *testing.B) {
+	var foo Foo
+	s := NewService(&foo)
+	mt := s.Method["Sum"]
+	run := func(b *testing.B, h MethodFunc) {
+		argv, replyv := mt.NewArgvFromPool(), mt.NewReplyvFromPool()
+		argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 2}))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = h(argv, replyv)
+		}
+	}
+	b.Run("reflect", func(b *testing.B) { run(b, s.methodFunc(mt.method)) })
+	b.Run("adapted", func(b *testing.B) { run(b, mt.handler) })
+}
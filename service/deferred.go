@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"reflect"
+)
+
+/*
+延迟响应的方法 签名为 func (T) M(ctx context.Context, args A, w ResponseWriter) error
+处理函数可以立即返回 之后在任意协程中调用 w.Send 或 w.Error 完成响应 返回非空错误时直接以该错误响应
+*/
+
+type ResponseWriter interface {
+	Send(reply interface{}) error
+	Error(err error) error
+}
+
+// 延迟响应方法的 replyv 携带处理函数的上下文与响应对象
+type DeferredReply struct {
+	Ctx    context.Context
+	Writer ResponseWriter
+}
+
+var (
+	contextType        = reflect.TypeOf((*context.Context)(nil)).Elem()
+	responseWriterType = reflect.TypeOf((*ResponseWriter)(nil)).Elem()
+	deferredReplyType  = reflect.TypeOf((*interface{})(nil)) // 结果类型由 Send 决定
+)
+
+func isDeferredMethod(mType reflect.Type) bool {
+	return mType.NumIn() == 4 && mType.In(1) == contextType && mType.In(3) == responseWriterType
+}
+
+func (s *service) deferredFunc(method reflect.Method) MethodFunc {
+	f := method.Func
+	return func(argv, replyv reflect.Value) error {
+		d := replyv.Interface().(*DeferredReply)
+		ctx := d.Ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		returnValues := f.Call([]reflect.Value{s.receiver, reflect.ValueOf(ctx), argv, reflect.ValueOf(d.Writer)})
+		if errInter := returnValues[0].Interface(); errInter != nil {
+			return errInter.(error)
+		}
+		return nil
+	}
+}
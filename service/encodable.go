@@ -0,0 +1,173 @@
+package service
+
+import (
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"gmrpc/codec"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+注册时检查结果类型能否编码 gob 与 json 都无法编码通道 函数与 unsafe.Pointer 也无法编码没有导出字段的结构体
+这类结果在运行时才会编码失败 提前在注册时给出具体的字段
+接口字段的实际类型只有运行时才知道 不做检查 运行时编码失败时服务端改为返回错误
+json 另有限制 map 的键只能是字符串 整数或实现了 encoding.TextMarshaler 的类型 不能编码复数
+服务端启用了 json 编码时 (CheckReplyCodecs) 这类结果在注册时拒绝
+*/
+
+var (
+	gobEncoderType  = reflect.TypeOf((*gob.GobEncoder)(nil)).Elem()
+	jsonMarshalType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	binaryMarshal   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	textMarshal     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	readerType      = reflect.TypeOf((*io.Reader)(nil)).Elem()
+)
+
+// 类型自己实现了编码
+func hasCustomEncoding(t reflect.Type) bool {
+	for _, it := range []reflect.Type{gobEncoderType, jsonMarshalType, binaryMarshal, textMarshal} {
+		if t.Implements(it) || reflect.PointerTo(t).Implements(it) {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查类型能否编码 path 为出错位置的描述
+func checkEncodable(t reflect.Type, path string, seen map[reflect.Type]bool) error {
+	if hasCustomEncoding(t) {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fmt.Errorf("%s has unsupported type %s", path, t)
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return checkEncodable(t.Elem(), path, seen)
+	case reflect.Map:
+		if err := checkEncodable(t.Key(), path+" map key", seen); err != nil {
+			return err
+		}
+		return checkEncodable(t.Elem(), path, seen)
+	case reflect.Struct:
+		if seen[t] {
+			return nil
+		}
+		seen[t] = true
+		exported := 0
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() || strings.Split(f.Tag.Get("json"), ",")[0] == "-" {
+				continue
+			}
+			exported++
+			if err := checkEncodable(f.Type, path+"."+f.Name, seen); err != nil {
+				return err
+			}
+		}
+		if exported == 0 && t.NumField() > 0 {
+			return fmt.Errorf("%s (%s) has no exported fields", path, t)
+		}
+	}
+	return nil
+}
+
+// 检查所有方法的结果类型 流式结果 (实现了 io.Reader) 按块发送 延迟响应的结果在发送时检查 都不检查
+func (s *service) CheckReplyTypes() error {
+	names := make([]string, 0, len(s.Method))
+	for name := range s.Method {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := s.Method[name].ReplyType
+		if t.Implements(readerType) || s.Method[name].Deferred {
+			continue
+		}
+		if err := checkEncodable(t.Elem(), t.Elem().Name(), map[reflect.Type]bool{}); err != nil {
+			return fmt.Errorf("rpc service: reply type of %s.%s is not serializable: %v", s.Name, name, err)
+		}
+	}
+	return nil
+}
+
+// 使用 json 编码的消息体类型
+func isJSONCodec(t codec.Type) bool {
+	return t == codec.JsonType || t == codec.JSONRPC2Type
+}
+
+// 检查类型能否以 json 编码 只检查 json 特有的限制 其余见 checkEncodable
+func checkJSONEncodable(t reflect.Type, path string, seen map[reflect.Type]bool) error {
+	if t.Implements(jsonMarshalType) || reflect.PointerTo(t).Implements(jsonMarshalType) ||
+		t.Implements(textMarshal) || reflect.PointerTo(t).Implements(textMarshal) {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Complex64, reflect.Complex128:
+		return fmt.Errorf("%s has unsupported type %s", path, t)
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return checkJSONEncodable(t.Elem(), path, seen)
+	case reflect.Map:
+		key := t.Key()
+		switch key.Kind() {
+		case reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			if !key.Implements(textMarshal) {
+				return fmt.Errorf("%s has map key type %s, use string or integer keys", path, key)
+			}
+		}
+		return checkJSONEncodable(t.Elem(), path, seen)
+	case reflect.Struct:
+		if seen[t] {
+			return nil
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() || strings.Split(f.Tag.Get("json"), ",")[0] == "-" {
+				continue
+			}
+			if err := checkJSONEncodable(f.Type, path+"."+f.Name, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 检查所有方法的结果类型能否以 codecs 中的每种编码发送 目前只有 json 有额外的限制
+// 与 CheckReplyTypes 一样跳过流式结果与延迟响应
+func (s *service) CheckReplyCodecs(codecs []codec.Type) error {
+	usesJSON := false
+	for _, t := range codecs {
+		usesJSON = usesJSON || isJSONCodec(t)
+	}
+	if !usesJSON {
+		return nil
+	}
+	names := make([]string, 0, len(s.Method))
+	for name := range s.Method {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := s.Method[name].ReplyType
+		if t.Implements(readerType) || s.Method[name].Deferred {
+			continue
+		}
+		path := t.Elem().Name()
+		if path == "" {
+			path = t.Elem().String()
+		}
+		if err := checkJSONEncodable(t.Elem(), path, map[reflect.Type]bool{}); err != nil {
+			return fmt.Errorf("rpc service: reply type of %s.%s can't be encoded as json: %v", s.Name, name, err)
+		}
+	}
+	return nil
+}
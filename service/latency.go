@@ -0,0 +1,65 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+/*
+方法耗时分布 使用 HDR 直方图估计分位数
+记录范围 1µs ~ 1h 保留 2 位有效数字 误差约 1% 每个直方图约占 20KB 第一次记录时才分配
+*/
+
+const (
+	minTrackedLatency = int64(time.Microsecond)
+	maxTrackedLatency = int64(time.Hour)
+)
+
+type LatencyTracker struct {
+	mu sync.Mutex
+	h  *hdrhistogram.Histogram
+}
+
+// 记录一次耗时 单位纳秒 超出范围的值按边界记录
+func (t *LatencyTracker) Record(ns int64) {
+	if ns < minTrackedLatency {
+		ns = minTrackedLatency
+	} else if ns > maxTrackedLatency {
+		ns = maxTrackedLatency
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.h == nil {
+		t.h = hdrhistogram.New(minTrackedLatency, maxTrackedLatency, 2)
+	}
+	_ = t.h.RecordValue(ns)
+}
+
+// p 取值 0~100 没有记录时返回 0
+func (t *LatencyTracker) Percentile(p float64) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.h == nil {
+		return 0
+	}
+	return time.Duration(t.h.ValueAtQuantile(p))
+}
+
+func (t *LatencyTracker) Count() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.h == nil {
+		return 0
+	}
+	return t.h.TotalCount()
+}
+
+func (mt *methodType) TrackLatency(ns int64) {
+	mt.latency.Record(ns)
+}
+
+func (mt *methodType) Percentile(p float64) time.Duration {
+	return mt.latency.Percentile(p)
+}
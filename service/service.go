@@ -1,9 +1,13 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"gmrpc/codec"
 	"go/ast"
 	"log"
 	"reflect"
+	"sync"
 	"sync/atomic"
 )
 
@@ -11,12 +15,27 @@ import (
  */
 
 type methodType struct {
-	method    reflect.Method
-	ArgType   reflect.Type
-	ReplyType reflect.Type
-	numCalls  uint64
+	method     reflect.Method
+	ArgType    reflect.Type
+	ReplyType  reflect.Type
+	ArgShape   []string // 参数类型的结构描述 见 TypeShape
+	ReplyShape []string
+	ArgHash    string // 结构描述的摘要 见 ShapeHash
+	ReplyHash  string
+	Deferred   bool  // 延迟响应 见 ResponseWriter
+	Version    uint8 // 文档注释中 @version 标注的版本 0 表示没有 见 version.go
+	ReplyCap   int   // map 与 slice 结果的初始容量 见 SetReplyCapacity
+	numCalls   uint64
+	latency    LatencyTracker // 处理耗时分布
+	handler    MethodFunc     // 调用方法的函数 可被中间件包装
+	adapted    bool           // handler 最初为预编译的适配器 见 adapter.go
+	argPool    sync.Pool      // 复用参数实例 存放指向参数的指针
+	replyPool  sync.Pool      // 复用结果实例
 }
 
+// 以反射值调用服务方法
+type MethodFunc func(argv, replyv reflect.Value) error
+
 func (mt *methodType) NumCalls() uint64 {
 	return atomic.LoadUint64(&mt.numCalls)
 }
@@ -36,14 +55,49 @@ func (mt *methodType) NewArgv() reflect.Value {
 func (mt *methodType) NewReplyv() reflect.Value {
 	// 返回结果实例
 	replyv := reflect.New(mt.ReplyType.Elem())
-	switch mt.ReplyType.Elem().Kind() {
+	mt.initReply(replyv.Elem())
+	return replyv
+}
+
+// map 与 slice 初始化为空 容量为 ReplyCap 其他类型清零
+func (mt *methodType) initReply(elem reflect.Value) {
+	switch elem.Kind() {
 	case reflect.Map:
-		replyv.Elem().Set(reflect.MakeMap(mt.ReplyType.Elem()))
+		elem.Set(reflect.MakeMapWithSize(elem.Type(), mt.ReplyCap))
 	case reflect.Slice:
-		replyv.Elem().Set(reflect.MakeSlice(mt.ReplyType.Elem(), 0, 0))
+		elem.Set(reflect.MakeSlice(elem.Type(), 0, mt.ReplyCap))
+	default:
+		elem.SetZero()
 	}
+}
 
-	return replyv
+// 从池中取参数实例 已清零 与 NewArgv 返回的类型一致
+func (mt *methodType) NewArgvFromPool() reflect.Value {
+	v := reflect.ValueOf(mt.argPool.Get())
+	v.Elem().SetZero()
+	if mt.ArgType.Kind() == reflect.Ptr {
+		return v
+	}
+	return v.Elem()
+}
+
+// 放回参数实例 调用方之后不能再使用它
+func (mt *methodType) RecycleArgv(v reflect.Value) {
+	if v.Kind() != reflect.Ptr {
+		v = v.Addr()
+	}
+	mt.argPool.Put(v.Interface())
+}
+
+// 从池中取结果实例 与 NewReplyv 一样 map 与 slice 已初始化为空
+func (mt *methodType) NewReplyvFromPool() reflect.Value {
+	v := reflect.ValueOf(mt.replyPool.Get())
+	mt.initReply(v.Elem())
+	return v
+}
+
+func (mt *methodType) RecycleReplyv(v reflect.Value) {
+	mt.replyPool.Put(v.Interface())
 }
 
 type service struct {
@@ -51,6 +105,57 @@ type service struct {
 	typ      reflect.Type  // 结构体类型
 	receiver reflect.Value // 结构体实例
 	Method   map[string]*methodType
+
+	deprecations map[string]*Deprecation
+}
+
+// 方法弃用信息
+type Deprecation struct {
+	Message   string // 返回给调用方的说明
+	ForwardTo string // 转发到同一服务的另一个方法 为空时仍调用原方法
+}
+
+// 标记方法弃用 需在服务开始处理请求前调用
+// 设置 ForwardTo 时调用转发到目标方法 原方法可以已经不存在 两者存在时参数与结果类型必须一致
+func (s *service) Deprecate(method string, d Deprecation) error {
+	if d.ForwardTo != "" {
+		target := s.Method[d.ForwardTo]
+		if target == nil {
+			return fmt.Errorf("rpc service: forward target %s.%s not found", s.Name, d.ForwardTo)
+		}
+		if old := s.Method[method]; old != nil && (old.ArgType != target.ArgType || old.ReplyType != target.ReplyType) {
+			return fmt.Errorf("rpc service: %s.%s and %s.%s have different signatures", s.Name, method, s.Name, d.ForwardTo)
+		}
+		s.Method[method] = target
+	} else if s.Method[method] == nil {
+		return errors.New("rpc service: can't deprecate missing method " + s.Name + "." + method)
+	}
+	if s.deprecations == nil {
+		s.deprecations = make(map[string]*Deprecation)
+	}
+	s.deprecations[method] = &d
+	return nil
+}
+
+// 设置 map 或 slice 结果的初始容量 处理函数填充大量元素时避免反复扩容 需在服务开始处理请求前调用
+func (s *service) SetReplyCapacity(method string, n int) error {
+	mt := s.Method[method]
+	if mt == nil {
+		return errors.New("rpc service: can't set reply capacity of missing method " + s.Name + "." + method)
+	}
+	if k := mt.ReplyType.Elem().Kind(); k != reflect.Map && k != reflect.Slice {
+		return fmt.Errorf("rpc service: reply type of %s.%s is %s, capacity applies only to maps and slices", s.Name, method, mt.ReplyType.Elem())
+	}
+	if n < 0 {
+		n = 0
+	}
+	mt.ReplyCap = n
+	return nil
+}
+
+// 方法的弃用信息 未弃用时返回 nil
+func (s *service) Deprecation(method string) *Deprecation {
+	return s.deprecations[method]
 }
 
 func (s *service) registerMethods() {
@@ -59,8 +164,9 @@ func (s *service) registerMethods() {
 		method := s.typ.Method(i)
 		mType := method.Type
 
+		deferred := isDeferredMethod(mType)
 		// 输入输出判断数量
-		if mType.NumIn() != 3 || mType.NumOut() != 1 {
+		if (mType.NumIn() != 3 && !deferred) || mType.NumOut() != 1 {
 			continue
 		}
 		//输出为error判断
@@ -69,27 +175,78 @@ func (s *service) registerMethods() {
 		}
 		// 判断导出类型与构建类型
 		argType, replyType := mType.In(1), mType.In(2)
+		if deferred {
+			argType, replyType = mType.In(2), deferredReplyType
+		}
 		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
 			continue
 		}
-		s.Method[method.Name] = &methodType{
+		// gob 编码接口值时需要注册具体类型
+		registerGobType(argType)
+		registerGobType(replyType)
+		mt := &methodType{
 			method:    method,
 			ArgType:   argType,
 			ReplyType: replyType,
+			handler:   s.methodFunc(method),
+			Deferred:  deferred,
+			Version:   parseVersion(methodDoc(s.typ, method)),
+		}
+		mt.ArgShape = TypeShape(argType)
+		mt.ArgHash = ShapeHash(mt.ArgShape)
+		if deferred {
+			// 结果类型由 Send 决定 没有结构摘要
+			mt.handler = s.deferredFunc(method)
+		} else {
+			mt.ReplyShape = TypeShape(replyType)
+			mt.ReplyHash = ShapeHash(mt.ReplyShape)
+			if h := s.adapterFunc(method); h != nil {
+				mt.handler, mt.adapted = h, true
+			}
 		}
+		argElem := argType
+		if argElem.Kind() == reflect.Ptr {
+			argElem = argElem.Elem()
+		}
+		mt.argPool.New = func() any { return reflect.New(argElem).Interface() }
+		mt.replyPool.New = func() any { return reflect.New(replyType.Elem()).Interface() }
+		s.Method[method.Name] = mt
 		log.Printf("rpc server: register %s.%s\n", s.Name, method.Name)
 	}
 }
 
+func (s *service) methodFunc(method reflect.Method) MethodFunc {
+	f := method.Func
+	return func(argv, replyv reflect.Value) error {
+		returnValues := f.Call([]reflect.Value{s.receiver, argv, replyv})
+		if errInter := returnValues[0].Interface(); errInter != nil {
+			return errInter.(error)
+		}
+		return nil
+	}
+}
+
 func (s *service) Call(m *methodType, argv, replyv reflect.Value) error {
 	// 服务调用
 	atomic.AddUint64(&m.numCalls, 1)
-	f := m.method.Func
-	returnValues := f.Call([]reflect.Value{s.receiver, argv, replyv})
-	if errInter := returnValues[0].Interface(); errInter != nil {
-		return errInter.(error)
+	return m.handler(argv, replyv)
+}
+
+// 包装所有方法 需在服务开始处理请求前调用
+func (s *service) WrapMethods(wrap func(methodName string, next MethodFunc) MethodFunc) {
+	for name, m := range s.Method {
+		m.handler = wrap(name, m.handler)
 	}
-	return nil
+}
+
+func registerGobType(t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Interface {
+		return
+	}
+	codec.RegisterGobType(reflect.Zero(t).Interface())
 }
 
 func isExportedOrBuiltinType(t reflect.Type) bool {
@@ -99,17 +256,23 @@ func isExportedOrBuiltinType(t reflect.Type) bool {
 
 func NewService(rcvr interface{}) *service {
 	// 创建服务
+	name := reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name() // Indirect 为了兼容指针类型
+
+	// 判断是否可以导入
+	if !ast.IsExported(name) {
+		log.Fatalf("rpc server: %s is not a valid service name", name)
+	}
+	return NewNamedService(rcvr, name)
+}
+
+// 以指定名称创建服务 名称由调用方保证合法
+func NewNamedService(rcvr interface{}, name string) *service {
 	ser := &service{
-		Name:     reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name(), // Indirect 为了兼容指针类型
+		Name:     name,
 		typ:      reflect.TypeOf(rcvr),
 		receiver: reflect.ValueOf(rcvr),
 		Method:   make(map[string]*methodType),
 	}
-
-	// 判断是否可以导入
-	if !ast.IsExported(ser.Name) {
-		log.Fatalf("rpc server: %s is not a valid service name", ser.Name)
-	}
 	// 注册方法
 	ser.registerMethods()
 	return ser
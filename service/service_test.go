@@ -2,8 +2,11 @@ package service
 
 import (
 	"fmt"
+	"gmrpc/codec"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type Foo int
@@ -46,3 +49,177 @@ func TestMethodTypeCall(t *testing.T) {
 	err := s.Call(mType, argv, replyv)
 	_assert(err == nil && *replyv.Interface().(*int) == 4 && mType.NumCalls() == 1, "failed to call Foo.Sum")
 }
+
+func TestMethodTypeLatency(t *testing.T) {
+	var foo Foo
+	mType := NewService(&foo).Method["Sum"]
+	_assert(mType.Percentile(50) == 0, "expect 0 without samples")
+	for i := 1; i <= 100; i++ {
+		mType.TrackLatency(int64(i) * int64(time.Millisecond))
+	}
+	p50, p99 := mType.Percentile(50), mType.Percentile(99)
+	_assert(p50 >= 49*time.Millisecond && p50 <= 51*time.Millisecond, "unexpected p50 %v", p50)
+	_assert(p99 >= 98*time.Millisecond && p99 <= 100*time.Millisecond, "unexpected p99 %v", p99)
+	_assert(mType.latency.Count() == 100, "unexpected count %d", mType.latency.Count())
+}
+
+type Tags struct{}
+
+func (Tags) Join(args *TagArgs, reply *[]string) error {
+	*reply = append(*reply, args.Tags...)
+	return nil
+}
+
+type TagArgs struct {
+	Tags []string
+}
+
+func TestMethodTypePool(t *testing.T) {
+	var foo Foo
+	sum := NewService(&foo).Method["Sum"]
+	argv := sum.NewArgvFromPool()
+	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 2}))
+	sum.RecycleArgv(argv)
+	argv = sum.NewArgvFromPool()
+	_assert(argv.Type() == sum.NewArgv().Type() && argv.Interface().(Args) == Args{}, "pooled argv should be zeroed: %v", argv)
+
+	tags := NewService(Tags{})
+	join := tags.Method["Join"]
+	pargv, replyv := join.NewArgvFromPool(), join.NewReplyvFromPool()
+	pargv.Interface().(*TagArgs).Tags = []string{"a"}
+	_assert(tags.Call(join, pargv, replyv) == nil, "call failed")
+	join.RecycleArgv(pargv)
+	join.RecycleReplyv(replyv)
+	pargv, replyv = join.NewArgvFromPool(), join.NewReplyvFromPool()
+	reply := *replyv.Interface().(*[]string)
+	_assert(pargv.Interface().(*TagArgs).Tags == nil && reply != nil && len(reply) == 0, "pooled values should be reset: %v %v", pargv, reply)
+}
+
+type Table struct{}
+
+func (Table) Rows(n int, reply *[]int) error {
+	for i := 0; i < n; i++ {
+		*reply = append(*reply, i)
+	}
+	return nil
+}
+
+func (Table) Index(n int, reply *map[string]int) error {
+	for i := 0; i < n; i++ {
+		(*reply)[fmt.Sprint(i)] = i
+	}
+	return nil
+}
+
+func TestMethodTypeReplyCapacity(t *testing.T) {
+	s := NewService(Table{})
+	rows := s.Method["Rows"]
+	argv := reflect.ValueOf(1000)
+	call := func() {
+		_ = s.Call(rows, argv, rows.NewReplyv())
+	}
+	before := testing.AllocsPerRun(20, call)
+	_assert(s.SetReplyCapacity("Rows", 1000) == nil, "set capacity failed")
+	after := testing.AllocsPerRun(20, call)
+	// 反射调用本身的分配不变 差值为扩容的次数
+	_assert(before-after >= 8, "expect preallocated slice to avoid growth, allocs %v -> %v", before, after)
+
+	replyv := rows.NewReplyvFromPool()
+	_assert(replyv.Elem().Cap() == 1000 && replyv.Elem().Len() == 0, "pooled reply should use capacity, cap %d", replyv.Elem().Cap())
+
+	index := s.Method["Index"]
+	_assert(s.SetReplyCapacity("Index", 64) == nil, "set map capacity failed")
+	_assert(s.Call(index, reflect.ValueOf(64), index.NewReplyv()) == nil, "call failed")
+
+	_assert(s.SetReplyCapacity("Missing", 1) != nil, "expect error for missing method")
+	var foo Foo
+	_assert(NewService(&foo).SetReplyCapacity("Sum", 1) != nil, "expect error for non-slice reply")
+}
+
+type Histogram struct{}
+
+type Bucket struct {
+	Counts map[float64]int
+}
+
+func (Histogram) Buckets(n int, reply *Bucket) error { return nil }
+
+type Point struct{ X, Y int }
+
+func (Histogram) Grid(n int, reply *map[Point]int) error { return nil }
+
+func (Histogram) Sparse(n int, reply *map[int]string) error { return nil }
+
+type Level int
+
+func (l Level) MarshalText() ([]byte, error) { return []byte(fmt.Sprint(int(l))), nil }
+
+func (Histogram) Levels(n int, reply *map[Level]bool) error { return nil }
+
+func TestCheckReplyCodecs(t *testing.T) {
+	s := NewService(Histogram{})
+	_assert(s.CheckReplyTypes() == nil, "gob can encode any comparable key: %v", s.CheckReplyTypes())
+	_assert(s.CheckReplyCodecs([]codec.Type{codec.GobType}) == nil, "gob only should pass")
+
+	err := s.CheckReplyCodecs([]codec.Type{codec.GobType, codec.JsonType})
+	_assert(err != nil && err.Error() == "rpc service: reply type of Histogram.Buckets can't be encoded as json: Bucket.Counts has map key type float64, use string or integer keys", "unexpected error %v", err)
+
+	delete(s.Method, "Buckets")
+	err = s.CheckReplyCodecs([]codec.Type{codec.JSONRPC2Type})
+	_assert(err != nil && strings.Contains(err.Error(), "Histogram.Grid") && strings.Contains(err.Error(), "map[service.Point]int has map key type service.Point"), "unexpected error %v", err)
+
+	// 整数键与实现了 TextMarshaler 的键可以编码
+	delete(s.Method, "Grid")
+	_assert(s.CheckReplyCodecs([]codec.Type{codec.JsonType}) == nil, "integer and text keys should pass: %v", s.CheckReplyCodecs([]codec.Type{codec.JsonType}))
+}
+
+// 单次调用的参数与结果分配 对比 reflect.New 与池
+func BenchmarkMethodType_Argv(b *testing.B) {
+	var foo Foo
+	s := NewService(&foo)
+	mType := s.Method["Sum"]
+	args := reflect.ValueOf(Args{Num1: 1, Num2: 2})
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			argv, replyv := mType.NewArgv(), mType.NewReplyv()
+			argv.Set(args)
+			_ = s.Call(mType, argv, replyv)
+		}
+	})
+	b.Run("pool", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			argv, replyv := mType.NewArgvFromPool(), mType.NewReplyvFromPool()
+			argv.Set(args)
+			_ = s.Call(mType, argv, replyv)
+			mType.RecycleArgv(argv)
+			mType.RecycleReplyv(replyv)
+		}
+	})
+}
+
+type Node struct {
+	Name     string
+	Children []*Node
+	Tags     map[string]int
+	At       time.Time
+	skipped  int
+}
+
+func TestTypeShape(t *testing.T) {
+	shape := TypeShape(reflect.TypeOf(&Node{}))
+	want := []string{"Name string", "Children[] recursive Node", "Tags{key} string", "Tags{} int", "At time.Time"}
+	_assert(reflect.DeepEqual(shape, want), "unexpected shape %q", shape)
+	_assert(reflect.DeepEqual(TypeShape(reflect.TypeOf(0)), []string{"$ int"}), "unexpected shape for int")
+
+	// 类型名与指针不影响摘要
+	type renamed struct{ Num1, Num2 int }
+	_assert(ShapeHash(TypeShape(reflect.TypeOf(Args{}))) == ShapeHash(TypeShape(reflect.TypeOf(&renamed{}))), "equal shapes should hash equal")
+
+	// 字段顺序不影响编码 也不影响摘要
+	type reordered struct{ Num2, Num1 int }
+	_assert(ShapeHash(TypeShape(reflect.TypeOf(Args{}))) == ShapeHash(TypeShape(reflect.TypeOf(reordered{}))), "field order should not change the hash")
+	diffs := DiffShapes(TypeShape(reflect.TypeOf(Args{})), TypeShape(reflect.TypeOf(reordered{})))
+	_assert(len(diffs) == 0, "unexpected diffs %q", diffs)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+参数与结果类型的结构描述 用于发现客户端与服务端类型定义不一致
+每行为 字段路径 与 类型 例如 "Num1 int" "Origin.X int" "Tags[] string" "Scores{key} string"
+只使用字段名与 reflect.Kind 不依赖 reflect.Type.String 的格式 类型名与包路径不参与 指针视为其指向的类型
+自定义编码的类型 (如 time.Time) 不展开 以包路径与类型名表示
+gob 与 json 都按字段名编码 摘要按路径排序后计算 字段顺序不同的定义摘要相同
+*/
+
+// 类型的结构描述
+func TypeShape(t reflect.Type) []string {
+	var lines []string
+	shape(t, "", map[reflect.Type]bool{}, &lines)
+	return lines
+}
+
+// 结构描述的摘要 16 字节的十六进制 与行的顺序无关
+func ShapeHash(lines []string) string {
+	sorted := append([]string(nil), lines...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func shape(t reflect.Type, path string, stack map[reflect.Type]bool, lines *[]string) {
+	emit := func(desc string) {
+		p := path
+		if p == "" {
+			p = "$"
+		}
+		*lines = append(*lines, p+" "+desc)
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if hasCustomEncoding(t) && t.Name() != "" {
+		emit(t.PkgPath() + "." + t.Name())
+		return
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			emit("bytes")
+			return
+		}
+		shape(t.Elem(), path+"[]", stack, lines)
+	case reflect.Array:
+		shape(t.Elem(), path+"["+strconv.Itoa(t.Len())+"]", stack, lines)
+	case reflect.Map:
+		shape(t.Key(), path+"{key}", stack, lines)
+		shape(t.Elem(), path+"{}", stack, lines)
+	case reflect.Struct:
+		if stack[t] {
+			// 递归的类型只展开一次
+			emit("recursive " + t.Name())
+			return
+		}
+		stack[t] = true
+		defer delete(stack, t)
+		n := len(*lines)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() || strings.Split(f.Tag.Get("json"), ",")[0] == "-" {
+				continue
+			}
+			p := f.Name
+			if path != "" {
+				p = path + "." + f.Name
+			}
+			shape(f.Type, p, stack, lines)
+		}
+		if len(*lines) == n {
+			emit("struct{}")
+		}
+	default:
+		emit(t.Kind().String())
+	}
+}
+
+// 比较两个结构描述 返回差异的说明 want 为期望的一方 一致时返回空
+func DiffShapes(want, got []string) []string {
+	split := func(lines []string) map[string]string {
+		m := make(map[string]string, len(lines))
+		for _, line := range lines {
+			path, typ, _ := strings.Cut(line, " ")
+			m[path] = typ
+		}
+		return m
+	}
+	w, g := split(want), split(got)
+	var diffs []string
+	for path, wt := range w {
+		gt, ok := g[path]
+		switch {
+		case !ok:
+			diffs = append(diffs, "missing "+path+" "+wt)
+		case gt != wt:
+			diffs = append(diffs, path+": "+gt+" != "+wt)
+		}
+	}
+	for path, gt := range g {
+		if _, ok := w[path]; !ok {
+			diffs = append(diffs, "unexpected "+path+" "+gt)
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+方法级的版本 在方法的文档注释中标注 @version N (1 <= N <= 255)
+	// Add 的第二版 结果改为 int64
+	// @version 2
+	func (m Math) AddV2(args Args, reply *int64) error
+客户端以 Math.Add@2 调用 方法名以 V<N> 结尾时版本化的名称去掉该后缀 否则沿用方法名 Math.AddV2 仍可直接调用
+注释从方法所在的源文件读取 运行环境没有源文件时标注不生效 此时可用 Server.RegisterVersion 整体登记一个版本
+*/
+
+// 方法名与版本的分隔符
+const VersionSep = "@"
+
+var versionPattern = regexp.MustCompile(`(?m)^\s*@version\s+(\S+)\s*$`)
+
+// 以 VersionSep 拼接的名称 name 以 V<version> 结尾时去掉后缀
+func VersionedName(name string, version uint8) string {
+	if base := strings.TrimSuffix(name, "V"+strconv.Itoa(int(version))); base != "" {
+		name = base
+	}
+	return name + VersionSep + strconv.Itoa(int(version))
+}
+
+// 拆分 Add@2 为 Add 与 2 没有合法的版本后缀时 ok 为 false
+func SplitVersion(name string) (base string, version uint8, ok bool) {
+	i := strings.LastIndex(name, VersionSep)
+	if i <= 0 {
+		return name, 0, false
+	}
+	v, err := strconv.ParseUint(name[i+1:], 10, 8)
+	if err != nil || v == 0 {
+		return name, 0, false
+	}
+	return name[:i], uint8(v), true
+}
+
+// 文档注释中标注的版本 没有标注或标注不合法时为 0
+func parseVersion(doc string) uint8 {
+	m := versionPattern.FindStringSubmatch(doc)
+	if m == nil {
+		return 0
+	}
+	v, err := strconv.ParseUint(m[1], 10, 8)
+	if err != nil || v == 0 {
+		log.Printf("rpc service: invalid @version %q\n", m[1])
+		return 0
+	}
+	return uint8(v)
+}
+
+var sourceFiles sync.Map // 文件名 -> *ast.File 解析失败时为 nil
+
+// 按方法的代码地址找到源文件 读取方法的文档注释 找不到时为空
+func methodDoc(typ reflect.Type, method reflect.Method) string {
+	// 值接收者的方法在指针类型的方法集中是自动生成的包装 没有源码位置
+	if typ.Kind() == reflect.Ptr {
+		if m, ok := typ.Elem().MethodByName(method.Name); ok {
+			method = m
+		}
+		typ = typ.Elem()
+	}
+	fn := runtime.FuncForPC(method.Func.Pointer())
+	if fn == nil {
+		return ""
+	}
+	file, _ := fn.FileLine(fn.Entry())
+	f := parseSource(file)
+	if f == nil {
+		return ""
+	}
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Recv == nil || fd.Name.Name != method.Name || fd.Doc == nil {
+			continue
+		}
+		if receiverName(fd.Recv.List[0].Type) == typ.Name() {
+			return fd.Doc.Text()
+		}
+	}
+	return ""
+}
+
+func parseSource(file string) *ast.File {
+	if f, ok := sourceFiles.Load(file); ok {
+		return f.(*ast.File)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		f = nil
+	}
+	sourceFiles.Store(file, f)
+	return f
+}
+
+// 接收者的类型名 T 与 *T 都返回 T
+func receiverName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if id, ok := expr.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// 服务中出现的版本 升序
+func (s *service) Versions() []uint8 {
+	seen := make(map[uint8]bool)
+	var versions []uint8
+	for _, mt := range s.Method {
+		if mt.Version > 0 && !seen[mt.Version] {
+			seen[mt.Version] = true
+			versions = append(versions, mt.Version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+// 由版本为 version 的方法组成的服务 名称为 Name@version 方法以去掉 V<version> 后缀的名称为键
+// 与原服务共用方法与接收者 已包装的中间件不会重复包装
+func (s *service) VersionService(version uint8) *service {
+	v := &service{
+		Name:     s.Name + VersionSep + strconv.Itoa(int(version)),
+		typ:      s.typ,
+		receiver: s.receiver,
+		Method:   make(map[string]*methodType),
+	}
+	for name, mt := range s.Method {
+		if mt.Version == version {
+			base, _, _ := SplitVersion(VersionedName(name, version))
+			v.Method[base] = mt
+		}
+	}
+	return v
+}
@@ -0,0 +1,53 @@
+package service
+
+import "testing"
+
+type Shapes int
+
+// Area 面积
+func (s *Shapes) Area(args Args, reply *int) error {
+	*reply = args.Num1 * args.Num2
+	return nil
+}
+
+// AreaV2 面积 结果带单位
+//
+// @version 2
+func (s *Shapes) AreaV2(args Args, reply *string) error {
+	return nil
+}
+
+// 值接收者 注册时传入指针
+// @version 7
+func (s Shapes) Perimeter(args Args, reply *int) error {
+	*reply = 2 * (args.Num1 + args.Num2)
+	return nil
+}
+
+func TestService_Versions(t *testing.T) {
+	s := NewService(new(Shapes))
+	_assert(s.Method["Area"].Version == 0, "expect Area unversioned")
+	_assert(s.Method["AreaV2"].Version == 2, "expect AreaV2 version 2, got %d", s.Method["AreaV2"].Version)
+	_assert(s.Method["Perimeter"].Version == 7, "expect Perimeter version 7, got %d", s.Method["Perimeter"].Version)
+
+	versions := s.Versions()
+	_assert(len(versions) == 2 && versions[0] == 2 && versions[1] == 7, "unexpected versions %v", versions)
+	v2 := s.VersionService(2)
+	_assert(v2.Name == "Shapes@2" && len(v2.Method) == 1 && v2.Method["Area"] == s.Method["AreaV2"], "unexpected version service %s %v", v2.Name, v2.Method)
+	_assert(s.VersionService(7).Method["Perimeter"] == s.Method["Perimeter"], "expect Perimeter in version 7")
+}
+
+func TestVersionedName(t *testing.T) {
+	for name, want := range map[string]string{"AddV2": "Add@2", "Add": "Add@2", "V2": "V2@2", "AddV12": "AddV12@2"} {
+		got := VersionedName(name, 2)
+		_assert(got == want, "%s: expect %s, got %s", name, want, got)
+	}
+	for name, want := range map[string]uint8{"Add@2": 2, "Add@255": 255, "Add@0": 0, "Add@256": 0, "Add@x": 0, "@2": 0, "Add": 0} {
+		base, v, ok := SplitVersion(name)
+		_assert(v == want && ok == (want > 0), "%s: expect %d, got %d", name, want, v)
+		_assert(!ok || base == "Add", "%s: unexpected base %s", name, base)
+	}
+	_assert(parseVersion("Add 加法\n@version 3\n") == 3, "expect version 3")
+	_assert(parseVersion("see @version 3 in docs\n") == 0, "annotation must be on its own line")
+	_assert(parseVersion("@version 300\n") == 0, "expect 0 for out of range version")
+}
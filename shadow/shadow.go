@@ -0,0 +1,287 @@
+package shadow
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/codec"
+	"gmrpc/metadata"
+	"gmrpc/server"
+	"gmrpc/service"
+	"log"
+	"path"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+影子流量 主处理函数返回后把请求复制一份 经有界队列异步发往影子服务端 响应仍只来自主处理函数
+影子的结果只用于统计耗时与比较差异 队列满时丢弃 影子服务端不可用时不影响主请求
+拦截器返回前以 gob 复制参数与结果 之后服务端可以放回池中复用 外层拦截器与编码器读取的仍是原值
+*/
+
+var ErrClosed = errors.New("rpc shadow: closed")
+
+// 一次影子调用的结果 Primary 与 Shadow 为指向结果的指针
+type Result struct {
+	ServiceMethod string
+	Args          interface{}
+	Primary       interface{}
+	Shadow        interface{}
+	PrimaryErr    error
+	ShadowErr     error
+	Latency       time.Duration // 影子调用的耗时
+}
+
+// 比较两边的结果 一致时返回空字符串 只在两边都成功时调用
+type Comparer func(r *Result) string
+
+type Config struct {
+	Network string         // 默认 tcp
+	Addr    string         // 影子服务端地址
+	Option  *server.Option // 连接影子服务端的选项 为空时使用默认选项
+	Methods []string       // 需要复制的方法名 通配符语义同 path.Match 如 "Math.*"
+
+	QueueSize   int           // 等待发送的请求数上限 默认 1024
+	Concurrency int           // 同时进行的影子调用数 默认 4
+	Timeout     time.Duration // 单次影子调用的超时 默认 1s
+
+	Compare Comparer                     // 为空时使用 reflect.DeepEqual
+	OnDiff  func(r *Result, diff string) // 发现差异时调用 在发送影子请求的协程中执行
+}
+
+type Stats struct {
+	Mirrored uint64 // 已完成的影子调用
+	Dropped  uint64 // 队列已满或复制失败而丢弃的请求
+	Failed   uint64 // 影子调用返回错误而主处理函数成功
+	Diffs    uint64 // 结果不一致
+	P50, P99 time.Duration
+}
+
+type Shadower struct {
+	cfg   Config
+	queue chan *mirror
+
+	mu     sync.Mutex
+	client *client.Client // 为空或不可用时在发送前重新连接
+
+	mirrored, dropped, failed, diffs uint64
+	latency                          service.LatencyTracker
+
+	closing chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+// 等待发送的请求 参数与结果都是副本
+type mirror struct {
+	method     string
+	md         metadata.MD
+	args       interface{}
+	reply      interface{} // 指针 主处理函数失败时为空
+	replyType  reflect.Type
+	primaryErr error
+}
+
+func New(cfg Config) *Shadower {
+	if cfg.Network == "" {
+		cfg.Network = "tcp"
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 4
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second
+	}
+	s := &Shadower{
+		cfg:     cfg,
+		queue:   make(chan *mirror, cfg.QueueSize),
+		closing: make(chan struct{}),
+	}
+	for i := 0; i < cfg.Concurrency; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	return s
+}
+
+// 服务端拦截器 主处理函数返回后复制请求 不改变它的结果
+func (s *Shadower) Interceptor() server.ServerInterceptor {
+	return func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		err := handler(ctx, argv, replyv)
+		if s.match(info.ServiceMethod) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			s.enqueue(info, md, argv, replyv, err)
+		}
+		return err
+	}
+}
+
+func (s *Shadower) match(method string) bool {
+	for _, pattern := range s.cfg.Methods {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Shadower) enqueue(info *server.MethodInfo, md metadata.MD, argv, replyv interface{}, err error) {
+	// 分帧方式与剩余时间由影子连接自己决定
+	md = md.Copy()
+	for _, k := range []string{codec.StreamMetadataKey, codec.ChunkedMetadataKey, server.TimeoutKey} {
+		delete(md, k)
+	}
+	m := &mirror{method: info.ServiceMethod, md: md, replyType: reflect.TypeOf(replyv).Elem(), primaryErr: err}
+	var cerr error
+	if m.args, cerr = clone(argv); cerr == nil && err == nil {
+		m.reply, cerr = clone(replyv)
+	}
+	if cerr != nil {
+		log.Printf("rpc shadow: copy %s error: %v", info.ServiceMethod, cerr)
+		atomic.AddUint64(&s.dropped, 1)
+		return
+	}
+	select {
+	case s.queue <- m:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// 以 gob 编码再解码 得到与 v 类型相同的副本
+func clone(v interface{}) (interface{}, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).EncodeValue(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	c := reflect.New(reflect.TypeOf(v))
+	if err := gob.NewDecoder(&buf).DecodeValue(c); err != nil {
+		return nil, err
+	}
+	return c.Elem().Interface(), nil
+}
+
+func (s *Shadower) worker() {
+	defer s.wg.Done()
+	for {
+		select {
+		case m := <-s.queue:
+			s.send(m)
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+func (s *Shadower) send(m *mirror) {
+	r := &Result{ServiceMethod: m.method, Args: m.args, Primary: m.reply, PrimaryErr: m.primaryErr}
+	r.Shadow = reflect.New(m.replyType).Interface()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
+	defer cancel()
+	if m.md != nil {
+		ctx = metadata.NewOutgoingContext(ctx, m.md)
+	}
+	start := time.Now()
+	c, err := s.dial()
+	if err == nil {
+		r.ShadowErr = c.Call(ctx, m.method, r.Args, r.Shadow)
+	} else {
+		r.ShadowErr = err
+	}
+	r.Latency = time.Since(start)
+	s.latency.Record(r.Latency.Nanoseconds())
+	s.compare(r)
+	atomic.AddUint64(&s.mirrored, 1)
+}
+
+func (s *Shadower) compare(r *Result) {
+	var diff string
+	switch {
+	case r.PrimaryErr == nil && r.ShadowErr != nil:
+		atomic.AddUint64(&s.failed, 1)
+		diff = "shadow error: " + r.ShadowErr.Error()
+	case r.PrimaryErr != nil && r.ShadowErr == nil:
+		diff = "primary error: " + r.PrimaryErr.Error()
+	case r.PrimaryErr != nil:
+		// 两边都失败 不比较错误内容
+		return
+	case s.cfg.Compare != nil:
+		diff = s.cfg.Compare(r)
+	case !reflect.DeepEqual(r.Primary, r.Shadow):
+		diff = fmt.Sprintf("reply %+v != %+v", reflect.ValueOf(r.Shadow).Elem(), reflect.ValueOf(r.Primary).Elem())
+	}
+	if diff == "" {
+		return
+	}
+	atomic.AddUint64(&s.diffs, 1)
+	if s.cfg.OnDiff != nil {
+		s.cfg.OnDiff(r, diff)
+	}
+}
+
+// 复用已有的连接 不可用时重新连接 拨号时不持有锁 其他发送协程不必等待
+func (s *Shadower) dial() (*client.Client, error) {
+	s.mu.Lock()
+	old := s.client
+	s.mu.Unlock()
+	if old != nil && old.IsAvailable() {
+		return old, nil
+	}
+	var opts []*server.Option
+	if s.cfg.Option != nil {
+		opts = append(opts, s.cfg.Option)
+	}
+	c, err := client.Dial(s.cfg.Network, s.cfg.Addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 其他协程已经换上了可用的连接
+	if s.client != old && s.client != nil && s.client.IsAvailable() {
+		_ = c.Close()
+		return s.client, nil
+	}
+	if s.client != nil {
+		_ = s.client.Close()
+	}
+	s.client = c
+	return c, nil
+}
+
+func (s *Shadower) Stats() Stats {
+	return Stats{
+		Mirrored: atomic.LoadUint64(&s.mirrored),
+		Dropped:  atomic.LoadUint64(&s.dropped),
+		Failed:   atomic.LoadUint64(&s.failed),
+		Diffs:    atomic.LoadUint64(&s.diffs),
+		P50:      s.latency.Percentile(50),
+		P99:      s.latency.Percentile(99),
+	}
+}
+
+// 停止发送 队列中的请求被丢弃 等待进行中的影子调用结束后关闭连接
+func (s *Shadower) Close() error {
+	err := ErrClosed
+	s.once.Do(func() {
+		err = nil
+		close(s.closing)
+		s.wg.Wait()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.client != nil {
+			_ = s.client.Close()
+		}
+	})
+	return err
+}
@@ -0,0 +1,164 @@
+package shadow
+
+import (
+	"context"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+// 影子服务端的实现对大数给出错误的结果
+type Math struct {
+	rewrite bool
+	delay   time.Duration
+}
+
+type Args struct {
+	A, B int
+}
+
+func (m *Math) Add(args Args, reply *int) error {
+	time.Sleep(m.delay)
+	*reply = args.A + args.B
+	if m.rewrite && args.A > 100 {
+		*reply++
+	}
+	return nil
+}
+
+func (m *Math) Echo(s string, reply *string) error {
+	*reply = s
+	return nil
+}
+
+func serve(t *testing.T, s *server.Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen error: %v", err)
+	go s.Accept(l)
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+	return l.Addr().String()
+}
+
+// 主服务端使用影子拦截器 返回主服务端的客户端
+func primary(t *testing.T, sh *Shadower) *client.Client {
+	s := server.NewServer()
+	_ = s.Register(&Math{})
+	s.Use(sh.Interceptor())
+	c, err := client.Dial("tcp", serve(t, s))
+	_assert(err == nil, "dial error: %v", err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func waitFor(cond func() bool, what string) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		_assert(time.Now().Before(deadline), "timed out waiting for %s", what)
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestShadower_MirrorsAndReportsDiffs(t *testing.T) {
+	ss := server.NewServer()
+	_ = ss.Register(&Math{rewrite: true})
+	var mu sync.Mutex
+	var diffs []string
+	sh := New(Config{
+		Addr:    serve(t, ss),
+		Methods: []string{"Math.Add"},
+		OnDiff: func(r *Result, diff string) {
+			mu.Lock()
+			defer mu.Unlock()
+			diffs = append(diffs, fmt.Sprintf("%v: %s", r.Args, diff))
+		},
+	})
+	defer func() { _ = sh.Close() }()
+	c := primary(t, sh)
+
+	for _, a := range []int{1, 2, 200, 3} {
+		var reply int
+		err := c.Call(context.Background(), "Math.Add", Args{A: a, B: 1}, &reply)
+		_assert(err == nil && reply == a+1, "primary reply changed: %d (%v)", reply, err)
+	}
+	// 不在列表中的方法不复制
+	var echo string
+	_assert(c.Call(context.Background(), "Math.Echo", "hi", &echo) == nil && echo == "hi", "echo failed")
+
+	waitFor(func() bool { return sh.Stats().Mirrored == 4 }, "mirrored calls")
+	waitFor(func() bool { return sh.Stats().Diffs == 1 }, "diff")
+	mu.Lock()
+	_assert(len(diffs) == 1 && strings.Contains(diffs[0], "{200 1}") && strings.Contains(diffs[0], "202 != 201"), "unexpected diffs %q", diffs)
+	mu.Unlock()
+	st := sh.Stats()
+	_assert(st.Failed == 0 && st.Dropped == 0 && st.P99 > 0, "unexpected stats %+v", st)
+}
+
+// 影子服务端不可用或很慢时 主请求的结果与耗时不受影响 超出队列的请求被丢弃
+func TestShadower_NoPrimaryImpact(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	dead := l.Addr().String()
+	_ = l.Close()
+
+	slow := server.NewServer()
+	_ = slow.Register(&Math{delay: 300 * time.Millisecond})
+
+	for _, tc := range []struct {
+		name, addr string
+		drops      bool // 慢的影子调用占住发送协程 队列很快被填满
+	}{
+		{"dead", dead, false},
+		{"slow", serve(t, slow), true},
+	} {
+		name := tc.name
+		sh := New(Config{Addr: tc.addr, Methods: []string{"Math.*"}, QueueSize: 2, Concurrency: 1, Timeout: 100 * time.Millisecond})
+		c := primary(t, sh)
+		const n = 20
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			var reply int
+			err := c.Call(context.Background(), "Math.Add", Args{A: i, B: i}, &reply)
+			_assert(err == nil && reply == 2*i, "%s: primary call failed: %d (%v)", name, reply, err)
+		}
+		_assert(time.Since(start) < 250*time.Millisecond, "%s: primary calls slowed down: %v", name, time.Since(start))
+
+		waitFor(func() bool { st := sh.Stats(); return st.Mirrored+st.Dropped == n }, name+" shadow calls")
+		st := sh.Stats()
+		_assert(st.Failed == st.Mirrored && (st.Dropped > 0) == tc.drops, "%s: unexpected stats %+v", name, st)
+		_ = sh.Close()
+	}
+}
+
+// 排队的是副本 参数与结果放回池中被之后的请求复用 影子调用很慢时也没有虚假的差异
+func TestShadower_CopiesQueuedValues(t *testing.T) {
+	ss := server.NewServer()
+	_ = ss.Register(&Math{delay: 10 * time.Millisecond})
+	sh := New(Config{Addr: serve(t, ss), Methods: []string{"Math.Add"}, QueueSize: 32, Concurrency: 1})
+	defer func() { _ = sh.Close() }()
+	c := primary(t, sh)
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		var reply int
+		_assert(c.Call(context.Background(), "Math.Add", Args{A: i, B: 1}, &reply) == nil, "primary call failed")
+	}
+	waitFor(func() bool { return sh.Stats().Mirrored == n }, "mirrored calls")
+	st := sh.Stats()
+	_assert(st.Diffs == 0 && st.Failed == 0 && st.Dropped == 0, "unexpected stats %+v", st)
+}
@@ -0,0 +1,103 @@
+package signing
+
+import (
+	"context"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Args struct{ Num1, Num2 int }
+
+type Calc int
+
+func (c Calc) Add(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func TestSigning(t *testing.T) {
+	s := server.NewServer()
+	_ = s.Register(new(Calc))
+	s.Use(NewVerifyInterceptor(VerifierConfig{Keys: map[string][]byte{
+		"k1": []byte("old secret"),
+		"k2": []byte("new secret"),
+	}}))
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+
+	call := func(hook codec.BodyHook, codecType codec.Type) (int, error) {
+		opt := &server.Option{MagicNumber: server.MagicNumber, CodecType: codecType, HeaderType: codec.BinaryHeader}
+		c, err := client.Dial("tcp", l.Addr().String(), opt)
+		_assert(err == nil, "dial error: %v", err)
+		defer func() { _ = c.Close() }()
+		c.Apply(client.WithBodyHook(hook))
+		var reply int
+		err = c.Call(context.Background(), "Calc.Add", Args{Num1: 1, Num2: 2}, &reply)
+		return reply, err
+	}
+	isUnauthenticated := func(err error) bool {
+		return rpcerr.CodeOf(err) == rpcerr.Unauthenticated
+	}
+
+	// 轮换期间新旧密钥都有效
+	for _, id := range []string{"k1", "k2"} {
+		key := map[string]string{"k1": "old secret", "k2": "new secret"}[id]
+		for _, ct := range []codec.Type{codec.GobType, codec.JsonType} {
+			reply, err := call((&Signer{KeyID: id, Key: []byte(key)}).Sign, ct)
+			_assert(err == nil && reply == 3, "%s/%s: valid signature should pass, got %d (%v)", id, ct, reply, err)
+		}
+	}
+
+	signer := &Signer{KeyID: "k2", Key: []byte("new secret")}
+	_, err := call(func(h *codec.Header, body []byte) {
+		// 签名的字节与发送的不同
+		signer.Sign(h, append(append([]byte(nil), body...), ' '))
+	}, codec.JsonType)
+	_assert(isUnauthenticated(err), "tampered body should be rejected, got %v", err)
+
+	stale := &Signer{KeyID: "k2", Key: []byte("new secret"), Now: func() time.Time { return time.Now().Add(-time.Minute) }}
+	_, err = call(stale.Sign, codec.GobType)
+	_assert(isUnauthenticated(err), "stale timestamp should be rejected, got %v", err)
+
+	_, err = call((&Signer{KeyID: "k3", Key: []byte("new secret")}).Sign, codec.GobType)
+	_assert(isUnauthenticated(err), "unknown key id should be rejected, got %v", err)
+	_, err = call((&Signer{KeyID: "k1", Key: []byte("new secret")}).Sign, codec.GobType)
+	_assert(isUnauthenticated(err), "wrong key for the id should be rejected, got %v", err)
+
+	_, err = call(nil, codec.GobType)
+	_assert(isUnauthenticated(err), "unsigned request should be rejected, got %v", err)
+
+	// 合并格式无法对消息体签名 请求不带签名
+	c, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = c.Close() }()
+	c.Apply(signer.ClientOption())
+	err = c.Call(context.Background(), "Calc.Add", Args{Num1: 1, Num2: 2}, new(int))
+	_assert(isUnauthenticated(err), "combined format should not be signed, got %v", err)
+}
+
+// Seq 参与签名 同一签名不能用于其他请求
+func TestDigest_BindsSeq(t *testing.T) {
+	key := []byte("k")
+	_assert(Digest(key, "Calc.Add", 1, 10, nil) != Digest(key, "Calc.Add", 2, 10, nil), "seq should be signed")
+	_assert(Digest(key, "Calc.Add", 1, 10, nil) != Digest(key, "Calc.Ad", 1, 10, []byte("d")), "method and body should be separated")
+}
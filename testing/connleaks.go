@@ -0,0 +1,139 @@
+package rpctesting
+
+import (
+	"gmrpc/client"
+	"gmrpc/server"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+连接泄漏检测 包名为 rpctesting 避免与标准库 testing 冲突
+监听器与拨号器包装连接 统计打开与关闭的次数
+对端关闭连接是异步的 AssertNoLeaks 会等待一小段时间再判断
+*/
+
+const leakWait = time.Second
+
+type counter struct {
+	opened int64
+	closed int64
+}
+
+func (c *counter) track(conn net.Conn) net.Conn {
+	atomic.AddInt64(&c.opened, 1)
+	return &trackedConn{Conn: conn, counter: c}
+}
+
+// 未关闭的连接数
+func (c *counter) Leaked() int64 {
+	return atomic.LoadInt64(&c.opened) - atomic.LoadInt64(&c.closed)
+}
+
+func (c *counter) assertNoLeaks(t testing.TB, kind string) {
+	t.Helper()
+	deadline := time.Now().Add(leakWait)
+	for c.Leaked() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := c.Leaked(); n != 0 {
+		t.Errorf("rpc testing: %d %s connection(s) not closed (opened %d, closed %d)",
+			n, kind, atomic.LoadInt64(&c.opened), atomic.LoadInt64(&c.closed))
+	}
+}
+
+// 多次关闭只计一次
+type trackedConn struct {
+	net.Conn
+	counter *counter
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { atomic.AddInt64(&c.counter.closed, 1) })
+	return c.Conn.Close()
+}
+
+type TrackingListener struct {
+	net.Listener
+	counter
+}
+
+func NewTrackingListener(l net.Listener) *TrackingListener {
+	return &TrackingListener{Listener: l}
+}
+
+func (l *TrackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.track(conn), nil
+}
+
+func (l *TrackingListener) AssertNoLeaks(t testing.TB) {
+	t.Helper()
+	l.assertNoLeaks(t, "accepted")
+}
+
+type TrackingDialer struct {
+	net.Dialer
+	counter
+}
+
+func (d *TrackingDialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := d.Dialer.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return d.track(conn), nil
+}
+
+func (d *TrackingDialer) AssertNoLeaks(t testing.TB) {
+	t.Helper()
+	d.assertNoLeaks(t, "dialed")
+}
+
+// 在本地端口上启动服务端 返回的函数关闭监听
+func NewTrackingServer(s *server.Server) (*TrackingListener, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("rpc testing: listen error: " + err.Error())
+	}
+	tl := NewTrackingListener(l)
+	go s.Accept(tl)
+	return tl, func() { _ = l.Close() }
+}
+
+// 与 client.NewClient 相同的签名 例如 client.NewHTTPClientWithHeaders
+type NewClientFunc func(conn net.Conn, opt *server.Option) (*client.Client, error)
+
+type DialFunc func(network, address string, opt *server.Option) (*client.Client, error)
+
+// 返回通过 TrackingDialer 建立连接的拨号函数 f 为空时使用 client.NewClient
+func NewTrackingDial(f NewClientFunc) (*TrackingDialer, DialFunc) {
+	if f == nil {
+		f = func(conn net.Conn, opt *server.Option) (*client.Client, error) {
+			return client.NewClient(conn, opt)
+		}
+	}
+	d := new(TrackingDialer)
+	return d, func(network, address string, opt *server.Option) (*client.Client, error) {
+		if opt == nil {
+			opt = server.DefaultOption
+		}
+		conn, err := d.Dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		c, err := f(conn, opt)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return c, nil
+	}
+}
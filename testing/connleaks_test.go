@@ -0,0 +1,70 @@
+package rpctesting
+
+import (
+	"context"
+	"fmt"
+	"gmrpc/server"
+	"strings"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Echo int
+
+func (e Echo) Say(s string, reply *string) error {
+	*reply = s
+	return nil
+}
+
+// 记录失败信息 不终止测试
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestConnLeaks(t *testing.T) {
+	s := server.NewServer()
+	_ = s.Register(new(Echo))
+	l, stop := NewTrackingServer(s)
+	defer stop()
+	dialer, dial := NewTrackingDial(nil)
+
+	c, err := dial("tcp", l.Addr().String(), nil)
+	_assert(err == nil, "dial error: %v", err)
+	var reply string
+	err = c.Call(context.Background(), "Echo.Say", "hi", &reply)
+	_assert(err == nil && reply == "hi", "unexpected reply %q (%v)", reply, err)
+	_ = c.Close()
+	l.AssertNoLeaks(t)
+	dialer.AssertNoLeaks(t)
+
+	// 忘记关闭的客户端会被发现
+	leaky, err := dial("tcp", l.Addr().String(), nil)
+	_assert(err == nil, "dial error: %v", err)
+	r := new(recorder)
+	dialer.AssertNoLeaks(r)
+	l.AssertNoLeaks(r)
+	_assert(len(r.errors) == 2, "expect both sides to report the leak, got %v", r.errors)
+	_assert(strings.Contains(r.errors[0], "1 dialed connection(s) not closed"), "unexpected message %q", r.errors[0])
+
+	_ = leaky.Close()
+	l.AssertNoLeaks(t)
+	dialer.AssertNoLeaks(t)
+}
@@ -0,0 +1,25 @@
+package rpctesting
+
+import (
+	"context"
+	"gmrpc/client"
+	"gmrpc/codec"
+	"gmrpc/server"
+)
+
+// 不启动服务端 以模拟的 MethodInfo 调用一次拦截器 handler 为空时直接返回 nil
+func RunServerInterceptor(interceptor server.ServerInterceptor, method string, args, reply interface{}, handler server.UnaryHandler) error {
+	if handler == nil {
+		handler = func(context.Context, interface{}, interface{}) error { return nil }
+	}
+	info := &server.MethodInfo{ServiceMethod: method, Header: &codec.Header{ServiceMethod: method}}
+	return interceptor(context.Background(), info, args, reply, handler)
+}
+
+// 不发起真实调用 以 invoker 代替后续的调用链 client 可以为空 invoker 为空时直接返回 nil
+func RunClientInterceptor(interceptor client.ClientInterceptor, c *client.Client, method string, args, reply interface{}, invoker client.UnaryInvoker) error {
+	if invoker == nil {
+		invoker = func(context.Context, string, interface{}, interface{}) error { return nil }
+	}
+	return interceptor(context.Background(), c, method, args, reply, invoker)
+}
@@ -0,0 +1,54 @@
+package rpctesting
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/logger"
+	"gmrpc/server"
+	"strings"
+	"testing"
+)
+
+// 记录方法名与结果的服务端拦截器
+func loggingInterceptor(l logger.Logger) server.ServerInterceptor {
+	return func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		err := handler(ctx, argv, replyv)
+		l.Info("%s args=%v err=%v", info.ServiceMethod, argv, err)
+		return err
+	}
+}
+
+func TestRunServerInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	var reply int
+	err := RunServerInterceptor(loggingInterceptor(logger.New(&buf)), "Math.Add", [2]int{1, 2}, &reply,
+		func(ctx context.Context, argv, replyv interface{}) error {
+			a := argv.([2]int)
+			*replyv.(*int) = a[0] + a[1]
+			return nil
+		})
+	_assert(err == nil && reply == 3, "unexpected result %d (%v)", reply, err)
+	_assert(strings.Contains(buf.String(), "Math.Add args=[1 2] err=<nil>"), "unexpected log %q", buf.String())
+
+	buf.Reset()
+	boom := errors.New("boom")
+	err = RunServerInterceptor(loggingInterceptor(logger.New(&buf)), "Math.Div", 0, &reply,
+		func(context.Context, interface{}, interface{}) error { return boom })
+	_assert(err == boom && strings.Contains(buf.String(), "Math.Div args=0 err=boom"), "unexpected log %q (%v)", buf.String(), err)
+	_assert(RunServerInterceptor(loggingInterceptor(logger.New(&buf)), "Math.Nop", nil, nil, nil) == nil, "nil handler should succeed")
+}
+
+func TestRunClientInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	var reply string
+	err := RunClientInterceptor(client.WithResponseLogging(logger.New(&buf)), nil, "Echo.Say", "hi", &reply,
+		func(ctx context.Context, method string, args, reply interface{}) error {
+			*reply.(*string) = fmt.Sprint(args)
+			return nil
+		})
+	_assert(err == nil && reply == "hi", "unexpected result %q (%v)", reply, err)
+	_assert(strings.Contains(buf.String(), "rpc client: Echo.Say reply: hi"), "unexpected log %q", buf.String())
+}
@@ -0,0 +1,425 @@
+package rpctesting
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+录制与回放 录制时客户端拦截器保存每次调用的方法名 参数与结果 回放时 MockServer 按方法名与参数返回录制的结果
+参数与结果以 json 编码保存 与录制时客户端使用的编解码类型无关 因此回放时客户端需使用 json 编码 (MockOption)
+文件每行一条 json 记录 参数与结果为 base64 编码的 json
+	{"method":"Foo.Sum","args":"eyJOdW0xIjoxLCJOdW0yIjoyfQ==","reply":"Mw=="}
+找不到匹配的记录时返回 NotFound 错误 并给出同一方法下最接近的记录与参数的差异
+*/
+
+type Recording struct {
+	ServiceMethod string           `json:"method"`
+	Args          []byte           `json:"args"`
+	Reply         []byte           `json:"reply,omitempty"`
+	Error         string           `json:"error,omitempty"`  // 服务端返回的错误信息
+	Status        *rpcerr.RPCError `json:"status,omitempty"` // 结构化错误
+}
+
+// 方法名与规范化后的参数的摘要 回放时据此匹配
+func (r *Recording) Key() string {
+	return recordingKey(r.ServiceMethod, r.Args)
+}
+
+func recordingKey(method string, args []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(method + "\n"))
+	sum.Write(canonicalJSON(args))
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// 对象的键排序 数字保持原样 无法解析时原样返回
+func canonicalJSON(data []byte) []byte {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return data
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// 录制调用 每次调用结束时写入一行
+type Recorder struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// 客户端拦截器 调用方的 ctx 结束或连接断开等本地错误不录制
+func (r *Recorder) Interceptor() client.ClientInterceptor {
+	return func(ctx context.Context, c *client.Client, serviceMethod string, args, reply interface{}, invoker client.UnaryInvoker) error {
+		err := invoker(ctx, serviceMethod, args, reply)
+		if ctx.Err() != nil || errors.Is(err, client.ErrShutdown) {
+			return err
+		}
+		if rerr := r.record(serviceMethod, args, reply, err); rerr != nil {
+			log.Println("rpc testing: record error:", rerr)
+		}
+		return err
+	}
+}
+
+func (r *Recorder) record(serviceMethod string, args, reply interface{}, callErr error) error {
+	rec := Recording{ServiceMethod: serviceMethod}
+	var err error
+	if rec.Args, err = json.Marshal(args); err != nil {
+		return err
+	}
+	if callErr != nil {
+		rec.Error = callErr.Error()
+		rec.Status, _ = rpcerr.FromError(callErr)
+	} else if rec.Reply, err = json.Marshal(reply); err != nil {
+		return err
+	}
+	line, err := json.Marshal(&rec)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.w.Write(append(line, '\n'))
+	return err
+}
+
+// 读取 Recorder 写入的记录
+func LoadRecordings(r io.Reader) ([]Recording, error) {
+	var recs []Recording
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var rec Recording
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("rpc testing: recording line %d: %w", line, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, sc.Err()
+}
+
+func LoadRecordingsFile(path string) ([]Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return LoadRecordings(f)
+}
+
+// 连接 MockServer 使用的选项
+var MockOption = &server.Option{
+	MagicNumber:     server.MagicNumber,
+	CodecType:       codec.JsonType,
+	ConnectTimeout:  10 * time.Second,
+	Capabilities:    true,
+	ProtocolVersion: server.ProtocolVersion,
+	Features:        server.SupportedFeatures,
+}
+
+// 回放录制的结果 与 server.Server 一样通过 Accept 或 ServeConn 提供服务
+// 同一请求有多条记录时按录制顺序依次返回 用完后重复最后一条
+type MockServer struct {
+	mu      sync.Mutex
+	recs    []Recording
+	byKey   map[string][]int // 记录的下标
+	used    map[string]int   // 每个键已返回的次数
+	misses  []string         // 没有匹配记录的请求
+	methods map[string][]string
+}
+
+func NewMockServer(recs []Recording) *MockServer {
+	m := &MockServer{
+		recs:    recs,
+		byKey:   make(map[string][]int),
+		used:    make(map[string]int),
+		methods: make(map[string][]string),
+	}
+	seen := make(map[string]bool)
+	for i := range recs {
+		key := recs[i].Key()
+		m.byKey[key] = append(m.byKey[key], i)
+		method := recs[i].ServiceMethod
+		if dot := strings.LastIndex(method, "."); dot > 0 && !seen[method] {
+			seen[method] = true
+			m.methods[method[:dot]] = append(m.methods[method[:dot]], method[dot+1:])
+		}
+	}
+	for _, methods := range m.methods {
+		sort.Strings(methods)
+	}
+	return m
+}
+
+func (m *MockServer) Accept(lis net.Listener) {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			log.Println("rpc testing: mock accept error:", err)
+			return
+		}
+		go m.ServeConn(conn)
+	}
+}
+
+// 读取缓冲区中的数据后再读连接
+type bufConn struct {
+	r *bufio.Reader
+	io.ReadWriteCloser
+}
+
+func (c *bufConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (m *MockServer) ServeConn(conn io.ReadWriteCloser) {
+	defer func() { _ = conn.Close() }()
+	br := bufio.NewReader(conn)
+	var opt server.Option
+	line, err := br.ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &opt)
+	}
+	if err != nil || opt.MagicNumber != server.MagicNumber {
+		log.Println("rpc testing: mock handshake error:", err)
+		return
+	}
+	if err := m.handshake(conn, &opt); err != nil {
+		log.Println("rpc testing: mock handshake error:", err)
+		return
+	}
+	cc, err := codec.DefaultCodecRegistry.New(&bufConn{r: br, ReadWriteCloser: conn}, opt.HeaderType, opt.CodecType)
+	if err != nil {
+		log.Println("rpc testing: mock codec error:", err)
+		return
+	}
+	for {
+		var h codec.Header
+		if err := cc.ReadHeader(&h); err != nil {
+			return
+		}
+		var args json.RawMessage
+		if err := cc.ReadBody(&args); err != nil {
+			return
+		}
+		if h.ServiceMethod == server.CancelMethod {
+			// 回放是同步的 没有可以取消的请求
+			continue
+		}
+		rec, err := m.match(h.ServiceMethod, args)
+		h.Metadata = nil
+		var body interface{} = struct{}{}
+		switch {
+		case err != nil:
+			h.Error, h.Status = err.Error(), err
+		case rec.Error != "":
+			h.Error, h.Status = rec.Error, rec.Status
+		default:
+			body = json.RawMessage(rec.Reply)
+		}
+		if err := cc.Write(&h, body); err != nil {
+			return
+		}
+	}
+}
+
+// 只支持 json 消息体 不支持压缩 流式与分块参数
+func (m *MockServer) handshake(w io.Writer, opt *server.Option) error {
+	var bodyErr error
+	if opt.CodecType != codec.JsonType && opt.CodecType != codec.JSONRPC2Type {
+		bodyErr = fmt.Errorf("rpc testing: mock server needs a json codec, got %s (use rpctesting.MockOption)", opt.CodecType)
+	}
+	ack := server.NegotiateProtocol(opt.ProtocolVersion, opt.Features)
+	ack.Features &^= server.FeatureCompression | server.FeatureStreaming | server.FeatureChunkedArgs
+	var first *server.ProtocolAck
+	if opt.ProtocolVersion >= 2 {
+		first = &ack
+	}
+	enc := json.NewEncoder(w)
+	if opt.Capabilities {
+		if bodyErr != nil {
+			_ = enc.Encode(map[string]string{"error": bodyErr.Error()})
+			return bodyErr
+		}
+		m.mu.Lock()
+		caps := server.Capabilities{Services: m.methods}
+		err := enc.Encode(struct {
+			server.Capabilities
+			*server.ProtocolAck
+		}{caps, first})
+		m.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		first = nil
+	}
+	if opt.Compression != "" {
+		if bodyErr != nil {
+			_ = enc.Encode(map[string]string{"error": bodyErr.Error()})
+			return bodyErr
+		}
+		if err := enc.Encode(struct {
+			server.CompressionAck
+			*server.ProtocolAck
+		}{server.CompressionAck{}, first}); err != nil {
+			return err
+		}
+		first = nil
+	}
+	if first != nil {
+		if bodyErr != nil {
+			_ = enc.Encode(map[string]string{"error": bodyErr.Error()})
+			return bodyErr
+		}
+		if err := enc.Encode(first); err != nil {
+			return err
+		}
+	}
+	return bodyErr
+}
+
+func (m *MockServer) match(method string, args []byte) (*Recording, *rpcerr.RPCError) {
+	key := recordingKey(method, args)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if idx := m.byKey[key]; len(idx) > 0 {
+		n := m.used[key]
+		m.used[key]++
+		if n >= len(idx) {
+			n = len(idx) - 1
+		}
+		return &m.recs[idx[n]], nil
+	}
+	msg := fmt.Sprintf("rpc testing: no recording for %s %s", method, args)
+	if closest := m.closest(method, args); closest != "" {
+		msg += "\nclosest recording:\n" + closest
+	}
+	log.Println(msg)
+	m.misses = append(m.misses, msg)
+	return nil, rpcerr.New(rpcerr.NotFound, msg)
+}
+
+// 同一方法下参数差异最少的记录 返回差异的说明 没有该方法的记录时返回空
+func (m *MockServer) closest(method string, args []byte) string {
+	got := flattenJSON(args)
+	best, bestDiff := -1, []string(nil)
+	for i := range m.recs {
+		if m.recs[i].ServiceMethod != method {
+			continue
+		}
+		diff := diffLines(flattenJSON(m.recs[i].Args), got)
+		if best < 0 || len(diff) < len(bestDiff) {
+			best, bestDiff = i, diff
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	return fmt.Sprintf("  %s %s\n%s", method, m.recs[best].Args, strings.Join(bestDiff, "\n"))
+}
+
+// 展开为 路径=值 的行 按路径排序
+func flattenJSON(data []byte) []string {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return []string{"$=" + string(data)}
+	}
+	var lines []string
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			for k, e := range x {
+				walk(path+"."+k, e)
+			}
+		case []interface{}:
+			for i, e := range x {
+				walk(fmt.Sprintf("%s[%d]", path, i), e)
+			}
+		default:
+			b, _ := json.Marshal(x)
+			lines = append(lines, path+"="+string(b))
+		}
+	}
+	walk("$", v)
+	sort.Strings(lines)
+	return lines
+}
+
+// 以 - 表示只在录制中出现的行 + 表示只在请求中出现的行
+func diffLines(recorded, got []string) []string {
+	in := func(lines []string) map[string]bool {
+		m := make(map[string]bool, len(lines))
+		for _, l := range lines {
+			m[l] = true
+		}
+		return m
+	}
+	r, g := in(recorded), in(got)
+	var diff []string
+	for _, l := range recorded {
+		if !g[l] {
+			diff = append(diff, "  - "+l)
+		}
+	}
+	for _, l := range got {
+		if !r[l] {
+			diff = append(diff, "  + "+l)
+		}
+	}
+	return diff
+}
+
+// 没有匹配记录的请求 按到达顺序
+func (m *MockServer) Misses() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.misses...)
+}
+
+// 每个没有匹配记录的请求报告一次错误
+func (m *MockServer) AssertNoMisses(t testing.TB) {
+	t.Helper()
+	for _, miss := range m.Misses() {
+		t.Errorf("%s", miss)
+	}
+}
@@ -0,0 +1,103 @@
+package rpctesting
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"gmrpc/client"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"net"
+	"strings"
+	"testing"
+)
+
+type Foo int
+
+type Args struct {
+	Num1, Num2 int
+}
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (f Foo) Div(args Args, reply *int) error {
+	if args.Num2 == 0 {
+		return rpcerr.New(rpcerr.InvalidArgs, "divide by zero").WithDetail(rpcerr.DetailField, "Num2")
+	}
+	*reply = args.Num1 / args.Num2
+	return nil
+}
+
+// 应用代码 录制与回放时运行同一套调用
+func runSuite(c *client.Client) (sums []int, divErr error) {
+	for _, a := range []Args{{1, 2}, {10, 20}, {-5, 5}} {
+		var reply int
+		_ = c.Call(context.Background(), "Foo.Sum", a, &reply)
+		sums = append(sums, reply)
+	}
+	var reply int
+	divErr = c.Call(context.Background(), "Foo.Div", Args{Num1: 1}, &reply)
+	return sums, divErr
+}
+
+func TestRecordReplay(t *testing.T) {
+	// 录制 使用默认的 gob 编码访问真实的服务端
+	s := server.NewServer()
+	_ = s.Register(new(Foo))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen error: %v", err)
+	go s.Accept(l)
+
+	var file bytes.Buffer
+	c, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	c.Use(NewRecorder(&file).Interceptor())
+	wantSums, wantErr := runSuite(c)
+	_ = c.Close()
+	_ = s.Shutdown(context.Background())
+	_assert(len(strings.Split(strings.TrimSpace(file.String()), "\n")) == 4, "unexpected recording:\n%s", file.String())
+
+	// 回放 没有网络 通过内存管道连接 MockServer
+	recs, err := LoadRecordings(&file)
+	_assert(err == nil && len(recs) == 4, "load error: %v (%d recordings)", err, len(recs))
+	mock := NewMockServer(recs)
+	cliConn, srvConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mock.ServeConn(srvConn)
+	}()
+	c, err = client.NewClient(cliConn, MockOption)
+	_assert(err == nil, "mock client error: %v", err)
+	_assert(c.HasMethod("Foo.Sum") && c.HasMethod("Foo.Div"), "unexpected capabilities %v", c.Capabilities())
+
+	gotSums, gotErr := runSuite(c)
+	_assert(len(gotSums) == len(wantSums), "unexpected sums %v", gotSums)
+	for i := range wantSums {
+		_assert(gotSums[i] == wantSums[i], "sum %d: got %d, want %d", i, gotSums[i], wantSums[i])
+	}
+	re, ok := rpcerr.FromError(gotErr)
+	_assert(ok && re.Code == rpcerr.InvalidArgs && re.Detail(rpcerr.DetailField) == "Num2" && gotErr.Error() == wantErr.Error(),
+		"unexpected replayed error %v", gotErr)
+	mock.AssertNoMisses(t)
+
+	// 没有录制的参数 返回 NotFound 并指出与最接近的记录的差异
+	var reply int
+	err = c.Call(context.Background(), "Foo.Sum", Args{Num1: 10, Num2: 21}, &reply)
+	_assert(errors.Is(err, rpcerr.New(rpcerr.NotFound, "")), "expect NotFound, got %v", err)
+	_assert(strings.Contains(err.Error(), "- $.Num2=20") && strings.Contains(err.Error(), "+ $.Num2=21"), "missing diff in %q", err)
+	_assert(len(mock.Misses()) == 1, "unexpected misses %q", mock.Misses())
+
+	_ = c.Close()
+	<-done
+
+	// 回放需要 json 编码
+	a, b := net.Pipe()
+	go mock.ServeConn(b)
+	_, err = client.NewClient(a, server.DefaultOption)
+	_assert(err != nil && strings.Contains(err.Error(), "json codec"), "gob client should be rejected: %v", err)
+	_ = a.Close()
+}
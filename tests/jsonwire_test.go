@@ -0,0 +1,250 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/metadata"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/*
+json 线上格式的一致性测试 供其他语言的实现对照
+testdata/jsonwire 下按顺序保存一次完整会话的字节流:
+  01_handshake        客户端发送的 Option 声明版本 2 与全部功能
+  01_handshake_ack    服务端回复的协商结果
+  02_request_utf8     请求头与参数 包含多字节 UTF-8 字符
+  03_response_utf8    成功响应
+  04_request_error    请求头与参数
+  05_response_error   带结构化错误的响应 消息体为 {}
+修改线上格式后使用 go test ./tests -run JSONWire -update 重新生成
+*/
+
+var update = flag.Bool("update", false, "update golden files")
+
+const jsonWireDir = "testdata/jsonwire"
+
+var jsonWireSteps = []string{
+	"01_handshake",
+	"01_handshake_ack",
+	"02_request_utf8",
+	"03_response_utf8",
+	"04_request_error",
+	"05_response_error",
+}
+
+type Greeter int
+
+type GreetArgs struct {
+	Name string
+}
+
+type GreetReply struct {
+	Text string
+}
+
+func (g Greeter) Greet(args GreetArgs, reply *GreetReply) error {
+	reply.Text = "你好, " + args.Name + " 👋"
+	return nil
+}
+
+func (g Greeter) Fail(args GreetArgs, reply *GreetReply) error {
+	return rpcerr.New(rpcerr.InvalidArgs, "name is required").WithDetail(rpcerr.DetailField, "Name")
+}
+
+func jsonWireOption() *server.Option {
+	return &server.Option{MagicNumber: server.MagicNumber, CodecType: server.DefaultJsonOption.CodecType, ConnectTimeout: 10 * time.Second,
+		ProtocolVersion: server.ProtocolVersion, Features: server.SupportedFeatures}
+}
+
+func newGreeterServer() *server.Server {
+	var g Greeter
+	s := server.NewServer()
+	_ = s.Register(&g)
+	return s
+}
+
+// 记录客户端一侧收发的字节
+type recordConn struct {
+	net.Conn
+	sent, received bytes.Buffer
+}
+
+func (c *recordConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.received.Write(p[:n])
+	return n, err
+}
+
+func (c *recordConn) Write(p []byte) (int, error) {
+	c.sent.Write(p)
+	return c.Conn.Write(p)
+}
+
+// 执行脚本化的会话 与固定文件中的步骤一一对应
+func runJSONWireSession(t *testing.T, c *client.Client) {
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("trace-id", "t-1"))
+	var reply GreetReply
+	err := c.Call(ctx, "Greeter.Greet", GreetArgs{Name: "Zoë"}, &reply)
+	if err != nil || reply.Text != "你好, Zoë 👋" {
+		t.Fatalf("unexpected greet result %q (%v)", reply.Text, err)
+	}
+	err = c.Call(context.Background(), "Greeter.Fail", GreetArgs{}, &reply)
+	e, ok := rpcerr.FromError(err)
+	if !ok || e.Code != rpcerr.InvalidArgs || e.Detail(rpcerr.DetailField) != "Name" {
+		t.Fatalf("unexpected fail result %v", err)
+	}
+}
+
+func readGolden(t *testing.T, name string) []byte {
+	data, err := os.ReadFile(filepath.Join(jsonWireDir, name+".golden"))
+	if err != nil {
+		t.Fatalf("read golden file: %v (run with -update to create)", err)
+	}
+	return data
+}
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	path := filepath.Join(jsonWireDir, name+".golden")
+	if *update {
+		if err := os.MkdirAll(jsonWireDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if want := readGolden(t, name); !bytes.Equal(got, want) {
+		t.Errorf("%s: wire format changed\n got: %q\nwant: %q", name, got, want)
+	}
+}
+
+// 真实的客户端与服务端之间的字节流与固定文件一致
+func TestJSONWire_Golden(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		newGreeterServer().ServeConn(serverConn)
+		close(done)
+	}()
+	defer func() { <-done }()
+
+	rc := &recordConn{Conn: clientConn}
+	c, err := client.NewClient(rc, jsonWireOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+
+	// 每一步结束后按位置切分字节流
+	var sentMarks, receivedMarks []int
+	sentMarks = append(sentMarks, rc.sent.Len())
+	receivedMarks = append(receivedMarks, rc.received.Len())
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("trace-id", "t-1"))
+	var reply GreetReply
+	if err := c.Call(ctx, "Greeter.Greet", GreetArgs{Name: "Zoë"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	sentMarks = append(sentMarks, rc.sent.Len())
+	receivedMarks = append(receivedMarks, rc.received.Len())
+	_ = c.Call(context.Background(), "Greeter.Fail", GreetArgs{}, &reply)
+
+	sent, received := rc.sent.Bytes(), rc.received.Bytes()
+	checkGolden(t, jsonWireSteps[0], sent[:sentMarks[0]])
+	checkGolden(t, jsonWireSteps[1], received[:receivedMarks[0]])
+	checkGolden(t, jsonWireSteps[2], sent[sentMarks[0]:sentMarks[1]])
+	checkGolden(t, jsonWireSteps[3], received[receivedMarks[0]:receivedMarks[1]])
+	checkGolden(t, jsonWireSteps[4], sent[sentMarks[1]:])
+	checkGolden(t, jsonWireSteps[5], received[receivedMarks[1]:])
+}
+
+// 将客户端发送的固定字节流交给 ServeConn 响应应逐字节一致
+func TestJSONWire_ServeConn(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		newGreeterServer().ServeConn(serverConn)
+		close(done)
+	}()
+	defer func() {
+		_ = clientConn.Close()
+		<-done
+	}()
+
+	r := bufio.NewReader(clientConn)
+	for _, step := range [][2]string{
+		{"01_handshake", "01_handshake_ack"},
+		{"02_request_utf8", "03_response_utf8"},
+		{"04_request_error", "05_response_error"},
+	} {
+		if _, err := clientConn.Write(readGolden(t, step[0])); err != nil {
+			t.Fatal(err)
+		}
+		want := readGolden(t, step[1])
+		got := make([]byte, len(want))
+		_ = clientConn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatalf("%s: %v", step[1], err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: response differs\n got: %q\nwant: %q", step[1], got, want)
+		}
+	}
+}
+
+// 用固定的响应字节流模拟服务端 NewClient 发送的内容与解析结果应一致
+func TestJSONWire_NewClient(t *testing.T) {
+	golden := make(map[string][]byte)
+	for _, step := range jsonWireSteps {
+		golden[step] = readGolden(t, step)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	fake := make(chan error, 1)
+	go func() {
+		defer func() { _ = serverConn.Close() }()
+		r := bufio.NewReader(serverConn)
+		for _, step := range [][2]string{
+			{"01_handshake", "01_handshake_ack"},
+			{"02_request_utf8", "03_response_utf8"},
+			{"04_request_error", "05_response_error"},
+		} {
+			want := golden[step[0]]
+			got := make([]byte, len(want))
+			if _, err := io.ReadFull(r, got); err != nil {
+				fake <- err
+				return
+			}
+			if !bytes.Equal(got, want) {
+				fake <- fmt.Errorf("%s: request differs\n got: %q\nwant: %q", step[0], got, want)
+				return
+			}
+			if _, err := serverConn.Write(golden[step[1]]); err != nil {
+				fake <- err
+				return
+			}
+		}
+		fake <- nil
+	}()
+
+	c, err := client.NewClient(clientConn, jsonWireOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+	runJSONWireSession(t, c)
+	if err := <-fake; err != nil {
+		t.Fatal(err)
+	}
+}
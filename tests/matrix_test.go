@@ -0,0 +1,210 @@
+package test
+
+import (
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/*
+端到端的组合测试 编码 × 传输 × 选项 每种组合运行全部场景
+新的编码或传输加入 matrixCodecs / matrixTransports 新功能的场景加入 scenarios (见 scenarios_test.go)
+场景只通过 env 访问服务端与客户端 不关心具体的组合
+运行单个组合: go test ./tests -run 'TestMatrix/json/unix/timeouts=on,compression=off'
+*/
+
+// 测试用的服务
+type Arith int
+
+type ArithArgs struct {
+	A, B int
+}
+
+func (a Arith) Add(args ArithArgs, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (a Arith) Divide(args ArithArgs, reply *int) error {
+	if args.B == 0 {
+		return rpcerr.New(rpcerr.InvalidArgs, "divide by zero").WithDetail(rpcerr.DetailField, "B")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func (a Arith) Sleep(d time.Duration, reply *int) error {
+	time.Sleep(d)
+	*reply = 1
+	return nil
+}
+
+type matrixCodec struct {
+	name   string
+	header codec.HeaderType
+	body   codec.Type
+}
+
+var matrixCodecs = []matrixCodec{
+	{"gob", codec.CombinedHeader, codec.GobType},
+	{"json", codec.CombinedHeader, codec.JsonType},
+	{"jsonrpc2", codec.CombinedHeader, codec.JSONRPC2Type},
+	{"binary-gob", codec.BinaryHeader, codec.GobType},
+	{"binary-json", codec.BinaryHeader, codec.JsonType},
+}
+
+// 启动服务并返回拨号函数 每次调用建立一个新连接 资源由 t.Cleanup 释放
+type matrixTransport struct {
+	name  string
+	serve func(t *testing.T, s *server.Server) func(opt *server.Option) (*client.Client, error)
+}
+
+var matrixTransports = []matrixTransport{
+	{"tcp", serveTCP},
+	{"unix", serveUnix},
+	{"pipe", servePipe},
+	{"http-connect", serveHTTPConnect},
+}
+
+func serveListener(t *testing.T, s *server.Server, network, addr string) func(*server.Option) (*client.Client, error) {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go s.Accept(l)
+	return func(opt *server.Option) (*client.Client, error) {
+		return client.Dial(network, l.Addr().String(), opt)
+	}
+}
+
+func serveTCP(t *testing.T, s *server.Server) func(*server.Option) (*client.Client, error) {
+	return serveListener(t, s, "tcp", "127.0.0.1:0")
+}
+
+func serveUnix(t *testing.T, s *server.Server) func(*server.Option) (*client.Client, error) {
+	// t.TempDir 的路径可能超过 unix 套接字的长度限制
+	dir, err := os.MkdirTemp("", "gmrpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return serveListener(t, s, "unix", filepath.Join(dir, "rpc.sock"))
+}
+
+func servePipe(t *testing.T, s *server.Server) func(*server.Option) (*client.Client, error) {
+	return func(opt *server.Option) (*client.Client, error) {
+		cliConn, srvConn := net.Pipe()
+		go s.ServeConn(srvConn)
+		c, err := client.NewClient(cliConn, opt)
+		if err != nil {
+			_ = cliConn.Close()
+		}
+		return c, err
+	}
+}
+
+func serveHTTPConnect(t *testing.T, s *server.Server) func(*server.Option) (*client.Client, error) {
+	ts := httptest.NewServer(http.HandlerFunc(s.ServeHTTPConn))
+	t.Cleanup(ts.Close)
+	return func(opt *server.Option) (*client.Client, error) {
+		return client.DialHTTPWithHeaders("tcp", ts.Listener.Addr().String(), opt)
+	}
+}
+
+// 一种组合的运行环境
+type env struct {
+	t           *testing.T
+	server      *server.Server
+	client      *client.Client
+	opt         *server.Option
+	timeouts    bool // Option.HandleTimeout 为 envHandleTimeout
+	compression bool // 双方支持 gzip
+
+	dialer func(opt *server.Option) (*client.Client, error)
+}
+
+const envHandleTimeout = 500 * time.Millisecond
+
+// 建立一个新连接 测试结束时关闭
+func (e *env) dial() *client.Client {
+	opt := *e.opt
+	return e.dialWith(&opt)
+}
+
+// 使用指定的 Option 建立连接 用于需要调整选项的场景
+func (e *env) dialWith(opt *server.Option) *client.Client {
+	c, err := e.dialer(opt)
+	if err != nil {
+		e.t.Fatalf("dial error: %v", err)
+	}
+	e.t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func newEnv(t *testing.T, mc matrixCodec, tr matrixTransport, timeouts, compression bool) *env {
+	s := server.NewServer()
+	if err := s.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+	s.SetCompression(1, "gzip")
+	e := &env{
+		t:           t,
+		server:      s,
+		timeouts:    timeouts,
+		compression: compression,
+		opt: &server.Option{
+			MagicNumber:    server.MagicNumber,
+			HeaderType:     mc.header,
+			CodecType:      mc.body,
+			ConnectTimeout: 10 * time.Second,
+		},
+	}
+	if timeouts {
+		e.opt.ConnectTimeout = time.Second
+		e.opt.HandleTimeout = envHandleTimeout
+	}
+	if compression {
+		e.opt.Compression = "gzip"
+	}
+	e.dialer = tr.serve(t, s)
+	e.client = e.dial()
+	return e
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func TestMatrix(t *testing.T) {
+	for _, mc := range matrixCodecs {
+		for _, tr := range matrixTransports {
+			for _, timeouts := range []bool{false, true} {
+				for _, compression := range []bool{false, true} {
+					mc, tr, timeouts, compression := mc, tr, timeouts, compression
+					name := fmt.Sprintf("%s/%s/timeouts=%s,compression=%s", mc.name, tr.name, onOff(timeouts), onOff(compression))
+					t.Run(name, func(t *testing.T) {
+						t.Parallel()
+						for _, sc := range scenarios {
+							t.Run(sc.name, func(t *testing.T) {
+								sc.run(newEnv(t, mc, tr, timeouts, compression))
+							})
+						}
+					})
+				}
+			}
+		}
+	}
+}
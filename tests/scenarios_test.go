@@ -0,0 +1,207 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"gmrpc/client"
+	"gmrpc/codec"
+	"gmrpc/rpcerr"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+组合测试的场景 每个场景拿到一个新的 env 可以修改其中的服务端与客户端
+*/
+
+type scenario struct {
+	name string
+	run  func(e *env)
+}
+
+var scenarios = []scenario{
+	{"success", scenarioSuccess},
+	{"handler-error", scenarioHandlerError},
+	{"unknown-method", scenarioUnknownMethod},
+	{"client-timeout", scenarioClientTimeout},
+	{"concurrent", scenarioConcurrent},
+	{"shutdown", scenarioShutdown},
+}
+
+// 共用的断言
+func (e *env) expectAdd(c *client.Client, a, b int) {
+	e.t.Helper()
+	var reply int
+	if err := c.Call(context.Background(), "Arith.Add", ArithArgs{A: a, B: b}, &reply); err != nil || reply != a+b {
+		e.t.Fatalf("Arith.Add(%d, %d) = %d, %v", a, b, reply, err)
+	}
+}
+
+func (e *env) expectCode(err error, code rpcerr.Code) *rpcerr.RPCError {
+	e.t.Helper()
+	re, ok := rpcerr.FromError(err)
+	if !ok || re.Code != code {
+		e.t.Fatalf("expect %s error, got %v", code, err)
+	}
+	return re
+}
+
+func scenarioSuccess(e *env) {
+	e.expectAdd(e.client, 1, 2)
+	// 只有拆分头部的格式支持压缩
+	want := ""
+	if e.compression && e.opt.HeaderType != codec.CombinedHeader {
+		want = "gzip"
+	}
+	if got := e.client.Compression(); got != want {
+		e.t.Fatalf("negotiated compression %q, want %q", got, want)
+	}
+}
+
+func scenarioHandlerError(e *env) {
+	var reply int
+	err := e.client.Call(context.Background(), "Arith.Divide", ArithArgs{A: 1}, &reply)
+	re := e.expectCode(err, rpcerr.InvalidArgs)
+	if re.Details[rpcerr.DetailField] != "B" {
+		e.t.Fatalf("missing field detail: %+v", re)
+	}
+	// 错误不影响连接
+	e.expectAdd(e.client, 3, 4)
+}
+
+func scenarioUnknownMethod(e *env) {
+	var reply int
+	for _, method := range []string{"Arith.Missing", "Missing.Add"} {
+		err := e.client.Call(context.Background(), method, ArithArgs{}, &reply)
+		e.expectCode(err, rpcerr.NotFound)
+	}
+	e.expectAdd(e.client, 5, 6)
+}
+
+func scenarioClientTimeout(e *env) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var reply int
+	err := e.client.Call(ctx, "Arith.Sleep", time.Second, &reply)
+	// 剩余时间随请求传给服务端 两边的时限谁先到都可以
+	if src := rpcerr.TimeoutSource(err); src != rpcerr.TimeoutClientDeadline && src != rpcerr.TimeoutPropagatedBudget {
+		e.t.Fatalf("expect client deadline error, got %v", err)
+	}
+	e.expectAdd(e.client, 7, 8)
+
+	// 服务端处理超时只在设置了 HandleTimeout 时触发 使用更短的时限以免拖慢测试
+	c := e.client
+	if e.timeouts {
+		opt := *e.opt
+		opt.HandleTimeout = 20 * time.Millisecond
+		c = e.dialWith(&opt)
+	}
+	err = c.Call(context.Background(), "Arith.Sleep", 50*time.Millisecond, &reply)
+	if e.timeouts {
+		e.expectCode(err, rpcerr.DeadlineExceeded)
+		if src := rpcerr.TimeoutSource(err); src != rpcerr.TimeoutServerHandle {
+			e.t.Fatalf("timeout source %q, want %q", src, rpcerr.TimeoutServerHandle)
+		}
+	} else if err != nil {
+		e.t.Fatalf("unexpected error without handle timeout: %v", err)
+	}
+}
+
+// 同时进行的调用数有上限 -race 下每个调用也远快于 envHandleTimeout
+func scenarioConcurrent(e *env) {
+	const n, workers = 1000, 50
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	next := make(chan int, n)
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				var reply int
+				if err := e.client.Call(context.Background(), "Arith.Add", ArithArgs{A: i, B: i}, &reply); err != nil {
+					errs <- err
+				} else if reply != 2*i {
+					errs <- errors.New("reply mismatch")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		e.t.Fatalf("concurrent call failed: %v", err)
+	}
+}
+
+// 调用进行中关闭服务端 关闭前的调用都成功 之后的调用可以失败 但不会挂起
+func scenarioShutdown(e *env) {
+	const workers = 8
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	errs := make(chan error, workers)
+	var shutting int32
+	var started sync.WaitGroup
+	started.Add(workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := e.dial()
+			first := true
+			for {
+				var reply int
+				err := c.Call(context.Background(), "Arith.Sleep", time.Millisecond, &reply)
+				if first {
+					started.Done()
+					first = false
+				}
+				if err != nil {
+					// 写入失败时连接被关闭 还没读出的关闭通知随之丢失 关闭开始后任何错误都可以接受
+					if atomic.LoadInt32(&shutting) == 0 {
+						errs <- err
+					}
+					return
+				}
+				select {
+				case <-stop:
+					errs <- nil
+					return
+				default:
+				}
+			}
+		}(i)
+	}
+	started.Wait()
+
+	atomic.StoreInt32(&shutting, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	// 调用方不停发送请求时连接可能一直不空闲 到期后强制通知
+	if err := e.server.Shutdown(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		e.t.Fatalf("shutdown error: %v", err)
+	}
+	close(stop)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		e.t.Fatal("calls hang after shutdown")
+	}
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			e.t.Fatalf("call failed before shutdown: %v", err)
+		}
+	}
+}
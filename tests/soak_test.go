@@ -0,0 +1,239 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"math/rand"
+	"net"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+长时间压测 检查协程 pending 表与堆内存是否有界
+默认跳过 运行方式: go test ./tests -run TestSoak -long [-soak.calls=N -soak.workers=N]
+*/
+
+var (
+	long         = flag.Bool("long", false, "run long soak tests")
+	soakCalls    = flag.Int64("soak.calls", 2000000, "number of calls in the soak test")
+	soakWorkers  = flag.Int("soak.workers", 32, "number of concurrent callers in the soak test")
+	soakMaxHeap  = flag.Uint64("soak.maxheap", 256<<20, "max heap in bytes at checkpoints")
+	soakMaxBytes = flag.Int("soak.maxpayload", 64<<10, "max payload size in bytes")
+)
+
+type Soak int
+
+func (s Soak) Echo(payload []byte, reply *[]byte) error {
+	*reply = payload
+	return nil
+}
+
+func (s Soak) Sleep(d time.Duration, reply *int) error {
+	time.Sleep(d)
+	*reply = 1
+	return nil
+}
+
+// 可替换的客户端 用于模拟重连
+type soakClient struct {
+	mu      sync.RWMutex
+	c       *client.Client
+	addr    string
+	redials int64
+}
+
+func (sc *soakClient) get() *client.Client {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.c
+}
+
+func (sc *soakClient) redial() error {
+	c, err := client.Dial("tcp", sc.addr)
+	if err != nil {
+		return err
+	}
+	sc.mu.Lock()
+	old := sc.c
+	sc.c = c
+	sc.mu.Unlock()
+	atomic.AddInt64(&sc.redials, 1)
+	return old.Close()
+}
+
+type soakHarness struct {
+	t      *testing.T
+	server *server.Server
+	client *soakClient
+
+	baseGoroutines int
+	calls          int64
+	failures       int64
+	mu             sync.Mutex
+	failed         bool
+}
+
+// 预期内的错误: 超时 取消 重连导致的连接关闭
+func expectedSoakError(err error) bool {
+	return errors.Is(err, client.ErrShutdown) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, context.Canceled) ||
+		bytes.Contains([]byte(err.Error()), []byte("call failed"))
+}
+
+func (h *soakHarness) fail(format string, v ...interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failed {
+		return
+	}
+	h.failed = true
+	h.dump()
+	h.t.Errorf(format, v...)
+}
+
+// 打印诊断信息: 协程栈与状态快照
+func (h *soakHarness) dump() {
+	var buf bytes.Buffer
+	_ = pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	h.t.Logf("goroutines:\n%s", buf.String())
+	h.t.Logf("client stats: %+v", h.client.get().Stats())
+	h.t.Logf("server stats: %+v", h.server.Stats())
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	h.t.Logf("heap alloc: %d, sys: %d, num gc: %d", ms.HeapAlloc, ms.Sys, ms.NumGC)
+}
+
+func (h *soakHarness) checkpoint(workers int) {
+	// 每个调用方最多持有常数个协程 加上服务端的处理协程
+	if n := runtime.NumGoroutine(); n > h.baseGoroutines+workers*8+64 {
+		h.fail("too many goroutines at %d calls: %d (base %d)", atomic.LoadInt64(&h.calls), n, h.baseGoroutines)
+	}
+	if p := h.client.get().Stats().Pending; p > workers*2 {
+		h.fail("pending map too large at %d calls: %d", atomic.LoadInt64(&h.calls), p)
+	}
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.HeapAlloc > *soakMaxHeap {
+		h.fail("heap too large at %d calls: %d", atomic.LoadInt64(&h.calls), ms.HeapAlloc)
+	}
+}
+
+func (h *soakHarness) step(r *rand.Rand) {
+	c := h.client.get()
+	var err error
+	switch op := r.Intn(100); {
+	case op < 60:
+		// 随机大小的回显 小包为主
+		size := r.Intn(256)
+		if r.Intn(10) == 0 {
+			size = r.Intn(*soakMaxBytes)
+		}
+		payload := make([]byte, size)
+		r.Read(payload)
+		var reply []byte
+		if err = c.Call(context.Background(), "Soak.Echo", payload, &reply); err == nil && !bytes.Equal(payload, reply) {
+			h.fail("echo mismatch: sent %d bytes, got %d bytes", len(payload), len(reply))
+		}
+	case op < 75:
+		// 随机超时 有一半会在处理完成前超时
+		sleep := time.Duration(r.Intn(2000)) * time.Microsecond
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.Intn(2000))*time.Microsecond)
+		var reply int
+		err = c.Call(ctx, "Soak.Sleep", sleep, &reply)
+		cancel()
+	case op < 85:
+		// 调用过程中主动取消
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(time.Duration(r.Intn(1000))*time.Microsecond, cancel)
+		var reply int
+		err = c.Call(ctx, "Soak.Sleep", time.Duration(r.Intn(1000))*time.Microsecond, &reply)
+		cancel()
+	case op < 99:
+		var reply []byte
+		call := c.Go("Soak.Echo", []byte("async"), &reply, make(chan *client.Call, 1))
+		<-call.Done
+		err = call.Error
+	default:
+		err = h.client.redial()
+	}
+	if err != nil {
+		if !expectedSoakError(err) {
+			h.fail("unexpected error: %v", err)
+		}
+		atomic.AddInt64(&h.failures, 1)
+	}
+}
+
+func TestSoak(t *testing.T) {
+	if !*long {
+		t.Skip("soak test is enabled with -long")
+	}
+
+	var soak Soak
+	s := server.NewServer()
+	_ = s.Register(&soak)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+
+	h := &soakHarness{t: t, server: s, client: &soakClient{addr: l.Addr().String()}}
+	if h.client.c, err = client.Dial("tcp", h.client.addr); err != nil {
+		t.Fatal(err)
+	}
+	h.baseGoroutines = runtime.NumGoroutine()
+
+	workers, total := *soakWorkers, *soakCalls
+	checkEvery := total / 20
+	if checkEvery < 1000 {
+		checkEvery = 1000
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for {
+				n := atomic.AddInt64(&h.calls, 1)
+				if n > total || t.Failed() {
+					return
+				}
+				h.step(r)
+				if n%checkEvery == 0 {
+					h.checkpoint(workers)
+					t.Logf("%d calls in %s, %d expected failures, %d redials", n, time.Since(start), atomic.LoadInt64(&h.failures), atomic.LoadInt64(&h.client.redials))
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+	_ = h.client.get().Close()
+
+	// 所有连接关闭后 服务端与协程数应回到初始水平
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		stats := s.Stats()
+		if stats.ActiveConns == 0 && stats.Inflight == 0 && runtime.NumGoroutine() <= h.baseGoroutines {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	h.fail("resources not released after soak: %s", fmt.Sprintf("%+v, goroutines %d (base %d)", s.Stats(), runtime.NumGoroutine(), h.baseGoroutines))
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"gmrpc/metadata"
+	"strings"
+)
+
+/*
+Baggage 沿整条调用链传递的键值对 与 OpenTracing 的 baggage item 含义相同
+放在请求元数据中 每一项的键为 baggage-<key> 键不区分大小写
+客户端发送请求时自动写入 ctx 中的 baggage 服务端在处理前自动取出放回 ctx
+服务端拦截器用同一个 ctx 发起下游调用时 baggage 随之继续传递
+*/
+
+const BaggagePrefix = "baggage-"
+
+type Baggage map[string]string
+
+type baggageKey struct{}
+
+// 返回带有该项的新 ctx 不修改原 ctx 中的 baggage
+func SetBaggageItem(ctx context.Context, key, val string) context.Context {
+	old := BaggageFromContext(ctx)
+	b := make(Baggage, len(old)+1)
+	for k, v := range old {
+		b[k] = v
+	}
+	b[strings.ToLower(key)] = val
+	return context.WithValue(ctx, baggageKey{}, b)
+}
+
+func GetBaggageItem(ctx context.Context, key string) string {
+	return BaggageFromContext(ctx)[strings.ToLower(key)]
+}
+
+// ctx 中的 baggage 调用方不应修改
+func BaggageFromContext(ctx context.Context) Baggage {
+	b, _ := ctx.Value(baggageKey{}).(Baggage)
+	return b
+}
+
+// 把 ctx 中的 baggage 写入元数据 有 baggage 时返回副本 不修改 md
+func InjectBaggage(ctx context.Context, md metadata.MD) metadata.MD {
+	b := BaggageFromContext(ctx)
+	if len(b) == 0 {
+		return md
+	}
+	out := md.Copy()
+	for k, v := range b {
+		out[BaggagePrefix+k] = v
+	}
+	return out
+}
+
+// 从元数据中取出 baggage 放入 ctx 与 ctx 中已有的项合并 元数据中的优先
+func ExtractBaggage(ctx context.Context, md metadata.MD) context.Context {
+	var b Baggage
+	for k, v := range md {
+		key, ok := strings.CutPrefix(strings.ToLower(k), BaggagePrefix)
+		if !ok || key == "" {
+			continue
+		}
+		if b == nil {
+			b = make(Baggage)
+			for k, v := range BaggageFromContext(ctx) {
+				b[k] = v
+			}
+		}
+		b[key] = v
+	}
+	if b == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, baggageKey{}, b)
+}
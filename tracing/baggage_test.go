@@ -0,0 +1,60 @@
+package tracing_test
+
+import (
+	"context"
+	"gmrpc/client"
+	"gmrpc/metadata"
+	"gmrpc/server"
+	"gmrpc/tracing"
+	"net"
+	"testing"
+)
+
+func startBaggageServer(t *testing.T, interceptor server.ServerInterceptor) string {
+	var foo Foo
+	s := server.NewServer()
+	_ = s.Register(&foo)
+	s.Use(interceptor)
+	l, _ := net.Listen("tcp", ":0")
+	t.Cleanup(func() { _ = l.Close() })
+	go s.Accept(l)
+	return l.Addr().String()
+}
+
+func TestBaggage_Propagation(t *testing.T) {
+	// 下游服务 记录收到的 baggage
+	seen := make(chan tracing.Baggage, 1)
+	backend := startBaggageServer(t, func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		seen <- tracing.BaggageFromContext(ctx)
+		return handler(ctx, argv, replyv)
+	})
+	backendClient, err := client.Dial("tcp", backend)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = backendClient.Close() }()
+
+	// 中间服务 用收到的 ctx 调用下游 并追加一项
+	frontend := startBaggageServer(t, func(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+		_assert(tracing.GetBaggageItem(ctx, "tenant") == "acme", "frontend should see baggage")
+		var reply int
+		ctx = tracing.SetBaggageItem(ctx, "hop", "frontend")
+		if err := backendClient.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 1}, &reply); err != nil {
+			return err
+		}
+		return handler(ctx, argv, replyv)
+	})
+	c, err := client.Dial("tcp", frontend)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = c.Close() }()
+
+	ctx := tracing.SetBaggageItem(context.Background(), "Tenant", "acme")
+	ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("trace-id", "t-1"))
+	var reply int
+	err = c.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "unexpected result %d (%v)", reply, err)
+
+	b := <-seen
+	_assert(b["tenant"] == "acme" && b["hop"] == "frontend" && len(b) == 2, "unexpected baggage at backend: %v", b)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	_assert(len(md) == 1, "outgoing metadata in ctx should not be modified: %v", md)
+	_assert(tracing.GetBaggageItem(context.Background(), "tenant") == "", "empty ctx has no baggage")
+}
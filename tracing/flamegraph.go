@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+记录每个请求的调用树(拦截器 处理函数的进入与退出) 以折叠栈格式输出
+输出可直接交给 flamegraph.pl 生成火焰图 每行的值为该栈帧自身耗时(微秒)
+*/
+
+type FlamegraphTracer struct {
+	sampleEvery uint64   // 每 N 个请求采样一次 0 与 1 表示全部采样
+	stacks      sync.Map // 折叠栈 -> *int64 累计耗时(纳秒)
+	traces      uint64   // 已采样的请求数
+}
+
+func NewFlamegraphTracer(sampleEvery uint64) *FlamegraphTracer {
+	return &FlamegraphTracer{sampleEvery: sampleEvery}
+}
+
+// 开始一次请求的追踪 未被采样时返回 nil
+func (t *FlamegraphTracer) StartTrace(serviceMethod string) *Trace {
+	now := time.Now().UnixNano()
+	if t.sampleEvery > 1 {
+		// 纳秒时间戳低位分布不均 先打散再取模
+		if (uint64(now)*0x9e3779b97f4a7c15)>>32%t.sampleEvery != 0 {
+			return nil
+		}
+	}
+	atomic.AddUint64(&t.traces, 1)
+	tr := &Trace{tracer: t}
+	tr.enter(serviceMethod, now)
+	return tr
+}
+
+func (t *FlamegraphTracer) add(stack string, ns int64) {
+	v, ok := t.stacks.Load(stack)
+	if !ok {
+		v, _ = t.stacks.LoadOrStore(stack, new(int64))
+	}
+	atomic.AddInt64(v.(*int64), ns)
+}
+
+// 已采样的请求数
+func (t *FlamegraphTracer) Traces() uint64 {
+	return atomic.LoadUint64(&t.traces)
+}
+
+// 输出折叠栈并清空已记录的数据
+func (t *FlamegraphTracer) FlushTo(w io.Writer) error {
+	var lines []string
+	t.stacks.Range(func(key, value interface{}) bool {
+		ns := atomic.SwapInt64(value.(*int64), 0)
+		if us := ns / int64(time.Microsecond); us > 0 {
+			lines = append(lines, fmt.Sprintf("%s %d", key, us))
+		} else if ns > 0 {
+			lines = append(lines, fmt.Sprintf("%s 1", key))
+		}
+		return true
+	})
+	sort.Strings(lines)
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type frame struct {
+	name  string
+	start int64
+	child int64 // 子帧耗时 用于计算自身耗时
+}
+
+// 单个请求的调用树 只在处理该请求的调用链上使用
+type Trace struct {
+	tracer *FlamegraphTracer
+	frames []frame
+}
+
+func (tr *Trace) enter(name string, now int64) {
+	tr.frames = append(tr.frames, frame{name: name, start: now})
+}
+
+// 进入一个栈帧
+func (tr *Trace) Enter(name string) {
+	if tr == nil {
+		return
+	}
+	tr.enter(name, time.Now().UnixNano())
+}
+
+// 退出当前栈帧 记录其自身耗时
+func (tr *Trace) Exit() {
+	if tr == nil || len(tr.frames) == 0 {
+		return
+	}
+	n := len(tr.frames)
+	f := tr.frames[n-1]
+	elapsed := time.Now().UnixNano() - f.start
+
+	names := make([]string, n)
+	for i := range tr.frames {
+		names[i] = tr.frames[i].name
+	}
+	tr.tracer.add(strings.Join(names, ";"), elapsed-f.child)
+
+	tr.frames = tr.frames[:n-1]
+	if n > 1 {
+		tr.frames[n-2].child += elapsed
+	}
+}
+
+// 结束追踪 退出所有未退出的栈帧
+func (tr *Trace) Finish() {
+	if tr == nil {
+		return
+	}
+	for len(tr.frames) > 0 {
+		tr.Exit()
+	}
+}
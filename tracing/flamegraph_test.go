@@ -0,0 +1,70 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"gmrpc/tracing"
+	"net"
+	"strings"
+	"testing"
+)
+
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+func passThrough(ctx context.Context, info *server.MethodInfo, argv, replyv interface{}, handler server.UnaryHandler) error {
+	return handler(ctx, argv, replyv)
+}
+
+func TestFlamegraphTracer(t *testing.T) {
+	var foo Foo
+	s := server.NewServer()
+	_ = s.Register(&foo)
+	s.Use(passThrough)
+	tracer := tracing.NewFlamegraphTracer(1)
+	s.SetFlamegraphTracer(tracer)
+
+	l, _ := net.Listen("tcp", ":0")
+	go s.Accept(l)
+
+	c, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = c.Close() }()
+
+	for i := 0; i < 100; i++ {
+		var reply int
+		err := c.Call(context.Background(), "Foo.Sum", Args{Num1: i, Num2: i}, &reply)
+		_assert(err == nil && reply == 2*i, "call Foo.Sum error: %v", err)
+	}
+	_assert(tracer.Traces() == 100, "expect 100 traces, but got %d", tracer.Traces())
+
+	var buf bytes.Buffer
+	_assert(tracer.FlushTo(&buf) == nil, "flush error")
+	out := buf.String()
+	_assert(strings.Contains(out, "Foo.Sum"), "expect service method in output, got %q", out)
+	_assert(strings.Contains(out, "Foo.Sum;tracing_test.passThrough;handler "), "expect interceptor and handler frames, got %q", out)
+
+	// 折叠栈格式: 以分号分隔的栈 空格 数值
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		_assert(strings.Count(line, " ") == 1, "malformed folded line %q", line)
+	}
+
+	buf.Reset()
+	_ = tracer.FlushTo(&buf)
+	_assert(buf.Len() == 0, "expect flushed data to be reset, got %q", buf.String())
+}
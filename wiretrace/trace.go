@@ -0,0 +1,294 @@
+package wiretrace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"gmrpc/codec"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+/*
+帧跟踪 把连接上每次 ReadHeader ReadBody Write 的解码结果交给 Tracer
+用于排查编解码问题 不需要抓包再猜 gob 的内部格式
+只在安装了 Tracer 的连接上包装编解码器 未安装时没有任何额外开销
+*/
+
+type Direction string
+
+const (
+	Recv Direction = "recv"
+	Send Direction = "send"
+)
+
+type Kind string
+
+const (
+	Header  Kind = "header"  // ReadHeader
+	Body    Kind = "body"    // ReadBody 或流式消息的后续块
+	Message Kind = "message" // 头部与消息体一起写入
+)
+
+type Frame struct {
+	Time          time.Time `json:"time"`
+	Dir           Direction `json:"dir"`
+	Kind          Kind      `json:"kind"`
+	Seq           uint64    `json:"seq"`
+	ServiceMethod string    `json:"method"`
+	// 操作期间经过连接的字节数 gob 合并格式下与消息一致
+	// json 与拆分头部的格式自带读缓冲 可能提前读入后续消息
+	Size  int64  `json:"size"`
+	Error string `json:"error,omitempty"` // 头部中的错误或编解码错误
+	Body  string `json:"body,omitempty"`  // 消息体的 json 渲染
+}
+
+func (f Frame) String() string {
+	s := fmt.Sprintf("%s %-4s %-7s seq=%d %s %dB", f.Time.Format("15:04:05.000000"), f.Dir, f.Kind, f.Seq, f.ServiceMethod, f.Size)
+	if f.Error != "" {
+		s += " error=" + f.Error
+	}
+	if f.Body != "" {
+		s += " " + f.Body
+	}
+	return s
+}
+
+// 实现需要支持并发调用 同一连接的读与写在不同的 goroutine 中
+type Tracer interface {
+	Trace(f Frame)
+}
+
+// 可选接口 返回消息体渲染的最大字节数 未实现或不大于 0 时不渲染消息体
+type BodyLimiter interface {
+	MaxBodySize() int
+}
+
+// 与 registry.New 相同 返回的编解码器把每一帧交给 t registry 为空时使用默认注册表
+func NewCodec(conn io.ReadWriteCloser, registry *codec.CodecRegistry, header codec.HeaderType, body codec.Type, t Tracer) (codec.Codec, error) {
+	cc := &countingConn{ReadWriteCloser: conn, r: bufio.NewReader(conn)}
+	inner, err := codec.RegistryOrDefault(registry).New(cc, header, body)
+	if err != nil {
+		return nil, err
+	}
+	c := &tracedCodec{Codec: inner, conn: cc, tracer: t}
+	if bl, ok := t.(BodyLimiter); ok {
+		c.maxBody = bl.MaxBodySize()
+	}
+	return c, nil
+}
+
+// 统计经过连接的字节数
+// 实现 io.ByteReader 使 gob 不再额外缓冲 读取的字节数与消息一致
+type countingConn struct {
+	io.ReadWriteCloser
+	r       *bufio.Reader
+	read    int64
+	written int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+func (c *countingConn) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		atomic.AddInt64(&c.read, 1)
+	}
+	return b, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	atomic.AddInt64(&c.written, int64(n))
+	return n, err
+}
+
+type tracedCodec struct {
+	codec.Codec
+	conn    *countingConn
+	tracer  Tracer
+	maxBody int
+
+	// 最近读到的头部 读取是串行的 读消息体时用于填充 Seq 与方法名
+	seq    uint64
+	method string
+}
+
+func (c *tracedCodec) ReadHeader(h *codec.Header) error {
+	before := atomic.LoadInt64(&c.conn.read)
+	err := c.Codec.ReadHeader(h)
+	if err == io.EOF {
+		return err // 对端正常关闭 不是一帧
+	}
+	c.seq, c.method = h.Seq, h.ServiceMethod
+	f := c.frame(Recv, Header, h, atomic.LoadInt64(&c.conn.read)-before, err)
+	if err == nil {
+		f.Error = h.Error
+	}
+	c.tracer.Trace(f)
+	return err
+}
+
+func (c *tracedCodec) ReadBody(body interface{}) error {
+	before := atomic.LoadInt64(&c.conn.read)
+	err := c.Codec.ReadBody(body)
+	f := c.frame(Recv, Body, &codec.Header{Seq: c.seq, ServiceMethod: c.method}, atomic.LoadInt64(&c.conn.read)-before, err)
+	if err == nil && body != nil {
+		f.Body = c.render(body)
+	}
+	c.tracer.Trace(f)
+	return err
+}
+
+func (c *tracedCodec) SkipBody() error {
+	before := atomic.LoadInt64(&c.conn.read)
+	err := c.Codec.SkipBody()
+	c.tracer.Trace(c.frame(Recv, Body, &codec.Header{Seq: c.seq, ServiceMethod: c.method}, atomic.LoadInt64(&c.conn.read)-before, err))
+	return err
+}
+
+func (c *tracedCodec) Write(h *codec.Header, body interface{}) error {
+	before := atomic.LoadInt64(&c.conn.written)
+	err := c.Codec.Write(h, body)
+	c.traceWrite(Message, h, body, before, err)
+	return err
+}
+
+// 跟踪时每条消息立即刷新 使记录的字节数与消息对应 合并写入不再生效
+func (c *tracedCodec) WriteBuffered(h *codec.Header, body interface{}) error {
+	return c.Write(h, body)
+}
+
+// 流式消息的后续块 与之前写入的头部属于同一条消息
+func (c *tracedCodec) WriteBody(body interface{}) error {
+	bw, ok := c.Codec.(codec.BodyWriter)
+	if !ok {
+		return codec.ErrStreamUnsupported
+	}
+	before := atomic.LoadInt64(&c.conn.written)
+	err := bw.WriteBody(body)
+	if err == nil {
+		err = c.Flush()
+	}
+	c.traceWrite(Body, nil, body, before, err)
+	return err
+}
+
+func (c *tracedCodec) Flush() error {
+	if bw, ok := c.Codec.(codec.BufferedWriter); ok {
+		return bw.Flush()
+	}
+	return nil
+}
+
+func (c *tracedCodec) SetStrictDecoding(strict bool) {
+	if sd, ok := c.Codec.(codec.StrictDecoding); ok {
+		sd.SetStrictDecoding(strict)
+	}
+}
+
+func (c *tracedCodec) SetCompression(comp codec.Compressor, threshold int) {
+	if cc, ok := c.Codec.(codec.Compressible); ok {
+		cc.SetCompression(comp, threshold)
+	}
+}
+
+func (c *tracedCodec) SetBodyHook(hook codec.BodyHook) {
+	if bh, ok := c.Codec.(codec.BodyHooker); ok {
+		bh.SetBodyHook(hook)
+	}
+}
+
+func (c *tracedCodec) PeekBody() []byte {
+	if bp, ok := c.Codec.(codec.BodyPeeker); ok {
+		return bp.PeekBody()
+	}
+	return nil
+}
+
+func (c *tracedCodec) traceWrite(kind Kind, h *codec.Header, body interface{}, before int64, err error) {
+	if h == nil {
+		h = &codec.Header{}
+	}
+	f := c.frame(Send, kind, h, atomic.LoadInt64(&c.conn.written)-before, err)
+	if err == nil {
+		f.Error = h.Error
+		f.Body = c.render(body)
+	}
+	c.tracer.Trace(f)
+}
+
+func (c *tracedCodec) frame(dir Direction, kind Kind, h *codec.Header, size int64, err error) Frame {
+	f := Frame{Time: time.Now(), Dir: dir, Kind: kind, Seq: h.Seq, ServiceMethod: h.ServiceMethod, Size: size}
+	if err != nil {
+		f.Error = err.Error()
+	}
+	return f
+}
+
+// 渲染为 json 超出上限时截断
+func (c *tracedCodec) render(body interface{}) string {
+	if c.maxBody <= 0 {
+		return ""
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Sprintf("<%T: %v>", body, err)
+	}
+	if len(data) > c.maxBody {
+		return string(data[:c.maxBody]) + "..."
+	}
+	return string(data)
+}
+
+var _ codec.BufferedWriter = (*tracedCodec)(nil)
+
+func (c *tracedCodec) MarshalBody(body interface{}) ([]byte, error) {
+	bm, ok := c.Codec.(codec.BodyMarshaler)
+	if !ok {
+		return nil, codec.ErrStreamUnsupported
+	}
+	return bm.MarshalBody(body)
+}
+
+func (c *tracedCodec) MarshalBodyTo(w io.Writer, body interface{}) error {
+	bm, ok := c.Codec.(codec.BodyMarshaler)
+	if !ok {
+		return codec.ErrStreamUnsupported
+	}
+	return bm.MarshalBodyTo(w, body)
+}
+
+func (c *tracedCodec) UnmarshalBody(data []byte, body interface{}) error {
+	bm, ok := c.Codec.(codec.BodyMarshaler)
+	if !ok {
+		return codec.ErrStreamUnsupported
+	}
+	return bm.UnmarshalBody(data, body)
+}
+
+func (c *tracedCodec) BodySize() int {
+	if bs, ok := c.Codec.(codec.BodySizer); ok {
+		return bs.BodySize()
+	}
+	return 0
+}
+
+func (c *tracedCodec) FrameSize() int {
+	if fs, ok := c.Codec.(codec.FrameSizer); ok {
+		return fs.FrameSize()
+	}
+	return -1
+}
+
+var _ codec.BodyWriter = (*tracedCodec)(nil)
+var _ codec.StrictDecoding = (*tracedCodec)(nil)
+var _ codec.Compressible = (*tracedCodec)(nil)
+var _ codec.BodyMarshaler = (*tracedCodec)(nil)
+var _ codec.BodyHooker = (*tracedCodec)(nil)
+var _ codec.BodyPeeker = (*tracedCodec)(nil)
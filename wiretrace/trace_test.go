@@ -0,0 +1,160 @@
+package wiretrace_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"gmrpc/wiretrace"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+type Calc int
+
+type Args struct{ Num1, Num2 int }
+
+func (c Calc) Add(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (c Calc) Fail(args Args, reply *int) error {
+	return errors.New("boom")
+}
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+// 客户端关闭后接收协程可能仍在写入
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+type entry struct {
+	dir    wiretrace.Direction
+	kind   wiretrace.Kind
+	seq    uint64
+	method string
+	body   string
+	err    string
+}
+
+func match(side string, frames []wiretrace.Frame, want []entry) {
+	// 之后可能还有关闭连接时的读取错误
+	_assert(len(frames) >= len(want), "%s: expect %d frames, got %d: %v", side, len(want), len(frames), frames)
+	for i, w := range want {
+		f := frames[i]
+		got := entry{f.Dir, f.Kind, f.Seq, f.ServiceMethod, f.Body, f.Error}
+		_assert(got == w, "%s frame %d: expect %+v, got %+v", side, i, w, got)
+		_assert(f.Size > 0 || f.Body == "", "%s frame %d: expect size, got %d", side, i, f.Size)
+	}
+}
+
+func TestWireTrace_Session(t *testing.T) {
+	var calc Calc
+	s := server.NewServer()
+	_ = s.Register(&calc)
+	ring := wiretrace.NewRing(0, 64)
+	s.SetWireTracer(func(conn io.ReadWriteCloser) wiretrace.Tracer { return ring })
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+
+	var out syncBuffer
+	opt := *server.DefaultOption
+	opt.WireTracer = wiretrace.NewFileTracer(&out, 64)
+	c, err := client.Dial("tcp", l.Addr().String(), &opt)
+	_assert(err == nil, "dial error: %v", err)
+
+	var reply int
+	err = c.Call(context.Background(), "Calc.Add", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "unexpected result %d (%v)", reply, err)
+	err = c.Call(context.Background(), "Calc.Fail", Args{Num1: 1}, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), "boom"), "expect error, got %v", err)
+	_ = c.Close()
+
+	var clientFrames []wiretrace.Frame
+	dec := json.NewDecoder(bytes.NewReader(out.Bytes()))
+	for dec.More() {
+		var f wiretrace.Frame
+		_assert(dec.Decode(&f) == nil, "decode trace line")
+		clientFrames = append(clientFrames, f)
+	}
+	match("client", clientFrames, []entry{
+		{wiretrace.Send, wiretrace.Message, 1, "Calc.Add", `{"Num1":1,"Num2":2}`, ""},
+		{wiretrace.Recv, wiretrace.Header, 1, "Calc.Add", "", ""},
+		{wiretrace.Recv, wiretrace.Body, 1, "Calc.Add", "3", ""},
+		{wiretrace.Send, wiretrace.Message, 2, "Calc.Fail", `{"Num1":1,"Num2":0}`, ""},
+		{wiretrace.Recv, wiretrace.Header, 2, "Calc.Fail", "", "boom"},
+		{wiretrace.Recv, wiretrace.Body, 2, "Calc.Fail", "", ""},
+	})
+
+	// 服务端的响应在写入之后才记录 等待最后一帧
+	deadline := time.Now().Add(time.Second)
+	for len(ring.Frames()) < 6 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	serverFrames := ring.Frames()
+	match("server", serverFrames, []entry{
+		{wiretrace.Recv, wiretrace.Header, 1, "Calc.Add", "", ""},
+		{wiretrace.Recv, wiretrace.Body, 1, "Calc.Add", `{"Num1":1,"Num2":2}`, ""},
+		{wiretrace.Send, wiretrace.Message, 1, "Calc.Add", "3", ""},
+		{wiretrace.Recv, wiretrace.Header, 2, "Calc.Fail", "", ""},
+		{wiretrace.Recv, wiretrace.Body, 2, "Calc.Fail", `{"Num1":1,"Num2":0}`, ""},
+		{wiretrace.Send, wiretrace.Message, 2, "Calc.Fail", "{}", "boom"},
+	})
+
+	// gob 的读取不预读 两端的字节数一致
+	for i := 0; i < 2; i++ {
+		sent, recv := clientFrames[3*i], serverFrames[3*i].Size+serverFrames[3*i+1].Size
+		_assert(sent.Size == recv, "request %d: client sent %d bytes, server read %d", i+1, sent.Size, recv)
+		sent, recv = serverFrames[3*i+2], clientFrames[3*i+1].Size+clientFrames[3*i+2].Size
+		_assert(sent.Size == recv, "response %d: server sent %d bytes, client read %d", i+1, sent.Size, recv)
+	}
+
+	// 调试页面
+	rec := httptest.NewRecorder()
+	ring.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/frames", nil))
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	_assert(len(lines) >= 6 && strings.Contains(lines[5], "send message seq=2 Calc.Fail"), "unexpected page:\n%s", rec.Body.String())
+}
+
+func TestRing_Overwrite(t *testing.T) {
+	ring := wiretrace.NewRing(3, 0)
+	for i := uint64(1); i <= 5; i++ {
+		ring.Trace(wiretrace.Frame{Seq: i})
+	}
+	frames := ring.Frames()
+	_assert(len(frames) == 3 && frames[0].Seq == 3 && frames[2].Seq == 5, "expect the last 3 frames, got %v", frames)
+}
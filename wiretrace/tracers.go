@@ -0,0 +1,88 @@
+package wiretrace
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// 每帧写入一行 json
+type FileTracer struct {
+	MaxBody int // 消息体渲染的最大字节数 0 表示不渲染
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewFileTracer(w io.Writer, maxBody int) *FileTracer {
+	return &FileTracer{MaxBody: maxBody, enc: json.NewEncoder(w)}
+}
+
+func (t *FileTracer) Trace(f Frame) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_ = t.enc.Encode(&f)
+}
+
+func (t *FileTracer) MaxBodySize() int {
+	return t.MaxBody
+}
+
+const DefaultRingSize = 100
+
+// 保留最近的若干帧 实现 http.Handler 可挂到调试页面上
+type Ring struct {
+	MaxBody int
+
+	mu     sync.Mutex
+	frames []Frame
+	next   int
+	full   bool
+}
+
+// size 不大于 0 时使用 DefaultRingSize
+func NewRing(size, maxBody int) *Ring {
+	if size <= 0 {
+		size = DefaultRingSize
+	}
+	return &Ring{MaxBody: maxBody, frames: make([]Frame, size)}
+}
+
+func (r *Ring) Trace(f Frame) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.frames[r.next] = f
+	r.next = (r.next + 1) % len(r.frames)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *Ring) MaxBodySize() int {
+	return r.MaxBody
+}
+
+// 按时间顺序返回保留的帧
+func (r *Ring) Frames() []Frame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Frame(nil), r.frames[:r.next]...)
+	}
+	return append(append([]Frame(nil), r.frames[r.next:]...), r.frames[:r.next]...)
+}
+
+// 每帧一行文本 ?format=json 时返回 json 数组
+func (r *Ring) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	frames := r.Frames()
+	if req.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(frames)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, f := range frames {
+		_, _ = io.WriteString(w, f.String()+"\n")
+	}
+}
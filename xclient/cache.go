@@ -0,0 +1,156 @@
+package xclient
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/server"
+	"reflect"
+)
+
+/*
+连接缓存 以 (地址, Option 指纹) 为键 不同编码或设置的调用不会共用同一个连接
+设置上限后按最近使用淘汰 被淘汰的连接立即关闭 其上进行中的调用返回 ErrShutdown
+*/
+
+type clientKey struct {
+	addr        string
+	fingerprint string
+}
+
+type cacheEntry struct {
+	key clientKey
+	c   *client.Client
+}
+
+// 最近使用的在链表头部 不加锁 由 XClient.mu 保护
+type clientCache struct {
+	max     int // <= 0 表示不限
+	entries map[clientKey]*list.Element
+	lru     *list.List
+}
+
+func newClientCache() *clientCache {
+	return &clientCache{entries: make(map[clientKey]*list.Element), lru: list.New()}
+}
+
+func (cc *clientCache) get(key clientKey) *client.Client {
+	e, ok := cc.entries[key]
+	if !ok {
+		return nil
+	}
+	cc.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).c
+}
+
+// 放入连接 返回因超出上限被淘汰的连接 由调用方关闭
+func (cc *clientCache) put(key clientKey, c *client.Client) []*client.Client {
+	if e, ok := cc.entries[key]; ok {
+		e.Value.(*cacheEntry).c = c
+		cc.lru.MoveToFront(e)
+		return nil
+	}
+	cc.entries[key] = cc.lru.PushFront(&cacheEntry{key: key, c: c})
+	return cc.trim()
+}
+
+func (cc *clientCache) trim() []*client.Client {
+	var evicted []*client.Client
+	for cc.max > 0 && cc.lru.Len() > cc.max {
+		e := cc.lru.Back()
+		entry := cc.lru.Remove(e).(*cacheEntry)
+		delete(cc.entries, entry.key)
+		evicted = append(evicted, entry.c)
+	}
+	return evicted
+}
+
+// 只在缓存的仍是 c 时移除
+func (cc *clientCache) remove(key clientKey, c *client.Client) bool {
+	e, ok := cc.entries[key]
+	if !ok || e.Value.(*cacheEntry).c != c {
+		return false
+	}
+	cc.lru.Remove(e)
+	delete(cc.entries, key)
+	return true
+}
+
+func (cc *clientCache) removeAll() []*client.Client {
+	var all []*client.Client
+	for e := cc.lru.Front(); e != nil; e = e.Next() {
+		all = append(all, e.Value.(*cacheEntry).c)
+	}
+	cc.entries = make(map[clientKey]*list.Element)
+	cc.lru.Init()
+	return all
+}
+
+// 缓存的连接数量上限 <= 0 表示不限 超出时关闭最久未使用的连接
+func (xc *XClient) SetMaxClients(n int) {
+	xc.mu.Lock()
+	xc.clients.max = n
+	evicted := xc.clients.trim()
+	xc.mu.Unlock()
+	for _, c := range evicted {
+		_ = c.Close()
+	}
+}
+
+// 当前缓存的连接数量
+func (xc *XClient) NumClients() int {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	return xc.clients.lru.Len()
+}
+
+type optionKey struct{}
+
+// 本次调用使用 opt 建立连接 代替 NewXClient 传入的 Option
+func WithOption(ctx context.Context, opt *server.Option) context.Context {
+	return context.WithValue(ctx, optionKey{}, opt)
+}
+
+func optionFromContext(ctx context.Context) (*server.Option, bool) {
+	opt, ok := ctx.Value(optionKey{}).(*server.Option)
+	return opt, ok && opt != nil
+}
+
+// Option 的指纹 建立的连接可以互换的两个 Option 指纹相同
+// 先按 client.Dial 的规则补全默认值 (nil 为 DefaultOption 编码为空时为 gob 没有版本时为本版本的全部功能)
+// ConnectTimeout 只影响建立连接 不参与 WireTracer 按实例区分
+func OptionFingerprint(opt *server.Option) string {
+	o := *server.DefaultOption
+	if opt != nil {
+		o = *opt
+		o.MagicNumber = server.DefaultOption.MagicNumber
+		if o.CodecType == "" {
+			o.CodecType = server.DefaultOption.CodecType
+		}
+		if o.ProtocolVersion == 0 {
+			o.ProtocolVersion, o.Features = server.ProtocolVersion, server.SupportedFeatures
+		}
+	}
+	o.ConnectTimeout = 0
+	wire, _ := json.Marshal(&o)
+	sum := sha256.New()
+	sum.Write(wire)
+	_, _ = fmt.Fprintf(sum, "|%d|%d|%s", o.CompressThreshold, o.LargeArgThresholdBytes, tracerIdentity(o.WireTracer))
+	return hex.EncodeToString(sum.Sum(nil)[:16])
+}
+
+func tracerIdentity(t any) string {
+	if t == nil {
+		return ""
+	}
+	v := reflect.ValueOf(t)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Slice:
+		return fmt.Sprintf("%T@%x", t, v.Pointer())
+	}
+	return fmt.Sprintf("%T:%#v", t, t)
+}
@@ -0,0 +1,86 @@
+package xclient
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/*
+服务发现 为 XClient 提供可用的服务端地址
+地址格式为 network@addr 省略 network 时使用 tcp
+*/
+
+type SelectMode int
+
+const (
+	RandomSelect     SelectMode = iota // 随机选择
+	RoundRobinSelect                   // 轮询
+)
+
+type Discovery interface {
+	Refresh() error // 从注册中心更新服务列表
+	Update(servers []string) error
+	Get(mode SelectMode) (string, error)
+	GetAll() ([]string, error)
+}
+
+var ErrNoServers = errors.New("rpc discovery: no available servers")
+
+// 手动维护服务列表的服务发现 不依赖注册中心
+type MultiServersDiscovery struct {
+	r       *rand.Rand
+	mu      sync.RWMutex
+	servers []string
+	index   int // 轮询的位置
+}
+
+func NewMultiServerDiscovery(servers []string) *MultiServersDiscovery {
+	d := &MultiServersDiscovery{
+		servers: servers,
+		r:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	d.index = d.r.Intn(1 << 30)
+	return d
+}
+
+func (d *MultiServersDiscovery) Refresh() error {
+	return nil
+}
+
+func (d *MultiServersDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	return nil
+}
+
+func (d *MultiServersDiscovery) Get(mode SelectMode) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := len(d.servers)
+	if n == 0 {
+		return "", ErrNoServers
+	}
+	switch mode {
+	case RandomSelect:
+		return d.servers[d.r.Intn(n)], nil
+	case RoundRobinSelect:
+		s := d.servers[d.index%n]
+		d.index = (d.index + 1) % n
+		return s, nil
+	}
+	return "", errors.New("rpc discovery: not supported select mode")
+}
+
+// 返回服务列表的副本
+func (d *MultiServersDiscovery) GetAll() ([]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	servers := make([]string, len(d.servers))
+	copy(servers, d.servers)
+	return servers, nil
+}
+
+var _ Discovery = (*MultiServersDiscovery)(nil)
@@ -0,0 +1,135 @@
+package xclient
+
+import (
+	"context"
+	"gmrpc/resolver"
+	"gmrpc/server"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+/*
+基于 resolver 的服务发现 目标格式见 resolver 包
+列表超过 refreshInterval 未更新时在 Get 中重新解析 解析器支持 Watch 时由后台协程推送更新
+*/
+
+const defaultRefreshInterval = 10 * time.Second
+
+type ResolverDiscovery struct {
+	*MultiServersDiscovery
+	target          string
+	refreshInterval time.Duration
+
+	mu         sync.Mutex
+	lastUpdate time.Time
+	cancel     context.CancelFunc // 停止 Watch
+}
+
+// refreshInterval 为 0 时使用默认的 10 秒
+func NewResolverDiscovery(target string, refreshInterval time.Duration) (*ResolverDiscovery, error) {
+	r, endpoint, err := resolver.Lookup(target)
+	if err != nil {
+		return nil, err
+	}
+	if refreshInterval == 0 {
+		refreshInterval = defaultRefreshInterval
+	}
+	d := &ResolverDiscovery{
+		MultiServersDiscovery: NewMultiServerDiscovery(nil),
+		target:                target,
+		refreshInterval:       refreshInterval,
+	}
+	if err := d.Refresh(); err != nil {
+		return nil, err
+	}
+	if w, ok := r.(resolver.Watcher); ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := w.Watch(ctx, endpoint)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		d.cancel = cancel
+		go d.watch(ch)
+	}
+	return d, nil
+}
+
+func (d *ResolverDiscovery) watch(ch <-chan []resolver.Address) {
+	for addrs := range ch {
+		_ = d.Update(addrStrings(addrs))
+	}
+}
+
+func (d *ResolverDiscovery) Refresh() error {
+	addrs, err := resolver.Resolve(d.target)
+	if err != nil {
+		return err
+	}
+	return d.Update(addrStrings(addrs))
+}
+
+func (d *ResolverDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	d.lastUpdate = time.Now()
+	d.mu.Unlock()
+	return d.MultiServersDiscovery.Update(servers)
+}
+
+// 列表过期时重新解析 解析失败时继续使用旧的列表
+func (d *ResolverDiscovery) refreshIfStale() {
+	d.mu.Lock()
+	stale := time.Since(d.lastUpdate) > d.refreshInterval
+	d.mu.Unlock()
+	if !stale {
+		return
+	}
+	if err := d.Refresh(); err != nil {
+		log.Println("rpc discovery: refresh error:", err)
+	}
+}
+
+func (d *ResolverDiscovery) Get(mode SelectMode) (string, error) {
+	d.refreshIfStale()
+	return d.MultiServersDiscovery.Get(mode)
+}
+
+func (d *ResolverDiscovery) GetAll() ([]string, error) {
+	d.refreshIfStale()
+	return d.MultiServersDiscovery.GetAll()
+}
+
+// 停止 Watch
+func (d *ResolverDiscovery) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+	return nil
+}
+
+func addrStrings(addrs []resolver.Address) []string {
+	servers := make([]string, len(addrs))
+	for i, a := range addrs {
+		servers[i] = a.String()
+	}
+	return servers
+}
+
+// 通过目标字符串创建 关闭 XClient 时同时停止服务发现
+func NewXClientTarget(target string, mode SelectMode, opt *server.Option) (*XClient, error) {
+	d, err := NewResolverDiscovery(target, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewXClient(d, mode, opt), nil
+}
+
+var (
+	_ Discovery = (*ResolverDiscovery)(nil)
+	_ io.Closer = (*ResolverDiscovery)(nil)
+)
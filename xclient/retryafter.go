@@ -0,0 +1,69 @@
+package xclient
+
+import (
+	"context"
+	"gmrpc/metadata"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"time"
+)
+
+/*
+服务端的重试提示 (错误的 RetryAfterMs 或响应元数据 retry-after-ms 见 server/retryafter.go)
+提示期间选择服务端时跳过该地址 所有候选都在提示期间时等待最早到期的一个再调用 不超过 ctx 的截止时间
+关闭中的服务端在成功的响应中也带有提示 之后的调用提前换到其他服务端
+*/
+
+// 记录 rpcAddr 的提示 err 为调用的结果 md 为成功时的响应元数据
+func (xc *XClient) noteRetryAfter(rpcAddr string, err error, md metadata.MD) {
+	wait := rpcerr.RetryAfter(err)
+	if err == nil {
+		if ms, ok := server.ParseRetryAfter(md.Get(server.RetryAfterKey)); ok {
+			wait = time.Duration(ms) * time.Millisecond
+		}
+	}
+	if wait <= 0 {
+		return
+	}
+	until := time.Now().Add(wait)
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if xc.retryAfter == nil {
+		xc.retryAfter = make(map[string]time.Time)
+	}
+	if until.After(xc.retryAfter[rpcAddr]) {
+		xc.retryAfter[rpcAddr] = until
+	}
+}
+
+// 地址的提示还要等待多久 没有提示或已到期时返回 0
+func (xc *XClient) backoff(rpcAddr string, now time.Time) time.Duration {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	until, ok := xc.retryAfter[rpcAddr]
+	if !ok {
+		return 0
+	}
+	if !now.Before(until) {
+		delete(xc.retryAfter, rpcAddr)
+		return 0
+	}
+	return until.Sub(now)
+}
+
+// 服务端建议稍后重试的过载与资源不足错误换到其他服务端
+// 关闭中的服务端对所有响应都给出提示 其他错误码即使带有提示也直接返回 不在其他服务端重复执行
+func hasRetryAfter(err error) bool {
+	return rpcerr.RetryAfter(err) > 0 && rpcerr.Retryable(rpcerr.CodeOf(err))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,351 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/metadata"
+	"gmrpc/server"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+负载均衡客户端 按 SelectMode 选择服务端 每个地址与 Option 的组合复用一个连接 见 cache.go
+服务端不可用(连接失败 握手失败 连接断开)时自动换下一个服务端重试
+处理函数返回的错误直接返回给调用方 换服务端重试对非幂等的方法不安全
+*/
+
+type ErrorClass int
+
+const (
+	ReturnError    ErrorClass = iota // 直接返回给调用方
+	RetryElsewhere                   // 换一个服务端重试
+)
+
+// 对调用错误分类 决定是否换服务端重试
+type ErrorClassifier func(err error) ErrorClass
+
+// 连接或握手失败
+type DialError struct {
+	Addr string
+	Err  error
+}
+
+func (e *DialError) Error() string {
+	return "rpc xclient: dial " + e.Addr + ": " + e.Err.Error()
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+// 默认分类 连接失败 连接断开与带有重试提示的错误换服务端重试 其余错误直接返回
+func DefaultErrorClassifier(err error) ErrorClass {
+	var dialErr *DialError
+	if errors.As(err, &dialErr) || errors.Is(err, client.ErrShutdown) || errors.Is(err, io.EOF) || hasRetryAfter(err) {
+		return RetryElsewhere
+	}
+	return ReturnError
+}
+
+const DefaultMaxAttempts = 3
+
+type XClient struct {
+	noCopy      noCopy
+	d           Discovery
+	mode        SelectMode
+	opt         *server.Option
+	classifier  ErrorClassifier
+	maxAttempts int
+	dialer      client.DialFunc
+	warmPing    bool
+
+	mu         sync.Mutex
+	clients    *clientCache
+	retryAfter map[string]time.Time // 服务端建议的重试时间 到期前跳过该地址
+	closed     bool                 // Close 之后调用返回 client.ErrShutdown
+}
+
+var _ io.Closer = (*XClient)(nil)
+
+// 嵌入后 go vet 的 copylocks 检查会报告对结构体的复制
+type noCopy struct{}
+
+func (*noCopy) Lock()   {}
+func (*noCopy) Unlock() {}
+
+func NewXClient(d Discovery, mode SelectMode, opt *server.Option) *XClient {
+	return &XClient{
+		d:           d,
+		mode:        mode,
+		opt:         opt,
+		classifier:  DefaultErrorClassifier,
+		maxAttempts: DefaultMaxAttempts,
+		dialer:      client.Dial,
+		clients:     newClientCache(),
+	}
+}
+
+// 自定义错误分类 例如把 Overloaded 也当作换服务端重试 为空时恢复默认分类
+func (xc *XClient) SetErrorClassifier(classifier ErrorClassifier) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if classifier == nil {
+		classifier = DefaultErrorClassifier
+	}
+	xc.classifier = classifier
+}
+
+// 一次 Call 最多尝试的服务端数量
+func (xc *XClient) SetMaxAttempts(n int) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if n < 1 {
+		n = 1
+	}
+	xc.maxAttempts = n
+}
+
+func (xc *XClient) SetDialer(dial client.DialFunc) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.dialer = dial
+}
+
+// WarmAll 建立连接后是否调用 Ping 检查服务端
+func (xc *XClient) SetWarmPing(on bool) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.warmPing = on
+}
+
+// 关闭所有连接与服务发现 之后的调用返回 client.ErrShutdown 再次关闭同样返回 client.ErrShutdown
+func (xc *XClient) Close() error {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if xc.closed {
+		return client.ErrShutdown
+	}
+	xc.closed = true
+	for _, c := range xc.clients.removeAll() {
+		_ = c.Close()
+	}
+	if closer, ok := xc.d.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (xc *XClient) isClosed() bool {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	return xc.closed
+}
+
+// 拆分 network@addr
+func parseAddr(rpcAddr string) (network, addr string) {
+	if i := strings.Index(rpcAddr, "@"); i >= 0 {
+		return rpcAddr[:i], rpcAddr[i+1:]
+	}
+	return "tcp", rpcAddr
+}
+
+// 本次调用建立连接使用的 Option 见 WithOption
+func (xc *XClient) option(ctx context.Context) *server.Option {
+	if opt, ok := optionFromContext(ctx); ok {
+		return opt
+	}
+	return xc.opt
+}
+
+// 取出缓存的连接 没有时建立 建立连接时不持有锁 多个地址可以并发建立
+// 建立失败的连接不缓存 之后的调用重新建立
+func (xc *XClient) dial(rpcAddr string, opt *server.Option) (*client.Client, clientKey, error) {
+	key := clientKey{addr: rpcAddr, fingerprint: OptionFingerprint(opt)}
+	xc.mu.Lock()
+	if xc.closed {
+		xc.mu.Unlock()
+		return nil, key, client.ErrShutdown
+	}
+	c := xc.clients.get(key)
+	if c != nil && !c.IsAvailable() {
+		xc.clients.remove(key, c)
+		_ = c.Close()
+		c = nil
+	}
+	dial := xc.dialer
+	xc.mu.Unlock()
+	if c != nil {
+		return c, key, nil
+	}
+
+	if opt != nil {
+		o := *opt
+		opt = &o
+	}
+	network, addr := parseAddr(rpcAddr)
+	c, err := dial(network, addr, opt)
+	if err == nil && c == nil {
+		err = errors.New("dialer returned no client")
+	}
+	if err != nil {
+		return nil, key, &DialError{Addr: rpcAddr, Err: err}
+	}
+
+	xc.mu.Lock()
+	if xc.closed {
+		// 拨号期间被关闭 新连接不缓存
+		xc.mu.Unlock()
+		_ = c.Close()
+		return nil, key, client.ErrShutdown
+	}
+	if old := xc.clients.get(key); old != nil && old.IsAvailable() {
+		xc.mu.Unlock()
+		_ = c.Close()
+		return old, key, nil
+	}
+	evicted := xc.clients.put(key, c)
+	xc.mu.Unlock()
+	for _, e := range evicted {
+		_ = e.Close()
+	}
+	go xc.evictOnDone(key, c)
+	return c, key, nil
+}
+
+// 连接断开时立即移出缓存 不必等到下次使用
+func (xc *XClient) evictOnDone(key clientKey, c *client.Client) {
+	<-c.Done()
+	xc.mu.Lock()
+	xc.clients.remove(key, c)
+	xc.mu.Unlock()
+	_ = c.Close()
+}
+
+// 提前与所有服务端建立连接 部分失败时返回 *client.WarmError Close 之后返回 client.ErrShutdown
+// 失败的地址不会被缓存 之后调用时重新建立
+func (xc *XClient) WarmAll(ctx context.Context) error {
+	if xc.isClosed() {
+		return client.ErrShutdown
+	}
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return err
+	}
+	xc.mu.Lock()
+	ping, opt := xc.warmPing, xc.opt
+	xc.mu.Unlock()
+	return client.WarmTargets(ctx, servers, func(ctx context.Context, i int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c, key, err := xc.dial(servers[i], opt)
+		if err != nil {
+			return err
+		}
+		if ping {
+			if err := c.Ping(ctx); err != nil {
+				xc.evict(key, c)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 关闭并移除不可用的连接
+func (xc *XClient) evict(key clientKey, c *client.Client) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if xc.clients.remove(key, c) {
+		_ = c.Close()
+	}
+}
+
+// 选择一个本次调用还没有尝试过的服务端 优先选择没有重试提示的
+// 都有提示时返回提示最早到期的一个与需要等待的时间
+func (xc *XClient) pick(tried map[string]bool) (string, time.Duration, error) {
+	rpcAddr, err := xc.d.Get(xc.mode)
+	if err != nil {
+		return "", 0, err
+	}
+	now := time.Now()
+	if !tried[rpcAddr] && xc.backoff(rpcAddr, now) == 0 {
+		return rpcAddr, 0, nil
+	}
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return "", 0, err
+	}
+	best, bestWait := "", time.Duration(0)
+	for _, s := range servers {
+		if tried[s] {
+			continue
+		}
+		wait := xc.backoff(s, now)
+		if wait == 0 {
+			return s, 0, nil
+		}
+		if best == "" || wait < bestWait {
+			best, bestWait = s, wait
+		}
+	}
+	if best == "" {
+		return "", 0, ErrNoServers
+	}
+	return best, bestWait, nil
+}
+
+// 调用一个服务端 服务端不可用时换下一个 对调用方而言只是一次调用
+func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	xc.mu.Lock()
+	classifier, maxAttempts := xc.classifier, xc.maxAttempts
+	xc.mu.Unlock()
+	opt := xc.option(ctx)
+
+	tried := make(map[string]bool)
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if xc.isClosed() {
+			return client.ErrShutdown
+		}
+		rpcAddr, wait, err := xc.pick(tried)
+		if err != nil {
+			if lastErr == nil {
+				lastErr = err
+			}
+			break
+		}
+		tried[rpcAddr] = true
+		if wait > 0 {
+			if err := sleep(ctx, wait); err != nil {
+				if lastErr == nil {
+					lastErr = err
+				}
+				return lastErr
+			}
+		}
+
+		c, key, err := xc.dial(rpcAddr, opt)
+		if err == nil {
+			var md metadata.MD
+			err = c.Call(client.WithResponseMetadata(ctx, &md), serviceMethod, args, reply)
+			xc.noteRetryAfter(rpcAddr, err, md)
+			if err == nil {
+				return nil
+			}
+			if !c.IsAvailable() {
+				xc.evict(key, c)
+			}
+		}
+		if classifier(err) != RetryElsewhere || ctx.Err() != nil {
+			return err
+		}
+		lastErr = err
+	}
+	return fmt.Errorf("rpc xclient: all attempts failed: %w", lastErr)
+}
@@ -0,0 +1,370 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gmrpc/client"
+	"gmrpc/codec"
+	"gmrpc/resolver"
+	"gmrpc/rpcerr"
+	"gmrpc/server"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type Foo struct {
+	name string
+	err  error
+}
+
+func (f *Foo) Name(args int, reply *string) error {
+	*reply = f.name
+	return f.err
+}
+
+func startServer(t *testing.T, foo *Foo) (*server.Server, string) {
+	s := server.NewServer()
+	_ = s.Register(foo)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen error: %v", err)
+	t.Cleanup(func() { _ = l.Close() })
+	go s.Accept(l)
+	return s, "tcp@" + l.Addr().String()
+}
+
+// 返回一个拒绝连接的地址
+func refusedAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen error: %v", err)
+	addr := l.Addr().String()
+	_ = l.Close()
+	return "tcp@" + addr
+}
+
+func TestXClient_Failover(t *testing.T) {
+	_, healthy := startServer(t, &Foo{name: "healthy"})
+	d := NewMultiServerDiscovery([]string{refusedAddr(t), healthy})
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	// 无论从哪个服务端开始 都由健康的服务端完成
+	for i := 0; i < 4; i++ {
+		var reply string
+		err := xc.Call(context.Background(), "Foo.Name", 0, &reply)
+		_assert(err == nil && reply == "healthy", "unexpected result %q (%v)", reply, err)
+	}
+
+	// 全部不可用时返回最后一个错误
+	xc2 := NewXClient(NewMultiServerDiscovery([]string{refusedAddr(t), refusedAddr(t)}), RandomSelect, nil)
+	defer func() { _ = xc2.Close() }()
+	var reply string
+	err := xc2.Call(context.Background(), "Foo.Name", 0, &reply)
+	var dialErr *DialError
+	_assert(errors.As(err, &dialErr), "expect dial error, got %v", err)
+}
+
+func TestXClient_HandlerErrorNotRetried(t *testing.T) {
+	first, addr1 := startServer(t, &Foo{name: "first", err: rpcerr.New(rpcerr.Overloaded, "busy")})
+	second, addr2 := startServer(t, &Foo{name: "second"})
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr1, addr2}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	// 固定从第一个服务端开始
+	_ = xc.d.(*MultiServersDiscovery).Update([]string{addr1, addr2})
+	xc.d.(*MultiServersDiscovery).index = 0
+	var reply string
+	err := xc.Call(context.Background(), "Foo.Name", 0, &reply)
+	e, ok := rpcerr.FromError(err)
+	_assert(ok && e.Code == rpcerr.Overloaded, "expect handler error, got %v", err)
+	_assert(first.Stats().Requests == 1, "first server should be called once, got %d", first.Stats().Requests)
+	_assert(second.Stats().Requests == 0, "second server should not be touched, got %d", second.Stats().Requests)
+
+	// 自定义分类 过载时换服务端
+	xc.SetErrorClassifier(func(err error) ErrorClass {
+		if e, ok := rpcerr.FromError(err); ok && e.Code == rpcerr.Overloaded {
+			return RetryElsewhere
+		}
+		return DefaultErrorClassifier(err)
+	})
+	xc.d.(*MultiServersDiscovery).index = 0
+	err = xc.Call(context.Background(), "Foo.Name", 0, &reply)
+	_assert(err == nil && reply == "second", "expect second server result, got %q (%v)", reply, err)
+	_assert(first.Stats().Requests == 2 && second.Stats().Requests == 1, "unexpected request counts %d/%d", first.Stats().Requests, second.Stats().Requests)
+
+	// 带有重试提示的参数错误 (如关闭中的服务端) 不在其他服务端重复执行
+	invalid, addr3 := startServer(t, &Foo{name: "invalid", err: &rpcerr.RPCError{Code: rpcerr.InvalidArgs, Message: "bad", RetryAfterMs: 100}})
+	xc2 := NewXClient(NewMultiServerDiscovery([]string{addr3, addr2}), RoundRobinSelect, nil)
+	defer func() { _ = xc2.Close() }()
+	xc2.d.(*MultiServersDiscovery).index = 0
+	err = xc2.Call(context.Background(), "Foo.Name", 0, &reply)
+	_assert(rpcerr.CodeOf(err) == rpcerr.InvalidArgs && rpcerr.RetryAfter(err) > 0, "expect hinted InvalidArgs, got %v", err)
+	_assert(invalid.Stats().Requests == 1 && second.Stats().Requests == 1, "hinted invalid args should not be retried elsewhere")
+}
+
+func TestXClient_MaxAttempts(t *testing.T) {
+	_, healthy := startServer(t, &Foo{name: "healthy"})
+	d := NewMultiServerDiscovery([]string{refusedAddr(t), refusedAddr(t), healthy})
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetMaxAttempts(1)
+	d.index = 0
+	var reply string
+	err := xc.Call(context.Background(), "Foo.Name", 0, &reply)
+	_assert(err != nil, "expect failure with a single attempt")
+}
+
+func TestXClient_WarmAll(t *testing.T) {
+	_, healthy := startServer(t, &Foo{name: "healthy"})
+	refused := refusedAddr(t)
+	xc := NewXClient(NewMultiServerDiscovery([]string{refused, healthy}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	var dials int32
+	xc.SetDialer(func(network, address string, opts ...*server.Option) (*client.Client, error) {
+		atomic.AddInt32(&dials, 1)
+		return client.Dial(network, address, opts...)
+	})
+	xc.SetWarmPing(true)
+
+	err := xc.WarmAll(context.Background())
+	var warmErr *client.WarmError
+	_assert(errors.As(err, &warmErr) && len(warmErr.Failures) == 1 && warmErr.Failures[0].Target == refused,
+		"expect only %s to fail, got %v", refused, err)
+	_assert(atomic.LoadInt32(&dials) == 2, "expect 2 dials, got %d", dials)
+
+	// 健康的服务端已建立连接 调用时不再建立
+	xc.d.(*MultiServersDiscovery).index = 1
+	var reply string
+	err = xc.Call(context.Background(), "Foo.Name", 0, &reply)
+	_assert(err == nil && reply == "healthy", "unexpected result %q (%v)", reply, err)
+	_assert(atomic.LoadInt32(&dials) == 2, "warmed address should not be dialed again, got %d", dials)
+}
+
+type switchResolver struct {
+	updates chan []resolver.Address
+}
+
+func (r *switchResolver) Resolve(target string) ([]resolver.Address, error) {
+	return resolver.Static{}.Resolve(target)
+}
+
+func (r *switchResolver) Watch(ctx context.Context, target string) (<-chan []resolver.Address, error) {
+	ch := make(chan []resolver.Address)
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case addrs := <-r.updates:
+				ch <- addrs
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func TestXClient_Target(t *testing.T) {
+	_, a := startServer(t, &Foo{name: "a"})
+	_, b := startServer(t, &Foo{name: "b"})
+
+	xc, err := NewXClientTarget("static:///"+refusedAddr(t)+","+a, RoundRobinSelect, nil)
+	_assert(err == nil, "new xclient error: %v", err)
+	for i := 0; i < 4; i++ {
+		var reply string
+		err := xc.Call(context.Background(), "Foo.Name", 0, &reply)
+		_assert(err == nil && reply == "a", "unexpected result %q (%v)", reply, err)
+	}
+	_ = xc.Close()
+
+	// 解析器推送的新地址生效
+	r := &switchResolver{updates: make(chan []resolver.Address)}
+	resolver.Register("switch", r)
+	defer resolver.Register("switch", nil)
+	xc, err = NewXClientTarget("switch:///"+a, RandomSelect, nil)
+	_assert(err == nil, "new xclient error: %v", err)
+	defer func() { _ = xc.Close() }()
+	var reply string
+	_ = xc.Call(context.Background(), "Foo.Name", 0, &reply)
+	_assert(reply == "a", "unexpected result %q", reply)
+	addr, _ := resolver.ParseAddress(b)
+	r.updates <- []resolver.Address{addr}
+	deadline := time.Now().Add(time.Second)
+	for reply != "b" && time.Now().Before(deadline) {
+		_ = xc.Call(context.Background(), "Foo.Name", 0, &reply)
+	}
+	_assert(reply == "b", "watch update should switch servers, got %q", reply)
+
+	_, err = NewXClientTarget("etcd:///svc", RandomSelect, nil)
+	_assert(err != nil, "unknown scheme should fail")
+}
+
+func TestXClient_OptionKeyedClients(t *testing.T) {
+	_, addr := startServer(t, &Foo{name: "a"})
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	var dialed []*client.Client
+	xc.SetDialer(func(network, address string, opts ...*server.Option) (*client.Client, error) {
+		c, err := client.Dial(network, address, opts...)
+		if err == nil {
+			dialed = append(dialed, c)
+		}
+		return c, err
+	})
+
+	call := func(ctx context.Context) {
+		var reply string
+		err := xc.Call(ctx, "Foo.Name", 0, &reply)
+		_assert(err == nil && reply == "a", "unexpected result %q (%v)", reply, err)
+	}
+	jsonCtx := WithOption(context.Background(), &server.Option{CodecType: codec.JsonType})
+	call(context.Background())
+	call(jsonCtx)
+	call(context.Background())
+	call(jsonCtx)
+	_assert(len(dialed) == 2 && dialed[0] != dialed[1], "expect 2 distinct connections, got %d", len(dialed))
+	_assert(xc.NumClients() == 2, "expect 2 cached clients, got %d", xc.NumClients())
+
+	// 补全默认值后相同的 Option 共用连接
+	_assert(OptionFingerprint(nil) == OptionFingerprint(&server.Option{CodecType: codec.GobType}),
+		"nil and explicit default option should share a fingerprint")
+	_assert(OptionFingerprint(nil) != OptionFingerprint(server.DefaultJsonOption), "gob and json should differ")
+
+	// 超出上限时关闭最久未使用的连接
+	xc.SetMaxClients(1)
+	_assert(xc.NumClients() == 1 && !dialed[0].IsAvailable() && dialed[1].IsAvailable(),
+		"expect the gob client to be evicted")
+	call(context.Background())
+	_assert(len(dialed) == 3 && xc.NumClients() == 1 && !dialed[1].IsAvailable(), "expect the json client to be evicted")
+	call(context.Background())
+	_assert(len(dialed) == 3, "cached client should be reused, got %d dials", len(dialed))
+}
+
+func TestXClient_FailedDialNotCached(t *testing.T) {
+	_, addr := startServer(t, &Foo{name: "a"})
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetMaxAttempts(1)
+	var dials int32
+	xc.SetDialer(func(network, address string, opts ...*server.Option) (*client.Client, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			// 握手失败却没有返回错误的拨号函数
+			return nil, nil
+		}
+		return client.Dial(network, address, opts...)
+	})
+
+	var reply string
+	err := xc.Call(context.Background(), "Foo.Name", 0, &reply)
+	var dialErr *DialError
+	_assert(errors.As(err, &dialErr), "expect DialError, got %v", err)
+	_assert(xc.NumClients() == 0, "failed dial should not be cached")
+	err = xc.Call(context.Background(), "Foo.Name", 0, &reply)
+	_assert(err == nil && reply == "a" && atomic.LoadInt32(&dials) == 2, "expect a redial, got %q (%v)", reply, err)
+}
+
+func TestXClient_RetryAfter(t *testing.T) {
+	sa, a := startServer(t, &Foo{name: "a"})
+	_, b := startServer(t, &Foo{name: "b"})
+	// 令牌耗尽后 a 建议 1s 后重试
+	sa.SetRateLimit(1, 1)
+	xc := NewXClient(NewMultiServerDiscovery([]string{a, b}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	call := func() string {
+		var reply string
+		err := xc.Call(context.Background(), "Foo.Name", 0, &reply)
+		_assert(err == nil, "call error: %v", err)
+		return reply
+	}
+	xc.d.(*MultiServersDiscovery).index = 0
+	_assert(call() == "a", "first call should go to a")
+	// 轮到 a 时被限流 换到 b 之后在提示期间跳过 a
+	xc.d.(*MultiServersDiscovery).index = 0
+	_assert(call() == "b", "overloaded call should be redirected to b")
+	wait := xc.backoff(a, time.Now())
+	_assert(wait > 900*time.Millisecond && wait <= time.Second, "expect a backoff of about 1s for a, got %v", wait)
+	for i := 0; i < 4; i++ {
+		_assert(call() == "b", "a should be skipped while its hint is active")
+	}
+}
+
+func TestXClient_RetryAfterWait(t *testing.T) {
+	s, addr := startServer(t, &Foo{name: "a"})
+	// 每秒 20 个请求 令牌耗尽后建议 50ms 后重试
+	s.SetRateLimit(20, 1)
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	var reply string
+	_assert(xc.Call(context.Background(), "Foo.Name", 0, &reply) == nil, "first call should pass")
+	err := xc.Call(context.Background(), "Foo.Name", 0, &reply)
+	_assert(rpcerr.CodeOf(err) == rpcerr.Overloaded, "expect Overloaded without another server, got %v", err)
+
+	// 唯一的服务端在提示期间 等待提示到期后再调用
+	start := time.Now()
+	err = xc.Call(context.Background(), "Foo.Name", 0, &reply)
+	elapsed := time.Since(start)
+	_assert(err == nil && reply == "a", "call after the hint should succeed, got %v", err)
+	_assert(elapsed >= 30*time.Millisecond, "expect to wait for the hint, waited %v", elapsed)
+
+	// ctx 先于提示到期时不再等待
+	_ = xc.Call(context.Background(), "Foo.Name", 0, &reply)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	err = xc.Call(ctx, "Foo.Name", 0, &reply)
+	_assert(err != nil, "expect the call to give up when ctx ends first")
+}
+
+// 连接断开后不经调用即移出缓存
+func TestXClient_EvictsClosedClient(t *testing.T) {
+	s, addr := startServer(t, &Foo{name: "a"})
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	var reply string
+	_assert(xc.Call(context.Background(), "Foo.Name", 0, &reply) == nil, "call failed")
+	_assert(xc.NumClients() == 1, "expect 1 cached client, got %d", xc.NumClients())
+
+	_assert(s.Shutdown(context.Background()) == nil, "shutdown failed")
+	deadline := time.Now().Add(time.Second)
+	for xc.NumClients() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	_assert(xc.NumClients() == 0, "expect the closed client to be evicted, got %d", xc.NumClients())
+}
+
+// 关闭后不再建立连接 调用直接返回 ErrShutdown
+func TestXClient_CallAfterClose(t *testing.T) {
+	_, addr := startServer(t, &Foo{name: "a"})
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RoundRobinSelect, nil)
+	var reply string
+	_assert(xc.Call(context.Background(), "Foo.Name", 0, &reply) == nil && reply == "a", "call failed")
+	_assert(xc.Close() == nil, "close failed")
+	err := xc.Call(context.Background(), "Foo.Name", 0, &reply)
+	_assert(err == client.ErrShutdown, "expect ErrShutdown, got %v", err)
+	_assert(xc.NumClients() == 0, "no client should be cached after close")
+	_assert(xc.Close() == client.ErrShutdown, "second close should report ErrShutdown")
+}
+
+func TestXClient_WarmAllAfterClose(t *testing.T) {
+	_, addr := startServer(t, &Foo{name: "a"})
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RoundRobinSelect, nil)
+	_ = xc.Close()
+	_assert(xc.WarmAll(context.Background()) == client.ErrShutdown, "expect ErrShutdown from WarmAll")
+	_, _, err := xc.dial(addr, nil)
+	_assert(err == client.ErrShutdown && xc.NumClients() == 0, "dial after close should fail without caching, got %v", err)
+}